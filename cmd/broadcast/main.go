@@ -8,11 +8,17 @@ import (
 	"syscall"
 
 	pkg "hex_toolset/pkg"
+	"hex_toolset/pkg/buildinfo"
+	"hex_toolset/pkg/db"
+	"hex_toolset/pkg/db/migrations"
 	"hex_toolset/pkg/logger"
 	"hex_toolset/pkg/managers"
 )
 
 func main() {
+	// Keep recent entries of every logger for /logz (LOG_RECENT overrides the count)
+	logger.SetDefaultRecent(logger.DefaultRecent)
+
 	// Initialize logger
 	logg, err := logger.New(logger.WithName("broadcast"), logger.WithConsole(true))
 	if err != nil {
@@ -20,6 +26,7 @@ func main() {
 		return
 	}
 	defer logg.Close()
+	logg.Infof("%s", buildinfo.Banner("broadcast"))
 
 	cfg := pkg.GetConfig()
 	mgr := managers.NewBroadcastManager(cfg, logg)
@@ -27,6 +34,30 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// The messages db_clon writes follow its schema: with DB_BOOTSTRAP bring the database up
+	// to this build, and refuse to start when it is of another schema version, e.g. after a
+	// partial upgrade
+	if cfg.SFC_CLON != "" || cfg.DB_DRIVER == db.DriverPostgres {
+		if err := checkSchema(ctx, cfg); err != nil {
+			logg.Errorf("database schema check failed, not starting: %v", err)
+			return
+		}
+	}
+
+	// Runtime log levels: SIGHUP re-reads LOG_LEVEL from .env; the admin endpoint changes
+	// them directly (and is the only way on Windows).
+	logger.WatchLevelSignal(ctx, ".env", logg)
+	adminTokens, tokenErr := managers.ParseAdminTokens(cfg.ADMIN_TOKENS)
+	if tokenErr != nil {
+		logg.Errorf("invalid ADMIN_TOKENS, admin endpoint disabled: %v", tokenErr)
+	}
+	if addr := cfg.BROADCAST_ADMIN_ADDR; addr != "" && tokenErr == nil {
+		admin := managers.NewAdminServer(addr, logg)
+		admin.RequireTokens(adminTokens)
+		admin.HandleBandwidth(mgr.Bandwidth())
+		go admin.Run(ctx)
+	}
+
 	// Graceful shutdown on interrupt
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
@@ -41,3 +72,21 @@ func main() {
 		logg.Errorf("broadcast manager exited with error: %v", err)
 	}
 }
+
+// checkSchema verifies the schema of the database of cfg, which db_clon must have created
+// unless DB_BOOTSTRAP creates it here; the connection is closed again as the broadcast
+// service does not use the database.
+func checkSchema(ctx context.Context, cfg *pkg.Config) error {
+	if cfg.DB_DRIVER != db.DriverPostgres && !cfg.DB_BOOTSTRAP {
+		if _, err := os.Stat(cfg.SFC_CLON); err != nil {
+			return fmt.Errorf("SFC_CLON %s: %w (start db_clon first, or unset SFC_CLON where the database is on another host)", cfg.SFC_CLON, err)
+		}
+	}
+	conn := db.GetInstance()
+	if err := conn.InitDefault(ctx); err != nil {
+		return err
+	}
+	defer conn.CloseDB()
+	_, err := migrations.Bootstrap(ctx, conn.GetDB(), cfg.DB_BOOTSTRAP)
+	return err
+}
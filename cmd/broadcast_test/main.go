@@ -4,13 +4,13 @@ import (
 	"context"
 	"fmt"
 	"hex_toolset/pkg/db"
-	"hex_toolset/pkg/db/entities"
 	"hex_toolset/pkg/logger"
 	"hex_toolset/pkg/managers"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 )
 
 //import (
@@ -75,9 +75,7 @@ func main() {
 		fmt.Println("DB initialized")
 	}
 
-	entityManager := entities.NewLatestPassManager(db.GetDB())
-
-	latest, err := entityManager.GetMap()
+	latest, err := managers.BuildLatestSnapshot(ctx, db.GetDB(), nil, time.Now())
 	if err != nil {
 		log.Fatalf("failed to get latest: %v", err)
 		return
@@ -88,7 +86,7 @@ func main() {
 		log.Fatalf("failed to create StoreFileManager: %v", err)
 	}
 
-	_, err = storeManager.SaveWithTimestampWrapped("latest", "LATEST", latest)
+	err = managers.NewFilePublisher(storeManager).Publish(managers.TopicLatest, latest)
 	//ticker := time.NewTicker(2 * time.Second)
 	//defer ticker.Stop()
 	//
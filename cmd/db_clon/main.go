@@ -3,8 +3,14 @@ package main
 import (
 	"context"
 	"fmt"
+	pkg "hex_toolset/pkg"
+	"hex_toolset/pkg/buildinfo"
 	"hex_toolset/pkg/db"
+	"hex_toolset/pkg/db/migrations"
+	"hex_toolset/pkg/logger"
 	"hex_toolset/pkg/managers"
+	"hex_toolset/pkg/shifts"
+	"hex_toolset/pkg/timeutil"
 
 	"os"
 	"os/signal"
@@ -13,10 +19,18 @@ import (
 )
 
 func main() {
+	// Keep recent entries of every logger for /logz (LOG_RECENT overrides the count)
+	logger.SetDefaultRecent(logger.DefaultRecent)
+
 	// Root context that cancels on SIGINT/SIGTERM for graceful shutdown
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
 
+	if err := pkg.GetConfig().Validate(); err != nil {
+		fmt.Printf("Error: invalid configuration: %v\n", err)
+		return
+	}
+
 	err := db.GetInstance().InitDefault(ctx)
 	if err != nil {
 		fmt.Printf("Error initializing database: %v\n", err)
@@ -32,15 +46,177 @@ func main() {
 
 	fmt.Println("DB initialized")
 
+	// With DB_BOOTSTRAP apply pending migrations so a fresh deployment or an upgrade does
+	// not depend on db_manager; either way refuse to start on a database of another schema
+	// version or with schema objects missing, before any loop or endpoint uses it
+	bootstrap := pkg.GetConfig().DB_BOOTSTRAP
+	applied, err := migrations.Bootstrap(ctx, db.GetDB(), bootstrap)
+	if err != nil {
+		fmt.Printf("Error checking database schema: %v\n", err)
+		return
+	}
+	if bootstrap {
+		fmt.Printf("DB schema at version %d (%d migrations applied)\n", migrations.Latest(), len(applied))
+	}
+
+	// Runtime log levels: SIGHUP re-reads LOG_LEVEL from .env; the admin endpoint changes
+	// them directly (and is the only way on Windows).
+	adminLog, _ := logger.New(logger.WithName("admin"), logger.WithFilePattern("{name}.log"))
+	adminLog.Infof("%s", buildinfo.Banner("db_clon"))
+	logger.WatchLevelSignal(ctx, ".env", adminLog)
+
+	// Unauthenticated lobby-display snapshot, on its own listener
+	if cfg := pkg.GetConfig(); cfg.PUBLIC_ADDR != "" {
+		if fields, err := managers.ParsePublicFields(cfg.PUBLIC_FIELDS); err != nil {
+			fmt.Printf("invalid PUBLIC_FIELDS, public snapshot disabled: %v\n", err)
+		} else {
+			publicLog, _ := logger.New(logger.WithName("public"), logger.WithFilePattern("{name}.log"))
+			go managers.NewPublicServer(cfg.PUBLIC_ADDR, db.GetDB(), managers.PublicOptions{
+				Fields:      fields,
+				OutputGroup: cfg.PUBLIC_OUTPUT_GROUP,
+				CacheTTL:    time.Duration(cfg.PUBLIC_CACHE_SECONDS) * time.Second,
+				RatePerMin:  cfg.PUBLIC_RATE_PER_MINUTE,
+				IdleAfter:   time.Duration(cfg.PUBLIC_IDLE_MINUTES) * time.Minute,
+			}, publicLog).Run(ctx)
+		}
+	}
+
 	// Initialize managers with the long-lived context
+	clock := timeutil.SystemClock
+	if offset := pkg.GetConfig().CLOCK_OFFSET_MINUTES; offset != 0 {
+		clock = timeutil.OffsetClock(clock, time.Duration(offset)*time.Minute)
+		fmt.Printf("running with the clock shifted by %d minute(s), now %s\n", offset, clock.Now().Format(timeutil.DBLayout))
+	}
 	sfcManager := managers.NewSFCAPIManager(&ctx)
-	lm := managers.NewLoopsManager(ctx)
-	defer lm.Stop() // ensure loops are stopped on exit
+	sfcManager.SetClock(clock)
+	if path := pkg.GetConfig().IPC_SOCKET; path != "" {
+		// Push broadcasts over the local socket; MESSAGE_DIR files remain the fallback.
+		if store, err := managers.NewStoreFileManager(); err != nil {
+			fmt.Printf("ipc publisher disabled: %v\n", err)
+		} else {
+			pub := managers.NewIPCPublisher(path, managers.NewFilePublisher(store))
+			defer pub.Close()
+			sfcManager.SetPublisher(pub)
+		}
+	}
+	var mqttPub managers.Publisher
+	if url := pkg.GetConfig().MQTT_URL; url != "" {
+		// Every broadcast also goes to the MQTT broker, next to the websocket transport.
+		if pub, err := managers.NewMQTTPublisher(url, pkg.GetConfig().MQTT_TOPIC_PREFIX); err != nil {
+			fmt.Printf("mqtt publisher disabled: %v\n", err)
+		} else {
+			defer pub.Close()
+			mqttPub = pub
+			sfcManager.SetPublisher(managers.MultiPublisher{sfcManager.Publisher(), pub})
+		}
+	}
+	if path := pkg.GetConfig().HEARTBEAT_FILE; path != "" {
+		sfcManager.SetHeartbeat(managers.NewHeartbeat(path))
+	}
+	historyLog, _ := logger.New(logger.WithName("pass_history"), logger.WithFilePattern("{name}.log"))
+	history := managers.NewPassHistory(db.GetDB(), pkg.GetConfig().PASS_HISTORY_SLOTS, historyLog)
+	if err := history.Apply(); err != nil {
+		fmt.Printf("pass history mode not applied: %v\n", err)
+	}
+	// Optional subsystems subscribe to the manager's events; DISABLED_SUBSYSTEMS leaves
+	// them out of this deployment
+	enabled := pkg.GetConfig().SubsystemEnabled
+	var modelRuns *managers.ModelRuns
+	if group := pkg.GetConfig().MODEL_RUN_GROUP; group != "" && enabled("model_runs") {
+		runsLog, _ := logger.New(logger.WithName("model_runs"), logger.WithFilePattern("{name}.log"))
+		modelRuns = managers.NewModelRuns(ctx, db.GetDB(), group, runsLog)
+		modelRuns.Attach(sfcManager.Bus())
+	}
+	if every := pkg.GetConfig().LATEST_SNAPSHOT_MINUTES; every > 0 && enabled("latest_snapshot") {
+		latestLog, _ := logger.New(logger.WithName("latest_snapshot"), logger.WithFilePattern("{name}.log"))
+		latest := managers.NewLatestPublisher(db.GetDB(), time.Duration(every)*time.Minute, latestLog)
+		latest.SetPerLine(pkg.GetConfig().LATEST_LINE_SNAPSHOTS)
+		latest.Attach(sfcManager)
+	}
+	var stationTargets *managers.StationTargets
+	if window := pkg.GetConfig().STATION_VARIANCE_WINDOW_MINUTES; window > 0 && enabled("station_variance") {
+		varianceLog, _ := logger.New(logger.WithName("station_variance"), logger.WithFilePattern("{name}.log"))
+		ttl := time.Duration(pkg.GetConfig().FEATURE_FLAG_TTL_SECONDS) * time.Second
+		stationTargets = managers.NewStationTargets(db.GetDB(), window, ttl, varianceLog)
+		stationTargets.Attach(sfcManager)
+	}
+	cal, calErr := shifts.Parse(pkg.GetConfig().SHIFTS, time.Local)
+	var oee *managers.OEE
+	if calErr == nil && enabled("oee") {
+		oeeLog, _ := logger.New(logger.WithName("oee"), logger.WithFilePattern("{name}.log"))
+		oee = managers.NewOEE(cal, db.GetDB(), time.Duration(pkg.GetConfig().OEE_STOP_MINUTES)*time.Minute, oeeLog)
+		oee.SetMaintenance(sfcManager.Maintenance())
+	}
+	integrityLog, _ := logger.New(logger.WithName("integrity"), logger.WithFilePattern("{name}.log"))
+	integrity := managers.NewIntegrityChecker(db.GetDB(), sfcManager.Alerts(), integrityLog)
+	sloLog, _ := logger.New(logger.WithName("slo"), logger.WithFilePattern("{name}.log"))
+	slo := managers.NewSLOTracker(db.GetDB(), managers.DefaultIngestSLO(), sloLog)
+	adminTokens, tokenErr := managers.ParseAdminTokens(pkg.GetConfig().ADMIN_TOKENS)
+	if tokenErr != nil {
+		fmt.Printf("invalid ADMIN_TOKENS, admin endpoint disabled: %v\n", tokenErr)
+	}
+	if addr := pkg.GetConfig().ADMIN_ADDR; addr != "" && tokenErr == nil {
+		admin := managers.NewAdminServer(addr, adminLog)
+		admin.RequireTokens(adminTokens)
+		admin.HandleAudit(managers.NewAuditLog(db.GetDB(), adminLog))
+		admin.HandleLineMaintenance(sfcManager.Lines())
+		admin.HandleMaintenanceWindows(sfcManager.Maintenance())
+		admin.HandleEnrichment(sfcManager.Enrichment())
+		admin.HandleFlowGraph(db.GetDB())
+		admin.HandleRecords(db.GetDB())
+		admin.HandleWIP(db.GetDB())
+		admin.HandleProgramRollup(managers.NewProgramRollup(db.GetDB(), pkg.GetConfig().PUBLIC_OUTPUT_GROUP))
+		admin.HandleSLO(slo)
+		admin.HandleTakt(history)
+		admin.HandleIntegrity(integrity)
+		compactLog, _ := logger.New(logger.WithName("compaction"), logger.WithFilePattern("{name}.log"))
+		admin.HandleCompact(managers.NewCompactor(db.GetDB(), db.GetInstance().DBPath(), compactLog))
+		if modelRuns != nil {
+			admin.HandleModelRuns(modelRuns)
+		}
+		if stationTargets != nil {
+			admin.HandleStationTargets(stationTargets)
+		}
+		if oee != nil {
+			admin.HandleOEE(oee)
+		}
+		admin.HandleWeeklyTrend(managers.NewWeeklyTrend(db.GetDB(), pkg.GetConfig().PUBLIC_OUTPUT_GROUP, oee))
+		storageLog, _ := logger.New(logger.WithName("storage"), logger.WithFilePattern("{name}.log"))
+		capacity := int64(pkg.GetConfig().STORAGE_CAPACITY_GB * (1 << 30))
+		// records stay in records_table until tiering archives them or, without tiering,
+		// retention deletes them (RETENTION_DAYS exceeds TIER_RAW_DAYS)
+		rawDays := pkg.GetConfig().TIER_RAW_DAYS
+		if rawDays == 0 {
+			rawDays = pkg.GetConfig().RETENTION_DAYS
+		}
+		admin.HandleStorage(managers.NewStorageForecast(db.GetDB(), rawDays,
+			pkg.GetConfig().STORAGE_HISTORY_DAYS, capacity, storageLog))
+		go admin.Run(ctx)
+	}
+	if cfg := pkg.GetConfig(); cfg.PUSH_ADDR != "" {
+		if keys, err := managers.ParsePushKeys(cfg.PUSH_KEYS); err != nil {
+			fmt.Printf("invalid PUSH_KEYS, push ingest disabled: %v\n", err)
+		} else if len(keys) == 0 {
+			fmt.Println("PUSH_ADDR set without PUSH_KEYS, push ingest disabled")
+		} else {
+			pushLog, _ := logger.New(logger.WithName("push"), logger.WithFilePattern("{name}.log"))
+			go managers.NewPushServer(cfg.PUSH_ADDR, sfcManager, keys, pushLog).Run(ctx)
+		}
+	}
+	lm := managers.NewLoopsManagerWithClock(ctx, clock)
+	slo.Schedule(lm)
 
 	// Start loops (run in parallel)
+	repairEvery := pkg.GetConfig().REPAIR_INTERVAL_MINUTES
+	minuteTiming := []managers.JobOption{
+		managers.WithPhaseOffset(time.Duration(pkg.GetConfig().MINUTE_LOOP_OFFSET_SECONDS) * time.Second),
+		managers.WithJitter(0, time.Duration(pkg.GetConfig().MINUTE_LOOP_JITTER_SECONDS)*time.Second),
+	}
 	lm.StartEveryMinute(func(ctx context.Context, minute time.Time) {
-		sfcManager.RequestMinute(minute)
-	})
+		sfcManager.RequestMinuteContext(ctx, minute)
+		// fill the minutes of this hour missing from the ingest ledger
+		sfcManager.AutoRepair(ctx, minute, repairEvery)
+	}, minuteTiming...)
 
 	lm.StartEveryHour(func(ctx context.Context) {
 		// hourly job at hh:00:02
@@ -50,16 +226,97 @@ func main() {
 		// daily job at 17:00:00
 	})
 
+	// Freeze shift summaries at each shift end, then publish the shift's OEE
+	if calErr != nil {
+		fmt.Printf("invalid SHIFTS configuration, shift closing disabled: %v\n", calErr)
+	} else if store, err := managers.NewStoreFileManager(); err != nil {
+		fmt.Printf("shift closing disabled: %v\n", err)
+	} else {
+		shiftLog, _ := logger.New(logger.WithName("shift_manager"), logger.WithFilePattern("{name}.log"))
+		var shiftPub managers.Publisher = managers.NewFilePublisher(store)
+		if mqttPub != nil {
+			shiftPub = managers.MultiPublisher{shiftPub, mqttPub}
+		}
+		sm := managers.NewShiftManager(cal, db.GetDB(), shiftPub, shiftLog)
+		if oee != nil {
+			oee.Attach(sm)
+		}
+		sm.Schedule(lm)
+	}
+
+	// Nightly incremental export to the configured destinations
+	cfg := pkg.GetConfig()
+	if dests, err := managers.ParseExportDestinations(cfg.EXPORT_DESTINATIONS); err != nil {
+		fmt.Printf("invalid EXPORT_DESTINATIONS, export disabled: %v\n", err)
+	} else if len(dests) > 0 && enabled("export") {
+		at, err := time.Parse("15:04", cfg.EXPORT_AT)
+		if err != nil {
+			fmt.Printf("invalid EXPORT_AT %q, export disabled: %v\n", cfg.EXPORT_AT, err)
+		} else {
+			exportLog, _ := logger.New(logger.WithName("export_manager"), logger.WithFilePattern("{name}.log"))
+			lag := time.Duration(cfg.EXPORT_LAG_MINUTES) * time.Minute
+			managers.NewExportManager(db.GetDB(), lag, exportLog).Schedule(lm, at.Hour(), at.Minute(), dests)
+		}
+	}
+
+	// Roll up and archive raw records older than TIER_RAW_DAYS
+	if cfg.TIER_RAW_DAYS > 0 && enabled("tiering") {
+		at, err := time.Parse("15:04", cfg.TIER_AT)
+		if err != nil {
+			fmt.Printf("invalid TIER_AT %q, tiering disabled: %v\n", cfg.TIER_AT, err)
+		} else {
+			tierLog, _ := logger.New(logger.WithName("tiering"), logger.WithFilePattern("{name}.log"))
+			managers.NewTieringManager(db.GetDB(), cfg.TIER_ARCHIVE_DIR, cfg.TIER_RAW_DAYS, tierLog).Schedule(lm, at.Hour(), at.Minute())
+		}
+	}
+
+	// Delete records older than RETENTION_DAYS
+	if cfg.RETENTION_DAYS > 0 && enabled("retention") {
+		at, err := time.Parse("15:04", cfg.RETENTION_AT)
+		if err != nil {
+			fmt.Printf("invalid RETENTION_AT %q, retention disabled: %v\n", cfg.RETENTION_AT, err)
+		} else {
+			retentionLog, _ := logger.New(logger.WithName("retention"), logger.WithFilePattern("{name}.log"))
+			managers.NewRetentionManager(db.GetDB(), cfg.RETENTION_DAYS, cfg.RETENTION_BATCH, retentionLog).Schedule(lm, at.Hour(), at.Minute())
+		}
+	}
+
+	// Trim the pass history during an idle hour
+	if history.Enabled() {
+		if at, err := time.Parse("15:04", cfg.PASS_HISTORY_COMPACT_AT); err != nil {
+			fmt.Printf("invalid PASS_HISTORY_COMPACT_AT %q, pass history compaction disabled: %v\n", cfg.PASS_HISTORY_COMPACT_AT, err)
+		} else {
+			history.Schedule(lm, at.Hour(), at.Minute())
+		}
+	}
+
+	// Check the database file and schema during an idle hour (SQLite's pragmas; check
+	// PostgreSQL with pg_amcheck)
+	if cfg.INTEGRITY_CHECK_AT != "" && enabled("integrity") && db.GetInstance().Driver() == db.DriverSQLite {
+		at, err := time.Parse("15:04", cfg.INTEGRITY_CHECK_AT)
+		fullDay, dayErr := managers.ParseWeekday(cfg.INTEGRITY_FULL_CHECK_DAY)
+		switch {
+		case err != nil:
+			fmt.Printf("invalid INTEGRITY_CHECK_AT %q, integrity check disabled: %v\n", cfg.INTEGRITY_CHECK_AT, err)
+		case dayErr != nil:
+			fmt.Printf("invalid INTEGRITY_FULL_CHECK_DAY, integrity check disabled: %v\n", dayErr)
+		default:
+			integrity.Schedule(lm, at.Hour(), at.Minute(), fullDay)
+		}
+	}
+
 	// Block until a shutdown signal is received
 	<-ctx.Done()
 
-	// Optional: give loops a short window to finish in-flight work
+	// Give loops a short window to finish in-flight work; a minute insert stops at its
+	// next chunk, keeping the chunks it committed (the minute is not recorded as ingested,
+	// so the ledger repair fetches it again after restart)
 	shutdownCtx, stop := context.WithTimeout(context.Background(), 5*time.Second)
 	defer stop()
+	if err := lm.StopWithin(shutdownCtx); err != nil {
+		fmt.Printf("loops still running after the shutdown window, exiting anyway: %v\n", err)
+	}
 
-	// Wait for loops to stop; Stop() is already deferred, but we can call explicitly here
-	lm.Stop()
-
-	// If additional services need shutdown, coordinate them here using shutdownCtx
-	_ = shutdownCtx
+	// Write the entries still queued by async loggers (LOG_ASYNC_BUFFER)
+	logger.FlushAll()
 }
@@ -2,54 +2,230 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
+	"hex_toolset/pkg/cli"
 	"hex_toolset/pkg/db"
 	"hex_toolset/pkg/db/entities"
-	"log"
+	"hex_toolset/pkg/db/migrations"
+	"hex_toolset/pkg/logger"
+	"io"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 )
 
+const usage = `usage:
+  db_manager [--output json|table|quiet] [--to VERSION]
+  db_manager [--output json|table|quiet] --status
+  db_manager [--output json|table|quiet] --repair [--only STEP[,STEP]] [--drop-recreate TRIGGER[,TRIGGER]]
+  db_manager [--output json|table|quiet] --verify [--only STEP[,STEP]]
+
+  (default)        apply the pending schema migrations (see pkg/db/migrations)
+  --to             migrate up or down to this version instead of the latest
+  --status         list the migrations of this build and when the database got them
+  --repair         run the baseline schema steps again, creating the tables, indexes and
+                   triggers a database lacks
+  --only           run only these schema steps: a step name, a table ("records") or "triggers"
+  --drop-recreate  drop these triggers ("triggers" for all) and create them again; stop the
+                   ingest first, inserts in between do not update latest_pass/latest_group
+  --verify         compare the database with the schema and change nothing; exits 1 when
+                   objects are missing or differ`
+
 func main() {
-	fmt.Println("DB Manager is running")
+	format, args, err := cli.ExtractOutputFlag(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+	out := cli.NewPrinter(format)
+	// exit through the logger so the entries the entity managers queued are written
+	logger.Exit(run(out, args))
+}
+
+func run(out *cli.Printer, args []string) int {
+	res := cli.Result{Command: "db_manager", StartedAt: time.Now(), Data: map[string]any{}}
+
+	fs := flag.NewFlagSet("db_manager", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	only := fs.String("only", "", "schema steps to run, comma separated")
+	dropRecreate := fs.String("drop-recreate", "", "triggers to drop and create again, comma separated")
+	verify := fs.Bool("verify", false, "compare the database with the schema only")
+	repair := fs.Bool("repair", false, "run the baseline schema steps again")
+	status := fs.Bool("status", false, "list the migrations")
+	to := fs.Int("to", 0, "version to migrate to")
+	if err := fs.Parse(args); err != nil {
+		out.Message("%s", usage)
+		return out.Finish(&res, err)
+	}
+	if fs.NArg() > 0 {
+		out.Message("%s", usage)
+		return out.Finish(&res, fmt.Errorf("unexpected argument %q", fs.Arg(0)))
+	}
+	if *verify && *dropRecreate != "" {
+		return out.Finish(&res, fmt.Errorf("--verify and --drop-recreate exclude each other"))
+	}
+	if (*only != "" || *dropRecreate != "") && !*verify {
+		*repair = true
+	}
+	if n := countTrue(*verify, *repair, *status, *to != 0); n > 1 {
+		return out.Finish(&res, fmt.Errorf("--verify, --repair, --status and --to exclude each other"))
+	}
+
+	out.Message("DB Manager is running")
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
 
 	if err := db.GetInstance().InitDefault(ctx); err != nil {
-		log.Fatal(err)
+		return out.Finish(&res, err)
 	}
 	if err := db.GetInstance().HealthCheck(ctx); err != nil {
-		log.Fatal(err)
+		return out.Finish(&res, err)
 	}
 	defer func() {
 		if err := db.GetInstance().CloseDB(); err != nil {
-			log.Printf("close db error: %v", err)
+			fmt.Fprintf(os.Stderr, "close db error: %v\n", err)
 		}
 	}()
 
-	dbInstance := db.GetInstance().GetDB()
+	var changes []entities.SchemaChange
+	var err error
+	switch {
+	case *status:
+		res.Command = "db_manager status"
+		return out.Finish(&res, migrationStatus(ctx, out, &res))
+	case !*verify && !*repair:
+		res.Command = "db_manager migrate"
+		return out.Finish(&res, migrate(ctx, out, &res, *to))
+	case *verify:
+		res.Command = "db_manager verify"
+		changes, err = entities.VerifySchema(ctx, db.GetInstance().GetDB(), splitList(*only))
+		for i, c := range changes {
+			progress(out, i+1, len(changes), c)
+		}
+		if n := countStatus(changes, entities.SchemaMissing, entities.SchemaDiffers); err == nil && n > 0 {
+			err = fmt.Errorf("%d schema step(s) missing or differing", n)
+		}
+	default:
+		res.Command = "db_manager repair"
+		changes, err = entities.ApplySchema(ctx, db.GetInstance().GetDB(), entities.SchemaOptions{
+			Only:         splitList(*only),
+			DropRecreate: splitList(*dropRecreate),
+			Progress:     func(i, n int, c entities.SchemaChange) { progress(out, i, n, c) },
+		})
+	}
+	summarize(out, &res, changes)
+	return out.Finish(&res, err)
+}
 
-	if err := entities.NewRecordManagerEntity(dbInstance).CreateTable(); err != nil {
-		log.Fatal(err)
+// migrate applies the pending migrations, or migrates to version to.
+func migrate(ctx context.Context, out *cli.Printer, res *cli.Result, to int) error {
+	applied, err := migrations.Migrate(ctx, db.GetInstance().GetDB(), migrations.Options{
+		Target:         to,
+		SchemaProgress: func(i, n int, c entities.SchemaChange) { progress(out, i, n, c) },
+		Progress: func(a migrations.Applied) {
+			out.Message("migration %d (%s): %s", a.Version, a.Name, a.Direction)
+		},
+	})
+	if err == nil && len(applied) == 0 {
+		if to == 0 {
+			to = migrations.Latest()
+		}
+		out.Message("database is at version %d, nothing to do", to)
 	}
-	if err := entities.NewLatestPassManager(dbInstance).CreateTable(); err != nil {
-		log.Fatal(err)
+	names := []string{}
+	for _, a := range applied {
+		names = append(names, fmt.Sprintf("%d %s %s", a.Version, a.Name, a.Direction))
 	}
-	if err := entities.NewLatestGroupManager(dbInstance).CreateTable(); err != nil {
-		log.Fatal(err)
+	res.Data["applied"] = names
+	if out.Format == cli.FormatJSON {
+		res.Data["migrations"] = applied
 	}
-	// Create triggers
-	if err := (entities.NewTriggersManager(dbInstance)).CreateRecordsPassUpsertTrigger(); err != nil {
-		log.Fatal(err)
+	return err
+}
+
+// migrationStatus lists the migrations of this build and when the database applied them.
+func migrationStatus(ctx context.Context, out *cli.Printer, res *cli.Result) error {
+	states, err := migrations.Status(ctx, db.GetInstance().GetDB())
+	if err != nil {
+		return err
 	}
-	if err := (entities.NewTriggersManager(dbInstance)).CreateRecordsGroupUpsertTrigger(); err != nil {
-		log.Fatal(err)
+	pending := 0
+	for _, s := range states {
+		at := s.AppliedAt
+		switch {
+		case s.Name == "":
+			at += " (unknown to this build)"
+		case at == "":
+			at = "pending"
+			pending++
+		}
+		out.Message("%4d  %-30s %s", s.Version, s.Name, at)
 	}
-	err := db.GetInstance().CloseDB()
-	if err != nil {
+	res.Data["pending"] = pending
+	if out.Format == cli.FormatJSON {
+		res.Data["migrations"] = states
+	}
+	return nil
+}
+
+func countTrue(bs ...bool) int {
+	n := 0
+	for _, b := range bs {
+		if b {
+			n++
+		}
+	}
+	return n
+}
+
+// progress prints one finished step, e.g. "[ 3/20] latest_group: created index idx_latest_group_ts".
+func progress(out *cli.Printer, i, n int, c entities.SchemaChange) {
+	if c.Status == entities.SchemaSkipped {
 		return
 	}
+	line := fmt.Sprintf("[%*d/%d] %s: %s", len(fmt.Sprint(n)), i, n, c.Step, c.Status)
+	if len(c.Objects) > 0 {
+		line += " " + strings.Join(c.Objects, ", ")
+	}
+	out.Message("%s", line)
+}
 
-	fmt.Println("DB end")
+// summarize lists the steps by status in res, and every change in json output.
+func summarize(out *cli.Printer, res *cli.Result, changes []entities.SchemaChange) {
+	by := map[string][]string{}
+	for _, c := range changes {
+		by[c.Status] = append(by[c.Status], c.Step)
+	}
+	for status, steps := range by {
+		res.Data[status] = steps
+	}
+	if out.Format == cli.FormatJSON {
+		res.Data["steps"] = changes
+	}
+}
+
+func countStatus(changes []entities.SchemaChange, statuses ...string) int {
+	n := 0
+	for _, c := range changes {
+		for _, s := range statuses {
+			if c.Status == s {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
 }
@@ -3,20 +3,84 @@ package main
 import (
 	"context"
 	"fmt"
+	pkg "hex_toolset/pkg"
+	"hex_toolset/pkg/cli"
 	"hex_toolset/pkg/db"
+	"hex_toolset/pkg/db/entities"
 	"hex_toolset/pkg/logger"
 	"hex_toolset/pkg/managers"
+	"hex_toolset/pkg/shifts"
+	"hex_toolset/pkg/timeutil"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 )
 
+const usage = `usage:
+  fix [--output json|table|quiet] load_day YYYY-MM-DD
+  fix [--output json|table|quiet] load_days YYYY-MM-DD YYYY-MM-DD
+  fix [--output json|table|quiet] load_hour "YYYY-MM-DD HH"
+  fix [--output json|table|quiet] repair_hour ["YYYY-MM-DD HH"]
+  fix [--output json|table|quiet] export [destination]
+  fix [--output json|table|quiet] rename_group [--dry-run] OLD NEW [LINE]
+  fix [--output json|table|quiet] rename_station [--dry-run] OLD NEW [LINE]
+  fix [--output json|table|quiet] flags
+  fix [--output json|table|quiet] flag NAME on|off
+  fix [--output json|table|quiet] null_audit [--fill]
+  fix [--output json|table|quiet] archive [KEEP_DAYS]
+  fix [--output json|table|quiet] prune [KEEP_DAYS]
+  fix [--output json|table|quiet] counts RANGE
+  fix [--output json|table|quiet] rekey_ids RANGE
+  fix [--output json|table|quiet] import_dump [--dry-run] FILE
+  fix [--output json|table|quiet] oee RANGE [LINE]`
+
 func main() {
+	format, args, err := cli.ExtractOutputFlag(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+	out := cli.NewPrinter(format)
+	if format == cli.FormatTable {
+		// run interactively: entries to read rather than to parse
+		logger.SetDefaultConsoleFormat(logger.Pretty)
+	}
+	// exit through the logger so the entries still queued are written
+	logger.Exit(run(out, args))
+}
+
+// run executes the command and returns the process exit code. It is split from main
+// so deferred cleanup (DB, logger) runs before os.Exit.
+func run(out *cli.Printer, args []string) int {
 	// Root context that cancels on SIGINT/SIGTERM for graceful shutdown
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
 
+	res := cli.Result{Command: "fix", StartedAt: time.Now(), Data: map[string]any{}}
+	if len(args) > 0 {
+		res.Command = "fix " + args[0]
+	}
+	// failures counts the failed units of work for the status file; see finish.
+	var failures func() int
+	finish := func(err error) int {
+		code := out.Finish(&res, err)
+		writeStatus(res, code, failures, err)
+		return code
+	}
+
+	cmd, err := parseCommand(args)
+	if err != nil {
+		out.Message("%s", usage)
+		return finish(err)
+	}
+	for k, v := range cmd.data {
+		res.Data[k] = v
+	}
+
 	// Create custom logger named sfc_loader
 	lgr, _ := logger.New(
 		logger.WithName("sfc_loader"),
@@ -30,7 +94,7 @@ func main() {
 			if lgr != nil {
 				lgr.Errorf("error closing database: %v", err)
 			} else {
-				fmt.Printf("error closing database: %v\n", err)
+				fmt.Fprintf(os.Stderr, "error closing database: %v\n", err)
 			}
 		}
 		if lgr != nil {
@@ -41,23 +105,17 @@ func main() {
 	if err := db.GetInstance().InitDefault(ctx); err != nil {
 		if lgr != nil {
 			lgr.Errorf("Error initializing database: %v", err)
-		} else {
-			fmt.Printf("Error initializing database: %v\n", err)
 		}
-		return
+		return finish(fmt.Errorf("initializing database: %w", err))
 	}
 	if err := db.GetInstance().HealthCheck(ctx); err != nil {
 		if lgr != nil {
 			lgr.Errorf("Error checking database health: %v", err)
-		} else {
-			fmt.Printf("Error checking database health: %v\n", err)
 		}
-		return
+		return finish(fmt.Errorf("checking database health: %w", err))
 	}
 	if lgr != nil {
 		lgr.Infof("DB initialized")
-	} else {
-		fmt.Println("DB initialized")
 	}
 
 	// Initialize managers with the long-lived context
@@ -66,109 +124,539 @@ func main() {
 		if lgr != nil {
 			lgr.Errorf("failed to create SFC manager")
 		}
-		return
+		return finish(fmt.Errorf("failed to create SFC manager"))
+	}
+
+	// Whole-hour and multi-day reloads report their totals through the backfill hook.
+	var backfill *managers.BackfillComplete
+	sfcManager.OnBackfillComplete(func(ev managers.BackfillComplete) { backfill = &ev })
+	failures = cmd.failures
+	if failures == nil {
+		failures = func() int {
+			if backfill == nil {
+				return 0
+			}
+			return backfill.Failed
+		}
 	}
 
-	args := os.Args
-	if len(args) < 2 {
-		fmt.Println("usage:")
-		fmt.Println("  fix load_day YYYY-MM-DD")
-		fmt.Println("  fix load_days YYYY-MM-DD YYYY-MM-DD")
-		fmt.Println("  fix load_hour \"YYYY-MM-DD HH\"")
+	err = cmd.exec(ctx, sfcManager)
+	if cmd.audit {
+		managers.NewAuditLog(db.GetDB(), lgr).Record(context.WithoutCancel(ctx), managers.CLIActor(), "fix "+cmd.name, cmd.data, err)
+	}
+	if backfill != nil {
+		res.Data["records"] = backfill.Records
+		res.Data["failed_hours"] = backfill.Failed
+	}
+	if cmd.result != nil {
+		for k, v := range cmd.result() {
+			res.Data[k] = v
+		}
+	}
+	if err != nil {
+		if lgr != nil {
+			lgr.Errorf("%s failed: %v", cmd.name, err)
+		}
+		return finish(err)
+	}
+	if lgr != nil {
+		lgr.Infof("%s completed", cmd.name)
+	}
+	return finish(nil)
+}
+
+// command is a validated subcommand ready to execute.
+type command struct {
+	name string
+	data map[string]any
+	exec func(ctx context.Context, m *managers.SFCAPIManager) error
+	// result, when set, is merged into the printed result data after exec succeeds or fails.
+	result func() map[string]any
+	// failures, when set, counts the units of work that failed, for the status file.
+	// Otherwise the failed hours of a backfill are counted.
+	failures func() int
+	// audit records the command, with data as its parameters, in the audit log: set on
+	// the commands that change stored data or settings.
+	audit bool
+}
+
+// writeStatus leaves the outcome of the command in SFC_DB_STATUS, so the scripts that
+// schedule backfills can tell a partial failure from a clean run without parsing logs.
+// A failed command reports at least one failure. Nothing is written when SFC_DB_STATUS
+// is not set, and a write error only warns: the exit code already tells the outcome.
+func writeStatus(res cli.Result, code int, failures func() int, err error) {
+	dir := strings.TrimSpace(pkg.GetConfig().SFC_DB_STATUS)
+	if dir == "" {
 		return
 	}
+	st := cli.Status{Result: res, ExitCode: code}
+	if failures != nil {
+		st.Failures = failures()
+	}
+	if err != nil && st.Failures == 0 {
+		st.Failures = 1
+	}
+	if _, werr := cli.WriteStatus(dir, st); werr != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", werr)
+	}
+}
 
-	switch args[1] {
+// parseCommand validates the positional arguments before anything is opened.
+func parseCommand(args []string) (*command, error) {
+	if len(args) < 1 {
+		return nil, fmt.Errorf("missing command")
+	}
+
+	switch args[0] {
 	case "load_day":
+		if len(args) != 2 {
+			return nil, fmt.Errorf("usage: fix load_day YYYY-MM-DD")
+		}
+		date := args[1]
+		if _, err := timeutil.ParseDay(date, time.Local); err != nil {
+			return nil, err
+		}
+		return &command{
+			name:  "load_day",
+			audit: true,
+			data:  map[string]any{"date": date},
+			exec:  func(ctx context.Context, m *managers.SFCAPIManager) error { return m.LoadDay(ctx, date) },
+		}, nil
+
+	case "load_days":
 		if len(args) != 3 {
-			fmt.Println("usage: fix load_day YYYY-MM-DD")
-			return
+			return nil, fmt.Errorf("usage: fix load_days YYYY-MM-DD YYYY-MM-DD")
 		}
-		date := args[2]
-		if _, err := time.Parse("2006-01-02", date); err != nil {
-			fmt.Printf("invalid date %q, expected YYYY-MM-DD: %v\n", date, err)
-			return
+		start, end := args[1], args[2]
+		startT, err := timeutil.ParseDay(start, time.Local)
+		if err != nil {
+			return nil, fmt.Errorf("start: %w", err)
 		}
-		if err := sfcManager.LoadDay(ctx, date); err != nil {
-			if lgr != nil {
-				lgr.Errorf("load_day failed: %v", err)
-			} else {
-				fmt.Printf("load_day failed: %v\n", err)
+		endT, err := timeutil.ParseDay(end, time.Local)
+		if err != nil {
+			return nil, fmt.Errorf("end: %w", err)
+		}
+		if endT.Start.Before(startT.Start) {
+			return nil, fmt.Errorf("end date %s is before start date %s", end, start)
+		}
+		return &command{
+			name:  "load_days",
+			audit: true,
+			data:  map[string]any{"start": start, "end": end},
+			exec: func(ctx context.Context, m *managers.SFCAPIManager) error {
+				return m.LoadRangeOfDays(ctx, start, end)
+			},
+		}, nil
+
+	case "load_hour":
+		if len(args) != 2 {
+			return nil, fmt.Errorf("usage: fix load_hour \"YYYY-MM-DD HH\"")
+		}
+		hourStr := args[1]
+		if _, err := timeutil.ParseHour(hourStr, time.Local); err != nil {
+			return nil, err
+		}
+		return &command{
+			name:  "load_hour",
+			audit: true,
+			data:  map[string]any{"hour": hourStr},
+			exec:  func(ctx context.Context, m *managers.SFCAPIManager) error { return m.LoadHour(hourStr) },
+		}, nil
+
+	case "repair_hour":
+		// Without an argument the current hour is repaired up to the last completed minute.
+		if len(args) > 2 {
+			return nil, fmt.Errorf("usage: fix repair_hour [\"YYYY-MM-DD HH\"]")
+		}
+		now := time.Now()
+		hour, until := now, now.Truncate(time.Minute).Add(-time.Minute)
+		if len(args) == 2 {
+			r, err := timeutil.ParseHour(args[1], time.Local)
+			if err != nil {
+				return nil, err
+			}
+			hour = r.Start
+			if r.End.Before(until) {
+				until = r.End
 			}
-			return
 		}
-		if lgr != nil {
-			lgr.Infof("load_day completed for %s", date)
+		var rr managers.RepairResult
+		return &command{
+			name:  "repair_hour",
+			audit: true,
+			data:  map[string]any{"hour": hour.Format(timeutil.HourLayout)},
+			exec: func(ctx context.Context, m *managers.SFCAPIManager) error {
+				var err error
+				rr, err = m.RepairHour(ctx, hour, until)
+				return err
+			},
+			failures: func() int { return rr.Failed },
+			result: func() map[string]any {
+				return map[string]any{
+					"until":    rr.Until.Format(time.DateTime),
+					"missing":  rr.Missing,
+					"repaired": rr.Repaired,
+					"failed":   rr.Failed,
+					"records":  rr.Records,
+				}
+			},
+		}, nil
+
+	case "export":
+		// Runs the incremental export now, for every EXPORT_DESTINATIONS entry or only the named one.
+		if len(args) > 2 {
+			return nil, fmt.Errorf("usage: fix export [destination]")
+		}
+		cfg := pkg.GetConfig()
+		dests, err := managers.ParseExportDestinations(cfg.EXPORT_DESTINATIONS)
+		if err != nil {
+			return nil, err
+		}
+		if len(args) == 2 {
+			var picked []managers.ExportDestination
+			for _, d := range dests {
+				if d.Name == args[1] {
+					picked = append(picked, d)
+				}
+			}
+			if len(picked) == 0 {
+				return nil, fmt.Errorf("unknown export destination %q", args[1])
+			}
+			dests = picked
+		}
+		if len(dests) == 0 {
+			return nil, fmt.Errorf("no export destinations configured (EXPORT_DESTINATIONS)")
 		}
+		var results []managers.ExportResult
+		return &command{
+			name:  "export",
+			audit: true,
+			data:  map[string]any{},
+			exec: func(ctx context.Context, _ *managers.SFCAPIManager) error {
+				exportLog, _ := logger.New(logger.WithName("export_manager"), logger.WithFilePattern("{name}.log"))
+				if exportLog != nil {
+					defer exportLog.Close()
+				}
+				lag := time.Duration(cfg.EXPORT_LAG_MINUTES) * time.Minute
+				var err error
+				results, err = managers.NewExportManager(db.GetDB(), lag, exportLog).ExportAll(ctx, dests)
+				return err
+			},
+			result: func() map[string]any {
+				var rows int64
+				files := []string{}
+				for _, r := range results {
+					rows += r.Rows
+					if r.File != "" {
+						files = append(files, r.File)
+					}
+				}
+				return map[string]any{"destinations": len(results), "rows": rows, "files": files, "exports": results}
+			},
+		}, nil
 
-	case "load_days":
-		if len(args) != 4 {
-			fmt.Println("usage: fix load_days YYYY-MM-DD YYYY-MM-DD")
-			return
-		}
-		start := args[2]
-		end := args[3]
-		startT, err1 := time.Parse("2006-01-02", start)
-		endT, err2 := time.Parse("2006-01-02", end)
-		if err1 != nil || err2 != nil {
-			if err1 != nil {
-				fmt.Printf("invalid start date %q: %v\n", start, err1)
+	case "rename_group", "rename_station":
+		// Rewrites history after an upstream rename so trend charts continue under the new name.
+		kind := entities.RenameGroup
+		if args[0] == "rename_station" {
+			kind = entities.RenameStation
+		}
+		var dryRun bool
+		var pos []string
+		for _, a := range args[1:] {
+			if a == "--dry-run" {
+				dryRun = true
+				continue
 			}
-			if err2 != nil {
-				fmt.Printf("invalid end date %q: %v\n", end, err2)
+			pos = append(pos, a)
+		}
+		if len(pos) < 2 || len(pos) > 3 {
+			return nil, fmt.Errorf("usage: fix %s [--dry-run] OLD NEW [LINE]", args[0])
+		}
+		oldName, newName, line := pos[0], pos[1], ""
+		if len(pos) == 3 {
+			line = pos[2]
+		}
+		var rr entities.RenameResult
+		return &command{
+			name:  args[0],
+			data:  map[string]any{"old": oldName, "new": newName, "line": line, "dry_run": dryRun},
+			audit: !dryRun,
+			exec: func(ctx context.Context, _ *managers.SFCAPIManager) error {
+				var err error
+				rr, err = entities.NewRenameManager(db.GetDB()).Rename(ctx, kind, line, oldName, newName, dryRun)
+				return err
+			},
+			result: func() map[string]any {
+				return map[string]any{"records": rr.Records, "latest_pass": rr.LatestPass, "latest_group": rr.LatestGroup}
+			},
+		}, nil
+
+	case "flags":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("usage: fix flags")
+		}
+		var state map[string]bool
+		return &command{
+			name: "flags",
+			data: map[string]any{},
+			exec: func(ctx context.Context, m *managers.SFCAPIManager) error {
+				var err error
+				state, err = m.Flags().State(ctx)
+				return err
+			},
+			result: func() map[string]any { return map[string]any{"flags": state} },
+		}, nil
+
+	case "flag":
+		// Flips a feature flag for this plant; running services pick it up within FEATURE_FLAG_TTL_SECONDS.
+		if len(args) != 3 || (args[2] != "on" && args[2] != "off") {
+			return nil, fmt.Errorf("usage: fix flag NAME on|off")
+		}
+		name, enabled := args[1], args[2] == "on"
+		return &command{
+			name:  "flag",
+			audit: true,
+			data:  map[string]any{"flag": name, "enabled": enabled},
+			exec: func(ctx context.Context, m *managers.SFCAPIManager) error {
+				return m.Flags().Set(ctx, name, enabled)
+			},
+		}, nil
+
+	case "null_audit":
+		// Counts NULLs in nullable columns; --fill rewrites NULL employee names to ''.
+		fill := len(args) == 2 && args[1] == "--fill"
+		if len(args) > 2 || (len(args) == 2 && !fill) {
+			return nil, fmt.Errorf("usage: fix null_audit [--fill]")
+		}
+		cols := []entities.NullColumn{}
+		return &command{
+			name:  "null_audit",
+			data:  map[string]any{"fill": fill},
+			audit: fill,
+			exec: func(ctx context.Context, _ *managers.SFCAPIManager) error {
+				found, err := entities.AuditNulls(ctx, db.GetDB())
+				if err != nil {
+					return err
+				}
+				cols = append(cols, found...)
+				if fill {
+					cols, err = entities.FillNullText(ctx, db.GetDB(), found)
+				}
+				return err
+			},
+			result: func() map[string]any {
+				var nulls int64
+				for _, c := range cols {
+					nulls += c.Nulls
+				}
+				return map[string]any{"nulls": nulls, "columns": cols}
+			},
+		}, nil
+
+	case "archive":
+		// Archives days older than KEEP_DAYS (default TIER_RAW_DAYS) now instead of at TIER_AT.
+		if len(args) > 2 {
+			return nil, fmt.Errorf("usage: fix archive [KEEP_DAYS]")
+		}
+		cfg := pkg.GetConfig()
+		keep := cfg.TIER_RAW_DAYS
+		if len(args) == 2 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid KEEP_DAYS %q, expected a positive number of days", args[1])
 			}
-			return
+			keep = n
 		}
-		if endT.Before(startT) {
-			fmt.Printf("end date %s is before start date %s\n", end, start)
-			return
+		var results []managers.ArchiveResult
+		return &command{
+			name:  "archive",
+			audit: true,
+			data:  map[string]any{"keep_days": keep, "dir": cfg.TIER_ARCHIVE_DIR},
+			exec: func(ctx context.Context, _ *managers.SFCAPIManager) error {
+				tierLog, _ := logger.New(logger.WithName("tiering"), logger.WithFilePattern("{name}.log"))
+				if tierLog != nil {
+					defer tierLog.Close()
+				}
+				var err error
+				results, err = managers.NewTieringManager(db.GetDB(), cfg.TIER_ARCHIVE_DIR, keep, tierLog).Archive(ctx)
+				return err
+			},
+			result: func() map[string]any {
+				var records int64
+				for _, r := range results {
+					records += r.Records
+				}
+				return map[string]any{"days": len(results), "records": records, "archived": results}
+			},
+		}, nil
+
+	case "prune":
+		// Deletes records older than KEEP_DAYS (default RETENTION_DAYS) now instead of at
+		// RETENTION_AT.
+		if len(args) > 2 {
+			return nil, fmt.Errorf("usage: fix prune [KEEP_DAYS]")
 		}
-		if err := sfcManager.LoadRangeOfDays(ctx, start, end); err != nil {
-			if lgr != nil {
-				lgr.Errorf("load_days failed: %v", err)
-			} else {
-				fmt.Printf("load_days failed: %v\n", err)
+		cfg := pkg.GetConfig()
+		keep := cfg.RETENTION_DAYS
+		if len(args) == 2 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid KEEP_DAYS %q, expected a positive number of days", args[1])
 			}
-			return
+			keep = n
 		}
-		if lgr != nil {
-			lgr.Infof("load_days completed for %s .. %s", start, end)
+		if keep > 0 && cfg.TIER_RAW_DAYS > 0 && keep <= cfg.TIER_RAW_DAYS {
+			return nil, fmt.Errorf("KEEP_DAYS %d would delete records tiering has not archived yet (TIER_RAW_DAYS=%d)", keep, cfg.TIER_RAW_DAYS)
 		}
+		var result managers.RetentionResult
+		return &command{
+			name:  "prune",
+			audit: true,
+			data:  map[string]any{"keep_days": keep},
+			exec: func(ctx context.Context, _ *managers.SFCAPIManager) error {
+				retentionLog, _ := logger.New(logger.WithName("retention"), logger.WithFilePattern("{name}.log"))
+				if retentionLog != nil {
+					defer retentionLog.Close()
+				}
+				var err error
+				result, err = managers.NewRetentionManager(db.GetDB(), keep, cfg.RETENTION_BATCH, retentionLog).Prune(ctx)
+				return err
+			},
+			result: func() map[string]any {
+				return map[string]any{"deleted": result.Deleted, "batches": result.Batches, "cutoff": result.Cutoff}
+			},
+		}, nil
 
-	case "load_hour":
-		if len(args) != 3 {
-			fmt.Println("usage: fix load_hour \"YYYY-MM-DD HH\"")
-			return
+	case "counts":
+		// Units per line/group over RANGE (see timeutil.Parse), answered from raw records
+		// or, for archived days, from the hourly rollup.
+		if len(args) != 2 {
+			return nil, fmt.Errorf("usage: fix counts RANGE (e.g. 2025-09-01, 2025-09-01..2025-09-07, -24h)")
 		}
-		hourStr := args[2]
-		if _, err := time.Parse("2006-01-02 15", hourStr); err != nil {
-			fmt.Printf("invalid hour %q, expected \"YYYY-MM-DD HH\": %v\n", hourStr, err)
-			return
+		r, err := timeutil.Parse(args[1], time.Now())
+		if err != nil {
+			return nil, err
 		}
-		if err := sfcManager.LoadHour(hourStr); err != nil {
-			if lgr != nil {
-				lgr.Errorf("load_hour failed: %v", err)
-			} else {
-				fmt.Printf("load_hour failed: %v\n", err)
+		counts := []entities.LineGroupCount{}
+		return &command{
+			name: "counts",
+			data: map[string]any{"from": timeutil.FormatLocal(r.Start), "to": timeutil.FormatLocal(r.End)},
+			exec: func(ctx context.Context, _ *managers.SFCAPIManager) error {
+				tierLog, _ := logger.New(logger.WithName("tiering"), logger.WithFilePattern("{name}.log"))
+				if tierLog != nil {
+					defer tierLog.Close()
+				}
+				c, err := managers.NewTieringManager(db.GetDB(), pkg.GetConfig().TIER_ARCHIVE_DIR, 0, tierLog).CountByLineGroup(ctx, r)
+				counts = append(counts, c...)
+				return err
+			},
+			result: func() map[string]any {
+				var units, fail int
+				for _, c := range counts {
+					units += c.Units
+					fail += c.FailUnits
+				}
+				return map[string]any{"units": units, "fail_units": fail, "lines": counts}
+			},
+		}, nil
+
+	case "rekey_ids":
+		// Rewrites record IDs written before they were derived from the logical key.
+		if len(args) != 2 {
+			return nil, fmt.Errorf("usage: fix rekey_ids RANGE (e.g. 2025-09-01..2025-09-30)")
+		}
+		r, err := timeutil.Parse(args[1], time.Now())
+		if err != nil {
+			return nil, err
+		}
+		var changed int64
+		return &command{
+			name:  "rekey_ids",
+			audit: true,
+			data:  map[string]any{"from": timeutil.FormatLocal(r.Start), "to": timeutil.FormatLocal(r.End)},
+			exec: func(ctx context.Context, _ *managers.SFCAPIManager) error {
+				var err error
+				changed, err = entities.NewRecordManagerEntity(db.GetDB()).RekeyIDs(ctx, r)
+				return err
+			},
+			result: func() map[string]any { return map[string]any{"rekeyed": changed} },
+		}, nil
+
+	case "import_dump":
+		// Backfills historical windows the API no longer serves from a vendor dump (CSV
+		// spooled from Oracle, optionally gzipped): inserts missing records, reports mismatches.
+		var dryRun bool
+		var pos []string
+		for _, a := range args[1:] {
+			if a == "--dry-run" {
+				dryRun = true
+				continue
 			}
-			return
+			pos = append(pos, a)
 		}
-		if lgr != nil {
-			lgr.Infof("load_hour completed for %s", hourStr)
+		if len(pos) != 1 {
+			return nil, fmt.Errorf("usage: fix import_dump [--dry-run] FILE")
 		}
+		path := pos[0]
+		var ir managers.DumpImportResult
+		return &command{
+			name:  "import_dump",
+			data:  map[string]any{"file": path, "dry_run": dryRun},
+			audit: !dryRun,
+			exec: func(ctx context.Context, m *managers.SFCAPIManager) error {
+				f, err := os.Open(path)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				ir, err = m.ImportDump(ctx, f, dryRun)
+				return err
+			},
+			result: func() map[string]any {
+				return map[string]any{"rows": ir.Rows, "skipped": ir.Skipped, "records": ir.Records, "hours": ir.Hours,
+					"matched": ir.Matched, "mismatched": ir.Mismatched, "inserted": ir.Inserted, "failed_hours": ir.Failed,
+					"mismatches": ir.Mismatches}
+			},
+			failures: func() int { return ir.Failed },
+		}, nil
 
-	default:
-		fmt.Println("unknown command. usage:")
-		fmt.Println("  fix load_day YYYY-MM-DD")
-		fmt.Println("  fix load_days YYYY-MM-DD YYYY-MM-DD")
-		fmt.Println("  fix load_hour \"YYYY-MM-DD HH\"")
-		return
-	}
+	case "oee":
+		// Availability, performance, first pass yield and OEE per shift of the stations with a target.
+		if len(args) < 2 || len(args) > 3 {
+			return nil, fmt.Errorf("usage: fix oee RANGE [LINE] (e.g. 2025-09-01, -24h)")
+		}
+		r, err := timeutil.Parse(args[1], time.Now())
+		if err != nil {
+			return nil, err
+		}
+		if r.Duration() > managers.MaxOEERange {
+			return nil, fmt.Errorf("range %s exceeds %s", r, managers.MaxOEERange)
+		}
+		cfg := pkg.GetConfig()
+		cal, err := shifts.Parse(cfg.SHIFTS, time.Local)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SHIFTS configuration: %w", err)
+		}
+		line := ""
+		if len(args) == 3 {
+			line = strings.ToUpper(strings.TrimSpace(args[2]))
+		}
+		report := []managers.ShiftOEE{}
+		return &command{
+			name: "oee",
+			data: map[string]any{"from": timeutil.FormatLocal(r.Start), "to": timeutil.FormatLocal(r.End), "line": line},
+			exec: func(ctx context.Context, m *managers.SFCAPIManager) error {
+				oee := managers.NewOEE(cal, db.GetDB(), time.Duration(cfg.OEE_STOP_MINUTES)*time.Minute, nil)
+				oee.SetMaintenance(m.Maintenance())
+				var err error
+				report, err = oee.Report(ctx, r, line)
+				return err
+			},
+			result: func() map[string]any { return map[string]any{"shifts": report} },
+		}, nil
 
-	// Wait briefly to allow any async logs to flush, or respond to signals
-	select {
-	case <-ctx.Done():
-		// graceful shutdown triggered
-	case <-time.After(100 * time.Millisecond):
+	default:
+		return nil, fmt.Errorf("unknown command %q", args[0])
 	}
 }
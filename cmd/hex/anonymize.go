@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+
+	"hex_toolset/pkg/cli"
+	"hex_toolset/pkg/db"
+	"hex_toolset/pkg/db/entities"
+)
+
+// anonymize copies SFC_CLON to --out with the PPIDs, work orders and employee names
+// replaced by keyed tokens (see entities.Anonymize), for sharing a problem database with the
+// vendor. Without --key the key is random, so nobody can map the tokens back; pass the same
+// --key to get the same tokens in copies made later.
+func anonymize(out *cli.Printer, res *cli.Result, args []string) error {
+	fs := flag.NewFlagSet("anonymize", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	path := fs.String("out", "", "file to write the anonymized copy to (must not exist)")
+	key := fs.String("key", "", "secret keying the tokens (default random)")
+	if err := fs.Parse(args); err != nil {
+		out.Message("%s", usage)
+		return err
+	}
+	if fs.NArg() > 0 {
+		out.Message("%s", usage)
+		return fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+	if *path == "" {
+		out.Message("%s", usage)
+		return fmt.Errorf("--out is required")
+	}
+	secret := []byte(*key)
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return err
+		}
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	conn := db.GetInstance()
+	if err := conn.InitDefault(ctx); err != nil {
+		return err
+	}
+	defer conn.CloseDB()
+	r, err := entities.Anonymize(ctx, conn.GetDB(), *path, secret)
+	if err != nil {
+		return err
+	}
+	out.Message("written:       %s", r.Path)
+	out.Message("records:       %d", r.Records)
+	out.Message("ppids:         %d", r.PPIDs)
+	out.Message("work orders:   %d", r.WorkOrders)
+	out.Message("employees:     %d", r.Employees)
+	out.Message("audit entries: %d dropped", r.AuditDeleted)
+	res.Data["result"] = r
+	return nil
+}
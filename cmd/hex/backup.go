@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+
+	"hex_toolset/pkg/cli"
+	"hex_toolset/pkg/db"
+)
+
+// backup copies SFC_CLON to --out and checks the copy (see db.DBConnection.Backup). It
+// opens the database itself and needs no downtime: db_clon keeps ingesting meanwhile.
+func backup(out *cli.Printer, res *cli.Result, args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	path := fs.String("out", "", "file to write the backup to (must not exist)")
+	if err := fs.Parse(args); err != nil {
+		out.Message("%s", usage)
+		return err
+	}
+	if fs.NArg() > 0 {
+		out.Message("%s", usage)
+		return fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+	if *path == "" {
+		out.Message("%s", usage)
+		return fmt.Errorf("--out is required")
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	conn := db.GetInstance()
+	if err := conn.InitDefault(ctx); err != nil {
+		return err
+	}
+	defer conn.CloseDB()
+	r, err := conn.Backup(ctx, *path)
+	if err != nil {
+		return fmt.Errorf("backup failed: %w", err)
+	}
+	out.Message("written:  %s", r.Path)
+	out.Message("size:     %s", formatBytes(r.Bytes))
+	out.Message("checked:  %s ok", r.Check)
+	out.Message("took:     %s", formatSeconds(r.DurationSeconds))
+	res.Data["result"] = r
+	return nil
+}
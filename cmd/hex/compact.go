@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"time"
+
+	pkg "hex_toolset/pkg"
+	"hex_toolset/pkg/cli"
+	"hex_toolset/pkg/db"
+	"hex_toolset/pkg/managers"
+)
+
+// compactPoll is how often compact asks db_clon whether the compaction finished.
+const compactPoll = 2 * time.Second
+
+// compact rewrites the database without its free pages (see db.Compact). By default it
+// asks the running db_clon, through its admin endpoint, which pauses its own ingestion;
+// with --offline it opens SFC_CLON itself, for when db_clon is stopped. The expected
+// downtime is printed first; --dry-run stops there.
+func compact(out *cli.Printer, res *cli.Result, args []string) error {
+	fs := flag.NewFlagSet("compact", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	dryRun := fs.Bool("dry-run", false, "only print the estimate")
+	keepBackup := fs.Bool("keep-backup", false, "keep the replaced file as <db>.pre-compact")
+	offline := fs.Bool("offline", false, "open the database directly instead of asking db_clon")
+	addr := fs.String("addr", "", "db_clon admin address (default ADMIN_ADDR)")
+	if err := fs.Parse(args); err != nil {
+		out.Message("%s", usage)
+		return err
+	}
+	if fs.NArg() > 0 {
+		out.Message("%s", usage)
+		return fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if *offline {
+		return compactOffline(ctx, out, res, *dryRun, *keepBackup)
+	}
+	if *addr == "" {
+		*addr = pkg.GetConfig().ADMIN_ADDR
+	}
+	if *addr == "" {
+		return fmt.Errorf("ADMIN_ADDR is not set: pass --addr, or --offline with db_clon stopped")
+	}
+	url := "http://" + *addr + "/admin/compact"
+
+	var st managers.CompactionStatus
+	if err := adminCall(ctx, http.MethodGet, url, http.StatusOK, &st); err != nil {
+		return err
+	}
+	if st.Running {
+		return fmt.Errorf("a compaction is already running (%s since %s)", st.Step, st.StartedAt)
+	}
+	printCompactEstimate(out, res, *st.Estimate)
+	if *dryRun {
+		return nil
+	}
+
+	var est db.CompactEstimate
+	if err := adminCall(ctx, http.MethodPost, url+"?keep_backup="+strconv.FormatBool(*keepBackup), http.StatusAccepted, &est); err != nil {
+		return err
+	}
+	step := ""
+	for {
+		select {
+		case <-ctx.Done():
+			// db_clon carries on; only the waiting stops
+			return fmt.Errorf("stopped waiting, the compaction continues in db_clon: GET %s", url)
+		case <-time.After(compactPoll):
+		}
+		st = managers.CompactionStatus{}
+		if err := adminCall(ctx, http.MethodGet, url, http.StatusOK, &st); err != nil {
+			return err
+		}
+		if !st.Running {
+			break
+		}
+		if st.Step != step {
+			step = st.Step
+			out.Message("%s...", step)
+		}
+	}
+	if st.Error != "" {
+		return fmt.Errorf("compaction failed, database unchanged: %s", st.Error)
+	}
+	printCompactResult(out, res, *st.Last)
+	return nil
+}
+
+func compactOffline(ctx context.Context, out *cli.Printer, res *cli.Result, dryRun, keepBackup bool) error {
+	conn := db.GetInstance()
+	if err := conn.InitDefault(ctx); err != nil {
+		return err
+	}
+	defer conn.CloseDB()
+	est, err := db.EstimateCompact(ctx, conn.GetDB(), conn.DBPath(), 0)
+	if err != nil {
+		return err
+	}
+	printCompactEstimate(out, res, est)
+	if dryRun {
+		return nil
+	}
+	result, err := db.Compact(ctx, conn.GetDB(), conn.DBPath(), db.CompactOptions{
+		KeepBackup: keepBackup,
+		Progress:   func(step string) { out.Message("%s...", step) },
+	})
+	if err != nil {
+		return fmt.Errorf("compaction failed, database unchanged: %w", err)
+	}
+	printCompactResult(out, res, result)
+	return nil
+}
+
+// adminCall sends a bodiless request to the admin endpoint and decodes the response, or
+// its problem detail when the status is not want.
+func adminCall(ctx context.Context, method, url string, want int, v any) error {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("db_clon admin endpoint: %w (is db_clon running? use --offline if not)", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != want {
+		var problem struct {
+			Detail string `json:"detail"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&problem)
+		return fmt.Errorf("%s %s: %s: %s", method, url, resp.Status, problem.Detail)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("%s %s: invalid response: %w", method, url, err)
+	}
+	return nil
+}
+
+func printCompactEstimate(out *cli.Printer, res *cli.Result, est db.CompactEstimate) {
+	out.Message("database:          %s", est.Path)
+	out.Message("size:              %s", formatBytes(est.SizeBytes))
+	out.Message("reclaimable:       %s", formatBytes(est.FreeBytes))
+	out.Message("expected size:     %s (also the free disk space needed)", formatBytes(est.ExpectedBytes))
+	out.Message("expected downtime: %s at %s/s", formatSeconds(est.DowntimeSeconds), formatBytes(est.RateBytesPerSecond))
+	res.Data["estimate"] = est
+}
+
+func printCompactResult(out *cli.Printer, res *cli.Result, r db.CompactResult) {
+	out.Message("compacted:         %s -> %s", formatBytes(r.BeforeBytes), formatBytes(r.AfterBytes))
+	out.Message("downtime:          %s", formatSeconds(r.DowntimeSeconds))
+	if r.Backup != "" {
+		out.Message("previous file:     %s", r.Backup)
+	}
+	res.Data["result"] = r
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func formatSeconds(s float64) string {
+	d := time.Duration(s * float64(time.Second)).Round(time.Second)
+	if d == 0 {
+		return "under 1s"
+	}
+	return d.String()
+}
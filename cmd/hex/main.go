@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	pkg "hex_toolset/pkg"
+	"hex_toolset/pkg/buildinfo"
+	"hex_toolset/pkg/cli"
+	"hex_toolset/pkg/logger"
+	"hex_toolset/pkg/managers"
+	"hex_toolset/pkg/timeutil"
+)
+
+const usage = `usage:
+  hex [--output json|table|quiet] logs [--name NAME[,NAME]] [--level LEVEL] [--since 2h|7d|today|"YYYY-MM-DD HH:MM[:SS]"]
+                                       [--grep REGEXP] [--limit N] [--dir LOG_DIR]
+  hex [--output json|table|quiet] messages [--since 2h|7d|today|"YYYY-MM-DD HH:MM[:SS]"] [--type TYPE] [--limit N]
+                                           [--dir BROADCAST_MESSAGE_DIR]
+  hex [--output json|table|quiet] compact [--dry-run] [--keep-backup] [--offline] [--addr ADMIN_ADDR]
+  hex [--output json|table|quiet] backup --out FILE
+  hex [--output json|table|quiet] anonymize --out FILE [--key KEY]
+  hex [--output json|table|quiet] config check
+  hex [--output json|table|quiet] version`
+
+func main() {
+	format, args, err := cli.ExtractOutputFlag(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+	out := cli.NewPrinter(format)
+	os.Exit(run(out, args))
+}
+
+func run(out *cli.Printer, args []string) int {
+	res := cli.Result{Command: "hex", StartedAt: time.Now(), Data: map[string]any{}}
+	if len(args) == 0 {
+		out.Message("%s", usage)
+		return out.Finish(&res, fmt.Errorf("missing command"))
+	}
+	res.Command = "hex " + args[0]
+	switch args[0] {
+	case "logs":
+		return out.Finish(&res, logs(out, &res, args[1:]))
+	case "messages":
+		return out.Finish(&res, messages(out, &res, args[1:]))
+	case "compact":
+		return out.Finish(&res, compact(out, &res, args[1:]))
+	case "backup":
+		return out.Finish(&res, backup(out, &res, args[1:]))
+	case "anonymize":
+		return out.Finish(&res, anonymize(out, &res, args[1:]))
+	case "config":
+		return out.Finish(&res, config(out, &res, args[1:]))
+	case "version":
+		build := buildinfo.Get()
+		out.Message("hex %s", build)
+		res.Data["version"], res.Data["commit"], res.Data["date"] = build.Version, build.Commit, build.Date
+		return out.Finish(&res, nil)
+	default:
+		out.Message("%s", usage)
+		return out.Finish(&res, fmt.Errorf("unknown command %q", args[0]))
+	}
+}
+
+// logs prints the entries of the log files in LOG_DIR matching the flags, oldest first.
+// Both the text and the JSON log format are understood.
+func logs(out *cli.Printer, res *cli.Result, args []string) error {
+	fs := flag.NewFlagSet("logs", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	names := fs.String("name", "", "logger names, comma separated")
+	level := fs.String("level", "debug", "minimum level")
+	since := fs.String("since", "", "duration back from now (2h, 7d) or a time expression (today, YYYY-MM-DD HH:MM)")
+	grep := fs.String("grep", "", "regular expression matched against message and fields")
+	limit := fs.Int("limit", 0, "print only the newest N entries (0: all)")
+	dir := fs.String("dir", "", "log directory (default LOG_DIR)")
+	if err := fs.Parse(args); err != nil {
+		out.Message("%s", usage)
+		return err
+	}
+	if fs.NArg() > 0 {
+		out.Message("%s", usage)
+		return fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+
+	var q logger.Query
+	for _, n := range strings.Split(*names, ",") {
+		if n = strings.TrimSpace(n); n != "" {
+			q.Names = append(q.Names, n)
+		}
+	}
+	lvl, err := logger.ParseLevel(*level)
+	if err != nil {
+		return err
+	}
+	q.MinLevel = lvl
+	if *since != "" {
+		if q.Since, err = timeutil.ParseSince(*since, time.Now()); err != nil {
+			return fmt.Errorf("invalid --since: %w", err)
+		}
+	}
+	if *grep != "" {
+		if q.Grep, err = regexp.Compile(*grep); err != nil {
+			return fmt.Errorf("invalid --grep: %w", err)
+		}
+	}
+	if *dir == "" {
+		*dir = pkg.GetConfig().LOG_DIR
+	}
+
+	entries, err := logger.Search(*dir, q)
+	if err != nil {
+		return err
+	}
+	res.Data["matched"] = len(entries)
+	if *limit > 0 && len(entries) > *limit {
+		entries = entries[len(entries)-*limit:]
+	}
+	for _, e := range entries {
+		out.Message("%s", formatEntry(e))
+	}
+	if out.Format == cli.FormatJSON {
+		res.Data["entries"] = entries
+	}
+	return nil
+}
+
+// messages prints the broadcast messages kept in the BROADCAST_MESSAGE_DIR history (see
+// MESSAGE_HISTORY_HOURS), oldest first, compressed or not.
+func messages(out *cli.Printer, res *cli.Result, args []string) error {
+	fs := flag.NewFlagSet("messages", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	since := fs.String("since", "1h", "duration back from now (2h, 7d) or a time expression (today, YYYY-MM-DD HH:MM)")
+	typ := fs.String("type", "", "massage_type to keep (e.g. LAST_HOUR)")
+	limit := fs.Int("limit", 0, "print only the newest N messages (0: all)")
+	dir := fs.String("dir", "", "message directory (default BROADCAST_MESSAGE_DIR)")
+	if err := fs.Parse(args); err != nil {
+		out.Message("%s", usage)
+		return err
+	}
+	if fs.NArg() > 0 {
+		out.Message("%s", usage)
+		return fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+	from, err := timeutil.ParseSince(*since, time.Now())
+	if err != nil {
+		return fmt.Errorf("invalid --since: %w", err)
+	}
+	if *dir == "" {
+		*dir = pkg.GetConfig().BROADCAST_MESSAGE_DIR
+	}
+
+	type message struct {
+		File string          `json:"file"`
+		Type string          `json:"massage_type"`
+		Body json.RawMessage `json:"body"`
+	}
+	var kept []message
+	err = managers.NewMessageHistory(*dir, 0).Replay(from, func(name string, b []byte) error {
+		var env struct {
+			Type string `json:"massage_type"`
+		}
+		_ = json.Unmarshal(b, &env)
+		if *typ != "" && !strings.EqualFold(env.Type, *typ) {
+			return nil
+		}
+		var buf bytes.Buffer // one message per line
+		if json.Compact(&buf, b) == nil {
+			b = buf.Bytes()
+		}
+		kept = append(kept, message{File: name, Type: env.Type, Body: b})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	res.Data["matched"] = len(kept)
+	if *limit > 0 && len(kept) > *limit {
+		kept = kept[len(kept)-*limit:]
+	}
+	for _, m := range kept {
+		out.Message("%s %s %s", m.File, m.Type, m.Body)
+	}
+	if out.Format == cli.FormatJSON {
+		res.Data["messages"] = kept
+	}
+	return nil
+}
+
+// config check prints the validated settings with their value, default and meaning, and
+// fails when one is invalid.
+func config(out *cli.Printer, res *cli.Result, args []string) error {
+	if len(args) != 1 || args[0] != "check" {
+		out.Message("%s", usage)
+		return fmt.Errorf("expected \"config check\"")
+	}
+	settings := pkg.GetConfig().Check()
+	invalid := 0
+	for _, st := range settings {
+		out.Message("%s=%q (default %s)\n    %s", st.Env, st.Value, st.Default, st.Doc)
+		if st.Error != "" {
+			invalid++
+			out.Message("    INVALID: %s", st.Error)
+		}
+	}
+	res.Data["invalid"] = invalid
+	if out.Format == cli.FormatJSON {
+		res.Data["settings"] = settings
+	}
+	if invalid > 0 {
+		return fmt.Errorf("%d invalid setting(s)", invalid)
+	}
+	return nil
+}
+
+func formatEntry(e logger.Entry) string {
+	ts := "-"
+	if !e.Time.IsZero() {
+		ts = e.Time.Local().Format(timeutil.DBLayout)
+	}
+	line := fmt.Sprintf("%s [%s] %s | %s", ts, e.Level, e.Name, e.Msg)
+	if len(e.Fields) > 0 {
+		var kv []string
+		for k, v := range e.Fields {
+			kv = append(kv, fmt.Sprintf("%s=%v", k, v))
+		}
+		sort.Strings(kv)
+		line += " | " + strings.Join(kv, " ")
+	}
+	return line
+}
@@ -0,0 +1,35 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+)
+
+// NotModified sets the ETag of the current representation on w and, when the request's
+// If-None-Match already holds it, answers 304 Not Modified and returns true: the handler
+// then returns without loading or encoding the payload. version is an opaque token that
+// changes whenever the data does (e.g. the latest timestamp of the table served); it is
+// quoted here.
+func NotModified(w http.ResponseWriter, r *http.Request, version string) bool {
+	etag := SetETag(w, version)
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	for _, tag := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		// weak comparison (RFC 9110 13.1.2): W/"x" matches "x"
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == etag || tag == "*" {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// SetETag sets the ETag of version on w and returns it, for handlers whose payload turns
+// out to be of a newer version than the one NotModified checked.
+func SetETag(w http.ResponseWriter, version string) string {
+	etag := `"` + version + `"`
+	w.Header().Set("ETag", etag)
+	return etag
+}
@@ -0,0 +1,37 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNotModified(t *testing.T) {
+	for _, tc := range []struct {
+		ifNoneMatch string
+		want        bool
+	}{
+		{"", false},
+		{`"v1"`, true},
+		{`W/"v1"`, true},
+		{`"v0", "v1"`, true},
+		{`*`, true},
+		{`"v0"`, false},
+		{`v1`, false},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/wip", nil)
+		if tc.ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", tc.ifNoneMatch)
+		}
+		rec := httptest.NewRecorder()
+		if got := NotModified(rec, req, "v1"); got != tc.want {
+			t.Fatalf("If-None-Match %q: NotModified = %v, want %v", tc.ifNoneMatch, got, tc.want)
+		}
+		if etag := rec.Header().Get("ETag"); etag != `"v1"` {
+			t.Fatalf("ETag = %q", etag)
+		}
+		if tc.want && rec.Code != http.StatusNotModified {
+			t.Fatalf("If-None-Match %q: status %d, want 304", tc.ifNoneMatch, rec.Code)
+		}
+	}
+}
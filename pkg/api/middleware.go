@@ -0,0 +1,221 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"hex_toolset/pkg/logger"
+
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader is read from incoming requests (if present) and always set on responses.
+const RequestIDHeader = "X-Request-ID"
+
+type ctxKey int
+
+const requestIDKey ctxKey = iota
+
+// RequestID returns the request ID stored in ctx by Middleware, or "".
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	if v, ok := ctx.Value(requestIDKey).(string); ok {
+		return v
+	}
+	return ""
+}
+
+// WithRequestID returns a copy of ctx carrying the given request ID, also as the
+// request_id field of logger.FromContext.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	ctx = logger.ContextWithFields(ctx, logger.RequestIDKey, id)
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// Middleware assigns a request ID, recovers panics as problem+json and writes
+// one access log line per request tagged with the same request_id.
+func Middleware(next http.Handler, logg *logger.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := sanitizeRequestID(r.Header.Get(RequestIDHeader))
+		if id == "" {
+			id = uuid.NewString()
+		}
+		r = r.WithContext(WithRequestID(r.Context(), id))
+		w.Header().Set(RequestIDHeader, id)
+
+		sw := &statusWriter{ResponseWriter: w}
+		defer func() {
+			if rec := recover(); rec != nil {
+				if logg != nil {
+					logg.Errorw("http panic recovered", "request_id", id, "method", r.Method, "path", r.URL.Path, "panic", fmt.Sprint(rec))
+				}
+				if !sw.wroteHeader {
+					WriteProblem(sw, r, http.StatusInternalServerError, CodeInternal, "internal server error")
+				}
+			}
+			logAccess(logg, r, sw, id, time.Since(start))
+		}()
+		next.ServeHTTP(sw, r)
+	})
+}
+
+func logAccess(logg *logger.Logger, r *http.Request, sw *statusWriter, id string, d time.Duration) {
+	if logg == nil || sw.hijacked {
+		return
+	}
+	status := sw.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	kv := []any{"request_id", id, "method", r.Method, "path", r.URL.Path, "status", status, "duration", d.String()}
+	switch {
+	case status >= 500:
+		logg.Errorw("http", append(kv, "code", sw.problem.Code, "cause", sw.cause)...)
+	case status >= 400:
+		logg.Warnw("http", append(kv, "code", sw.problem.Code, "detail", sw.problem.Detail)...)
+	default:
+		logg.Debugw("http", kv...)
+	}
+}
+
+// sanitizeRequestID accepts client-provided IDs only if they are short and printable.
+func sanitizeRequestID(s string) string {
+	s = strings.TrimSpace(s)
+	if s == "" || len(s) > 128 {
+		return ""
+	}
+	for _, c := range s {
+		if c < 0x21 || c > 0x7e {
+			return ""
+		}
+	}
+	return s
+}
+
+// statusWriter records the status and problem written by a handler.
+// It forwards Hijack and Flush so websocket upgrades keep working behind the middleware.
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	hijacked    bool
+	problem     Problem
+	cause       error
+}
+
+func (sw *statusWriter) WriteHeader(status int) {
+	if !sw.wroteHeader {
+		sw.status = status
+		sw.wroteHeader = true
+	}
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+func (sw *statusWriter) Write(b []byte) (int, error) {
+	if !sw.wroteHeader {
+		sw.WriteHeader(http.StatusOK)
+	}
+	return sw.ResponseWriter.Write(b)
+}
+
+func (sw *statusWriter) Flush() {
+	if f, ok := sw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (sw *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := sw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("api: underlying ResponseWriter does not implement http.Hijacker")
+	}
+	sw.hijacked = true
+	return h.Hijack()
+}
+
+func (sw *statusWriter) Unwrap() http.ResponseWriter { return sw.ResponseWriter }
+
+// recordProblem and recordCause also pass the problem on to an enclosing statusWriter
+// (see Observe), so the access log keeps it.
+func (sw *statusWriter) recordProblem(p Problem) {
+	sw.problem = p
+	if pr, ok := sw.ResponseWriter.(problemRecorder); ok {
+		pr.recordProblem(p)
+	}
+}
+
+func (sw *statusWriter) recordCause(err error) {
+	sw.cause = err
+	if pr, ok := sw.ResponseWriter.(problemRecorder); ok {
+		pr.recordCause(err)
+	}
+}
+
+// Observe serves r through next and returns the status it answered with and the problem
+// document it wrote, if any, for middleware acting on the outcome of a request.
+func Observe(w http.ResponseWriter, r *http.Request, next http.Handler) (int, Problem) {
+	sw := &statusWriter{ResponseWriter: w}
+	next.ServeHTTP(sw, r)
+	if !sw.wroteHeader {
+		return http.StatusOK, sw.problem
+	}
+	return sw.status, sw.problem
+}
+
+// Router is an http.ServeMux that answers unknown routes and wrong methods with
+// problem+json instead of the mux's plain-text 404/405 pages.
+type Router struct {
+	mux *http.ServeMux
+}
+
+// NewRouter creates an empty Router.
+func NewRouter() *Router { return &Router{mux: http.NewServeMux()} }
+
+// Handle registers handler for pattern (Go 1.22 patterns, e.g. "GET /api/topics").
+func (rt *Router) Handle(pattern string, handler http.Handler) { rt.mux.Handle(pattern, handler) }
+
+// HandleFunc registers an error-returning handler for pattern.
+func (rt *Router) HandleFunc(pattern string, fn HandlerFunc) { rt.mux.Handle(pattern, fn) }
+
+// Pattern returns the pattern of the route serving r, "" when none matches.
+func (rt *Router) Pattern(r *http.Request) string {
+	_, pattern := rt.mux.Handler(r)
+	return pattern
+}
+
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h, pattern := rt.mux.Handler(r)
+	if pattern != "" {
+		rt.mux.ServeHTTP(w, r)
+		return
+	}
+	// No route matched: let the mux decide between 404 and 405 (it also sets Allow),
+	// then render the outcome as a problem document.
+	rec := &headerRecorder{header: w.Header()}
+	h.ServeHTTP(rec, r)
+	if rec.status == http.StatusMethodNotAllowed {
+		WriteProblem(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed,
+			"method "+r.Method+" is not allowed for "+r.URL.Path)
+		return
+	}
+	WriteProblem(w, r, http.StatusNotFound, CodeNotFound, "no route for "+r.URL.Path)
+}
+
+// headerRecorder captures the status of the mux's fallback handler and discards its body.
+type headerRecorder struct {
+	header http.Header
+	status int
+}
+
+func (h *headerRecorder) Header() http.Header         { return h.header }
+func (h *headerRecorder) Write(b []byte) (int, error) { return len(b), nil }
+func (h *headerRecorder) WriteHeader(status int)      { h.status = status }
@@ -0,0 +1,193 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ProblemContentType is the media type defined by RFC 7807 for error responses.
+const ProblemContentType = "application/problem+json"
+
+// problemTypeBase prefixes the machine-readable code to build the RFC 7807 "type" URI.
+const problemTypeBase = "urn:hex_toolset:problem:"
+
+// Code is a stable, machine-readable error code that clients can switch on.
+type Code string
+
+const (
+	CodeInvalidRequest   Code = "invalid_request"
+	CodeInvalidRange     Code = "invalid_range"
+	CodeUnauthorized     Code = "unauthorized"
+	CodeNotFound         Code = "not_found"
+	CodeMethodNotAllowed Code = "method_not_allowed"
+	CodeRateLimited      Code = "rate_limited"
+	CodeDBBusy           Code = "db_busy"
+	CodeTimeout          Code = "timeout"
+	CodeInternal         Code = "internal"
+)
+
+// Problem is the RFC 7807 problem details document returned for every REST error.
+// Code and RequestID are extension members; RequestID matches the request_id in the logs.
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	Code      Code   `json:"code"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// Error is an error that carries the HTTP status and code to report to the client.
+// Handlers return it (directly or wrapped) to control the problem response.
+type Error struct {
+	Status int
+	Code   Code
+	Detail string
+	Err    error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %s: %v", e.Code, e.Detail, e.Err)
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Detail)
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// InvalidRequest reports a malformed request (bad parameter, unparsable body...).
+func InvalidRequest(format string, args ...any) *Error {
+	return &Error{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Detail: fmt.Sprintf(format, args...)}
+}
+
+// InvalidRange reports a time or numeric range that is malformed or out of bounds.
+func InvalidRange(format string, args ...any) *Error {
+	return &Error{Status: http.StatusBadRequest, Code: CodeInvalidRange, Detail: fmt.Sprintf(format, args...)}
+}
+
+// Unauthorized reports a request that failed authentication, e.g. a bad signature.
+func Unauthorized(format string, args ...any) *Error {
+	return &Error{Status: http.StatusUnauthorized, Code: CodeUnauthorized, Detail: fmt.Sprintf(format, args...)}
+}
+
+// NotFound reports a resource that does not exist.
+func NotFound(format string, args ...any) *Error {
+	return &Error{Status: http.StatusNotFound, Code: CodeNotFound, Detail: fmt.Sprintf(format, args...)}
+}
+
+// RateLimited reports a client that exceeded its request rate.
+func RateLimited(format string, args ...any) *Error {
+	return &Error{Status: http.StatusTooManyRequests, Code: CodeRateLimited, Detail: fmt.Sprintf(format, args...)}
+}
+
+// ErrorFromErr classifies an arbitrary error into an *Error.
+// - *Error anywhere in the chain is returned as-is
+// - sql.ErrNoRows => not_found
+// - SQLite busy/locked => db_busy (503), so clients know to retry
+// - context deadline => timeout (504)
+// - everything else => internal (500)
+func ErrorFromErr(err error) *Error {
+	if err == nil {
+		return nil
+	}
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return &Error{Status: http.StatusNotFound, Code: CodeNotFound, Detail: "resource not found", Err: err}
+	case IsDBBusy(err):
+		return &Error{Status: http.StatusServiceUnavailable, Code: CodeDBBusy, Detail: "database is busy, retry later", Err: err}
+	case errors.Is(err, context.DeadlineExceeded):
+		return &Error{Status: http.StatusGatewayTimeout, Code: CodeTimeout, Detail: "operation timed out", Err: err}
+	default:
+		return &Error{Status: http.StatusInternalServerError, Code: CodeInternal, Detail: "internal server error", Err: err}
+	}
+}
+
+// IsDBBusy reports whether err is a SQLite SQLITE_BUSY/SQLITE_LOCKED condition.
+func IsDBBusy(err error) bool {
+	if err == nil {
+		return false
+	}
+	s := strings.ToLower(err.Error())
+	return strings.Contains(s, "database is locked") ||
+		strings.Contains(s, "sqlite_busy") ||
+		strings.Contains(s, "database table is locked") ||
+		strings.Contains(s, "sqlite_locked")
+}
+
+// WriteProblem writes a problem+json response for the given status and code.
+// The request ID assigned by Middleware is included so clients can quote it.
+func WriteProblem(w http.ResponseWriter, r *http.Request, status int, code Code, detail string) {
+	p := Problem{
+		Type:   problemTypeBase + string(code),
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+	if r != nil {
+		p.Instance = r.URL.Path
+		p.RequestID = RequestID(r.Context())
+	}
+	if pr, ok := w.(problemRecorder); ok {
+		pr.recordProblem(p)
+	}
+	b, err := json.Marshal(p)
+	if err != nil {
+		http.Error(w, detail, status)
+		return
+	}
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_, _ = w.Write(b)
+}
+
+// WriteError classifies err and writes the matching problem response.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	e := ErrorFromErr(err)
+	if e == nil {
+		return
+	}
+	if pr, ok := w.(problemRecorder); ok && e.Err != nil {
+		pr.recordCause(e.Err)
+	}
+	WriteProblem(w, r, e.Status, e.Code, e.Detail)
+}
+
+// WriteJSON writes v as a JSON response with the given status.
+func WriteJSON(w http.ResponseWriter, status int, v any) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		WriteProblem(w, nil, http.StatusInternalServerError, CodeInternal, "failed to encode response")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(b)
+}
+
+// HandlerFunc is an http handler that may return an error; errors are rendered as problem+json.
+type HandlerFunc func(w http.ResponseWriter, r *http.Request) error
+
+func (f HandlerFunc) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := f(w, r); err != nil {
+		WriteError(w, r, err)
+	}
+}
+
+// problemRecorder is implemented by the middleware response writer so the access log
+// can include the problem code and underlying cause for failed requests.
+type problemRecorder interface {
+	recordProblem(p Problem)
+	recordCause(err error)
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func decodeProblem(t *testing.T, rec *httptest.ResponseRecorder) Problem {
+	t.Helper()
+	if ct := rec.Header().Get("Content-Type"); ct != ProblemContentType {
+		t.Fatalf("expected content type %q, got %q", ProblemContentType, ct)
+	}
+	var p Problem
+	if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+		t.Fatalf("decode problem: %v (body=%q)", err, rec.Body.String())
+	}
+	return p
+}
+
+func TestErrorFromErrClassification(t *testing.T) {
+	cases := []struct {
+		err    error
+		status int
+		code   Code
+	}{
+		{InvalidRange("start after end"), http.StatusBadRequest, CodeInvalidRange},
+		{fmt.Errorf("wrapped: %w", NotFound("ppid X")), http.StatusNotFound, CodeNotFound},
+		{fmt.Errorf("scan: %w", sql.ErrNoRows), http.StatusNotFound, CodeNotFound},
+		{errors.New("database is locked (5) (SQLITE_BUSY)"), http.StatusServiceUnavailable, CodeDBBusy},
+		{errors.New("boom"), http.StatusInternalServerError, CodeInternal},
+	}
+	for _, c := range cases {
+		e := ErrorFromErr(c.err)
+		if e.Status != c.status || e.Code != c.code {
+			t.Fatalf("ErrorFromErr(%v) = %d/%s, want %d/%s", c.err, e.Status, e.Code, c.status, c.code)
+		}
+	}
+}
+
+func TestMiddlewareRequestIDAndProblem(t *testing.T) {
+	rt := NewRouter()
+	rt.HandleFunc("GET /api/range", func(w http.ResponseWriter, r *http.Request) error {
+		return InvalidRange("end before start")
+	})
+	h := Middleware(rt, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/range", nil)
+	req.Header.Set(RequestIDHeader, "abc-123")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rec.Code)
+	}
+	p := decodeProblem(t, rec)
+	if p.Code != CodeInvalidRange || p.RequestID != "abc-123" || p.Instance != "/api/range" {
+		t.Fatalf("unexpected problem: %+v", p)
+	}
+	if rec.Header().Get(RequestIDHeader) != "abc-123" {
+		t.Fatalf("request id header not echoed")
+	}
+}
+
+func TestRouterNotFoundAndMethodNotAllowed(t *testing.T) {
+	rt := NewRouter()
+	rt.HandleFunc("GET /api/topics", func(w http.ResponseWriter, r *http.Request) error {
+		WriteJSON(w, http.StatusOK, []string{})
+		return nil
+	})
+	h := Middleware(rt, nil)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/nope", nil))
+	if p := decodeProblem(t, rec); rec.Code != http.StatusNotFound || p.Code != CodeNotFound || p.RequestID == "" {
+		t.Fatalf("unexpected 404 problem: %d %+v", rec.Code, p)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/topics", nil))
+	if p := decodeProblem(t, rec); rec.Code != http.StatusMethodNotAllowed || p.Code != CodeMethodNotAllowed {
+		t.Fatalf("unexpected 405 problem: %d %+v", rec.Code, p)
+	}
+}
+
+func TestMiddlewareRecoversPanics(t *testing.T) {
+	h := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { panic("boom") }), nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/x", nil))
+	if p := decodeProblem(t, rec); rec.Code != http.StatusInternalServerError || p.Code != CodeInternal {
+		t.Fatalf("unexpected panic problem: %d %+v", rec.Code, p)
+	}
+}
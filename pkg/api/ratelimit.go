@@ -0,0 +1,85 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxLimiterClients bounds the per-client state kept by RateLimiter; beyond it, idle clients
+// (whose bucket has refilled) are dropped.
+const maxLimiterClients = 4096
+
+// RateLimiter is a per-client-IP token bucket: each client may burst up to perMinute
+// requests, refilled continuously at perMinute per minute. The client is the connection's
+// remote address; X-Forwarded-For is not trusted, so behind a proxy the proxy is limited.
+type RateLimiter struct {
+	mu        sync.Mutex
+	perMinute float64
+	clients   map[string]*bucket
+	now       func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter allows perMinute requests per client and minute; perMinute <= 0 disables limiting.
+func NewRateLimiter(perMinute int) *RateLimiter {
+	return &RateLimiter{perMinute: float64(perMinute), clients: map[string]*bucket{}, now: time.Now}
+}
+
+// Allow takes a token for client. When the bucket is empty it returns false and how long
+// until the next token.
+func (l *RateLimiter) Allow(client string) (bool, time.Duration) {
+	if l.perMinute <= 0 {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	b, ok := l.clients[client]
+	if !ok {
+		if len(l.clients) >= maxLimiterClients {
+			l.evictIdle(now)
+		}
+		b = &bucket{tokens: l.perMinute, last: now}
+		l.clients[client] = b
+	}
+	b.tokens = min(l.perMinute, b.tokens+now.Sub(b.last).Minutes()*l.perMinute)
+	b.last = now
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.perMinute * float64(time.Minute))
+		return false, wait
+	}
+	b.tokens--
+	return true, 0
+}
+
+// evictIdle drops clients whose bucket would be full again by now.
+func (l *RateLimiter) evictIdle(now time.Time) {
+	for k, b := range l.clients {
+		if b.tokens+now.Sub(b.last).Minutes()*l.perMinute >= l.perMinute {
+			delete(l.clients, k)
+		}
+	}
+}
+
+// Wrap rejects requests over the limit with a 429 rate_limited problem and a Retry-After header.
+func (l *RateLimiter) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			client = r.RemoteAddr
+		}
+		if ok, wait := l.Allow(client); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(wait/time.Second)+1))
+			WriteError(w, r, RateLimited("too many requests, retry in %s", wait.Round(time.Second)))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
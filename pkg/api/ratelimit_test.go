@@ -0,0 +1,53 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterRefills(t *testing.T) {
+	now := time.Date(2025, 9, 1, 8, 0, 0, 0, time.UTC)
+	l := NewRateLimiter(2)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.Allow("10.0.0.1"); !ok {
+			t.Fatalf("request %d should be allowed", i)
+		}
+	}
+	ok, wait := l.Allow("10.0.0.1")
+	if ok || wait <= 0 || wait > 30*time.Second {
+		t.Fatalf("third request: ok=%v wait=%s", ok, wait)
+	}
+	if ok, _ := l.Allow("10.0.0.2"); !ok {
+		t.Fatalf("other clients have their own bucket")
+	}
+	now = now.Add(30 * time.Second)
+	if ok, _ := l.Allow("10.0.0.1"); !ok {
+		t.Fatalf("a token should have refilled after 30s")
+	}
+}
+
+func TestRateLimiterWrap(t *testing.T) {
+	h := NewRateLimiter(1).Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest(http.MethodGet, "/public/snapshot", nil)
+	req.RemoteAddr = "192.0.2.7:5123"
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("first request: status %d", rec.Code)
+	}
+
+	req.RemoteAddr = "192.0.2.7:6001" // same client, new connection
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if p := decodeProblem(t, rec); p.Status != http.StatusTooManyRequests || p.Code != CodeRateLimited {
+		t.Fatalf("unexpected problem %+v", p)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("missing Retry-After")
+	}
+}
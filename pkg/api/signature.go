@@ -0,0 +1,157 @@
+package api
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Headers of a signed request; see SignRequest.
+const (
+	SignatureKeyHeader       = "X-Signature-Key"
+	SignatureTimestampHeader = "X-Signature-Timestamp"
+	SignatureHeader          = "X-Signature"
+)
+
+// signatureVersion prefixes the signature so the scheme can change without ambiguity.
+const signatureVersion = "v1="
+
+// DefaultSignatureWindow is how far a request's timestamp may be from the server's clock.
+const DefaultSignatureWindow = 5 * time.Minute
+
+// MaxSignedBody bounds the body SignatureVerifier reads to check a signature.
+const MaxSignedBody = 8 << 20
+
+// SignatureVerifier authenticates pushes from edge collectors with a shared secret per
+// collector instead of TLS client certificates. A request is signed with HMAC-SHA256 over
+// its timestamp, method, path and query, and body (SignRequest); the verifier rejects
+// unknown keys, bad signatures, timestamps outside the window and a signature it already
+// accepted within the window, so a captured request cannot be replayed. Seen signatures
+// are kept in memory: a restart forgets them, which the window bounds.
+type SignatureVerifier struct {
+	keys   map[string][]byte // read-only after NewSignatureVerifier
+	window time.Duration
+	mu     sync.Mutex
+	seen   map[string]time.Time // accepted signature -> its request timestamp
+	now    func() time.Time
+}
+
+// NewSignatureVerifier accepts requests signed with one of keys (key ID -> secret) whose
+// timestamp is within window of now; window <= 0 uses DefaultSignatureWindow.
+func NewSignatureVerifier(keys map[string][]byte, window time.Duration) *SignatureVerifier {
+	if window <= 0 {
+		window = DefaultSignatureWindow
+	}
+	k := make(map[string][]byte, len(keys))
+	for id, secret := range keys {
+		k[id] = append([]byte(nil), secret...)
+	}
+	return &SignatureVerifier{keys: k, window: window, seen: map[string]time.Time{}, now: time.Now}
+}
+
+// SignRequest signs r for keyID with secret at now, reading and restoring its body; the
+// collectors' side of SignatureVerifier.
+func SignRequest(r *http.Request, keyID string, secret []byte, now time.Time) error {
+	var body []byte
+	if r.Body != nil {
+		var err error
+		if body, err = io.ReadAll(r.Body); err != nil {
+			return fmt.Errorf("failed to read request body: %w", err)
+		}
+		_ = r.Body.Close()
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	ts := strconv.FormatInt(now.Unix(), 10)
+	r.Header.Set(SignatureKeyHeader, keyID)
+	r.Header.Set(SignatureTimestampHeader, ts)
+	r.Header.Set(SignatureHeader, signatureVersion+hex.EncodeToString(signature(secret, ts, r, body)))
+	return nil
+}
+
+// signature is the HMAC of "timestamp\nMETHOD\n/path?query\nhex(sha256(body))".
+func signature(secret []byte, ts string, r *http.Request, body []byte) []byte {
+	sum := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s", ts, r.Method, r.URL.RequestURI(), hex.EncodeToString(sum[:]))
+	return mac.Sum(nil)
+}
+
+// Verify checks r's signature and, when valid, records it against replays. It reads the
+// body (up to MaxSignedBody) and leaves it readable for the handler.
+func (v *SignatureVerifier) Verify(r *http.Request) error {
+	keyID := r.Header.Get(SignatureKeyHeader)
+	ts := r.Header.Get(SignatureTimestampHeader)
+	sig := r.Header.Get(SignatureHeader)
+	if keyID == "" || ts == "" || sig == "" {
+		return Unauthorized("request is not signed: %s, %s and %s are required",
+			SignatureKeyHeader, SignatureTimestampHeader, SignatureHeader)
+	}
+	secret, ok := v.keys[keyID]
+	if !ok {
+		return Unauthorized("unknown signature key %q", keyID)
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return Unauthorized("invalid %s %q: want unix seconds", SignatureTimestampHeader, ts)
+	}
+	signedAt := time.Unix(unix, 0)
+	now := v.now()
+	if skew := now.Sub(signedAt); skew > v.window || skew < -v.window {
+		return Unauthorized("request timestamp %s is outside the %s window", signedAt.UTC().Format(time.RFC3339), v.window)
+	}
+	got, err := hex.DecodeString(strings.TrimPrefix(sig, signatureVersion))
+	if err != nil || !strings.HasPrefix(sig, signatureVersion) {
+		return Unauthorized("invalid %s: want %s<hex>", SignatureHeader, signatureVersion)
+	}
+
+	var body []byte
+	if r.Body != nil {
+		body, err = io.ReadAll(io.LimitReader(r.Body, MaxSignedBody+1))
+		if err != nil {
+			return InvalidRequest("failed to read request body: %v", err)
+		}
+		if len(body) > MaxSignedBody {
+			return &Error{Status: http.StatusRequestEntityTooLarge, Code: CodeInvalidRequest,
+				Detail: fmt.Sprintf("request body exceeds %d bytes", MaxSignedBody)}
+		}
+		_ = r.Body.Close()
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	if !hmac.Equal(got, signature(secret, ts, r, body)) {
+		return Unauthorized("signature mismatch")
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for s, at := range v.seen {
+		if now.Sub(at) > v.window {
+			delete(v.seen, s)
+		}
+	}
+	key := keyID + ":" + sig
+	if _, replayed := v.seen[key]; replayed {
+		return Unauthorized("request already received (replay)")
+	}
+	v.seen[key] = signedAt
+	return nil
+}
+
+// Wrap rejects requests failing Verify with a 401 unauthorized problem (413 for a body
+// over MaxSignedBody).
+func (v *SignatureVerifier) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := v.Verify(r); err != nil {
+			WriteError(w, r, err)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
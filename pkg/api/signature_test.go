@@ -0,0 +1,72 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignatureVerifier(t *testing.T) {
+	now := time.Date(2025, 9, 1, 8, 0, 0, 0, time.UTC)
+	secret := []byte("collector-j01-secret")
+	v := NewSignatureVerifier(map[string][]byte{"edge-j01": secret}, time.Minute)
+	v.now = func() time.Time { return now }
+
+	var got string
+	h := v.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		got = string(b)
+	}))
+	send := func(r *http.Request) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		return rec
+	}
+	signed := func(body string, at time.Time, key string, secret []byte) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/ingest/records?line=J01", strings.NewReader(body))
+		if err := SignRequest(r, key, secret, at); err != nil {
+			t.Fatalf("SignRequest: %v", err)
+		}
+		return r
+	}
+
+	// A signed request reaches the handler with its body intact.
+	first := signed(`{"ppid":"P1"}`, now, "edge-j01", secret)
+	replay := first.Clone(first.Context())
+	replay.Body = io.NopCloser(strings.NewReader(`{"ppid":"P1"}`))
+	if rec := send(first); rec.Code != http.StatusOK || got != `{"ppid":"P1"}` {
+		t.Fatalf("signed request: status %d, body %q", rec.Code, got)
+	}
+	// Sending it again within the window is a replay.
+	if rec := send(replay); rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), "replay") {
+		t.Fatalf("replayed request: status %d, %s", rec.Code, rec.Body)
+	}
+
+	tampered := signed(`{"ppid":"P2"}`, now, "edge-j01", secret)
+	tampered.Body = io.NopCloser(strings.NewReader(`{"ppid":"P3"}`))
+	for name, r := range map[string]*http.Request{
+		"unsigned":     httptest.NewRequest(http.MethodPost, "/ingest/records", strings.NewReader("{}")),
+		"tampered":     tampered,
+		"unknown key":  signed(`{}`, now, "edge-j02", secret),
+		"wrong secret": signed(`{}`, now, "edge-j01", []byte("other")),
+		"stale":        signed(`{}`, now.Add(-2*time.Minute), "edge-j01", secret),
+		"future":       signed(`{}`, now.Add(2*time.Minute), "edge-j01", secret),
+	} {
+		rec := send(r)
+		if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), `"code":"unauthorized"`) {
+			t.Fatalf("%s: status %d, %s", name, rec.Code, rec.Body)
+		}
+	}
+
+	// Seen signatures are forgotten once their timestamp leaves the window.
+	now = now.Add(2 * time.Minute)
+	if rec := send(signed(`{"ppid":"P1"}`, now, "edge-j01", secret)); rec.Code != http.StatusOK {
+		t.Fatalf("later request: status %d, %s", rec.Code, rec.Body)
+	}
+	if len(v.seen) != 1 {
+		t.Fatalf("expired signatures kept: %d", len(v.seen))
+	}
+}
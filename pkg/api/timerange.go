@@ -0,0 +1,35 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"hex_toolset/pkg/timeutil"
+)
+
+// ParseTimeRange reads the time range of a request from either ?range=EXPR or ?from=EXPR&to=EXPR
+// (see timeutil.Parse). Failures are InvalidRange errors ready for WriteError.
+func ParseTimeRange(r *http.Request) (timeutil.TimeRange, error) {
+	q := r.URL.Query()
+	now := time.Now().In(time.Local)
+	expr, from, to := strings.TrimSpace(q.Get("range")), q.Get("from"), q.Get("to")
+	var (
+		tr  timeutil.TimeRange
+		err error
+	)
+	switch {
+	case expr != "" && (from != "" || to != ""):
+		return tr, InvalidRange("use either range or from/to, not both")
+	case expr != "":
+		tr, err = timeutil.Parse(expr, now)
+	case from != "":
+		tr, err = timeutil.ParseBounds(from, to, now)
+	default:
+		return tr, InvalidRange("missing time range: set range or from")
+	}
+	if err != nil {
+		return tr, InvalidRange("%v", err)
+	}
+	return tr, nil
+}
@@ -0,0 +1,25 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseTimeRange(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/records?from=2025-09-01&to=2025-09-02", nil)
+	tr, err := ParseTimeRange(req)
+	if err != nil || tr.Duration() != 48*time.Hour {
+		t.Fatalf("ParseTimeRange = %s, %v", tr, err)
+	}
+
+	for _, target := range []string{"/records", "/records?range=bogus", "/records?range=today&from=yesterday"} {
+		_, err := ParseTimeRange(httptest.NewRequest(http.MethodGet, target, nil))
+		var e *Error
+		if !errors.As(err, &e) || e.Code != CodeInvalidRange {
+			t.Fatalf("%s: expected invalid_range, got %v", target, err)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+// Package buildinfo identifies the running build. Release builds stamp it with ldflags:
+//
+//	go build -ldflags "-X hex_toolset/pkg/buildinfo.Version=1.4.2 \
+//	  -X hex_toolset/pkg/buildinfo.Commit=$(git rev-parse --short HEAD) \
+//	  -X hex_toolset/pkg/buildinfo.Date=$(date -u +%Y-%m-%dT%H:%M:%SZ)" ./cmd/db_clon
+//
+// Without them the commit and date come from the VCS information the go tool embeds when
+// building inside the git checkout, and the version is "dev".
+package buildinfo
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+// Set with -ldflags "-X hex_toolset/pkg/buildinfo.<Var>=<value>".
+var (
+	Version = ""
+	Commit  = ""
+	Date    = "" // RFC 3339, UTC
+)
+
+// Info describes the running build; it is served at /version.
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	Date      string `json:"date"`
+	Modified  bool   `json:"modified,omitempty"` // built from a checkout with local changes
+	GoVersion string `json:"go_version"`
+}
+
+var (
+	once sync.Once
+	info Info
+)
+
+// Get returns the build information.
+func Get() Info {
+	once.Do(func() { info = resolve(Version, Commit, Date, debug.ReadBuildInfo) })
+	return info
+}
+
+func resolve(version, commit, date string, read func() (*debug.BuildInfo, bool)) Info {
+	in := Info{Version: version, Commit: commit, Date: date, GoVersion: runtime.Version()}
+	if bi, ok := read(); ok {
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if in.Commit == "" {
+					in.Commit = s.Value
+				}
+			case "vcs.time":
+				if in.Date == "" {
+					in.Date = s.Value
+				}
+			case "vcs.modified":
+				in.Modified = s.Value == "true"
+			}
+		}
+	}
+	if len(in.Commit) > 12 {
+		in.Commit = in.Commit[:12]
+	}
+	if in.Version == "" {
+		in.Version = "dev"
+	}
+	if in.Commit == "" {
+		in.Commit = "unknown"
+	}
+	if in.Date == "" {
+		in.Date = "unknown"
+	}
+	return in
+}
+
+// String renders i on one line, e.g. "1.4.2 (commit 3f2a9c1, built 2025-03-10T08:00:00Z, go1.24.1)".
+func (i Info) String() string {
+	commit := i.Commit
+	if i.Modified {
+		commit += "+dirty"
+	}
+	return fmt.Sprintf("%s (commit %s, built %s, %s)", i.Version, commit, i.Date, i.GoVersion)
+}
+
+// Banner is the startup log line of program.
+func Banner(program string) string { return fmt.Sprintf("starting %s %s", program, Get()) }
@@ -0,0 +1,33 @@
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	vcs := func() (*debug.BuildInfo, bool) {
+		return &debug.BuildInfo{Settings: []debug.BuildSetting{
+			{Key: "vcs.revision", Value: "3f2a9c1d5e6b7a8c9d0e1f2a3b4c5d6e7f8a9b0c"},
+			{Key: "vcs.time", Value: "2025-03-10T08:00:00Z"},
+			{Key: "vcs.modified", Value: "true"},
+		}}, true
+	}
+	none := func() (*debug.BuildInfo, bool) { return nil, false }
+
+	if got := resolve("1.4.2", "abc1234", "2025-03-11T09:00:00Z", vcs); got.Version != "1.4.2" || got.Commit != "abc1234" ||
+		got.Date != "2025-03-11T09:00:00Z" || !got.Modified {
+		t.Errorf("ldflags win over VCS info: %+v", got)
+	}
+	got := resolve("", "", "", vcs)
+	if got.Version != "dev" || got.Commit != "3f2a9c1d5e6b" || got.Date != "2025-03-10T08:00:00Z" {
+		t.Errorf("from VCS info: %+v", got)
+	}
+	if want := "dev (commit 3f2a9c1d5e6b+dirty, built 2025-03-10T08:00:00Z, " + runtime.Version() + ")"; got.String() != want {
+		t.Errorf("String() = %q, want %q", got.String(), want)
+	}
+	if got := resolve("", "", "", none); got.Version != "dev" || got.Commit != "unknown" || got.Date != "unknown" {
+		t.Errorf("without any info: %+v", got)
+	}
+}
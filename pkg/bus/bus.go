@@ -0,0 +1,96 @@
+// Package bus is an in-process, typed publish/subscribe event bus. Managers publish what
+// happened (a minute ingested, an alert raised, a setting changed) and the subsystems
+// needing it subscribe to the event type, so neither side knows the other and a subsystem
+// disabled in a deployment simply does not subscribe.
+//
+// Handlers run synchronously on the publishing goroutine, in subscription order, so they
+// must be quick and hand off anything slow; a panicking handler is logged and does not
+// stop the publisher or the other handlers.
+package bus
+
+import (
+	"reflect"
+	"sync"
+
+	"hex_toolset/pkg/logger"
+)
+
+// Bus dispatches events to the handlers of their type. The zero value is not usable; a nil
+// *Bus drops every event.
+type Bus struct {
+	logger *logger.Logger
+
+	mu   sync.RWMutex
+	subs map[reflect.Type][]*handler // replaced, never modified, so Publish reads it unlocked
+}
+
+type handler struct {
+	fn any // func(E) of the key type
+}
+
+// New creates a bus logging panicking handlers to lgr (nil: not logged).
+func New(lgr *logger.Logger) *Bus {
+	return &Bus{logger: lgr, subs: map[reflect.Type][]*handler{}}
+}
+
+// Subscribe registers fn for the events of type E published on b and returns the function
+// removing it. Subscribing to a nil bus does nothing.
+func Subscribe[E any](b *Bus, fn func(E)) (unsubscribe func()) {
+	if b == nil {
+		return func() {}
+	}
+	t := reflect.TypeFor[E]()
+	h := &handler{fn: fn}
+	b.mu.Lock()
+	b.subs[t] = append(b.subs[t][:len(b.subs[t]):len(b.subs[t])], h)
+	b.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			hs := b.subs[t]
+			for i := range hs {
+				if hs[i] == h {
+					b.subs[t] = append(hs[:i:i], hs[i+1:]...)
+					break
+				}
+			}
+		})
+	}
+}
+
+// Publish passes ev to the handlers of type E, in subscription order.
+func Publish[E any](b *Bus, ev E) {
+	if b == nil {
+		return
+	}
+	t := reflect.TypeFor[E]()
+	b.mu.RLock()
+	hs := b.subs[t]
+	b.mu.RUnlock()
+	for _, h := range hs {
+		b.call(t, func() { h.fn.(func(E))(ev) })
+	}
+}
+
+// Subscribed reports whether events of type E have a handler on b, to skip building an
+// event nobody receives.
+func Subscribed[E any](b *Bus) bool {
+	if b == nil {
+		return false
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.subs[reflect.TypeFor[E]()]) > 0
+}
+
+func (b *Bus) call(t reflect.Type, fn func()) {
+	defer func() {
+		if r := recover(); r != nil && b.logger != nil {
+			b.logger.Errorf("%s handler panicked: %v", t, r)
+		}
+	}()
+	fn()
+}
@@ -0,0 +1,40 @@
+package bus
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPublishSubscribe(t *testing.T) {
+	b := New(nil)
+	var got []string
+	unsubscribe := Subscribe(b, func(ev MinuteIngested) { got = append(got, "first "+ev.Source) })
+	Subscribe(b, func(ev MinuteIngested) { panic("handler bug") })
+	Subscribe(b, func(ev MinuteIngested) { got = append(got, "third "+ev.Source) })
+	Subscribe(b, func(ev ConfigChanged) { got = append(got, "config "+ev.Source) })
+	if !Subscribed[MinuteIngested](b) || Subscribed[AlertRaised](b) {
+		t.Fatal("Subscribed does not follow the subscriptions")
+	}
+
+	// in subscription order, by type, past a panicking handler
+	Publish(b, MinuteIngested{Minute: time.Now(), Source: "live"})
+	Publish(b, ConfigChanged{Source: ConfigFeatureFlags})
+	Publish(b, AlertRaised{Key: "nobody listens"})
+	if want := []string{"first live", "third live", "config feature_flags"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("handled %v, want %v", got, want)
+	}
+
+	got = nil
+	unsubscribe()
+	unsubscribe()
+	Publish(b, MinuteIngested{Source: "repair"})
+	if want := []string{"third repair"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("after unsubscribing handled %v, want %v", got, want)
+	}
+
+	// a nil bus drops everything
+	var none *Bus
+	Subscribe(none, func(MinuteIngested) { t.Fatal("handler of a nil bus ran") })()
+	Publish(none, MinuteIngested{})
+}
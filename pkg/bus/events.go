@@ -0,0 +1,43 @@
+package bus
+
+import "time"
+
+// MinuteIngested is published after a minute was fetched and stored (Records may be 0 for
+// an empty minute). Source is the ingest ledger source: live or repair.
+type MinuteIngested struct {
+	Minute  time.Time `json:"minute"`
+	Records int       `json:"records"`
+	Source  string    `json:"source"`
+}
+
+// AlertRaised is published when an alert becomes active. Maintenance names the
+// maintenance window it was raised in, in which case it is not broadcast.
+type AlertRaised struct {
+	Key         string    `json:"key"`
+	Severity    string    `json:"severity"`
+	Source      string    `json:"source"`
+	Message     string    `json:"message"`
+	At          time.Time `json:"at"`
+	Maintenance string    `json:"maintenance,omitempty"`
+}
+
+// AlertResolved is published when an active alert is cleared.
+type AlertResolved struct {
+	Key     string    `json:"key"`
+	Source  string    `json:"source"`
+	Message string    `json:"message"`
+	At      time.Time `json:"at"`
+}
+
+// Sources of ConfigChanged.
+const (
+	ConfigFeatureFlags    = "feature_flags"    // Changed: the flags toggled
+	ConfigLineMaintenance = "line_maintenance" // Changed: the lines now disabled
+)
+
+// ConfigChanged is published when a runtime setting changed, in this process or (seen on
+// the next reload) another one.
+type ConfigChanged struct {
+	Source  string   `json:"source"`
+	Changed []string `json:"changed"`
+}
@@ -0,0 +1,170 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"hex_toolset/pkg/logger"
+)
+
+// Format selects how a command reports its result.
+type Format string
+
+const (
+	FormatTable Format = "table" // human readable key/value table (default)
+	FormatJSON  Format = "json"  // one JSON document on stdout
+	FormatQuiet Format = "quiet" // nothing on stdout; rely on the exit code
+)
+
+// ParseFormat validates an --output value.
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(strings.TrimSpace(s))); f {
+	case FormatTable, FormatJSON, FormatQuiet:
+		return f, nil
+	case "":
+		return FormatTable, nil
+	default:
+		return "", fmt.Errorf("invalid output format %q, expected json|table|quiet", s)
+	}
+}
+
+// ExtractOutputFlag removes --output/-o (as "--output json" or "--output=json") from args,
+// wherever it appears, and returns the remaining positional arguments.
+func ExtractOutputFlag(args []string) (Format, []string, error) {
+	format := FormatTable
+	rest := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		var val string
+		switch {
+		case a == "--output" || a == "-o" || a == "-output":
+			if i+1 >= len(args) {
+				return "", nil, fmt.Errorf("%s requires a value (json|table|quiet)", a)
+			}
+			val = args[i+1]
+			i++
+		case strings.HasPrefix(a, "--output="):
+			val = strings.TrimPrefix(a, "--output=")
+		case strings.HasPrefix(a, "-o="):
+			val = strings.TrimPrefix(a, "-o=")
+		default:
+			rest = append(rest, a)
+			continue
+		}
+		f, err := ParseFormat(val)
+		if err != nil {
+			return "", nil, err
+		}
+		format = f
+	}
+	return format, rest, nil
+}
+
+// Result is the machine-readable outcome of one command run.
+type Result struct {
+	Command    string         `json:"command"`
+	OK         bool           `json:"ok"`
+	Error      string         `json:"error,omitempty"`
+	StartedAt  time.Time      `json:"started_at"`
+	FinishedAt time.Time      `json:"finished_at"`
+	Data       map[string]any `json:"data,omitempty"`
+}
+
+// Printer writes results in the selected format.
+type Printer struct {
+	Format Format
+	Out    io.Writer
+}
+
+// NewPrinter creates a printer writing to stdout. For json and quiet formats it also
+// redirects logger console output to stderr so stdout only carries the result.
+func NewPrinter(format Format) *Printer {
+	if format != FormatTable {
+		logger.SetDefaultConsoleWriter(os.Stderr)
+	}
+	return &Printer{Format: format, Out: os.Stdout}
+}
+
+// Print writes r.
+func (p *Printer) Print(r Result) error {
+	switch p.Format {
+	case FormatQuiet:
+		return nil
+	case FormatJSON:
+		enc := json.NewEncoder(p.Out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	default:
+		tw := tabwriter.NewWriter(p.Out, 0, 0, 2, ' ', 0)
+		status := "ok"
+		if !r.OK {
+			status = "error"
+		}
+		fmt.Fprintf(tw, "COMMAND\t%s\n", r.Command)
+		fmt.Fprintf(tw, "STATUS\t%s\n", status)
+		if r.Error != "" {
+			fmt.Fprintf(tw, "ERROR\t%s\n", r.Error)
+		}
+		fmt.Fprintf(tw, "DURATION\t%s\n", r.FinishedAt.Sub(r.StartedAt).Round(time.Millisecond))
+		keys := make([]string, 0, len(r.Data))
+		for k := range r.Data {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(tw, "%s\t%s\n", strings.ToUpper(k), formatValue(r.Data[k]))
+		}
+		return tw.Flush()
+	}
+}
+
+// Message prints informational text (usage, hints) only in table format.
+func (p *Printer) Message(format string, args ...any) {
+	if p.Format != FormatTable {
+		return
+	}
+	fmt.Fprintf(p.Out, format+"\n", args...)
+}
+
+func formatValue(v any) string {
+	switch x := v.(type) {
+	case []string:
+		if len(x) == 0 {
+			return "-"
+		}
+		return strings.Join(x, ", ")
+	case time.Time:
+		return x.Format(time.RFC3339)
+	}
+	switch reflect.ValueOf(v).Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map, reflect.Struct:
+		if b, err := json.Marshal(v); err == nil {
+			return string(b)
+		}
+	}
+	return fmt.Sprint(v)
+}
+
+// Finish completes r with err, prints it and returns the process exit code
+// (0 on success, 1 on failure) for the caller to pass to os.Exit.
+func (p *Printer) Finish(r *Result, err error) int {
+	r.FinishedAt = time.Now()
+	r.OK = err == nil
+	if err != nil {
+		r.Error = err.Error()
+	}
+	if perr := p.Print(*r); perr != nil {
+		fmt.Fprintf(os.Stderr, "failed to write output: %v\n", perr)
+	}
+	if err != nil {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,109 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExtractOutputFlag(t *testing.T) {
+	cases := []struct {
+		args   []string
+		format Format
+		rest   []string
+	}{
+		{[]string{"load_day", "2025-01-01"}, FormatTable, []string{"load_day", "2025-01-01"}},
+		{[]string{"--output", "json", "load_day", "2025-01-01"}, FormatJSON, []string{"load_day", "2025-01-01"}},
+		{[]string{"load_day", "2025-01-01", "--output=quiet"}, FormatQuiet, []string{"load_day", "2025-01-01"}},
+		{[]string{"-o", "TABLE", "x"}, FormatTable, []string{"x"}},
+	}
+	for _, c := range cases {
+		f, rest, err := ExtractOutputFlag(c.args)
+		if err != nil {
+			t.Fatalf("%v: %v", c.args, err)
+		}
+		if f != c.format || strings.Join(rest, " ") != strings.Join(c.rest, " ") {
+			t.Fatalf("%v: got %s %v", c.args, f, rest)
+		}
+	}
+	if _, _, err := ExtractOutputFlag([]string{"--output", "yaml"}); err == nil {
+		t.Fatal("expected error for unknown format")
+	}
+	if _, _, err := ExtractOutputFlag([]string{"--output"}); err == nil {
+		t.Fatal("expected error for missing value")
+	}
+}
+
+func TestPrinterFormats(t *testing.T) {
+	start := time.Date(2025, 1, 1, 6, 0, 0, 0, time.UTC)
+	r := Result{Command: "fix load_day", OK: true, StartedAt: start, FinishedAt: start.Add(time.Second),
+		Data: map[string]any{"date": "2025-01-01", "created": []string{"a", "b"}}}
+
+	var buf bytes.Buffer
+	if err := (&Printer{Format: FormatJSON, Out: &buf}).Print(r); err != nil {
+		t.Fatal(err)
+	}
+	var got Result
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("json output not parseable: %v\n%s", err, buf.String())
+	}
+	if got.Command != r.Command || !got.OK || got.Data["date"] != "2025-01-01" {
+		t.Fatalf("unexpected json result: %+v", got)
+	}
+
+	buf.Reset()
+	if err := (&Printer{Format: FormatTable, Out: &buf}).Print(r); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"STATUS", "ok", "CREATED", "a, b", "DATE"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Fatalf("table output missing %q:\n%s", want, buf.String())
+		}
+	}
+
+	buf.Reset()
+	p := &Printer{Format: FormatQuiet, Out: &buf}
+	_ = p.Print(r)
+	p.Message("hello")
+	if buf.Len() != 0 {
+		t.Fatalf("quiet format wrote %q", buf.String())
+	}
+}
+
+func TestWriteStatus(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2025, 1, 1, 6, 0, 0, 0, time.UTC)
+	s := Status{
+		Result:   Result{Command: "fix load_days", Error: "range load completed with 1 day(s) failed", StartedAt: start, FinishedAt: start.Add(time.Minute), Data: map[string]any{"records": 120}},
+		ExitCode: 1,
+		Failures: 3,
+	}
+	path, err := WriteStatus(dir, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(path) != "status_fix_load_days.json" {
+		t.Fatalf("status written to %s", path)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("status not parseable: %v\n%s", err, b)
+	}
+	for k, want := range map[string]any{"command": "fix load_days", "ok": false, "exit_code": 1.0, "failures": 3.0,
+		"started_at": "2025-01-01T06:00:00Z", "finished_at": "2025-01-01T06:01:00Z"} {
+		if got[k] != want {
+			t.Fatalf("%s = %v, want %v\n%s", k, got[k], want, b)
+		}
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Fatalf("status dir holds %d files, want only the status", len(entries))
+	}
+}
@@ -0,0 +1,48 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Status is the summary a command leaves in its status file at completion, so the scripts
+// scheduling it can check the outcome without parsing logs.
+type Status struct {
+	Result
+	ExitCode int `json:"exit_code"`
+	// Failures counts the units of work (hours, days, minutes...) that failed. A failed run
+	// whose data still shows work done (e.g. records > 0) failed only partially.
+	Failures int `json:"failures"`
+}
+
+// StatusFileName returns the status file of command: "fix load_day" writes
+// status_fix_load_day.json, so each subcommand keeps its own last outcome.
+func StatusFileName(command string) string {
+	return "status_" + strings.Join(strings.Fields(command), "_") + ".json"
+}
+
+// WriteStatus writes s to StatusFileName(s.Command) in dir, creating dir if needed, and
+// returns the file's path. The file is replaced atomically, so a reader never sees a
+// partial document.
+func WriteStatus(dir string, s Status) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("status directory: %w", err)
+	}
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("encode status: %w", err)
+	}
+	path := filepath.Join(dir, StatusFileName(s.Command))
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(b, '\n'), 0644); err != nil {
+		return "", fmt.Errorf("write status: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return "", fmt.Errorf("write status: %w", err)
+	}
+	return path, nil
+}
@@ -4,20 +4,233 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/joho/godotenv"
+
+	"hex_toolset/pkg/sfc_api"
+	"hex_toolset/pkg/shifts"
 )
 
-// Config holds all configuration for the application
+// DefaultRecordCacheMinutes is the default of RECORD_CACHE_MINUTES: a bit more than one
+// hour, so the hourly reconciliation can be answered entirely from memory.
+const DefaultRecordCacheMinutes = 90
+
+// Config holds all configuration for the application. The settings listed in Settings are
+// validated by Validate and documented by `hex config check`.
 type Config struct {
 	SFC_API       string
-	SFC_CLON      string
+	SFC_CLON      string // database file; the broadcast service also checks its schema when set
+	DB_DRIVER     string // "sqlite" (SFC_CLON) or "postgres" (DB_DSN, read by package db only)
 	SFC_DB_STATUS string
-	MESSAGE_DIR   string
+	MESSAGE_DIR   string // where db_clon writes broadcast message files
 	WS_ADD        string
 	WS_PORT       string
 	LOG_DIR       string
+
+	// SFC_API_BACKUP is the disaster recovery API used while the primary's circuit is open
+	// (empty disables failover): SFC_API_BREAKER_FAILURES consecutive failures open it and
+	// the primary is probed again every SFC_API_BREAKER_COOLDOWN_SECONDS.
+	SFC_API_BACKUP                   string
+	SFC_API_BREAKER_FAILURES         int
+	SFC_API_BREAKER_COOLDOWN_SECONDS int
+	// SFC_MINUTE_CONCURRENCY bounds the parallel minute requests of an hour refetched by
+	// minute, which happens when the hour fails or its response exceeds SFC_HOUR_MAX_BYTES
+	// (0 disables the limit).
+	SFC_MINUTE_CONCURRENCY int
+	SFC_HOUR_MAX_BYTES     int
+
+	// BROADCAST_MESSAGE_DIR is the directory the broadcast service watches and keeps the
+	// history in (default MESSAGE_DIR); set it when the service sees db_clon's files under
+	// another path. BROADCAST_WS_ADDR is the host:port its websocket server listens on,
+	// derived from WS_ADD and WS_PORT when unset.
+	BROADCAST_MESSAGE_DIR string
+	BROADCAST_WS_ADDR     string
+
+	// BROADCAST_ADMIN_ADDR is the listen address of the broadcast service's admin endpoint
+	// (health, /metrics, runtime log levels), apart from the websocket port clients reach;
+	// empty disables it. Keep it on loopback.
+	BROADCAST_ADMIN_ADDR string
+
+	// WS_WRITE_TIMEOUT_SECONDS is the per-client deadline of each websocket frame; slower
+	// clients are disconnected. WS_MAX_BATCH caps the messages per frame for clients that
+	// connect with ?batch=ndjson (others always get one message per frame).
+	WS_WRITE_TIMEOUT_SECONDS int
+	WS_MAX_BATCH             int
+
+	// WS_POLL_TIMEOUT_SECONDS is how long GET /api/stream/poll, the long-poll fallback for
+	// clients without websocket support, holds a request open waiting for a message.
+	WS_POLL_TIMEOUT_SECONDS int
+
+	// WS_DASHBOARD serves the embedded live dashboard at / of the broadcast service, for
+	// sites that do not deploy the separate frontend.
+	WS_DASHBOARD bool
+
+	// MESSAGE_HISTORY_HOURS makes the broadcast service keep the MESSAGE_DIR files it relayed
+	// in MESSAGE_DIR/history for that many hours instead of deleting them, gzipped once an
+	// hour old (0 deletes them right away).
+	MESSAGE_HISTORY_HOURS int
+
+	// IPC_SOCKET is the Unix-domain socket through which db_clon pushes broadcasts straight
+	// to the broadcast service instead of MESSAGE_DIR files (empty disables). Both processes
+	// must use the same path; MESSAGE_DIR stays the fallback while the socket is down.
+	IPC_SOCKET string
+
+	// MQTT_URL is the MQTT broker db_clon also publishes every broadcast to, under
+	// MQTT_TOPIC_PREFIX + topic (e.g. "tcp://mosquitto:1883"); empty disables it.
+	MQTT_URL          string
+	MQTT_TOPIC_PREFIX string
+
+	// BACKPLANE_URL enables the pub/sub backplane shared by broadcast instances, Redis
+	// ("redis://redis:6379/0") or NATS ("nats://nats:4222"); empty runs a single standalone
+	// instance. BACKPLANE_CHANNEL is the Redis channel or NATS subject.
+	BACKPLANE_URL     string
+	BACKPLANE_CHANNEL string
+
+	// SHIFTS is the shift calendar, e.g. "A=06:00-18:00,B=18:00-06:00" (shifts.DefaultSpec).
+	SHIFTS string
+
+	// RECORD_CACHE_MINUTES is how many recent minutes of fetched records are kept in memory.
+	RECORD_CACHE_MINUTES int
+
+	// EXPORT_DESTINATIONS lists incremental export targets as "name=dir[,name=dir]" (empty disables).
+	// EXPORT_AT is the daily run time (HH:MM); EXPORT_LAG_MINUTES keeps the newest minutes out
+	// of the export until hour reloads have settled.
+	EXPORT_DESTINATIONS string
+	EXPORT_AT           string
+	EXPORT_LAG_MINUTES  int
+
+	// TIER_RAW_DAYS keeps raw records for that many days; older days are rolled up hourly and
+	// their raw rows moved to gzipped files in TIER_ARCHIVE_DIR, daily at TIER_AT (HH:MM).
+	// 0 disables tiering.
+	TIER_RAW_DAYS    int
+	TIER_ARCHIVE_DIR string
+	TIER_AT          string
+
+	// RETENTION_DAYS deletes the records collected more than that many days ago, daily at
+	// RETENTION_AT (HH:MM), RETENTION_BATCH rows per transaction; nothing is archived.
+	// 0 disables it. With tiering it must exceed TIER_RAW_DAYS.
+	RETENTION_DAYS  int
+	RETENTION_AT    string
+	RETENTION_BATCH int
+
+	// STORAGE_HISTORY_DAYS is how many past days of records_table the storage forecast fits
+	// the daily volume on. STORAGE_CAPACITY_GB is the disk space available to the database
+	// file, from which the forecast tells the days left (0 leaves it out).
+	STORAGE_HISTORY_DAYS int
+	STORAGE_CAPACITY_GB  float64
+
+	// DB_BUDGET_INSERT_MS / DB_BUDGET_QUERY_MS bound DB operations during live ingest (0 disables).
+	DB_BUDGET_INSERT_MS int
+	DB_BUDGET_QUERY_MS  int
+
+	// FEATURE_FLAG_TTL_SECONDS is how long feature flags are cached before the table is re-read.
+	FEATURE_FLAG_TTL_SECONDS int
+
+	// ADMIN_ADDR is the listen address of db_clon's admin endpoint (health, /metrics,
+	// runtime log levels); empty disables it. Keep it on loopback.
+	ADMIN_ADDR string
+	// ADMIN_TOKENS are the bearer tokens of the admin endpoints, "label=token" comma
+	// separated; requests that change something must send one and are audited under its
+	// label. Empty leaves the endpoints unauthenticated.
+	ADMIN_TOKENS string
+
+	// PUSH_ADDR is the listen address of db_clon's push ingest endpoint, through which edge
+	// collectors send records as they see them (empty disables it). PUSH_KEYS are the
+	// collectors' signing secrets, "collector=secret" comma separated; a request must be
+	// signed with its collector's secret.
+	PUSH_ADDR string
+	PUSH_KEYS string
+
+	// PUBLIC_ADDR is the listen address of the unauthenticated lobby-display snapshot
+	// (empty disables it). PUBLIC_FIELDS is the allowlist of per-line fields it exposes,
+	// PUBLIC_OUTPUT_GROUP the group whose passes count as line output (also the units of the
+	// admin endpoint's program rollups); responses are cached
+	// for PUBLIC_CACHE_SECONDS and each client IP is limited to PUBLIC_RATE_PER_MINUTE requests.
+	// A line with no pass for PUBLIC_IDLE_MINUTES is reported idle.
+	PUBLIC_ADDR            string
+	PUBLIC_FIELDS          string
+	PUBLIC_OUTPUT_GROUP    string
+	PUBLIC_CACHE_SECONDS   int
+	PUBLIC_RATE_PER_MINUTE int
+	PUBLIC_IDLE_MINUTES    int
+
+	// HEARTBEAT_FILE is rewritten after every live minute cycle with the time, the last
+	// ingested minute and the cycle status, for file-age monitoring (empty disables).
+	HEARTBEAT_FILE string
+
+	// SLO_INGEST_TARGET (percent) of minutes must be ingested within SLO_INGEST_LATENCY_SECONDS
+	// of the minute's end; db_clon tracks compliance and burn rate against it.
+	SLO_INGEST_TARGET          float64
+	SLO_INGEST_LATENCY_SECONDS int
+
+	// PASS_HISTORY_SLOTS enables pass history mode: every passing second of a (line, group)
+	// is recorded for takt analytics, and daily at PASS_HISTORY_COMPACT_AT (HH:MM, an idle
+	// hour) the history is trimmed to the newest PASS_HISTORY_SLOTS per (line, group).
+	// 0 disables it.
+	PASS_HISTORY_SLOTS      int
+	PASS_HISTORY_COMPACT_AT string
+
+	// LATEST_SNAPSHOT_MINUTES is the shortest interval between two LATEST snapshots, the full
+	// list of units in process, published only when the WIP changed (0 disables).
+	LATEST_SNAPSHOT_MINUTES int
+	// LATEST_LINE_SNAPSHOTS also publishes each line's part of LATEST as LATEST_<LINE>
+	// (e.g. LATEST_J06), for line-side displays subscribing to their line only.
+	LATEST_LINE_SNAPSHOTS bool
+
+	// MODEL_RUN_GROUP is the output group whose passes segment each line into model runs,
+	// detecting changeovers (empty disables).
+	MODEL_RUN_GROUP string
+
+	// STATION_VARIANCE_WINDOW_MINUTES is the rolling window over which db_clon measures the
+	// cycle time of the stations with a target for STATION_VARIANCE (0 disables). It is
+	// served from the record cache, so it must not exceed RECORD_CACHE_MINUTES.
+	STATION_VARIANCE_WINDOW_MINUTES int
+
+	// OEE_STOP_MINUTES is the shortest gap without a record at a station that counts as
+	// downtime in the OEE availability (0 counts no downtime).
+	OEE_STOP_MINUTES int
+
+	// MAINTENANCE_WINDOWS are daily planned stops, "HH:MM-HH:MM" for every line or
+	// "LINE=HH:MM-HH:MM" for one, comma separated (e.g. "22:00-06:00,J01=12:00-12:30").
+	// During a window alerts are not broadcast, its time is neither planned nor downtime in
+	// the OEE and the dashboard shows the lines as under maintenance instead of stale. Dated
+	// windows are added in the maintenance_window table.
+	MAINTENANCE_WINDOWS string
+
+	// INTEGRITY_CHECK_AT is the daily time (HH:MM, an idle hour) db_clon checks the database
+	// file for corruption and the schema for missing indexes and triggers, alerting on any
+	// finding (empty disables). The check is a quick_check, except on INTEGRITY_FULL_CHECK_DAY
+	// (a weekday name, empty never) when the slower integrity_check also verifies every index.
+	INTEGRITY_CHECK_AT       string
+	INTEGRITY_FULL_CHECK_DAY string
+
+	// REPAIR_INTERVAL_MINUTES is how often db_clon repairs missing minutes of the current hour (0 disables).
+	REPAIR_INTERVAL_MINUTES int
+
+	// MINUTE_LOOP_OFFSET_SECONDS moves db_clon's minute fetch from hh:mm:02 to that many
+	// seconds later, and MINUTE_LOOP_JITTER_SECONDS adds a random 0..N second delay to each
+	// fetch, so sites sharing the upstream API spread their requests across the minute.
+	MINUTE_LOOP_OFFSET_SECONDS int
+	MINUTE_LOOP_JITTER_SECONDS int
+
+	// CLOCK_OFFSET_MINUTES shifts the clock db_clon's loops and SFC requests run on, e.g.
+	// -1440 replays yesterday minute by minute against a test database (0 runs live).
+	CLOCK_OFFSET_MINUTES int
+
+	// DB_BOOTSTRAP makes db_clon and the broadcast service apply the pending schema
+	// migrations (pkg/db/migrations) at startup, as cmd/db_manager does, so a fresh
+	// deployment or an upgrade needs no separate setup step. Off by default: migrations may
+	// rewrite data (e.g. the UTC migration), so they run only when asked for.
+	DB_BOOTSTRAP bool
+
+	// DISABLED_SUBSYSTEMS lists the optional db_clon subsystems left out of a deployment,
+	// comma separated (see Subsystems), e.g. "station_variance,oee" at a site without
+	// station targets or shifts. A disabled subsystem neither subscribes to the ingest
+	// events nor runs on a schedule.
+	DISABLED_SUBSYSTEMS string
 }
 
 var (
@@ -38,19 +251,134 @@ func GetConfig() *Config {
 			// Use environment variables or default values
 			SFC_API:       getEnv("SFC_API", ""),
 			SFC_CLON:      getEnv("SFC_CLON", ""),
+			DB_DRIVER:     getEnv("DB_DRIVER", "sqlite"),
 			LOG_DIR:       getEnv("LOG_DIR", "logs"),
 			SFC_DB_STATUS: getEnv("SFC_DB_STATUS", ""),
 			MESSAGE_DIR:   getEnv("MESSAGE_DIR", "broadcast_messages"),
 			WS_ADD:        getEnv("WS_ADD", "localhost"),
 			WS_PORT:       getEnv("WS_PORT", "8081"),
+
+			SFC_API_BACKUP:                   getEnv("SFC_API_BACKUP", ""),
+			SFC_API_BREAKER_FAILURES:         getEnvAsInt("SFC_API_BREAKER_FAILURES", sfc_api.DefaultBreakerFailures),
+			SFC_API_BREAKER_COOLDOWN_SECONDS: getEnvAsInt("SFC_API_BREAKER_COOLDOWN_SECONDS", int(sfc_api.DefaultBreakerCooldown/time.Second)),
+			SFC_MINUTE_CONCURRENCY:           getEnvAsInt("SFC_MINUTE_CONCURRENCY", sfc_api.DefaultMinuteConcurrency),
+			SFC_HOUR_MAX_BYTES:               getEnvAsInt("SFC_HOUR_MAX_BYTES", sfc_api.DefaultMaxHourBytes),
+
+			WS_WRITE_TIMEOUT_SECONDS: getEnvAsInt("WS_WRITE_TIMEOUT_SECONDS", 10),
+			WS_MAX_BATCH:             getEnvAsInt("WS_MAX_BATCH", 64),
+			WS_POLL_TIMEOUT_SECONDS:  getEnvAsInt("WS_POLL_TIMEOUT_SECONDS", 25),
+			WS_DASHBOARD:             getEnvAsBool("WS_DASHBOARD", true),
+			MESSAGE_HISTORY_HOURS:    getEnvAsInt("MESSAGE_HISTORY_HOURS", 0),
+
+			IPC_SOCKET: getEnv("IPC_SOCKET", ""),
+
+			MQTT_URL:          getEnv("MQTT_URL", ""),
+			MQTT_TOPIC_PREFIX: getEnvAllowEmpty("MQTT_TOPIC_PREFIX", "hex_toolset/"),
+			BACKPLANE_URL:     getEnv("BACKPLANE_URL", ""),
+			BACKPLANE_CHANNEL: getEnv("BACKPLANE_CHANNEL", "hex_toolset:broadcast"),
+
+			SHIFTS:               getEnv("SHIFTS", shifts.DefaultSpec),
+			RECORD_CACHE_MINUTES: getEnvAsInt("RECORD_CACHE_MINUTES", DefaultRecordCacheMinutes),
+
+			REPAIR_INTERVAL_MINUTES: getEnvAsInt("REPAIR_INTERVAL_MINUTES", 10),
+			CLOCK_OFFSET_MINUTES:    getEnvAsInt("CLOCK_OFFSET_MINUTES", 0),
+			ADMIN_ADDR:              getEnv("ADMIN_ADDR", "127.0.0.1:9092"),
+			ADMIN_TOKENS:            getEnv("ADMIN_TOKENS", ""),
+			PUSH_ADDR:               getEnv("PUSH_ADDR", ""),
+			PUSH_KEYS:               getEnv("PUSH_KEYS", ""),
+
+			MINUTE_LOOP_OFFSET_SECONDS: getEnvAsInt("MINUTE_LOOP_OFFSET_SECONDS", 0),
+			MINUTE_LOOP_JITTER_SECONDS: getEnvAsInt("MINUTE_LOOP_JITTER_SECONDS", 0),
+
+			FEATURE_FLAG_TTL_SECONDS: getEnvAsInt("FEATURE_FLAG_TTL_SECONDS", 30),
+
+			PUBLIC_ADDR:            getEnv("PUBLIC_ADDR", ""),
+			PUBLIC_FIELDS:          getEnv("PUBLIC_FIELDS", "output_today,output_hour,status"),
+			PUBLIC_OUTPUT_GROUP:    getEnv("PUBLIC_OUTPUT_GROUP", "PACKING"),
+			PUBLIC_CACHE_SECONDS:   getEnvAsInt("PUBLIC_CACHE_SECONDS", 30),
+			PUBLIC_RATE_PER_MINUTE: getEnvAsInt("PUBLIC_RATE_PER_MINUTE", 60),
+			PUBLIC_IDLE_MINUTES:    getEnvAsInt("PUBLIC_IDLE_MINUTES", 10),
+
+			TIER_RAW_DAYS:    getEnvAsInt("TIER_RAW_DAYS", 0),
+			TIER_ARCHIVE_DIR: getEnv("TIER_ARCHIVE_DIR", "archive"),
+			TIER_AT:          getEnv("TIER_AT", "02:30"),
+
+			RETENTION_DAYS:  getEnvAsInt("RETENTION_DAYS", 0),
+			RETENTION_AT:    getEnv("RETENTION_AT", "03:00"),
+			RETENTION_BATCH: getEnvAsInt("RETENTION_BATCH", 5000),
+
+			STORAGE_HISTORY_DAYS: getEnvAsInt("STORAGE_HISTORY_DAYS", 28),
+			STORAGE_CAPACITY_GB:  getEnvAsFloat("STORAGE_CAPACITY_GB", 0),
+
+			DB_BUDGET_INSERT_MS: getEnvAsInt("DB_BUDGET_INSERT_MS", 5000),
+			DB_BUDGET_QUERY_MS:  getEnvAsInt("DB_BUDGET_QUERY_MS", 3000),
+
+			EXPORT_DESTINATIONS: getEnv("EXPORT_DESTINATIONS", ""),
+			EXPORT_AT:           getEnv("EXPORT_AT", "01:00"),
+			EXPORT_LAG_MINUTES:  getEnvAsInt("EXPORT_LAG_MINUTES", 120),
+
+			HEARTBEAT_FILE: getEnv("HEARTBEAT_FILE", ""),
+
+			SLO_INGEST_TARGET:          getEnvAsFloat("SLO_INGEST_TARGET", 99.5),
+			SLO_INGEST_LATENCY_SECONDS: getEnvAsInt("SLO_INGEST_LATENCY_SECONDS", 120),
+
+			PASS_HISTORY_SLOTS:      getEnvAsInt("PASS_HISTORY_SLOTS", 0),
+			PASS_HISTORY_COMPACT_AT: getEnv("PASS_HISTORY_COMPACT_AT", "03:30"),
+
+			MODEL_RUN_GROUP:         getEnv("MODEL_RUN_GROUP", "PACKING"),
+			LATEST_SNAPSHOT_MINUTES: getEnvAsInt("LATEST_SNAPSHOT_MINUTES", 5),
+			LATEST_LINE_SNAPSHOTS:   getEnvAsBool("LATEST_LINE_SNAPSHOTS", false),
+
+			STATION_VARIANCE_WINDOW_MINUTES: getEnvAsInt("STATION_VARIANCE_WINDOW_MINUTES", 15),
+			OEE_STOP_MINUTES:                getEnvAsInt("OEE_STOP_MINUTES", 5),
+			MAINTENANCE_WINDOWS:             getEnv("MAINTENANCE_WINDOWS", ""),
+
+			INTEGRITY_CHECK_AT:       getEnv("INTEGRITY_CHECK_AT", "04:30"),
+			INTEGRITY_FULL_CHECK_DAY: getEnv("INTEGRITY_FULL_CHECK_DAY", "sunday"),
+
+			DB_BOOTSTRAP: getEnvAsBool("DB_BOOTSTRAP", false),
+
+			DISABLED_SUBSYSTEMS: getEnv("DISABLED_SUBSYSTEMS", ""),
 		}
+		config.BROADCAST_MESSAGE_DIR = getEnv("BROADCAST_MESSAGE_DIR", config.MESSAGE_DIR)
+		config.BROADCAST_WS_ADDR = getEnv("BROADCAST_WS_ADDR", legacyWSAddr(config.WS_ADD, config.WS_PORT))
+		config.BROADCAST_ADMIN_ADDR = getEnvAllowEmpty("BROADCAST_ADMIN_ADDR", "127.0.0.1:9093")
 
-		log.Printf("Configuration loaded: %+v", config)
+		shown := *config
+		shown.ADMIN_TOKENS = redactSecrets(shown.ADMIN_TOKENS)
+		shown.PUSH_KEYS = redactSecrets(shown.PUSH_KEYS)
+		log.Printf("Configuration loaded: %+v", &shown)
 	})
 
 	return config
 }
 
+// Subsystems are the optional db_clon subsystems DISABLED_SUBSYSTEMS can turn off.
+var Subsystems = []string{"model_runs", "latest_snapshot", "station_variance", "oee", "export", "tiering", "retention", "integrity"}
+
+// SubsystemEnabled reports whether subsystem is not listed in DISABLED_SUBSYSTEMS.
+func (c *Config) SubsystemEnabled(subsystem string) bool {
+	for _, name := range strings.Split(c.DISABLED_SUBSYSTEMS, ",") {
+		if strings.EqualFold(strings.TrimSpace(name), subsystem) {
+			return false
+		}
+	}
+	return true
+}
+
+// redactSecrets masks the secrets of a "label=secret" list, keeping the labels.
+func redactSecrets(spec string) string {
+	parts := strings.Split(spec, ",")
+	for i, part := range parts {
+		if label, _, ok := strings.Cut(part, "="); ok {
+			parts[i] = label + "=***"
+		} else if strings.TrimSpace(part) != "" {
+			parts[i] = "***"
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
 // getEnv gets an environment variable or returns a default value
 func getEnv(key, defaultValue string) string {
 	value := os.Getenv(key)
@@ -60,6 +388,15 @@ func getEnv(key, defaultValue string) string {
 	return value
 }
 
+// getEnvAllowEmpty is getEnv for settings disabled by an empty value: the default applies
+// only when key is not set at all.
+func getEnvAllowEmpty(key, defaultValue string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return defaultValue
+}
+
 // getEnvAsInt gets an environment variable as int or returns a default value
 func getEnvAsInt(key string, defaultValue int) int {
 	value := os.Getenv(key)
@@ -71,3 +408,27 @@ func getEnvAsInt(key string, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+// getEnvAsBool gets an environment variable as bool or returns a default value
+func getEnvAsBool(key string, defaultValue bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	if b, err := strconv.ParseBool(value); err == nil {
+		return b
+	}
+	return defaultValue
+}
+
+// getEnvAsFloat gets an environment variable as float64 or returns a default value
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	if f, err := strconv.ParseFloat(value, 64); err == nil {
+		return f
+	}
+	return defaultValue
+}
@@ -0,0 +1,269 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"hex_toolset/pkg/sfc_api"
+)
+
+// Setting documents one validated configuration variable for `hex config check`.
+type Setting struct {
+	Env     string `json:"env"`
+	Default string `json:"default"`
+	Doc     string `json:"doc"`
+
+	value    func(c *Config) string
+	validate func(c *Config) error
+}
+
+// SettingStatus is the effective value of a Setting and its validation error, if any.
+type SettingStatus struct {
+	Setting
+	Value string `json:"value"`
+	Error string `json:"error,omitempty"`
+}
+
+// Settings lists the validated settings, in the order `hex config check` prints them.
+var Settings = []Setting{
+	{
+		Env:     "DB_DRIVER",
+		Default: "sqlite",
+		Doc:     "database engine: sqlite (the SFC_CLON file) or postgres (the DB_DSN server)",
+		value:   func(c *Config) string { return c.DB_DRIVER },
+		validate: func(c *Config) error {
+			switch c.DB_DRIVER {
+			case "", "sqlite", "postgres":
+				return nil
+			}
+			return fmt.Errorf("unknown driver %q (want sqlite or postgres)", c.DB_DRIVER)
+		},
+	},
+	{
+		Env:      "MESSAGE_DIR",
+		Default:  "broadcast_messages",
+		Doc:      "directory db_clon writes broadcast message files to",
+		value:    func(c *Config) string { return c.MESSAGE_DIR },
+		validate: func(c *Config) error { return checkDir(c.MESSAGE_DIR) },
+	},
+	{
+		Env:      "BROADCAST_MESSAGE_DIR",
+		Default:  "MESSAGE_DIR",
+		Doc:      "directory the broadcast service watches for message files and keeps their history in",
+		value:    func(c *Config) string { return c.BROADCAST_MESSAGE_DIR },
+		validate: func(c *Config) error { return checkDir(c.BROADCAST_MESSAGE_DIR) },
+	},
+	{
+		Env:      "WS_ADD",
+		Default:  "localhost",
+		Doc:      "host of the broadcast websocket server, used only when BROADCAST_WS_ADDR is unset",
+		value:    func(c *Config) string { return c.WS_ADD },
+		validate: func(c *Config) error { return nil },
+	},
+	{
+		Env:     "WS_PORT",
+		Default: "8081",
+		Doc:     "port of the broadcast websocket server, used only when BROADCAST_WS_ADDR is unset",
+		value:   func(c *Config) string { return c.WS_PORT },
+		validate: func(c *Config) error {
+			if c.BROADCAST_WS_ADDR != legacyWSAddr(c.WS_ADD, c.WS_PORT) {
+				return nil // overridden
+			}
+			return checkPort(c.WS_PORT)
+		},
+	},
+	{
+		Env:      "BROADCAST_WS_ADDR",
+		Default:  "WS_ADD:WS_PORT",
+		Doc:      "host:port the broadcast websocket server listens on (\":port\" for all interfaces)",
+		value:    func(c *Config) string { return c.BROADCAST_WS_ADDR },
+		validate: func(c *Config) error { return checkAddr(c.BROADCAST_WS_ADDR) },
+	},
+	{
+		Env:     "BROADCAST_ADMIN_ADDR",
+		Default: "127.0.0.1:9093",
+		Doc:     "host:port of the broadcast service's admin endpoint (log levels, metrics); empty disables it",
+		value:   func(c *Config) string { return c.BROADCAST_ADMIN_ADDR },
+		validate: func(c *Config) error {
+			if c.BROADCAST_ADMIN_ADDR == "" {
+				return nil
+			}
+			return checkAddr(c.BROADCAST_ADMIN_ADDR)
+		},
+	},
+	{
+		Env:      "MQTT_URL",
+		Default:  "",
+		Doc:      "MQTT broker (tcp://, ssl://, ws://, wss://) db_clon also publishes every broadcast to, under MQTT_TOPIC_PREFIX; empty disables it",
+		value:    func(c *Config) string { return c.MQTT_URL },
+		validate: func(c *Config) error { return checkURLScheme(c.MQTT_URL, "tcp", "ssl", "ws", "wss") },
+	},
+	{
+		Env:      "BACKPLANE_URL",
+		Default:  "",
+		Doc:      "Redis (redis://, rediss://) or NATS (nats://, tls://) URL of the backplane shared by broadcast instances; empty runs standalone",
+		value:    func(c *Config) string { return c.BACKPLANE_URL },
+		validate: func(c *Config) error { return checkURLScheme(c.BACKPLANE_URL, "redis", "rediss", "nats", "tls") },
+	},
+	{
+		Env:      "SFC_API_BACKUP",
+		Default:  "",
+		Doc:      "disaster recovery SFC API db_clon fails over to while the primary's circuit is open; empty disables failover",
+		value:    func(c *Config) string { return c.SFC_API_BACKUP },
+		validate: func(c *Config) error { return checkURLScheme(c.SFC_API_BACKUP, "http", "https") },
+	},
+	{
+		Env:      "SFC_API_BREAKER_FAILURES",
+		Default:  strconv.Itoa(sfc_api.DefaultBreakerFailures),
+		Doc:      "consecutive failed SFC API requests that open the primary's circuit; 0 keeps the default",
+		value:    func(c *Config) string { return strconv.Itoa(c.SFC_API_BREAKER_FAILURES) },
+		validate: func(c *Config) error { return checkMin(c.SFC_API_BREAKER_FAILURES, 0) },
+	},
+	{
+		Env:      "SFC_API_BREAKER_COOLDOWN_SECONDS",
+		Default:  strconv.Itoa(int(sfc_api.DefaultBreakerCooldown / time.Second)),
+		Doc:      "seconds on the backup SFC API before the primary is probed again; 0 keeps the default",
+		value:    func(c *Config) string { return strconv.Itoa(c.SFC_API_BREAKER_COOLDOWN_SECONDS) },
+		validate: func(c *Config) error { return checkMin(c.SFC_API_BREAKER_COOLDOWN_SECONDS, 0) },
+	},
+	{
+		Env:      "SFC_MINUTE_CONCURRENCY",
+		Default:  strconv.Itoa(sfc_api.DefaultMinuteConcurrency),
+		Doc:      "parallel minute requests of an hour refetched by minute; 0 keeps the default",
+		value:    func(c *Config) string { return strconv.Itoa(c.SFC_MINUTE_CONCURRENCY) },
+		validate: func(c *Config) error { return checkMin(c.SFC_MINUTE_CONCURRENCY, 0) },
+	},
+	{
+		Env:      "SFC_HOUR_MAX_BYTES",
+		Default:  strconv.Itoa(sfc_api.DefaultMaxHourBytes),
+		Doc:      "hour response size above which the hour is refetched by minute; 0 disables the limit",
+		value:    func(c *Config) string { return strconv.Itoa(c.SFC_HOUR_MAX_BYTES) },
+		validate: func(c *Config) error { return checkMin(c.SFC_HOUR_MAX_BYTES, 0) },
+	},
+	{
+		Env:     "RETENTION_DAYS",
+		Default: "0",
+		Doc:     "days of records db_clon keeps, deleting older ones daily at RETENTION_AT without archiving them; 0 keeps every record",
+		value:   func(c *Config) string { return strconv.Itoa(c.RETENTION_DAYS) },
+		validate: func(c *Config) error {
+			switch {
+			case c.RETENTION_DAYS < 0:
+				return errors.New("must not be negative")
+			case c.RETENTION_DAYS > 0 && c.TIER_RAW_DAYS > 0 && c.RETENTION_DAYS <= c.TIER_RAW_DAYS:
+				return fmt.Errorf("must exceed TIER_RAW_DAYS (%d), or records are deleted before tiering archives them", c.TIER_RAW_DAYS)
+			}
+			return nil
+		},
+	},
+	{
+		Env:      "DISABLED_SUBSYSTEMS",
+		Default:  "",
+		Doc:      "optional db_clon subsystems to leave out, comma separated: " + strings.Join(Subsystems, ", "),
+		value:    func(c *Config) string { return c.DISABLED_SUBSYSTEMS },
+		validate: func(c *Config) error { return checkSubsystems(c.DISABLED_SUBSYSTEMS) },
+	},
+}
+
+// Check validates c against Settings and returns the status of each.
+func (c *Config) Check() []SettingStatus {
+	out := make([]SettingStatus, 0, len(Settings))
+	for _, s := range Settings {
+		st := SettingStatus{Setting: s, Value: s.value(c)}
+		if err := s.validate(c); err != nil {
+			st.Error = err.Error()
+		}
+		out = append(out, st)
+	}
+	return out
+}
+
+// Validate returns the errors of Check joined, or nil when every setting is valid.
+func (c *Config) Validate() error {
+	var errs []error
+	for _, st := range c.Check() {
+		if st.Error != "" {
+			errs = append(errs, fmt.Errorf("%s=%q: %s", st.Env, st.Value, st.Error))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// legacyWSAddr derives the listen address from WS_ADD and WS_PORT the way the broadcast
+// service did before BROADCAST_WS_ADDR: no host listens on every interface, a host with a
+// port is used as is.
+func legacyWSAddr(host, port string) string {
+	host = strings.TrimSpace(host)
+	switch {
+	case host == "":
+		return ":" + port
+	case strings.Contains(host, ":"):
+		return host
+	default:
+		return host + ":" + port
+	}
+}
+
+func checkDir(dir string) error {
+	if strings.TrimSpace(dir) == "" {
+		return errors.New("must not be empty")
+	}
+	if fi, err := os.Stat(dir); err == nil && !fi.IsDir() {
+		return errors.New("not a directory")
+	}
+	return nil // a missing directory is created on start
+}
+
+func checkAddr(addr string) error {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid address: %w", err)
+	}
+	return checkPort(port)
+}
+
+func checkPort(port string) error {
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 0 || n > 65535 {
+		return fmt.Errorf("invalid port %q", port)
+	}
+	return nil
+}
+
+func checkMin(n, min int) error {
+	if n < min {
+		return fmt.Errorf("must be at least %d", min)
+	}
+	return nil
+}
+
+// checkURLScheme accepts an empty raw or a URL with one of schemes.
+func checkURLScheme(raw string, schemes ...string) error {
+	if strings.TrimSpace(raw) == "" {
+		return nil
+	}
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return fmt.Errorf("invalid url: %w", err)
+	}
+	if !slices.Contains(schemes, strings.ToLower(u.Scheme)) {
+		return fmt.Errorf("unsupported scheme %q (want %s)", u.Scheme, strings.Join(schemes, ", "))
+	}
+	return nil
+}
+
+func checkSubsystems(list string) error {
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name != "" && !slices.ContainsFunc(Subsystems, func(s string) bool { return strings.EqualFold(s, name) }) {
+			return fmt.Errorf("unknown subsystem %q", name)
+		}
+	}
+	return nil
+}
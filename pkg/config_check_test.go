@@ -0,0 +1,71 @@
+package pkg
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigCheck(t *testing.T) {
+	for _, c := range []struct{ host, port, want string }{
+		{"", "8081", ":8081"},
+		{"10.0.0.5", "9091", "10.0.0.5:9091"},
+		{"10.0.0.5:7000", "9091", "10.0.0.5:7000"},
+	} {
+		if got := legacyWSAddr(c.host, c.port); got != c.want {
+			t.Errorf("legacyWSAddr(%q, %q) = %q, want %q", c.host, c.port, got, c.want)
+		}
+	}
+
+	dir := t.TempDir()
+	cfg := &Config{MESSAGE_DIR: dir, BROADCAST_MESSAGE_DIR: dir, WS_ADD: "localhost", WS_PORT: "8081",
+		BROADCAST_WS_ADDR: "localhost:8081"}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("valid config: %v", err)
+	}
+
+	// WS_PORT no longer matters once BROADCAST_WS_ADDR is set; no admin address disables it.
+	cfg.WS_PORT, cfg.BROADCAST_WS_ADDR, cfg.BROADCAST_ADMIN_ADDR = "none", ":9000", ""
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("overridden WS_PORT: %v", err)
+	}
+
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg.BROADCAST_MESSAGE_DIR, cfg.BROADCAST_WS_ADDR, cfg.BROADCAST_ADMIN_ADDR = file, "localhost", "127.0.0.1:http"
+	err := cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), "BROADCAST_MESSAGE_DIR=") || !strings.Contains(err.Error(), "BROADCAST_WS_ADDR=") {
+		t.Fatalf("invalid config: %v", err)
+	}
+	for _, st := range cfg.Check() {
+		if (st.Error != "") != strings.HasPrefix(st.Env, "BROADCAST_") {
+			t.Errorf("%s: error %q", st.Env, st.Error)
+		}
+	}
+
+	cfg = &Config{MESSAGE_DIR: dir, BROADCAST_MESSAGE_DIR: dir, BROADCAST_WS_ADDR: ":8081", SFC_API_BACKUP: "ftp://dr",
+		SFC_MINUTE_CONCURRENCY: -1, SFC_HOUR_MAX_BYTES: -1}
+	for _, st := range cfg.Check() {
+		if (st.Error != "") != (st.Env == "SFC_API_BACKUP" || st.Env == "SFC_MINUTE_CONCURRENCY" || st.Env == "SFC_HOUR_MAX_BYTES") {
+			t.Errorf("%s=%s: error %q", st.Env, st.Value, st.Error)
+		}
+	}
+
+	for raw, ok := range map[string]bool{"": true, "redis://redis:6379/0": true, "nats://nats:4222": true,
+		"amqp://rabbit": false, "redis:// bad": false} {
+		if err := checkURLScheme(raw, "redis", "nats"); (err == nil) != ok {
+			t.Errorf("checkURLScheme(%q) = %v", raw, err)
+		}
+	}
+
+	cfg = &Config{DISABLED_SUBSYSTEMS: " OEE, station_variance"}
+	if cfg.SubsystemEnabled("oee") || cfg.SubsystemEnabled("station_variance") || !cfg.SubsystemEnabled("model_runs") {
+		t.Errorf("subsystems enabled with DISABLED_SUBSYSTEMS=%q", cfg.DISABLED_SUBSYSTEMS)
+	}
+	if err := checkSubsystems(cfg.DISABLED_SUBSYSTEMS + ",oe"); err == nil || !strings.Contains(err.Error(), `"oe"`) {
+		t.Errorf("unknown subsystem: %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// backupPartSuffix names the copy while Backup writes and checks it.
+const backupPartSuffix = ".partial"
+
+// BackupResult is the outcome of Backup.
+type BackupResult struct {
+	Path            string  `json:"path"`
+	Bytes           int64   `json:"bytes"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	// Check is the integrity check the copy passed ("integrity_check").
+	Check string `json:"check"`
+}
+
+// Backup writes a copy of the SQLite database to destPath while the service keeps using it.
+// The copy is a VACUUM INTO on a connection of its own: in WAL mode it reads a snapshot
+// without blocking the writer, so the loader carries on and the copy holds the database as
+// of the moment it started. The copy is then checked with integrity_check and compared
+// with the schema of the database, and only renamed to destPath once it passed; on failure
+// nothing is left at destPath. destPath must not exist. PostgreSQL databases are backed up
+// with pg_dump instead.
+func (h *DBConnection) Backup(ctx context.Context, destPath string) (res BackupResult, err error) {
+	if h.database == nil {
+		return res, errors.New("database not initialized")
+	}
+	if h.driver == DriverPostgres {
+		return res, errors.New("backup is of SQLite databases; back up PostgreSQL with pg_dump")
+	}
+	dest, err := filepath.Abs(destPath)
+	if err != nil {
+		return res, fmt.Errorf("resolve backup path: %w", err)
+	}
+	if dest == h.dbPath {
+		return res, fmt.Errorf("backup path is the database itself: %s", dest)
+	}
+	if _, err := os.Stat(dest); err == nil {
+		return res, fmt.Errorf("backup path already exists: %s", dest)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return res, fmt.Errorf("failed to stat backup path: %w", err)
+	}
+	tmp := dest + backupPartSuffix
+	if err := os.Remove(tmp); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return res, fmt.Errorf("failed to remove leftover %s: %w", tmp, err)
+	}
+	res.Path, res.Check = dest, "integrity_check"
+	start := time.Now()
+	defer func() { res.DurationSeconds = time.Since(start).Seconds() }()
+
+	// a connection of its own, so the pool's (a single one on SQLite) stays free for the loader
+	src := sql.OpenDB(newConnector(h.dbPath, []string{"PRAGMA busy_timeout=30000"}))
+	defer src.Close()
+	src.SetMaxOpenConns(1)
+	if _, err := src.ExecContext(ctx, "VACUUM INTO ?", tmp); err != nil {
+		_ = os.Remove(tmp)
+		return res, fmt.Errorf("failed to vacuum into %s: %w", tmp, err)
+	}
+
+	copyDB := sql.OpenDB(newConnector(tmp, nil))
+	copyDB.SetMaxOpenConns(1)
+	err = checkCopy(ctx, src.QueryContext, copyDB, res.Check, "backup")
+	if cerr := copyDB.Close(); err == nil && cerr != nil {
+		err = fmt.Errorf("failed to close the backup: %w", cerr)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return res, err
+	}
+	if err := os.Rename(tmp, dest); err != nil {
+		_ = os.Remove(tmp)
+		return res, fmt.Errorf("failed to move the backup to %s: %w", dest, err)
+	}
+	info, err := os.Stat(dest)
+	if err != nil {
+		return res, fmt.Errorf("failed to stat backup: %w", err)
+	}
+	res.Bytes = info.Size()
+	return res, nil
+}
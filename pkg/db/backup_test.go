@@ -0,0 +1,57 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBackup(t *testing.T) {
+	database, path := openBloated(t)
+	ctx := context.Background()
+	conn := &DBConnection{database: database, dbPath: path, driver: DriverSQLite}
+
+	// a write in progress on the pool's connection does not hold the backup up, and is not
+	// in it
+	tx, err := database.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec(`INSERT INTO t VALUES ('uncommitted')`); err != nil {
+		t.Fatal(err)
+	}
+	dest := filepath.Join(t.TempDir(), "backup.db")
+	res, err := conn.Backup(ctx, dest)
+	if err != nil {
+		t.Fatalf("Backup: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if res.Path != dest || res.Bytes <= 0 || res.DurationSeconds <= 0 || res.Check != "integrity_check" {
+		t.Errorf("result = %+v", res)
+	}
+	if _, err := os.Stat(dest + backupPartSuffix); !os.IsNotExist(err) {
+		t.Errorf("partial backup left behind: %v", err)
+	}
+
+	copyDB, err := sql.Open("sqlite", dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer copyDB.Close()
+	var n int
+	if err := copyDB.QueryRow(`SELECT count(*) FROM t`).Scan(&n); err != nil || n != 100 {
+		t.Errorf("rows in the backup = %d, %v; want the 100 committed", n, err)
+	}
+
+	if _, err := conn.Backup(ctx, dest); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("backup over an existing file: %v", err)
+	}
+	if _, err := conn.Backup(ctx, path); err == nil {
+		t.Error("backup over the database itself succeeded")
+	}
+}
@@ -0,0 +1,290 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultCompactRate is the VACUUM INTO throughput, in bytes per second, EstimateCompact
+// assumes without a measured one; a finished Compact reports the rate it reached.
+const DefaultCompactRate = 64 << 20
+
+// compactSuffix names the new file next to the database while it is written, and
+// backupSuffix the replaced one with CompactOptions.KeepBackup.
+const (
+	compactSuffix = ".compact"
+	backupSuffix  = ".pre-compact"
+)
+
+// CompactEstimate is what compacting the database would take.
+type CompactEstimate struct {
+	Path      string `json:"path"`
+	SizeBytes int64  `json:"size_bytes"` // database file plus WAL
+	FreeBytes int64  `json:"free_bytes"` // free pages, returned to the file system
+	// ExpectedBytes is the size after compaction, also the free disk space it needs next
+	// to the database.
+	ExpectedBytes int64 `json:"expected_bytes"`
+	// DowntimeSeconds is how long ingestion is paused: copying the used pages and checking
+	// the copy, at RateBytesPerSecond.
+	DowntimeSeconds    float64 `json:"downtime_seconds"`
+	RateBytesPerSecond int64   `json:"rate_bytes_per_second"`
+}
+
+// CompactResult is the outcome of Compact.
+type CompactResult struct {
+	Estimate    CompactEstimate `json:"estimate"`
+	BeforeBytes int64           `json:"before_bytes"`
+	AfterBytes  int64           `json:"after_bytes"`
+	// DowntimeSeconds is how long the database connection was held, pausing ingestion;
+	// RateBytesPerSecond the copy throughput reached, for the next estimate.
+	DowntimeSeconds    float64 `json:"downtime_seconds"`
+	RateBytesPerSecond int64   `json:"rate_bytes_per_second"`
+	Backup             string  `json:"backup,omitempty"` // the replaced file, with KeepBackup
+}
+
+// CompactOptions tune Compact.
+type CompactOptions struct {
+	// Rate is the assumed copy throughput in bytes per second; 0 uses DefaultCompactRate.
+	Rate int64
+	// KeepBackup keeps the replaced file as <path>.pre-compact instead of deleting it; it
+	// needs the disk space of both.
+	KeepBackup bool
+	// Progress, when set, is called at each step ("copying", "verifying", "swapping").
+	Progress func(step string)
+}
+
+// EstimateCompact measures the database at path, open as database, and estimates the
+// downtime of Compact from the size of its used pages and rate (0: DefaultCompactRate).
+func EstimateCompact(ctx context.Context, database *sql.DB, path string, rate int64) (CompactEstimate, error) {
+	if _, ok := database.Driver().(postgresDriver); ok {
+		return CompactEstimate{Path: path}, errors.New("compaction is of SQLite databases; PostgreSQL reclaims space with its autovacuum")
+	}
+	if rate <= 0 {
+		rate = DefaultCompactRate
+	}
+	est := CompactEstimate{Path: path, RateBytesPerSecond: rate}
+	var pageSize, pageCount, freePages int64
+	for pragma, dst := range map[string]*int64{"page_size": &pageSize, "page_count": &pageCount, "freelist_count": &freePages} {
+		if err := database.QueryRowContext(ctx, "PRAGMA "+pragma).Scan(dst); err != nil {
+			return est, fmt.Errorf("failed to read %s: %w", pragma, err)
+		}
+	}
+	size, err := fileSizes(path)
+	if err != nil {
+		return est, err
+	}
+	est.SizeBytes = size
+	est.FreeBytes = freePages * pageSize
+	est.ExpectedBytes = (pageCount - freePages) * pageSize
+	// the copy writes the used pages once and quick_check reads them back
+	est.DowntimeSeconds = float64(est.ExpectedBytes) * 1.5 / float64(rate)
+	return est, nil
+}
+
+// Compact rewrites the database at path, open as database, without its free pages: VACUUM
+// INTO a new file, a quick_check and schema comparison of it, then an atomic rename over
+// the old file. The pool's only connection is held throughout, so every other use of the
+// database in this process waits; that is the ingestion pause the estimate announces, and
+// the minutes it misses are left to the repair loop. Other processes must not write to the
+// database meanwhile: leaving WAL mode fails while one has it open, and a commit of theirs
+// during the copy aborts the swap. On any failure the database is left as it was.
+func Compact(ctx context.Context, database *sql.DB, path string, opts CompactOptions) (res CompactResult, err error) {
+	progress := opts.Progress
+	if progress == nil {
+		progress = func(string) {}
+	}
+	if n := database.Stats().MaxOpenConnections; n != 1 {
+		return res, fmt.Errorf("compaction needs a pool of one connection, have %d", n)
+	}
+	est, err := EstimateCompact(ctx, database, path, opts.Rate)
+	if err != nil {
+		return res, err
+	}
+	res.Estimate, res.BeforeBytes = est, est.SizeBytes
+
+	tmp := path + compactSuffix
+	if err := os.Remove(tmp); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return res, fmt.Errorf("failed to remove leftover %s: %w", tmp, err)
+	}
+	conn, err := database.Conn(ctx)
+	if err != nil {
+		return res, fmt.Errorf("failed to take the database connection: %w", err)
+	}
+	start := time.Now()
+	defer func() {
+		_ = conn.Close()
+		res.DowntimeSeconds = time.Since(start).Seconds()
+	}()
+	var guarded *guardedConn
+	_ = conn.Raw(func(dc any) error {
+		guarded, _ = dc.(*guardedConn)
+		return nil
+	})
+	if guarded == nil {
+		return res, fmt.Errorf("compaction needs a database opened by this package")
+	}
+
+	var mode string
+	var version int64
+	if err := conn.QueryRowContext(ctx, "PRAGMA journal_mode").Scan(&mode); err != nil {
+		return res, fmt.Errorf("failed to read journal_mode: %w", err)
+	}
+	wal := strings.EqualFold(mode, "wal")
+	if err := conn.QueryRowContext(ctx, "PRAGMA data_version").Scan(&version); err != nil {
+		return res, fmt.Errorf("failed to read data_version: %w", err)
+	}
+
+	progress("copying")
+	copyStart := time.Now()
+	if _, err := conn.ExecContext(ctx, "VACUUM INTO ?", tmp); err != nil {
+		_ = os.Remove(tmp)
+		return res, fmt.Errorf("failed to vacuum into %s: %w", tmp, err)
+	}
+	if secs := time.Since(copyStart).Seconds(); secs > 0 {
+		res.RateBytesPerSecond = int64(float64(est.ExpectedBytes) / secs)
+	}
+
+	progress("verifying")
+	if err := verifyCompacted(ctx, conn, tmp, wal); err != nil {
+		_ = os.Remove(tmp)
+		return res, err
+	}
+
+	progress("swapping")
+	if err := swapCompacted(ctx, conn, path, tmp, version, wal, opts.KeepBackup); err != nil {
+		_ = os.Remove(tmp)
+		return res, err
+	}
+	// the held connection still reads the replaced file; the pool opens the new one
+	guarded.retire()
+	if opts.KeepBackup {
+		res.Backup = path + backupSuffix
+	}
+	if res.AfterBytes, err = fileSizes(path); err != nil {
+		return res, err
+	}
+	return res, nil
+}
+
+// verifyCompacted checks the copy at tmp: quick_check, the same schema as the database of
+// conn, and WAL mode when the database uses it.
+func verifyCompacted(ctx context.Context, conn *sql.Conn, tmp string, wal bool) error {
+	copyDB := sql.OpenDB(newConnector(tmp, nil))
+	defer copyDB.Close()
+	copyDB.SetMaxOpenConns(1)
+
+	if err := checkCopy(ctx, conn.QueryContext, copyDB, "quick_check", "compacted copy"); err != nil {
+		return err
+	}
+	if wal {
+		if _, err := copyDB.ExecContext(ctx, "PRAGMA journal_mode=WAL"); err != nil {
+			return fmt.Errorf("failed to set WAL mode on the compacted copy: %w", err)
+		}
+	}
+	return nil
+}
+
+// checkCopy runs the integrity check pragma (quick_check or integrity_check) on copyDB and
+// compares its schema with the one query reads from the original; what names the copy in
+// the errors.
+func checkCopy(ctx context.Context, query func(context.Context, string, ...any) (*sql.Rows, error), copyDB *sql.DB, pragma, what string) error {
+	problems, err := queryStrings(ctx, copyDB.QueryContext, "PRAGMA "+pragma)
+	if err != nil {
+		return fmt.Errorf("failed to check the %s: %w", what, err)
+	}
+	if len(problems) != 1 || problems[0] != "ok" {
+		return fmt.Errorf("%s failed %s: %s", what, pragma, strings.Join(problems, "; "))
+	}
+
+	const schema = `SELECT type || ' ' || name || ' ' || coalesce(sql, '') FROM sqlite_master ORDER BY type, name`
+	want, err := queryStrings(ctx, query, schema)
+	if err != nil {
+		return fmt.Errorf("failed to read the schema: %w", err)
+	}
+	got, err := queryStrings(ctx, copyDB.QueryContext, schema)
+	if err != nil {
+		return fmt.Errorf("failed to read the schema of the %s: %w", what, err)
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		return fmt.Errorf("%s has %d schema objects, the database %d, or they differ", what, len(got), len(want))
+	}
+	return nil
+}
+
+// swapCompacted renames tmp over path. In WAL mode the database first leaves it, which
+// checkpoints and deletes the WAL, so nothing of the old file's WAL is applied to the new
+// one; that fails while another process has the database open.
+func swapCompacted(ctx context.Context, conn *sql.Conn, path, tmp string, version int64, wal, keepBackup bool) error {
+	var now int64
+	if err := conn.QueryRowContext(ctx, "PRAGMA data_version").Scan(&now); err != nil {
+		return fmt.Errorf("failed to read data_version: %w", err)
+	}
+	if now != version {
+		return fmt.Errorf("database changed by another process during compaction; nothing replaced")
+	}
+	if wal {
+		var mode string
+		if err := conn.QueryRowContext(ctx, "PRAGMA journal_mode=DELETE").Scan(&mode); err != nil || !strings.EqualFold(mode, "delete") {
+			return fmt.Errorf("failed to leave WAL mode (is another process using the database?): mode %q, %v", mode, err)
+		}
+	}
+	restore := func(err error) error {
+		if wal {
+			if _, werr := conn.ExecContext(ctx, "PRAGMA journal_mode=WAL"); werr != nil {
+				err = errors.Join(err, fmt.Errorf("failed to restore WAL mode: %w", werr))
+			}
+		}
+		return err
+	}
+	if keepBackup {
+		backup := path + backupSuffix
+		if err := os.Remove(backup); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return restore(fmt.Errorf("failed to remove old backup %s: %w", backup, err))
+		}
+		if err := os.Link(path, backup); err != nil {
+			return restore(fmt.Errorf("failed to keep %s: %w", backup, err))
+		}
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return restore(fmt.Errorf("failed to replace %s: %w", path, err))
+	}
+	// left by the copy's WAL mode switch, if at all
+	_ = os.Remove(tmp + "-wal")
+	_ = os.Remove(tmp + "-shm")
+	return nil
+}
+
+func queryStrings(ctx context.Context, query func(context.Context, string, ...any) (*sql.Rows, error), q string) ([]string, error) {
+	rows, err := query(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// fileSizes returns the size of the database file at path plus its WAL, if any.
+func fileSizes(path string) (int64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat database: %w", err)
+	}
+	size := info.Size()
+	if wal, err := os.Stat(path + "-wal"); err == nil {
+		size += wal.Size()
+	}
+	return size, nil
+}
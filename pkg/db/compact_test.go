@@ -0,0 +1,112 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// openBloated opens a WAL database with 20000 rows inserted and most deleted again.
+func openBloated(t *testing.T) (*sql.DB, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "bloated.db")
+	db := sql.OpenDB(newConnector(path, nil))
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+	for _, q := range []string{
+		`PRAGMA journal_mode=WAL`,
+		`CREATE TABLE t (v TEXT)`,
+		`CREATE INDEX idx_t_v ON t (v)`,
+		`WITH RECURSIVE c(n) AS (SELECT 1 UNION ALL SELECT n+1 FROM c WHERE n < 20000)
+			INSERT INTO t SELECT printf('%0200d', n) FROM c`,
+		`DELETE FROM t WHERE rowid > 100`,
+	} {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db, path
+}
+
+func TestCompact(t *testing.T) {
+	db, path := openBloated(t)
+	ctx := context.Background()
+
+	est, err := EstimateCompact(ctx, db, path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if est.FreeBytes <= est.ExpectedBytes || est.RateBytesPerSecond != DefaultCompactRate || est.DowntimeSeconds <= 0 {
+		t.Fatalf("estimate = %+v", est)
+	}
+
+	var steps []string
+	res, err := Compact(ctx, db, path, CompactOptions{KeepBackup: true, Progress: func(s string) { steps = append(steps, s) }})
+	if err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	if strings.Join(steps, ",") != "copying,verifying,swapping" {
+		t.Errorf("steps = %v", steps)
+	}
+	if res.AfterBytes >= res.BeforeBytes/4 || res.Backup != path+".pre-compact" || res.DowntimeSeconds <= 0 {
+		t.Errorf("result = %+v", res)
+	}
+
+	// The pool reopened on the compacted file, in WAL mode, with the rows kept.
+	var n, free int
+	var mode string
+	if err := db.QueryRow(`SELECT count(*) FROM t`).Scan(&n); err != nil || n != 100 {
+		t.Fatalf("rows after compaction = %d, %v", n, err)
+	}
+	if err := db.QueryRow(`PRAGMA freelist_count`).Scan(&free); err != nil || free != 0 {
+		t.Errorf("freelist_count = %d, %v", free, err)
+	}
+	if err := db.QueryRow(`PRAGMA journal_mode`).Scan(&mode); err != nil || mode != "wal" {
+		t.Errorf("journal_mode = %q, %v", mode, err)
+	}
+	if _, err := db.Exec(`INSERT INTO t VALUES ('after')`); err != nil {
+		t.Fatalf("insert after compaction: %v", err)
+	}
+	if _, err := os.Stat(path + ".compact"); !os.IsNotExist(err) {
+		t.Errorf("compacted copy left behind: %v", err)
+	}
+	if _, err := os.Stat(res.Backup); err != nil {
+		t.Errorf("backup: %v", err)
+	}
+}
+
+func TestCompactRefusesWhileAnotherConnectionIsOpen(t *testing.T) {
+	db, path := openBloated(t)
+	other, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	if err := other.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Exec(`SELECT count(*) FROM t`); err != nil {
+		t.Fatal(err)
+	}
+	before, _ := os.Stat(path)
+
+	if _, err := Compact(context.Background(), db, path, CompactOptions{}); err == nil ||
+		!strings.Contains(err.Error(), "another process") {
+		t.Fatalf("Compact with another connection open = %v", err)
+	}
+	after, _ := os.Stat(path)
+	if !os.SameFile(before, after) {
+		t.Errorf("database file replaced despite the failure")
+	}
+	var n int
+	if err := db.QueryRow(`SELECT count(*) FROM t`).Scan(&n); err != nil || n != 100 {
+		t.Fatalf("rows after failed compaction = %d, %v", n, err)
+	}
+	if _, err := os.Stat(path + ".compact"); !os.IsNotExist(err) {
+		t.Errorf("compacted copy left behind: %v", err)
+	}
+}
@@ -0,0 +1,221 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+
+	"hex_toolset/pkg/metrics"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// connDiscards counts connections the guard took out of the pool.
+var connDiscards = metrics.NewCounter("db_connections_discarded_total",
+	"SQLite connections discarded because a canceled or interrupted statement left them unusable; the pool reopens one.", nil)
+
+func init() { metrics.Default.Register(connDiscards) }
+
+// ConnDiscards returns how many poisoned connections were discarded since start.
+func ConnDiscards() uint64 { return connDiscards.Value() }
+
+// sqliteConn is what the guard needs from a modernc.org/sqlite connection.
+type sqliteConn interface {
+	driver.Conn
+	driver.ConnBeginTx
+	driver.ConnPrepareContext
+	driver.ExecerContext
+	driver.QueryerContext
+	driver.Pinger
+	driver.SessionResetter
+	driver.Validator
+}
+
+// connector opens the pool's connections and applies the per-connection pragmas to each,
+// so a connection reopened after a discard has the same busy_timeout, synchronous, etc. as
+// the first one.
+type connector struct {
+	dsn     string
+	pragmas []string
+	drv     *sqlite.Driver
+}
+
+func newConnector(dsn string, pragmas []string) *connector {
+	return &connector{dsn: dsn, pragmas: pragmas, drv: &sqlite.Driver{}}
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	dc, err := c.drv.Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	sc, ok := dc.(sqliteConn)
+	if !ok {
+		_ = dc.Close()
+		return nil, fmt.Errorf("unexpected sqlite connection type %T", dc)
+	}
+	for _, p := range c.pragmas {
+		if _, err := sc.ExecContext(ctx, p, nil); err != nil {
+			_ = sc.Close()
+			return nil, fmt.Errorf("apply pragma %q: %w", p, err)
+		}
+	}
+	return &guardedConn{sqliteConn: sc}, nil
+}
+
+func (c *connector) Driver() driver.Driver { return c.drv }
+
+// guardedConn works around a modernc.org/sqlite behavior with the single pooled connection:
+// a statement interrupted by its context being canceled can leave the connection unusable
+// (the interrupt still pending, or a transaction that failed to roll back), and every later
+// statement fails on it until restart. guardedConn remembers such a failure and reports
+// the connection bad to database/sql, which closes it and opens a fresh one; a transaction
+// that fails to begin on a poisoned connection is retried by database/sql on the new one.
+type guardedConn struct {
+	sqliteConn
+	poisoned atomic.Pointer[string] // why the connection is unusable, nil while it is fine
+	retired  atomic.Bool            // the file it has open was replaced (Compact); not counted
+}
+
+// retire makes the pool close the connection once it is returned, without counting it as a
+// discard: it still reads the file Compact replaced.
+func (c *guardedConn) retire() { c.retired.Store(true) }
+
+// isPoisoning reports whether err may leave the connection unusable.
+func isPoisoning(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var se *sqlite.Error
+	if errors.As(err, &se) && se.Code()&0xff == sqlite3.SQLITE_INTERRUPT {
+		return true
+	}
+	return strings.Contains(err.Error(), "cannot start a transaction within a transaction")
+}
+
+// check marks the connection poisoned when err is a poisoning error.
+func (c *guardedConn) check(err error) {
+	if isPoisoning(err) {
+		reason := err.Error()
+		c.poisoned.CompareAndSwap(nil, &reason)
+	}
+}
+
+// discard reports whether the connection must be discarded, counting the discard.
+func (c *guardedConn) discard(usable bool) bool {
+	reason := c.poisoned.Load()
+	if reason == nil && usable {
+		return false
+	}
+	why := "interrupt still pending"
+	if reason != nil {
+		why = *reason
+	}
+	connDiscards.Inc()
+	log.Printf("Warning: discarding database connection (%s); reopening", why)
+	return true
+}
+
+func (c *guardedConn) ResetSession(ctx context.Context) error {
+	if c.retired.Load() {
+		return driver.ErrBadConn
+	}
+	if c.discard(c.sqliteConn.ResetSession(ctx) == nil) {
+		return driver.ErrBadConn
+	}
+	return nil
+}
+
+func (c *guardedConn) IsValid() bool {
+	if c.retired.Load() {
+		return false
+	}
+	return !c.discard(c.sqliteConn.IsValid())
+}
+
+func (c *guardedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	t, err := c.sqliteConn.BeginTx(ctx, opts)
+	if err != nil {
+		c.check(err)
+		if ctx.Err() == nil && isPoisoning(err) {
+			// Left over from an earlier statement; nothing ran, so database/sql closes the
+			// connection and retries on a new one.
+			c.discard(false)
+			return nil, driver.ErrBadConn
+		}
+		return nil, err
+	}
+	return &guardedTx{Tx: t, c: c}, nil
+}
+
+func (c *guardedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	s, err := c.sqliteConn.PrepareContext(ctx, query)
+	c.check(err)
+	if err != nil {
+		return nil, err
+	}
+	return &guardedStmt{Stmt: s, c: c}, nil
+}
+
+func (c *guardedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	r, err := c.sqliteConn.ExecContext(ctx, query, args)
+	c.check(err)
+	return r, err
+}
+
+func (c *guardedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	r, err := c.sqliteConn.QueryContext(ctx, query, args)
+	c.check(err)
+	return r, err
+}
+
+func (c *guardedConn) Ping(ctx context.Context) error {
+	err := c.sqliteConn.Ping(ctx)
+	c.check(err)
+	return err
+}
+
+// guardedTx watches Commit and Rollback: a rollback failing after an interrupt leaves the
+// transaction open on the connection.
+type guardedTx struct {
+	driver.Tx
+	c *guardedConn
+}
+
+func (t *guardedTx) Commit() error {
+	err := t.Tx.Commit()
+	t.c.check(err)
+	return err
+}
+
+func (t *guardedTx) Rollback() error {
+	err := t.Tx.Rollback()
+	t.c.check(err)
+	return err
+}
+
+// guardedStmt watches the statements prepared in transactions, e.g. the batch inserts.
+type guardedStmt struct {
+	driver.Stmt
+	c *guardedConn
+}
+
+func (s *guardedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	r, err := s.Stmt.(driver.StmtExecContext).ExecContext(ctx, args)
+	s.c.check(err)
+	return r, err
+}
+
+func (s *guardedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	r, err := s.Stmt.(driver.StmtQueryContext).QueryContext(ctx, args)
+	s.c.check(err)
+	return r, err
+}
@@ -0,0 +1,74 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openGuarded(t *testing.T) *sql.DB {
+	t.Helper()
+	db := sql.OpenDB(newConnector(filepath.Join(t.TempDir(), "guard.db"), []string{"PRAGMA busy_timeout=1234"}))
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+	if _, err := db.Exec(`CREATE TABLE t (v INTEGER)`); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestGuardDiscardsCanceledConn(t *testing.T) {
+	db := openGuarded(t)
+	before := ConnDiscards()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := db.ExecContext(ctx, `WITH RECURSIVE c(n) AS (SELECT 1 UNION ALL SELECT n+1 FROM c)
+		INSERT INTO t SELECT n FROM c`)
+	if err == nil {
+		t.Fatal("endless insert finished")
+	}
+
+	if _, err := db.Exec(`INSERT INTO t VALUES (1)`); err != nil {
+		t.Fatalf("insert after the canceled one: %v", err)
+	}
+	if got := ConnDiscards() - before; got != 1 {
+		t.Errorf("discards = %d, want 1", got)
+	}
+	var busy int
+	if err := db.QueryRow(`PRAGMA busy_timeout`).Scan(&busy); err != nil || busy != 1234 {
+		t.Errorf("busy_timeout on the reopened connection = %d (%v), want 1234", busy, err)
+	}
+}
+
+func TestGuardRetriesBeginOnPoisonedConn(t *testing.T) {
+	db := openGuarded(t)
+	before := ConnDiscards()
+
+	// A transaction left open on the pooled connection, as after a failed rollback.
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.ExecContext(context.Background(), `BEGIN`); err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("begin on the poisoned connection was not retried: %v", err)
+	}
+	if _, err := tx.Exec(`INSERT INTO t VALUES (1)`); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if got := ConnDiscards() - before; got != 1 {
+		t.Errorf("discards = %d, want 1", got)
+	}
+}
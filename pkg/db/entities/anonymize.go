@@ -0,0 +1,199 @@
+package entities
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// AnonymizeResult counts what Anonymize replaced in the copy.
+type AnonymizeResult struct {
+	Path       string `json:"path"`
+	Records    int    `json:"records"` // records_table rows, with their IDs recomputed
+	PPIDs      int    `json:"ppids"`   // distinct values replaced
+	WorkOrders int    `json:"work_orders"`
+	Employees  int    `json:"employees"`
+	// AuditDeleted is the audit_log entries dropped: their actors and parameters are free
+	// text.
+	AuditDeleted int64 `json:"audit_deleted"`
+}
+
+// anonKind is one kind of identifier Anonymize replaces, with the values to replace.
+type anonKind struct {
+	kind, prefix string
+	values       string // query of the distinct values
+}
+
+var anonKinds = []anonKind{
+	{"ppid", "P", fmt.Sprintf(`SELECT ppid FROM %s UNION SELECT ppid FROM %s`, tableName, latestGroupTable)},
+	{"work_order", "WO", fmt.Sprintf(`SELECT work_order FROM %s UNION SELECT work_order FROM %s UNION SELECT work_order FROM %s`,
+		tableName, latestGroupTable, workOrderMetaTable)},
+	{"employee", "EMP", fmt.Sprintf(`SELECT DISTINCT employee_name FROM %s WHERE employee_name IS NOT NULL`, tableName)},
+}
+
+// Anonymize writes a copy of db to out with the production identifiers replaced, so a
+// problem database can be shared with the vendor. PPIDs, work orders and employee names
+// become tokens keyed by key ("P…", "WO…", "EMP…"), the same value getting the same token
+// in every table, so joins, counts and pass sequences hold; record IDs are recomputed from
+// the new PPIDs (RecordID). The audit log is emptied. With the same key, two copies get the
+// same tokens; without knowing it, the values cannot be recovered by hashing guessed serial
+// numbers. out must not exist; the copy is vacuumed last so no replaced value is left in
+// its free pages, and removed on failure. db is only read.
+func Anonymize(ctx context.Context, db *sql.DB, out string, key []byte) (AnonymizeResult, error) {
+	res := AnonymizeResult{Path: out}
+	if d := DialectOf(db); d.Name() != DialectSQLite {
+		return res, fmt.Errorf("anonymize copies SQLite databases only, not %s", d.Name())
+	}
+	if _, err := os.Stat(out); err == nil {
+		return res, fmt.Errorf("%s already exists", out)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return res, err
+	}
+	if _, err := db.ExecContext(ctx, `VACUUM INTO ?`, out); err != nil {
+		return res, fmt.Errorf("copy database to %s: %w", out, err)
+	}
+	ok := false
+	defer func() {
+		if !ok {
+			_ = os.Remove(out)
+		}
+	}()
+	cp, err := sql.Open("sqlite", out)
+	if err != nil {
+		return res, fmt.Errorf("open %s: %w", out, err)
+	}
+	defer cp.Close()
+	cp.SetMaxOpenConns(1) // the temp tables live on the connection
+
+	if err := anonymizeTables(ctx, cp, key, &res); err != nil {
+		return res, fmt.Errorf("anonymize %s: %w", out, err)
+	}
+	if _, err := cp.ExecContext(ctx, `VACUUM`); err != nil {
+		return res, fmt.Errorf("vacuum %s: %w", out, err)
+	}
+	ok = true
+	return res, nil
+}
+
+func anonymizeTables(ctx context.Context, db *sql.DB, key []byte, res *AnonymizeResult) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, `CREATE TEMP TABLE anon_map (
+		kind TEXT NOT NULL, value TEXT NOT NULL, token TEXT NOT NULL, PRIMARY KEY (kind, value)) WITHOUT ROWID;
+	CREATE TEMP TABLE anon_ids (old_id TEXT PRIMARY KEY, new_id TEXT NOT NULL) WITHOUT ROWID;`); err != nil {
+		return err
+	}
+	var ppids map[string]string
+	for _, k := range anonKinds {
+		tokens, err := anonMap(ctx, tx, key, k)
+		if err != nil {
+			return fmt.Errorf("map %s: %w", k.kind, err)
+		}
+		switch k.kind {
+		case "ppid":
+			ppids, res.PPIDs = tokens, len(tokens)
+		case "work_order":
+			res.WorkOrders = len(tokens)
+		case "employee":
+			res.Employees = len(tokens)
+		}
+	}
+
+	// the new IDs, before the key columns change under them
+	ins, err := tx.PrepareContext(ctx, `INSERT INTO temp.anon_ids (old_id, new_id) VALUES (?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer ins.Close()
+	for after := ""; ; {
+		page, err := legacyRecordPage(ctx, tx, after)
+		if err != nil {
+			return fmt.Errorf("read records: %w", err)
+		}
+		for _, r := range page {
+			old := r.ID
+			if t, ok := ppids[r.PPID]; ok {
+				r.PPID = t
+			}
+			if _, err := ins.ExecContext(ctx, old, RecordID(r)); err != nil {
+				return err
+			}
+			after = old
+		}
+		res.Records += len(page)
+		if len(page) < utcMigrationPageSize {
+			break
+		}
+	}
+
+	token := func(kind, column string) string {
+		return fmt.Sprintf(`%[2]s = COALESCE((SELECT token FROM temp.anon_map WHERE kind = '%[1]s' AND value = %[2]s), %[2]s)`, kind, column)
+	}
+	for _, q := range []string{
+		fmt.Sprintf(`UPDATE %s SET id = COALESCE((SELECT new_id FROM temp.anon_ids WHERE old_id = id), id), %s, %s, %s`,
+			tableName, token("ppid", "ppid"), token("work_order", "work_order"), token("employee", "employee_name")),
+		fmt.Sprintf(`UPDATE %s SET %s, %s`, latestGroupTable, token("ppid", "ppid"), token("work_order", "work_order")),
+		fmt.Sprintf(`UPDATE %s SET %s`, workOrderMetaTable, token("work_order", "work_order")),
+	} {
+		if _, err := tx.ExecContext(ctx, q); err != nil {
+			return err
+		}
+	}
+	r, err := tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s`, auditLogTable))
+	if err != nil {
+		return err
+	}
+	res.AuditDeleted, _ = r.RowsAffected()
+
+	if _, err := tx.ExecContext(ctx, `DROP TABLE temp.anon_map; DROP TABLE temp.anon_ids;`); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// anonMap fills anon_map with the tokens of the values of k and returns them by value.
+// Empty values are kept as they are.
+func anonMap(ctx context.Context, tx *sql.Tx, key []byte, k anonKind) (map[string]string, error) {
+	rows, err := tx.QueryContext(ctx, k.values)
+	if err != nil {
+		return nil, err
+	}
+	tokens := map[string]string{}
+	for rows.Next() {
+		var v sql.NullString
+		if err := rows.Scan(&v); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if v.String != "" {
+			tokens[v.String] = anonToken(key, k, v.String)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for v, t := range tokens {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO temp.anon_map (kind, value, token) VALUES (?, ?, ?)`, k.kind, v, t); err != nil {
+			return nil, err
+		}
+	}
+	return tokens, nil
+}
+
+// anonToken is the prefix and 64 bits of the HMAC-SHA256 of the value under key, kinds apart.
+func anonToken(key []byte, k anonKind, v string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(k.kind + "\x00" + v))
+	return k.prefix + strings.ToUpper(hex.EncodeToString(mac.Sum(nil)[:8]))
+}
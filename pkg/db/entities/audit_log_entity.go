@@ -0,0 +1,146 @@
+package entities
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	skylogger "hex_toolset/pkg/logger"
+	"strings"
+	"time"
+
+	"hex_toolset/pkg/timeutil"
+)
+
+// AuditEntry is one administrative action: who did what, with which parameters and how
+// it ended. Entries are only ever appended.
+type AuditEntry struct {
+	ID      int64           `json:"id" database:"id"`
+	At      string          `json:"at" database:"at"`       // 'YYYY-MM-DD HH:MM:SS' UTC
+	Actor   string          `json:"actor" database:"actor"` // e.g. "token:3f2a9c0d1e4b", "ip:10.1.2.3", "cli:ops@host"
+	Action  string          `json:"action" database:"action"`
+	Params  json.RawMessage `json:"params" database:"params"`   // JSON object
+	Outcome string          `json:"outcome" database:"outcome"` // "ok" or the failure
+}
+
+// AuditFilter selects audit entries; zero fields match everything.
+type AuditFilter struct {
+	Actor  string             // exact actor
+	Action string             // substring of the action
+	Range  timeutil.TimeRange // entries in [Start, End)
+	Limit  int                // newest entries kept; <= 0 means DefaultAuditLimit
+}
+
+// DefaultAuditLimit is the number of entries List returns without a limit.
+const DefaultAuditLimit = 200
+
+const auditLogTable = "audit_log"
+
+// AuditLogManager manages the audit_log table, the change-control record of the admin
+// API and the fix commands.
+type AuditLogManager struct {
+	TableName string
+	db        *sql.DB
+	dialect   Dialect
+	logger    *skylogger.Logger
+}
+
+// NewAuditLogManager creates a new manager
+func NewAuditLogManager(db *sql.DB) *AuditLogManager {
+	if db == nil {
+		panic("database connection cannot be nil")
+	}
+	lgr, _ := skylogger.New(
+		skylogger.WithName("entities"),
+		skylogger.WithFilePattern("{name}.log"),
+	)
+	return &AuditLogManager{TableName: auditLogTable, db: db, dialect: DialectOf(db), logger: lgr}
+}
+
+// CreateTable creates the audit_log table.
+func (m *AuditLogManager) CreateTable() error {
+	m.logEntity("CreateTable", "start")
+	q := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		id %[2]s,
+		at TEXT NOT NULL,
+		actor TEXT NOT NULL,
+		action TEXT NOT NULL,
+		params TEXT NOT NULL DEFAULT '{}',
+		outcome TEXT NOT NULL DEFAULT 'ok'
+	);
+	CREATE INDEX IF NOT EXISTS idx_%[1]s_at ON %[1]s (at);`, m.TableName, m.dialect.AutoID())
+	if _, err := m.db.Exec(q); err != nil {
+		m.logEntity("CreateTable", "error")
+		return fmt.Errorf("failed to create %s: %v", m.TableName, err)
+	}
+	m.logEntity("CreateTable", "done")
+	return nil
+}
+
+// Add appends an entry stamped at and returns its id. Nil params are stored as {}.
+func (m *AuditLogManager) Add(ctx context.Context, at time.Time, actor, action string, params json.RawMessage, outcome string) (int64, error) {
+	if len(params) == 0 {
+		params = json.RawMessage("{}")
+	}
+	q := fmt.Sprintf(`INSERT INTO %s (at, actor, action, params, outcome) VALUES (?, ?, ?, ?, ?) RETURNING id`, m.TableName)
+	var id int64
+	err := m.db.QueryRowContext(ctx, q, timeutil.FormatDB(at), actor, action, string(params), outcome).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to add audit entry: %w", err)
+	}
+	m.logEntity("Add", fmt.Sprintf("%d %s", id, action))
+	return id, nil
+}
+
+// List returns the newest entries matching f, newest first.
+func (m *AuditLogManager) List(ctx context.Context, f AuditFilter) ([]AuditEntry, error) {
+	var where []string
+	var args []any
+	if f.Actor != "" {
+		where, args = append(where, "actor = ?"), append(args, f.Actor)
+	}
+	if f.Action != "" {
+		// replace() as the substring test both engines have (instr/strpos are not shared)
+		where, args = append(where, "replace(action, ?, '') != action"), append(args, f.Action)
+	}
+	if !f.Range.Start.IsZero() {
+		where, args = append(where, "at >= ?"), append(args, timeutil.FormatDB(f.Range.Start))
+	}
+	if !f.Range.End.IsZero() {
+		where, args = append(where, "at < ?"), append(args, timeutil.FormatDB(f.Range.End))
+	}
+	limit := f.Limit
+	if limit <= 0 {
+		limit = DefaultAuditLimit
+	}
+	q := fmt.Sprintf(`SELECT id, at, actor, action, params, outcome FROM %s`, m.TableName)
+	if len(where) > 0 {
+		q += " WHERE " + strings.Join(where, " AND ")
+	}
+	q += " ORDER BY id DESC LIMIT ?"
+	rows, err := m.db.QueryContext(ctx, q, append(args, limit)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s: %w", m.TableName, err)
+	}
+	defer rows.Close()
+
+	out := []AuditEntry{}
+	for rows.Next() {
+		var e AuditEntry
+		var params string
+		if err := rows.Scan(&e.ID, &e.At, &e.Actor, &e.Action, &params, &e.Outcome); err != nil {
+			return nil, fmt.Errorf("failed to scan %s: %w", m.TableName, err)
+		}
+		e.Params = json.RawMessage(params)
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+func (m *AuditLogManager) logEntity(operation, status string) {
+	skylogger.Helper()
+	if m.logger == nil {
+		return
+	}
+	m.logger.Infof(`entity operation "%s" "%s" "%s"`, "AuditLog", operation, status)
+}
@@ -0,0 +1,223 @@
+package entities
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Dialect names.
+const (
+	DialectSQLite   = "sqlite"
+	DialectPostgres = "postgres"
+)
+
+// Conflict selects what an INSERT built by Dialect.Insert does with a row whose key is
+// already stored.
+type Conflict int
+
+const (
+	ConflictIgnore  Conflict = iota // keep the stored row
+	ConflictReplace                 // overwrite the stored row with the new one
+)
+
+// Dialect is what differs in the entities' SQL between the database engines. Queries are
+// otherwise written once, in the SQL both engines share, with "?" placeholders (the
+// PostgreSQL connection of package db numbers them). Timestamps are stored as UTC
+// 'YYYY-MM-DD HH:MM:SS' text on both, so they compare and format the same way.
+type Dialect interface {
+	Name() string
+
+	// WithoutRowID is the table option of SQLite's clustered tables ("" elsewhere).
+	WithoutRowID() string
+	// ConflictIgnore is the clause of a UNIQUE constraint whose conflicting inserts are
+	// dropped ("" where inserts say so themselves, see Insert).
+	ConflictIgnore() string
+	// TimestampType is the column type of collected timestamps.
+	TimestampType() string
+	// Date is the expression of the date part of timestamp column col.
+	Date(col string) string
+	// Timestamp is the expression of timestamp expr as 'YYYY-MM-DD HH:MM:SS' text.
+	Timestamp(expr string) string
+	// Epoch is the expression of timestamp expr in Unix seconds, an integer.
+	Epoch(expr string) string
+	// AutoID is the column definition of an integer primary key numbered by the database.
+	AutoID() string
+
+	// Insert returns the INSERT of columns into table handling conflicts on key.
+	Insert(table string, columns, key []string, c Conflict) string
+
+	// ColumnExists is the query of whether table (first argument) has column (second).
+	ColumnExists() string
+	// TableExists is the query of whether table (the argument) exists, as a count.
+	TableExists() string
+	// Columns is the query of the columns of table (the argument) as (cid, name, type,
+	// notnull, default, pk) rows, the shape of SQLite's table_info.
+	Columns() string
+	// Objects is the query of the tables, indexes and triggers of the database as (type,
+	// name, definition) rows, leaving out the engine's own.
+	Objects() string
+
+	// CreateTrigger returns the statements creating trigger name running body (statements
+	// separated by ";" using NEW) after every insert into table whose row satisfies when
+	// ("" for all).
+	CreateTrigger(name, table, when, body string) []string
+	// RejectTrigger returns the statements creating trigger name that fails every op
+	// ("UPDATE" or "DELETE") on table with message.
+	RejectTrigger(name, table, op, message string) []string
+	// DropTrigger returns the statement dropping trigger name of table, if it exists.
+	DropTrigger(name, table string) string
+	// LockTable is the statement locking table against concurrent writers until the end of
+	// the transaction ("" where writers are serialized anyway).
+	LockTable(table string) string
+}
+
+// DialectOf returns the dialect db speaks: PostgreSQL for a connection of package db
+// opened with DriverPostgres, SQLite otherwise.
+func DialectOf(db *sql.DB) Dialect {
+	if d, ok := db.Driver().(interface{ Dialect() string }); ok && d.Dialect() == DialectPostgres {
+		return postgresDialect{}
+	}
+	return sqliteDialect{}
+}
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) Name() string           { return DialectSQLite }
+func (sqliteDialect) WithoutRowID() string   { return " WITHOUT ROWID" }
+func (sqliteDialect) ConflictIgnore() string { return " ON CONFLICT IGNORE" }
+func (sqliteDialect) TimestampType() string  { return "DATETIME" }
+func (sqliteDialect) Date(col string) string { return "date(" + col + ")" }
+func (sqliteDialect) Timestamp(expr string) string {
+	return "strftime('%Y-%m-%d %H:%M:%S', " + expr + ")"
+}
+func (sqliteDialect) Epoch(expr string) string {
+	return "CAST(strftime('%s', " + expr + ") AS INTEGER)"
+}
+func (sqliteDialect) AutoID() string { return "INTEGER PRIMARY KEY AUTOINCREMENT" }
+func (sqliteDialect) ColumnExists() string {
+	return `SELECT count(*) FROM pragma_table_info(?) WHERE name = ?`
+}
+func (sqliteDialect) TableExists() string {
+	return `SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = ?`
+}
+func (sqliteDialect) Columns() string {
+	return `SELECT cid, name, type, "notnull", dflt_value, pk FROM pragma_table_info(?)`
+}
+func (sqliteDialect) DropTrigger(name, _ string) string { return "DROP TRIGGER IF EXISTS " + name }
+func (sqliteDialect) LockTable(string) string           { return "" }
+
+func (sqliteDialect) Insert(table string, columns, _ []string, c Conflict) string {
+	verb := "INSERT OR IGNORE"
+	if c == ConflictReplace {
+		verb = "INSERT OR REPLACE"
+	}
+	return fmt.Sprintf(`%s INTO %s (%s) VALUES (%s)`, verb, table, strings.Join(columns, ", "), placeholders(len(columns)))
+}
+
+func (sqliteDialect) Objects() string {
+	return `SELECT type, name, COALESCE(sql, '') FROM sqlite_master
+		WHERE type IN ('table', 'index', 'trigger') AND name NOT LIKE 'sqlite_%'`
+}
+
+func (sqliteDialect) CreateTrigger(name, table, when, body string) []string {
+	if when != "" {
+		when = "\nWHEN " + when
+	}
+	return []string{fmt.Sprintf("CREATE TRIGGER IF NOT EXISTS %s\nAFTER INSERT ON %s%s\nBEGIN\n%s\nEND;", name, table, when, body)}
+}
+
+func (sqliteDialect) RejectTrigger(name, table, op, message string) []string {
+	return []string{fmt.Sprintf("CREATE TRIGGER IF NOT EXISTS %s\nBEFORE %s ON %s\nBEGIN\n  SELECT RAISE(ABORT, '%s');\nEND;", name, op, table, message)}
+}
+
+type postgresDialect struct{}
+
+func (postgresDialect) Name() string           { return DialectPostgres }
+func (postgresDialect) WithoutRowID() string   { return "" }
+func (postgresDialect) ConflictIgnore() string { return "" }
+func (postgresDialect) TimestampType() string  { return "TEXT" }
+func (postgresDialect) Date(col string) string { return "left(" + col + ", 10)" }
+
+// Timestamp cuts the fraction off; timestamps are stored as text already.
+func (postgresDialect) Timestamp(expr string) string { return "left(" + expr + ", 19)" }
+func (postgresDialect) Epoch(expr string) string {
+	return "CAST(extract(epoch FROM CAST(" + expr + " AS timestamp)) AS BIGINT)"
+}
+func (postgresDialect) AutoID() string { return "BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY" }
+func (postgresDialect) LockTable(table string) string {
+	return "LOCK TABLE " + table + " IN SHARE ROW EXCLUSIVE MODE"
+}
+
+func (postgresDialect) ColumnExists() string {
+	return `SELECT count(*) FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = ? AND column_name = ?`
+}
+
+func (postgresDialect) TableExists() string {
+	return `SELECT count(*) FROM pg_tables WHERE schemaname = current_schema() AND tablename = ?`
+}
+
+func (postgresDialect) Columns() string {
+	return `SELECT c.ordinal_position - 1, c.column_name, c.data_type,
+		CASE WHEN c.is_nullable = 'NO' THEN 1 ELSE 0 END, c.column_default,
+		COALESCE((SELECT k.ordinal_position FROM information_schema.key_column_usage k
+			JOIN information_schema.table_constraints tc
+				ON tc.constraint_schema = k.constraint_schema AND tc.constraint_name = k.constraint_name
+			WHERE tc.constraint_type = 'PRIMARY KEY' AND k.table_schema = c.table_schema
+				AND k.table_name = c.table_name AND k.column_name = c.column_name), 0)
+		FROM information_schema.columns c
+		WHERE c.table_schema = current_schema() AND c.table_name = ?
+		ORDER BY c.ordinal_position`
+}
+
+func (postgresDialect) DropTrigger(name, table string) string {
+	return fmt.Sprintf("DROP TRIGGER IF EXISTS %s ON %s", name, table)
+}
+
+func (postgresDialect) Insert(table string, columns, key []string, c Conflict) string {
+	q := fmt.Sprintf(`INSERT INTO %s (%s) VALUES (%s)`, table, strings.Join(columns, ", "), placeholders(len(columns)))
+	if c == ConflictIgnore {
+		return q + " ON CONFLICT DO NOTHING"
+	}
+	set := make([]string, 0, len(columns))
+	for _, col := range columns {
+		set = append(set, col+" = excluded."+col)
+	}
+	return q + fmt.Sprintf(" ON CONFLICT (%s) DO UPDATE SET %s", strings.Join(key, ", "), strings.Join(set, ", "))
+}
+
+func (postgresDialect) Objects() string {
+	return `SELECT 'table', tablename, '' FROM pg_tables WHERE schemaname = current_schema()
+		UNION ALL
+		SELECT 'index', indexname, indexdef FROM pg_indexes WHERE schemaname = current_schema()
+		UNION ALL
+		SELECT 'trigger', t.tgname, pg_get_triggerdef(t.oid) FROM pg_trigger t
+		JOIN pg_class c ON c.oid = t.tgrelid JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE NOT t.tgisinternal AND n.nspname = current_schema()`
+}
+
+// CreateTrigger creates the trigger function name_fn running body and the row trigger
+// calling it.
+func (postgresDialect) CreateTrigger(name, table, when, body string) []string {
+	if when != "" {
+		body = fmt.Sprintf("IF %s THEN\n%s\nEND IF;", when, body)
+	}
+	return []string{
+		fmt.Sprintf("CREATE OR REPLACE FUNCTION %s_fn() RETURNS trigger LANGUAGE plpgsql AS $$\nBEGIN\n%s\nRETURN NULL;\nEND\n$$", name, body),
+		fmt.Sprintf("CREATE OR REPLACE TRIGGER %s\nAFTER INSERT ON %s\nFOR EACH ROW EXECUTE FUNCTION %[1]s_fn()", name, table),
+	}
+}
+
+// RejectTrigger creates the trigger function name_fn raising message and the row trigger
+// calling it.
+func (postgresDialect) RejectTrigger(name, table, op, message string) []string {
+	return []string{
+		fmt.Sprintf("CREATE OR REPLACE FUNCTION %s_fn() RETURNS trigger LANGUAGE plpgsql AS $$\nBEGIN\nRAISE EXCEPTION '%s';\nEND\n$$", name, message),
+		fmt.Sprintf("CREATE OR REPLACE TRIGGER %s\nBEFORE %s ON %s\nFOR EACH ROW EXECUTE FUNCTION %[1]s_fn()", name, op, table),
+	}
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd
+
+package entities
+
+import "errors"
+
+// freeDiskSpace fails: the free space is not read on this platform.
+func freeDiskSpace(path string) (int64, error) {
+	return 0, errors.New("free disk space is not available on this platform")
+}
@@ -0,0 +1,304 @@
+package entities
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	skylogger "hex_toolset/pkg/logger"
+	"time"
+
+	"hex_toolset/pkg/timeutil"
+)
+
+// LineStation is one entry of the line/station registry. An entry with an empty
+// StationName is the default of every station of the line without an entry of its own.
+type LineStation struct {
+	LineName    string `json:"line_name" database:"line_name"`
+	StationName string `json:"station_name" database:"station_name"`
+	Area        string `json:"area" database:"area"`
+	Process     string `json:"process" database:"process"`
+	UpdatedAt   string `json:"updated_at" database:"updated_at"` // 'YYYY-MM-DD HH:MM:SS' UTC
+}
+
+// WorkOrderMeta is the planning metadata of a work order. Program, the customer program the
+// work order builds for, is only joined by the program rollups (ProgramCounts), not
+// denormalized into the records.
+type WorkOrderMeta struct {
+	WorkOrder string `json:"work_order" database:"work_order"`
+	Customer  string `json:"customer" database:"customer"`
+	Program   string `json:"program" database:"program"`
+	TargetQty int    `json:"target_qty" database:"target_qty"`
+	UpdatedAt string `json:"updated_at" database:"updated_at"` // 'YYYY-MM-DD HH:MM:SS' UTC
+}
+
+const (
+	lineStationTable   = "line_station"
+	workOrderMetaTable = "work_order_meta"
+)
+
+// EnrichmentManager manages the line_station registry and the work_order_meta table, the
+// lookups whose fields are denormalized into records_table at ingest. Changing an entry
+// rewrites the enrichment of the stored records it applies to in the same transaction, so
+// the denormalized columns never disagree with the lookups.
+type EnrichmentManager struct {
+	db      *sql.DB
+	dialect Dialect
+	logger  *skylogger.Logger
+}
+
+// NewEnrichmentManager creates a new manager
+func NewEnrichmentManager(db *sql.DB) *EnrichmentManager {
+	if db == nil {
+		panic("database connection cannot be nil")
+	}
+	lgr, _ := skylogger.New(
+		skylogger.WithName("entities"),
+		skylogger.WithFilePattern("{name}.log"),
+	)
+	return &EnrichmentManager{db: db, dialect: DialectOf(db), logger: lgr}
+}
+
+// CreateTable creates the line_station and work_order_meta tables.
+func (m *EnrichmentManager) CreateTable() error {
+	m.logEntity("CreateTable", "start")
+	stmts := []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			line_name TEXT NOT NULL,
+			station_name TEXT NOT NULL DEFAULT '',
+			area TEXT NOT NULL DEFAULT '',
+			process TEXT NOT NULL DEFAULT '',
+			updated_at TEXT NOT NULL,
+			PRIMARY KEY (line_name, station_name)
+		)%s;`, lineStationTable, m.dialect.WithoutRowID()),
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			work_order TEXT PRIMARY KEY,
+			customer TEXT NOT NULL DEFAULT '',
+			program TEXT NOT NULL DEFAULT '',
+			target_qty INTEGER NOT NULL DEFAULT 0 CHECK (target_qty >= 0),
+			updated_at TEXT NOT NULL
+		)%s;`, workOrderMetaTable, m.dialect.WithoutRowID()),
+	}
+	for _, q := range stmts {
+		if _, err := m.db.Exec(q); err != nil {
+			m.logEntity("CreateTable", "error")
+			return fmt.Errorf("failed to create enrichment tables: %v", err)
+		}
+	}
+	// added after the table: tables created before have no program
+	if err := ensureColumn(m.db, workOrderMetaTable, "program", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		m.logEntity("CreateTable", "error")
+		return err
+	}
+	m.logEntity("CreateTable", "done")
+	return nil
+}
+
+// ListStations returns the registry ordered by line and station.
+func (m *EnrichmentManager) ListStations(ctx context.Context) ([]LineStation, error) {
+	q := fmt.Sprintf(`SELECT line_name, station_name, area, process, updated_at FROM %s
+		ORDER BY line_name, station_name`, lineStationTable)
+	rows, err := m.db.QueryContext(ctx, q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s: %w", lineStationTable, err)
+	}
+	defer rows.Close()
+
+	var out []LineStation
+	for rows.Next() {
+		var s LineStation
+		if err := rows.Scan(&s.LineName, &s.StationName, &s.Area, &s.Process, &s.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan %s: %w", lineStationTable, err)
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// SetStation creates or replaces the registry entry of line/station (station "" for the
+// line default) and re-enriches the stored records it applies to.
+func (m *EnrichmentManager) SetStation(ctx context.Context, s LineStation) error {
+	q := fmt.Sprintf(`INSERT INTO %s (line_name, station_name, area, process, updated_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(line_name, station_name) DO UPDATE SET area = excluded.area, process = excluded.process,
+			updated_at = excluded.updated_at`, lineStationTable)
+	err := m.inTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, q, s.LineName, s.StationName, s.Area, s.Process, timeutil.FormatDB(time.Now())); err != nil {
+			return fmt.Errorf("failed to set %s/%s: %w", s.LineName, s.StationName, err)
+		}
+		return m.restampStations(ctx, tx, s.LineName, s.StationName)
+	})
+	if err != nil {
+		return err
+	}
+	m.logEntity("SetStation", fmt.Sprintf("%s/%s area=%q process=%q", s.LineName, s.StationName, s.Area, s.Process))
+	return nil
+}
+
+// DeleteStation removes the registry entry of line/station and re-enriches the stored
+// records it applied to from what remains; ok is false when there was no entry.
+func (m *EnrichmentManager) DeleteStation(ctx context.Context, line, station string) (ok bool, err error) {
+	err = m.inTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE line_name = ? AND station_name = ?`, lineStationTable), line, station)
+		if err != nil {
+			return fmt.Errorf("failed to delete %s/%s: %w", line, station, err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return nil
+		}
+		ok = true
+		return m.restampStations(ctx, tx, line, station)
+	})
+	if err != nil {
+		return false, err
+	}
+	m.logEntity("DeleteStation", line+"/"+station)
+	return ok, nil
+}
+
+// restampStations recomputes area and process of the stored records of line (of station
+// only, unless station is the line default) from the registry: the station's own entry,
+// else the line default, else empty.
+func (m *EnrichmentManager) restampStations(ctx context.Context, tx *sql.Tx, line, station string) error {
+	lookup := func(col string) string {
+		return fmt.Sprintf(`COALESCE((SELECT s.%[1]s FROM %[2]s s WHERE s.line_name = %[3]s.line_name
+			AND s.station_name IN (%[3]s.station_name, '') ORDER BY s.station_name DESC LIMIT 1), '')`, col, lineStationTable, tableName)
+	}
+	q := fmt.Sprintf(`UPDATE %s SET area = %s, process = %s WHERE line_name = ?`, tableName, lookup("area"), lookup("process"))
+	args := []any{line}
+	if station != "" {
+		q += ` AND station_name = ?`
+		args = append(args, station)
+	}
+	if _, err := tx.ExecContext(ctx, q, args...); err != nil {
+		return fmt.Errorf("failed to re-enrich records of %s/%s: %w", line, station, err)
+	}
+	return nil
+}
+
+// ListWorkOrders returns the work order metadata ordered by work order.
+func (m *EnrichmentManager) ListWorkOrders(ctx context.Context) ([]WorkOrderMeta, error) {
+	q := fmt.Sprintf(`SELECT work_order, customer, program, target_qty, updated_at FROM %s ORDER BY work_order`, workOrderMetaTable)
+	rows, err := m.db.QueryContext(ctx, q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s: %w", workOrderMetaTable, err)
+	}
+	defer rows.Close()
+
+	var out []WorkOrderMeta
+	for rows.Next() {
+		var w WorkOrderMeta
+		if err := rows.Scan(&w.WorkOrder, &w.Customer, &w.Program, &w.TargetQty, &w.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan %s: %w", workOrderMetaTable, err)
+		}
+		out = append(out, w)
+	}
+	return out, rows.Err()
+}
+
+// SetWorkOrder creates or replaces the metadata of a work order and re-enriches its stored records.
+func (m *EnrichmentManager) SetWorkOrder(ctx context.Context, w WorkOrderMeta) error {
+	q := fmt.Sprintf(`INSERT INTO %s (work_order, customer, program, target_qty, updated_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(work_order) DO UPDATE SET customer = excluded.customer, program = excluded.program,
+			target_qty = excluded.target_qty, updated_at = excluded.updated_at`, workOrderMetaTable)
+	err := m.inTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, q, w.WorkOrder, w.Customer, w.Program, w.TargetQty, timeutil.FormatDB(time.Now())); err != nil {
+			return fmt.Errorf("failed to set work order %s: %w", w.WorkOrder, err)
+		}
+		return m.restampWorkOrder(ctx, tx, w.WorkOrder, w.Customer, w.TargetQty)
+	})
+	if err != nil {
+		return err
+	}
+	m.logEntity("SetWorkOrder", fmt.Sprintf("%s customer=%q program=%q target=%d", w.WorkOrder, w.Customer, w.Program, w.TargetQty))
+	return nil
+}
+
+// DeleteWorkOrder removes the metadata of a work order and clears it from its stored
+// records; ok is false when it had none.
+func (m *EnrichmentManager) DeleteWorkOrder(ctx context.Context, workOrder string) (ok bool, err error) {
+	err = m.inTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE work_order = ?`, workOrderMetaTable), workOrder)
+		if err != nil {
+			return fmt.Errorf("failed to delete work order %s: %w", workOrder, err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return nil
+		}
+		ok = true
+		return m.restampWorkOrder(ctx, tx, workOrder, "", 0)
+	})
+	if err != nil {
+		return false, err
+	}
+	m.logEntity("DeleteWorkOrder", workOrder)
+	return ok, nil
+}
+
+func (m *EnrichmentManager) restampWorkOrder(ctx context.Context, tx *sql.Tx, workOrder, customer string, target int) error {
+	q := fmt.Sprintf(`UPDATE %s SET customer = ?, target_qty = ? WHERE work_order = ?`, tableName)
+	if _, err := tx.ExecContext(ctx, q, customer, target, workOrder); err != nil {
+		return fmt.Errorf("failed to re-enrich records of work order %s: %w", workOrder, err)
+	}
+	return nil
+}
+
+// ProgramCount is the output and yield of one customer program over a time range. Records
+// of work orders without metadata count under an empty customer and program.
+type ProgramCount struct {
+	Customer   string `json:"customer"`
+	Program    string `json:"program"`
+	WorkOrders int    `json:"work_orders"`
+	// Units are the distinct units passing the output group; Tested the distinct units with
+	// any record and Failed those with a failing one.
+	Units  int `json:"units"`
+	Tested int `json:"tested"`
+	Failed int `json:"failed"`
+}
+
+// ProgramCounts aggregates the records of r per customer and program by joining their work
+// order with work_order_meta, counting as output the passes of outputGroup (case-insensitive).
+func (m *EnrichmentManager) ProgramCounts(ctx context.Context, r timeutil.TimeRange, outputGroup string) ([]ProgramCount, error) {
+	q := fmt.Sprintf(`SELECT coalesce(w.customer, '') AS meta_customer, coalesce(w.program, '') AS meta_program,
+			COUNT(DISTINCT r.work_order),
+			COUNT(DISTINCT CASE WHEN r.error_flag = 0 AND upper(r.group_name) = upper(?) THEN r.ppid END),
+			COUNT(DISTINCT r.ppid),
+			COUNT(DISTINCT CASE WHEN r.error_flag = 1 THEN r.ppid END)
+		FROM %s r LEFT JOIN %s w ON w.work_order = r.work_order
+		WHERE r.collected_timestamp >= ? AND r.collected_timestamp < ?
+		GROUP BY meta_customer, meta_program
+		ORDER BY meta_customer, meta_program`, tableName, workOrderMetaTable)
+	rows, err := m.db.QueryContext(ctx, q, outputGroup, r.DBStart(), r.DBEnd())
+	if err != nil {
+		return nil, fmt.Errorf("program counts in %s: %w", r, err)
+	}
+	defer rows.Close()
+
+	var out []ProgramCount
+	for rows.Next() {
+		var c ProgramCount
+		if err := rows.Scan(&c.Customer, &c.Program, &c.WorkOrders, &c.Units, &c.Tested, &c.Failed); err != nil {
+			return nil, fmt.Errorf("program counts in %s: %w", r, err)
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+func (m *EnrichmentManager) inTx(ctx context.Context, fn func(*sql.Tx) error) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (m *EnrichmentManager) logEntity(operation, status string) {
+	skylogger.Helper()
+	if m.logger == nil {
+		return
+	}
+	m.logger.Infof(`entity operation "%s" "%s" "%s"`, "Enrichment", operation, status)
+}
@@ -0,0 +1,49 @@
+package entities
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// The tests of this package run the entities against a temporary SQLite database holding
+// the full schema, one per test.
+
+// base is the first minute the tests store; a Monday.
+var base = time.Date(2025, 3, 10, 8, 0, 0, 0, time.UTC)
+
+func TestMain(m *testing.M) {
+	// Timestamps are stored and keyed in local time; pin it, and keep the entity log out of
+	// the source tree.
+	time.Local = time.UTC
+	dir, err := os.MkdirTemp("", "entities-test-")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Setenv("LOG_DIR", dir)
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// openTestDB returns a new database with the full schema.
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "entities.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+	if _, err := ApplySchema(context.Background(), db, SchemaOptions{}); err != nil {
+		t.Fatalf("schema: %v", err)
+	}
+	return db
+}
@@ -0,0 +1,118 @@
+package entities
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	skylogger "hex_toolset/pkg/logger"
+	"time"
+)
+
+// ExportState is the incremental export progress of one destination.
+type ExportState struct {
+	Destination  string `json:"destination" database:"destination"`
+	Watermark    string `json:"watermark" database:"watermark"` // last exported collected_timestamp, 'YYYY-MM-DD HH:MM:SS' UTC
+	ExportedRows int64  `json:"exported_rows" database:"exported_rows"`
+	LastFile     string `json:"last_file" database:"last_file"`
+	LastRunAt    string `json:"last_run_at" database:"last_run_at"`
+	LastError    string `json:"last_error" database:"last_error"`
+}
+
+const exportStateTable = "export_state"
+
+// ExportStateManager manages the export_state table, one row per destination.
+type ExportStateManager struct {
+	TableName string
+	db        *sql.DB
+	dialect   Dialect
+	logger    *skylogger.Logger
+}
+
+// NewExportStateManager creates a new manager
+func NewExportStateManager(db *sql.DB) *ExportStateManager {
+	if db == nil {
+		panic("database connection cannot be nil")
+	}
+	lgr, _ := skylogger.New(
+		skylogger.WithName("entities"),
+		skylogger.WithFilePattern("{name}.log"),
+	)
+	return &ExportStateManager{TableName: exportStateTable, db: db, dialect: DialectOf(db), logger: lgr}
+}
+
+// CreateTable creates the export_state table.
+func (m *ExportStateManager) CreateTable() error {
+	m.logEntity("CreateTable", "start")
+	q := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		destination TEXT PRIMARY KEY,
+		watermark TEXT NOT NULL DEFAULT '',
+		exported_rows INTEGER NOT NULL DEFAULT 0,
+		last_file TEXT NOT NULL DEFAULT '',
+		last_run_at TEXT NOT NULL DEFAULT '',
+		last_error TEXT NOT NULL DEFAULT ''
+	)%s;`, m.TableName, m.dialect.WithoutRowID())
+	if _, err := m.db.Exec(q); err != nil {
+		m.logEntity("CreateTable", "error")
+		return fmt.Errorf("failed to create %s: %v", m.TableName, err)
+	}
+	m.logEntity("CreateTable", "done")
+	return nil
+}
+
+// Get returns the state of destination; a destination never exported has an empty Watermark.
+func (m *ExportStateManager) Get(destination string) (ExportState, error) {
+	st := ExportState{Destination: destination}
+	q := fmt.Sprintf(`SELECT watermark, exported_rows, last_file, last_run_at, last_error FROM %s WHERE destination = ?`, m.TableName)
+	err := m.db.QueryRow(q, destination).Scan(&st.Watermark, &st.ExportedRows, &st.LastFile, &st.LastRunAt, &st.LastError)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return st, fmt.Errorf("failed to read export state of %s: %w", destination, err)
+	}
+	return st, nil
+}
+
+// Advance moves the watermark of destination after rows were exported to file.
+func (m *ExportStateManager) Advance(destination, watermark string, rows int64, file string) error {
+	q := fmt.Sprintf(`INSERT INTO %[1]s (destination, watermark, exported_rows, last_file, last_run_at, last_error)
+		VALUES (?, ?, ?, ?, ?, '')
+		ON CONFLICT(destination) DO UPDATE SET
+			watermark = excluded.watermark,
+			exported_rows = %[1]s.exported_rows + excluded.exported_rows,
+			last_file = excluded.last_file,
+			last_run_at = excluded.last_run_at,
+			last_error = ''`, m.TableName)
+	if _, err := m.db.Exec(q, destination, watermark, rows, file, time.Now().Format("2006-01-02 15:04:05")); err != nil {
+		m.logEntity("Advance", "error")
+		return fmt.Errorf("failed to advance export watermark of %s: %w", destination, err)
+	}
+	m.logEntity("Advance", fmt.Sprintf("%s -> %s (%d rows)", destination, watermark, rows))
+	return nil
+}
+
+// RecordError stores the failure of a run without moving the watermark.
+func (m *ExportStateManager) RecordError(destination string, runErr error) error {
+	q := fmt.Sprintf(`INSERT INTO %s (destination, last_run_at, last_error) VALUES (?, ?, ?)
+		ON CONFLICT(destination) DO UPDATE SET last_run_at = excluded.last_run_at, last_error = excluded.last_error`, m.TableName)
+	if _, err := m.db.Exec(q, destination, time.Now().Format("2006-01-02 15:04:05"), runErr.Error()); err != nil {
+		return fmt.Errorf("failed to record export error of %s: %w", destination, err)
+	}
+	return nil
+}
+
+// Reset sets the watermark of destination, e.g. to re-export a period after a backfill.
+func (m *ExportStateManager) Reset(destination, watermark string) error {
+	q := fmt.Sprintf(`INSERT INTO %s (destination, watermark) VALUES (?, ?)
+		ON CONFLICT(destination) DO UPDATE SET watermark = excluded.watermark`, m.TableName)
+	if _, err := m.db.Exec(q, destination, watermark); err != nil {
+		return fmt.Errorf("failed to reset export watermark of %s: %w", destination, err)
+	}
+	m.logEntity("Reset", fmt.Sprintf("%s -> %s", destination, watermark))
+	return nil
+}
+
+func (m *ExportStateManager) logEntity(operation, status string) {
+	skylogger.Helper()
+	if m.logger == nil {
+		return
+	}
+	m.logger.Infof(`entity operation "%s" "%s" "%s"`, "ExportState", operation, status)
+}
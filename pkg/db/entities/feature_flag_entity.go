@@ -0,0 +1,113 @@
+package entities
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	skylogger "hex_toolset/pkg/logger"
+	"time"
+)
+
+// FeatureFlag is a named on/off switch stored in the plant database, so one build can
+// roll a risky behavior out plant by plant.
+type FeatureFlag struct {
+	Name        string `json:"name" database:"name"`
+	Enabled     bool   `json:"enabled" database:"enabled"`
+	Description string `json:"description,omitempty" database:"description"`
+	UpdatedAt   string `json:"updated_at" database:"updated_at"` // 'YYYY-MM-DD HH:MM:SS'
+}
+
+const featureFlagsTable = "feature_flags"
+
+// FeatureFlagManager manages the feature_flags table.
+type FeatureFlagManager struct {
+	TableName string
+	db        *sql.DB
+	dialect   Dialect
+	logger    *skylogger.Logger
+}
+
+// NewFeatureFlagManager creates a new manager
+func NewFeatureFlagManager(db *sql.DB) *FeatureFlagManager {
+	if db == nil {
+		panic("database connection cannot be nil")
+	}
+	lgr, _ := skylogger.New(
+		skylogger.WithName("entities"),
+		skylogger.WithFilePattern("{name}.log"),
+	)
+	return &FeatureFlagManager{TableName: featureFlagsTable, db: db, dialect: DialectOf(db), logger: lgr}
+}
+
+// CreateTable creates the feature_flags table.
+func (m *FeatureFlagManager) CreateTable() error {
+	m.logEntity("CreateTable", "start")
+	q := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		name TEXT PRIMARY KEY,
+		enabled INTEGER NOT NULL DEFAULT 0,
+		description TEXT NOT NULL DEFAULT '',
+		updated_at TEXT NOT NULL
+	)%s;`, m.TableName, m.dialect.WithoutRowID())
+	if _, err := m.db.Exec(q); err != nil {
+		m.logEntity("CreateTable", "error")
+		return fmt.Errorf("failed to create %s: %v", m.TableName, err)
+	}
+	m.logEntity("CreateTable", "done")
+	return nil
+}
+
+// List returns every stored flag ordered by name.
+func (m *FeatureFlagManager) List(ctx context.Context) ([]FeatureFlag, error) {
+	q := fmt.Sprintf(`SELECT name, enabled, description, updated_at FROM %s ORDER BY name`, m.TableName)
+	rows, err := m.db.QueryContext(ctx, q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s: %w", m.TableName, err)
+	}
+	defer rows.Close()
+
+	var out []FeatureFlag
+	for rows.Next() {
+		var f FeatureFlag
+		if err := rows.Scan(&f.Name, &f.Enabled, &f.Description, &f.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan %s: %w", m.TableName, err)
+		}
+		out = append(out, f)
+	}
+	return out, rows.Err()
+}
+
+// Get returns the flag called name; ok is false when it has never been set.
+func (m *FeatureFlagManager) Get(ctx context.Context, name string) (f FeatureFlag, ok bool, err error) {
+	q := fmt.Sprintf(`SELECT name, enabled, description, updated_at FROM %s WHERE name = ?`, m.TableName)
+	err = m.db.QueryRowContext(ctx, q, name).Scan(&f.Name, &f.Enabled, &f.Description, &f.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return f, false, nil
+	}
+	if err != nil {
+		return f, false, fmt.Errorf("failed to read flag %s: %w", name, err)
+	}
+	return f, true, nil
+}
+
+// Set stores the state of flag name. An empty description keeps the stored one.
+func (m *FeatureFlagManager) Set(ctx context.Context, name string, enabled bool, description string) error {
+	q := fmt.Sprintf(`INSERT INTO %[1]s (name, enabled, description, updated_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET
+			enabled = excluded.enabled,
+			description = CASE WHEN excluded.description = '' THEN %[1]s.description ELSE excluded.description END,
+			updated_at = excluded.updated_at`, m.TableName)
+	if _, err := m.db.ExecContext(ctx, q, name, enabled, description, time.Now().Format("2006-01-02 15:04:05")); err != nil {
+		return fmt.Errorf("failed to set flag %s: %w", name, err)
+	}
+	m.logEntity("Set", fmt.Sprintf("%s=%t", name, enabled))
+	return nil
+}
+
+func (m *FeatureFlagManager) logEntity(operation, status string) {
+	skylogger.Helper()
+	if m.logger == nil {
+		return
+	}
+	m.logger.Infof(`entity operation "%s" "%s" "%s"`, "FeatureFlag", operation, status)
+}
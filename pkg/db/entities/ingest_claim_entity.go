@@ -0,0 +1,126 @@
+package entities
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	skylogger "hex_toolset/pkg/logger"
+	"time"
+
+	"hex_toolset/pkg/timeutil"
+)
+
+// IngestClaim is a time range of SFC data being fetched and stored by one process, so
+// db_clon's loops and a fix run never work on the same minutes at the same time. A claim
+// lapses at ExpiresAt, which frees the range of a process that died holding it.
+type IngestClaim struct {
+	ID        int64  `json:"id" database:"id"`
+	StartAt   string `json:"start_at" database:"start_at"` // 'YYYY-MM-DD HH:MM:SS' UTC
+	EndAt     string `json:"end_at" database:"end_at"`     // exclusive
+	Owner     string `json:"owner" database:"owner"`       // e.g. "fix@host:4242 hour"
+	ClaimedAt string `json:"claimed_at" database:"claimed_at"`
+	ExpiresAt string `json:"expires_at" database:"expires_at"`
+}
+
+const ingestClaimTable = "ingest_claim"
+
+// IngestClaimManager manages the ingest_claim table.
+type IngestClaimManager struct {
+	TableName string
+	db        *sql.DB
+	dialect   Dialect
+	logger    *skylogger.Logger
+}
+
+// NewIngestClaimManager creates a new manager
+func NewIngestClaimManager(db *sql.DB) *IngestClaimManager {
+	if db == nil {
+		panic("database connection cannot be nil")
+	}
+	lgr, _ := skylogger.New(
+		skylogger.WithName("entities"),
+		skylogger.WithFilePattern("{name}.log"),
+	)
+	return &IngestClaimManager{TableName: ingestClaimTable, db: db, dialect: DialectOf(db), logger: lgr}
+}
+
+// CreateTable creates the ingest_claim table.
+func (m *IngestClaimManager) CreateTable() error {
+	m.logEntity("CreateTable", "start")
+	q := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		id %[2]s,
+		start_at TEXT NOT NULL,
+		end_at TEXT NOT NULL CHECK (end_at > start_at),
+		owner TEXT NOT NULL,
+		claimed_at TEXT NOT NULL,
+		expires_at TEXT NOT NULL
+	);`, m.TableName, m.dialect.AutoID())
+	if _, err := m.db.Exec(q); err != nil {
+		m.logEntity("CreateTable", "error")
+		return fmt.Errorf("failed to create %s: %v", m.TableName, err)
+	}
+	m.logEntity("CreateTable", "done")
+	return nil
+}
+
+// TryClaim claims [start, end) for owner until now+ttl unless a live claim overlaps it.
+// The check and the insert are one statement, under a table lock on PostgreSQL, so two
+// processes cannot both succeed. It returns the id of the new claim, or ok false and the
+// claim in the way.
+func (m *IngestClaimManager) TryClaim(ctx context.Context, start, end time.Time, owner string, now time.Time, ttl time.Duration) (id int64, held IngestClaim, ok bool, err error) {
+	s, e, at := timeutil.FormatDB(start), timeutil.FormatDB(end), timeutil.FormatDB(now)
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, held, false, fmt.Errorf("failed to claim %s..%s: %w", s, e, err)
+	}
+	defer tx.Rollback()
+	if lock := m.dialect.LockTable(m.TableName); lock != "" {
+		if _, err := tx.ExecContext(ctx, lock); err != nil {
+			return 0, held, false, fmt.Errorf("failed to claim %s..%s: %w", s, e, err)
+		}
+	}
+	q := fmt.Sprintf(`INSERT INTO %[1]s (start_at, end_at, owner, claimed_at, expires_at)
+		SELECT ?, ?, ?, ?, ? WHERE NOT EXISTS (
+			SELECT 1 FROM %[1]s WHERE start_at < ? AND end_at > ? AND expires_at > ?)
+		RETURNING id`, m.TableName)
+	err = tx.QueryRowContext(ctx, q, s, e, owner, at, timeutil.FormatDB(now.Add(ttl)), e, s, at).Scan(&id)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, held, false, fmt.Errorf("failed to claim %s..%s: %w", s, e, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, held, false, fmt.Errorf("failed to claim %s..%s: %w", s, e, err)
+	}
+	if id != 0 {
+		return id, held, true, nil
+	}
+
+	q = fmt.Sprintf(`SELECT id, start_at, end_at, owner, claimed_at, expires_at FROM %s
+		WHERE start_at < ? AND end_at > ? AND expires_at > ? ORDER BY id LIMIT 1`, m.TableName)
+	err = m.db.QueryRowContext(ctx, q, e, s, at).Scan(&held.ID, &held.StartAt, &held.EndAt, &held.Owner, &held.ClaimedAt, &held.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		// released in between; the caller retries
+		return 0, held, false, nil
+	}
+	if err != nil {
+		return 0, held, false, fmt.Errorf("failed to read claim on %s..%s: %w", s, e, err)
+	}
+	return 0, held, false, nil
+}
+
+// Release removes the claim id and the claims that lapsed before now.
+func (m *IngestClaimManager) Release(ctx context.Context, id int64, now time.Time) error {
+	q := fmt.Sprintf(`DELETE FROM %s WHERE id = ? OR expires_at <= ?`, m.TableName)
+	if _, err := m.db.ExecContext(ctx, q, id, timeutil.FormatDB(now)); err != nil {
+		return fmt.Errorf("failed to release claim %d: %w", id, err)
+	}
+	return nil
+}
+
+func (m *IngestClaimManager) logEntity(operation, status string) {
+	skylogger.Helper()
+	if m.logger == nil {
+		return
+	}
+	m.logger.Infof(`entity operation "%s" "%s" "%s"`, "IngestClaim", operation, status)
+}
@@ -0,0 +1,273 @@
+package entities
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	skylogger "hex_toolset/pkg/logger"
+	"time"
+)
+
+// IngestStatus is the outcome of ingesting one minute.
+type IngestStatus string
+
+const (
+	IngestOK     IngestStatus = "ok"     // records fetched and stored
+	IngestEmpty  IngestStatus = "empty"  // API answered with no records for the minute
+	IngestFailed IngestStatus = "failed" // fetch or insert failed; the minute needs a repair
+)
+
+// Ingest sources, recorded so repairs and reloads can be told apart from live ingestion.
+const (
+	IngestSourceLive   = "live"
+	IngestSourceRepair = "repair"
+	IngestSourceHour   = "hour"
+)
+
+// IngestLedgerEntry records what happened to one minute of SFC data.
+type IngestLedgerEntry struct {
+	Minute    string       `json:"minute" database:"minute"` // 'YYYY-MM-DD HH:MM:00' local time
+	Status    IngestStatus `json:"status" database:"status"`
+	Records   int          `json:"records" database:"records"`
+	Attempts  int          `json:"attempts" database:"attempts"`
+	Source    string       `json:"source" database:"source"`
+	Error     string       `json:"error,omitempty" database:"error"`
+	UpdatedAt string       `json:"updated_at" database:"updated_at"`
+	// IngestedAt is when the minute was first stored successfully (ok or empty); later
+	// reloads keep it, so it measures ingestion latency. Empty until then.
+	IngestedAt string `json:"ingested_at,omitempty" database:"ingested_at"`
+	// Checksum identifies the records last fetched for the minute (see the managers'
+	// recordsChecksum); a re-fetch with the same checksum needs no processing. Mutations
+	// counts the re-fetches of a minute already reconciled by an hour reload that returned
+	// different records, i.e. upstream data changed silently after the hour closed.
+	Checksum  string `json:"checksum,omitempty" database:"checksum"`
+	Mutations int    `json:"mutations,omitempty" database:"mutations"`
+}
+
+const ingestLedgerTable = "ingest_ledger"
+
+// IngestLedgerManager manages the ingest_ledger table, one row per minute.
+type IngestLedgerManager struct {
+	TableName string
+	db        *sql.DB
+	logger    *skylogger.Logger
+}
+
+// NewIngestLedgerManager creates a new manager
+func NewIngestLedgerManager(db *sql.DB) *IngestLedgerManager {
+	if db == nil {
+		panic("database connection cannot be nil")
+	}
+	lgr, _ := skylogger.New(
+		skylogger.WithName("entities"),
+		skylogger.WithFilePattern("{name}.log"),
+	)
+	return &IngestLedgerManager{TableName: ingestLedgerTable, db: db, logger: lgr}
+}
+
+// CreateTable creates the ledger table and its status index.
+func (m *IngestLedgerManager) CreateTable() error {
+	m.logEntity("CreateTable", "start")
+	stmts := []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			minute TEXT PRIMARY KEY,
+			status TEXT NOT NULL,
+			records INTEGER NOT NULL DEFAULT 0,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			source TEXT NOT NULL DEFAULT '',
+			error TEXT NOT NULL DEFAULT '',
+			updated_at TEXT NOT NULL,
+			ingested_at TEXT NOT NULL DEFAULT '',
+			checksum TEXT NOT NULL DEFAULT '',
+			mutations INTEGER NOT NULL DEFAULT 0
+		)%s;`, m.TableName, DialectOf(m.db).WithoutRowID()),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS idx_%s_status ON %s(status, minute);`, m.TableName, m.TableName),
+	}
+	for _, q := range stmts {
+		if _, err := m.db.Exec(q); err != nil {
+			m.logEntity("CreateTable", "error")
+			return fmt.Errorf("failed to create %s: %v", m.TableName, err)
+		}
+	}
+	// Ledgers created before ingested_at existed get the column; their minutes count as
+	// never ingested on time, which only affects SLO windows reaching back before the upgrade.
+	// Older ledgers also lack the checksums, so their minutes are processed once more.
+	for _, col := range []struct{ name, def string }{
+		{"ingested_at", "TEXT NOT NULL DEFAULT ''"},
+		{"checksum", "TEXT NOT NULL DEFAULT ''"},
+		{"mutations", "INTEGER NOT NULL DEFAULT 0"},
+	} {
+		if err := ensureColumn(m.db, m.TableName, col.name, col.def); err != nil {
+			m.logEntity("CreateTable", "error")
+			return err
+		}
+	}
+	m.logEntity("CreateTable", "done")
+	return nil
+}
+
+// Mutated reports whether a minute whose ledger entry is prev, fetched again with checksum,
+// changed upstream after its hour was reconciled.
+func Mutated(prev IngestLedgerEntry, checksum string) bool {
+	return prev.Source == IngestSourceHour && prev.Checksum != "" && checksum != "" && prev.Checksum != checksum
+}
+
+// Record upserts the outcome of ingesting minute; attempts accumulate across calls.
+// checksum identifies the records fetched (empty when the fetch failed, keeping the last one).
+func (m *IngestLedgerManager) Record(ctx context.Context, minute time.Time, status IngestStatus, records int, source, checksum string, ingestErr error) error {
+	errText := ""
+	if ingestErr != nil {
+		errText = ingestErr.Error()
+	}
+	now := time.Now().Format("2006-01-02 15:04:05")
+	q := fmt.Sprintf(`INSERT INTO %s (minute, status, records, attempts, source, error, updated_at, ingested_at, checksum)
+		VALUES (?, ?, ?, 1, ?, ?, ?, ?, ?)
+		ON CONFLICT(minute) DO UPDATE SET
+			status = excluded.status,
+			records = excluded.records,
+			attempts = attempts + 1,
+			source = excluded.source,
+			error = excluded.error,
+			updated_at = excluded.updated_at,
+			%s,
+			%s`, m.TableName, keepIngestedAt, trackChecksum)
+	_, err := m.db.ExecContext(ctx, q, ledgerMinute(minute), string(status), records, source, errText,
+		now, ingestedAt(status, now), checksum)
+	if err != nil {
+		return fmt.Errorf("failed to record ingest of %s: %w", ledgerMinute(minute), err)
+	}
+	return nil
+}
+
+// RecordRange marks every minute in [start, end) with status; used after whole-hour reloads
+// where per-minute counts are not known. checksums holds the checksum of each minute keyed
+// by its Unix time; minutes without one keep their last checksum.
+func (m *IngestLedgerManager) RecordRange(start, end time.Time, status IngestStatus, source string, checksums map[int64]string) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin ledger transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	q := fmt.Sprintf(`INSERT INTO %s (minute, status, records, attempts, source, error, updated_at, ingested_at, checksum)
+		VALUES (?, ?, 0, 1, ?, '', ?, ?, ?)
+		ON CONFLICT(minute) DO UPDATE SET
+			status = excluded.status,
+			attempts = attempts + 1,
+			source = excluded.source,
+			error = '',
+			updated_at = excluded.updated_at,
+			%s,
+			%s`, m.TableName, keepIngestedAt, trackChecksum)
+	now := time.Now().Format("2006-01-02 15:04:05")
+	for t := start.Truncate(time.Minute); t.Before(end); t = t.Add(time.Minute) {
+		if _, err := tx.Exec(q, ledgerMinute(t), string(status), source, now, ingestedAt(status, now), checksums[t.Unix()]); err != nil {
+			return fmt.Errorf("failed to record ingest of %s: %w", ledgerMinute(t), err)
+		}
+	}
+	return tx.Commit()
+}
+
+// MissingMinutes returns the minutes in [start, end) that have no successful (ok or empty)
+// ledger entry, i.e. minutes never ingested or whose last attempt failed.
+func (m *IngestLedgerManager) MissingMinutes(start, end time.Time) ([]time.Time, error) {
+	start = start.Truncate(time.Minute)
+	q := fmt.Sprintf(`SELECT minute FROM %s WHERE minute >= ? AND minute < ? AND status IN (?, ?)`, m.TableName)
+	rows, err := m.db.Query(q, ledgerMinute(start), ledgerMinute(end), string(IngestOK), string(IngestEmpty))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query ingest ledger: %w", err)
+	}
+	defer rows.Close()
+
+	done := map[string]bool{}
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, fmt.Errorf("failed to scan ingest ledger: %w", err)
+		}
+		done[s] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var missing []time.Time
+	for t := start; t.Before(end); t = t.Add(time.Minute) {
+		if !done[ledgerMinute(t)] {
+			missing = append(missing, t)
+		}
+	}
+	return missing, nil
+}
+
+// Range returns the ledger entries for minutes in [start, end), oldest first.
+func (m *IngestLedgerManager) Range(start, end time.Time) ([]IngestLedgerEntry, error) {
+	q := fmt.Sprintf(`SELECT minute, status, records, attempts, source, error, updated_at, ingested_at, checksum, mutations
+		FROM %s WHERE minute >= ? AND minute < ? ORDER BY minute`, m.TableName)
+	rows, err := m.db.Query(q, ledgerMinute(start), ledgerMinute(end))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query ingest ledger: %w", err)
+	}
+	defer rows.Close()
+
+	var out []IngestLedgerEntry
+	for rows.Next() {
+		var e IngestLedgerEntry
+		var status string
+		if err := rows.Scan(&e.Minute, &status, &e.Records, &e.Attempts, &e.Source, &e.Error, &e.UpdatedAt, &e.IngestedAt,
+			&e.Checksum, &e.Mutations); err != nil {
+			return nil, fmt.Errorf("failed to scan ingest ledger: %w", err)
+		}
+		e.Status = IngestStatus(status)
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+// LatencyCounts classifies the minutes in [start, end) by when they were first ingested:
+// within latency of the minute's end (onTime), later (late), or not at all (missing).
+func (m *IngestLedgerManager) LatencyCounts(ctx context.Context, start, end time.Time, latency time.Duration) (onTime, late, missing int, err error) {
+	start, end = start.Truncate(time.Minute), end.Truncate(time.Minute)
+	deadline := int64((time.Minute + latency).Seconds())
+	d := DialectOf(m.db)
+	q := fmt.Sprintf(`SELECT
+			COALESCE(SUM(CASE WHEN %s - %s <= ? THEN 1 ELSE 0 END), 0),
+			COUNT(*)
+		FROM %s WHERE minute >= ? AND minute < ? AND ingested_at != ''`, d.Epoch("ingested_at"), d.Epoch("minute"), m.TableName)
+	var ingested int
+	if err = m.db.QueryRowContext(ctx, q, deadline, ledgerMinute(start), ledgerMinute(end)).Scan(&onTime, &ingested); err != nil {
+		return 0, 0, 0, fmt.Errorf("failed to query ingest latency: %w", err)
+	}
+	total := int(end.Sub(start) / time.Minute)
+	return onTime, ingested - onTime, max(total-ingested, 0), nil
+}
+
+func (m *IngestLedgerManager) logEntity(operation, status string) {
+	skylogger.Helper()
+	if m.logger == nil {
+		return
+	}
+	m.logger.Infof(`entity operation "%s" "%s" "%s"`, "IngestLedger", operation, status)
+}
+
+// keepIngestedAt is the upsert clause setting ingested_at only on the first success.
+const keepIngestedAt = `ingested_at = CASE WHEN ingested_at = '' THEN excluded.ingested_at ELSE ingested_at END`
+
+// trackChecksum is the upsert clause keeping the checksum of the last successful fetch and
+// counting the mutations of reconciled minutes; it must match Mutated. The unqualified
+// columns are the stored values.
+const trackChecksum = `mutations = mutations + (source = 'hour' AND checksum != '' AND excluded.checksum != '' AND checksum != excluded.checksum),
+			checksum = CASE WHEN excluded.checksum = '' THEN checksum ELSE excluded.checksum END`
+
+// ingestedAt is the ingested_at value written for an attempt with status at now.
+func ingestedAt(status IngestStatus, now string) string {
+	if status == IngestFailed {
+		return ""
+	}
+	return now
+}
+
+// ledgerMinute formats t as the ledger key: local wall-clock minute.
+func ledgerMinute(t time.Time) string {
+	return t.In(time.Local).Truncate(time.Minute).Format("2006-01-02 15:04:00")
+}
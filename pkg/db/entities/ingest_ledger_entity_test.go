@@ -0,0 +1,95 @@
+package entities
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestIngestLedger(t *testing.T) {
+	ctx := context.Background()
+	ledger := NewIngestLedgerManager(openTestDB(t))
+	at := func(i int) time.Time { return base.Add(time.Duration(i) * time.Minute) }
+	entry := func(minute time.Time) IngestLedgerEntry {
+		t.Helper()
+		entries, err := ledger.Range(minute, minute.Add(time.Minute))
+		if err != nil || len(entries) != 1 {
+			t.Fatalf("entries of %s = %+v, %v", minute, entries, err)
+		}
+		return entries[0]
+	}
+
+	// A failed attempt keeps the minute missing; the retry's success sets ingested_at once.
+	if err := ledger.Record(ctx, at(0), IngestFailed, 0, IngestSourceLive, "", errors.New("timeout")); err != nil {
+		t.Fatal(err)
+	}
+	if e := entry(at(0)); e.Status != IngestFailed || e.Error != "timeout" || e.Attempts != 1 || e.IngestedAt != "" {
+		t.Fatalf("failed minute = %+v", e)
+	}
+	if err := ledger.Record(ctx, at(0), IngestOK, 3, IngestSourceRepair, "sum1", nil); err != nil {
+		t.Fatal(err)
+	}
+	first := entry(at(0))
+	if first.Status != IngestOK || first.Records != 3 || first.Attempts != 2 || first.Source != IngestSourceRepair ||
+		first.Error != "" || first.IngestedAt == "" || first.Checksum != "sum1" {
+		t.Fatalf("repaired minute = %+v", first)
+	}
+	// A later failure keeps the checksum of the last fetch.
+	if err := ledger.Record(ctx, at(0), IngestFailed, 0, IngestSourceLive, "", errors.New("down")); err != nil {
+		t.Fatal(err)
+	}
+	if e := entry(at(0)); e.Checksum != "sum1" || e.IngestedAt != first.IngestedAt || e.Attempts != 3 {
+		t.Fatalf("minute failing after its success = %+v", e)
+	}
+	if err := ledger.Record(ctx, at(1), IngestEmpty, 0, IngestSourceLive, "empty", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	missing, err := ledger.MissingMinutes(at(0), at(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []time.Time{at(0), at(2)}; !reflect.DeepEqual(missing, want) {
+		t.Fatalf("missing = %v, want %v", missing, want)
+	}
+
+	// An hour reload marks every minute, counting those it fetched different records for
+	// after an earlier reload as mutations.
+	hour := base.Add(time.Hour)
+	if err := ledger.RecordRange(base, hour, IngestOK, IngestSourceHour, map[int64]string{at(0).Unix(): "sum2"}); err != nil {
+		t.Fatal(err)
+	}
+	if missing, err := ledger.MissingMinutes(base, hour); err != nil || len(missing) != 0 {
+		t.Fatalf("missing after the reload = %v, %v", missing, err)
+	}
+	if e := entry(at(0)); e.Checksum != "sum2" || e.Mutations != 0 || e.Source != IngestSourceHour {
+		t.Fatalf("reloaded minute = %+v", e)
+	}
+	if e := entry(at(1)); e.Checksum != "empty" {
+		t.Fatalf("minute reloaded without a checksum = %+v, want its last one kept", e)
+	}
+	if !Mutated(entry(at(0)), "sum3") || Mutated(entry(at(0)), "sum2") || Mutated(entry(at(0)), "") {
+		t.Fatal("Mutated disagrees with the stored checksum")
+	}
+	if err := ledger.RecordRange(base, at(1), IngestOK, IngestSourceHour, map[int64]string{at(0).Unix(): "sum3"}); err != nil {
+		t.Fatal(err)
+	}
+	if e := entry(at(0)); e.Mutations != 1 || e.Checksum != "sum3" {
+		t.Fatalf("mutated minute = %+v", e)
+	}
+
+	// Every minute of the hour was first ingested just now, long after it ended.
+	onTime, late, missingN, err := ledger.LatencyCounts(ctx, base, hour.Add(time.Minute), time.Minute)
+	if err != nil || onTime != 0 || late != 60 || missingN != 1 {
+		t.Fatalf("latency = %d on time, %d late, %d missing, %v", onTime, late, missingN, err)
+	}
+	now := time.Now().Truncate(time.Minute).Add(-time.Minute)
+	if err := ledger.Record(ctx, now, IngestOK, 1, IngestSourceLive, "x", nil); err != nil {
+		t.Fatal(err)
+	}
+	if onTime, late, _, err := ledger.LatencyCounts(ctx, now, now.Add(time.Minute), time.Hour); err != nil || onTime != 1 || late != 0 {
+		t.Fatalf("latency of a minute ingested at once = %d on time, %d late, %v", onTime, late, err)
+	}
+}
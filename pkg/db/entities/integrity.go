@@ -0,0 +1,78 @@
+package entities
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// maxIntegrityProblems bounds the rows an integrity pragma reports.
+const maxIntegrityProblems = 100
+
+// SchemaObject is an index or trigger of the database.
+type SchemaObject struct {
+	Type  string `json:"type"` // "index" or "trigger"
+	Name  string `json:"name"`
+	Table string `json:"table"`
+}
+
+func (o SchemaObject) String() string { return o.Type + " " + o.Name + " on " + o.Table }
+
+// ListSchemaObjects returns the indexes and triggers of db ordered by type and name,
+// leaving out the automatic indexes SQLite keeps for primary keys and UNIQUE constraints.
+func ListSchemaObjects(ctx context.Context, db *sql.DB) ([]SchemaObject, error) {
+	if d := DialectOf(db); d.Name() != DialectSQLite {
+		return nil, fmt.Errorf("schema objects are listed of SQLite databases only, not %s (see VerifySchema)", d.Name())
+	}
+	rows, err := db.QueryContext(ctx, `SELECT type, name, tbl_name FROM sqlite_master
+		WHERE type IN ('index', 'trigger') AND name NOT LIKE 'sqlite_autoindex_%'
+		ORDER BY type, name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list schema objects: %w", err)
+	}
+	defer rows.Close()
+
+	var out []SchemaObject
+	for rows.Next() {
+		var o SchemaObject
+		if err := rows.Scan(&o.Type, &o.Name, &o.Table); err != nil {
+			return nil, fmt.Errorf("failed to scan schema object: %w", err)
+		}
+		out = append(out, o)
+	}
+	return out, rows.Err()
+}
+
+// IntegrityCheck runs PRAGMA quick_check, or integrity_check when full, and returns the
+// problems found; none means the database file is sound. quick_check reads every page but
+// skips matching indexes against their tables, which integrity_check also does and which
+// makes it several times slower on a large database.
+func IntegrityCheck(ctx context.Context, db *sql.DB, full bool) ([]string, error) {
+	if d := DialectOf(db); d.Name() != DialectSQLite {
+		return nil, fmt.Errorf("integrity check is of SQLite databases only, not %s (use pg_amcheck)", d.Name())
+	}
+	pragma := "quick_check"
+	if full {
+		pragma = "integrity_check"
+	}
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("PRAGMA %s(%d)", pragma, maxIntegrityProblems))
+	if err != nil {
+		return nil, fmt.Errorf("pragma %s: %w", pragma, err)
+	}
+	defer rows.Close()
+
+	var problems []string
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, fmt.Errorf("pragma %s: %w", pragma, err)
+		}
+		if s != "ok" {
+			problems = append(problems, s)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("pragma %s: %w", pragma, err)
+	}
+	return problems, nil
+}
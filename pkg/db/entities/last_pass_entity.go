@@ -1,6 +1,7 @@
 package entities
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	skylogger "hex_toolset/pkg/logger"
@@ -10,7 +11,7 @@ import (
 type LatestPass struct {
 	LineName           string `json:"line_name" database:"line_name"`
 	GroupName          string `json:"group_name" database:"group_name"`
-	CollectedTimestamp string `json:"collected_timestamp" database:"collected_timestamp"` // 'YYYY-MM-DD HH:MM:SS'
+	CollectedTimestamp string `json:"collected_timestamp" database:"collected_timestamp"` // 'YYYY-MM-DD HH:MM:SS' UTC
 }
 
 const latestPassTable = "latest_pass"
@@ -65,7 +66,7 @@ func (m *LatestPassManager) CreateTable() error {
 }
 
 // UpsertIfNewer inserts or updates the latest pass only if incoming timestamp is newer or row doesn't exist.
-// timestamp must be in format 'YYYY-MM-DD HH:MM:SS'
+// timestamp must be in format 'YYYY-MM-DD HH:MM:SS' UTC (timeutil.FormatDB)
 func (m *LatestPassManager) UpsertIfNewer(lineName, groupName, timestamp string) error {
 	// Use INSERT ... ON CONFLICT DO UPDATE with a WHERE clause to enforce newer timestamp only
 	q := fmt.Sprintf(`INSERT INTO %s (line_name, group_name, collected_timestamp)
@@ -86,9 +87,14 @@ func (m *LatestPassManager) Get(lineName, groupName string) (LatestPass, error)
 }
 
 func (m *LatestPassManager) GetMap() (map[string]string, error) {
+	return m.GetMapContext(context.Background())
+}
+
+// GetMapContext is GetMap bounded by ctx.
+func (m *LatestPassManager) GetMapContext(ctx context.Context) (map[string]string, error) {
 	q := fmt.Sprintf(`SELECT line_name || '_' || group_name AS line_group, collected_timestamp FROM %s`, m.TableName)
 
-	rows, err := m.db.Query(q)
+	rows, err := m.db.QueryContext(ctx, q)
 	if err != nil {
 		return nil, err
 	}
@@ -111,6 +117,27 @@ func (m *LatestPassManager) GetMap() (map[string]string, error) {
 	return result, nil
 }
 
+// LatestByLine returns the most recent passing timestamp of each line, over all its groups.
+func (m *LatestPassManager) LatestByLine(ctx context.Context) (map[string]string, error) {
+	q := fmt.Sprintf(`SELECT line_name, MAX(collected_timestamp) FROM %s GROUP BY line_name`, m.TableName)
+
+	rows, err := m.db.QueryContext(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make(map[string]string)
+	for rows.Next() {
+		var line, ts string
+		if err := rows.Scan(&line, &ts); err != nil {
+			return nil, err
+		}
+		result[line] = ts
+	}
+	return result, rows.Err()
+}
+
 // DeleteAll removes all rows (utility/testing)
 func (m *LatestPassManager) DeleteAll() error {
 	q := fmt.Sprintf(`DELETE FROM %s`, m.TableName)
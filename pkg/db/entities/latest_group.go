@@ -1,6 +1,7 @@
 package entities
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	skylogger "hex_toolset/pkg/logger"
@@ -43,17 +44,18 @@ func (m *LatestGroupManager) CreateTable() error {
 		m.logger.Infof(`entity operation "%s" "%s" "%s"`, "LatestGroup", "CreateTable", "start")
 	}
 
+	d := DialectOf(m.db)
 	create := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
   ppid                TEXT PRIMARY KEY,
   work_order          TEXT NOT NULL,
-  collected_timestamp DATETIME NOT NULL,
+  collected_timestamp %s NOT NULL,
   line_name           TEXT NOT NULL,
   group_name          TEXT NOT NULL,
   station_name        TEXT NOT NULL,
   model_name          TEXT NOT NULL,
   next_station        TEXT NOT NULL DEFAULT '',
   error_flag          INTEGER NOT NULL DEFAULT 0
-) WITHOUT ROWID;`, m.TableName)
+)%s;`, m.TableName, d.TimestampType(), d.WithoutRowID())
 
 	if _, err := m.db.Exec(create); err != nil {
 		if m.logger != nil {
@@ -123,10 +125,11 @@ WHERE excluded.collected_timestamp > %s.collected_timestamp;`, m.TableName, m.Ta
 	return err
 }
 
-// DeleteOnInStore mirrors trigger behavior (useful for replays or repairs).
-func (m *LatestGroupManager) DeleteOnInStore(ppid string) error {
-	q := fmt.Sprintf(`DELETE FROM %s WHERE ppid = ?;`, m.TableName)
-	_, err := m.db.Exec(q, ppid)
+// DeleteOnInStore mirrors trigger behavior (useful for replays or repairs): the ppid is
+// removed only if its stored state is not newer than the IN_STORE timestamp.
+func (m *LatestGroupManager) DeleteOnInStore(ppid, timestamp string) error {
+	q := fmt.Sprintf(`DELETE FROM %s WHERE ppid = ? AND collected_timestamp <= ?;`, m.TableName)
+	_, err := m.db.Exec(q, ppid, timestamp)
 	return err
 }
 
@@ -139,7 +142,7 @@ FROM %s WHERE ppid = ?;`, m.TableName)
 	return lg, err
 }
 
-// Map like "J06_PACKING" -> "YYYY-MM-DD HH:MM:SS" (aggregated from latest_group)
+// Map like "J06_PACKING" -> "YYYY-MM-DD HH:MM:SS" UTC (aggregated from latest_group)
 func (m *LatestGroupManager) GetLineGroupMap() (map[string]string, error) {
 	q := fmt.Sprintf(`SELECT line_name || '_' || group_name AS line_group,
        MAX(collected_timestamp) AS ts
@@ -163,6 +166,145 @@ GROUP BY line_group;`, m.TableName)
 	return out, rows.Err()
 }
 
+// GetWIPContext counts the units in process keyed by LINE_GROUP (e.g. "J06_PACKING"), the
+// group of each unit being that of its latest pass.
+func (m *LatestGroupManager) GetWIPContext(ctx context.Context) (map[string]int, error) {
+	return m.wip(ctx, m.db)
+}
+
+// wipQuerier runs the latest_group reads: the database, or the read transaction of a
+// snapshot.
+type wipQuerier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func (m *LatestGroupManager) wip(ctx context.Context, db wipQuerier) (map[string]int, error) {
+	q := fmt.Sprintf(`SELECT line_name || '_' || group_name AS line_group, COUNT(*)
+FROM %s
+GROUP BY line_group;`, m.TableName)
+
+	rows, err := db.QueryContext(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make(map[string]int)
+	for rows.Next() {
+		var k string
+		var n int
+		if err := rows.Scan(&k, &n); err != nil {
+			return nil, err
+		}
+		out[k] = n
+	}
+	return out, rows.Err()
+}
+
+// WIPVersion returns a token that changes whenever latest_group does, for conditional GETs of
+// the WIP: the newest collected_timestamp, which moves with every live pass, the row count,
+// which moves when a unit leaves at IN_STORE, and the sum of the timestamps, which moves
+// when a backfill upserts a pass older than the newest. idx_latest_group_ts covers it, so it
+// is much cheaper than loading the WIP itself.
+func (m *LatestGroupManager) WIPVersion(ctx context.Context) (string, error) {
+	return m.version(ctx, m.db)
+}
+
+func (m *LatestGroupManager) version(ctx context.Context, db wipQuerier) (string, error) {
+	d := DialectOf(m.db)
+	q := fmt.Sprintf(`SELECT COUNT(*),
+       COALESCE(replace(replace(replace(%s, '-', ''), ' ', ''), ':', ''), ''),
+       COALESCE(SUM(%s), 0)
+FROM %s;`, d.Timestamp("MAX(collected_timestamp)"), d.Epoch("collected_timestamp"), m.TableName)
+	var n int
+	var newest string
+	var sum int64
+	if err := db.QueryRowContext(ctx, q).Scan(&n, &newest, &sum); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s-%d-%x", newest, n, sum), nil
+}
+
+// ListWIP returns the units in process with their latest pass, of one line and group or
+// ("") all, ordered by line, group and timestamp. CollectedTimestamp is in DB layout, UTC.
+func (m *LatestGroupManager) ListWIP(ctx context.Context, lineName, groupName string) ([]LatestGroup, error) {
+	return m.units(ctx, m.db, lineName, groupName)
+}
+
+func (m *LatestGroupManager) units(ctx context.Context, db wipQuerier, lineName, groupName string) ([]LatestGroup, error) {
+	q := fmt.Sprintf(`SELECT ppid, work_order, %s,
+       line_name, group_name, station_name, model_name, next_station, error_flag
+FROM %s
+WHERE (? = '' OR line_name = ?) AND (? = '' OR group_name = ?)
+ORDER BY line_name, group_name, collected_timestamp;`, DialectOf(m.db).Timestamp("collected_timestamp"), m.TableName)
+
+	rows, err := db.QueryContext(ctx, q, lineName, lineName, groupName, groupName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []LatestGroup{}
+	for rows.Next() {
+		var lg LatestGroup
+		if err := rows.Scan(&lg.PPID, &lg.WorkOrder, &lg.CollectedTimestamp, &lg.LineName, &lg.GroupName,
+			&lg.StationName, &lg.ModelName, &lg.NextStation, &lg.ErrorFlag); err != nil {
+			return nil, err
+		}
+		out = append(out, lg)
+	}
+	return out, rows.Err()
+}
+
+// WIPSnapshot is latest_group at one point in time: the version and the data read with it
+// agree, so a consumer caching by Version never pairs it with older or newer units.
+type WIPSnapshot struct {
+	Version string         // as WIPVersion
+	WIP     map[string]int // as GetWIPContext; SnapshotWIP only
+	Units   []LatestGroup  // as ListWIP; SnapshotUnits only
+}
+
+// SnapshotWIP reads the version and the units in process keyed by LINE_GROUP in one read
+// transaction (see readSnapshot).
+func (m *LatestGroupManager) SnapshotWIP(ctx context.Context) (WIPSnapshot, error) {
+	var snap WIPSnapshot
+	err := m.readSnapshot(ctx, func(tx *sql.Tx) (err error) {
+		if snap.Version, err = m.version(ctx, tx); err != nil {
+			return err
+		}
+		snap.WIP, err = m.wip(ctx, tx)
+		return err
+	})
+	return snap, err
+}
+
+// SnapshotUnits reads the version and the units in process of one line and group or ("")
+// all, as ListWIP, in one read transaction (see readSnapshot).
+func (m *LatestGroupManager) SnapshotUnits(ctx context.Context, lineName, groupName string) (WIPSnapshot, error) {
+	var snap WIPSnapshot
+	err := m.readSnapshot(ctx, func(tx *sql.Tx) (err error) {
+		if snap.Version, err = m.version(ctx, tx); err != nil {
+			return err
+		}
+		snap.Units, err = m.units(ctx, tx, lineName, groupName)
+		return err
+	})
+	return snap, err
+}
+
+// readSnapshot runs fn in a read transaction (BEGIN DEFERRED). With WAL its first read
+// fixes the snapshot the later ones see, so the latest_group trigger updates of inserts
+// committing in between, live or backfill, cannot show up in only some of the reads.
+func (m *LatestGroupManager) readSnapshot(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := m.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("failed to begin snapshot read: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+	return fn(tx)
+}
+
 // Utility
 func (m *LatestGroupManager) DeleteAll() error {
 	q := fmt.Sprintf(`DELETE FROM %s;`, m.TableName)
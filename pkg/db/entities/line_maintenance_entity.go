@@ -0,0 +1,109 @@
+package entities
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	skylogger "hex_toolset/pkg/logger"
+	"time"
+
+	"hex_toolset/pkg/timeutil"
+)
+
+// LineMaintenance marks a line whose ingestion and broadcasts are switched off, typically
+// while it is down for maintenance and engineering runs test units through it.
+type LineMaintenance struct {
+	LineName   string `json:"line_name" database:"line_name"`
+	Reason     string `json:"reason" database:"reason"`
+	DisabledAt string `json:"disabled_at" database:"disabled_at"` // 'YYYY-MM-DD HH:MM:SS'
+}
+
+const lineMaintenanceTable = "line_maintenance"
+
+// LineMaintenanceManager manages the line_maintenance table; a line is ingested unless
+// it has a row there.
+type LineMaintenanceManager struct {
+	TableName string
+	db        *sql.DB
+	dialect   Dialect
+	logger    *skylogger.Logger
+}
+
+// NewLineMaintenanceManager creates a new manager
+func NewLineMaintenanceManager(db *sql.DB) *LineMaintenanceManager {
+	if db == nil {
+		panic("database connection cannot be nil")
+	}
+	lgr, _ := skylogger.New(
+		skylogger.WithName("entities"),
+		skylogger.WithFilePattern("{name}.log"),
+	)
+	return &LineMaintenanceManager{TableName: lineMaintenanceTable, db: db, dialect: DialectOf(db), logger: lgr}
+}
+
+// CreateTable creates the line_maintenance table.
+func (m *LineMaintenanceManager) CreateTable() error {
+	m.logEntity("CreateTable", "start")
+	q := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		line_name TEXT PRIMARY KEY,
+		reason TEXT NOT NULL DEFAULT '',
+		disabled_at TEXT NOT NULL
+	)%s;`, m.TableName, m.dialect.WithoutRowID())
+	if _, err := m.db.Exec(q); err != nil {
+		m.logEntity("CreateTable", "error")
+		return fmt.Errorf("failed to create %s: %v", m.TableName, err)
+	}
+	m.logEntity("CreateTable", "done")
+	return nil
+}
+
+// List returns the disabled lines ordered by name.
+func (m *LineMaintenanceManager) List(ctx context.Context) ([]LineMaintenance, error) {
+	q := fmt.Sprintf(`SELECT line_name, reason, disabled_at FROM %s ORDER BY line_name`, m.TableName)
+	rows, err := m.db.QueryContext(ctx, q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s: %w", m.TableName, err)
+	}
+	defer rows.Close()
+
+	var out []LineMaintenance
+	for rows.Next() {
+		var l LineMaintenance
+		if err := rows.Scan(&l.LineName, &l.Reason, &l.DisabledAt); err != nil {
+			return nil, fmt.Errorf("failed to scan %s: %w", m.TableName, err)
+		}
+		out = append(out, l)
+	}
+	return out, rows.Err()
+}
+
+// Disable switches line off. Disabling an already disabled line updates its reason and
+// keeps the original disabled_at.
+func (m *LineMaintenanceManager) Disable(ctx context.Context, line, reason string) error {
+	q := fmt.Sprintf(`INSERT INTO %s (line_name, reason, disabled_at) VALUES (?, ?, ?)
+		ON CONFLICT(line_name) DO UPDATE SET reason = excluded.reason`, m.TableName)
+	if _, err := m.db.ExecContext(ctx, q, line, reason, time.Now().Format(timeutil.DBLayout)); err != nil {
+		return fmt.Errorf("failed to disable line %s: %w", line, err)
+	}
+	m.logEntity("Disable", fmt.Sprintf("%s reason=%q", line, reason))
+	return nil
+}
+
+// Enable switches line back on; ok is false when it was not disabled.
+func (m *LineMaintenanceManager) Enable(ctx context.Context, line string) (ok bool, err error) {
+	res, err := m.db.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE line_name = ?`, m.TableName), line)
+	if err != nil {
+		return false, fmt.Errorf("failed to enable line %s: %w", line, err)
+	}
+	n, _ := res.RowsAffected()
+	m.logEntity("Enable", line)
+	return n > 0, nil
+}
+
+func (m *LineMaintenanceManager) logEntity(operation, status string) {
+	skylogger.Helper()
+	if m.logger == nil {
+		return
+	}
+	m.logger.Infof(`entity operation "%s" "%s" "%s"`, "LineMaintenance", operation, status)
+}
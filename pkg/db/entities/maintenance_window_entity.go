@@ -0,0 +1,117 @@
+package entities
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	skylogger "hex_toolset/pkg/logger"
+	"time"
+
+	"hex_toolset/pkg/timeutil"
+)
+
+// MaintenanceWindow is a planned stop of one line, or of every line when LineName is
+// empty, during which missing passes are expected and not alarmed on.
+type MaintenanceWindow struct {
+	ID        int64  `json:"id" database:"id"`
+	LineName  string `json:"line_name" database:"line_name"` // "" for all lines
+	StartAt   string `json:"start_at" database:"start_at"`   // 'YYYY-MM-DD HH:MM:SS' UTC
+	EndAt     string `json:"end_at" database:"end_at"`       // 'YYYY-MM-DD HH:MM:SS' UTC, exclusive
+	Reason    string `json:"reason" database:"reason"`
+	CreatedAt string `json:"created_at" database:"created_at"` // 'YYYY-MM-DD HH:MM:SS' UTC
+}
+
+const maintenanceWindowTable = "maintenance_window"
+
+// MaintenanceWindowManager manages the maintenance_window table, the dated maintenance
+// windows; the recurring ones come from the MAINTENANCE_WINDOWS setting.
+type MaintenanceWindowManager struct {
+	TableName string
+	db        *sql.DB
+	dialect   Dialect
+	logger    *skylogger.Logger
+}
+
+// NewMaintenanceWindowManager creates a new manager
+func NewMaintenanceWindowManager(db *sql.DB) *MaintenanceWindowManager {
+	if db == nil {
+		panic("database connection cannot be nil")
+	}
+	lgr, _ := skylogger.New(
+		skylogger.WithName("entities"),
+		skylogger.WithFilePattern("{name}.log"),
+	)
+	return &MaintenanceWindowManager{TableName: maintenanceWindowTable, db: db, dialect: DialectOf(db), logger: lgr}
+}
+
+// CreateTable creates the maintenance_window table.
+func (m *MaintenanceWindowManager) CreateTable() error {
+	m.logEntity("CreateTable", "start")
+	q := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		id %[2]s,
+		line_name TEXT NOT NULL DEFAULT '',
+		start_at TEXT NOT NULL,
+		end_at TEXT NOT NULL CHECK (end_at > start_at),
+		reason TEXT NOT NULL DEFAULT '',
+		created_at TEXT NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_%[1]s_end ON %[1]s (end_at);`, m.TableName, m.dialect.AutoID())
+	if _, err := m.db.Exec(q); err != nil {
+		m.logEntity("CreateTable", "error")
+		return fmt.Errorf("failed to create %s: %v", m.TableName, err)
+	}
+	m.logEntity("CreateTable", "done")
+	return nil
+}
+
+// Add stores the window [start, end) of line ("" for all lines) and returns its id.
+func (m *MaintenanceWindowManager) Add(ctx context.Context, line string, start, end time.Time, reason string) (int64, error) {
+	q := fmt.Sprintf(`INSERT INTO %s (line_name, start_at, end_at, reason, created_at) VALUES (?, ?, ?, ?, ?) RETURNING id`, m.TableName)
+	var id int64
+	err := m.db.QueryRowContext(ctx, q, line, timeutil.FormatDB(start), timeutil.FormatDB(end), reason, timeutil.FormatDB(time.Now())).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to add maintenance window: %w", err)
+	}
+	m.logEntity("Add", fmt.Sprintf("%d line=%q %s..%s", id, line, timeutil.FormatDB(start), timeutil.FormatDB(end)))
+	return id, nil
+}
+
+// Overlapping returns the windows overlapping r, ordered by start.
+func (m *MaintenanceWindowManager) Overlapping(ctx context.Context, r timeutil.TimeRange) ([]MaintenanceWindow, error) {
+	q := fmt.Sprintf(`SELECT id, line_name, start_at, end_at, reason, created_at FROM %s
+		WHERE end_at > ? AND start_at < ? ORDER BY start_at, id`, m.TableName)
+	rows, err := m.db.QueryContext(ctx, q, timeutil.FormatDB(r.Start), timeutil.FormatDB(r.End))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s: %w", m.TableName, err)
+	}
+	defer rows.Close()
+
+	var out []MaintenanceWindow
+	for rows.Next() {
+		var w MaintenanceWindow
+		if err := rows.Scan(&w.ID, &w.LineName, &w.StartAt, &w.EndAt, &w.Reason, &w.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan %s: %w", m.TableName, err)
+		}
+		out = append(out, w)
+	}
+	return out, rows.Err()
+}
+
+// Delete removes the window id; ok is false when there was none.
+func (m *MaintenanceWindowManager) Delete(ctx context.Context, id int64) (ok bool, err error) {
+	res, err := m.db.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE id = ?`, m.TableName), id)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete maintenance window %d: %w", id, err)
+	}
+	n, _ := res.RowsAffected()
+	m.logEntity("Delete", fmt.Sprint(id))
+	return n > 0, nil
+}
+
+func (m *MaintenanceWindowManager) logEntity(operation, status string) {
+	skylogger.Helper()
+	if m.logger == nil {
+		return
+	}
+	m.logger.Infof(`entity operation "%s" "%s" "%s"`, "MaintenanceWindow", operation, status)
+}
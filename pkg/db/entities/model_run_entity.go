@@ -0,0 +1,215 @@
+package entities
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	skylogger "hex_toolset/pkg/logger"
+
+	"hex_toolset/pkg/timeutil"
+)
+
+// ModelRun is a segment of a line's output during which it ran one model: the passes of
+// the output group from Start to End (inclusive) were all of ModelName. A changeover ends
+// the run and starts the next one at the first pass of the new model.
+type ModelRun struct {
+	LineName  string `json:"line_name" database:"line_name"`
+	ModelName string `json:"model_name" database:"model_name"`
+	Start     string `json:"start" database:"start_ts"` // first pass, 'YYYY-MM-DD HH:MM:SS' UTC
+	End       string `json:"end" database:"end_ts"`     // last pass so far
+	Units     int    `json:"units" database:"units"`
+}
+
+// Changeover is a model change detected by Segment.
+type Changeover struct {
+	LineName string
+	From, To string // From is "" for the first run of a line
+	At       string
+}
+
+const modelRunTable = "model_run"
+
+// ModelRunManager manages model_run, the model-run segments of each line derived from the
+// passes of one output group.
+type ModelRunManager struct {
+	TableName string
+	db        *sql.DB
+	dialect   Dialect
+	logger    *skylogger.Logger
+}
+
+// NewModelRunManager creates a new manager
+func NewModelRunManager(db *sql.DB) *ModelRunManager {
+	if db == nil {
+		panic("database connection cannot be nil")
+	}
+	lgr, _ := skylogger.New(
+		skylogger.WithName("entities"),
+		skylogger.WithFilePattern("{name}.log"),
+	)
+	return &ModelRunManager{TableName: modelRunTable, db: db, dialect: DialectOf(db), logger: lgr}
+}
+
+func (m *ModelRunManager) logEntity(operation, status string) {
+	skylogger.Helper()
+	if m.logger != nil {
+		m.logger.Infof(`entity operation "%s" "%s" "%s"`, "ModelRun", operation, status)
+	}
+}
+
+// CreateTable creates the model_run table.
+func (m *ModelRunManager) CreateTable() error {
+	m.logEntity("CreateTable", "start")
+	stmts := []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		line_name TEXT NOT NULL,
+		start_ts TEXT NOT NULL,
+		model_name TEXT NOT NULL,
+		end_ts TEXT NOT NULL,
+		units INTEGER NOT NULL,
+		PRIMARY KEY (line_name, start_ts)
+	)%s;`, m.TableName, m.dialect.WithoutRowID()),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS idx_model_run_model ON %s (model_name, start_ts)`, m.TableName),
+	}
+	for _, q := range stmts {
+		if _, err := m.db.Exec(q); err != nil {
+			m.logEntity("CreateTable", "error")
+			return fmt.Errorf("failed to create %s: %v", m.TableName, err)
+		}
+	}
+	m.logEntity("CreateTable", "done")
+	return nil
+}
+
+// Segment extends the model runs with the passes of group recorded after the end of each
+// line's latest run and returns the changeovers found. Lines without runs are segmented
+// from their first pass. Passes inserted later with an older timestamp (backfills of a
+// segmented period) are not re-attributed; Resegment rebuilds a range for that.
+func (m *ModelRunManager) Segment(ctx context.Context, group string) ([]Changeover, error) {
+	latest, err := m.latest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	q := fmt.Sprintf(`SELECT r.line_name, r.model_name, %s
+		FROM %s r LEFT JOIN (
+			SELECT line_name, MAX(end_ts) AS end_ts FROM %s GROUP BY line_name
+		) m ON m.line_name = r.line_name
+		WHERE r.group_name = ? AND r.error_flag = 0 AND (m.end_ts IS NULL OR r.collected_timestamp > m.end_ts)
+		ORDER BY r.line_name, r.collected_timestamp`, m.dialect.Timestamp("r.collected_timestamp"), tableName, m.TableName)
+	rows, err := m.db.QueryContext(ctx, q, group)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query passes of %s: %w", group, err)
+	}
+	var touched []*ModelRun
+	var changes []Changeover
+	for rows.Next() {
+		var line, model, ts string
+		if err := rows.Scan(&line, &model, &ts); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan pass: %w", err)
+		}
+		cur := latest[line]
+		if cur != nil && cur.ModelName == model {
+			if len(touched) == 0 || touched[len(touched)-1] != cur {
+				touched = append(touched, cur)
+			}
+			cur.End = ts
+			cur.Units++
+			continue
+		}
+		c := Changeover{LineName: line, To: model, At: ts}
+		if cur != nil {
+			c.From = cur.ModelName
+		}
+		changes = append(changes, c)
+		latest[line] = &ModelRun{LineName: line, ModelName: model, Start: ts, End: ts, Units: 1}
+		touched = append(touched, latest[line])
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return changes, m.save(ctx, touched)
+}
+
+// Resegment deletes every run still going on at or after the start of r and segments the
+// passes from there again, e.g. after an hour was reloaded with corrected records.
+func (m *ModelRunManager) Resegment(ctx context.Context, group string, r timeutil.TimeRange) ([]Changeover, error) {
+	res, err := m.db.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE end_ts >= ?`, m.TableName), r.DBStart())
+	if err != nil {
+		m.logEntity("Resegment", "error")
+		return nil, fmt.Errorf("failed to delete runs from %s: %w", r, err)
+	}
+	n, _ := res.RowsAffected()
+	m.logEntity(fmt.Sprintf("Resegment: %d runs from %s deleted", n, r.DBStart()), "done")
+	return m.Segment(ctx, group)
+}
+
+// latest returns the latest run of each line.
+func (m *ModelRunManager) latest(ctx context.Context) (map[string]*ModelRun, error) {
+	q := fmt.Sprintf(`SELECT line_name, model_name, start_ts, end_ts, units FROM %[1]s
+		WHERE (line_name, start_ts) IN (SELECT line_name, MAX(start_ts) FROM %[1]s GROUP BY line_name)`, m.TableName)
+	runs, err := m.query(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]*ModelRun, len(runs))
+	for i := range runs {
+		out[runs[i].LineName] = &runs[i]
+	}
+	return out, nil
+}
+
+// List returns the runs of line overlapping r, oldest first; an empty line lists all lines.
+func (m *ModelRunManager) List(ctx context.Context, line string, r timeutil.TimeRange) ([]ModelRun, error) {
+	q := fmt.Sprintf(`SELECT line_name, model_name, start_ts, end_ts, units FROM %s
+		WHERE start_ts < ? AND end_ts >= ? AND (? = '' OR line_name = ?)
+		ORDER BY start_ts, line_name`, m.TableName)
+	return m.query(ctx, q, r.DBEnd(), r.DBStart(), line, line)
+}
+
+func (m *ModelRunManager) query(ctx context.Context, q string, args ...any) ([]ModelRun, error) {
+	rows, err := m.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s: %w", m.TableName, err)
+	}
+	defer rows.Close()
+	var out []ModelRun
+	for rows.Next() {
+		var run ModelRun
+		if err := rows.Scan(&run.LineName, &run.ModelName, &run.Start, &run.End, &run.Units); err != nil {
+			return nil, fmt.Errorf("failed to scan %s: %w", m.TableName, err)
+		}
+		out = append(out, run)
+	}
+	return out, rows.Err()
+}
+
+func (m *ModelRunManager) save(ctx context.Context, runs []*ModelRun) error {
+	if len(runs) == 0 {
+		return nil
+	}
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	stmt, err := tx.PrepareContext(ctx, fmt.Sprintf(`INSERT INTO %s (line_name, start_ts, model_name, end_ts, units)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(line_name, start_ts) DO UPDATE SET end_ts = excluded.end_ts, units = excluded.units`, m.TableName))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, run := range runs {
+		if _, err := stmt.ExecContext(ctx, run.LineName, run.Start, run.ModelName, run.End, run.Units); err != nil {
+			m.logEntity("save", "error")
+			return fmt.Errorf("failed to save run of %s from %s: %w", run.LineName, run.Start, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	m.logEntity(fmt.Sprintf("save: %d runs", len(runs)), "done")
+	return nil
+}
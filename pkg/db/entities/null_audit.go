@@ -0,0 +1,108 @@
+package entities
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+)
+
+// NullColumn reports the NULLs found in one nullable column.
+type NullColumn struct {
+	Table  string `json:"table"`
+	Column string `json:"column"`
+	Type   string `json:"type"`
+	Nulls  int64  `json:"nulls"`
+	Filled int64  `json:"filled,omitempty"`
+}
+
+// AuditNulls counts NULLs in every nullable, non-key column of every table. Only columns
+// holding at least one NULL are returned.
+func AuditNulls(ctx context.Context, db *sql.DB) ([]NullColumn, error) {
+	if d := DialectOf(db); d.Name() != DialectSQLite {
+		return nil, fmt.Errorf("null audit runs on SQLite databases only, not %s", d.Name())
+	}
+	tables, err := userTables(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	var out []NullColumn
+	for _, table := range tables {
+		cols, err := nullableColumns(ctx, db, table)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range cols {
+			q := fmt.Sprintf(`SELECT COUNT(*) FROM %q WHERE %q IS NULL`, table, c.Column)
+			if err := db.QueryRowContext(ctx, q).Scan(&c.Nulls); err != nil {
+				return nil, fmt.Errorf("count NULLs in %s.%s: %w", table, c.Column, err)
+			}
+			if c.Nulls > 0 {
+				out = append(out, c)
+			}
+		}
+	}
+	return out, nil
+}
+
+// nullFillColumns are the columns FillNullText may rewrite: records_table.employee_name,
+// whose NULLs (rows written by older tools or by hand) break consumers scanning it into a
+// string. NULLs elsewhere are only reported.
+var nullFillColumns = map[string][]string{tableName: {"employee_name"}}
+
+// FillNullText replaces NULLs with empty strings, which is how the ingest writes a missing
+// value, in the columns of cols that are listed in nullFillColumns. The other columns are
+// returned unchanged, with Filled 0.
+func FillNullText(ctx context.Context, db *sql.DB, cols []NullColumn) ([]NullColumn, error) {
+	out := make([]NullColumn, 0, len(cols))
+	for _, c := range cols {
+		if slices.Contains(nullFillColumns[c.Table], c.Column) {
+			q := fmt.Sprintf(`UPDATE %q SET %q = '' WHERE %q IS NULL`, c.Table, c.Column, c.Column)
+			res, err := db.ExecContext(ctx, q)
+			if err != nil {
+				return out, fmt.Errorf("fill NULLs in %s.%s: %w", c.Table, c.Column, err)
+			}
+			c.Filled, _ = res.RowsAffected()
+		}
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+func userTables(ctx context.Context, db *sql.DB) ([]string, error) {
+	rows, err := db.QueryContext(ctx, `SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("list tables: %w", err)
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("list tables: %w", err)
+		}
+		out = append(out, name)
+	}
+	return out, rows.Err()
+}
+
+func nullableColumns(ctx context.Context, db *sql.DB, table string) ([]NullColumn, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(`PRAGMA table_info(%q)`, table))
+	if err != nil {
+		return nil, fmt.Errorf("table info %s: %w", table, err)
+	}
+	defer rows.Close()
+	var out []NullColumn
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, dataType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &dataType, &notNull, &defaultValue, &pk); err != nil {
+			return nil, fmt.Errorf("table info %s: %w", table, err)
+		}
+		if notNull == 0 && pk == 0 {
+			out = append(out, NullColumn{Table: table, Column: name, Type: dataType})
+		}
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,73 @@
+package entities
+
+import (
+	"context"
+	"testing"
+)
+
+func TestNullAudit(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	if err := NewRecordManagerEntity(db).InsertBatch([]RecordEntity{
+		{PPID: "U1", WorkOrder: "MO1", LineName: "J01", GroupName: "TEST", StationName: "ST01", ModelName: "M", CollectedTimestamp: base},
+		{PPID: "U2", WorkOrder: "MO1", LineName: "J01", GroupName: "TEST", StationName: "ST01", ModelName: "M", CollectedTimestamp: base},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// NULLs as written by older tools, in records_table and in a table of another tool.
+	for _, q := range []string{
+		`UPDATE records_table SET employee_name = NULL, next_station = NULL`,
+		`CREATE TABLE notes (body TEXT)`,
+		`INSERT INTO notes (body) VALUES (NULL)`,
+	} {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Scans read the NULLs as empty strings.
+	rows, err := db.Query(`SELECT ` + RecordSelectColumns(sqliteDialect{}) + ` FROM records_table`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+		if r, err := ScanRecord(rows); err != nil || r.EmployeeName != "" || r.NextStation != "" {
+			t.Fatalf("ScanRecord = %+v, %v", r, err)
+		}
+	}
+	rows.Close()
+
+	found, err := AuditNulls(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nulls := map[string]int64{}
+	for _, c := range found {
+		nulls[c.Table+"."+c.Column] = c.Nulls
+	}
+	if len(nulls) != 3 || nulls["records_table.employee_name"] != 2 || nulls["records_table.next_station"] != 2 || nulls["notes.body"] != 1 {
+		t.Fatalf("AuditNulls = %v", nulls)
+	}
+
+	// Only employee_name is filled; the other NULLs stay reported.
+	filled, err := FillNullText(ctx, db, found)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range filled {
+		want := int64(0)
+		if c.Table == "records_table" && c.Column == "employee_name" {
+			want = 2
+		}
+		if c.Filled != want {
+			t.Errorf("%s.%s filled %d, want %d", c.Table, c.Column, c.Filled, want)
+		}
+	}
+	after, err := AuditNulls(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(after) != 2 {
+		t.Fatalf("NULLs after filling = %+v, want next_station and notes.body", after)
+	}
+}
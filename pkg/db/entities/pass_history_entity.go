@@ -0,0 +1,146 @@
+package entities
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	skylogger "hex_toolset/pkg/logger"
+
+	"hex_toolset/pkg/timeutil"
+)
+
+const (
+	passHistoryTable   = "pass_history"
+	passHistoryTrigger = "trg_records_pass_history"
+)
+
+// PassHistoryManager manages pass_history, the optional companion of latest_pass that keeps
+// every passing second of a (line, group) instead of only the newest, with the units that
+// passed in it. It feeds inter-pass interval analytics (takt adherence).
+//
+// While history mode is enabled a trigger appends to it on every passing insert; Compact
+// trims it back to the newest passing seconds of each (line, group), so between compactions
+// the table holds a bounded ring per (line, group) plus what was appended since.
+type PassHistoryManager struct {
+	TableName string
+	db        *sql.DB
+	dialect   Dialect
+	logger    *skylogger.Logger
+}
+
+// NewPassHistoryManager creates a new manager
+func NewPassHistoryManager(db *sql.DB) *PassHistoryManager {
+	if db == nil {
+		panic("database connection cannot be nil")
+	}
+	lgr, _ := skylogger.New(
+		skylogger.WithName("entities"),
+		skylogger.WithFilePattern("{name}.log"),
+	)
+	return &PassHistoryManager{TableName: passHistoryTable, db: db, dialect: DialectOf(db), logger: lgr}
+}
+
+func (m *PassHistoryManager) logEntity(operation, status string) {
+	skylogger.Helper()
+	if m.logger != nil {
+		m.logger.Infof(`entity operation "%s" "%s" "%s"`, "PassHistory", operation, status)
+	}
+}
+
+// CreateTable creates the pass_history table. The history trigger is managed by SetEnabled.
+func (m *PassHistoryManager) CreateTable() error {
+	m.logEntity("CreateTable", "start")
+	q := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		line_name TEXT NOT NULL,
+		group_name TEXT NOT NULL,
+		collected_timestamp TEXT NOT NULL,
+		units INTEGER NOT NULL DEFAULT 1,
+		PRIMARY KEY (line_name, group_name, collected_timestamp)
+	)%s;`, m.TableName, m.dialect.WithoutRowID())
+	if _, err := m.db.Exec(q); err != nil {
+		m.logEntity("CreateTable", "error")
+		return fmt.Errorf("failed to create %s: %v", m.TableName, err)
+	}
+	m.logEntity("CreateTable", "done")
+	return nil
+}
+
+// SetEnabled switches history mode on or off by creating or dropping the trigger that
+// appends passing records. Disabling keeps the rows already recorded.
+func (m *PassHistoryManager) SetEnabled(enabled bool) error {
+	stmts := []string{m.dialect.DropTrigger(passHistoryTrigger, tableName)}
+	if enabled {
+		stmts = m.dialect.CreateTrigger(passHistoryTrigger, tableName, "NEW.error_flag = 0", fmt.Sprintf(
+			`  INSERT INTO %[1]s (line_name, group_name, collected_timestamp, units)
+  VALUES (NEW.line_name, NEW.group_name, NEW.collected_timestamp, 1)
+  ON CONFLICT(line_name, group_name, collected_timestamp) DO UPDATE SET units = %[1]s.units + 1;`, m.TableName))
+	}
+	op := fmt.Sprintf("SetEnabled(%v)", enabled)
+	for _, q := range stmts {
+		if _, err := m.db.Exec(q); err != nil {
+			m.logEntity(op, "error")
+			return fmt.Errorf("set pass history mode: %w", err)
+		}
+	}
+	m.logEntity(op, "done")
+	return nil
+}
+
+// Compact deletes all but the newest slots passing seconds of every (line, group) and
+// returns the number of rows removed.
+func (m *PassHistoryManager) Compact(ctx context.Context, slots int) (int64, error) {
+	if slots <= 0 {
+		return 0, fmt.Errorf("compact %s: slots must be positive, got %d", m.TableName, slots)
+	}
+	q := fmt.Sprintf(`DELETE FROM %[1]s WHERE (line_name, group_name, collected_timestamp) IN (
+		SELECT line_name, group_name, collected_timestamp FROM (
+			SELECT line_name, group_name, collected_timestamp,
+				ROW_NUMBER() OVER (PARTITION BY line_name, group_name ORDER BY collected_timestamp DESC) AS n
+			FROM %[1]s
+		) ranked WHERE n > ?
+	)`, m.TableName)
+	res, err := m.db.ExecContext(ctx, q, slots)
+	if err != nil {
+		m.logEntity("Compact", "error")
+		return 0, fmt.Errorf("compact %s: %w", m.TableName, err)
+	}
+	n, _ := res.RowsAffected()
+	m.logEntity(fmt.Sprintf("Compact: %d rows", n), "done")
+	return n, nil
+}
+
+// PassInterval is the gap between two consecutive passing seconds of a (line, group);
+// Units passed at the later one.
+type PassInterval struct {
+	At      string  `json:"at"` // 'YYYY-MM-DD HH:MM:SS' UTC
+	Seconds float64 `json:"seconds"`
+	Units   int     `json:"units"`
+}
+
+// Intervals returns the inter-pass intervals of line/group whose later pass falls in r,
+// oldest first. The first pass of r is measured from the pass before it, when recorded.
+func (m *PassHistoryManager) Intervals(ctx context.Context, line, group string, r timeutil.TimeRange) ([]PassInterval, error) {
+	q := fmt.Sprintf(`SELECT collected_timestamp, seconds, units FROM (
+		SELECT collected_timestamp, units,
+			%s - %s AS seconds
+		FROM %s
+		WHERE line_name = ? AND group_name = ? AND collected_timestamp < ?
+	) gaps WHERE seconds IS NOT NULL AND collected_timestamp >= ?
+	ORDER BY collected_timestamp`, m.dialect.Epoch("collected_timestamp"),
+		m.dialect.Epoch("LAG(collected_timestamp) OVER (ORDER BY collected_timestamp)"), m.TableName)
+	rows, err := m.db.QueryContext(ctx, q, line, group, r.DBEnd(), r.DBStart())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s: %w", m.TableName, err)
+	}
+	defer rows.Close()
+
+	var out []PassInterval
+	for rows.Next() {
+		var iv PassInterval
+		if err := rows.Scan(&iv.At, &iv.Seconds, &iv.Units); err != nil {
+			return nil, fmt.Errorf("failed to scan %s: %w", m.TableName, err)
+		}
+		out = append(out, iv)
+	}
+	return out, rows.Err()
+}
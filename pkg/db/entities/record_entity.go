@@ -1,11 +1,17 @@
 package entities
 
 import (
+	"context"
 	"database/sql"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	skylogger "hex_toolset/pkg/logger"
+	"hex_toolset/pkg/timeutil"
 	"strings"
 	"time"
+
+	"github.com/google/uuid"
 )
 
 // RecordEntity represents a record in the records_table
@@ -21,6 +27,44 @@ type RecordEntity struct {
 	ModelName          string    `json:"model_name" database:"model_name"`
 	ErrorFlag          bool      `json:"error_flag" database:"error_flag"`
 	NextStation        string    `json:"next_station" database:"next_station"`
+	Enrichment
+}
+
+// Enrichment holds the registry and work order metadata denormalized into every record at
+// ingest (see EnrichmentManager), so dashboards filter and group by it without joins.
+// Empty fields mean no metadata was known for the record's line, station or work order.
+type Enrichment struct {
+	Area      string `json:"area,omitempty" database:"area"`
+	Process   string `json:"process,omitempty" database:"process"`
+	Customer  string `json:"customer,omitempty" database:"customer"`
+	TargetQty int    `json:"target_qty,omitempty" database:"target_qty"`
+}
+
+// enrichmentColumns are the records_table columns of Enrichment, added to tables created
+// before enrichment existed.
+var enrichmentColumns = []struct{ name, def string }{
+	{"area", "TEXT NOT NULL DEFAULT ''"},
+	{"process", "TEXT NOT NULL DEFAULT ''"},
+	{"customer", "TEXT NOT NULL DEFAULT ''"},
+	{"target_qty", "INTEGER NOT NULL DEFAULT 0"},
+}
+
+// recordIDNamespace scopes the name-based UUIDs of RecordID.
+var recordIDNamespace = uuid.NewSHA1(uuid.NameSpaceURL, []byte("hex_toolset/records_table"))
+
+// RecordID derives the ID of r from its logical key, the columns of the records_table
+// UNIQUE constraint, as a name-based (version 5) UUID. Reloading the same pass always
+// yields the same ID, so consumers can dedupe by ID and a repeated insert of a record
+// conflicts on the primary key exactly when it conflicts on the unique key.
+func RecordID(r RecordEntity) string {
+	key := strings.Join([]string{
+		r.PPID,
+		timeutil.FormatDB(r.CollectedTimestamp),
+		r.LineName,
+		r.StationName,
+		r.GroupName,
+	}, "\x1f")
+	return uuid.NewSHA1(recordIDNamespace, []byte(key)).String()
 }
 
 const (
@@ -38,9 +82,19 @@ const (
 type RecordEntityManager struct {
 	TableName string
 	db        *sql.DB
+	dialect   Dialect
 	logger    *skylogger.Logger
+	upsert    func() bool             // see SetUpsert
+	fault     func(step string) error // see SetReplaceFault
+	chunk     int                     // records per insert transaction, see SetInsertChunk
+	progress  func(done, total int)   // see SetInsertProgress
 }
 
+// DefaultInsertChunk is the number of records InsertBatchStats commits per transaction. A
+// chunk takes a few milliseconds on SQLite, which bounds how long a cancelled batch keeps
+// the connection (and a shutdown waiting on it).
+const DefaultInsertChunk = 500
+
 // NewRecordManagerEntity creates a new RecordEntityManager instance
 func NewRecordManagerEntity(db *sql.DB) *RecordEntityManager {
 	if db == nil {
@@ -53,7 +107,9 @@ func NewRecordManagerEntity(db *sql.DB) *RecordEntityManager {
 	return &RecordEntityManager{
 		TableName: tableName,
 		db:        db,
+		dialect:   DialectOf(db),
 		logger:    lgr,
+		chunk:     DefaultInsertChunk,
 	}
 }
 
@@ -63,6 +119,12 @@ func (rm *RecordEntityManager) CreateTable() error {
 		return fmt.Errorf("failed to create main table: %v", err)
 	}
 
+	for _, col := range enrichmentColumns {
+		if err := ensureColumn(rm.db, rm.TableName, col.name, col.def); err != nil {
+			return err
+		}
+	}
+
 	if err := rm.createIndexes(); err != nil {
 		return fmt.Errorf("failed to create indexes: %v", err)
 	}
@@ -74,6 +136,7 @@ func (rm *RecordEntityManager) CreateTable() error {
 }
 
 func (rm *RecordEntityManager) logEntity(operation, desc, status string) {
+	skylogger.Helper()
 	if rm.logger == nil {
 		return
 	}
@@ -107,7 +170,7 @@ func (rm *RecordEntityManager) buildCreateTableQuery() string {
 			id TEXT PRIMARY KEY,
 			ppid TEXT NOT NULL,
 			work_order TEXT NOT NULL,
-			collected_timestamp DATETIME NOT NULL,
+			collected_timestamp ` + rm.dialect.TimestampType() + ` NOT NULL,
 			employee_name TEXT,
 			group_name TEXT NOT NULL,
 			line_name TEXT NOT NULL CHECK(length(line_name) <= 3),
@@ -115,10 +178,14 @@ func (rm *RecordEntityManager) buildCreateTableQuery() string {
 			model_name TEXT NOT NULL,
 			error_flag INTEGER NOT NULL DEFAULT 0,
 			next_station TEXT,
+			area TEXT NOT NULL DEFAULT '',
+			process TEXT NOT NULL DEFAULT '',
+			customer TEXT NOT NULL DEFAULT '',
+			target_qty INTEGER NOT NULL DEFAULT 0,
 			
 			-- Composite unique constraint with conflict resolution
-			UNIQUE(ppid, collected_timestamp, line_name, station_name, group_name) ON CONFLICT IGNORE
-		) WITHOUT ROWID;`)
+			UNIQUE(ppid, collected_timestamp, line_name, station_name, group_name)` + rm.dialect.ConflictIgnore() + `
+		)` + rm.dialect.WithoutRowID() + `;`)
 
 	return builder.String()
 }
@@ -140,7 +207,7 @@ func (rm *RecordEntityManager) getIndexDefinitions() []IndexDefinition {
 		{
 			Name: idxDateRange,
 			Query: fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s 
-				ON %s (date(collected_timestamp), line_name)`, idxDateRange, rm.TableName),
+				ON %s (%s, line_name)`, idxDateRange, rm.TableName, rm.dialect.Date("collected_timestamp")),
 		},
 		{
 			Name: idxErrorFlag,
@@ -215,34 +282,26 @@ func (rm *RecordEntityManager) DropTable() error {
 
 // TableExists checks if the table exists
 func (rm *RecordEntityManager) TableExists() (bool, error) {
-	query := `SELECT name FROM sqlite_master WHERE type='table' AND name=?`
-
-	var name string
-	err := rm.db.QueryRow(query, rm.TableName).Scan(&name)
-
-	if err == sql.ErrNoRows {
-		return false, nil
-	}
+	var n int
+	err := rm.db.QueryRow(rm.dialect.TableExists(), rm.TableName).Scan(&n)
 	if err != nil {
 		return false, fmt.Errorf("failed to check table existence: %v", err)
 	}
 
-	return true, nil
+	return n > 0, nil
 }
 
 // GetTableInfo returns information about the table structure
 func (rm *RecordEntityManager) GetTableInfo() ([]map[string]interface{}, error) {
-	query := fmt.Sprintf(`PRAGMA table_info(%s)`, rm.TableName)
-
-	rows, err := rm.db.Query(query)
+	rows, err := rm.db.Query(rm.dialect.Columns(), rm.TableName)
 	if err != nil {
 		if rm.logger != nil {
-			rm.logEntity("getTableInfo", "PRAGMA table_info", "error")
+			rm.logEntity("getTableInfo", "table columns", "error")
 		}
 		return nil, fmt.Errorf("failed to get table info: %v", err)
 	}
 	if rm.logger != nil {
-		rm.logEntity("getTableInfo", "PRAGMA table_info", "done")
+		rm.logEntity("getTableInfo", "table columns", "done")
 	}
 	defer rows.Close()
 
@@ -274,32 +333,267 @@ func (rm *RecordEntityManager) GetTableInfo() ([]map[string]interface{}, error)
 	return tableInfo, nil
 }
 
-// InsertBatch inserts multiple records in a single transaction for better performance
+// SetUpsert installs a check, consulted once per batch, deciding whether inserts replace a
+// stored duplicate (same ppid, timestamp, line, station, group) instead of being ignored.
+func (rm *RecordEntityManager) SetUpsert(fn func() bool) { rm.upsert = fn }
+
+// SetInsertChunk sets the number of records InsertBatchStats commits per transaction; n <= 0
+// restores DefaultInsertChunk.
+func (rm *RecordEntityManager) SetInsertChunk(n int) {
+	if n <= 0 {
+		n = DefaultInsertChunk
+	}
+	rm.chunk = n
+}
+
+// SetInsertProgress installs a hook called by InsertBatchStats after each committed chunk
+// with the records written so far and the size of the batch.
+func (rm *RecordEntityManager) SetInsertProgress(fn func(done, total int)) { rm.progress = fn }
+
+// Steps of ReplaceHour, passed to the SetReplaceFault hook once each has run.
+const (
+	ReplaceStepDelete = "delete"
+	ReplaceStepInsert = "insert"
+)
+
+// SetReplaceFault installs a hook called by ReplaceHour after each step, inside the
+// transaction; a non-nil error aborts the replace as if the step had failed. It lets tests
+// and failure drills check that an interrupted replace leaves the hour untouched.
+func (rm *RecordEntityManager) SetReplaceFault(fn func(step string) error) { rm.fault = fn }
+
+// InsertBatch inserts records in chunked transactions (see InsertBatchStats).
 func (rm *RecordEntityManager) InsertBatch(records []RecordEntity) error {
+	return rm.InsertBatchContext(context.Background(), records)
+}
+
+// InsertBatchContext inserts records, stopping when ctx is done (see InsertBatchStats).
+func (rm *RecordEntityManager) InsertBatchContext(ctx context.Context, records []RecordEntity) error {
+	_, err := rm.InsertBatchStats(ctx, records)
+	return err
+}
+
+// InsertStats counts the outcome of one insert batch. Ignored rows already existed (same
+// logical key) and were dropped by the UNIQUE constraint; in upsert mode they are replaced
+// and counted as inserted.
+type InsertStats struct {
+	Inserted int
+	Ignored  int
+}
+
+// PartialInsertError is returned by InsertBatchStats when the batch stopped after some of
+// its chunks were committed.
+type PartialInsertError struct {
+	Committed InsertStats // rows of the committed chunks
+	Remaining int         // records not written
+	Err       error       // why the batch stopped, e.g. context.Canceled
+}
+
+func (e *PartialInsertError) Error() string {
+	return fmt.Sprintf("insert batch stopped with %d record(s) committed and %d not written: %v",
+		e.Committed.Inserted+e.Committed.Ignored, e.Remaining, e.Err)
+}
+
+func (e *PartialInsertError) Unwrap() error { return e.Err }
+
+// InsertBatchStats is InsertBatchContext returning how many rows were actually written.
+//
+// Records are committed in chunks of SetInsertChunk records, each in its own transaction,
+// and ctx is checked between chunks, so a cancelled batch returns within one chunk instead
+// of after the whole batch. A chunk that fails or is cancelled is rolled back; the chunks
+// committed before it stay, and the error is a *PartialInsertError wrapping the cause,
+// with the returned stats counting those chunks. Inserting the whole batch again is safe:
+// committed records are ignored as duplicates (or replaced, in upsert mode).
+func (rm *RecordEntityManager) InsertBatchStats(ctx context.Context, records []RecordEntity) (InsertStats, error) {
+	var stats InsertStats
 	if len(records) == 0 {
-		return nil
+		return stats, nil
+	}
+	verb := rm.insertVerb()
+	chunk := rm.chunk
+	if chunk <= 0 {
+		chunk = DefaultInsertChunk
 	}
 
-	// Start transaction for batch insert
-	tx, err := rm.db.Begin()
+	for done := 0; done < len(records); {
+		err := ctx.Err()
+		end := min(done+chunk, len(records))
+		if err == nil {
+			var cs InsertStats
+			if cs, err = rm.insertChunk(ctx, verb, records[done:end]); err == nil {
+				stats.Inserted += cs.Inserted
+				stats.Ignored += cs.Ignored
+				done = end
+				if rm.progress != nil {
+					rm.progress(done, len(records))
+				}
+				continue
+			}
+		}
+		if done == 0 {
+			return stats, err
+		}
+		if rm.logger != nil {
+			rm.logger.Warnf("insert batch stopped after %d of %d records: %v", done, len(records), err)
+		}
+		return stats, &PartialInsertError{Committed: stats, Remaining: len(records) - done, Err: err}
+	}
+
+	if rm.logger != nil {
+		rm.logger.Infof("entity operation \"%s\" \"%s\" \"%s\"", "RecordEntity", "InsertBatch", fmt.Sprintf("inserted %d records, ignored %d duplicates", stats.Inserted, stats.Ignored))
+	}
+	return stats, nil
+}
+
+// insertChunk inserts records in one transaction.
+func (rm *RecordEntityManager) insertChunk(ctx context.Context, verb Conflict, records []RecordEntity) (InsertStats, error) {
+	tx, err := rm.db.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %v", err)
+		return InsertStats{}, fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer tx.Rollback()
 
-	// Prepare the INSERT statement
-	query := fmt.Sprintf(`
-		INSERT INTO %s (
-			id, ppid, work_order, collected_timestamp, employee_name, 
-			group_name, line_name, station_name, model_name, error_flag, next_station
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, rm.TableName)
+	stats, err := rm.insertTx(ctx, tx, verb, records)
+	if err != nil {
+		return InsertStats{}, err
+	}
+	if err := rm.commit(tx, "insertBatch"); err != nil {
+		return InsertStats{}, err
+	}
+	return stats, nil
+}
+
+// ReplaceResult counts the outcome of a ReplaceHour. Ignored covers both the records
+// already stored (see InsertStats) and those collected outside the hour, which are left to
+// the replacement of their own hour.
+type ReplaceResult struct {
+	Deleted int
+	InsertStats
+}
+
+// ReplaceHour replaces the records collected in the hour starting at hourStart with
+// records, the one primitive behind every hour reload. The delete and the inserts run in
+// one transaction, each step under a savepoint: a failure at any point (context
+// cancelled, insert or commit error, injected fault) rolls the hour back to its stored state,
+// so a retried replace applies exactly once. Records of keepLines are neither deleted nor
+// expected in records.
+func (rm *RecordEntityManager) ReplaceHour(ctx context.Context, hourStart time.Time, records []RecordEntity, keepLines ...string) (ReplaceResult, error) {
+	var res ReplaceResult
+	hour := timeutil.Hour(hourStart)
+	verb := rm.insertVerb()
+
+	inHour := make([]RecordEntity, 0, len(records))
+	for _, r := range records {
+		if hour.Contains(r.CollectedTimestamp) {
+			inHour = append(inHour, r)
+		}
+	}
+	outside := len(records) - len(inHour)
+	if outside > 0 && rm.logger != nil {
+		rm.logger.Warnf("replace hour %s: ignoring %d record(s) collected outside the hour", hour, outside)
+	}
 
-	stmt, err := tx.Prepare(query)
+	tx, err := rm.db.BeginTx(ctx, nil)
+	if err != nil {
+		return res, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	err = rm.savepoint(ctx, tx, "replace_hour_delete", func() error {
+		query, args := rm.deleteRangeQuery(hour, keepLines)
+		r, err := tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return fmt.Errorf("failed to delete records in %s: %v", hour, err)
+		}
+		n, _ := r.RowsAffected()
+		res.Deleted = int(n)
+		return rm.injectFault(ReplaceStepDelete)
+	})
+	if err != nil {
+		rm.logEntity("replaceHour", "DELETE "+hour.String(), "error")
+		return ReplaceResult{}, err
+	}
+	if len(inHour) > 0 {
+		err = rm.savepoint(ctx, tx, "replace_hour_insert", func() (err error) {
+			if res.InsertStats, err = rm.insertTx(ctx, tx, verb, inHour); err != nil {
+				return err
+			}
+			return rm.injectFault(ReplaceStepInsert)
+		})
+		if err != nil {
+			rm.logEntity("replaceHour", "INSERT "+hour.String(), "error")
+			return ReplaceResult{}, err
+		}
+	}
+	if err := rm.commit(tx, "replaceHour"); err != nil {
+		return ReplaceResult{}, err
+	}
+	res.Ignored += outside
+
+	if rm.logger != nil {
+		rm.logger.Infof("entity operation \"%s\" \"%s\" \"%s\"", "RecordEntity", "ReplaceHour",
+			fmt.Sprintf("replaced %s: deleted %d, inserted %d, ignored %d", hour, res.Deleted, res.Inserted, res.Ignored))
+	}
+	return res, nil
+}
+
+func (rm *RecordEntityManager) injectFault(step string) error {
+	if rm.fault == nil {
+		return nil
+	}
+	if err := rm.fault(step); err != nil {
+		return fmt.Errorf("replace hour: %s: %w", step, err)
+	}
+	return nil
+}
+
+// savepoint runs step under the savepoint name of tx, rolling back to it when step fails
+// so the transaction is left as it was before the step.
+func (rm *RecordEntityManager) savepoint(ctx context.Context, tx *sql.Tx, name string, step func() error) error {
+	if _, err := tx.ExecContext(ctx, "SAVEPOINT "+name); err != nil {
+		return fmt.Errorf("savepoint %s: %v", name, err)
+	}
+	if err := step(); err != nil {
+		// The connection may already be unusable (e.g. ctx cancelled); the deferred
+		// rollback of the whole transaction still applies.
+		_, _ = tx.Exec("ROLLBACK TO " + name)
+		_, _ = tx.Exec("RELEASE " + name)
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "RELEASE "+name); err != nil {
+		return fmt.Errorf("release savepoint %s: %v", name, err)
+	}
+	return nil
+}
+
+// insertVerb returns the conflict handling of the next batch. Ignoring extends the table's
+// ON CONFLICT IGNORE to the primary key (a reloaded record has the same RecordID);
+// replacing overrides both. The upsert flag may query the DB, so it must be read before a
+// transaction takes the pool's only connection.
+func (rm *RecordEntityManager) insertVerb() Conflict {
+	if rm.upsert != nil && rm.upsert() {
+		return ConflictReplace
+	}
+	return ConflictIgnore
+}
+
+// recordColumns are the records_table columns in insert order.
+var recordColumns = []string{
+	"id", "ppid", "work_order", "collected_timestamp", "employee_name",
+	"group_name", "line_name", "station_name", "model_name", "error_flag", "next_station",
+	"area", "process", "customer", "target_qty",
+}
+
+// insertTx inserts records within tx.
+func (rm *RecordEntityManager) insertTx(ctx context.Context, tx *sql.Tx, verb Conflict, records []RecordEntity) (InsertStats, error) {
+	var stats InsertStats
+	query := rm.dialect.Insert(rm.TableName, recordColumns, []string{"id"}, verb)
+
+	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
 		if rm.logger != nil {
 			rm.logEntity("insertBatch", "PREPARE INSERT", "error")
 		}
-		return fmt.Errorf("failed to prepare statement: %v", err)
+		return stats, fmt.Errorf("failed to prepare statement: %v", err)
 	}
 	if rm.logger != nil {
 		rm.logEntity("insertBatch", "PREPARE INSERT", "done")
@@ -307,13 +601,15 @@ func (rm *RecordEntityManager) InsertBatch(records []RecordEntity) error {
 	defer stmt.Close()
 
 	// Execute batch insert
-	insertedCount := 0
 	for i, record := range records {
-		_, err := stmt.Exec(
+		if record.ID == "" {
+			record.ID = RecordID(record)
+		}
+		res, err := stmt.ExecContext(ctx,
 			record.ID,
 			record.PPID,
 			record.WorkOrder,
-			record.CollectedTimestamp.Format("2006-01-02 15:04:05"),
+			timeutil.FormatDB(record.CollectedTimestamp),
 			record.EmployeeName,
 			record.GroupName,
 			record.LineName,
@@ -321,62 +617,145 @@ func (rm *RecordEntityManager) InsertBatch(records []RecordEntity) error {
 			record.ModelName,
 			record.ErrorFlag,
 			record.NextStation,
+			record.Area,
+			record.Process,
+			record.Customer,
+			record.TargetQty,
 		)
 
 		if err != nil {
-			return fmt.Errorf("failed to insert record %d (ID: %s): %v", i+1, record.ID, err)
+			return stats, fmt.Errorf("failed to insert record %d (ID: %s): %w", i+1, record.ID, err)
+		}
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			stats.Ignored++
+		} else {
+			stats.Inserted++
 		}
-		insertedCount++
 	}
+	return stats, nil
+}
 
-	// Commit transaction
+func (rm *RecordEntityManager) commit(tx *sql.Tx, operation string) error {
 	if err := tx.Commit(); err != nil {
 		if rm.logger != nil {
-			rm.logEntity("insertBatch", "COMMIT", "error")
+			rm.logEntity(operation, "COMMIT", "error")
 		}
 		return fmt.Errorf("failed to commit transaction: %v", err)
 	}
 	if rm.logger != nil {
-		rm.logEntity("insertBatch", "COMMIT", "done")
-	}
-
-	if rm.logger != nil {
-		rm.logger.Infof("entity operation \"%s\" \"%s\" \"%s\"", "RecordEntity", "InsertBatch", fmt.Sprintf("inserted %d records", insertedCount))
+		rm.logEntity(operation, "COMMIT", "done")
 	}
 	return nil
 }
 
-func (rm *RecordEntityManager) DeleteRecordRange(start, end string) error {
-
-	query := fmt.Sprintf(`DELETE FROM %s WHERE collected_timestamp BETWEEN ? AND ?`, rm.TableName)
+// DeleteRange deletes the records collected in r (end exclusive), except those of
+// keepLines (lines whose reload is skipped, e.g. while under maintenance).
+func (rm *RecordEntityManager) DeleteRange(r timeutil.TimeRange, keepLines ...string) error {
+	query, args := rm.deleteRangeQuery(r, keepLines)
 
 	if rm.logger != nil {
-		rm.logEntity("deleteRange", fmt.Sprintf("DELETE BETWEEN %s AND %s", start, end), "start")
+		rm.logEntity("deleteRange", "DELETE "+r.String(), "start")
 	}
-	_, err := rm.db.Exec(query, start, end)
+	_, err := rm.db.Exec(query, args...)
 	if err != nil {
 		if rm.logger != nil {
-			rm.logEntity("deleteRange", fmt.Sprintf("DELETE BETWEEN %s AND %s", start, end), "error")
+			rm.logEntity("deleteRange", "DELETE "+r.String(), "error")
 		}
-		return fmt.Errorf("failed to delete records between %s and %s: %v", start, end, err)
+		return fmt.Errorf("failed to delete records in %s: %v", r, err)
 	}
 	if rm.logger != nil {
-		rm.logEntity("deleteRange", fmt.Sprintf("DELETE BETWEEN %s AND %s", start, end), "done")
+		rm.logEntity("deleteRange", "DELETE "+r.String(), "done")
 	}
 	return nil
 }
 
-func (rm *RecordEntityManager) GetLastHour() (map[string]int, error) {
-	// Calculate the previous full hour window: [start, end)
-	now := time.Now().In(time.Local)
+func (rm *RecordEntityManager) deleteRangeQuery(r timeutil.TimeRange, keepLines []string) (string, []any) {
+	query := fmt.Sprintf(`DELETE FROM %s WHERE collected_timestamp >= ? AND collected_timestamp < ?`, rm.TableName)
+	args := []any{r.DBStart(), r.DBEnd()}
+	if len(keepLines) > 0 {
+		query += ` AND line_name NOT IN (?` + strings.Repeat(", ?", len(keepLines)-1) + `)`
+		for _, l := range keepLines {
+			args = append(args, l)
+		}
+	}
+	return query, args
+}
 
-	start := time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), 0, 0, 0, time.Local)
-	end := start.Add(+1 * time.Hour)
+// DeleteBefore deletes up to limit records collected before cutoff, oldest first, in one
+// statement, and returns how many it deleted. Deleting a large range limit rows at a time,
+// until fewer come back, keeps each write transaction (and the ingest waiting on it) short.
+func (rm *RecordEntityManager) DeleteBefore(ctx context.Context, cutoff time.Time, limit int) (int64, error) {
+	res, err := rm.db.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %[1]s WHERE id IN (
+		SELECT id FROM %[1]s WHERE collected_timestamp < ? ORDER BY collected_timestamp LIMIT ?)`, rm.TableName),
+		timeutil.FormatDB(cutoff), limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete records before %s: %w", timeutil.FormatDB(cutoff), err)
+	}
+	return res.RowsAffected()
+}
 
-	startStr := start.Format("2006-01-02 15:04:05")
-	endStr := end.Format("2006-01-02 15:04:05")
+// RekeyIDs replaces the IDs of the records in r with their RecordID, for rows written when
+// IDs were random. It works one day per transaction and returns the number of rows changed.
+func (rm *RecordEntityManager) RekeyIDs(ctx context.Context, r timeutil.TimeRange) (int64, error) {
+	var changed int64
+	for _, d := range r.Days() {
+		day := timeutil.Day(d)
+		if day.Start.Before(r.Start) {
+			day.Start = r.Start
+		}
+		if day.End.After(r.End) {
+			day.End = r.End
+		}
+		type rekey struct{ from, to string }
+		var pending []rekey
+		err := rm.ForEachIn(ctx, day, func(rec RecordEntity) error {
+			if id := RecordID(rec); id != rec.ID {
+				pending = append(pending, rekey{rec.ID, id})
+			}
+			return nil
+		})
+		if err != nil {
+			return changed, err
+		}
+		if len(pending) == 0 {
+			continue
+		}
 
-	fmt.Println(startStr, endStr)
+		tx, err := rm.db.BeginTx(ctx, nil)
+		if err != nil {
+			return changed, err
+		}
+		stmt, err := tx.PrepareContext(ctx, fmt.Sprintf(`UPDATE %s SET id = ? WHERE id = ?`, rm.TableName))
+		if err != nil {
+			_ = tx.Rollback()
+			return changed, err
+		}
+		for _, p := range pending {
+			if _, err := stmt.ExecContext(ctx, p.to, p.from); err != nil {
+				_ = stmt.Close()
+				_ = tx.Rollback()
+				return changed, fmt.Errorf("rekey record %s: %v", p.from, err)
+			}
+		}
+		_ = stmt.Close()
+		if err := tx.Commit(); err != nil {
+			return changed, err
+		}
+		changed += int64(len(pending))
+		rm.logEntity("RekeyIDs", fmt.Sprintf("%s rekeyed %d", day, len(pending)), "done")
+	}
+	return changed, nil
+}
+
+func (rm *RecordEntityManager) GetLastHour() (map[string]int, error) {
+	return rm.GetLastHourContext(context.Background())
+}
+
+// GetLastHourContext is GetLastHour bounded by ctx.
+func (rm *RecordEntityManager) GetLastHourContext(ctx context.Context) (map[string]int, error) {
+	// Current clock hour window: [start, end)
+	hour := timeutil.Hour(time.Now().In(time.Local))
+	startStr, endStr := hour.DBStart(), hour.DBEnd()
 
 	// Aggregation query
 	query := fmt.Sprintf(`
@@ -395,7 +774,7 @@ func (rm *RecordEntityManager) GetLastHour() (map[string]int, error) {
 		rm.logEntity("GetLastHour", fmt.Sprintf("window %s to %s", startStr, endStr), "start")
 	}
 
-	rows, err := rm.db.Query(query, startStr, endStr)
+	rows, err := rm.db.QueryContext(ctx, query, startStr, endStr)
 	if err != nil {
 		if rm.logger != nil {
 			rm.logEntity("GetLastHour", "query execution", "error")
@@ -423,3 +802,390 @@ func (rm *RecordEntityManager) GetLastHour() (map[string]int, error) {
 
 	return result, nil
 }
+
+// LineGroupCount is the number of passing and failing records for one (line, group).
+type LineGroupCount struct {
+	LineName  string `json:"line_name"`
+	GroupName string `json:"group_name"`
+	Units     int    `json:"units"`
+	FailUnits int    `json:"fail_units"`
+}
+
+// CountByLineGroup aggregates records in [start, end) per (line, group).
+// start/end use 'YYYY-MM-DD HH:MM:SS'. Units counts error_flag = 0, FailUnits error_flag = 1.
+func (rm *RecordEntityManager) CountByLineGroup(start, end string) ([]LineGroupCount, error) {
+	query := fmt.Sprintf(`
+		SELECT line_name, group_name,
+			SUM(CASE WHEN error_flag = 0 THEN 1 ELSE 0 END) AS units,
+			SUM(CASE WHEN error_flag = 1 THEN 1 ELSE 0 END) AS fail_units
+		FROM %s
+		WHERE collected_timestamp >= ?
+		  AND collected_timestamp < ?
+		GROUP BY line_name, group_name
+		ORDER BY line_name, group_name
+	`, rm.TableName)
+
+	rows, err := rm.db.Query(query, start, end)
+	if err != nil {
+		if rm.logger != nil {
+			rm.logEntity("CountByLineGroup", fmt.Sprintf("window %s to %s", start, end), "error")
+		}
+		return nil, fmt.Errorf("failed to execute line/group count query: %v", err)
+	}
+	defer rows.Close()
+
+	var result []LineGroupCount
+	for rows.Next() {
+		var c LineGroupCount
+		if err := rows.Scan(&c.LineName, &c.GroupName, &c.Units, &c.FailUnits); err != nil {
+			return nil, fmt.Errorf("failed to scan line/group count: %v", err)
+		}
+		result = append(result, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %v", err)
+	}
+	return result, nil
+}
+
+// HourlyCounts returns the number of records collected in r per hour, keyed by the UTC
+// start of the hour; hours without records are absent.
+func (rm *RecordEntityManager) HourlyCounts(ctx context.Context, r timeutil.TimeRange) (map[time.Time]int64, error) {
+	q := fmt.Sprintf(`SELECT substr(%s, 1, 13) AS hour, COUNT(*)
+FROM %s WHERE collected_timestamp >= ? AND collected_timestamp < ?
+GROUP BY hour`, rm.dialect.Timestamp("collected_timestamp"), rm.TableName)
+	rows, err := rm.db.QueryContext(ctx, q, r.DBStart(), r.DBEnd())
+	if err != nil {
+		return nil, fmt.Errorf("hourly counts in %s: %w", r, err)
+	}
+	defer rows.Close()
+
+	out := make(map[time.Time]int64)
+	for rows.Next() {
+		var hour string
+		var n int64
+		if err := rows.Scan(&hour, &n); err != nil {
+			return nil, fmt.Errorf("hourly counts in %s: %w", r, err)
+		}
+		t, err := time.ParseInLocation(timeutil.HourLayout, hour, time.UTC)
+		if err != nil {
+			return nil, fmt.Errorf("hourly counts in %s: %w", r, err)
+		}
+		out[t] = n
+	}
+	return out, rows.Err()
+}
+
+// ForEachInRange streams records with start < collected_timestamp <= end, oldest first,
+// calling fn for each one without loading the range into memory: rows are read in
+// keyset-paginated pages of streamPageSize. start/end use 'YYYY-MM-DD HH:MM:SS' in UTC
+// (timeutil.FormatDB); an empty start means from the beginning of the table.
+func (rm *RecordEntityManager) ForEachInRange(ctx context.Context, start, end string, fn func(RecordEntity) error) error {
+	return rm.forEach(ctx, "collected_timestamp > ? AND collected_timestamp <= ?", start, end, fn)
+}
+
+// ForEachIn is ForEachInRange over the half-open range r.
+func (rm *RecordEntityManager) ForEachIn(ctx context.Context, r timeutil.TimeRange, fn func(RecordEntity) error) error {
+	return rm.forEach(ctx, "collected_timestamp >= ? AND collected_timestamp < ?", r.DBStart(), r.DBEnd(), fn)
+}
+
+func (rm *RecordEntityManager) forEach(ctx context.Context, where, start, end string, fn func(RecordEntity) error) error {
+	var after recordCursor
+	for {
+		page, err := rm.queryPage(ctx, where, []any{start, end}, after, streamPageSize)
+		if err != nil {
+			if rm.logger != nil {
+				rm.logEntity("ForEachInRange", fmt.Sprintf("window %s to %s", start, end), "error")
+			}
+			return err
+		}
+		for _, r := range page {
+			if err := fn(r); err != nil {
+				return err
+			}
+		}
+		if len(page) < streamPageSize {
+			return nil
+		}
+		after = cursorOf(page[len(page)-1])
+	}
+}
+
+// streamPageSize is the number of rows ForEachIn/ForEachInRange read per query. Between
+// pages the pool's connection is free, so a long export does not hold up live ingest.
+const streamPageSize = 2000
+
+// MaxPageSize bounds the limit of PageIn.
+const MaxPageSize = 10000
+
+// ErrInvalidCursor is returned by PageIn for a cursor it did not issue.
+var ErrInvalidCursor = errors.New("invalid page cursor")
+
+// RecordPage is one page of records. Next is the cursor of the following page, empty on the
+// last one.
+type RecordPage struct {
+	Records []RecordEntity `json:"records"`
+	Next    string         `json:"next,omitempty"`
+}
+
+// PageIn returns up to limit records of r, ordered by (collected_timestamp, id), starting
+// after cursor ("" for the first page). Pages are keyset-based: each query seeks to the
+// cursor instead of skipping rows, so deep pages cost the same as the first, and records
+// inserted behind the cursor do not shift later pages.
+func (rm *RecordEntityManager) PageIn(ctx context.Context, r timeutil.TimeRange, cursor string, limit int) (RecordPage, error) {
+	var page RecordPage
+	after, err := parseCursor(cursor)
+	if err != nil {
+		return page, err
+	}
+	if limit <= 0 || limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+	// One extra row tells whether a next page exists.
+	recs, err := rm.queryPage(ctx, "collected_timestamp >= ? AND collected_timestamp < ?",
+		[]any{r.DBStart(), r.DBEnd()}, after, limit+1)
+	if err != nil {
+		return page, err
+	}
+	if len(recs) > limit {
+		recs = recs[:limit]
+		page.Next = cursorOf(recs[limit-1]).String()
+	}
+	page.Records = recs
+	if page.Records == nil {
+		page.Records = []RecordEntity{}
+	}
+	return page, nil
+}
+
+// queryPage reads up to limit records matching where (with args), after the cursor.
+func (rm *RecordEntityManager) queryPage(ctx context.Context, where string, args []any, after recordCursor, limit int) ([]RecordEntity, error) {
+	if !after.isZero() {
+		where += " AND (collected_timestamp > ? OR (collected_timestamp = ? AND id > ?))"
+		args = append(args, after.ts, after.ts, after.id)
+	}
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM %s
+		WHERE %s
+		ORDER BY collected_timestamp, id
+		LIMIT ?`, RecordSelectColumns(rm.dialect), rm.TableName, where)
+
+	rows, err := rm.db.QueryContext(ctx, query, append(args, limit)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute range query: %v", err)
+	}
+	defer rows.Close()
+
+	var page []RecordEntity
+	for rows.Next() {
+		r, err := ScanRecord(rows)
+		if err != nil {
+			return nil, err
+		}
+		page = append(page, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %v", err)
+	}
+	return page, nil
+}
+
+// PageCursor returns the cursor of a page ending at r, for pages assembled outside PageIn.
+func PageCursor(r RecordEntity) string { return cursorOf(r).String() }
+
+// RecordsAfter returns a filter keeping the records that sort after cursor in PageIn order
+// (every record for ""), or ErrInvalidCursor.
+func RecordsAfter(cursor string) (func(RecordEntity) bool, error) {
+	after, err := parseCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+	return func(r RecordEntity) bool {
+		c := cursorOf(r)
+		return after.isZero() || c.ts > after.ts || (c.ts == after.ts && c.id > after.id)
+	}, nil
+}
+
+// recordCursor is the sort key of the last record of a page.
+type recordCursor struct{ ts, id string }
+
+func cursorOf(r RecordEntity) recordCursor {
+	return recordCursor{ts: timeutil.FormatDB(r.CollectedTimestamp), id: r.ID}
+}
+
+func (c recordCursor) isZero() bool { return c.ts == "" && c.id == "" }
+
+// String encodes the cursor as an opaque URL-safe token.
+func (c recordCursor) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(c.ts + "|" + c.id))
+}
+
+func parseCursor(s string) (recordCursor, error) {
+	if s == "" {
+		return recordCursor{}, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return recordCursor{}, ErrInvalidCursor
+	}
+	ts, id, ok := strings.Cut(string(b), "|")
+	if !ok || ts == "" {
+		return recordCursor{}, ErrInvalidCursor
+	}
+	if _, err := time.Parse(timeutil.DBLayout, ts); err != nil {
+		return recordCursor{}, ErrInvalidCursor
+	}
+	return recordCursor{ts: ts, id: id}, nil
+}
+
+// StationTransition is one move of a unit between consecutive stations of a line.
+type StationTransition struct {
+	From    string  // station_name the unit left
+	To      string  // station_name of the unit's next record
+	Seconds float64 // time between the two records (whole seconds)
+}
+
+// ForEachTransition streams the consecutive-record transitions of every unit (ppid) of line
+// within r, calling fn for each. Only records inside r take part, so a unit's first move
+// into the range and last move out of it are not reported.
+func (rm *RecordEntityManager) ForEachTransition(ctx context.Context, line string, r timeutil.TimeRange, fn func(StationTransition) error) error {
+	query := fmt.Sprintf(`
+		SELECT station_name, to_station, %s - %s
+		FROM (
+			SELECT station_name, collected_timestamp,
+				LEAD(station_name) OVER w AS to_station,
+				LEAD(collected_timestamp) OVER w AS to_ts
+			FROM %s
+			WHERE line_name = ? AND collected_timestamp >= ? AND collected_timestamp < ?
+			WINDOW w AS (PARTITION BY ppid ORDER BY collected_timestamp)
+		) moves
+		WHERE to_station IS NOT NULL`, rm.dialect.Epoch("to_ts"), rm.dialect.Epoch("collected_timestamp"), rm.TableName)
+
+	rows, err := rm.db.QueryContext(ctx, query, line, r.DBStart(), r.DBEnd())
+	if err != nil {
+		rm.logEntity("ForEachTransition", line+" "+r.String(), "error")
+		return fmt.Errorf("failed to query transitions: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t StationTransition
+		if err := rows.Scan(&t.From, &t.To, &t.Seconds); err != nil {
+			return fmt.Errorf("failed to scan transition: %v", err)
+		}
+		if err := fn(t); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// StationCount is the number of units recorded at one station of a line.
+type StationCount struct {
+	StationName string `json:"station_name"`
+	GroupName   string `json:"group_name"`
+	Units       int    `json:"units"`
+	FailUnits   int    `json:"fail_units"`
+}
+
+// CountByStation aggregates the records of line in r per station.
+func (rm *RecordEntityManager) CountByStation(ctx context.Context, line string, r timeutil.TimeRange) ([]StationCount, error) {
+	query := fmt.Sprintf(`
+		SELECT station_name, MIN(group_name),
+			SUM(CASE WHEN error_flag = 0 THEN 1 ELSE 0 END),
+			SUM(CASE WHEN error_flag = 1 THEN 1 ELSE 0 END)
+		FROM %s
+		WHERE line_name = ? AND collected_timestamp >= ? AND collected_timestamp < ?
+		GROUP BY station_name
+		ORDER BY station_name`, rm.TableName)
+
+	rows, err := rm.db.QueryContext(ctx, query, line, r.DBStart(), r.DBEnd())
+	if err != nil {
+		return nil, fmt.Errorf("failed to count by station: %v", err)
+	}
+	defer rows.Close()
+
+	var out []StationCount
+	for rows.Next() {
+		var c StationCount
+		if err := rows.Scan(&c.StationName, &c.GroupName, &c.Units, &c.FailUnits); err != nil {
+			return nil, fmt.Errorf("failed to scan station count: %v", err)
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// LineFirstPass counts the units tested on one line and those passing their first test.
+// A unit counts once per station it was tested at, so retests at the same station do not
+// raise the yield.
+type LineFirstPass struct {
+	LineName  string `json:"line_name"`
+	Units     int    `json:"units"`
+	FirstPass int    `json:"first_pass"`
+}
+
+// FirstPassByLine counts, per line, the units tested in r and how many passed their first
+// test at each station, the base of the first pass yield.
+func (rm *RecordEntityManager) FirstPassByLine(ctx context.Context, r timeutil.TimeRange) ([]LineFirstPass, error) {
+	query := fmt.Sprintf(`
+		SELECT line_name, COUNT(*), SUM(CASE WHEN error_flag = 0 THEN 1 ELSE 0 END)
+		FROM (
+			SELECT line_name, error_flag, ROW_NUMBER() OVER (
+				PARTITION BY line_name, station_name, ppid ORDER BY collected_timestamp) AS n
+			FROM %s
+			WHERE collected_timestamp >= ? AND collected_timestamp < ?
+		) tests
+		WHERE n = 1
+		GROUP BY line_name
+		ORDER BY line_name`, rm.TableName)
+
+	rows, err := rm.db.QueryContext(ctx, query, r.DBStart(), r.DBEnd())
+	if err != nil {
+		return nil, fmt.Errorf("failed to count first passes: %v", err)
+	}
+	defer rows.Close()
+
+	var out []LineFirstPass
+	for rows.Next() {
+		var c LineFirstPass
+		if err := rows.Scan(&c.LineName, &c.Units, &c.FirstPass); err != nil {
+			return nil, fmt.Errorf("failed to scan first pass count: %v", err)
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// RecordSelectColumns selects records_table columns in the order ScanRecord expects, with
+// collected_timestamp formatted as 'YYYY-MM-DD HH:MM:SS' in dialect d; consumer code and
+// ad hoc tools should use both instead of scanning columns into plain strings themselves.
+func RecordSelectColumns(d Dialect) string {
+	return `id, ppid, work_order, ` + d.Timestamp("collected_timestamp") + `,
+	employee_name, group_name, line_name, station_name, model_name, error_flag, next_station,
+	area, process, customer, target_qty`
+}
+
+// RowScanner is implemented by *sql.Row and *sql.Rows.
+type RowScanner interface {
+	Scan(dest ...any) error
+}
+
+// ScanRecord scans one row selected with RecordSelectColumns. The nullable columns
+// (employee_name, next_station, rows written by older tools or by hand) read as "".
+func ScanRecord(sc RowScanner) (RecordEntity, error) {
+	var r RecordEntity
+	var ts string
+	var employee, next sql.NullString
+	if err := sc.Scan(&r.ID, &r.PPID, &r.WorkOrder, &ts, &employee,
+		&r.GroupName, &r.LineName, &r.StationName, &r.ModelName, &r.ErrorFlag, &next,
+		&r.Area, &r.Process, &r.Customer, &r.TargetQty); err != nil {
+		return r, fmt.Errorf("failed to scan record: %v", err)
+	}
+	r.EmployeeName, r.NextStation = employee.String, next.String
+	if t, err := timeutil.ParseDB(ts); err == nil {
+		r.CollectedTimestamp = t
+	}
+	return r, nil
+}
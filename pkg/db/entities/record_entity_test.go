@@ -0,0 +1,107 @@
+package entities
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"hex_toolset/pkg/timeutil"
+)
+
+func TestRecordID(t *testing.T) {
+	r := RecordEntity{PPID: "U1", WorkOrder: "MO1", LineName: "J01", GroupName: "TEST", StationName: "ST01",
+		ModelName: "M", CollectedTimestamp: base}
+	id := RecordID(r)
+	if _, err := uuid.Parse(id); err != nil {
+		t.Fatalf("RecordID %q: %v", id, err)
+	}
+
+	// Fields outside the logical key, as a reload may correct them, keep the ID.
+	reloaded := r
+	reloaded.WorkOrder, reloaded.EmployeeName, reloaded.ErrorFlag, reloaded.NextStation = "MO2", "E1", true, "ST02"
+	reloaded.CollectedTimestamp = base.Add(400 * time.Millisecond) // stored to the second
+	if got := RecordID(reloaded); got != id {
+		t.Errorf("reloaded record got ID %s, want %s", got, id)
+	}
+
+	// Each key column changes it.
+	for name, change := range map[string]func(*RecordEntity){
+		"ppid":      func(r *RecordEntity) { r.PPID = "U2" },
+		"timestamp": func(r *RecordEntity) { r.CollectedTimestamp = base.Add(time.Second) },
+		"line":      func(r *RecordEntity) { r.LineName = "J02" },
+		"station":   func(r *RecordEntity) { r.StationName = "ST02" },
+		"group":     func(r *RecordEntity) { r.GroupName = "PACKING" },
+	} {
+		other := r
+		change(&other)
+		if RecordID(other) == id {
+			t.Errorf("%s change kept ID %s", name, id)
+		}
+	}
+	// The separator keeps adjacent columns from running into each other.
+	shifted := r
+	shifted.LineName, shifted.StationName = "J01ST", "01"
+	if RecordID(shifted) == id {
+		t.Error("line/station boundary shift kept the ID")
+	}
+}
+
+func TestRecordIDReload(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	rm := NewRecordManagerEntity(db)
+	hour := []RecordEntity{
+		{PPID: "U1", WorkOrder: "MO1", LineName: "J01", GroupName: "TEST", StationName: "ST01", ModelName: "M", CollectedTimestamp: base},
+		{PPID: "U2", WorkOrder: "MO1", LineName: "J01", GroupName: "TEST", StationName: "ST01", ModelName: "M", CollectedTimestamp: base.Add(time.Minute)},
+	}
+	if stats, err := rm.InsertBatchStats(ctx, hour); err != nil || stats.Inserted != 2 {
+		t.Fatalf("first load = %+v, %v", stats, err)
+	}
+	if stats, err := rm.InsertBatchStats(ctx, hour); err != nil || stats.Inserted != 0 || stats.Ignored != 2 {
+		t.Fatalf("reload = %+v, %v", stats, err)
+	}
+	if n := countRows(t, db, "records_table", "id IN (?, ?)", RecordID(hour[0]), RecordID(hour[1])); n != 2 {
+		t.Errorf("%d rows keyed by RecordID, want 2", n)
+	}
+}
+
+func TestRekeyIDs(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	rm := NewRecordManagerEntity(db)
+
+	// A day written with random IDs, another already keyed, and a random-ID record just
+	// past the range to rekey.
+	var recs []RecordEntity
+	for i, at := range []time.Time{base, base.Add(time.Hour), base.Add(24 * time.Hour), base.Add(48 * time.Hour)} {
+		r := RecordEntity{PPID: fmt.Sprintf("U%d", i+1), WorkOrder: "MO1", LineName: "J01", GroupName: "TEST",
+			StationName: "ST01", ModelName: "M", CollectedTimestamp: at}
+		if i != 2 {
+			r.ID = uuid.NewString()
+		}
+		recs = append(recs, r)
+	}
+	if err := rm.InsertBatch(recs); err != nil {
+		t.Fatal(err)
+	}
+
+	r := timeutil.TimeRange{Start: timeutil.Day(base).Start, End: timeutil.Day(base).Start.AddDate(0, 0, 2)}
+	if n, err := rm.RekeyIDs(ctx, r); err != nil || n != 2 {
+		t.Fatalf("RekeyIDs = %d, %v, want 2", n, err)
+	}
+	for i, rec := range recs {
+		rekeyed := countRows(t, db, "records_table", "id = ?", RecordID(rec)) == 1
+		if want := i < 3; rekeyed != want {
+			t.Errorf("record %d keyed by RecordID: %v, want %v", i, rekeyed, want)
+		}
+	}
+	if n, err := rm.RekeyIDs(ctx, r); err != nil || n != 0 {
+		t.Errorf("second RekeyIDs = %d, %v, want 0", n, err)
+	}
+	if n := countRows(t, db, "records_table", "1 = 1"); n != len(recs) {
+		t.Errorf("%d records after rekeying, want %d", n, len(recs))
+	}
+}
@@ -0,0 +1,217 @@
+package entities
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	skylogger "hex_toolset/pkg/logger"
+	"hex_toolset/pkg/timeutil"
+	"time"
+)
+
+// ArchivedDay is one day whose raw records were moved out of records_table into an
+// archive file, leaving only its hourly rollup in the database.
+type ArchivedDay struct {
+	Day        string `json:"day" database:"day"` // 'YYYY-MM-DD'
+	Path       string `json:"path" database:"path"`
+	Records    int64  `json:"records" database:"records"`
+	ArchivedAt string `json:"archived_at" database:"archived_at"`
+}
+
+const (
+	recordRollupTable  = "record_rollup"
+	recordArchiveTable = "record_archive"
+)
+
+// RollupManager manages record_rollup, the hourly per (line, group, station) counts that
+// answer queries once raw records are archived, and record_archive, the archived days.
+type RollupManager struct {
+	db      *sql.DB
+	dialect Dialect
+	logger  *skylogger.Logger
+}
+
+// NewRollupManager creates a new manager
+func NewRollupManager(db *sql.DB) *RollupManager {
+	if db == nil {
+		panic("database connection cannot be nil")
+	}
+	lgr, _ := skylogger.New(
+		skylogger.WithName("entities"),
+		skylogger.WithFilePattern("{name}.log"),
+	)
+	return &RollupManager{db: db, dialect: DialectOf(db), logger: lgr}
+}
+
+func (m *RollupManager) logEntity(operation, desc, status string) {
+	skylogger.Helper()
+	if m.logger != nil {
+		m.logger.Infof(`entity operation "%s" "%s" "%s"`, "RecordRollup", operation+": "+desc, status)
+	}
+}
+
+// CreateTable creates record_rollup and record_archive.
+func (m *RollupManager) CreateTable() error {
+	m.logEntity("CreateTable", recordRollupTable+"+"+recordArchiveTable, "start")
+	stmts := []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+  hour TEXT NOT NULL,             -- 'YYYY-MM-DD HH:00:00'
+  line_name TEXT NOT NULL,
+  group_name TEXT NOT NULL,
+  station_name TEXT NOT NULL,
+  units INTEGER NOT NULL,
+  fail_units INTEGER NOT NULL,
+  PRIMARY KEY (hour, line_name, group_name, station_name)
+)%s;`, recordRollupTable, m.dialect.WithoutRowID()),
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+  day TEXT PRIMARY KEY,           -- 'YYYY-MM-DD'
+  path TEXT NOT NULL,
+  records INTEGER NOT NULL,
+  archived_at TEXT NOT NULL
+)%s;`, recordArchiveTable, m.dialect.WithoutRowID()),
+	}
+	for _, q := range stmts {
+		if _, err := m.db.Exec(q); err != nil {
+			m.logEntity("CreateTable", recordRollupTable+"+"+recordArchiveTable, "error")
+			return fmt.Errorf("create rollup tables: %w", err)
+		}
+	}
+	m.logEntity("CreateTable", recordRollupTable+"+"+recordArchiveTable, "done")
+	return nil
+}
+
+// RollUp (re)computes the hourly rollup of the raw records in r, which must be whole hours.
+// It returns the number of rollup rows written.
+func (m *RollupManager) RollUp(ctx context.Context, r timeutil.TimeRange) (int64, error) {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE hour >= ? AND hour < ?`, recordRollupTable),
+		r.DBStart(), r.DBEnd()); err != nil {
+		return 0, fmt.Errorf("clear rollup %s: %w", r, err)
+	}
+	res, err := tx.ExecContext(ctx, fmt.Sprintf(`
+		INSERT INTO %s (hour, line_name, group_name, station_name, units, fail_units)
+		SELECT substr(%s, 1, 13) || ':00:00', line_name, group_name, station_name,
+			SUM(CASE WHEN error_flag = 0 THEN 1 ELSE 0 END),
+			SUM(CASE WHEN error_flag = 1 THEN 1 ELSE 0 END)
+		FROM %s
+		WHERE collected_timestamp >= ? AND collected_timestamp < ?
+		GROUP BY 1, line_name, group_name, station_name`, recordRollupTable, m.dialect.Timestamp("collected_timestamp"), tableName),
+		r.DBStart(), r.DBEnd())
+	if err != nil {
+		m.logEntity("RollUp", r.String(), "error")
+		return 0, fmt.Errorf("roll up %s: %w", r, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	n, _ := res.RowsAffected()
+	m.logEntity("RollUp", fmt.Sprintf("%s rows=%d", r, n), "done")
+	return n, nil
+}
+
+// CountByLineGroup aggregates the rollup over the hours starting in r, like
+// RecordEntityManager.CountByLineGroup does over raw records.
+func (m *RollupManager) CountByLineGroup(ctx context.Context, r timeutil.TimeRange) ([]LineGroupCount, error) {
+	rows, err := m.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT line_name, group_name, SUM(units), SUM(fail_units)
+		FROM %s
+		WHERE hour >= ? AND hour < ?
+		GROUP BY line_name, group_name
+		ORDER BY line_name, group_name`, recordRollupTable), r.DBStart(), r.DBEnd())
+	if err != nil {
+		return nil, fmt.Errorf("rollup count query: %w", err)
+	}
+	defer rows.Close()
+	var out []LineGroupCount
+	for rows.Next() {
+		var c LineGroupCount
+		if err := rows.Scan(&c.LineName, &c.GroupName, &c.Units, &c.FailUnits); err != nil {
+			return nil, fmt.Errorf("scan rollup count: %w", err)
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// MarkArchived records that the raw records of day are in path and deletes them from
+// records_table, in one transaction.
+func (m *RollupManager) MarkArchived(ctx context.Context, day timeutil.TimeRange, path string, records int64) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	_, err = tx.ExecContext(ctx, m.dialect.Insert(recordArchiveTable, []string{"day", "path", "records", "archived_at"}, []string{"day"}, ConflictReplace),
+		day.Start.Format(timeutil.DayLayout), path, records, time.Now().Format(timeutil.DBLayout))
+	if err != nil {
+		return fmt.Errorf("record archive of %s: %w", day.Start.Format(timeutil.DayLayout), err)
+	}
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE collected_timestamp >= ? AND collected_timestamp < ?`, tableName),
+		day.DBStart(), day.DBEnd()); err != nil {
+		return fmt.Errorf("delete archived records of %s: %w", day.Start.Format(timeutil.DayLayout), err)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	m.logEntity("MarkArchived", fmt.Sprintf("%s records=%d path=%s", day.Start.Format(timeutil.DayLayout), records, path), "done")
+	return nil
+}
+
+// Archived returns the archived days overlapping r, oldest first.
+func (m *RollupManager) Archived(ctx context.Context, r timeutil.TimeRange) ([]ArchivedDay, error) {
+	first := r.Start.Format(timeutil.DayLayout)
+	last := r.End.Add(-time.Nanosecond).Format(timeutil.DayLayout)
+	rows, err := m.db.QueryContext(ctx, fmt.Sprintf(`SELECT day, path, records, archived_at FROM %s
+		WHERE day >= ? AND day <= ? ORDER BY day`, recordArchiveTable), first, last)
+	if err != nil {
+		return nil, fmt.Errorf("list archived days: %w", err)
+	}
+	defer rows.Close()
+	var out []ArchivedDay
+	for rows.Next() {
+		var a ArchivedDay
+		if err := rows.Scan(&a.Day, &a.Path, &a.Records, &a.ArchivedAt); err != nil {
+			return nil, fmt.Errorf("scan archived day: %w", err)
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+// ArchivedUntil returns the end of the most recent archived day, or the zero time when
+// nothing was archived. Raw records before it live only in archive files.
+func (m *RollupManager) ArchivedUntil(ctx context.Context) (time.Time, error) {
+	var day sql.NullString
+	err := m.db.QueryRowContext(ctx, fmt.Sprintf(`SELECT MAX(day) FROM %s`, recordArchiveTable)).Scan(&day)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, fmt.Errorf("archive watermark: %w", err)
+	}
+	if !day.Valid {
+		return time.Time{}, nil
+	}
+	d, err := timeutil.ParseDay(day.String, time.Local)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return d.End, nil
+}
+
+// OldestRaw returns the collected_timestamp of the oldest raw record, or the zero time.
+func (m *RollupManager) OldestRaw(ctx context.Context) (time.Time, error) {
+	var ts sql.NullString
+	err := m.db.QueryRowContext(ctx, fmt.Sprintf(`SELECT %s FROM %s`, m.dialect.Timestamp("MIN(collected_timestamp)"), tableName)).Scan(&ts)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("oldest raw record: %w", err)
+	}
+	if !ts.Valid {
+		return time.Time{}, nil
+	}
+	return timeutil.ParseDB(ts.String)
+}
@@ -0,0 +1,269 @@
+package entities
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	skylogger "hex_toolset/pkg/logger"
+	"strings"
+	"time"
+)
+
+// RenameKind is the kind of upstream name being renamed.
+type RenameKind string
+
+const (
+	RenameGroup   RenameKind = "group"
+	RenameStation RenameKind = "station"
+)
+
+// NameAlias maps a name used before an upstream rename to the current one.
+// LineName is empty when the rename applies to every line.
+type NameAlias struct {
+	Kind      RenameKind `json:"kind" database:"kind"`
+	LineName  string     `json:"line_name" database:"line_name"`
+	OldName   string     `json:"old_name" database:"old_name"`
+	NewName   string     `json:"new_name" database:"new_name"`
+	RenamedAt string     `json:"renamed_at" database:"renamed_at"`
+}
+
+// RenameResult counts the rows rewritten by a rename.
+type RenameResult struct {
+	Records     int64 `json:"records"`
+	LatestPass  int64 `json:"latest_pass"`
+	LatestGroup int64 `json:"latest_group"`
+	DryRun      bool  `json:"dry_run"`
+}
+
+const nameAliasTable = "name_alias"
+
+// RenameManager rewrites historical data after an upstream group/station rename and keeps
+// the name_alias table used to read frozen (immutable) shift summaries under the new name.
+type RenameManager struct {
+	db      *sql.DB
+	dialect Dialect
+	logger  *skylogger.Logger
+}
+
+// NewRenameManager creates a new manager
+func NewRenameManager(db *sql.DB) *RenameManager {
+	if db == nil {
+		panic("database connection cannot be nil")
+	}
+	lgr, _ := skylogger.New(
+		skylogger.WithName("entities"),
+		skylogger.WithFilePattern("{name}.log"),
+	)
+	return &RenameManager{db: db, dialect: DialectOf(db), logger: lgr}
+}
+
+// CreateTable creates the name_alias table.
+func (m *RenameManager) CreateTable() error {
+	m.logEntity("CreateTable", "start")
+	q := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		kind TEXT NOT NULL,
+		line_name TEXT NOT NULL DEFAULT '',
+		old_name TEXT NOT NULL,
+		new_name TEXT NOT NULL,
+		renamed_at TEXT NOT NULL,
+		PRIMARY KEY (kind, line_name, old_name)
+	)%s;`, nameAliasTable, m.dialect.WithoutRowID())
+	if _, err := m.db.Exec(q); err != nil {
+		m.logEntity("CreateTable", "error")
+		return fmt.Errorf("failed to create %s: %v", nameAliasTable, err)
+	}
+	m.logEntity("CreateTable", "done")
+	return nil
+}
+
+// Rename rewrites oldName to newName in records_table, latest_pass (groups only) and
+// latest_group, optionally restricted to one line, and records the alias, all in one
+// transaction. Records that already exist under the new name win over their old-name
+// duplicates. With dryRun the counts are computed and the transaction is rolled back.
+func (m *RenameManager) Rename(ctx context.Context, kind RenameKind, line, oldName, newName string, dryRun bool) (RenameResult, error) {
+	res := RenameResult{DryRun: dryRun}
+	line, oldName, newName = strings.TrimSpace(line), strings.TrimSpace(oldName), strings.TrimSpace(newName)
+	if oldName == "" || newName == "" || oldName == newName {
+		return res, fmt.Errorf("rename needs two different non-empty names, got %q -> %q", oldName, newName)
+	}
+	var column string
+	switch kind {
+	case RenameGroup:
+		column = "group_name"
+	case RenameStation:
+		column = "station_name"
+	default:
+		return res, fmt.Errorf("unknown rename kind %q", kind)
+	}
+	lineCond, lineArgs := "", []any{}
+	if line != "" {
+		lineCond, lineArgs = " AND line_name = ?", []any{line}
+	}
+	args := func(head ...any) []any { return append(head, lineArgs...) }
+
+	m.logEntity("Rename", fmt.Sprintf("%s %q -> %q line=%q start", kind, oldName, newName, line))
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return res, fmt.Errorf("failed to begin rename transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	exec := func(q string, a []any) (int64, error) {
+		r, err := tx.ExecContext(ctx, q, a...)
+		if err != nil {
+			return 0, err
+		}
+		return r.RowsAffected()
+	}
+
+	// A pass already stored under the new name replaces its old-name duplicate, which would
+	// otherwise break the table's UNIQUE constraint when renamed.
+	var same []string
+	for _, key := range []string{"ppid", "collected_timestamp", "line_name", "station_name", "group_name"} {
+		if key != column {
+			same = append(same, fmt.Sprintf("n.%[1]s = %s.%[1]s", key, tableName))
+		}
+	}
+	dups, err := exec(fmt.Sprintf(`DELETE FROM %[1]s WHERE %[2]s = ?%[3]s AND EXISTS (
+			SELECT 1 FROM %[1]s n WHERE n.%[2]s = ? AND %[4]s)`, tableName, column, lineCond, strings.Join(same, " AND ")),
+		append(args(oldName), newName))
+	if err != nil {
+		return res, fmt.Errorf("rename %s in %s: %w", kind, tableName, err)
+	}
+	res.Records, err = exec(fmt.Sprintf(`UPDATE %s SET %s = ? WHERE %s = ?%s`, tableName, column, column, lineCond),
+		args(newName, oldName))
+	if err != nil {
+		return res, fmt.Errorf("rename %s in %s: %w", kind, tableName, err)
+	}
+	res.Records += dups
+
+	if kind == RenameGroup {
+		// latest_pass is keyed by (line, group): merge keeping the newest timestamp.
+		if _, err = exec(fmt.Sprintf(`INSERT INTO %s (line_name, group_name, collected_timestamp)
+			SELECT line_name, ?, collected_timestamp FROM %s WHERE group_name = ?%s
+			ON CONFLICT(line_name, group_name) DO UPDATE SET collected_timestamp = excluded.collected_timestamp
+			WHERE excluded.collected_timestamp > %s.collected_timestamp`, latestPassTable, latestPassTable, lineCond, latestPassTable),
+			args(newName, oldName)); err != nil {
+			return res, fmt.Errorf("rename group in %s: %w", latestPassTable, err)
+		}
+		res.LatestPass, err = exec(fmt.Sprintf(`DELETE FROM %s WHERE group_name = ?%s`, latestPassTable, lineCond), args(oldName))
+		if err != nil {
+			return res, fmt.Errorf("rename group in %s: %w", latestPassTable, err)
+		}
+	}
+
+	res.LatestGroup, err = exec(fmt.Sprintf(`UPDATE %s SET %s = ? WHERE %s = ?%s`, latestGroupTable, column, column, lineCond),
+		args(newName, oldName))
+	if err != nil {
+		return res, fmt.Errorf("rename %s in %s: %w", kind, latestGroupTable, err)
+	}
+
+	// Chained renames (A -> B, then B -> C) keep resolving A to the current name.
+	if _, err = exec(fmt.Sprintf(`UPDATE %s SET new_name = ? WHERE kind = ? AND new_name = ? AND (line_name = ? OR ? = '')`, nameAliasTable),
+		[]any{newName, string(kind), oldName, line, line}); err != nil {
+		return res, fmt.Errorf("update aliases: %w", err)
+	}
+	if _, err = exec(fmt.Sprintf(`INSERT INTO %s (kind, line_name, old_name, new_name, renamed_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(kind, line_name, old_name) DO UPDATE SET new_name = excluded.new_name, renamed_at = excluded.renamed_at`, nameAliasTable),
+		[]any{string(kind), line, oldName, newName, time.Now().Format("2006-01-02 15:04:05")}); err != nil {
+		return res, fmt.Errorf("record alias: %w", err)
+	}
+
+	if dryRun {
+		m.logEntity("Rename", "dry run rolled back")
+		return res, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return res, fmt.Errorf("failed to commit rename: %w", err)
+	}
+	m.logEntity("Rename", fmt.Sprintf("done records=%d latest_pass=%d latest_group=%d", res.Records, res.LatestPass, res.LatestGroup))
+	return res, nil
+}
+
+// Aliases returns every recorded alias of kind.
+func (m *RenameManager) Aliases(kind RenameKind) ([]NameAlias, error) {
+	return loadAliases(m.db, kind)
+}
+
+func loadAliases(db *sql.DB, kind RenameKind) ([]NameAlias, error) {
+	q := fmt.Sprintf(`SELECT kind, line_name, old_name, new_name, renamed_at FROM %s WHERE kind = ? ORDER BY renamed_at`, nameAliasTable)
+	rows, err := db.Query(q, string(kind))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []NameAlias
+	for rows.Next() {
+		var a NameAlias
+		var k string
+		if err := rows.Scan(&k, &a.LineName, &a.OldName, &a.NewName, &a.RenamedAt); err != nil {
+			return nil, err
+		}
+		a.Kind = RenameKind(k)
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+// resolveAlias returns the current name of name on line, following renames from alias to
+// alias and preferring a line-specific alias at each step, so a global rename followed by
+// a rename on one line resolves to that line's latest name.
+func resolveAlias(aliases []NameAlias, line, name string) string {
+	seen := map[string]bool{name: true}
+	for {
+		next, ok := aliasStep(aliases, line, name)
+		if !ok || seen[next] {
+			return name
+		}
+		seen[next] = true
+		name = next
+	}
+}
+
+// aliasStep returns the name name was renamed to on line, if any.
+func aliasStep(aliases []NameAlias, line, name string) (string, bool) {
+	resolved, found := name, false
+	for _, a := range aliases {
+		if a.OldName != name {
+			continue
+		}
+		if a.LineName == line {
+			return a.NewName, true
+		}
+		if a.LineName == "" {
+			resolved, found = a.NewName, true
+		}
+	}
+	return resolved, found
+}
+
+// applyGroupAliases renames groups in frozen lines to their current names, merging lines
+// that end up with the same (line, group). A missing alias table leaves lines unchanged.
+func applyGroupAliases(db *sql.DB, lines []ShiftLineSummary) []ShiftLineSummary {
+	aliases, err := loadAliases(db, RenameGroup)
+	if err != nil || len(aliases) == 0 {
+		return lines
+	}
+	out := make([]ShiftLineSummary, 0, len(lines))
+	index := map[[2]string]int{}
+	for _, l := range lines {
+		l.GroupName = resolveAlias(aliases, l.LineName, l.GroupName)
+		key := [2]string{l.LineName, l.GroupName}
+		if i, ok := index[key]; ok {
+			out[i].Units += l.Units
+			out[i].FailUnits += l.FailUnits
+			continue
+		}
+		index[key] = len(out)
+		out = append(out, l)
+	}
+	return out
+}
+
+func (m *RenameManager) logEntity(operation, status string) {
+	skylogger.Helper()
+	if m.logger == nil {
+		return
+	}
+	m.logger.Infof(`entity operation "%s" "%s" "%s"`, "Rename", operation, status)
+}
@@ -0,0 +1,126 @@
+package entities
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// countRows counts the rows of table matching where.
+func countRows(t *testing.T, db *sql.DB, table, where string, args ...any) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM "+table+" WHERE "+where, args...).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestRename(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	rec := func(ppid, line, group string, minute int) RecordEntity {
+		return RecordEntity{PPID: ppid, WorkOrder: "MO1", LineName: line, GroupName: group, StationName: "ST01",
+			ModelName: "M", CollectedTimestamp: base.Add(time.Duration(minute) * time.Minute)}
+	}
+	// U3 already passed under the new name before the rename reached the API.
+	if err := NewRecordManagerEntity(db).InsertBatch([]RecordEntity{
+		rec("U1", "J01", "TEST", 0), rec("U2", "J01", "TEST", 1), rec("U3", "J01", "TEST", 2),
+		rec("U3", "J01", "FT", 2), rec("U4", "J02", "TEST", 3),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	m := NewRenameManager(db)
+
+	if _, err := m.Rename(ctx, RenameGroup, "", "TEST", "TEST", false); err == nil {
+		t.Error("rename to the same name succeeded")
+	}
+	if _, err := m.Rename(ctx, "model", "", "TEST", "FT", false); err == nil {
+		t.Error("rename of an unknown kind succeeded")
+	}
+
+	// A dry run counts the rows but changes nothing.
+	dry, err := m.Rename(ctx, RenameGroup, "J01", "TEST", "FT", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !dry.DryRun || dry.Records != 3 || dry.LatestPass != 1 {
+		t.Fatalf("dry run = %+v", dry)
+	}
+	if n := countRows(t, db, tableName, "group_name = 'TEST'"); n != 4 {
+		t.Fatalf("%d TEST records after the dry run, want 4", n)
+	}
+	if aliases, _ := m.Aliases(RenameGroup); len(aliases) != 0 {
+		t.Fatalf("dry run recorded %v", aliases)
+	}
+
+	// The rename of one line leaves the other alone and merges the duplicate pass of U3.
+	res, err := m.Rename(ctx, RenameGroup, "J01", "TEST", "FT", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.DryRun || res.Records != 3 || res.LatestPass != 1 {
+		t.Fatalf("rename = %+v", res)
+	}
+	if n := countRows(t, db, tableName, "line_name = 'J01' AND group_name = 'FT'"); n != 3 {
+		t.Errorf("%d FT records on J01, want 3 (U3 once)", n)
+	}
+	if n := countRows(t, db, tableName, "group_name = 'TEST'"); n != 1 {
+		t.Errorf("%d TEST records left, want J02's", n)
+	}
+	if n := countRows(t, db, latestPassTable, "group_name = 'TEST'"); n != 1 {
+		t.Errorf("%d TEST latest passes left, want J02's", n)
+	}
+	if n := countRows(t, db, latestGroupTable, "line_name = 'J01' AND group_name = 'TEST'"); n != 0 {
+		t.Errorf("%d J01 units still in TEST", n)
+	}
+	aliases, err := m.Aliases(RenameGroup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(aliases) != 1 || aliases[0].LineName != "J01" || aliases[0].OldName != "TEST" || aliases[0].NewName != "FT" {
+		t.Fatalf("aliases = %+v", aliases)
+	}
+}
+
+func TestGroupAliases(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	summaries := NewShiftSummaryManager(db)
+	start := base.Format("2006-01-02 15:04:05")
+	if _, err := summaries.Freeze("A", start, base.Add(12*time.Hour).Format("2006-01-02 15:04:05"), []ShiftLineSummary{
+		{LineName: "J01", GroupName: "PACK", Units: 5, FailUnits: 1},
+		{LineName: "J01", GroupName: "PACKOUT", Units: 1},
+		{LineName: "J02", GroupName: "PACK", Units: 2},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// PACK is renamed on every line, then J01 renames it once more.
+	m := NewRenameManager(db)
+	if _, err := m.Rename(ctx, RenameGroup, "", "PACK", "PACKING", false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Rename(ctx, RenameGroup, "J01", "PACKING", "PACKOUT", false); err != nil {
+		t.Fatal(err)
+	}
+	c, err := summaries.Latest("A", start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ShiftLineSummary{
+		{LineName: "J01", GroupName: "PACKOUT", Units: 6, FailUnits: 1},
+		{LineName: "J02", GroupName: "PACKING", Units: 2},
+	}
+	if !reflect.DeepEqual(c.Lines, want) {
+		t.Fatalf("frozen lines = %+v, want %+v", c.Lines, want)
+	}
+
+	// Renaming back and forth does not loop.
+	aliases := []NameAlias{{OldName: "A", NewName: "B"}, {OldName: "B", NewName: "A"}}
+	if got := resolveAlias(aliases, "J01", "A"); got != "B" {
+		t.Errorf("resolveAlias over a cycle = %q", got)
+	}
+}
@@ -0,0 +1,334 @@
+package entities
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SchemaStep creates one table group or trigger of the SFC clone database.
+type SchemaStep struct {
+	Name   string
+	Create func() error
+}
+
+// Schema returns the steps creating the full database schema, in dependency order:
+// tables first, then the triggers that write into them. Every step is idempotent.
+func Schema(db *sql.DB) []SchemaStep {
+	triggers := NewTriggersManager(db)
+	return []SchemaStep{
+		{"records_table", NewRecordManagerEntity(db).CreateTable},
+		{"latest_pass", NewLatestPassManager(db).CreateTable},
+		{"latest_group", NewLatestGroupManager(db).CreateTable},
+		{"shift_closure+shift_summary", NewShiftSummaryManager(db).CreateTable},
+		{"ingest_ledger", NewIngestLedgerManager(db).CreateTable},
+		{"export_state", NewExportStateManager(db).CreateTable},
+		{"name_alias", NewRenameManager(db).CreateTable},
+		{"feature_flags", NewFeatureFlagManager(db).CreateTable},
+		{"record_rollup+record_archive", NewRollupManager(db).CreateTable},
+		{"line_maintenance", NewLineMaintenanceManager(db).CreateTable},
+		{"pass_history", NewPassHistoryManager(db).CreateTable},
+		{"model_run", NewModelRunManager(db).CreateTable},
+		{"station_target", NewStationTargetManager(db).CreateTable},
+		{"line_station+work_order_meta", NewEnrichmentManager(db).CreateTable},
+		{"maintenance_window", NewMaintenanceWindowManager(db).CreateTable},
+		{"audit_log", NewAuditLogManager(db).CreateTable},
+		{"ingest_claim", NewIngestClaimManager(db).CreateTable},
+		// Create triggers
+		{"trg_records_pass_upsert", triggers.CreateRecordsPassUpsertTrigger},
+		{"trg_records_group_upsert", triggers.CreateRecordsGroupUpsertTrigger},
+	}
+}
+
+// EnsureSchema runs every Schema step and returns the names of the steps applied. Steps are
+// idempotent, so it brings a fresh database up to the current schema and is a no-op on one
+// that already is; it stops at the first step that fails.
+func EnsureSchema(db *sql.DB) ([]string, error) {
+	steps := Schema(db)
+	applied := make([]string, 0, len(steps))
+	for _, s := range steps {
+		if err := s.Create(); err != nil {
+			return applied, fmt.Errorf("%s: %w", s.Name, err)
+		}
+		applied = append(applied, s.Name)
+	}
+	return applied, nil
+}
+
+// Status of a step in a SchemaChange.
+const (
+	SchemaCreated   = "created"   // the step created objects
+	SchemaChanged   = "changed"   // the step altered or dropped objects
+	SchemaUnchanged = "unchanged" // the step ran; its objects were already current
+	SchemaRecreated = "recreated" // the step's trigger was dropped and created again
+	SchemaSkipped   = "skipped"   // not selected by SchemaOptions.Only
+	SchemaOK        = "ok"        // verified: every object of the step is present as the schema has it
+	SchemaMissing   = "missing"   // verified: objects of the step are absent
+	SchemaDiffers   = "differs"   // verified: an index or trigger of the step has another definition
+)
+
+// SchemaChange is what applying or verifying one Schema step found.
+type SchemaChange struct {
+	Step   string `json:"step"`
+	Status string `json:"status"`
+	// Objects are the objects created, changed, missing or differing, e.g. "trigger trg_records_pass_upsert".
+	Objects []string `json:"objects,omitempty"`
+}
+
+// SchemaOptions select what ApplySchema does.
+type SchemaOptions struct {
+	// Only selects the steps to run (see SchemaStep.Matches); empty runs them all.
+	Only []string
+	// DropRecreate selects trigger steps whose trigger is dropped before it is created, to
+	// replace a trigger whose definition changed. Inserts committed in between do not
+	// update latest_pass/latest_group, so stop the ingest first.
+	DropRecreate []string
+	// Progress, if set, is called after each step with its index (from 1) and the count.
+	Progress func(i, n int, c SchemaChange)
+}
+
+// Matches reports whether token selects s: its name, one of the "+" parts of it, a table
+// step by the table name without "_table" ("records"), or every trigger step ("triggers").
+func (s SchemaStep) Matches(token string) bool {
+	token = strings.ToLower(strings.TrimSpace(token))
+	if token == s.Name || token == "triggers" && s.isTrigger() {
+		return true
+	}
+	for _, part := range strings.Split(s.Name, "+") {
+		if token == part || token+"_table" == part {
+			return true
+		}
+	}
+	return false
+}
+
+func (s SchemaStep) isTrigger() bool { return strings.HasPrefix(s.Name, "trg_") }
+
+// selectSteps returns, per step, whether one of tokens matches it; no tokens select all.
+// A token matching no step is an error.
+func selectSteps(steps []SchemaStep, tokens []string) ([]bool, error) {
+	sel := make([]bool, len(steps))
+	for i := range sel {
+		sel[i] = len(tokens) == 0
+	}
+	for _, tok := range tokens {
+		found := false
+		for i, s := range steps {
+			if s.Matches(tok) {
+				sel[i], found = true, true
+			}
+		}
+		if !found {
+			names := make([]string, len(steps))
+			for i, s := range steps {
+				names[i] = s.Name
+			}
+			return nil, fmt.Errorf("unknown schema step %q (steps: %s, triggers)", tok, strings.Join(names, ", "))
+		}
+	}
+	return sel, nil
+}
+
+// ApplySchema runs the Schema steps selected by opts in order and reports for every step
+// whether it created, changed or left its objects as they were, from the database's catalog
+// before and after it. It stops at the first step that fails, returning the changes so far.
+func ApplySchema(ctx context.Context, db *sql.DB, opts SchemaOptions) ([]SchemaChange, error) {
+	steps := Schema(db)
+	only, err := selectSteps(steps, opts.Only)
+	if err != nil {
+		return nil, err
+	}
+	var recreate []bool
+	if len(opts.DropRecreate) > 0 {
+		if recreate, err = selectSteps(steps, opts.DropRecreate); err != nil {
+			return nil, err
+		}
+		for i, s := range steps {
+			if recreate[i] && !s.isTrigger() {
+				return nil, fmt.Errorf("%s: only triggers can be dropped and recreated", s.Name)
+			}
+		}
+	}
+
+	changes := make([]SchemaChange, 0, len(steps))
+	before, err := schemaEntries(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	for i, s := range steps {
+		c := SchemaChange{Step: s.Name, Status: SchemaSkipped}
+		if only[i] || recreate != nil && recreate[i] {
+			if recreate != nil && recreate[i] {
+				if _, err := db.ExecContext(ctx, DialectOf(db).DropTrigger(s.Name, tableName)); err != nil {
+					return changes, fmt.Errorf("%s: failed to drop trigger: %w", s.Name, err)
+				}
+			}
+			if err := s.Create(); err != nil {
+				return changes, fmt.Errorf("%s: %w", s.Name, err)
+			}
+			after, err := schemaEntries(ctx, db)
+			if err != nil {
+				return changes, err
+			}
+			created, changed := diffSchemaEntries(before, after)
+			switch {
+			case recreate != nil && recreate[i]:
+				c.Status, c.Objects = SchemaRecreated, []string{"trigger " + s.Name}
+			case len(created) > 0:
+				c.Status, c.Objects = SchemaCreated, append(created, changed...)
+			case len(changed) > 0:
+				c.Status, c.Objects = SchemaChanged, changed
+			default:
+				c.Status = SchemaUnchanged
+			}
+			before = after
+		}
+		changes = append(changes, c)
+		if opts.Progress != nil {
+			opts.Progress(i+1, len(steps), c)
+		}
+	}
+	return changes, nil
+}
+
+// VerifySchema compares db with the schema without changing it: it applies the steps
+// selected by only (see SchemaStep.Matches) to a scratch in-memory database and reports
+// for every step whether its tables, indexes and triggers are present in db, and whether
+// its indexes and triggers have the same definition. Tables are only checked for presence,
+// as columns added by migrations change their CREATE statement. On PostgreSQL every object
+// is only checked for presence, the scratch database speaking SQLite.
+func VerifySchema(ctx context.Context, db *sql.DB, only []string) ([]SchemaChange, error) {
+	scratch, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open scratch database: %w", err)
+	}
+	defer scratch.Close()
+	scratch.SetMaxOpenConns(1) // every connection is a new in-memory database
+
+	steps := Schema(scratch)
+	sel, err := selectSteps(steps, only)
+	if err != nil {
+		return nil, err
+	}
+	have, err := schemaEntries(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	dialect := DialectOf(db)
+	before := map[string]schemaEntry{}
+	changes := make([]SchemaChange, 0, len(steps))
+	for i, s := range steps {
+		if err := s.Create(); err != nil {
+			return nil, fmt.Errorf("%s of scratch database: %w", s.Name, err)
+		}
+		after, err := schemaEntries(ctx, scratch)
+		if err != nil {
+			return nil, err
+		}
+		created, _ := diffSchemaEntries(before, after)
+		before = after
+
+		c := SchemaChange{Step: s.Name, Status: SchemaSkipped}
+		if sel[i] {
+			c.Status = SchemaOK
+			var missing, differs []string
+			for _, key := range created {
+				got, ok := have[key]
+				switch {
+				case !ok:
+					missing = append(missing, key)
+				case got.typ != "table" && dialect.Name() == DialectSQLite && got.sql != after[key].sql:
+					differs = append(differs, key)
+				}
+			}
+			if len(missing) > 0 {
+				c.Status, c.Objects = SchemaMissing, append(missing, differs...)
+			} else if len(differs) > 0 {
+				c.Status, c.Objects = SchemaDiffers, differs
+			}
+		}
+		changes = append(changes, c)
+	}
+	return changes, nil
+}
+
+// schemaEntry is one object of the catalog, its SQL with whitespace collapsed.
+type schemaEntry struct{ typ, sql string }
+
+// schemaEntries returns the tables, indexes and triggers of db keyed by "type name",
+// leaving out the engine's own.
+func schemaEntries(ctx context.Context, db *sql.DB) (map[string]schemaEntry, error) {
+	rows, err := db.QueryContext(ctx, DialectOf(db).Objects())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema: %w", err)
+	}
+	defer rows.Close()
+	out := map[string]schemaEntry{}
+	for rows.Next() {
+		var typ, name, q string
+		if err := rows.Scan(&typ, &name, &q); err != nil {
+			return nil, fmt.Errorf("failed to scan schema: %w", err)
+		}
+		out[typ+" "+name] = schemaEntry{typ: typ, sql: strings.Join(strings.Fields(q), " ")}
+	}
+	return out, rows.Err()
+}
+
+// diffSchemaEntries returns the objects of after absent from before, and those whose SQL
+// changed or that were dropped, each sorted.
+func diffSchemaEntries(before, after map[string]schemaEntry) (created, changed []string) {
+	for key, e := range after {
+		if old, ok := before[key]; !ok {
+			created = append(created, key)
+		} else if old.sql != e.sql {
+			changed = append(changed, key)
+		}
+	}
+	for key := range before {
+		if _, ok := after[key]; !ok {
+			changed = append(changed, key+" (dropped)")
+		}
+	}
+	sort.Strings(created)
+	sort.Strings(changed)
+	return created, changed
+}
+
+// SchemaMismatchError is returned by CheckSchema when objects of the schema are missing
+// from the database or differ in it.
+type SchemaMismatchError struct {
+	// Objects are the objects of the schema missing from the database or differing in it,
+	// e.g. "trigger trg_records_pass_upsert (missing)".
+	Objects []string
+}
+
+func (e *SchemaMismatchError) Error() string {
+	return fmt.Sprintf("database schema is incomplete: %s; run db_manager --repair to create them (--drop-recreate for triggers)",
+		strings.Join(e.Objects, ", "))
+}
+
+// CheckSchema returns a *SchemaMismatchError unless db has every table, index and trigger
+// of the schema as VerifySchema sees them, so a service refuses to start against a
+// database a partial upgrade left behind instead of misbehaving later. The versions are
+// checked by package migrations. It changes nothing.
+func CheckSchema(ctx context.Context, db *sql.DB) error {
+	changes, err := VerifySchema(ctx, db, nil)
+	if err != nil {
+		return err
+	}
+	mismatch := &SchemaMismatchError{}
+	for _, c := range changes {
+		if c.Status == SchemaOK {
+			continue
+		}
+		for _, o := range c.Objects {
+			mismatch.Objects = append(mismatch.Objects, o+" ("+c.Status+")")
+		}
+	}
+	if len(mismatch.Objects) > 0 {
+		return mismatch
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package entities
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"testing"
+)
+
+// recordingDriver speaks PostgreSQL to DialectOf and records the statements run on it
+// instead of executing them; every query returns one row of 1.
+type recordingDriver struct{ stmts *[]string }
+
+func (d recordingDriver) Open(string) (driver.Conn, error)             { return recordingConn(d), nil }
+func (d recordingDriver) Connect(context.Context) (driver.Conn, error) { return recordingConn(d), nil }
+func (d recordingDriver) Driver() driver.Driver                        { return d }
+func (recordingDriver) Dialect() string                                { return DialectPostgres }
+
+type recordingConn recordingDriver
+
+func (c recordingConn) Prepare(q string) (driver.Stmt, error) {
+	*c.stmts = append(*c.stmts, q)
+	return recordingStmt{}, nil
+}
+func (recordingConn) Close() error              { return nil }
+func (recordingConn) Begin() (driver.Tx, error) { return recordingTx{}, nil }
+
+type recordingTx struct{}
+
+func (recordingTx) Commit() error   { return nil }
+func (recordingTx) Rollback() error { return nil }
+
+type recordingStmt struct{}
+
+func (recordingStmt) Close() error                               { return nil }
+func (recordingStmt) NumInput() int                              { return -1 }
+func (recordingStmt) Exec([]driver.Value) (driver.Result, error) { return driver.RowsAffected(0), nil }
+func (recordingStmt) Query([]driver.Value) (driver.Rows, error)  { return &oneRow{}, nil }
+
+type oneRow struct{ done bool }
+
+func (*oneRow) Columns() []string { return []string{"n"} }
+func (*oneRow) Close() error      { return nil }
+func (r *oneRow) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	for i := range dest {
+		dest[i] = int64(1)
+	}
+	return nil
+}
+
+// Every schema step goes through Dialect on PostgreSQL: none of the statements it runs
+// there is SQLite's own SQL.
+func TestPostgresSchema(t *testing.T) {
+	var stmts []string
+	db := sql.OpenDB(recordingDriver{stmts: &stmts})
+	defer db.Close()
+	if DialectOf(db).Name() != DialectPostgres {
+		t.Fatal("recording driver is not taken for PostgreSQL")
+	}
+	if _, err := EnsureSchema(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewPassHistoryManager(db).SetEnabled(true); err != nil {
+		t.Fatal(err)
+	}
+	for _, q := range stmts {
+		for _, sqlite := range []string{"WITHOUT ROWID", "AUTOINCREMENT", "strftime", "RAISE(", "sqlite_master", "pragma_", "INSERT OR", "DATETIME"} {
+			if strings.Contains(q, sqlite) {
+				t.Errorf("statement with %q on PostgreSQL:\n%s", sqlite, q)
+			}
+		}
+	}
+}
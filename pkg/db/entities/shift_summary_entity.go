@@ -0,0 +1,194 @@
+package entities
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	skylogger "hex_toolset/pkg/logger"
+	"strings"
+	"time"
+)
+
+// ShiftClosure is one frozen (immutable) version of a shift's final figures.
+// Re-freezing a shift (e.g. after a backfill) creates a new version; rows are never updated.
+type ShiftClosure struct {
+	ShiftName  string             `json:"shift_name" database:"shift_name"`
+	ShiftStart string             `json:"shift_start" database:"shift_start"` // 'YYYY-MM-DD HH:MM:SS'
+	ShiftEnd   string             `json:"shift_end" database:"shift_end"`
+	Version    int                `json:"version" database:"version"`
+	FrozenAt   string             `json:"frozen_at" database:"frozen_at"`
+	Units      int                `json:"units" database:"units"`
+	FailUnits  int                `json:"fail_units" database:"fail_units"`
+	Lines      []ShiftLineSummary `json:"lines"`
+}
+
+// ShiftLineSummary holds the frozen counts of one (line, group) within a shift closure.
+type ShiftLineSummary struct {
+	LineName  string `json:"line_name" database:"line_name"`
+	GroupName string `json:"group_name" database:"group_name"`
+	Units     int    `json:"units" database:"units"`
+	FailUnits int    `json:"fail_units" database:"fail_units"`
+}
+
+const (
+	shiftClosureTable = "shift_closure"
+	shiftSummaryTable = "shift_summary"
+)
+
+// ShiftSummaryManager manages the shift_closure (header) and shift_summary (detail) tables.
+type ShiftSummaryManager struct {
+	db      *sql.DB
+	dialect Dialect
+	logger  *skylogger.Logger
+}
+
+// NewShiftSummaryManager creates a new manager
+func NewShiftSummaryManager(db *sql.DB) *ShiftSummaryManager {
+	if db == nil {
+		panic("database connection cannot be nil")
+	}
+	lgr, _ := skylogger.New(
+		skylogger.WithName("entities"),
+		skylogger.WithFilePattern("{name}.log"),
+	)
+	return &ShiftSummaryManager{db: db, dialect: DialectOf(db), logger: lgr}
+}
+
+// CreateTable creates both tables plus triggers rejecting UPDATE/DELETE so frozen rows stay immutable.
+func (m *ShiftSummaryManager) CreateTable() error {
+	if m.logger != nil {
+		m.logger.Infof(`entity operation "%s" "%s" "%s"`, "ShiftSummary", "CreateTable", "start")
+	}
+	stmts := []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+  shift_name  TEXT NOT NULL,
+  shift_start TEXT NOT NULL,
+  shift_end   TEXT NOT NULL,
+  version     INTEGER NOT NULL,
+  frozen_at   TEXT NOT NULL,
+  units       INTEGER NOT NULL DEFAULT 0,
+  fail_units  INTEGER NOT NULL DEFAULT 0,
+  PRIMARY KEY (shift_start, shift_name, version)
+)%s;`, shiftClosureTable, m.dialect.WithoutRowID()),
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+  shift_name  TEXT NOT NULL,
+  shift_start TEXT NOT NULL,
+  version     INTEGER NOT NULL,
+  line_name   TEXT NOT NULL,
+  group_name  TEXT NOT NULL,
+  units       INTEGER NOT NULL DEFAULT 0,
+  fail_units  INTEGER NOT NULL DEFAULT 0,
+  PRIMARY KEY (shift_start, shift_name, version, line_name, group_name)
+)%s;`, shiftSummaryTable, m.dialect.WithoutRowID()),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS idx_shift_summary_line ON %s (line_name, shift_start);`, shiftSummaryTable),
+	}
+	for _, table := range []string{shiftClosureTable, shiftSummaryTable} {
+		for _, op := range []string{"UPDATE", "DELETE"} {
+			name := fmt.Sprintf("trg_%s_no_%s", table, strings.ToLower(op))
+			stmts = append(stmts, m.dialect.RejectTrigger(name, table, op, table+" rows are immutable")...)
+		}
+	}
+	for _, q := range stmts {
+		if _, err := m.db.Exec(q); err != nil {
+			if m.logger != nil {
+				m.logger.Errorf("create shift summary schema error: %v", err)
+			}
+			return err
+		}
+	}
+	if m.logger != nil {
+		m.logger.Infof(`entity operation "%s" "%s" "%s"`, "ShiftSummary", "CreateTable", "done")
+	}
+	return nil
+}
+
+// Freeze stores a new version of the shift's figures and returns it.
+// start/end use 'YYYY-MM-DD HH:MM:SS'.
+func (m *ShiftSummaryManager) Freeze(shiftName, start, end string, lines []ShiftLineSummary) (ShiftClosure, error) {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return ShiftClosure{}, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var version int
+	q := fmt.Sprintf(`SELECT COALESCE(MAX(version), 0) + 1 FROM %s WHERE shift_start = ? AND shift_name = ?`, shiftClosureTable)
+	if err := tx.QueryRow(q, start, shiftName).Scan(&version); err != nil {
+		return ShiftClosure{}, fmt.Errorf("failed to read shift version: %v", err)
+	}
+
+	c := ShiftClosure{
+		ShiftName:  shiftName,
+		ShiftStart: start,
+		ShiftEnd:   end,
+		Version:    version,
+		FrozenAt:   time.Now().Format("2006-01-02 15:04:05"),
+		Lines:      lines,
+	}
+	for _, l := range lines {
+		c.Units += l.Units
+		c.FailUnits += l.FailUnits
+	}
+
+	hq := fmt.Sprintf(`INSERT INTO %s (shift_name, shift_start, shift_end, version, frozen_at, units, fail_units)
+VALUES (?, ?, ?, ?, ?, ?, ?)`, shiftClosureTable)
+	if _, err := tx.Exec(hq, c.ShiftName, c.ShiftStart, c.ShiftEnd, c.Version, c.FrozenAt, c.Units, c.FailUnits); err != nil {
+		return ShiftClosure{}, fmt.Errorf("failed to insert shift closure: %v", err)
+	}
+	dq := fmt.Sprintf(`INSERT INTO %s (shift_name, shift_start, version, line_name, group_name, units, fail_units)
+VALUES (?, ?, ?, ?, ?, ?, ?)`, shiftSummaryTable)
+	for _, l := range lines {
+		if _, err := tx.Exec(dq, c.ShiftName, c.ShiftStart, c.Version, l.LineName, l.GroupName, l.Units, l.FailUnits); err != nil {
+			return ShiftClosure{}, fmt.Errorf("failed to insert shift summary %s/%s: %v", l.LineName, l.GroupName, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return ShiftClosure{}, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	if m.logger != nil {
+		m.logger.Infof(`entity operation "%s" "%s" "%s"`, "ShiftSummary", "Freeze",
+			fmt.Sprintf("%s %s v%d: %d lines", shiftName, start, version, len(lines)))
+	}
+	return c, nil
+}
+
+// Latest returns the newest frozen version of a shift; sql.ErrNoRows if it was never frozen.
+func (m *ShiftSummaryManager) Latest(shiftName, start string) (ShiftClosure, error) {
+	q := fmt.Sprintf(`SELECT shift_name, shift_start, shift_end, version, frozen_at, units, fail_units
+FROM %s WHERE shift_start = ? AND shift_name = ? ORDER BY version DESC LIMIT 1`, shiftClosureTable)
+	var c ShiftClosure
+	err := m.db.QueryRow(q, start, shiftName).
+		Scan(&c.ShiftName, &c.ShiftStart, &c.ShiftEnd, &c.Version, &c.FrozenAt, &c.Units, &c.FailUnits)
+	if err != nil {
+		return ShiftClosure{}, err
+	}
+	lq := fmt.Sprintf(`SELECT line_name, group_name, units, fail_units FROM %s
+WHERE shift_start = ? AND shift_name = ? AND version = ? ORDER BY line_name, group_name`, shiftSummaryTable)
+	rows, err := m.db.Query(lq, start, shiftName, c.Version)
+	if err != nil {
+		return ShiftClosure{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var l ShiftLineSummary
+		if err := rows.Scan(&l.LineName, &l.GroupName, &l.Units, &l.FailUnits); err != nil {
+			return ShiftClosure{}, err
+		}
+		c.Lines = append(c.Lines, l)
+	}
+	if err := rows.Err(); err != nil {
+		return ShiftClosure{}, err
+	}
+	// Frozen rows are never rewritten; groups renamed upstream since are mapped at read time.
+	c.Lines = applyGroupAliases(m.db, c.Lines)
+	return c, nil
+}
+
+// IsFrozen reports whether any version of the shift exists.
+func (m *ShiftSummaryManager) IsFrozen(shiftName, start string) (bool, error) {
+	_, err := m.Latest(shiftName, start)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
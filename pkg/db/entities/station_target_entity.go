@@ -0,0 +1,112 @@
+package entities
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	skylogger "hex_toolset/pkg/logger"
+	"time"
+
+	"hex_toolset/pkg/timeutil"
+)
+
+// StationTarget is the expected cycle time of a station: the seconds between two
+// consecutive passing units when the station runs to plan.
+type StationTarget struct {
+	LineName     string  `json:"line_name" database:"line_name"`
+	StationName  string  `json:"station_name" database:"station_name"`
+	CycleSeconds float64 `json:"cycle_seconds" database:"cycle_seconds"`
+	UpdatedAt    string  `json:"updated_at" database:"updated_at"` // 'YYYY-MM-DD HH:MM:SS' UTC
+}
+
+const stationTargetTable = "station_target"
+
+// StationTargetManager manages the station_target table, the cycle time targets the live
+// station variance is measured against.
+type StationTargetManager struct {
+	TableName string
+	db        *sql.DB
+	dialect   Dialect
+	logger    *skylogger.Logger
+}
+
+// NewStationTargetManager creates a new manager
+func NewStationTargetManager(db *sql.DB) *StationTargetManager {
+	if db == nil {
+		panic("database connection cannot be nil")
+	}
+	lgr, _ := skylogger.New(
+		skylogger.WithName("entities"),
+		skylogger.WithFilePattern("{name}.log"),
+	)
+	return &StationTargetManager{TableName: stationTargetTable, db: db, dialect: DialectOf(db), logger: lgr}
+}
+
+// CreateTable creates the station_target table.
+func (m *StationTargetManager) CreateTable() error {
+	m.logEntity("CreateTable", "start")
+	q := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		line_name TEXT NOT NULL,
+		station_name TEXT NOT NULL,
+		cycle_seconds DOUBLE PRECISION NOT NULL CHECK (cycle_seconds > 0),
+		updated_at TEXT NOT NULL,
+		PRIMARY KEY (line_name, station_name)
+	)%s;`, m.TableName, m.dialect.WithoutRowID())
+	if _, err := m.db.Exec(q); err != nil {
+		m.logEntity("CreateTable", "error")
+		return fmt.Errorf("failed to create %s: %v", m.TableName, err)
+	}
+	m.logEntity("CreateTable", "done")
+	return nil
+}
+
+// List returns every target ordered by line and station.
+func (m *StationTargetManager) List(ctx context.Context) ([]StationTarget, error) {
+	q := fmt.Sprintf(`SELECT line_name, station_name, cycle_seconds, updated_at FROM %s
+		ORDER BY line_name, station_name`, m.TableName)
+	rows, err := m.db.QueryContext(ctx, q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s: %w", m.TableName, err)
+	}
+	defer rows.Close()
+
+	var out []StationTarget
+	for rows.Next() {
+		var t StationTarget
+		if err := rows.Scan(&t.LineName, &t.StationName, &t.CycleSeconds, &t.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan %s: %w", m.TableName, err)
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// Set creates or replaces the target of line/station.
+func (m *StationTargetManager) Set(ctx context.Context, line, station string, cycleSeconds float64) error {
+	q := fmt.Sprintf(`INSERT INTO %s (line_name, station_name, cycle_seconds, updated_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(line_name, station_name) DO UPDATE SET cycle_seconds = excluded.cycle_seconds, updated_at = excluded.updated_at`, m.TableName)
+	if _, err := m.db.ExecContext(ctx, q, line, station, cycleSeconds, timeutil.FormatDB(time.Now())); err != nil {
+		return fmt.Errorf("failed to set target of %s/%s: %w", line, station, err)
+	}
+	m.logEntity("Set", fmt.Sprintf("%s/%s %gs", line, station, cycleSeconds))
+	return nil
+}
+
+// Delete removes the target of line/station; ok is false when it had none.
+func (m *StationTargetManager) Delete(ctx context.Context, line, station string) (ok bool, err error) {
+	res, err := m.db.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE line_name = ? AND station_name = ?`, m.TableName), line, station)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete target of %s/%s: %w", line, station, err)
+	}
+	n, _ := res.RowsAffected()
+	m.logEntity("Delete", line+"/"+station)
+	return n > 0, nil
+}
+
+func (m *StationTargetManager) logEntity(operation, status string) {
+	skylogger.Helper()
+	if m.logger == nil {
+		return
+	}
+	m.logger.Infof(`entity operation "%s" "%s" "%s"`, "StationTarget", operation, status)
+}
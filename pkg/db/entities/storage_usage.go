@@ -0,0 +1,49 @@
+package entities
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// StorageUsage describes the space taken by the database file and by one of its tables.
+type StorageUsage struct {
+	PageSize   int64  `json:"page_size"`
+	Pages      int64  `json:"pages"`
+	FreePages  int64  `json:"free_pages"`
+	Table      string `json:"table"`
+	TableBytes int64  `json:"table_bytes"` // the table and its indexes
+	TableRows  int64  `json:"table_rows"`
+}
+
+// FileBytes is the size of the database file.
+func (u StorageUsage) FileBytes() int64 { return u.PageSize * u.Pages }
+
+// UsedBytes is the size of the pages in use; free pages are reused before the file grows.
+func (u StorageUsage) UsedBytes() int64 { return u.PageSize * (u.Pages - u.FreePages) }
+
+// MeasureStorage reads the page counts of the database and the size and row count of
+// table. It walks every page of table (dbstat) and counts its rows, so it is slow on a large
+// database and meant for reports, not for polling.
+func MeasureStorage(ctx context.Context, db *sql.DB, table string) (StorageUsage, error) {
+	u := StorageUsage{Table: table}
+	if d := DialectOf(db); d.Name() != DialectSQLite {
+		return u, fmt.Errorf("storage is measured on SQLite databases only, not %s", d.Name())
+	}
+	for _, p := range []struct {
+		pragma string
+		dst    *int64
+	}{{"page_size", &u.PageSize}, {"page_count", &u.Pages}, {"freelist_count", &u.FreePages}} {
+		if err := db.QueryRowContext(ctx, "PRAGMA "+p.pragma).Scan(p.dst); err != nil {
+			return u, fmt.Errorf("pragma %s: %w", p.pragma, err)
+		}
+	}
+	q := `SELECT COALESCE(SUM(d.pgsize), 0) FROM dbstat d JOIN sqlite_master m ON m.name = d.name WHERE m.tbl_name = ?`
+	if err := db.QueryRowContext(ctx, q, table).Scan(&u.TableBytes); err != nil {
+		return u, fmt.Errorf("size of %s: %w", table, err)
+	}
+	if err := db.QueryRowContext(ctx, fmt.Sprintf(`SELECT COUNT(*) FROM %q`, table)).Scan(&u.TableRows); err != nil {
+		return u, fmt.Errorf("rows of %s: %w", table, err)
+	}
+	return u, nil
+}
@@ -8,8 +8,9 @@ import (
 
 // TriggersManager encapsulates creation of DB triggers
 type TriggersManager struct {
-	db     *sql.DB
-	logger *skylogger.Logger
+	db      *sql.DB
+	dialect Dialect
+	logger  *skylogger.Logger
 }
 
 func NewTriggersManager(db *sql.DB) *TriggersManager {
@@ -20,27 +21,16 @@ func NewTriggersManager(db *sql.DB) *TriggersManager {
 		skylogger.WithName("entities"),
 		skylogger.WithFilePattern("{name}.log"),
 	)
-	return &TriggersManager{db: db, logger: lgr}
+	return &TriggersManager{db: db, dialect: DialectOf(db), logger: lgr}
 }
 
 // CreateRecordsPassUpsertTrigger creates the trigger that maintains latest_pass on new passing records.
 // It assumes records_table and latest_pass exist. Adjust the WHEN condition if the pass criteria differs.
 func (t *TriggersManager) CreateRecordsPassUpsertTrigger() error {
-	// Using DATETIME strings lexicographically comparable in SQLite ('YYYY-MM-DD HH:MM:SS').
-	query := `CREATE TRIGGER IF NOT EXISTS trg_records_pass_upsert
-AFTER INSERT ON records_table
-WHEN NEW.error_flag = 0
-BEGIN
-  INSERT INTO latest_pass (line_name, group_name, collected_timestamp)
-  VALUES (NEW.line_name, NEW.group_name, NEW.collected_timestamp)
-  ON CONFLICT(line_name, group_name) DO UPDATE SET
-    collected_timestamp = excluded.collected_timestamp
-  WHERE excluded.collected_timestamp > latest_pass.collected_timestamp;
-END;`
 	if t.logger != nil {
 		t.logger.Infof("entity operation \"%s\" \"%s\" \"%s\"", "Triggers", "CreateRecordsPassUpsertTrigger", "start")
 	}
-	if _, err := t.db.Exec(query); err != nil {
+	if err := t.exec(passUpsertTrigger(t.dialect)); err != nil {
 		if t.logger != nil {
 			t.logger.Errorf("create trigger trg_records_pass_upsert error: %v", err)
 		}
@@ -53,20 +43,52 @@ END;`
 }
 
 // CreateRecordsGroupUpsertTrigger creates the trigger that maintains latest_group.
-// Behavior:
-// - If NEW.group_name = 'IN_STORE' => DELETE ppid from latest_group.
-// - Else UPSERT only if NEW.collected_timestamp is newer than the stored one.
+// Records may arrive out of order (a backfilled hour replays passes older than the live
+// state), so both transitions respect timestamps:
+//   - NEW.group_name = 'IN_STORE' deletes the ppid only if its latest_group row is not
+//     newer, so replaying an old exit does not wipe a reworked unit back in WIP.
+//   - Any other group upserts the ppid only if NEW is newer than the stored row and no
+//     IN_STORE record of the ppid at or after NEW exists in records_table, so replaying
+//     old WIP passes does not resurrect a unit that has left the line.
+//
+// The trigger is replaced on every start so databases created with an older definition
+// pick up the current one.
 func (t *TriggersManager) CreateRecordsGroupUpsertTrigger() error {
-	query := `
-CREATE TRIGGER IF NOT EXISTS trg_records_group_upsert
-AFTER INSERT ON records_table
-BEGIN
-  -- Exit from process → remove from latest_group
+	if t.logger != nil {
+		t.logger.Infof(`entity operation "%s" "%s" "%s"`, "Triggers", "CreateRecordsGroupUpsertTrigger", "start")
+	}
+	if err := t.replaceTrigger("trg_records_group_upsert", groupUpsertTrigger(t.dialect)); err != nil {
+		if t.logger != nil {
+			t.logger.Errorf("create trigger trg_records_group_upsert error: %v", err)
+		}
+		return fmt.Errorf("create trigger trg_records_group_upsert: %w", err)
+	}
+	if t.logger != nil {
+		t.logger.Infof(`entity operation "%s" "%s" "%s"`, "Triggers", "CreateRecordsGroupUpsertTrigger", "done")
+	}
+	return nil
+}
+
+// passUpsertTrigger returns the statements creating trg_records_pass_upsert.
+func passUpsertTrigger(d Dialect) []string {
+	// Using DATETIME strings lexicographically comparable in SQLite ('YYYY-MM-DD HH:MM:SS').
+	body := `  INSERT INTO latest_pass (line_name, group_name, collected_timestamp)
+  VALUES (NEW.line_name, NEW.group_name, NEW.collected_timestamp)
+  ON CONFLICT(line_name, group_name) DO UPDATE SET
+    collected_timestamp = excluded.collected_timestamp
+  WHERE excluded.collected_timestamp > latest_pass.collected_timestamp;`
+	return d.CreateTrigger("trg_records_pass_upsert", "records_table", "NEW.error_flag = 0", body)
+}
+
+// groupUpsertTrigger returns the statements creating trg_records_group_upsert.
+func groupUpsertTrigger(d Dialect) []string {
+	body := `  -- Exit from process → remove from latest_group, unless the unit has a newer state
   DELETE FROM latest_group
   WHERE NEW.group_name = 'IN_STORE'
-    AND latest_group.ppid = NEW.ppid;
+    AND latest_group.ppid = NEW.ppid
+    AND latest_group.collected_timestamp <= NEW.collected_timestamp;
 
-  -- In-process → upsert only if newer timestamp
+  -- In-process → upsert only if newer than the stored state and than the last exit
   INSERT INTO latest_group (
     ppid, work_order, collected_timestamp, line_name, group_name, station_name, model_name, next_station, error_flag
   )
@@ -81,6 +103,12 @@ BEGIN
     COALESCE(NEW.next_station, ''),
     NEW.error_flag
   WHERE NEW.group_name <> 'IN_STORE'
+    AND NOT EXISTS (
+      SELECT 1 FROM records_table r
+      WHERE r.ppid = NEW.ppid
+        AND r.group_name = 'IN_STORE'
+        AND r.collected_timestamp >= NEW.collected_timestamp
+    )
   ON CONFLICT(ppid) DO UPDATE SET
     work_order          = excluded.work_order,
     collected_timestamp = excluded.collected_timestamp,
@@ -90,20 +118,27 @@ BEGIN
     model_name          = excluded.model_name,
     next_station        = excluded.next_station,
     error_flag          = excluded.error_flag
-  WHERE excluded.collected_timestamp > latest_group.collected_timestamp;
-END;`
+  WHERE excluded.collected_timestamp > latest_group.collected_timestamp;`
+	return d.CreateTrigger("trg_records_group_upsert", "records_table", "", body)
+}
 
-	if t.logger != nil {
-		t.logger.Infof(`entity operation "%s" "%s" "%s"`, "Triggers", "CreateRecordsGroupUpsertTrigger", "start")
+// exec runs the statements of a trigger in one transaction.
+func (t *TriggersManager) exec(stmts []string) error {
+	tx, err := t.db.Begin()
+	if err != nil {
+		return err
 	}
-	if _, err := t.db.Exec(query); err != nil {
-		if t.logger != nil {
-			t.logger.Errorf("create trigger trg_records_group_upsert error: %v", err)
+	defer tx.Rollback()
+	for _, q := range stmts {
+		if _, err := tx.Exec(q); err != nil {
+			return err
 		}
-		return fmt.Errorf("create trigger trg_records_group_upsert: %w", err)
 	}
-	if t.logger != nil {
-		t.logger.Infof(`entity operation "%s" "%s" "%s"`, "Triggers", "CreateRecordsGroupUpsertTrigger", "done")
-	}
-	return nil
+	return tx.Commit()
+}
+
+// replaceTrigger drops name and creates it with create in one transaction, so concurrent
+// inserts never run without the trigger.
+func (t *TriggersManager) replaceTrigger(name string, create []string) error {
+	return t.exec(append([]string{t.dialect.DropTrigger(name, "records_table")}, create...))
 }
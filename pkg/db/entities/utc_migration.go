@@ -0,0 +1,325 @@
+package entities
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	skylogger "hex_toolset/pkg/logger"
+	"hex_toolset/pkg/timeutil"
+)
+
+const utcMigrationPageSize = 5000
+
+// MigrateTimestampsToUTC rewrites the local-time collected timestamps of a database written
+// before they were stored in UTC: records_table (with the IDs recomputed from the new key),
+// latest_pass, latest_group, the record_rollup hours and the export watermarks. It is
+// migration 2 of package migrations, which runs it in tx and records it; only db_manager
+// applies it, as it holds the write lock for the whole copy.
+//
+// records_table is copied into a new table and swapped in, which drops its triggers, so
+// they are created again in tx. The copy needs about the used size of the database in
+// free disk space until it commits, which is checked first, and its progress is logged. A
+// legacy timestamp in the repeated hour of a DST fall-back night is ambiguous and taken as
+// the first occurrence. A record converted to the ID of one already copied (the same pass
+// stored twice, e.g. with and without fractional seconds, which the converted key drops)
+// is skipped and counted rather than failing the migration. The ingest ledger, shift
+// summaries and audit columns keep their local keys.
+func MigrateTimestampsToUTC(ctx context.Context, tx *sql.Tx) error {
+	lgr, _ := skylogger.New(
+		skylogger.WithName("entities"),
+		skylogger.WithFilePattern("{name}.log"),
+	)
+	logEntity := func(desc, status string) {
+		if lgr != nil {
+			lgr.Infof(`entity operation "%s" "%s" "%s"`, "Schema", "MigrateTimestampsToUTC: "+desc, status)
+		}
+	}
+	logEntity(tableName, "start")
+	if err := checkCopySpace(ctx, tx, lgr); err != nil {
+		logEntity("free disk space", "error")
+		return err
+	}
+
+	logged := int64(-1)
+	records, skipped, err := migrateRecordsToUTC(ctx, tx, func(done, total int64) {
+		// once per percent
+		if pct := done * 100 / max(total, 1); pct != logged && lgr != nil {
+			lgr.Infof("MigrateTimestampsToUTC: converted %d of %d records (%d%%)", done, total, pct)
+			logged = pct
+		}
+	})
+	if err != nil {
+		logEntity(tableName, "error")
+		return fmt.Errorf("convert %s: %w", tableName, err)
+	}
+	for _, stmts := range [][]string{passUpsertTrigger(sqliteDialect{}), groupUpsertTrigger(sqliteDialect{})} {
+		for _, q := range stmts {
+			if _, err := tx.ExecContext(ctx, q); err != nil {
+				return fmt.Errorf("recreate triggers of %s: %w", tableName, err)
+			}
+		}
+	}
+	for _, c := range []struct{ table, column string }{
+		{latestPassTable, "collected_timestamp"},
+		{latestGroupTable, "collected_timestamp"},
+		{exportStateTable, "watermark"},
+	} {
+		if err := convertColumnToUTC(tx, c.table, c.column); err != nil {
+			logEntity(c.table, "error")
+			return fmt.Errorf("convert %s.%s: %w", c.table, c.column, err)
+		}
+	}
+	if err := migrateRollupToUTC(tx); err != nil {
+		logEntity(recordRollupTable, "error")
+		return fmt.Errorf("convert %s: %w", recordRollupTable, err)
+	}
+	if skipped > 0 && lgr != nil {
+		lgr.Warnf("MigrateTimestampsToUTC: skipped %d records converted to the ID of one already copied", skipped)
+	}
+	logEntity(fmt.Sprintf("%d records, %d skipped", records, skipped), "done")
+	return nil
+}
+
+// checkCopySpace returns an error unless the file system of the database has room for a
+// copy of its used pages, which the journal and the new records_table take until the
+// migration commits. It only warns where the free space cannot be read.
+func checkCopySpace(ctx context.Context, tx *sql.Tx, lgr *skylogger.Logger) error {
+	var path string
+	rows, err := tx.QueryContext(ctx, `PRAGMA database_list`)
+	if err != nil {
+		return fmt.Errorf("read database file: %w", err)
+	}
+	for rows.Next() {
+		var seq int
+		var name, file string
+		if err := rows.Scan(&seq, &name, &file); err != nil {
+			rows.Close()
+			return fmt.Errorf("read database file: %w", err)
+		}
+		if name == "main" {
+			path = file
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || path == "" { // in memory
+		return err
+	}
+
+	var pageSize, pageCount, freePages int64
+	for pragma, dst := range map[string]*int64{"page_size": &pageSize, "page_count": &pageCount, "freelist_count": &freePages} {
+		if err := tx.QueryRowContext(ctx, "PRAGMA "+pragma).Scan(dst); err != nil {
+			return fmt.Errorf("failed to read %s: %w", pragma, err)
+		}
+	}
+	need := (pageCount - freePages) * pageSize
+	free, err := freeDiskSpace(path)
+	switch {
+	case err != nil:
+		if lgr != nil {
+			lgr.Warnf("MigrateTimestampsToUTC: cannot check the free disk space for about %d MB: %v", need>>20, err)
+		}
+	case free < need:
+		return fmt.Errorf("converting %s needs about %d MB of free disk space next to %s, %d MB available", tableName, need>>20, path, free>>20)
+	}
+	return nil
+}
+
+// fromLocalDB parses a legacy timestamp as local wall-clock time and formats it for storage.
+func fromLocalDB(s string) (string, bool) {
+	t, err := time.ParseInLocation(timeutil.DBLayout, s, time.Local)
+	if err != nil {
+		return "", false
+	}
+	return timeutil.FormatDB(t), true
+}
+
+// migrateRecordsToUTC copies records_table into a new table with converted timestamps and
+// IDs, keeping every other column (NULLs included) as stored, then swaps it in. It returns
+// the records read and those skipped as duplicates of a converted ID, and reports the
+// records converted after each page.
+func migrateRecordsToUTC(ctx context.Context, tx *sql.Tx, progress func(done, total int64)) (n, skipped int64, err error) {
+	var total int64
+	if err := tx.QueryRowContext(ctx, `SELECT count(*) FROM `+tableName).Scan(&total); err != nil {
+		return 0, 0, err
+	}
+	if _, err := tx.Exec(`CREATE TEMP TABLE utc_record_map (
+  old_id TEXT PRIMARY KEY,
+  new_id TEXT NOT NULL,
+  collected_timestamp TEXT NOT NULL
+) WITHOUT ROWID`); err != nil {
+		return 0, 0, err
+	}
+	defer func() { _, _ = tx.Exec(`DROP TABLE IF EXISTS temp.utc_record_map`) }()
+
+	after := ""
+	for {
+		page, err := legacyRecordPage(ctx, tx, after)
+		if err != nil {
+			return n, 0, err
+		}
+		if len(page) == 0 {
+			break
+		}
+		for _, r := range page {
+			t, err := time.ParseInLocation(timeutil.DBLayout, timeutil.FormatDB(r.CollectedTimestamp), time.Local)
+			if err != nil {
+				return n, 0, err
+			}
+			oldID := r.ID
+			r.CollectedTimestamp = t
+			if _, err := tx.Exec(`INSERT INTO temp.utc_record_map (old_id, new_id, collected_timestamp) VALUES (?, ?, ?)`,
+				oldID, RecordID(r), timeutil.FormatDB(t)); err != nil {
+				return n, 0, err
+			}
+		}
+		n += int64(len(page))
+		after = page[len(page)-1].ID
+		progress(n, total)
+	}
+
+	staging := &RecordEntityManager{TableName: tableName + "_utc", dialect: sqliteDialect{}}
+	if _, err := tx.ExecContext(ctx, staging.buildCreateTableQuery()); err != nil {
+		return n, 0, err
+	}
+	res, err := tx.ExecContext(ctx, fmt.Sprintf(`INSERT OR IGNORE INTO %s (id, ppid, work_order, collected_timestamp, employee_name, group_name,
+			line_name, station_name, model_name, error_flag, next_station, area, process, customer, target_qty)
+		SELECT m.new_id, r.ppid, r.work_order, m.collected_timestamp, r.employee_name, r.group_name,
+			r.line_name, r.station_name, r.model_name, r.error_flag, r.next_station,
+			r.area, r.process, r.customer, r.target_qty
+		FROM %s r JOIN temp.utc_record_map m ON m.old_id = r.id`, staging.TableName, tableName))
+	if err != nil {
+		return n, 0, err
+	}
+	copied, err := res.RowsAffected()
+	if err != nil {
+		return n, 0, err
+	}
+	stmts := []string{
+		fmt.Sprintf(`DROP TABLE %s`, tableName),
+		fmt.Sprintf(`ALTER TABLE %s RENAME TO %s`, staging.TableName, tableName),
+	}
+	for _, idx := range (&RecordEntityManager{TableName: tableName, dialect: sqliteDialect{}}).getIndexDefinitions() {
+		stmts = append(stmts, idx.Query)
+	}
+	for _, q := range stmts {
+		if _, err := tx.ExecContext(ctx, q); err != nil {
+			return n, 0, err
+		}
+	}
+	return n, n - copied, nil
+}
+
+// legacyRecordPage reads the next page of records by id. The timestamps come back as
+// written, i.e. the local wall clock read as if it were UTC.
+func legacyRecordPage(ctx context.Context, tx *sql.Tx, after string) ([]RecordEntity, error) {
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf(`SELECT %s FROM %s WHERE id > ? ORDER BY id LIMIT ?`, RecordSelectColumns(sqliteDialect{}), tableName),
+		after, utcMigrationPageSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var page []RecordEntity
+	for rows.Next() {
+		r, err := ScanRecord(rows)
+		if err != nil {
+			return nil, err
+		}
+		page = append(page, r)
+	}
+	return page, rows.Err()
+}
+
+// convertColumnToUTC rewrites a timestamp column whose values are not part of a key.
+// Every row is mapped from its original value, so converted values are never converted twice.
+func convertColumnToUTC(tx *sql.Tx, table, column string) error {
+	rows, err := tx.Query(fmt.Sprintf(`SELECT DISTINCT CAST(%[1]s AS TEXT), strftime('%%Y-%%m-%%d %%H:%%M:%%S', %[1]s) FROM %[2]s`, column, table))
+	if err != nil {
+		return err
+	}
+	mapping := map[string]string{}
+	for rows.Next() {
+		var raw string
+		var ts sql.NullString
+		if err := rows.Scan(&raw, &ts); err != nil {
+			rows.Close()
+			return err
+		}
+		if utc, ok := fromLocalDB(ts.String); ok {
+			mapping[raw] = utc
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(mapping) == 0 {
+		return nil
+	}
+
+	if _, err := tx.Exec(`CREATE TEMP TABLE utc_ts_map (old TEXT PRIMARY KEY, new TEXT NOT NULL) WITHOUT ROWID`); err != nil {
+		return err
+	}
+	defer func() { _, _ = tx.Exec(`DROP TABLE IF EXISTS temp.utc_ts_map`) }()
+	for old, utc := range mapping {
+		if _, err := tx.Exec(`INSERT INTO temp.utc_ts_map (old, new) VALUES (?, ?)`, old, utc); err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(fmt.Sprintf(`UPDATE %[1]s SET %[2]s = (SELECT new FROM temp.utc_ts_map WHERE old = CAST(%[1]s.%[2]s AS TEXT))
+		WHERE CAST(%[2]s AS TEXT) IN (SELECT old FROM temp.utc_ts_map)`, table, column))
+	return err
+}
+
+// migrateRollupToUTC shifts the rollup hours. The hour is part of the primary key, so the
+// rows are rebuilt rather than updated in place.
+func migrateRollupToUTC(tx *sql.Tx) error {
+	rows, err := tx.Query(fmt.Sprintf(`SELECT DISTINCT hour FROM %s`, recordRollupTable))
+	if err != nil {
+		return err
+	}
+	var hours []string
+	for rows.Next() {
+		var h string
+		if err := rows.Scan(&h); err != nil {
+			rows.Close()
+			return err
+		}
+		hours = append(hours, h)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || len(hours) == 0 {
+		return err
+	}
+
+	if _, err := tx.Exec(`CREATE TEMP TABLE utc_hour_map (old TEXT PRIMARY KEY, new TEXT NOT NULL) WITHOUT ROWID`); err != nil {
+		return err
+	}
+	defer func() { _, _ = tx.Exec(`DROP TABLE IF EXISTS temp.utc_hour_map`) }()
+	for _, h := range hours {
+		utc, ok := fromLocalDB(h)
+		if !ok {
+			return fmt.Errorf("unexpected rollup hour %q", h)
+		}
+		if _, err := tx.Exec(`INSERT INTO temp.utc_hour_map (old, new) VALUES (?, ?)`, h, utc); err != nil {
+			return err
+		}
+	}
+	stmts := []string{
+		fmt.Sprintf(`CREATE TEMP TABLE utc_rollup AS
+		SELECT m.new AS hour, r.line_name, r.group_name, r.station_name, SUM(r.units) AS units, SUM(r.fail_units) AS fail_units
+		FROM %s r JOIN temp.utc_hour_map m ON m.old = r.hour
+		GROUP BY m.new, r.line_name, r.group_name, r.station_name`, recordRollupTable),
+		fmt.Sprintf(`DELETE FROM %s`, recordRollupTable),
+		fmt.Sprintf(`INSERT INTO %s (hour, line_name, group_name, station_name, units, fail_units)
+		SELECT hour, line_name, group_name, station_name, units, fail_units FROM temp.utc_rollup`, recordRollupTable),
+		`DROP TABLE temp.utc_rollup`,
+	}
+	for _, q := range stmts {
+		if _, err := tx.Exec(q); err != nil {
+			return err
+		}
+	}
+	return nil
+}
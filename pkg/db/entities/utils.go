@@ -1,5 +1,10 @@
 package entities
 
+import (
+	"database/sql"
+	"fmt"
+)
+
 // IndexDefinition represents an index with its name and query
 type IndexDefinition struct {
 	Name  string
@@ -9,3 +14,19 @@ type IndexDefinition struct {
 type MMap struct {
 	Name string
 }
+
+// ensureColumn adds column name (with definition def) to table when an older schema lacks it.
+func ensureColumn(db *sql.DB, table, name, def string) error {
+	var n int
+	err := db.QueryRow(DialectOf(db).ColumnExists(), table, name).Scan(&n)
+	if err != nil {
+		return fmt.Errorf("failed to inspect %s: %v", table, err)
+	}
+	if n > 0 {
+		return nil
+	}
+	if _, err := db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, name, def)); err != nil {
+		return fmt.Errorf("failed to add %s.%s: %v", table, name, err)
+	}
+	return nil
+}
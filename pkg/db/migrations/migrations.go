@@ -0,0 +1,387 @@
+// Package migrations versions the schema of the SFC clone database. Each applied version
+// is a row of schema_migrations, so an upgrade runs exactly the changes a database lacks,
+// in order, and a service can tell a database that is behind or ahead of its build.
+//
+// Version 1 is the baseline: the schema the entity steps create (entities.Schema), which
+// also bring databases created before this package up to it, older tables getting the
+// columns added since. Every later schema change is a Migration registered here instead
+// of another CREATE TABLE or ALTER TABLE in the entities, with an Up and, where the change
+// can be undone, a Down; both run in a transaction that also records the version.
+// Conversions of data written by releases before this package are migrations too, marked
+// Legacy so that a database the baseline creates records them without running them, and
+// those rewriting whole tables are Explicit: only db_manager applies them.
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"hex_toolset/pkg/db/entities"
+	"hex_toolset/pkg/timeutil"
+)
+
+// Table records the applied versions.
+const Table = "schema_migrations"
+
+// Baseline is the version of the schema the entity steps create.
+const Baseline = 1
+
+const baselineName = "baseline"
+
+// Migration is one schema change after the baseline.
+type Migration struct {
+	Version int // greater than the previous migration's
+	Name    string
+	// Up applies the change in tx, which also records it, so a failing Up leaves nothing
+	// behind. Down reverts it the same way; nil makes the migration irreversible.
+	Up, Down func(ctx context.Context, tx *sql.Tx) error
+	// Legacy marks a conversion of data written before this package: it runs on a database
+	// that had tables before its baseline was recorded, and is recorded as applied, without
+	// running, along with the baseline of a database created empty.
+	Legacy bool
+	// Explicit marks a migration too long or too large to run at a service's startup, such
+	// as one rewriting records_table: Bootstrap stops before it, so the service refuses to
+	// start until db_manager applied it.
+	Explicit bool
+}
+
+// registered are the migrations after the baseline, in version order. Add new ones at the
+// end; never change one that has shipped.
+var registered = []Migration{
+	{Version: 2, Name: "utc_timestamps", Up: entities.MigrateTimestampsToUTC, Legacy: true, Explicit: true},
+}
+
+// Latest returns the version of the schema of this build.
+func Latest() int { return latest(registered) }
+
+func latest(list []Migration) int {
+	if len(list) == 0 {
+		return Baseline
+	}
+	return list[len(list)-1].Version
+}
+
+// Directions of an Applied.
+const (
+	Up   = "up"
+	Down = "down"
+)
+
+// Applied is one migration Migrate applied or reverted.
+type Applied struct {
+	Version   int    `json:"version"`
+	Name      string `json:"name"`
+	Direction string `json:"direction"`
+	// Schema are the steps of the baseline, when it was applied.
+	Schema []entities.SchemaChange `json:"schema,omitempty"`
+}
+
+// Options select what Migrate does.
+type Options struct {
+	// Target is the version to migrate to, up or down; 0 is Latest.
+	Target int
+	// Progress, if set, is called after each migration.
+	Progress func(a Applied)
+	// SchemaProgress, if set, is called after each step of the baseline (see
+	// entities.SchemaOptions.Progress).
+	SchemaProgress func(i, n int, c entities.SchemaChange)
+	// SkipExplicit stops before the first pending Explicit migration, leaving it and the
+	// later ones pending, as Bootstrap does.
+	SkipExplicit bool
+}
+
+// Migrate brings db to opts.Target: it applies the baseline and the later migrations db
+// lacks, in order, or reverts the applied ones above the target, newest first. It stops
+// at the first that fails and returns the migrations done so far. A database holding a
+// version this build does not know was migrated by a later release and is left alone.
+func Migrate(ctx context.Context, db *sql.DB, opts Options) ([]Applied, error) {
+	return migrate(ctx, db, registered, opts)
+}
+
+func migrate(ctx context.Context, db *sql.DB, list []Migration, opts Options) ([]Applied, error) {
+	if err := validate(list); err != nil {
+		return nil, err
+	}
+	target := opts.Target
+	if target == 0 {
+		target = latest(list)
+	}
+	if target < Baseline || target > latest(list) {
+		return nil, fmt.Errorf("no migration %d (versions %d to %d)", target, Baseline, latest(list))
+	}
+	if err := createTable(ctx, db); err != nil {
+		return nil, err
+	}
+	applied, err := appliedVersions(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	if v := unknown(applied, list); v != 0 {
+		return nil, fmt.Errorf("database has migration %d, newer than version %d of this build: upgrade to the release that migrated it", v, latest(list))
+	}
+
+	var done []Applied
+	report := func(a Applied) {
+		done = append(done, a)
+		if opts.Progress != nil {
+			opts.Progress(a)
+		}
+	}
+	if _, ok := applied[Baseline]; !ok {
+		var tables int
+		if err := db.QueryRowContext(ctx, entities.DialectOf(db).ColumnExists(), "records_table", "id").Scan(&tables); err != nil {
+			return nil, fmt.Errorf("failed to inspect records_table: %w", err)
+		}
+		changes, err := entities.ApplySchema(ctx, db, entities.SchemaOptions{Progress: opts.SchemaProgress})
+		if err != nil {
+			return done, fmt.Errorf("migration %d (%s): %w", Baseline, baselineName, err)
+		}
+		// A database created now holds no data of the releases before this package, so
+		// the legacy conversions are recorded with the baseline.
+		if err := inTx(ctx, db, func(tx *sql.Tx) error {
+			if err := record(ctx, tx, Baseline, baselineName); err != nil {
+				return err
+			}
+			for _, m := range list {
+				if m.Legacy && tables == 0 {
+					if err := record(ctx, tx, m.Version, m.Name); err != nil {
+						return err
+					}
+					applied[m.Version] = ""
+				}
+			}
+			return nil
+		}); err != nil {
+			return done, fmt.Errorf("record migration %d: %w", Baseline, err)
+		}
+		report(Applied{Version: Baseline, Name: baselineName, Direction: Up, Schema: changes})
+	}
+	for _, m := range list {
+		if _, ok := applied[m.Version]; ok || m.Version > target {
+			continue
+		}
+		if m.Explicit && opts.SkipExplicit {
+			break
+		}
+		if err := inTx(ctx, db, func(tx *sql.Tx) error {
+			if err := m.Up(ctx, tx); err != nil {
+				return err
+			}
+			return record(ctx, tx, m.Version, m.Name)
+		}); err != nil {
+			return done, fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+		}
+		report(Applied{Version: m.Version, Name: m.Name, Direction: Up})
+	}
+	for i := len(list) - 1; i >= 0; i-- {
+		m := list[i]
+		if _, ok := applied[m.Version]; !ok || m.Version <= target {
+			continue
+		}
+		if m.Down == nil {
+			return done, fmt.Errorf("migration %d (%s) cannot be reverted", m.Version, m.Name)
+		}
+		if err := inTx(ctx, db, func(tx *sql.Tx) error {
+			if err := m.Down(ctx, tx); err != nil {
+				return err
+			}
+			_, err := tx.ExecContext(ctx, `DELETE FROM `+Table+` WHERE version = ?`, m.Version)
+			return err
+		}); err != nil {
+			return done, fmt.Errorf("revert migration %d (%s): %w", m.Version, m.Name, err)
+		}
+		report(Applied{Version: m.Version, Name: m.Name, Direction: Down})
+	}
+	return done, nil
+}
+
+// validate checks that list holds the versions after the baseline in increasing order.
+func validate(list []Migration) error {
+	prev := Baseline
+	for _, m := range list {
+		if m.Version <= prev {
+			return fmt.Errorf("migration %d (%s) is not after version %d", m.Version, m.Name, prev)
+		}
+		if m.Up == nil {
+			return fmt.Errorf("migration %d (%s) has no Up", m.Version, m.Name)
+		}
+		prev = m.Version
+	}
+	return nil
+}
+
+func inTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// record records version as applied now.
+func record(ctx context.Context, tx *sql.Tx, version int, name string) error {
+	_, err := tx.ExecContext(ctx, `INSERT INTO `+Table+` (version, name, applied_at) VALUES (?, ?, ?)`,
+		version, name, timeutil.FormatDB(time.Now()))
+	return err
+}
+
+func createTable(ctx context.Context, db *sql.DB) error {
+	if _, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+Table+` (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TEXT NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("failed to create %s: %w", Table, err)
+	}
+	return nil
+}
+
+// appliedVersions returns the applied_at of every version recorded in db; none when the
+// table does not exist.
+func appliedVersions(ctx context.Context, db *sql.DB) (map[int]string, error) {
+	var n int
+	if err := db.QueryRowContext(ctx, entities.DialectOf(db).ColumnExists(), Table, "version").Scan(&n); err != nil {
+		return nil, fmt.Errorf("failed to inspect %s: %w", Table, err)
+	}
+	out := map[int]string{}
+	if n == 0 {
+		return out, nil
+	}
+	rows, err := db.QueryContext(ctx, `SELECT version, applied_at FROM `+Table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", Table, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var v int
+		var at string
+		if err := rows.Scan(&v, &at); err != nil {
+			return nil, fmt.Errorf("failed to scan %s: %w", Table, err)
+		}
+		out[v] = at
+	}
+	return out, rows.Err()
+}
+
+// unknown returns the newest applied version that is not in list, 0 if none.
+func unknown(applied map[int]string, list []Migration) int {
+	known := map[int]bool{Baseline: true}
+	for _, m := range list {
+		known[m.Version] = true
+	}
+	newest := 0
+	for v := range applied {
+		if !known[v] && v > newest {
+			newest = v
+		}
+	}
+	return newest
+}
+
+// State is a version of this build and whether db has it.
+type State struct {
+	Version   int    `json:"version"`
+	Name      string `json:"name"`
+	AppliedAt string `json:"applied_at,omitempty"` // UTC 'YYYY-MM-DD HH:MM:SS'; "" while pending
+	// Reversible reports whether the version has a Down.
+	Reversible bool `json:"reversible"`
+}
+
+// Status returns every version of this build in order with when db applied it, followed
+// by the versions db has that this build does not know (Name "").
+func Status(ctx context.Context, db *sql.DB) ([]State, error) {
+	return status(ctx, db, registered)
+}
+
+func status(ctx context.Context, db *sql.DB, list []Migration) ([]State, error) {
+	applied, err := appliedVersions(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	out := []State{{Version: Baseline, Name: baselineName, AppliedAt: applied[Baseline]}}
+	delete(applied, Baseline)
+	for _, m := range list {
+		out = append(out, State{Version: m.Version, Name: m.Name, AppliedAt: applied[m.Version], Reversible: m.Down != nil})
+		delete(applied, m.Version)
+	}
+	var extra []int
+	for v := range applied {
+		extra = append(extra, v)
+	}
+	sort.Ints(extra)
+	for _, v := range extra {
+		out = append(out, State{Version: v, AppliedAt: applied[v]})
+	}
+	return out, nil
+}
+
+// ErrPending is wrapped by Check when the database lacks migrations of this build.
+var ErrPending = errors.New("database has pending migrations")
+
+// Check returns an error unless db has every migration of this build and none newer, so a
+// service refuses to start against a database that was not upgraded with it.
+func Check(ctx context.Context, db *sql.DB) error {
+	return check(ctx, db, registered)
+}
+
+func check(ctx context.Context, db *sql.DB, list []Migration) error {
+	states, err := status(ctx, db, list)
+	if err != nil {
+		return err
+	}
+	explicit := map[int]bool{}
+	for _, m := range list {
+		explicit[m.Version] = m.Explicit
+	}
+	var pending, rewrites []int
+	for _, s := range states {
+		switch {
+		case s.Name == "":
+			return fmt.Errorf("database has migration %d, newer than version %d of this build: upgrade this service to the release that migrated it",
+				s.Version, latest(list))
+		case s.AppliedAt == "":
+			pending = append(pending, s.Version)
+			if explicit[s.Version] {
+				rewrites = append(rewrites, s.Version)
+			}
+		}
+	}
+	if len(rewrites) > 0 {
+		return fmt.Errorf("%w %v: run db_manager to apply them (%v rewrite stored data and are not applied by DB_BOOTSTRAP)", ErrPending, pending, rewrites)
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%w %v: run db_manager (or start a service with DB_BOOTSTRAP=true) to apply them", ErrPending, pending)
+	}
+	return nil
+}
+
+// Bootstrap readies db for a service at startup. With apply (DB_BOOTSTRAP) it first
+// applies the pending migrations up to the first Explicit one, so a fresh deployment needs
+// no separate setup step. Either way it then checks the schema (entities.CheckSchema and
+// Check), so the service refuses to start against a database of another version or with
+// schema objects missing. It returns the migrations applied.
+func Bootstrap(ctx context.Context, db *sql.DB, apply bool) ([]Applied, error) {
+	return bootstrap(ctx, db, registered, apply)
+}
+
+func bootstrap(ctx context.Context, db *sql.DB, list []Migration, apply bool) ([]Applied, error) {
+	var applied []Applied
+	if apply {
+		var err error
+		if applied, err = migrate(ctx, db, list, Options{SkipExplicit: true}); err != nil {
+			return applied, fmt.Errorf("migrate: %w", err)
+		}
+	}
+	if err := entities.CheckSchema(ctx, db); err != nil {
+		return applied, err
+	}
+	return applied, check(ctx, db, list)
+}
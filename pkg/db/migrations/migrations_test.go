@@ -0,0 +1,210 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	_ "modernc.org/sqlite"
+
+	"hex_toolset/pkg/db/entities"
+)
+
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "migrations.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+func exec(stmt string) func(ctx context.Context, tx *sql.Tx) error {
+	return func(ctx context.Context, tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, stmt)
+		return err
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	// the baseline's entity steps log to LOG_DIR, ./logs by default
+	t.Setenv("LOG_DIR", t.TempDir())
+	ctx := context.Background()
+	db := openTestDB(t)
+	list := []Migration{
+		{Version: 2, Name: "line_note", Up: exec(`CREATE TABLE line_note (line_name TEXT PRIMARY KEY, note TEXT NOT NULL)`),
+			Down: exec(`DROP TABLE line_note`)},
+		{Version: 3, Name: "line_note_author", Up: exec(`ALTER TABLE line_note ADD COLUMN author TEXT NOT NULL DEFAULT ''`),
+			Down: exec(`ALTER TABLE line_note DROP COLUMN author`)},
+	}
+	versions := func(applied []Applied) string {
+		var s []string
+		for _, a := range applied {
+			s = append(s, a.Name+" "+a.Direction)
+		}
+		return strings.Join(s, ", ")
+	}
+
+	if err := check(ctx, db, list); !errors.Is(err, ErrPending) {
+		t.Fatalf("check of an empty database: %v", err)
+	}
+	applied, err := migrate(ctx, db, list, Options{Target: 2})
+	if got := versions(applied); err != nil || got != "baseline up, line_note up" || len(applied[0].Schema) == 0 {
+		t.Fatalf("migrate to 2 = %s, %v", got, err)
+	}
+	applied, err = migrate(ctx, db, list, Options{})
+	if got := versions(applied); err != nil || got != "line_note_author up" {
+		t.Fatalf("migrate = %s, %v", got, err)
+	}
+	if _, err := db.Exec(`INSERT INTO line_note (line_name, note, author) VALUES ('J01', 'ok', 'me')`); err != nil {
+		t.Fatal(err)
+	}
+	if err := check(ctx, db, list); err != nil {
+		t.Fatalf("check after migrate: %v", err)
+	}
+	if applied, err := migrate(ctx, db, list, Options{}); err != nil || len(applied) != 0 {
+		t.Fatalf("migrate again = %+v, %v", applied, err)
+	}
+
+	// down to the baseline, newest first
+	applied, err = migrate(ctx, db, list, Options{Target: Baseline})
+	if got := versions(applied); err != nil || got != "line_note_author down, line_note down" {
+		t.Fatalf("migrate to baseline = %s, %v", got, err)
+	}
+	states, err := status(ctx, db, list)
+	if err != nil || len(states) != 3 || states[0].AppliedAt == "" || states[1].AppliedAt != "" || !states[2].Reversible {
+		t.Fatalf("status = %+v, %v", states, err)
+	}
+	if _, err := migrate(ctx, db, list, Options{Target: 4}); err == nil {
+		t.Error("migrated to a version that does not exist")
+	}
+
+	// a failing migration leaves nothing behind
+	bad := append(list[:1:1], Migration{Version: 3, Name: "broken", Up: func(ctx context.Context, tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `CREATE TABLE half_done (x INTEGER)`); err != nil {
+			return err
+		}
+		return errors.New("boom")
+	}})
+	if applied, err := migrate(ctx, db, bad, Options{}); err == nil || !strings.Contains(err.Error(), "migration 3 (broken): boom") || len(applied) != 1 {
+		t.Fatalf("broken migration = %+v, %v", applied, err)
+	}
+	var n int
+	if err := db.QueryRow(`SELECT count(*) FROM sqlite_master WHERE name = 'half_done'`).Scan(&n); err != nil || n != 0 {
+		t.Errorf("table of the failed migration left behind (%d, %v)", n, err)
+	}
+	if err := check(ctx, db, bad); !errors.Is(err, ErrPending) || !strings.Contains(err.Error(), "[3]") {
+		t.Errorf("check after the failed migration: %v", err)
+	}
+	irreversible := []Migration{{Version: 2, Name: "line_note", Up: list[0].Up}}
+	if _, err := migrate(ctx, db, irreversible, Options{Target: Baseline}); err == nil || !strings.Contains(err.Error(), "cannot be reverted") {
+		t.Errorf("reverting an irreversible migration: %v", err)
+	}
+
+	// a database migrated by a later release is left alone
+	if _, err := db.Exec(`INSERT INTO ` + Table + ` (version, name, applied_at) VALUES (9, 'later', '2026-01-01 00:00:00')`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrate(ctx, db, list, Options{}); err == nil || !strings.Contains(err.Error(), "migration 9") {
+		t.Errorf("migrate with an unknown version: %v", err)
+	}
+	if err := check(ctx, db, list); err == nil || errors.Is(err, ErrPending) || !strings.Contains(err.Error(), "migration 9") {
+		t.Errorf("check with an unknown version: %v", err)
+	}
+
+	if err := validate([]Migration{list[1], list[0]}); err == nil {
+		t.Error("migrations out of order accepted")
+	}
+	if err := validate(registered); err != nil {
+		t.Errorf("registered migrations: %v", err)
+	}
+}
+
+func TestBootstrap(t *testing.T) {
+	t.Setenv("LOG_DIR", t.TempDir())
+	ctx := context.Background()
+	db := openTestDB(t)
+	list := []Migration{{Version: 2, Name: "line_note", Up: exec(`CREATE TABLE line_note (line_name TEXT PRIMARY KEY, note TEXT NOT NULL)`)}}
+
+	// Without DB_BOOTSTRAP a fresh database is left alone and refused.
+	if applied, err := bootstrap(ctx, db, list, false); err == nil || len(applied) != 0 {
+		t.Fatalf("bootstrap off on a fresh database = %+v, %v", applied, err)
+	}
+	var n int
+	if err := db.QueryRow(`SELECT count(*) FROM sqlite_master WHERE type = 'table'`).Scan(&n); err != nil || n != 0 {
+		t.Fatalf("%d tables created with bootstrap off (%v)", n, err)
+	}
+
+	// With it the schema is created and checked; a restart has nothing left to apply.
+	applied, err := bootstrap(ctx, db, list, true)
+	if err != nil || len(applied) != 2 || applied[1].Name != "line_note" {
+		t.Fatalf("bootstrap = %+v, %v", applied, err)
+	}
+	if applied, err := bootstrap(ctx, db, list, true); err != nil || len(applied) != 0 {
+		t.Fatalf("bootstrap again = %+v, %v", applied, err)
+	}
+	if _, err := bootstrap(ctx, db, list, false); err != nil {
+		t.Fatalf("check of a bootstrapped database: %v", err)
+	}
+
+	// A migration of a newer build is pending until a service bootstraps it.
+	next := append(list[:1:1], Migration{Version: 3, Name: "line_note_author",
+		Up: exec(`ALTER TABLE line_note ADD COLUMN author TEXT NOT NULL DEFAULT ''`)})
+	if _, err := bootstrap(ctx, db, next, false); !errors.Is(err, ErrPending) {
+		t.Fatalf("bootstrap off with a pending migration: %v", err)
+	}
+	if applied, err := bootstrap(ctx, db, next, true); err != nil || len(applied) != 1 {
+		t.Fatalf("bootstrap of the pending migration = %+v, %v", applied, err)
+	}
+
+	// An explicit one, and those after it, are left to db_manager.
+	next = append(next, Migration{Version: 4, Name: "line_note_rewrite", Explicit: true,
+		Up: exec(`UPDATE line_note SET author = 'migrated'`)},
+		Migration{Version: 5, Name: "line_note_index", Up: exec(`CREATE INDEX idx_line_note_author ON line_note (author)`)})
+	applied, err = bootstrap(ctx, db, next, true)
+	if !errors.Is(err, ErrPending) || !strings.Contains(err.Error(), "run db_manager") || len(applied) != 0 {
+		t.Fatalf("bootstrap with an explicit migration = %+v, %v", applied, err)
+	}
+	if applied, err := migrate(ctx, db, next, Options{}); err != nil || len(applied) != 2 {
+		t.Fatalf("migrate of the explicit migration = %+v, %v", applied, err)
+	}
+	if _, err := bootstrap(ctx, db, next, false); err != nil {
+		t.Fatalf("check after db_manager: %v", err)
+	}
+}
+
+func TestLegacy(t *testing.T) {
+	t.Setenv("LOG_DIR", t.TempDir())
+	ctx := context.Background()
+	list := []Migration{{Version: 2, Name: "legacy_note", Legacy: true, Up: exec(`CREATE TABLE legacy_note (x INTEGER)`)}}
+	ran := func(db *sql.DB) bool {
+		var n int
+		if err := db.QueryRow(`SELECT count(*) FROM sqlite_master WHERE name = 'legacy_note'`).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n == 1
+	}
+
+	// A database created by the baseline records the conversion without running it.
+	fresh := openTestDB(t)
+	if applied, err := migrate(ctx, fresh, list, Options{}); err != nil || len(applied) != 1 || ran(fresh) {
+		t.Fatalf("migrate of a fresh database = %+v, %v (ran: %v)", applied, err, ran(fresh))
+	}
+	if err := check(ctx, fresh, list); err != nil {
+		t.Fatalf("check of a fresh database: %v", err)
+	}
+
+	// One written by an earlier release runs it.
+	old := openTestDB(t)
+	if err := entities.NewRecordManagerEntity(old).CreateTable(); err != nil {
+		t.Fatal(err)
+	}
+	if applied, err := migrate(ctx, old, list, Options{}); err != nil || len(applied) != 2 || !ran(old) {
+		t.Fatalf("migrate of an earlier database = %+v, %v", applied, err)
+	}
+}
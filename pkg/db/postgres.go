@@ -0,0 +1,148 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// Database drivers of Config.Driver.
+const (
+	DriverSQLite   = "sqlite"   // a single file, SFC_CLON (default)
+	DriverPostgres = "postgres" // a PostgreSQL server, DB_DSN
+)
+
+// postgresConn is what the rebinding needs from a pgx connection.
+type postgresConn interface {
+	driver.Conn
+	driver.ConnBeginTx
+	driver.ConnPrepareContext
+	driver.ExecerContext
+	driver.QueryerContext
+	driver.Pinger
+	driver.SessionResetter
+	driver.Validator
+	driver.NamedValueChecker
+}
+
+// postgresConnector opens PostgreSQL connections through pgx whose statements take the
+// "?" placeholders the entities are written with (see rebind).
+type postgresConnector struct {
+	dsn string
+	drv postgresDriver
+}
+
+func newPostgresConnector(dsn string) *postgresConnector {
+	return &postgresConnector{dsn: dsn, drv: postgresDriver{stdlib.GetDefaultDriver()}}
+}
+
+func (c *postgresConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	inner, err := c.drv.Driver.(driver.DriverContext).OpenConnector(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	dc, err := inner.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pc, ok := dc.(postgresConn)
+	if !ok {
+		_ = dc.Close()
+		return nil, fmt.Errorf("unexpected postgres connection type %T", dc)
+	}
+	return &reboundConn{postgresConn: pc}, nil
+}
+
+func (c *postgresConnector) Driver() driver.Driver { return c.drv }
+
+// postgresDriver tells the entities which SQL dialect a *sql.DB speaks (see
+// entities.DialectOf).
+type postgresDriver struct{ driver.Driver }
+
+func (postgresDriver) Dialect() string { return DriverPostgres }
+
+// reboundConn rewrites the placeholders of every statement before pgx sees it.
+type reboundConn struct{ postgresConn }
+
+func (c *reboundConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	return c.postgresConn.PrepareContext(ctx, rebind(query))
+}
+
+func (c *reboundConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.postgresConn.ExecContext(ctx, rebind(query), args)
+}
+
+func (c *reboundConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.postgresConn.QueryContext(ctx, rebind(query), args)
+}
+
+// CheckNamedValue stores booleans as 0 and 1, the INTEGER flags of the schema (error_flag)
+// being what SQLite makes of them; everything else is pgx's.
+func (c *reboundConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if b, ok := nv.Value.(bool); ok {
+		nv.Value = int64(0)
+		if b {
+			nv.Value = int64(1)
+		}
+		return nil
+	}
+	return c.postgresConn.CheckNamedValue(nv)
+}
+
+// rebind numbers the "?" placeholders of query as PostgreSQL's $1, $2, ..., leaving those
+// in string literals, quoted identifiers, dollar-quoted bodies and comments alone.
+func rebind(query string) string {
+	if !strings.Contains(query, "?") {
+		return query
+	}
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+	n := 0
+	for i := 0; i < len(query); {
+		switch c := query[i]; {
+		case c == '?':
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			i++
+		case c == '\'' || c == '"':
+			j := i + 1
+			for j < len(query) && query[j] != c {
+				j++
+			}
+			j = min(j+1, len(query)) // a doubled quote is two adjacent literals here
+			b.WriteString(query[i:j])
+			i = j
+		case c == '-' && strings.HasPrefix(query[i:], "--"):
+			j := strings.IndexByte(query[i:], '\n')
+			if j < 0 {
+				j = len(query) - i
+			}
+			b.WriteString(query[i : i+j])
+			i += j
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			j := strings.Index(query[i+2:], "*/")
+			end := len(query)
+			if j >= 0 {
+				end = i + 2 + j + 2
+			}
+			b.WriteString(query[i:end])
+			i = end
+		case c == '$' && strings.HasPrefix(query[i:], "$$"):
+			j := strings.Index(query[i+2:], "$$")
+			end := len(query)
+			if j >= 0 {
+				end = i + 2 + j + 2
+			}
+			b.WriteString(query[i:end])
+			i = end
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,60 @@
+package db
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"hex_toolset/pkg/db/entities"
+)
+
+func TestRebind(t *testing.T) {
+	for _, c := range []struct{ in, want string }{
+		{`SELECT 1`, `SELECT 1`},
+		{`INSERT INTO t (a, b) VALUES (?, ?)`, `INSERT INTO t (a, b) VALUES ($1, $2)`},
+		{`SELECT '?', "a?" FROM t WHERE a = ? AND b = 'it''s?' AND c = ?`, `SELECT '?', "a?" FROM t WHERE a = $1 AND b = 'it''s?' AND c = $2`},
+		{"SELECT ? -- why?\n, ? /* or? */", "SELECT $1 -- why?\n, $2 /* or? */"},
+		{`CREATE FUNCTION f() AS $$ BEGIN IF a = '?' THEN END IF; END $$; SELECT ?`, `CREATE FUNCTION f() AS $$ BEGIN IF a = '?' THEN END IF; END $$; SELECT $1`},
+		{`SELECT 'unterminated ?`, `SELECT 'unterminated ?`},
+	} {
+		if got := rebind(c.in); got != c.want {
+			t.Errorf("rebind(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestPostgresDialect(t *testing.T) {
+	// sql.OpenDB does not connect: the dialect comes from the driver alone
+	pg := sql.OpenDB(newPostgresConnector("postgres://hex@127.0.0.1:1/hex"))
+	defer pg.Close()
+	if got := entities.DialectOf(pg).Name(); got != entities.DialectPostgres {
+		t.Errorf("dialect of a postgres connection = %s", got)
+	}
+	lite := sql.OpenDB(newConnector(":memory:", nil))
+	defer lite.Close()
+	if got := entities.DialectOf(lite).Name(); got != entities.DialectSQLite {
+		t.Errorf("dialect of a sqlite connection = %s", got)
+	}
+	if _, err := EstimateCompact(t.Context(), pg, "", 0); err == nil || !strings.Contains(err.Error(), "SQLite") {
+		t.Errorf("estimate compaction of postgres: %v", err)
+	}
+
+	d := entities.DialectOf(pg)
+	cols := []string{"id", "v"}
+	if got, want := d.Insert("t", cols, []string{"id"}, entities.ConflictIgnore), `INSERT INTO t (id, v) VALUES (?, ?) ON CONFLICT DO NOTHING`; got != want {
+		t.Errorf("insert ignoring = %q, want %q", got, want)
+	}
+	if got, want := d.Insert("t", cols, []string{"id"}, entities.ConflictReplace),
+		`INSERT INTO t (id, v) VALUES (?, ?) ON CONFLICT (id) DO UPDATE SET id = excluded.id, v = excluded.v`; got != want {
+		t.Errorf("insert replacing = %q, want %q", got, want)
+	}
+
+	c := &reboundConn{}
+	for in, want := range map[bool]int64{false: 0, true: 1} {
+		nv := driver.NamedValue{Value: in}
+		if err := c.CheckNamedValue(&nv); err != nil || nv.Value != want {
+			t.Errorf("CheckNamedValue(%v) = %v, %v; want %d", in, nv.Value, err, want)
+		}
+	}
+}
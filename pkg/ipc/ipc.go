@@ -0,0 +1,178 @@
+// Package ipc is the local channel between the SFC loader (db_clon) and the broadcast
+// service: a Unix-domain socket (AF_UNIX, also available on Windows 10+) carrying one
+// broadcast envelope per line. It replaces the MESSAGE_DIR round trip, whose latency is
+// dominated by file watching, when both processes run on the same host.
+package ipc
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"hex_toolset/pkg/logger"
+)
+
+// MaxMessageBytes bounds one envelope; larger messages must go through MESSAGE_DIR.
+const MaxMessageBytes = 8 << 20
+
+// listenFDsStart is the first file descriptor passed by systemd socket activation.
+const listenFDsStart = 3
+
+// Listen returns the listener of the broadcast side. Under systemd socket activation
+// (LISTEN_PID is this process and LISTEN_FDS=1) the inherited socket is used and path is
+// ignored; otherwise path is created, replacing a stale socket left by a crashed process.
+func Listen(path string) (net.Listener, error) {
+	if ln, ok, err := activated(); ok || err != nil {
+		return ln, err
+	}
+	if _, err := os.Stat(path); err == nil {
+		if c, err := net.DialTimeout("unix", path, 200*time.Millisecond); err == nil {
+			_ = c.Close()
+			return nil, fmt.Errorf("ipc: %s is already in use by another process", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("ipc: remove stale socket %s: %w", path, err)
+		}
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("ipc: listen %s: %w", path, err)
+	}
+	return ln, nil
+}
+
+// activated returns the socket passed by systemd, if any.
+func activated() (net.Listener, bool, error) {
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return nil, false, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 1 {
+		return nil, false, nil
+	}
+	if n > 1 {
+		return nil, true, fmt.Errorf("ipc: expected one activated socket, got LISTEN_FDS=%d", n)
+	}
+	f := os.NewFile(uintptr(listenFDsStart), "LISTEN_FD_3")
+	defer f.Close()
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return nil, true, fmt.Errorf("ipc: activated socket: %w", err)
+	}
+	return ln, true, nil
+}
+
+// Serve accepts loader connections on ln and calls handle with every message received,
+// until ctx is done. handle runs on the connection's goroutine and must not retain msg.
+func Serve(ctx context.Context, ln net.Listener, handle func(msg []byte), lgr *logger.Logger) {
+	go func() {
+		<-ctx.Done()
+		_ = ln.Close()
+	}()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() == nil && lgr != nil {
+				lgr.Errorf("ipc accept: %v", err)
+			}
+			return
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer conn.Close()
+			stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+			defer stop()
+			sc := bufio.NewScanner(conn)
+			sc.Buffer(make([]byte, 64<<10), MaxMessageBytes)
+			for sc.Scan() {
+				if len(sc.Bytes()) > 0 {
+					handle(sc.Bytes())
+				}
+			}
+			if err := sc.Err(); err != nil && ctx.Err() == nil && lgr != nil {
+				lgr.Warnf("ipc connection closed: %v", err)
+			}
+		}()
+	}
+}
+
+// ErrUnavailable is returned by Client.Send while the broadcast side cannot be reached.
+var ErrUnavailable = errors.New("ipc: broadcast service unavailable")
+
+// Client is the loader side. It connects lazily and, after a failed connect, does not retry
+// before RetryAfter so a stopped broadcast service does not slow every publish down.
+type Client struct {
+	path       string
+	RetryAfter time.Duration
+
+	mu       sync.Mutex
+	conn     net.Conn
+	w        *bufio.Writer
+	nextDial time.Time
+}
+
+// NewClient creates a client for the socket at path.
+func NewClient(path string) *Client {
+	return &Client{path: path, RetryAfter: 5 * time.Second}
+}
+
+// Send writes msg as one line. On failure the connection is dropped and the caller is
+// expected to fall back to another transport for this message. A message written just as
+// the broadcast service exits can be lost; the live topics are snapshots that the next
+// minute supersedes.
+func (c *Client) Send(msg []byte) error {
+	if len(msg) > MaxMessageBytes {
+		return fmt.Errorf("ipc: message of %d bytes exceeds %d", len(msg), MaxMessageBytes)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		if time.Now().Before(c.nextDial) {
+			return ErrUnavailable
+		}
+		conn, err := net.DialTimeout("unix", c.path, 500*time.Millisecond)
+		if err != nil {
+			c.nextDial = time.Now().Add(c.RetryAfter)
+			return fmt.Errorf("%w: %v", ErrUnavailable, err)
+		}
+		c.conn, c.w = conn, bufio.NewWriter(conn)
+	}
+	_ = c.conn.SetWriteDeadline(time.Now().Add(time.Second))
+	_, err := c.w.Write(msg)
+	if err == nil {
+		err = c.w.WriteByte('\n')
+	}
+	if err == nil {
+		err = c.w.Flush()
+	}
+	if err != nil {
+		c.closeLocked()
+		return fmt.Errorf("ipc: send: %w", err)
+	}
+	return nil
+}
+
+// Close closes the connection, if any.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closeLocked()
+}
+
+func (c *Client) closeLocked() error {
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn, c.w = nil, nil
+	return err
+}
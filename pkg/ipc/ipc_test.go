@@ -0,0 +1,73 @@
+package ipc
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSendReceive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "broadcast.sock")
+	ln, err := Listen(path)
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	got := make(chan string, 4)
+	done := make(chan struct{})
+	go func() {
+		Serve(ctx, ln, func(msg []byte) { got <- string(msg) }, nil)
+		close(done)
+	}()
+
+	c := NewClient(path)
+	defer c.Close()
+	for _, m := range []string{`{"massage_type":"LAST_HOUR","massage":{}}`, `{"massage_type":"LATEST","massage":{}}`} {
+		if err := c.Send([]byte(m)); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+		select {
+		case r := <-got:
+			if r != m {
+				t.Fatalf("received %q, want %q", r, m)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("message not received")
+		}
+	}
+
+	if _, err := Listen(path); err == nil {
+		t.Fatalf("a socket in use must not be replaced")
+	}
+	cancel()
+	<-done
+}
+
+func TestClientBacksOffWhenUnavailable(t *testing.T) {
+	c := NewClient(filepath.Join(t.TempDir(), "missing.sock"))
+	if err := c.Send([]byte("x")); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("expected ErrUnavailable, got %v", err)
+	}
+	// Within RetryAfter the client does not dial again.
+	if err := c.Send([]byte("x")); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("expected ErrUnavailable, got %v", err)
+	}
+}
+
+func TestListenReplacesStaleSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "broadcast.sock")
+	ln, err := Listen(path)
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	// Simulate a crash: the socket file stays behind but nobody listens.
+	ln.(interface{ SetUnlinkOnClose(bool) }).SetUnlinkOnClose(false)
+	_ = ln.Close()
+	ln, err = Listen(path)
+	if err != nil {
+		t.Fatalf("Listen over stale socket: %v", err)
+	}
+	_ = ln.Close()
+}
@@ -0,0 +1,84 @@
+package logger
+
+import (
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Caller fields added by WithCaller.
+const (
+	CallerKey = "caller" // "dir/file.go:line" of the call site
+	FuncKey   = "func"   // e.g. "entities.(*RecordEntityManager).InsertBatch"
+)
+
+// loggerDir is the directory of this package's sources, whose frames are never the caller.
+var loggerDir = func() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Dir(file)
+}()
+
+// helpers holds the functions marked with Helper.
+var helpers sync.Map // function name -> struct{}
+
+// Helper marks the calling function as a logging helper, like testing.T.Helper: with
+// WithCaller, entries logged from it report the caller of the helper instead, e.g. the
+// entity method calling a shared logEntity.
+func Helper() {
+	pc, _, _, ok := runtime.Caller(1)
+	if !ok {
+		return
+	}
+	if fn := runtime.FuncForPC(pc); fn != nil {
+		helpers.LoadOrStore(fn.Name(), struct{}{})
+	}
+}
+
+// callerFields returns the caller fields of the call site logging through this package,
+// skipping the standard log package (StdLogger) and the helpers.
+func callerFields() []field {
+	var pcs [16]uintptr
+	n := runtime.Callers(3, pcs[:])
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		f, more := frames.Next()
+		if !skipFrame(f) {
+			return []field{{CallerKey, trimPath(f.File) + ":" + strconv.Itoa(f.Line)}, {FuncKey, trimFunc(f.Function)}}
+		}
+		if !more {
+			return nil
+		}
+	}
+}
+
+func skipFrame(f runtime.Frame) bool {
+	if filepath.Dir(f.File) == loggerDir && !strings.HasSuffix(f.File, "_test.go") {
+		return true
+	}
+	if strings.HasPrefix(f.Function, "log.") {
+		return true
+	}
+	_, helper := helpers.Load(f.Function)
+	return helper
+}
+
+// trimPath keeps the last directory and the file name.
+func trimPath(file string) string {
+	file = filepath.ToSlash(file)
+	if i := strings.LastIndexByte(file, '/'); i >= 0 {
+		if j := strings.LastIndexByte(file[:i], '/'); j >= 0 {
+			return file[j+1:]
+		}
+	}
+	return file
+}
+
+// trimFunc drops the import path of the package from a function name.
+func trimFunc(fn string) string {
+	if i := strings.LastIndexByte(fn, '/'); i >= 0 {
+		return fn[i+1:]
+	}
+	return fn
+}
@@ -0,0 +1,69 @@
+package logger
+
+import (
+	"context"
+	"io"
+	"log"
+	"math"
+)
+
+// Keys of the IDs that the services store in contexts with ContextWithFields.
+const (
+	RequestIDKey = "request_id" // one HTTP request or websocket connection (api.Middleware)
+	JobIDKey     = "job_id"     // one run of a loop job, e.g. "minute/2025-03-10T08:00"
+)
+
+type ctxKey int
+
+const (
+	loggerKey ctxKey = iota
+	fieldsKey
+)
+
+// NewContext returns a copy of ctx carrying l, for FromContext.
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, loggerKey, l)
+}
+
+// FromContext returns the logger stored in ctx with NewContext, with the fields of ctx
+// (ContextWithFields) added, so every line of one request or job carries its IDs. Without
+// a logger in ctx it returns one that writes nothing.
+func FromContext(ctx context.Context) *Logger {
+	l, _ := ctx.Value(loggerKey).(*Logger)
+	if l == nil {
+		l = nop
+	}
+	return l.WithContext(ctx)
+}
+
+// ContextWithFields returns a copy of ctx carrying the key-value pairs (as in Infow) that
+// FromContext and WithContext add to the entries, on top of those already in ctx; a key
+// already in ctx takes the new value.
+func ContextWithFields(ctx context.Context, kv ...any) context.Context {
+	parent, _ := ctx.Value(fieldsKey).([]field)
+	fields := append(append([]field(nil), parent...), kvFields(kv)...)
+	return context.WithValue(ctx, fieldsKey, fields)
+}
+
+// WithContext returns l with the fields of ctx (ContextWithFields), or l itself when ctx
+// has none.
+func (l *Logger) WithContext(ctx context.Context) *Logger {
+	fields, _ := ctx.Value(fieldsKey).([]field)
+	if len(fields) == 0 {
+		return l
+	}
+	m := make(map[string]any, len(fields))
+	for _, f := range fields {
+		m[f.key] = f.val
+	}
+	return l.With(m)
+}
+
+// nop is the logger of FromContext without a logger in the context: its level is above
+// Error, so nothing is formatted, and its core is closed, so nothing is written even after
+// SetLevel.
+var nop = func() *Logger {
+	c := &core{name: "nop", closed: true}
+	c.level.Store(math.MaxInt32)
+	return &Logger{cfg: Config{Name: "nop"}, core: c, std: log.New(io.Discard, "", 0)}
+}()
@@ -0,0 +1,87 @@
+package logger
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Fields added by ErrorE.
+const (
+	ErrorKey      = "error"       // err.Error()
+	ErrorChainKey = "error_chain" // one "type: message" per error in the chain
+	StackKey      = "stack"       // the stack of the call site
+)
+
+// maxStackFrames bounds the frames ErrorE records.
+const maxStackFrames = 32
+
+// ErrorE logs msg at Error level with err broken down into fields: "error" (its message),
+// "error_chain" (every error reached through Unwrap, outermost first, as "type: message",
+// so the *sqlite.Error or *url.Error under a wrapped message stays visible) and "stack"
+// (the stack of the call site, one "function file:line" per frame). kv are extra fields
+// as for Errorw:
+//
+//	l.ErrorE(err, "insert batch failed", "line", line, "rows", len(recs))
+//
+// A nil err logs msg with the stack only.
+func (l *Logger) ErrorE(err error, msg string, kv ...any) {
+	if !l.core.enabled(Error) {
+		return
+	}
+	extra := make([]field, 0, 3)
+	if err != nil {
+		extra = append(extra, field{ErrorKey, err.Error()}, field{ErrorChainKey, errorChain(err)})
+	}
+	extra = append(extra, field{StackKey, stackTrace()})
+	l.logEntry(Error, msg, append(extra, kvFields(kv)...))
+}
+
+// errorChain lists err and the errors it wraps, depth first; errors.Join and multi-%w
+// errors contribute each of their errors.
+func errorChain(err error) []string {
+	var out []string
+	var walk func(error)
+	walk = func(e error) {
+		for e != nil && len(out) < maxStackFrames {
+			out = append(out, fmt.Sprintf("%T: %s", e, e.Error()))
+			if multi, ok := e.(interface{ Unwrap() []error }); ok {
+				for _, inner := range multi.Unwrap() {
+					walk(inner)
+				}
+				return
+			}
+			e = errors.Unwrap(e)
+		}
+	}
+	walk(err)
+	return out
+}
+
+// stackTrace renders the stack of the call site logging through this package (see
+// callerFields), without the runtime's frames.
+func stackTrace() string {
+	var pcs [maxStackFrames + 8]uintptr
+	n := runtime.Callers(3, pcs[:])
+	frames := runtime.CallersFrames(pcs[:n])
+	var b strings.Builder
+	started, count := false, 0
+	for {
+		f, more := frames.Next()
+		if !started && !skipFrame(f) {
+			started = true
+		}
+		if started && !strings.HasPrefix(f.Function, "runtime.") && count < maxStackFrames {
+			if b.Len() > 0 {
+				b.WriteByte('\n')
+			}
+			b.WriteString(trimFunc(f.Function) + " " + trimPath(f.File) + ":" + strconv.Itoa(f.Line))
+			count++
+		}
+		if !more {
+			return b.String()
+		}
+	}
+}
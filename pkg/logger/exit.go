@@ -0,0 +1,71 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// exit ends the process; tests replace it.
+var exit = os.Exit
+
+var exitHooks struct {
+	mu  sync.Mutex
+	fns []func()
+	ran sync.Once
+}
+
+// RegisterExitHook calls fn when the process ends through Fatalf or Exit, before the
+// loggers are flushed, e.g. to stop the loops or close the database. Hooks run once, the
+// last registered first, and may still log; a panicking hook is recovered so the others
+// run.
+func RegisterExitHook(fn func()) {
+	exitHooks.mu.Lock()
+	exitHooks.fns = append(exitHooks.fns, fn)
+	exitHooks.mu.Unlock()
+}
+
+// Exit runs the exit hooks, flushes every logger (FlushAll) and exits with code. Commands
+// use it instead of os.Exit, which skips deferred calls, so the entries still queued with
+// WithAsync or for a remote sink are not lost.
+func Exit(code int) {
+	exitHooks.ran.Do(func() {
+		exitHooks.mu.Lock()
+		fns := exitHooks.fns
+		exitHooks.mu.Unlock()
+		for i := len(fns) - 1; i >= 0; i-- {
+			runExitHook(fns[i])
+		}
+	})
+	FlushAll()
+	exit(code)
+}
+
+func runExitHook(fn func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Fprintf(os.Stderr, "logger: exit hook panicked: %v\n", r)
+		}
+	}()
+	fn()
+}
+
+// Fatalf logs at Fatal level and ends the process with status 1 through Exit, so the exit
+// hooks run and no queued entry is lost. Use it instead of log.Fatalf where a logger is at
+// hand.
+func (l *Logger) Fatalf(format string, args ...any) {
+	l.logf(Fatal, format, args...)
+	Exit(1)
+}
+
+// Panicf logs at Panic level, flushes every logger and panics with the message, so the
+// entries logged so far are written even when nothing recovers the panic. Exit hooks do
+// not run.
+func (l *Logger) Panicf(format string, args ...any) {
+	msg := safeSprintf(format, args...)
+	if l.core.enabled(Panic) {
+		l.logEntry(Panic, msg, nil)
+	}
+	FlushAll()
+	panic(msg)
+}
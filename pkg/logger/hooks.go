@@ -0,0 +1,139 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// hookQueueSize bounds the entries waiting for the hooks of one logger; beyond it entries
+// are not passed to the hooks.
+const hookQueueSize = 256
+
+type hook struct {
+	level Level
+	fn    func(Entry)
+}
+
+// hookRunner calls the hooks of one core from its own goroutine, so a slow hook (e.g. one
+// publishing an alert) never delays logging.
+type hookRunner struct {
+	mu      sync.RWMutex
+	hooks   []hook
+	closed  bool
+	queue   chan queuedEntry
+	done    chan struct{}
+	dropped atomic.Int64
+}
+
+// queuedEntry is an entry for the hooks, or a Flush marker closed once the entries before
+// it are handled.
+type queuedEntry struct {
+	entry   Entry
+	flushed chan struct{}
+}
+
+// RegisterHook calls fn with every entry logged at or above level, asynchronously and in
+// logging order. Hooks belong to the logger and the children created with With. A hook
+// that falls more than 256 entries behind misses entries (counted on stderr), and a
+// panicking hook is recovered; Flush and Close wait for the queued calls.
+func (l *Logger) RegisterHook(level Level, fn func(Entry)) {
+	c := l.core
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	h := c.hooks.Load()
+	if h == nil {
+		h = &hookRunner{queue: make(chan queuedEntry, hookQueueSize), done: make(chan struct{})}
+		go h.run()
+		c.hooks.Store(h)
+	}
+	h.mu.Lock()
+	h.hooks = append(h.hooks, hook{level: level, fn: fn})
+	h.mu.Unlock()
+}
+
+// wants reports whether a hook takes entries at level.
+func (h *hookRunner) wants(level Level) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, hk := range h.hooks {
+		if level >= hk.level {
+			return true
+		}
+	}
+	return false
+}
+
+// dispatch queues e without waiting; a full queue drops it.
+func (h *hookRunner) dispatch(e Entry) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.closed {
+		return
+	}
+	select {
+	case h.queue <- queuedEntry{entry: e}:
+	default:
+		h.dropped.Add(1)
+	}
+}
+
+// flush waits until the entries queued so far are handled.
+func (h *hookRunner) flush() {
+	h.mu.RLock()
+	if h.closed {
+		h.mu.RUnlock()
+		return
+	}
+	flushed := make(chan struct{})
+	h.queue <- queuedEntry{flushed: flushed}
+	h.mu.RUnlock()
+	<-flushed
+}
+
+// close handles the queued entries and stops the goroutine.
+func (h *hookRunner) close() {
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return
+	}
+	h.closed = true
+	close(h.queue)
+	h.mu.Unlock()
+	<-h.done
+}
+
+func (h *hookRunner) run() {
+	defer close(h.done)
+	for q := range h.queue {
+		if q.flushed != nil {
+			close(q.flushed)
+			continue
+		}
+		if n := h.dropped.Swap(0); n > 0 {
+			fmt.Fprintf(os.Stderr, "logger: hooks behind, %d entries skipped\n", n)
+		}
+		h.mu.RLock()
+		hooks := h.hooks
+		h.mu.RUnlock()
+		for _, hk := range hooks {
+			if q.entry.Level >= hk.level {
+				callHook(hk.fn, q.entry)
+			}
+		}
+	}
+}
+
+func callHook(fn func(Entry), e Entry) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Fprintf(os.Stderr, "logger: %s hook panicked: %v\n", e.Name, r)
+		}
+	}()
+	fn(e)
+}
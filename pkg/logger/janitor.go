@@ -0,0 +1,209 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// janitorInterval is how often a janitor sweeps its directory.
+const janitorInterval = time.Hour
+
+// janitor deletes the old log files of one directory (WithMaxAgeDays). Every logger with a
+// max age registers the file pattern it writes, with {name} filled in and the other tokens
+// as wildcards, so the files of earlier runs ({timestamp}_{rand} names, never reopened)
+// and their rotated and dated copies are found. A file is deleted once its last write is
+// older than the largest max age of the patterns it matches; files of other loggers,
+// unregistered patterns and files still open in this process are left alone. One janitor
+// runs per directory while loggers use it, sweeping at start and then every
+// janitorInterval.
+type janitor struct {
+	dir  string
+	refs int // under janitorsMu
+
+	mu    sync.Mutex
+	rules map[janitorRule]int // rule -> loggers registering it
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+type janitorRule struct {
+	pattern string // regexp matched against file names
+	maxAge  time.Duration
+}
+
+var (
+	janitorsMu sync.Mutex
+	janitors   = map[string]*janitor{}
+)
+
+// acquireJanitor registers the files of cfg with the janitor of their directory, starting it
+// on first use, and returns the function undoing it.
+func acquireJanitor(cfg Config) (release func(), err error) {
+	re, err := filePatternRegexp(cfg.FilePattern, cfg.Name)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := filepath.Abs(cfg.Dir)
+	if err != nil {
+		dir = cfg.Dir
+	}
+	rule := janitorRule{pattern: re.String(), maxAge: time.Duration(cfg.MaxAgeDays) * 24 * time.Hour}
+
+	janitorsMu.Lock()
+	j, ok := janitors[dir]
+	if !ok {
+		j = &janitor{dir: dir, rules: map[janitorRule]int{}, stop: make(chan struct{}), done: make(chan struct{})}
+		janitors[dir] = j
+	}
+	j.refs++
+	j.mu.Lock()
+	j.rules[rule]++
+	j.mu.Unlock()
+	janitorsMu.Unlock()
+	if !ok {
+		go j.run()
+	}
+
+	var once sync.Once
+	return func() { once.Do(func() { j.release(rule) }) }, nil
+}
+
+func (j *janitor) release(rule janitorRule) {
+	j.mu.Lock()
+	if j.rules[rule]--; j.rules[rule] == 0 {
+		delete(j.rules, rule)
+	}
+	j.mu.Unlock()
+
+	janitorsMu.Lock()
+	j.refs--
+	last := j.refs == 0
+	if last {
+		delete(janitors, j.dir)
+	}
+	janitorsMu.Unlock()
+	if last {
+		close(j.stop)
+		<-j.done
+	}
+}
+
+func (j *janitor) run() {
+	defer close(j.done)
+	t := time.NewTicker(janitorInterval)
+	defer t.Stop()
+	for {
+		j.sweep()
+		select {
+		case <-j.stop:
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// sweep deletes the expired files of the directory.
+func (j *janitor) sweep() {
+	j.mu.Lock()
+	rules := make([]janitorRule, 0, len(j.rules))
+	for r := range j.rules {
+		rules = append(rules, r)
+	}
+	j.mu.Unlock()
+	res := make([]*regexp.Regexp, len(rules))
+	for i, r := range rules {
+		res[i] = regexp.MustCompile(r.pattern) // compiled by acquireJanitor
+	}
+
+	entries, err := os.ReadDir(j.dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "logger: clean %s: %v\n", j.dir, err)
+		return
+	}
+	now := time.Now()
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+		var maxAge time.Duration
+		for i, r := range rules {
+			if r.maxAge > maxAge && res[i].MatchString(e.Name()) {
+				maxAge = r.maxAge
+			}
+		}
+		if maxAge == 0 {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil || now.Sub(info.ModTime()) <= maxAge {
+			continue
+		}
+		path := filepath.Join(j.dir, e.Name())
+		if isOpenLogFile(path) {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "logger: clean %s: %v\n", j.dir, err)
+		}
+	}
+}
+
+// isOpenLogFile reports whether a logger of this process writes to path.
+func isOpenLogFile(path string) bool {
+	filesMu.Lock()
+	defer filesMu.Unlock()
+	_, ok := files[path]
+	return ok
+}
+
+// fileTokens are the wildcards of the file pattern tokens other than {name}, matching
+// what buildFileName puts in their place.
+var fileTokens = map[string]string{
+	"{timestamp}": `\d{8}_\d{6}\.\d{3}`,
+	"{rand}":      `\d{4}`,
+	"{pid}":       `\d+`,
+}
+
+// filePatternRegexp returns the regexp matching the names of the files buildFileName makes
+// for pattern and name, including their rotated (.N) and dated (.YYYY-MM-DD[.N]) copies.
+func filePatternRegexp(pattern, name string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		pattern = "{name}_{timestamp}_{rand}.log"
+	}
+	if strings.ContainsRune(pattern, '/') || strings.ContainsRune(pattern, os.PathSeparator) {
+		return nil, fmt.Errorf("logger: max age needs a file pattern without directories, got %q", pattern)
+	}
+	var b strings.Builder
+	b.WriteString("^")
+	for rest := pattern; rest != ""; {
+		i := strings.IndexByte(rest, '{')
+		if i < 0 {
+			b.WriteString(regexp.QuoteMeta(rest))
+			break
+		}
+		b.WriteString(regexp.QuoteMeta(rest[:i]))
+		rest = rest[i:]
+		token := rest[:1]
+		if j := strings.IndexByte(rest, '}'); j > 0 {
+			token = rest[:j+1]
+		}
+		switch wild, ok := fileTokens[token]; {
+		case token == "{name}":
+			b.WriteString(regexp.QuoteMeta(sanitize(name)))
+		case ok:
+			b.WriteString(wild)
+		default:
+			token = rest[:1]
+			b.WriteString(regexp.QuoteMeta(token))
+		}
+		rest = rest[len(token):]
+	}
+	b.WriteString(`(\.\d+|\.\d{4}-\d{2}-\d{2}(\.\d+)?)?$`)
+	return regexp.Compile(b.String())
+}
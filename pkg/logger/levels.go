@@ -0,0 +1,201 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// Runtime level control.
+//
+// Every logger registers its core so the minimum level of running loggers can be changed
+// without a restart (admin endpoint, SIGHUP reload). Levels are addressed by logger name;
+// loggers sharing a name (e.g. every "entities" manager) change together.
+//
+// A level spec is a comma separated list of "level" (all loggers) and "name=level" entries,
+// e.g. "info,entities=debug". The LOG_LEVEL variable holds the spec applied at startup.
+
+var registry = struct {
+	mu        sync.Mutex
+	cores     map[*core]Level  // core -> level configured with WithLevel
+	base      *Level           // level applied to every logger, if set
+	overrides map[string]Level // per-name levels, win over base
+}{cores: map[*core]Level{}, overrides: map[string]Level{}}
+
+// ParseLevel parses "debug", "info", "warn"/"warning", "error", "panic" or "fatal"
+// (case-insensitive).
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return Debug, nil
+	case "info":
+		return Info, nil
+	case "warn", "warning":
+		return Warn, nil
+	case "error":
+		return Error, nil
+	case "panic":
+		return Panic, nil
+	case "fatal":
+		return Fatal, nil
+	default:
+		return Info, fmt.Errorf("logger: unknown level %q", s)
+	}
+}
+
+// register sets the effective level of a new core configured with configured and tracks it.
+func register(c *core, configured Level) {
+	loadEnvOnce()
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	c.level.Store(int32(effectiveLevel(c.name, configured)))
+	registry.cores[c] = configured
+}
+
+func unregister(c *core) {
+	registry.mu.Lock()
+	delete(registry.cores, c)
+	registry.mu.Unlock()
+}
+
+// FlushAll flushes every running logger, so a command exiting without closing its loggers
+// (e.g. the entity managers' ones) does not lose the entries still queued with WithAsync
+// or LOG_ASYNC_BUFFER, nor those not yet shipped to a remote sink.
+func FlushAll() {
+	registry.mu.Lock()
+	cores := make([]*core, 0, len(registry.cores))
+	for c := range registry.cores {
+		cores = append(cores, c)
+	}
+	registry.mu.Unlock()
+	for _, c := range cores {
+		c.flush()
+	}
+	flushShippers()
+}
+
+// effectiveLevel must be called with registry.mu held.
+func effectiveLevel(name string, configured Level) Level {
+	if l, ok := registry.overrides[name]; ok {
+		return l
+	}
+	if registry.base != nil {
+		return *registry.base
+	}
+	return configured
+}
+
+// SetLevels sets the level of every logger named name, including ones created later.
+// An empty name sets all loggers and drops per-name levels. It returns the number of
+// running loggers changed.
+func SetLevels(name string, level Level) int {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	if name == "" {
+		registry.base = &level
+		registry.overrides = map[string]Level{}
+	} else {
+		registry.overrides[name] = level
+	}
+	n := 0
+	for c := range registry.cores {
+		if name == "" || c.name == name {
+			c.level.Store(int32(level))
+			n++
+		}
+	}
+	return n
+}
+
+// ApplyLevelSpec replaces all runtime levels with spec (see package comment above).
+// An empty spec restores every logger to the level it was configured with.
+func ApplyLevelSpec(spec string) error {
+	var base *Level
+	overrides := map[string]Level{}
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, lvl, named := strings.Cut(part, "=")
+		if !named {
+			lvl, name = name, ""
+		}
+		level, err := ParseLevel(lvl)
+		if err != nil {
+			return err
+		}
+		if named {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				return fmt.Errorf("logger: missing logger name in %q", part)
+			}
+			overrides[name] = level
+		} else {
+			base = &level
+		}
+	}
+
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	registry.base, registry.overrides = base, overrides
+	for c, configured := range registry.cores {
+		c.level.Store(int32(effectiveLevel(c.name, configured)))
+	}
+	return nil
+}
+
+// Levels returns the current level of every running logger by name. When loggers sharing
+// a name disagree (one changed through SetLevel), the most verbose level is reported.
+func Levels() map[string]Level {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	out := map[string]Level{}
+	for c := range registry.cores {
+		l := Level(c.level.Load())
+		if cur, ok := out[c.name]; !ok || l < cur {
+			out[c.name] = l
+		}
+	}
+	return out
+}
+
+// ReloadLevels re-reads LOG_LEVEL from envFile (falling back to the process environment)
+// and applies it. It returns the spec applied.
+func ReloadLevels(envFile string) (string, error) {
+	spec, ok := readDotEnvValue(envFile, "LOG_LEVEL")
+	if !ok {
+		spec = os.Getenv("LOG_LEVEL")
+	}
+	return spec, ApplyLevelSpec(spec)
+}
+
+// WatchLevelSignal reloads levels from envFile on every SIGHUP until ctx is done, logging
+// the outcome to lgr. Windows never delivers SIGHUP; use the admin endpoint there.
+func WatchLevelSignal(ctx context.Context, envFile string, lgr *Logger) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(ch)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ch:
+				spec, err := ReloadLevels(envFile)
+				if lgr == nil {
+					continue
+				}
+				if err != nil {
+					lgr.Errorf("SIGHUP: log levels not changed: %v", err)
+				} else {
+					lgr.Warnf("SIGHUP: log levels reloaded (LOG_LEVEL=%q)", spec)
+				}
+			}
+		}
+	}()
+}
@@ -2,21 +2,50 @@ package logger
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"math/rand"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 var envOnce sync.Once
 
+// LOG_MAX_SIZE_MB, LOG_MAX_BACKUPS, LOG_DAILY_KEEP_DAYS, LOG_MAX_AGE_DAYS, LOG_ASYNC_BUFFER
+// and LOG_RECENT, read by loadEnvOnce; -1 when unset. LOG_ROTATE_TZ, LOG_CONSOLE_LEVEL and LOG_FILE_LEVEL are nil
+// and LOG_SYSLOG is "" when unset; envRemote (remote.go) is nil when LOG_REMOTE is unset
+// and envSampleWindow is 0 when LOG_SAMPLING is unset; envCaller is nil when LOG_CALLER is unset
+// and envRedact when LOG_REDACT is; envConsoleFormat and envFileFormat are nil when
+// LOG_CONSOLE_FORMAT and LOG_FILE_FORMAT are, and envRemoteLevel when LOG_REMOTE_LEVEL is.
+var (
+	envMaxSizeMB, envMaxBackups, envKeepDays, envAsyncBuffer = -1, -1, -1, -1
+	envRecent, envMaxAgeDays                                 = -1, -1
+	envRotateLoc                                             *time.Location
+	envConsoleLevel, envFileLevel, envRemoteLevel            *Level
+	envSyslog                                                string
+	envSampleFirst                                           int
+	envSampleWindow                                          time.Duration
+	envCaller                                                *bool
+	envRedact                                                []string
+	envConsoleFormat, envFileFormat                          *Format
+)
+
+// DefaultAsyncBuffer is the queue size of WithAsync(0).
+const DefaultAsyncBuffer = 1024
+
+// maxAsyncBatch bounds the bytes the background writer of an async logger gathers into
+// one write.
+const maxAsyncBatch = 64 << 10
+
 // Level represents the severity of a log entry.
-// Order: Debug < Info < Warn < Error
+// Order: Debug < Info < Warn < Error < Panic < Fatal
 //
 // Use WithLevel(...) option to configure the minimum level that will be written.
 // Messages below the level are ignored.
@@ -27,6 +56,8 @@ const (
 	Info
 	Warn
 	Error
+	Panic // Panicf: logged, then the caller panics
+	Fatal // Fatalf: logged, then the process exits
 )
 
 func (l Level) String() string {
@@ -39,6 +70,10 @@ func (l Level) String() string {
 		return "WARN"
 	case Error:
 		return "ERROR"
+	case Panic:
+		return "PANIC"
+	case Fatal:
+		return "FATAL"
 	default:
 		return fmt.Sprintf("LEVEL(%d)", int(l))
 	}
@@ -54,10 +89,65 @@ type Config struct {
 	Dir          string
 	DirSet       bool   // true if set via WithDir
 	FilePattern  string // e.g., "{name}_{timestamp}_{rand}.log"
-	Console      bool   // also write to stdout
-	JSON         bool   // JSON output; otherwise text
+	Console      bool   // also write to stdout (see SetDefaultConsoleWriter)
+	JSON         bool   // JSON output of the sinks in the Plain format; otherwise text
 	TimeFormat   string // time format for text output
 	StaticFields map[string]any
+	MaxSizeMB    int  // roll the file over before it exceeds this size; 0 never rotates (LOG_MAX_SIZE_MB)
+	MaxSizeSet   bool // true if set via WithMaxSizeMB
+	MaxBackups   int  // rolled files kept as <file>.1 .. <file>.N (LOG_MAX_BACKUPS)
+	BackupsSet   bool // true if set via WithMaxBackups
+	Daily        bool // start a new file at midnight, keeping the day as <file>.YYYY-MM-DD
+	KeepDays     int  // dated files kept by daily rotation; 0 keeps all (LOG_DAILY_KEEP_DAYS)
+	DailySet     bool // true if set via WithDailyRotation
+	// RotationLoc is where days start for daily rotation; nil is time.Local (LOG_ROTATE_TZ).
+	RotationLoc *time.Location
+	// MaxAgeDays deletes the files of this logger's pattern in Dir, of earlier runs and
+	// rotated ones, last written more than that many days ago; 0 keeps all
+	// (LOG_MAX_AGE_DAYS). See WithMaxAgeDays.
+	MaxAgeDays  int
+	MaxAgeSet   bool // true if set via WithMaxAgeDays
+	AsyncBuffer int  // entries queued for the background writer; 0 writes synchronously (LOG_ASYNC_BUFFER)
+	AsyncSet    bool // true if set via WithAsync
+	// ConsoleLevel and FileLevel are minimum levels of one sink on top of MinLevel
+	// (LOG_CONSOLE_LEVEL, LOG_FILE_LEVEL); see WithConsoleLevel.
+	ConsoleLevel    Level
+	ConsoleLevelSet bool // true if set via WithConsoleLevel
+	FileLevel       Level
+	FileLevelSet    bool // true if set via WithFileLevel
+	// Syslog also sends the entries written to the file to the local syslog daemon
+	// (journald under systemd) under SyslogTag (LOG_SYSLOG).
+	Syslog    bool
+	SyslogTag string
+	// Remote also ships the entries to a log backend (LOG_REMOTE); see WithRemote.
+	Remote    RemoteSink
+	RemoteSet bool // true if set via WithRemote
+	// RemoteLevel is the minimum level shipped on top of MinLevel (LOG_REMOTE_LEVEL); the
+	// file level without it. See WithRemoteLevel.
+	RemoteLevel    Level
+	RemoteLevelSet bool // true if set via WithRemoteLevel
+	// SampleFirst and SampleWindow suppress repeated identical entries (LOG_SAMPLING);
+	// see WithSampling. A zero window logs every entry.
+	SampleFirst  int
+	SampleWindow time.Duration
+	SamplingSet  bool // true if set via WithSampling
+	// Caller adds the call site to every entry (LOG_CALLER); see WithCaller.
+	Caller    bool
+	CallerSet bool // true if set via WithCaller
+	// Redact lists the field keys whose values are masked (LOG_REDACT); see WithRedaction.
+	Redact    []string
+	RedactSet bool // true if set via WithRedaction
+	// Recent is the number of last entries kept in memory (LOG_RECENT); see WithRecent.
+	Recent    int
+	RecentSet bool // true if set via WithRecent
+	// ConsoleFormat and FileFormat are how entries are written to the console and the file
+	// (LOG_CONSOLE_FORMAT, LOG_FILE_FORMAT); see WithConsoleFormat and WithFileFormat.
+	ConsoleFormat    Format
+	ConsoleFormatSet bool // true if set via WithConsoleFormat
+	FileFormat       Format
+	FileFormatSet    bool // true if set via WithFileFormat
+	// Sinks are written to next to the file and the console; see WithSink.
+	Sinks []Sink
 }
 
 // DefaultConfig returns the default configuration.
@@ -71,6 +161,7 @@ func DefaultConfig() Config {
 		JSON:         false,
 		TimeFormat:   time.RFC3339,
 		StaticFields: map[string]any{},
+		MaxBackups:   5,
 	}
 }
 
@@ -89,6 +180,97 @@ func WithFilePattern(pattern string) Option { return func(c *Config) { c.FilePat
 // WithConsole enables/disables console output.
 func WithConsole(enabled bool) Option { return func(c *Config) { c.Console = enabled } }
 
+// WithConsoleLevel sets the minimum level written to the console, e.g. Warn to keep the
+// console quiet while the file gets every entry. Entries must also pass the logger level;
+// a sink level below it lowers the logger level, and the other sink keeps the logger level
+// as its own.
+func WithConsoleLevel(level Level) Option {
+	return func(c *Config) { c.ConsoleLevel, c.ConsoleLevelSet = level, true }
+}
+
+// WithConsoleFormat sets how entries are written to the console: Plain, the default, in
+// the logger's format (WithJSON); Pretty for reading at a terminal, with colors when the
+// console is one; or Text or JSON. The file is unchanged. Without it the logger uses
+// LOG_CONSOLE_FORMAT, else the format set with SetDefaultConsoleFormat.
+func WithConsoleFormat(f Format) Option {
+	return func(c *Config) { c.ConsoleFormat, c.ConsoleFormatSet = f, true }
+}
+
+// WithFileFormat sets how entries are written to the log file, e.g. JSON for a collector
+// while the console stays text: Plain, the default, in the logger's format (WithJSON), or
+// Text or JSON. Syslog gets the file's lines. Without it the logger uses LOG_FILE_FORMAT.
+func WithFileFormat(f Format) Option {
+	return func(c *Config) { c.FileFormat, c.FileFormatSet = f, true }
+}
+
+// WithSink also writes the entries at level or above, and passing the logger level, to w
+// in format f, e.g. a TCP connection to a log collector taking JSON lines. Every call adds
+// a sink. Writes happen in the caller, or in the background writer with WithAsync, and
+// their errors are ignored; w must be safe for concurrent use when several loggers share
+// it. The logger does not close w.
+func WithSink(w io.Writer, f Format, level Level) Option {
+	return func(c *Config) { c.Sinks = append(c.Sinks, Sink{Writer: w, Format: f, Level: level}) }
+}
+
+// WithFileLevel sets the minimum level written to the log file; see WithConsoleLevel.
+func WithFileLevel(level Level) Option {
+	return func(c *Config) { c.FileLevel, c.FileLevelSet = level, true }
+}
+
+// WithSyslog also sends the entries written to the file to the local syslog daemon, or
+// journald under systemd, tagged tag (`journalctl -t tag`); an empty tag uses the logger
+// name. Entries keep their level as the syslog priority. When syslog is unreachable the
+// logger warns on stderr and writes the file only. Not available on Windows.
+func WithSyslog(tag string) Option { return func(c *Config) { c.Syslog, c.SyslogTag = true, tag } }
+
+// WithRemote also ships the entries written to the file to sink, e.g. NewLokiSink or
+// NewOTLPSink, in batches from a background goroutine; logging never waits for it. A nil
+// sink turns off the sink of LOG_REMOTE.
+func WithRemote(sink RemoteSink) Option {
+	return func(c *Config) { c.Remote, c.RemoteSet = sink, true }
+}
+
+// WithRemoteLevel ships the entries at level or above, and passing the logger level, to
+// the remote sink instead of those written to the file, e.g. Warn to ship only problems
+// while the file keeps every entry.
+func WithRemoteLevel(level Level) Option {
+	return func(c *Config) { c.RemoteLevel, c.RemoteLevelSet = level, true }
+}
+
+// WithSampling suppresses repeated identical entries (same level, message and fields):
+// of the entries identical to one logged, those within window after it beyond the first
+// are not written but counted, and when the window ends one entry with the message,
+// " (repeated N times in D)" and a "repeated" field reports them. window <= 0 logs every
+// entry, turning off LOG_SAMPLING.
+func WithSampling(first int, window time.Duration) Option {
+	return func(c *Config) { c.SampleFirst, c.SampleWindow, c.SamplingSet = first, window, true }
+}
+
+// WithCaller adds the call site of every entry as the fields "caller" (the file's
+// directory and name with the line, e.g. "entities/record_entity.go:391") and "func"
+// ("entities.(*RecordEntityManager).InsertBatch"), in text and JSON output alike. Functions
+// marked with Helper are skipped. It costs a stack walk per entry written.
+func WithCaller(enabled bool) Option {
+	return func(c *Config) { c.Caller, c.CallerSet = enabled, true }
+}
+
+// WithRedaction masks the values of the fields named by keys (case-insensitive), e.g.
+// "employee_name", "ppid" or "token", as "[REDACTED]" in every sink and in the entries
+// passed to hooks, so logs can be shared outside the plant. It covers the logger's fields
+// (WithStaticFields, With) and the entry's (the *w methods); values formatted into the
+// message are not masked. Redacting "error" also masks the "error_chain" of ErrorE. No
+// keys turns off LOG_REDACT.
+func WithRedaction(keys []string) Option {
+	return func(c *Config) { c.Redact, c.RedactSet = append([]string(nil), keys...), true }
+}
+
+// WithRecent keeps the last n entries in memory for Logger.Recent and the package-level
+// Recent, which the services serve at /logz; 0 keeps none. Without it the logger keeps
+// LOG_RECENT entries, else the count set with SetDefaultRecent.
+func WithRecent(n int) Option {
+	return func(c *Config) { c.Recent, c.RecentSet = max(n, 0), true }
+}
+
 // WithJSON enables/disables JSON output.
 func WithJSON(enabled bool) Option { return func(c *Config) { c.JSON = enabled } }
 
@@ -100,15 +282,203 @@ func WithStaticFields(fields map[string]any) Option {
 	return func(c *Config) { c.StaticFields = cloneMap(fields) }
 }
 
+// WithMaxSizeMB rolls the log file over once it would exceed mb megabytes; 0 disables rotation.
+func WithMaxSizeMB(mb int) Option { return func(c *Config) { c.MaxSizeMB = mb; c.MaxSizeSet = true } }
+
+// WithMaxBackups sets how many rolled files are kept; 0 discards the file when it rolls over.
+func WithMaxBackups(n int) Option { return func(c *Config) { c.MaxBackups = n; c.BackupsSet = true } }
+
+// WithDailyRotation starts a new file at midnight and keeps keepDays days of history
+// (0 keeps all). It combines with WithMaxSizeMB.
+func WithDailyRotation(keepDays int) Option {
+	return func(c *Config) { c.Daily, c.KeepDays, c.DailySet = true, keepDays, true }
+}
+
+// WithMaxAgeDays deletes, in the background, the files in the log directory matching this
+// logger's file pattern whose last write is more than days ago: the {timestamp}_{rand}
+// files of earlier runs and the rotated and dated copies. Files in use are kept; 0 keeps
+// all.
+func WithMaxAgeDays(days int) Option {
+	return func(c *Config) { c.MaxAgeDays, c.MaxAgeSet = days, true }
+}
+
+// WithAsync queues entries to a background writer instead of writing them in the caller,
+// which then only formats the entry. Queued entries are written in batches; when
+// bufferSize entries are pending, callers wait for the writer, so no entry is dropped.
+// Flush waits for the entries logged so far and Close flushes. bufferSize <= 0 uses
+// DefaultAsyncBuffer.
+func WithAsync(bufferSize int) Option {
+	return func(c *Config) {
+		if bufferSize <= 0 {
+			bufferSize = DefaultAsyncBuffer
+		}
+		c.AsyncBuffer, c.AsyncSet = bufferSize, true
+	}
+}
+
+// WithRotationLocation sets the time zone whose midnight starts a new file with daily rotation.
+func WithRotationLocation(loc *time.Location) Option { return func(c *Config) { c.RotationLoc = loc } }
+
+var (
+	consoleMu sync.Mutex
+	consoleW  io.Writer = os.Stdout
+)
+
+// SetDefaultConsoleWriter changes where console output of loggers created afterwards goes
+// (stdout by default). CLIs printing machine-readable results use it to move logs to stderr.
+func SetDefaultConsoleWriter(w io.Writer) {
+	if w == nil {
+		w = os.Stdout
+	}
+	consoleMu.Lock()
+	consoleW = w
+	consoleMu.Unlock()
+}
+
+func defaultConsoleWriter() io.Writer {
+	consoleMu.Lock()
+	defer consoleMu.Unlock()
+	return consoleW
+}
+
 // Logger is a flexible, leveled, structured logger with per-instance file.
 type Logger struct {
 	cfg    Config
-	mu     sync.Mutex
-	out    io.Writer
+	core   *core
 	std    *log.Logger    // standard logger adapter
-	file   *os.File       // owned file (per instance)
 	fields map[string]any // contextual fields
-	closed bool
+}
+
+// core is the state shared by a logger and the children created with With:
+// outputs, owned file and the minimum level, which can change at runtime.
+type core struct {
+	name    string
+	level   atomic.Int32
+	mu      sync.Mutex
+	outputs []*output                  // the file first, then the console and the sinks
+	file    *logFile                   // file, shared with the other loggers writing to the same path
+	syslog  *syslogSink                // nil without WithSyslog; shared by the loggers with its tag
+	remote  *shipper                   // nil without a remote sink; shared by the loggers with the sink
+	sampler *sampler                   // nil without sampling
+	redact  redactor                   // nil without WithRedaction
+	recent  *ring                      // nil without WithRecent
+	janitor func()                     // releases the old-file janitor; nil without WithMaxAgeDays
+	hooks   atomic.Pointer[hookRunner] // nil until RegisterHook
+	closed  bool
+
+	// remoteLevel filters the entries passing level for the remote sink, and minOutput is
+	// the lowest level of the outputs and the remote sink; Debug filters nothing.
+	remoteLevel, minOutput Level
+
+	// With WithAsync, entries go through queue to the writer goroutine (run), which
+	// closes done once queue is closed and drained.
+	queue chan queued
+	done  chan struct{}
+}
+
+// queued is an entry for the writer goroutine, or a Flush marker closed once the entries
+// before it are written.
+type queued struct {
+	level   Level
+	lines   [][]byte // per output, nil for those the entry does not reach
+	flushed chan struct{}
+}
+
+// enabled reports whether an entry at level reaches any sink, so that others are not
+// formatted.
+func (c *core) enabled(level Level) bool {
+	return level >= Level(c.level.Load()) && level >= c.minOutput
+}
+
+// write writes the formatted lines of an entry to their outputs, or queues them with
+// WithAsync.
+func (c *core) write(level Level, lines [][]byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	if c.queue != nil {
+		c.queue <- queued{level: level, lines: lines}
+		return
+	}
+	for i, line := range lines {
+		if line != nil {
+			c.outputs[i].write(level, line)
+		}
+	}
+}
+
+// run writes the queued entries, gathering those already waiting into one write per output.
+func (c *core) run() {
+	defer close(c.done)
+	size := 0
+	add := func(e queued) {
+		for i, line := range e.lines {
+			if line == nil {
+				continue
+			}
+			o := c.outputs[i]
+			o.batch = append(o.batch, line...)
+			if o.syslog != nil {
+				o.syslog.write(e.level, line) // one message per entry
+			}
+			size += len(line)
+		}
+	}
+	for e := range c.queue {
+		for _, o := range c.outputs {
+			o.batch = o.batch[:0]
+		}
+		size = 0
+		add(e)
+		flushed := e.flushed
+	batch:
+		for flushed == nil && size < maxAsyncBatch {
+			select {
+			case next, ok := <-c.queue:
+				if !ok {
+					break batch
+				}
+				add(next)
+				flushed = next.flushed
+			default:
+				break batch
+			}
+		}
+		for _, o := range c.outputs {
+			if len(o.batch) > 0 {
+				_, _ = o.w.Write(o.batch)
+			}
+		}
+		if flushed != nil {
+			close(flushed)
+		}
+	}
+}
+
+// flush logs the summaries of the sampled entries and waits until the entries queued so
+// far are written.
+func (c *core) flush() {
+	if c.sampler != nil {
+		c.sampler.flush()
+	}
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	if c.queue != nil {
+		flushed := make(chan struct{})
+		c.queue <- queued{flushed: flushed}
+		c.mu.Unlock()
+		<-flushed
+	} else {
+		c.mu.Unlock()
+	}
+	if h := c.hooks.Load(); h != nil {
+		h.flush()
+	}
 }
 
 // New creates a new Logger instance with its own file.
@@ -129,6 +499,65 @@ func New(opts ...Option) (*Logger, error) {
 	if strings.TrimSpace(cfg.Dir) == "" {
 		cfg.Dir = "logs"
 	}
+	if !cfg.MaxSizeSet && envMaxSizeMB >= 0 {
+		cfg.MaxSizeMB = envMaxSizeMB
+	}
+	if !cfg.BackupsSet && envMaxBackups >= 0 {
+		cfg.MaxBackups = envMaxBackups
+	}
+	if !cfg.DailySet && envKeepDays > 0 {
+		cfg.Daily, cfg.KeepDays = true, envKeepDays
+	}
+	if cfg.RotationLoc == nil {
+		cfg.RotationLoc = envRotateLoc
+	}
+	if !cfg.MaxAgeSet && envMaxAgeDays > 0 {
+		cfg.MaxAgeDays = envMaxAgeDays
+	}
+	if !cfg.AsyncSet && envAsyncBuffer > 0 {
+		cfg.AsyncBuffer = envAsyncBuffer
+	}
+	if !cfg.Syslog && envSyslog != "" {
+		cfg.Syslog, cfg.SyslogTag = true, envSyslog
+	}
+	if !cfg.RemoteSet {
+		cfg.Remote = envRemote
+	}
+	if !cfg.SamplingSet && envSampleWindow > 0 {
+		cfg.SampleFirst, cfg.SampleWindow = envSampleFirst, envSampleWindow
+	}
+	if !cfg.CallerSet && envCaller != nil {
+		cfg.Caller = *envCaller
+	}
+	if !cfg.RecentSet {
+		cfg.Recent = defaultRecentSize()
+		if envRecent >= 0 {
+			cfg.Recent = envRecent
+		}
+	}
+	if !cfg.ConsoleFormatSet {
+		if f, ok := defaultConsoleFormat(); ok {
+			cfg.ConsoleFormat = f
+		}
+		if envConsoleFormat != nil {
+			cfg.ConsoleFormat = *envConsoleFormat
+		}
+	}
+	if !cfg.FileFormatSet && envFileFormat != nil {
+		cfg.FileFormat = *envFileFormat
+	}
+	if !cfg.RedactSet && envRedact != nil {
+		cfg.Redact = envRedact
+	}
+	if !cfg.ConsoleLevelSet && envConsoleLevel != nil {
+		cfg.ConsoleLevel, cfg.ConsoleLevelSet = *envConsoleLevel, true
+	}
+	if !cfg.FileLevelSet && envFileLevel != nil {
+		cfg.FileLevel, cfg.FileLevelSet = *envFileLevel, true
+	}
+	if !cfg.RemoteLevelSet && envRemoteLevel != nil {
+		cfg.RemoteLevel, cfg.RemoteLevelSet = *envRemoteLevel, true
+	}
 
 	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
 		return nil, fmt.Errorf("logger: create dir: %w", err)
@@ -136,50 +565,157 @@ func New(opts ...Option) (*Logger, error) {
 
 	fileName := buildFileName(cfg)
 	filePath := filepath.Join(cfg.Dir, fileName)
-	f, err := os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	f, err := openLogFile(filePath, rotation{maxSize: int64(cfg.MaxSizeMB) << 20, maxBackups: cfg.MaxBackups,
+		daily: cfg.Daily, keepDays: cfg.KeepDays, loc: cfg.RotationLoc})
 	if err != nil {
 		return nil, fmt.Errorf("logger: open file: %w", err)
 	}
 
-	var w io.Writer = f
+	c := &core{name: cfg.Name, file: f, redact: newRedactor(cfg.Redact)}
+	if cfg.MaxAgeDays > 0 {
+		if c.janitor, err = acquireJanitor(cfg); err != nil {
+			fmt.Fprintf(os.Stderr, "logger: %s: old files are not deleted: %v\n", cfg.Name, err)
+		}
+	}
+	var fileLevel, consoleLevel Level
+	cfg.MinLevel, fileLevel, consoleLevel = sinkLevels(cfg)
+	fileOut := newOutput(f, cfg.FileFormat, cfg.JSON, fileLevel)
+	c.outputs = []*output{fileOut}
 	if cfg.Console {
-		w = io.MultiWriter(f, os.Stdout)
+		c.outputs = append(c.outputs, newOutput(defaultConsoleWriter(), cfg.ConsoleFormat, cfg.JSON, consoleLevel))
+	}
+	for _, s := range cfg.Sinks {
+		if s.Writer != nil {
+			c.outputs = append(c.outputs, newOutput(s.Writer, s.Format, cfg.JSON, s.Level))
+		}
+	}
+	if cfg.Syslog {
+		tag := cfg.SyslogTag
+		if tag == "" {
+			tag = cfg.Name
+		}
+		if c.syslog, err = openSyslog(tag); err != nil {
+			fmt.Fprintf(os.Stderr, "logger: %s: syslog unavailable, writing the file only: %v\n", cfg.Name, err)
+		}
+		fileOut.syslog = c.syslog
+	}
+	c.minOutput = Error
+	for _, o := range c.outputs {
+		c.minOutput = min(c.minOutput, o.level)
+	}
+	if cfg.Remote != nil {
+		c.remote = openShipper(cfg.Remote)
+		c.remoteLevel = fileLevel
+		if cfg.RemoteLevelSet {
+			c.remoteLevel = cfg.RemoteLevel
+		}
+		c.minOutput = min(c.minOutput, c.remoteLevel)
+	}
+	if cfg.SampleWindow > 0 {
+		c.sampler = newSampler(cfg.SampleFirst, cfg.SampleWindow)
+	}
+	if cfg.Recent > 0 {
+		c.recent = newRing(cfg.Recent)
 	}
+	if cfg.AsyncBuffer > 0 {
+		c.queue, c.done = make(chan queued, cfg.AsyncBuffer), make(chan struct{})
+		go c.run()
+	}
+	register(c, cfg.MinLevel)
 
 	l := &Logger{
 		cfg:    cfg,
-		out:    w,
+		core:   c,
 		std:    log.New(io.Discard, "", 0), // replaced by adapter below
-		file:   f,
-		fields: cloneMap(cfg.StaticFields),
+		fields: c.redact.fieldMap(cloneMap(cfg.StaticFields)),
 	}
 	// std logger will write via Info level formatting through the adapter writer
 	l.std = log.New(&adapterWriter{l: l}, "", 0)
 	return l, nil
 }
 
-// Close closes the underlying file of this logger. Safe to call multiple times.
+// sinkLevels returns the logger level and the file and console levels of cfg. A sink
+// without a level of its own filters nothing beyond the logger level, so runtime level
+// changes reach it, unless the other sink's level lowered the logger level: it then keeps
+// the configured level.
+func sinkLevels(cfg Config) (minLevel, fileLevel, consoleLevel Level) {
+	minLevel, fileLevel, consoleLevel = cfg.MinLevel, Debug, Debug
+	if cfg.FileLevelSet {
+		fileLevel = cfg.FileLevel
+	}
+	if cfg.ConsoleLevelSet {
+		consoleLevel = cfg.ConsoleLevel
+	}
+	if cfg.FileLevelSet && fileLevel < minLevel || cfg.ConsoleLevelSet && consoleLevel < minLevel {
+		if !cfg.FileLevelSet {
+			fileLevel = minLevel
+		}
+		if !cfg.ConsoleLevelSet {
+			consoleLevel = minLevel
+		}
+		minLevel = min(fileLevel, consoleLevel)
+	}
+	return minLevel, fileLevel, consoleLevel
+}
+
+// Close writes the queued entries of an async logger and closes the underlying file of this
+// logger. Safe to call multiple times.
 func (l *Logger) Close() error {
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	if l.closed {
+	c := l.core
+	// before taking c.mu: the summaries are logged, and a hook may log through this logger
+	if c.sampler != nil {
+		c.sampler.close()
+	}
+	if h := c.hooks.Load(); h != nil {
+		h.close()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
 		return nil
 	}
-	l.closed = true
-	if l.file != nil {
-		return l.file.Close()
+	c.closed = true
+	unregister(c)
+	if c.queue != nil {
+		close(c.queue)
+		<-c.done
+	}
+	if c.remote != nil {
+		c.remote.release()
+	}
+	if c.janitor != nil {
+		c.janitor()
+	}
+	if c.file != nil {
+		err := c.file.release()
+		if c.syslog != nil {
+			err = errors.Join(err, c.syslog.release())
+		}
+		return err
 	}
 	return nil
 }
 
+// Flush waits until the entries logged so far are written and passed to the hooks. It
+// returns at once for loggers without WithAsync or hooks, which write in the caller. With
+// WithSampling it first logs the suppressed counts so far, starting new windows.
+func (l *Logger) Flush() { l.core.flush() }
+
+// Level returns the current minimum level.
+func (l *Logger) Level() Level { return Level(l.core.level.Load()) }
+
+// SetLevel changes the minimum level at runtime; it applies to children created with With.
+func (l *Logger) SetLevel(level Level) { l.core.level.Store(int32(level)) }
+
 // StdLogger returns a *log.Logger adapter that writes using Info level formatting.
 func (l *Logger) StdLogger() *log.Logger { return l.std }
 
 // With returns a child logger that will include the given fields on every entry.
+// The child shares the parent's output, file and level.
 func (l *Logger) With(fields map[string]any) *Logger {
-	child := *l // shallow copy
-	child.fields = mergeMaps(l.fields, fields)
-	return &child
+	child := &Logger{cfg: l.cfg, core: l.core, fields: l.core.redact.fieldMap(mergeMaps(l.fields, fields))}
+	child.std = log.New(&adapterWriter{l: child}, "", 0)
+	return child
 }
 
 // Printf is provided for compatibility with existing code and logs at Info level.
@@ -190,58 +726,209 @@ func (l *Logger) Infof(format string, args ...any)  { l.logf(Info, format, args.
 func (l *Logger) Warnf(format string, args ...any)  { l.logf(Warn, format, args...) }
 func (l *Logger) Errorf(format string, args ...any) { l.logf(Error, format, args...) }
 
+// Debugw, Infow, Warnw and Errorw log msg with the key-value pairs kv as fields of this
+// entry only, on top of the logger's own fields:
+//
+//	l.Infow("batch inserted", "line", line, "rows", n)
+//
+// Keys are strings; an error value is written as its message. A key without a value or a
+// value where a key is expected is kept under "!BADKEY".
+func (l *Logger) Debugw(msg string, kv ...any) { l.logw(Debug, msg, kv) }
+func (l *Logger) Infow(msg string, kv ...any)  { l.logw(Info, msg, kv) }
+func (l *Logger) Warnw(msg string, kv ...any)  { l.logw(Warn, msg, kv) }
+func (l *Logger) Errorw(msg string, kv ...any) { l.logw(Error, msg, kv) }
+
 func (l *Logger) logf(level Level, format string, args ...any) {
-	if level < l.cfg.MinLevel {
+	if !l.core.enabled(level) {
+		return
+	}
+	l.logEntry(level, safeSprintf(format, args...), nil)
+}
+
+func (l *Logger) logw(level Level, msg string, kv []any) {
+	if !l.core.enabled(level) {
 		return
 	}
-	msg := safeSprintf(format, args...)
-	entryTime := time.Now()
+	l.logEntry(level, msg, kvFields(kv))
+}
+
+// logEntry writes an entry that passed the level check; extra are its own fields.
+func (l *Logger) logEntry(level Level, msg string, extra []field) {
+	if l.cfg.Caller {
+		extra = append(callerFields(), extra...)
+	}
+	l.logEntryAt(level, msg, time.Now(), extra)
+}
 
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	if l.closed {
+// logEntryAt is logEntry for an entry whose time and caller fields are already known
+// (SlogHandler).
+func (l *Logger) logEntryAt(level Level, msg string, now time.Time, extra []field) {
+	extra = l.core.redact.fields(extra)
+	if s := l.core.sampler; s != nil && !s.allow(l, level, msg, extra, now) {
 		return
 	}
+	l.write(level, msg, now, extra)
+	l.emit(level, msg, now, extra)
+}
 
-	if l.cfg.JSON {
-		// JSON structured line
-		payload := map[string]any{
-			"ts":    entryTime.Format(time.RFC3339Nano),
-			"level": level.String(),
-			"name":  l.cfg.Name,
-			"msg":   msg,
+// write formats an entry for the outputs whose level it passes, once per format, and
+// writes it.
+func (l *Logger) write(level Level, msg string, entryTime time.Time, extra []field) {
+	outputs := l.core.outputs
+	lines := make([][]byte, len(outputs))
+	for i, o := range outputs {
+		if level < o.level {
+			continue
 		}
-		for k, v := range l.fields {
-			payload[k] = v
+		for j, prev := range outputs[:i] {
+			if lines[j] != nil && prev.format == o.format && prev.color == o.color {
+				lines[i] = lines[j]
+				break
+			}
 		}
-		b, err := json.Marshal(payload)
-		if err != nil {
-			// fallback to text formatting if JSON fails
-			fmt.Fprintf(l.out, "%s [%s] %s | %s\n", entryTime.Format(l.cfg.TimeFormat), level.String(), l.cfg.Name, msg)
-			return
+		if lines[i] == nil {
+			lines[i] = l.format(o.format, o.color, level, msg, entryTime, extra)
 		}
-		fmt.Fprintln(l.out, string(b))
-		return
 	}
+	l.core.write(level, lines)
+}
 
-	// Text line
-	if len(l.fields) == 0 {
-		fmt.Fprintf(l.out, "%s [%s] %s | %s\n", entryTime.Format(l.cfg.TimeFormat), level.String(), l.cfg.Name, msg)
+// emit hands an entry to the hooks, to the remote sink at its level, and to the recent
+// entries.
+func (l *Logger) emit(level Level, msg string, entryTime time.Time, extra []field) {
+	c := l.core
+	h := c.hooks.Load()
+	toHooks := h != nil && h.wants(level)
+	toRemote := c.remote != nil && level >= c.remoteLevel
+	if !toHooks && !toRemote && c.recent == nil {
 		return
 	}
-	// include fields as key=value
-	var b strings.Builder
-	first := true
+	fields := cloneMap(l.fields)
+	for _, f := range extra {
+		fields[f.key] = f.val
+	}
+	e := Entry{Time: entryTime, Level: level, Name: l.cfg.Name, Msg: msg, Fields: fields}
+	if toHooks {
+		h.dispatch(e)
+	}
+	if toRemote {
+		c.remote.enqueue(e)
+	}
+	if c.recent != nil {
+		c.recent.add(e)
+	}
+}
+
+// field is one key-value pair passed to a *w method.
+type field struct {
+	key string
+	val any
+}
+
+const badKey = "!BADKEY"
+
+// kvFields pairs up kv the way the *w methods document.
+func kvFields(kv []any) []field {
+	out := make([]field, 0, (len(kv)+1)/2)
+	for i := 0; i < len(kv); {
+		key, ok := kv[i].(string)
+		if !ok || i+1 == len(kv) {
+			out = append(out, field{badKey, fieldValue(kv[i])})
+			i++
+			continue
+		}
+		out = append(out, field{key, fieldValue(kv[i+1])})
+		i += 2
+	}
+	return out
+}
+
+// fieldValue keeps an error readable: encoding/json would write it as {}.
+func fieldValue(v any) any {
+	if err, ok := v.(error); ok && err != nil {
+		return err.Error()
+	}
+	return v
+}
+
+// format renders one entry in f (not Plain), outside the core lock. extra are the
+// per-entry fields; they win over the logger's fields of the same key.
+func (l *Logger) format(f Format, color bool, level Level, msg string, entryTime time.Time, extra []field) []byte {
+	switch f {
+	case Pretty:
+		return l.formatPretty(level, msg, entryTime, extra, color)
+	case JSON:
+		return l.formatJSON(level, msg, entryTime, extra)
+	default:
+		return l.formatText(level, msg, entryTime, extra)
+	}
+}
+
+// formatJSON renders one entry as a JSON object on one line.
+func (l *Logger) formatJSON(level Level, msg string, entryTime time.Time, extra []field) []byte {
+	payload := map[string]any{
+		"ts":    entryTime.Format(time.RFC3339Nano),
+		"level": level.String(),
+		"name":  l.cfg.Name,
+		"msg":   msg,
+	}
 	for k, v := range l.fields {
-		if !first {
+		payload[k] = v
+	}
+	for _, f := range extra {
+		payload[f.key] = f.val
+	}
+	b, err := json.Marshal(payload)
+	if err == nil {
+		return append(b, '\n')
+	}
+	// fallback to text formatting if JSON fails
+	return fmt.Appendf(nil, "%s [%s] %s | %s\n", entryTime.Format(l.cfg.TimeFormat), level.String(), l.cfg.Name, msg)
+}
+
+// formatText renders one entry as a text line, the fields as key=value pairs.
+func (l *Logger) formatText(level Level, msg string, entryTime time.Time, extra []field) []byte {
+	if len(l.fields) == 0 && len(extra) == 0 {
+		return fmt.Appendf(nil, "%s [%s] %s | %s\n", entryTime.Format(l.cfg.TimeFormat), level.String(), l.cfg.Name, msg)
+	}
+	// include fields as key=value, the logger's first and then the entry's in call order
+	var b strings.Builder
+	writeField := func(k string, v any) {
+		if b.Len() > 0 {
 			b.WriteString(" ")
 		}
-		first = false
 		b.WriteString(k)
 		b.WriteString("=")
-		b.WriteString(fmt.Sprint(v))
+		b.WriteString(textValue(v))
+	}
+	for k, v := range l.fields {
+		if !hasKey(extra, k) {
+			writeField(k, v)
+		}
+	}
+	for _, f := range extra {
+		writeField(f.key, f.val)
+	}
+	return fmt.Appendf(nil, "%s [%s] %s | %s | %s\n", entryTime.Format(l.cfg.TimeFormat), level.String(), l.cfg.Name, b.String(), msg)
+}
+
+func hasKey(fields []field, key string) bool {
+	for _, f := range fields {
+		if f.key == key {
+			return true
+		}
 	}
-	fmt.Fprintf(l.out, "%s [%s] %s | %s | %s\n", entryTime.Format(l.cfg.TimeFormat), level.String(), l.cfg.Name, b.String(), msg)
+	return false
+}
+
+// textValue renders a field value for the text format, quoted when it would not read back
+// as one k=v token (see parseTextFields).
+func textValue(v any) string {
+	s := fmt.Sprint(v)
+	if s == "" || strings.ContainsAny(s, " \t\r\n\"=|") {
+		return strconv.Quote(s)
+	}
+	return s
 }
 
 // adapterWriter allows using the logger as io.Writer for the std logger adapter.
@@ -300,22 +987,129 @@ func mergeMaps(a, b map[string]any) map[string]any {
 	return res
 }
 
-// loadEnvOnce ensures .env is loaded at most once for LOG_DIR.
+// loadEnvOnce ensures .env is loaded at most once for LOG_DIR, LOG_LEVEL, the rotation
+// settings and LOG_ASYNC_BUFFER.
 func loadEnvOnce() {
 	envOnce.Do(func() {
 		loadDotEnv()
+		envMaxSizeMB = envInt("LOG_MAX_SIZE_MB")
+		envMaxBackups = envInt("LOG_MAX_BACKUPS")
+		envKeepDays = envInt("LOG_DAILY_KEEP_DAYS")
+		envAsyncBuffer = envInt("LOG_ASYNC_BUFFER")
+		envRecent = envInt("LOG_RECENT")
+		envMaxAgeDays = envInt("LOG_MAX_AGE_DAYS")
+		if tz := strings.TrimSpace(os.Getenv("LOG_ROTATE_TZ")); tz != "" {
+			loc, err := time.LoadLocation(tz)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "logger: ignoring LOG_ROTATE_TZ: %v\n", err)
+			}
+			envRotateLoc = loc
+		}
+		envConsoleLevel = envLevel("LOG_CONSOLE_LEVEL")
+		envFileLevel = envLevel("LOG_FILE_LEVEL")
+		envRemoteLevel = envLevel("LOG_REMOTE_LEVEL")
+		envSyslog = strings.TrimSpace(os.Getenv("LOG_SYSLOG"))
+		if spec := strings.TrimSpace(os.Getenv("LOG_REMOTE")); spec != "" {
+			sink, err := parseRemoteSpec(spec, os.Getenv("LOG_REMOTE_LABELS"))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "logger: ignoring LOG_REMOTE: %v\n", err)
+			}
+			envRemote = sink
+		}
+		if v := strings.TrimSpace(os.Getenv("LOG_CALLER")); v != "" {
+			if on, err := strconv.ParseBool(v); err != nil {
+				fmt.Fprintf(os.Stderr, "logger: ignoring LOG_CALLER=%q\n", v)
+			} else {
+				envCaller = &on
+			}
+		}
+		envConsoleFormat = envFormat("LOG_CONSOLE_FORMAT")
+		envFileFormat = envFormat("LOG_FILE_FORMAT")
+		if spec := strings.TrimSpace(os.Getenv("LOG_REDACT")); spec != "" {
+			envRedact = parseRedact(spec)
+		}
+		if spec := strings.TrimSpace(os.Getenv("LOG_SAMPLING")); spec != "" {
+			first, window, err := parseSampling(spec)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "logger: ignoring LOG_SAMPLING: %v\n", err)
+			}
+			envSampleFirst, envSampleWindow = first, window
+		}
+		spec := os.Getenv("LOG_LEVEL")
+		if strings.TrimSpace(spec) == "" {
+			spec, _ = readDotEnvValue(".env", "LOG_LEVEL")
+		}
+		if strings.TrimSpace(spec) != "" {
+			if err := ApplyLevelSpec(spec); err != nil {
+				fmt.Fprintf(os.Stderr, "logger: ignoring LOG_LEVEL: %v\n", err)
+			}
+		}
 	})
 }
 
-// loadDotEnv loads LOG_DIR from a .env file in the current working directory
-// if it's not already set in the environment.
+// loadDotEnv loads LOG_DIR, the rotation settings, LOG_ASYNC_BUFFER and the sink settings from a .env
+// file in the current working directory if they're not already set in the environment.
 func loadDotEnv() {
-	if strings.TrimSpace(os.Getenv("LOG_DIR")) != "" {
-		return
+	for _, key := range []string{"LOG_DIR", "LOG_MAX_SIZE_MB", "LOG_MAX_BACKUPS", "LOG_DAILY_KEEP_DAYS", "LOG_MAX_AGE_DAYS", "LOG_ROTATE_TZ",
+		"LOG_ASYNC_BUFFER", "LOG_CONSOLE_LEVEL", "LOG_FILE_LEVEL", "LOG_SYSLOG",
+		"LOG_REMOTE", "LOG_REMOTE_LABELS", "LOG_SAMPLING", "LOG_CALLER", "LOG_REDACT", "LOG_RECENT",
+		"LOG_CONSOLE_FORMAT", "LOG_FILE_FORMAT", "LOG_REMOTE_LEVEL"} {
+		if strings.TrimSpace(os.Getenv(key)) != "" {
+			continue
+		}
+		if val, ok := readDotEnvValue(".env", key); ok && val != "" {
+			_ = os.Setenv(key, val)
+		}
+	}
+}
+
+// envInt returns the non-negative integer in env var key, or -1 when unset or invalid.
+func envInt(key string) int {
+	v := strings.TrimSpace(os.Getenv(key))
+	if v == "" {
+		return -1
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		fmt.Fprintf(os.Stderr, "logger: ignoring %s=%q\n", key, v)
+		return -1
+	}
+	return n
+}
+
+// envLevel returns the level in env var key, or nil when unset or invalid.
+func envLevel(key string) *Level {
+	v := strings.TrimSpace(os.Getenv(key))
+	if v == "" {
+		return nil
 	}
-	data, err := os.ReadFile(".env")
+	level, err := ParseLevel(v)
 	if err != nil {
-		return
+		fmt.Fprintf(os.Stderr, "logger: ignoring %s=%q\n", key, v)
+		return nil
+	}
+	return &level
+}
+
+// envFormat returns the format in env var key, or nil when unset or invalid.
+func envFormat(key string) *Format {
+	v := strings.TrimSpace(os.Getenv(key))
+	if v == "" {
+		return nil
+	}
+	f, err := ParseFormat(v)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "logger: ignoring %s: %v\n", key, err)
+		return nil
+	}
+	return &f
+}
+
+// readDotEnvValue returns the value of key in the .env file at path.
+func readDotEnvValue(path, key string) (string, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false
 	}
 	lines := strings.Split(string(data), "\n")
 	for _, line := range lines {
@@ -327,16 +1121,16 @@ func loadDotEnv() {
 		if idx <= 0 {
 			continue
 		}
-		key := strings.TrimSpace(s[:idx])
+		k := strings.TrimSpace(s[:idx])
 		val := strings.TrimSpace(s[idx+1:])
 		if len(val) >= 2 {
 			if (val[0] == '"' && val[len(val)-1] == '"') || (val[0] == '\'' && val[len(val)-1] == '\'') {
 				val = val[1 : len(val)-1]
 			}
 		}
-		if strings.EqualFold(key, "LOG_DIR") && val != "" {
-			_ = os.Setenv("LOG_DIR", val)
-			break
+		if strings.EqualFold(k, key) {
+			return val, true
 		}
 	}
+	return "", false
 }
@@ -2,12 +2,21 @@ package logger
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -274,6 +283,47 @@ func TestCloseIdempotentAndNoWriteAfterClose(t *testing.T) {
 	}
 }
 
+func TestAsyncFlushAndClose(t *testing.T) {
+	dir := t.TempDir()
+	l, err := New(WithDir(dir), WithConsole(false), WithFilePattern("async.log"), WithAsync(4))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	path := filepath.Join(dir, "async.log")
+	count := func() int { return strings.Count(readFileString(t, path), "\n") }
+
+	// more writers than the queue holds: callers wait for the writer, nothing is dropped
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			child := l.With(map[string]any{"g": g})
+			for i := 0; i < 50; i++ {
+				child.Infof("entry %d", i)
+			}
+		}(g)
+	}
+	wg.Wait()
+	l.Flush()
+	if n := count(); n != 200 {
+		t.Fatalf("after Flush: %d lines, want 200", n)
+	}
+
+	l.Infof("last")
+	if err := l.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if last := readLastLine(t, path); !strings.HasSuffix(last, "| last") {
+		t.Fatalf("Close did not write the queued entry, last line %q", last)
+	}
+	l.Infof("after close")
+	l.Flush()
+	if n := count(); n != 201 {
+		t.Fatalf("after Close: %d lines, want 201", n)
+	}
+}
+
 func TestSafeSprintfDoesNotPanic(t *testing.T) {
 	defer func() {
 		if r := recover(); r != nil {
@@ -301,6 +351,41 @@ func TestTextOutputWithFieldsFormatting(t *testing.T) {
 	}
 }
 
+func TestKeyValueFields(t *testing.T) {
+	dir := t.TempDir()
+	js, err := New(WithName("kv"), WithDir(dir), WithFilePattern("{name}.json"), WithConsole(false), WithJSON(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer js.Close()
+	js.With(map[string]any{"line": "J01"}).Infow("batch inserted", "rows", 3, "err", errors.New("locked"), "line", "J02", 42)
+
+	var m map[string]any
+	if err := json.Unmarshal([]byte(readLastLine(t, filepath.Join(dir, "kv.json"))), &m); err != nil {
+		t.Fatal(err)
+	}
+	if m["msg"] != "batch inserted" || m["rows"] != float64(3) || m["err"] != "locked" || m["line"] != "J02" || m[badKey] != float64(42) {
+		t.Fatalf("JSON entry = %#v", m)
+	}
+
+	text, err := New(WithName("kv"), WithDir(dir), WithFilePattern("{name}.log"), WithConsole(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	text.With(map[string]any{"line": "J01"}).Warnw("slow | retrying", "detail", `took 2s | "p95"`, "empty", "")
+	text.Debugw("filtered", "k", "v")
+	_ = text.Close()
+
+	last := readLastLine(t, filepath.Join(dir, "kv.log"))
+	if !strings.Contains(last, `| line=J01 detail="took 2s | \"p95\"" empty="" | slow | retrying`) {
+		t.Fatalf("text entry = %q", last)
+	}
+	e, ok := ParseEntry(last)
+	if !ok || e.Msg != "slow | retrying" || e.Fields["detail"] != `took 2s | "p95"` || e.Fields["empty"] != "" || e.Fields["line"] != "J01" {
+		t.Fatalf("parsed = %+v", e)
+	}
+}
+
 // Basic sanity for sanitize and map helpers
 func TestHelpers(t *testing.T) {
 	sep := string(os.PathSeparator)
@@ -385,3 +470,1099 @@ var _ io.Writer = (*adapterWriter)(nil)
 
 // protect against unused imported errors
 var _ = errors.New
+
+func TestSetDefaultConsoleWriter(t *testing.T) {
+	var buf strings.Builder
+	SetDefaultConsoleWriter(&buf)
+	defer SetDefaultConsoleWriter(nil)
+
+	l, err := New(WithName("console"), WithDir(t.TempDir()), WithConsole(true))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer l.Close()
+	l.Infof("to the redirected console")
+	if !strings.Contains(buf.String(), "to the redirected console") {
+		t.Fatalf("console output not redirected, got %q", buf.String())
+	}
+}
+
+func TestPrettyConsole(t *testing.T) {
+	for _, async := range []int{0, 8} {
+		var console strings.Builder
+		SetDefaultConsoleWriter(&console)
+		dir := t.TempDir()
+		opts := []Option{WithName("pretty"), WithDir(dir), WithFilePattern("{name}.log"),
+			WithConsole(true), WithConsoleFormat(Pretty), WithStaticFields(map[string]any{"svc": "fix"})}
+		if async > 0 {
+			opts = append(opts, WithAsync(async))
+		}
+		l, err := New(opts...)
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+		l.Infow("loaded", "line", "J01", "rows", 3)
+		l.Errorw("insert failed", "detail", "took 2s")
+		_ = l.Close()
+		SetDefaultConsoleWriter(nil)
+
+		lines := strings.Split(strings.TrimSuffix(console.String(), "\n"), "\n")
+		if len(lines) != 2 {
+			t.Fatalf("async=%d: want 2 console lines, got %q", async, console.String())
+		}
+		if strings.Contains(console.String(), "\x1b[") {
+			t.Fatalf("async=%d: colors written to a non-terminal: %q", async, lines[0])
+		}
+		// time, level and name columns line up, then the message and the fields
+		if got, want := lines[0][12:], " INFO  pretty             loaded  svc=fix  line=J01  rows=3"; got != want {
+			t.Fatalf("async=%d: got %q, want %q", async, got, want)
+		}
+		if got, want := lines[1][12:], ` ERROR pretty             insert failed  svc=fix  detail="took 2s"`; got != want {
+			t.Fatalf("async=%d: got %q, want %q", async, got, want)
+		}
+		// the file keeps the plain format
+		file := readFileString(t, filepath.Join(dir, "pretty.log"))
+		if !strings.Contains(file, "[INFO] pretty | ") {
+			t.Fatalf("async=%d: file not in the text format: %q", async, file)
+		}
+	}
+
+	l, err := New(WithName("pretty"), WithDir(t.TempDir()), WithConsole(false))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer l.Close()
+	colored := string(l.formatPretty(Warn, "slow", time.Now(), nil, true))
+	if !strings.Contains(colored, levelColors[Warn]+"WARN "+ansiReset) {
+		t.Fatalf("level not colored: %q", colored)
+	}
+	if _, err := ParseFormat("fancy"); err == nil {
+		t.Fatalf("ParseFormat accepted an unknown format")
+	}
+}
+
+func TestConsoleAndFileLevels(t *testing.T) {
+	t.Cleanup(func() { _ = ApplyLevelSpec("") })
+	for _, async := range []int{0, 8} {
+		var console strings.Builder
+		SetDefaultConsoleWriter(&console)
+		dir := t.TempDir()
+		opts := []Option{WithName("sinks"), WithDir(dir), WithFilePattern("{name}.log"),
+			WithConsoleLevel(Warn), WithFileLevel(Debug)}
+		if async > 0 {
+			opts = append(opts, WithAsync(async))
+		}
+		l, err := New(opts...)
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+		if l.Level() != Debug {
+			t.Fatalf("logger level = %v, want lowered to DEBUG", l.Level())
+		}
+		l.Debugf("debug detail")
+		l.Infow("info entry", "k", 1)
+		l.Warnf("real warning")
+		l.SetLevel(Error)
+		l.Warnf("after raise")
+		_ = l.Close()
+		SetDefaultConsoleWriter(nil)
+
+		data, err := os.ReadFile(filepath.Join(dir, "sinks.log"))
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		file, con := string(data), console.String()
+		for _, want := range []string{"debug detail", "info entry", "real warning"} {
+			if !strings.Contains(file, want) {
+				t.Errorf("async=%d: file missing %q:\n%s", async, want, file)
+			}
+		}
+		if strings.Contains(con, "debug detail") || strings.Contains(con, "info entry") || !strings.Contains(con, "real warning") {
+			t.Errorf("async=%d: console = %q, want only the warning", async, con)
+		}
+		if strings.Contains(file+con, "after raise") {
+			t.Errorf("async=%d: runtime level not applied to the sinks", async)
+		}
+	}
+
+	// Only the console level set: the file follows the logger level, runtime changes included.
+	c := Config{MinLevel: Info, ConsoleLevel: Error, ConsoleLevelSet: true}
+	if m, f, con := sinkLevels(c); m != Info || f != Debug || con != Error {
+		t.Fatalf("sinkLevels = %v %v %v", m, f, con)
+	}
+	c = Config{MinLevel: Info, FileLevel: Debug, FileLevelSet: true}
+	if m, f, con := sinkLevels(c); m != Debug || f != Debug || con != Info {
+		t.Fatalf("sinkLevels lowered = %v %v %v", m, f, con)
+	}
+}
+
+func TestSinkFormats(t *testing.T) {
+	for _, async := range []int{0, 8} {
+		var console, sink strings.Builder
+		SetDefaultConsoleWriter(&console)
+		remote := &recordingSink{}
+		dir := t.TempDir()
+		opts := []Option{WithName("fanout"), WithDir(dir), WithFilePattern("{name}.log"), WithLevel(Debug),
+			WithFileFormat(JSON), WithConsoleFormat(Text), WithConsoleLevel(Info), WithSink(&sink, Pretty, Warn),
+			WithRemote(remote), WithRemoteLevel(Error)}
+		if async > 0 {
+			opts = append(opts, WithAsync(async))
+		}
+		l, err := New(opts...)
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+		l.Debugf("debug detail")
+		l.Infow("stored", "rows", 3)
+		l.Warnf("slow fetch")
+		l.Errorf("fetch failed")
+		_ = l.Close()
+		SetDefaultConsoleWriter(nil)
+
+		file := strings.Split(strings.TrimSpace(readFileString(t, filepath.Join(dir, "fanout.log"))), "\n")
+		if len(file) != 4 || !strings.HasPrefix(file[1], "{") || !strings.Contains(file[1], `"rows":3`) {
+			t.Errorf("async=%d: file not JSON with every entry: %q", async, file)
+		}
+		con := strings.Split(strings.TrimSpace(console.String()), "\n")
+		if len(con) != 3 || !strings.Contains(con[0], "[INFO] fanout | rows=3 | stored") {
+			t.Errorf("async=%d: console not text from Info: %q", async, con)
+		}
+		got := strings.Split(strings.TrimSpace(sink.String()), "\n")
+		if len(got) != 2 || !strings.Contains(got[0], "WARN  fanout") || !strings.Contains(got[1], "ERROR fanout") {
+			t.Errorf("async=%d: sink not pretty from Warn: %q", async, got)
+		}
+		if msgs := remote.messages(); !reflect.DeepEqual(msgs, []string{"fetch failed"}) {
+			t.Errorf("async=%d: shipped %q, want the error only", async, msgs)
+		}
+	}
+
+	// Plain follows WithJSON
+	if Plain.resolve(true) != JSON || Plain.resolve(false) != Text || Pretty.resolve(true) != Pretty {
+		t.Fatal("Plain does not follow WithJSON")
+	}
+	if f, err := ParseFormat(" JSON "); err != nil || f != JSON {
+		t.Fatalf("ParseFormat = %v, %v", f, err)
+	}
+}
+
+// recordingSink records the messages pushed to it.
+type recordingSink struct {
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (s *recordingSink) Push(_ context.Context, entries []Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range entries {
+		s.msgs = append(s.msgs, e.Msg)
+	}
+	return nil
+}
+
+func (s *recordingSink) messages() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.msgs...)
+}
+
+// fakeSyslog records the messages sent per priority.
+type fakeSyslog struct {
+	mu     sync.Mutex
+	msgs   []string
+	closed bool
+}
+
+func (f *fakeSyslog) add(prio, m string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.msgs = append(f.msgs, prio+" "+m)
+	return nil
+}
+
+func (f *fakeSyslog) Debug(m string) error   { return f.add("debug", m) }
+func (f *fakeSyslog) Info(m string) error    { return f.add("info", m) }
+func (f *fakeSyslog) Warning(m string) error { return f.add("warning", m) }
+func (f *fakeSyslog) Err(m string) error     { return f.add("err", m) }
+func (f *fakeSyslog) Crit(m string) error    { return f.add("crit", m) }
+func (f *fakeSyslog) Close() error           { f.closed = true; return nil }
+
+func TestSyslogSink(t *testing.T) {
+	fake, dials := &fakeSyslog{}, 0
+	orig := dialSyslog
+	dialSyslog = func(tag string) (syslogWriter, error) {
+		if tag != "hexsvc" {
+			t.Errorf("tag = %q", tag)
+		}
+		dials++
+		return fake, nil
+	}
+	defer func() { dialSyslog = orig }()
+
+	dir := t.TempDir()
+	a, err := New(WithName("sys_a"), WithDir(dir), WithConsole(false), WithSyslog("hexsvc"))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	b, err := New(WithName("sys_b"), WithDir(dir), WithConsole(false), WithSyslog("hexsvc"), WithAsync(4),
+		WithFileLevel(Warn))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	a.Debugf("hidden")
+	a.Infof("started")
+	a.Errorw("failed", "k", "v")
+	b.Infof("below the file level")
+	b.Warnf("slow")
+	b.Flush()
+
+	if dials != 1 {
+		t.Fatalf("dials = %d, want one shared connection", dials)
+	}
+	_ = a.Close()
+	if fake.closed {
+		t.Fatal("connection closed while b still uses it")
+	}
+	_ = b.Close()
+	if !fake.closed {
+		t.Fatal("connection not closed with the last logger")
+	}
+	want := []string{"info ", "err ", "warning "}
+	if len(fake.msgs) != len(want) {
+		t.Fatalf("messages = %q", fake.msgs)
+	}
+	for i, m := range fake.msgs {
+		if !strings.HasPrefix(m, want[i]) || strings.HasSuffix(m, "\n") {
+			t.Errorf("message %d = %q, want priority %q without newline", i, m, want[i])
+		}
+	}
+	if !strings.Contains(fake.msgs[1], "k=v") {
+		t.Errorf("fields missing: %q", fake.msgs[1])
+	}
+
+	// An unreachable daemon leaves the file sink working.
+	dialSyslog = func(string) (syslogWriter, error) { return nil, errors.New("no /dev/log") }
+	c, err := New(WithName("sys_c"), WithDir(dir), WithConsole(false), WithSyslog(""), WithFilePattern("{name}.log"))
+	if err != nil {
+		t.Fatalf("New without syslog: %v", err)
+	}
+	c.Infof("still written")
+	_ = c.Close()
+	if data, _ := os.ReadFile(filepath.Join(dir, "sys_c.log")); !strings.Contains(string(data), "still written") {
+		t.Fatalf("file = %q", data)
+	}
+}
+
+func TestHooks(t *testing.T) {
+	l, err := New(WithName("hooked"), WithDir(t.TempDir()), WithConsole(false), WithStaticFields(map[string]any{"line": "L1"}))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	var errs, warns []Entry
+	l.RegisterHook(Error, func(e Entry) {
+		errs = append(errs, e)
+		l.Infof("hook saw %s", e.Msg) // logging from a hook must not deadlock Close
+	})
+	child := l.With(map[string]any{"hour": "10"})
+	child.RegisterHook(Warn, func(e Entry) { warns = append(warns, e) })
+	l.RegisterHook(Debug, func(Entry) { panic("broken hook") })
+
+	l.Infof("not for the hooks")
+	child.Warnf("slow")
+	child.Errorw("fetch failed", "attempt", 2)
+	l.Debugf("below the logger level")
+	l.Flush()
+
+	if len(errs) != 1 || errs[0].Msg != "fetch failed" || errs[0].Name != "hooked" || errs[0].Level != Error {
+		t.Fatalf("error hook got %+v", errs)
+	}
+	if f := errs[0].Fields; f["line"] != "L1" || f["hour"] != "10" || f["attempt"] != 2 {
+		t.Errorf("fields = %v", f)
+	}
+	if len(warns) != 2 || warns[0].Msg != "slow" {
+		t.Errorf("warn hook got %+v", warns)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+}
+
+func TestSampling(t *testing.T) {
+	dir := t.TempDir()
+	l, err := New(WithName("sampled"), WithDir(dir), WithFilePattern("{name}.log"), WithConsole(false), WithSampling(2, time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hooked []Entry
+	l.RegisterHook(Warn, func(e Entry) { hooked = append(hooked, e) })
+	for i := 0; i < 5; i++ {
+		l.Warnf("Attempt failed: %v", "connection refused")
+		l.Warnw("fetch failed", "minute", i%2) // two distinct entries
+	}
+	l.Infof("other")
+	l.Flush()
+	l.Warnf("Attempt failed: %v", "connection refused") // a new window
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	out := readFileString(t, filepath.Join(dir, "sampled.log"))
+	if n := strings.Count(out, "| Attempt failed: connection refused\n"); n != 3 {
+		t.Errorf("%d unsuppressed attempts logged:\n%s", n, out)
+	}
+	if !strings.Contains(out, "repeated=3 | Attempt failed: connection refused (repeated 3 times in 0s)") {
+		t.Errorf("no summary of the attempts:\n%s", out)
+	}
+	if strings.Count(out, "fetch failed\n") != 4 || !strings.Contains(out, "minute=0 repeated=1 | fetch failed (repeated 1 times") {
+		t.Errorf("fields are part of the entry:\n%s", out)
+	}
+	if len(hooked) != 9 || hooked[6].Fields["repeated"] != 3 {
+		t.Errorf("hooks got %d entries: %+v", len(hooked), hooked)
+	}
+
+	// the summary of an entry that stopped repeating is logged when its window ends
+	short, err := New(WithName("short"), WithDir(dir), WithFilePattern("{name}.log"), WithConsole(false), WithSampling(1, 20*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer short.Close()
+	short.Errorf("down")
+	short.Errorf("down")
+	deadline := time.Now().Add(2 * time.Second)
+	for !strings.Contains(readFileString(t, filepath.Join(dir, "short.log")), "down (repeated 1 times") {
+		if time.Now().After(deadline) {
+			t.Fatal("no summary after the window")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for spec, want := range map[string]string{"5/1m": "5 1m0s", "30s": "1 30s", "0/1m": "error", "1/-1s": "error", "x": "error"} {
+		first, window, err := parseSampling(spec)
+		got := fmt.Sprintf("%d %s", first, window)
+		if err != nil {
+			got = "error"
+		}
+		if got != want {
+			t.Errorf("parseSampling(%q) = %s, want %s", spec, got, want)
+		}
+	}
+}
+
+// logVia logs through a helper, as the entity managers' logEntity do.
+func logVia(l *Logger, msg string) {
+	Helper()
+	l.Warnf("%s", msg)
+}
+
+func TestCaller(t *testing.T) {
+	dir := t.TempDir()
+	l, err := New(WithName("caller"), WithDir(dir), WithFilePattern("{name}.log"), WithConsole(false), WithCaller(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	here := func() string {
+		_, file, line, _ := runtime.Caller(1)
+		return fmt.Sprintf("%s/%s:%d", filepath.Base(filepath.Dir(file)), filepath.Base(file), line+1)
+	}
+	want := []string{here()}
+	l.Infof("direct")
+	want = append(want, here())
+	l.With(map[string]any{"line": "J01"}).Errorw("with fields", "rows", 3)
+	want = append(want, here())
+	l.StdLogger().Printf("std")
+	want = append(want, here())
+	logVia(l, "helped")
+	_ = l.Close()
+
+	f, err := os.Open(filepath.Join(dir, "caller.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	var n int
+	for ; sc.Scan(); n++ {
+		e, ok := ParseEntry(sc.Text())
+		if !ok || n >= len(want) || e.Fields[CallerKey] != want[n] || e.Fields[FuncKey] != "logger.TestCaller" {
+			t.Errorf("entry %d = %q", n, sc.Text())
+		}
+	}
+	if n != len(want) {
+		t.Errorf("%d entries, want %d", n, len(want))
+	}
+
+	js, err := New(WithName("caller"), WithDir(dir), WithFilePattern("{name}.json"), WithConsole(false), WithJSON(true), WithCaller(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	js.Infow("json", "k", "v")
+	_ = js.Close()
+	var m map[string]any
+	if err := json.Unmarshal([]byte(readLastLine(t, filepath.Join(dir, "caller.json"))), &m); err != nil {
+		t.Fatal(err)
+	}
+	if c, _ := m[CallerKey].(string); !strings.HasPrefix(c, "logger/logger_test.go:") || m[FuncKey] != "logger.TestCaller" || m["k"] != "v" {
+		t.Errorf("JSON entry = %v", m)
+	}
+}
+
+func TestRedaction(t *testing.T) {
+	dir := t.TempDir()
+	l, err := New(WithName("redact"), WithDir(dir), WithFilePattern("{name}.log"), WithConsole(false),
+		WithStaticFields(map[string]any{"token": "s3cret"}), WithRedaction([]string{"Token", "employee_name", " ppid "}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hooked []Entry
+	l.RegisterHook(Debug, func(e Entry) { hooked = append(hooked, e) })
+	l.With(map[string]any{"line": "J01", "PPID": "MX1234567"}).Warnw("dump mismatch", "employee_name", "Jane Doe", "station", "ICT")
+	_ = l.Close()
+
+	line := readLastLine(t, filepath.Join(dir, "redact.log"))
+	for _, leak := range []string{"s3cret", "MX1234567", "Jane Doe"} {
+		if strings.Contains(line, leak) {
+			t.Errorf("%q leaked: %q", leak, line)
+		}
+	}
+	e, ok := ParseEntry(line)
+	if !ok || e.Fields["token"] != Redacted || e.Fields["PPID"] != Redacted || e.Fields["employee_name"] != Redacted ||
+		e.Fields["line"] != "J01" || e.Fields["station"] != "ICT" {
+		t.Errorf("entry = %q", line)
+	}
+	if len(hooked) != 1 || hooked[0].Fields["employee_name"] != Redacted || hooked[0].Fields["token"] != Redacted {
+		t.Errorf("hooked = %+v", hooked)
+	}
+
+	js, err := New(WithName("redact"), WithDir(dir), WithFilePattern("{name}.json"), WithConsole(false), WithJSON(true),
+		WithRedaction([]string{"error"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	js.ErrorE(errors.New("login failed for jdoe"), "sfc auth")
+	_ = js.Close()
+	var m map[string]any
+	if err := json.Unmarshal([]byte(readLastLine(t, filepath.Join(dir, "redact.json"))), &m); err != nil {
+		t.Fatal(err)
+	}
+	if m[ErrorKey] != Redacted || m[ErrorChainKey] != Redacted || m["msg"] != "sfc auth" {
+		t.Errorf("JSON entry = %v", m)
+	}
+}
+
+func TestRecent(t *testing.T) {
+	dir := t.TempDir()
+	l, err := New(WithName("recent"), WithDir(dir), WithFilePattern("{name}.log"), WithConsole(false), WithRecent(3),
+		WithLevel(Info))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	l.Debugf("filtered")
+	for i := 1; i <= 4; i++ {
+		l.Infow("minute stored", "n", i)
+	}
+	l.With(map[string]any{"line": "J01"}).Warnf("child")
+
+	got := l.Recent()
+	if len(got) != 3 || got[0].Fields["n"] != 3 || got[1].Fields["n"] != 4 || got[2].Msg != "child" ||
+		got[2].Fields["line"] != "J01" || got[2].Level != Warn || got[2].Name != "recent" {
+		t.Fatalf("Recent() = %+v", got)
+	}
+
+	other, err := New(WithName("other"), WithDir(dir), WithFilePattern("{name}.log"), WithConsole(false), WithRecent(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	other.Errorf("other failed")
+	none, err := New(WithName("none"), WithDir(dir), WithFilePattern("{name}.log"), WithConsole(false), WithRecent(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer none.Close()
+	none.Errorf("not kept")
+	if none.Recent() != nil {
+		t.Errorf("logger without recent entries kept %+v", none.Recent())
+	}
+
+	all := Recent(Query{Names: []string{"recent", "other", "none"}, MinLevel: Warn})
+	if len(all) != 2 || all[0].Msg != "child" || all[1].Msg != "other failed" {
+		t.Errorf("Recent(warn) = %+v", all)
+	}
+}
+
+func TestContextLogging(t *testing.T) {
+	l, err := New(WithName("ctx"), WithDir(t.TempDir()), WithFilePattern("{name}.log"), WithConsole(false),
+		WithRecent(10), WithStaticFields(map[string]any{"svc": "db_clon"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	ctx := NewContext(context.Background(), l)
+	ctx = ContextWithFields(ctx, RequestIDKey, "req-1")
+	FromContext(ctx).Infof("request line")
+	job := ContextWithFields(ctx, JobIDKey, "minute/2025-03-10T08:00", RequestIDKey, "req-2")
+	FromContext(job).Infow("job line", "rows", 3)
+	l.WithContext(context.Background()).Infof("plain line")
+
+	got := l.Recent()
+	if len(got) != 3 {
+		t.Fatalf("Recent() = %+v", got)
+	}
+	if f := got[0].Fields; f[RequestIDKey] != "req-1" || f["svc"] != "db_clon" || f[JobIDKey] != nil {
+		t.Errorf("request line fields = %v", f)
+	}
+	if f := got[1].Fields; f[RequestIDKey] != "req-2" || f[JobIDKey] != "minute/2025-03-10T08:00" || f["rows"] != 3 {
+		t.Errorf("job line fields = %v", f)
+	}
+	if f := got[2].Fields; f[RequestIDKey] != nil {
+		t.Errorf("plain line fields = %v", f)
+	}
+
+	// Without a logger in the context nothing is written, whatever its level.
+	nl := FromContext(ContextWithFields(context.Background(), RequestIDKey, "req-3"))
+	nl.SetLevel(Debug)
+	nl.Errorf("dropped")
+	nl.StdLogger().Print("dropped")
+	if err := nl.Close(); err != nil {
+		t.Errorf("Close() = %v", err)
+	}
+}
+
+func TestSlogHandler(t *testing.T) {
+	l, err := New(WithName("slog"), WithDir(t.TempDir()), WithFilePattern("{name}.log"), WithConsole(false),
+		WithRecent(10), WithLevel(Info), WithCaller(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	sl := l.Slog().With("svc", "db_clon")
+	sl.Debug("dropped")
+	ctx := ContextWithFields(context.Background(), RequestIDKey, "req-1")
+	sl.InfoContext(ctx, "request", "rows", 3, slog.Group("http", "status", 200, slog.Group("", "inlined", true)))
+	sl.WithGroup("db").Log(ctx, slog.LevelWarn+2, "slow", "took", 1500*time.Millisecond, "err", errors.New("locked"))
+	sl.Error("failed", slog.Any("empty", slog.GroupValue()))
+
+	got := l.Recent()
+	if len(got) != 3 {
+		t.Fatalf("Recent() = %+v", got)
+	}
+	if e := got[0]; e.Level != Info || e.Msg != "request" || e.Fields["svc"] != "db_clon" || e.Fields[RequestIDKey] != "req-1" ||
+		e.Fields["rows"] != int64(3) || e.Fields["http.status"] != int64(200) || e.Fields["http.inlined"] != true {
+		t.Errorf("request entry = %+v", e)
+	}
+	if c, _ := got[0].Fields[CallerKey].(string); !strings.HasPrefix(c, "logger/logger_test.go:") || got[0].Fields[FuncKey] != "logger.TestSlogHandler" {
+		t.Errorf("caller = %v %v", got[0].Fields[CallerKey], got[0].Fields[FuncKey])
+	}
+	if e := got[1]; e.Level != Warn || e.Fields["db.took"] != "1.5s" || e.Fields["db.err"] != "locked" || e.Fields["svc"] != "db_clon" {
+		t.Errorf("grouped entry = %+v", e)
+	}
+	if e := got[2]; e.Level != Error || len(e.Fields) != 3 { // svc, caller, func
+		t.Errorf("error entry = %+v", e)
+	}
+	if h := l.SlogHandler(); h.Enabled(context.Background(), slog.LevelDebug) || !h.Enabled(context.Background(), slog.LevelInfo) {
+		t.Error("Enabled does not follow the logger level")
+	}
+}
+
+type lockedError struct{ code int }
+
+func (e *lockedError) Error() string { return fmt.Sprintf("database is locked (%d)", e.code) }
+
+func TestErrorE(t *testing.T) {
+	dir := t.TempDir()
+	js, err := New(WithName("errs"), WithDir(dir), WithFilePattern("{name}.json"), WithConsole(false), WithJSON(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cause := fmt.Errorf("insert batch: %w", errors.Join(&lockedError{5}, errors.New("rollback failed")))
+	js.ErrorE(fmt.Errorf("minute 08:00: %w", cause), "live minute failed", "line", "J01")
+	js.ErrorE(nil, "no error")
+	_ = js.Close()
+
+	lines := strings.Split(strings.TrimSpace(readFileString(t, filepath.Join(dir, "errs.json"))), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("%d entries", len(lines))
+	}
+	var e struct {
+		Msg   string   `json:"msg"`
+		Line  string   `json:"line"`
+		Error string   `json:"error"`
+		Chain []string `json:"error_chain"`
+		Stack string   `json:"stack"`
+	}
+	if err := json.Unmarshal([]byte(lines[0]), &e); err != nil {
+		t.Fatal(err)
+	}
+	wantChain := []string{
+		"*fmt.wrapError: minute 08:00: insert batch: database is locked (5)\nrollback failed",
+		"*fmt.wrapError: insert batch: database is locked (5)\nrollback failed",
+		"*errors.joinError: database is locked (5)\nrollback failed",
+		"*logger.lockedError: database is locked (5)",
+		"*errors.errorString: rollback failed",
+	}
+	if e.Msg != "live minute failed" || e.Line != "J01" || e.Error != "minute 08:00: insert batch: database is locked (5)\nrollback failed" ||
+		strings.Join(e.Chain, "|") != strings.Join(wantChain, "|") {
+		t.Errorf("entry = %+v", e)
+	}
+	if !strings.HasPrefix(e.Stack, "logger.TestErrorE logger/logger_test.go:") || strings.Contains(e.Stack, "logger.(*Logger)") {
+		t.Errorf("stack = %q", e.Stack)
+	}
+	var bare map[string]any
+	if err := json.Unmarshal([]byte(lines[1]), &bare); err != nil || bare["error"] != nil || bare["stack"] == nil {
+		t.Errorf("nil error entry = %v", bare)
+	}
+
+	// the text format keeps the stack on the entry's line
+	text, err := New(WithName("errs"), WithDir(dir), WithFilePattern("{name}.log"), WithConsole(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	text.ErrorE(cause, "insert failed")
+	_ = text.Close()
+	if parsed, ok := ParseEntry(readLastLine(t, filepath.Join(dir, "errs.log"))); !ok ||
+		!strings.HasPrefix(parsed.Fields[StackKey].(string), "logger.TestErrorE ") || parsed.Msg != "insert failed" {
+		t.Errorf("text entry = %+v", parsed)
+	}
+}
+
+func TestRemoteSinks(t *testing.T) {
+	var mu sync.Mutex
+	bodies := map[string][]byte{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies[r.URL.Path] = b
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	loki, err := New(WithName("ship_loki"), WithDir(dir), WithConsole(false), WithFileLevel(Info),
+		WithStaticFields(map[string]any{"line": "L1"}), WithRemote(NewLokiSink(srv.URL, map[string]string{"job": "loader"})))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	otlp, err := New(WithName("ship_otlp"), WithDir(dir), WithConsole(false),
+		WithRemote(NewOTLPSink(srv.URL+"/", map[string]string{"job": "loader", "host": "h1"})))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	loki.Debugf("below the file level")
+	loki.Infow("stored", "rows", 3)
+	otlp.Errorw("fetch failed", "attempt", 2, "err", errors.New("timeout"))
+	FlushAll()
+	_ = loki.Close()
+	_ = otlp.Close()
+
+	var push struct {
+		Streams []struct {
+			Stream map[string]string `json:"stream"`
+			Values [][2]string       `json:"values"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(bodies["/loki/api/v1/push"], &push); err != nil {
+		t.Fatalf("loki body %q: %v", bodies["/loki/api/v1/push"], err)
+	}
+	if len(push.Streams) != 1 || len(push.Streams[0].Values) != 1 {
+		t.Fatalf("loki streams = %+v", push.Streams)
+	}
+	st := push.Streams[0]
+	if st.Stream["job"] != "loader" || st.Stream["logger"] != "ship_loki" || st.Stream["level"] != "info" {
+		t.Errorf("loki labels = %v", st.Stream)
+	}
+	if st.Values[0][1] != "stored line=L1 rows=3" {
+		t.Errorf("loki line = %q", st.Values[0][1])
+	}
+
+	body := string(bodies["/v1/logs"])
+	for _, want := range []string{`"key":"service.name","value":{"stringValue":"loader"}`, `"scope":{"name":"ship_otlp"}`,
+		`"severityNumber":17`, `"body":{"stringValue":"fetch failed"}`, `"key":"attempt","value":{"intValue":"2"}`,
+		`"key":"err","value":{"stringValue":"timeout"}`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("otlp body lacks %s: %s", want, body)
+		}
+	}
+
+	// A stuck backend drops entries instead of blocking the logger.
+	stuck := &blockingSink{release: make(chan struct{})}
+	l, err := New(WithName("ship_stuck"), WithDir(dir), WithConsole(false), WithRemote(stuck))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	start := time.Now()
+	for i := 0; i < 2*remoteQueueSize; i++ {
+		l.Infof("entry %d", i)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("logging took %v with a stuck sink", d)
+	}
+	if l.core.remote.dropped.Load() == 0 {
+		t.Error("nothing dropped with a full queue")
+	}
+	close(stuck.release)
+	_ = l.Close()
+}
+
+// blockingSink blocks every push until release is closed.
+type blockingSink struct{ release chan struct{} }
+
+func (s *blockingSink) Push(ctx context.Context, _ []Entry) error {
+	<-s.release
+	return nil
+}
+
+func TestFatalAndPanic(t *testing.T) {
+	code := -1
+	exit = func(c int) { code = c }
+	t.Cleanup(func() {
+		exit = os.Exit
+		exitHooks.fns, exitHooks.ran = nil, sync.Once{}
+	})
+	dir := t.TempDir()
+	l, err := New(WithName("fatal"), WithDir(dir), WithFilePattern("{name}.log"), WithConsole(false), WithAsync(64))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer l.Close()
+	var order []string
+	RegisterExitHook(func() { order = append(order, "first") })
+	RegisterExitHook(func() { panic("broken exit hook") })
+	RegisterExitHook(func() {
+		order = append(order, "last")
+		l.Infof("closing the database")
+	})
+
+	l.Fatalf("cannot open %s", "db.sqlite")
+	if code != 1 || !reflect.DeepEqual(order, []string{"last", "first"}) {
+		t.Fatalf("exit code %d, hooks %v", code, order)
+	}
+	// the async entries, the hook's included, are written before exiting
+	file := readFileString(t, filepath.Join(dir, "fatal.log"))
+	if !strings.Contains(file, "[FATAL] fatal | cannot open db.sqlite") || !strings.Contains(file, "closing the database") {
+		t.Fatalf("file = %q", file)
+	}
+	Exit(3)
+	if code != 3 || len(order) != 2 {
+		t.Fatalf("second exit: code %d, hooks %v", code, order)
+	}
+
+	func() {
+		defer func() {
+			if r := recover(); r != "bad state 7" {
+				t.Fatalf("recovered %v", r)
+			}
+		}()
+		l.Panicf("bad state %d", 7)
+	}()
+	if file := readFileString(t, filepath.Join(dir, "fatal.log")); !strings.Contains(file, "[PANIC] fatal | bad state 7") {
+		t.Fatalf("panic entry not written: %q", file)
+	}
+	if level, err := ParseLevel("FATAL"); err != nil || level != Fatal || Panic.String() != "PANIC" {
+		t.Fatalf("ParseLevel(FATAL) = %v, %v", level, err)
+	}
+}
+
+func TestRuntimeLevelChanges(t *testing.T) {
+	t.Cleanup(func() { _ = ApplyLevelSpec("") })
+	dir := t.TempDir()
+	a, err := New(WithName("lvl_a"), WithDir(dir), WithConsole(false), WithFilePattern("{name}.log"))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer a.Close()
+	b, err := New(WithName("lvl_b"), WithDir(dir), WithConsole(false), WithLevel(Warn), WithFilePattern("{name}.log"))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer b.Close()
+	child := a.With(map[string]any{"k": "v"})
+
+	if n := SetLevels("lvl_a", Debug); n != 1 {
+		t.Fatalf("expected 1 logger changed, got %d", n)
+	}
+	child.Debugf("child debug visible")
+	b.Infof("b info hidden")
+	if got := readFileString(t, filepath.Join(dir, "lvl_a.log")); !strings.Contains(got, "child debug visible") {
+		t.Fatalf("debug entry missing after SetLevels: %q", got)
+	}
+
+	// loggers created after the change pick it up
+	late, err := New(WithName("lvl_a"), WithDir(t.TempDir()), WithConsole(false))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer late.Close()
+	if late.Level() != Debug {
+		t.Fatalf("new logger should inherit runtime level, got %s", late.Level())
+	}
+
+	if err := ApplyLevelSpec("error,lvl_b=debug"); err != nil {
+		t.Fatalf("ApplyLevelSpec: %v", err)
+	}
+	if a.Level() != Error || b.Level() != Debug {
+		t.Fatalf("spec not applied: a=%s b=%s", a.Level(), b.Level())
+	}
+	if lv := Levels(); lv["lvl_b"] != Debug {
+		t.Fatalf("Levels() = %v", lv)
+	}
+
+	// empty spec restores configured levels
+	if err := ApplyLevelSpec(""); err != nil {
+		t.Fatalf("ApplyLevelSpec: %v", err)
+	}
+	if a.Level() != Info || b.Level() != Warn {
+		t.Fatalf("configured levels not restored: a=%s b=%s", a.Level(), b.Level())
+	}
+	if err := ApplyLevelSpec("lvl_a=loud"); err == nil || a.Level() != Info {
+		t.Fatalf("invalid spec should be rejected without changes, err=%v level=%s", err, a.Level())
+	}
+}
+
+func TestReloadLevelsFromEnvFile(t *testing.T) {
+	t.Cleanup(func() { _ = ApplyLevelSpec("") })
+	l, err := New(WithName("reload"), WithDir(t.TempDir()), WithConsole(false))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer l.Close()
+
+	env := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(env, []byte("LOG_DIR=logs\nLOG_LEVEL=\"warn,reload=debug\"\n"), 0o644); err != nil {
+		t.Fatalf("write env: %v", err)
+	}
+	spec, err := ReloadLevels(env)
+	if err != nil || spec != "warn,reload=debug" {
+		t.Fatalf("ReloadLevels = %q, %v", spec, err)
+	}
+	if l.Level() != Debug {
+		t.Fatalf("expected debug after reload, got %s", l.Level())
+	}
+}
+
+func TestSearchParsesTextAndJSONLogs(t *testing.T) {
+	dir := t.TempDir()
+	text, err := New(WithName("sfc_loader"), WithDir(dir), WithFilePattern("{name}.log"), WithConsole(false), WithLevel(Debug))
+	if err != nil {
+		t.Fatal(err)
+	}
+	text.Infof("InsertBatch: 12 records")
+	text.With(map[string]any{"line": "J01"}).Errorf("InsertBatch failed: database is locked")
+	text.Errorf("first line\nsecond line")
+	_ = text.Close()
+
+	js, err := New(WithName("slo"), WithDir(dir), WithFilePattern("{name}.log"), WithConsole(false), WithJSON(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	js.With(map[string]any{"minute": "08:01"}).Errorf("minute late")
+	_ = js.Close()
+
+	entries, err := Search(dir, Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 4 {
+		t.Fatalf("entries = %d, want 4: %+v", len(entries), entries)
+	}
+
+	entries, err = Search(dir, Query{Names: []string{"SFC_LOADER"}, MinLevel: Error, Grep: regexp.MustCompile("InsertBatch")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Msg != "InsertBatch failed: database is locked" || entries[0].Fields["line"] != "J01" {
+		t.Fatalf("filtered entries = %+v", entries)
+	}
+
+	entries, _ = Search(dir, Query{Grep: regexp.MustCompile("second line|minute=08:01")})
+	if len(entries) != 2 || entries[0].Msg != "first line\nsecond line" || entries[1].Name != "slo" {
+		t.Fatalf("multi-line/field entries = %+v", entries)
+	}
+
+	if entries, _ := Search(dir, Query{Since: time.Now().Add(time.Hour)}); len(entries) != 0 {
+		t.Fatalf("entries in the future = %d", len(entries))
+	}
+}
+
+func TestLogFileRotatesBySize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "svc.log")
+	lf, err := openLogFile(path, rotation{maxSize: 100, maxBackups: 2})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	line := strings.Repeat("x", 39) + "\n" // 40 bytes: two lines fit in 100, three do not
+	for i := 0; i < 9; i++ {
+		if _, err := lf.Write([]byte(line)); err != nil {
+			t.Fatalf("write %d: %v", i, err)
+		}
+	}
+	if err := lf.release(); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+
+	// 9 lines roll over every 2: the current file holds the last one, two backups the
+	// four before it, and the oldest files were dropped.
+	for name, want := range map[string]int{"svc.log": 40, "svc.log.1": 80, "svc.log.2": 80} {
+		info, err := os.Stat(filepath.Join(filepath.Dir(path), name))
+		if err != nil {
+			t.Fatalf("stat %s: %v", name, err)
+		}
+		if info.Size() != int64(want) {
+			t.Fatalf("%s is %d bytes, want %d", name, info.Size(), want)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Fatalf("svc.log.3 kept beyond WithMaxBackups(2): %v", err)
+	}
+}
+
+func TestLogFileRotatesDaily(t *testing.T) {
+	clock := time.Date(2025, 3, 10, 22, 0, 0, 0, time.UTC)
+	rotateNow = func() time.Time { return clock }
+	t.Cleanup(func() { rotateNow = time.Now })
+
+	path := filepath.Join(t.TempDir(), "svc.log")
+	lf, err := openLogFile(path, rotation{daily: true, keepDays: 2, loc: time.UTC})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	// One line a day over four days, two on the last.
+	for _, day := range []int{10, 11, 12, 13, 13} {
+		clock = time.Date(2025, 3, day, 1, 0, 0, 0, time.UTC)
+		if _, err := lf.Write([]byte("day " + clock.Format(time.DateOnly) + "\n")); err != nil {
+			t.Fatalf("write %d: %v", day, err)
+		}
+	}
+	if err := lf.release(); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+
+	for name, want := range map[string]string{
+		"svc.log":            "day 2025-03-13\nday 2025-03-13\n",
+		"svc.log.2025-03-12": "day 2025-03-12\n",
+		"svc.log.2025-03-11": "day 2025-03-11\n",
+	} {
+		b, err := os.ReadFile(filepath.Join(filepath.Dir(path), name))
+		if err != nil {
+			t.Fatalf("read %s: %v", name, err)
+		}
+		if string(b) != want {
+			t.Fatalf("%s = %q, want %q", name, b, want)
+		}
+	}
+	if _, err := os.Stat(path + ".2025-03-10"); !os.IsNotExist(err) {
+		t.Fatalf("svc.log.2025-03-10 kept beyond WithDailyRotation(2): %v", err)
+	}
+}
+
+func TestLoggersSharingAFileRotateTogether(t *testing.T) {
+	dir := t.TempDir()
+	open := func() *Logger {
+		l, err := New(WithName("shared"), WithDir(dir), WithConsole(false), WithFilePattern("{name}.log"),
+			WithMaxSizeMB(1), WithMaxBackups(1))
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+		return l
+	}
+	a, b := open(), open()
+	msg := strings.Repeat("y", 1000)
+	for i := 0; i < 800; i++ {
+		a.Infof("%s", msg)
+		b.Infof("%s", msg)
+	}
+	_ = a.Close()
+	b.Infof("after close of a")
+	_ = b.Close()
+
+	for _, name := range []string{"shared.log", "shared.log.1"} {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("stat %s: %v", name, err)
+		}
+		if info.Size() > 1<<20 {
+			t.Fatalf("%s is %d bytes, over WithMaxSizeMB(1)", name, info.Size())
+		}
+	}
+	if last := readLastLine(t, filepath.Join(dir, "shared.log")); !strings.HasSuffix(last, "after close of a") {
+		t.Fatalf("last line = %q", last)
+	}
+}
+
+func TestMaxAgeDeletesOldFiles(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Now().Add(-10 * 24 * time.Hour)
+	files := map[string]bool{ // name -> deleted
+		"svc_20250101_080000.000_0001.log":            true,
+		"svc_20250101_080000.000_0001.log.2":          true,
+		"svc_20250101_080000.000_0001.log.2025-01-01": true,
+		"svc_20250102_080000.000_0002.log":            false, // recent
+		"svc-api_20250101_080000.000_0001.log":        false, // another logger
+		"svc.log":                                     false, // another pattern
+		"notes.txt":                                   false,
+	}
+	for name := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("x\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if name != "svc_20250102_080000.000_0002.log" {
+			if err := os.Chtimes(path, old, old); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// a file in use is kept however old its last write
+	current := fmt.Sprintf("cur_%d.log", os.Getpid())
+	if err := os.WriteFile(filepath.Join(dir, current), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(filepath.Join(dir, current), old, old); err != nil {
+		t.Fatal(err)
+	}
+	cur, err := New(WithName("cur"), WithDir(dir), WithFilePattern("{name}_{pid}.log"), WithConsole(false), WithMaxAgeDays(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := New(WithName("svc"), WithDir(dir), WithConsole(false), WithMaxAgeDays(7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	janitors[mustAbs(t, dir)].sweep()
+	_ = l.Close()
+	_ = cur.Close() // the last one waits for the running sweep
+	if _, ok := janitors[mustAbs(t, dir)]; ok {
+		t.Error("janitor still running after the last logger closed")
+	}
+
+	for name, deleted := range files {
+		_, err := os.Stat(filepath.Join(dir, name))
+		if gone := os.IsNotExist(err); gone != deleted {
+			t.Errorf("%s deleted = %v, want %v", name, gone, deleted)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, current)); err != nil {
+		t.Errorf("current file: %v", err)
+	}
+
+	if _, err := filePatternRegexp("{name}/{timestamp}.log", "svc"); err == nil {
+		t.Error("pattern with a directory accepted")
+	}
+	re, err := filePatternRegexp("{name}_{pid}{x}.log", "a b")
+	if err != nil || !re.MatchString("a-b_123{x}.log.3") || re.MatchString("a-b_{x}.log") {
+		t.Errorf("pattern regexp = %v, %v", re, err)
+	}
+}
+
+func mustAbs(t *testing.T, path string) string {
+	t.Helper()
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return abs
+}
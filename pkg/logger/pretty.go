@@ -0,0 +1,117 @@
+package logger
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	consoleFormatSet bool
+	consoleFormat    Format
+)
+
+// SetDefaultConsoleFormat changes the console format of loggers created afterwards without
+// WithConsoleFormat, unless LOG_CONSOLE_FORMAT is set. Interactive commands (fix) use it so
+// the entries of every logger they run read the same.
+func SetDefaultConsoleFormat(f Format) {
+	consoleMu.Lock()
+	consoleFormat, consoleFormatSet = f, true
+	consoleMu.Unlock()
+}
+
+func defaultConsoleFormat() (Format, bool) {
+	consoleMu.Lock()
+	defer consoleMu.Unlock()
+	return consoleFormat, consoleFormatSet
+}
+
+// prettyNameWidth is the width of the logger name column; longer names push the line.
+const prettyNameWidth = 18
+
+const (
+	ansiReset = "\x1b[0m"
+	ansiDim   = "\x1b[2m"
+)
+
+var levelColors = map[Level]string{
+	Debug: "\x1b[90m",   // gray
+	Info:  "\x1b[36m",   // cyan
+	Warn:  "\x1b[33m",   // yellow
+	Error: "\x1b[1;31m", // bold red
+	Panic: "\x1b[1;35m", // bold magenta
+	Fatal: "\x1b[1;35m",
+}
+
+// useColor reports whether w is a terminal that should get colors: not with NO_COLOR
+// (https://no-color.org) or TERM=dumb, nor when output is redirected to a file or pipe.
+func useColor(w io.Writer) bool {
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	st, err := f.Stat()
+	return err == nil && st.Mode()&os.ModeCharDevice != 0
+}
+
+// formatPretty renders an entry for the console:
+//
+//	08:01:02.345 WARN  sfc_api_production minute skipped  line=J01 rows=0
+//
+// The logger's fields come first in key order, then the entry's in call order; a "stack"
+// field (ErrorE) follows on indented lines.
+func (l *Logger) formatPretty(level Level, msg string, entryTime time.Time, extra []field, color bool) []byte {
+	var b strings.Builder
+	paint := func(code, s string) {
+		if color {
+			b.WriteString(code)
+			b.WriteString(s)
+			b.WriteString(ansiReset)
+		} else {
+			b.WriteString(s)
+		}
+	}
+	paint(ansiDim, entryTime.Format("15:04:05.000"))
+	b.WriteByte(' ')
+	paint(levelColors[level], fmt.Sprintf("%-5s", level.String()))
+	fmt.Fprintf(&b, " %-*s %s", prettyNameWidth, l.cfg.Name, msg)
+
+	var stack string
+	writeField := func(k string, v any) {
+		if k == StackKey {
+			stack = fmt.Sprint(v)
+			return
+		}
+		b.WriteString("  ")
+		paint(ansiDim, k+"=")
+		b.WriteString(textValue(v))
+	}
+	keys := make([]string, 0, len(l.fields))
+	for k := range l.fields {
+		if !hasKey(extra, k) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		writeField(k, l.fields[k])
+	}
+	for _, f := range extra {
+		writeField(f.key, f.val)
+	}
+	b.WriteByte('\n')
+	if stack != "" {
+		for _, frame := range strings.Split(stack, "\n") {
+			b.WriteString("    ")
+			paint(ansiDim, frame)
+			b.WriteByte('\n')
+		}
+	}
+	return []byte(b.String())
+}
@@ -0,0 +1,222 @@
+package logger
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Entry is one log entry, parsed from either output format or, without File, handed to
+// hooks and remote sinks as it is logged.
+type Entry struct {
+	Time   time.Time      `json:"ts"`
+	Level  Level          `json:"-"`
+	Name   string         `json:"name"`
+	Msg    string         `json:"msg"`
+	Fields map[string]any `json:"fields,omitempty"`
+	File   string         `json:"file"`
+}
+
+// MarshalJSON writes the level by name.
+func (e Entry) MarshalJSON() ([]byte, error) {
+	type plain Entry
+	return json.Marshal(struct {
+		plain
+		Level string `json:"level"`
+	}{plain(e), e.Level.String()})
+}
+
+// Query selects log entries. Zero fields match everything.
+type Query struct {
+	Names    []string       // logger names (exact, case-insensitive)
+	MinLevel Level          // entries below it are skipped
+	Since    time.Time      // entries before it are skipped; entries without a time are kept only when zero
+	Grep     *regexp.Regexp // matched against the message and the fields
+}
+
+// Match reports whether e satisfies q.
+func (q Query) Match(e Entry) bool {
+	if e.Level < q.MinLevel {
+		return false
+	}
+	if !q.Since.IsZero() && e.Time.Before(q.Since) {
+		return false
+	}
+	if len(q.Names) > 0 {
+		found := false
+		for _, n := range q.Names {
+			if strings.EqualFold(n, e.Name) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if q.Grep != nil && !q.Grep.MatchString(e.Msg) {
+		for k, v := range e.Fields {
+			if q.Grep.MatchString(fmt.Sprintf("%s=%v", k, v)) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// Search parses the *.log files of dir, and the files rotated from them (*.log.1,
+// *.log.2025-03-10), and returns the entries matching q, oldest first. Files last written
+// before q.Since are skipped unread.
+func Search(dir string, q Query) ([]Entry, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.log"))
+	if err != nil {
+		return nil, err
+	}
+	rotated, err := filepath.Glob(filepath.Join(dir, "*.log.*"))
+	if err != nil {
+		return nil, err
+	}
+	paths = append(paths, rotated...)
+	var out []Entry
+	for _, p := range paths {
+		if !q.Since.IsZero() {
+			if st, err := os.Stat(p); err == nil && st.ModTime().Before(q.Since) {
+				continue
+			}
+		}
+		entries, err := ReadEntries(p)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if q.Match(e) {
+				out = append(out, e)
+			}
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Time.Before(out[j].Time) })
+	return out, nil
+}
+
+// ReadEntries parses every entry of the log file at path. Lines that do not start an entry
+// (multi-line messages, stray output) are appended to the message of the previous one.
+func ReadEntries(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("logger: open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	file := filepath.Base(path)
+	var out []Entry
+	s := bufio.NewScanner(f)
+	s.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for s.Scan() {
+		line := strings.TrimRight(s.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		e, ok := ParseEntry(line)
+		if !ok {
+			if len(out) > 0 {
+				out[len(out)-1].Msg += "\n" + line
+			}
+			continue
+		}
+		e.File = file
+		out = append(out, e)
+	}
+	if err := s.Err(); err != nil {
+		return out, fmt.Errorf("logger: read %s: %w", path, err)
+	}
+	return out, nil
+}
+
+// textEntry matches "<time> [<LEVEL>] <name> | <rest>" as written by the text format.
+var textEntry = regexp.MustCompile(`^(\S+) \[([A-Z]+)\] (.*?) \| (.*)$`)
+
+// ParseEntry parses one line written by a Logger in JSON or text format. Text lines with
+// fields carry them as "k=v k=v | msg"; a time in a custom WithTimeFormat is left zero.
+func ParseEntry(line string) (Entry, bool) {
+	if strings.HasPrefix(line, "{") {
+		return parseJSONEntry(line)
+	}
+	m := textEntry.FindStringSubmatch(line)
+	if m == nil {
+		return Entry{}, false
+	}
+	level, err := ParseLevel(m[2])
+	if err != nil {
+		return Entry{}, false
+	}
+	e := Entry{Level: level, Name: m[3], Msg: m[4]}
+	e.Time, _ = time.Parse(time.RFC3339, m[1])
+	if kv, msg, ok := parseTextFields(m[4]); ok {
+		e.Fields, e.Msg = kv, msg
+	}
+	return e, true
+}
+
+func parseJSONEntry(line string) (Entry, bool) {
+	var raw map[string]any
+	if err := json.Unmarshal([]byte(line), &raw); err != nil {
+		return Entry{}, false
+	}
+	ts, _ := raw["ts"].(string)
+	lvl, _ := raw["level"].(string)
+	level, err := ParseLevel(lvl)
+	if err != nil {
+		return Entry{}, false
+	}
+	e := Entry{Level: level}
+	e.Time, _ = time.Parse(time.RFC3339Nano, ts)
+	e.Name, _ = raw["name"].(string)
+	e.Msg, _ = raw["msg"].(string)
+	for k, v := range raw {
+		switch k {
+		case "ts", "level", "name", "msg":
+		default:
+			if e.Fields == nil {
+				e.Fields = map[string]any{}
+			}
+			e.Fields[k] = v
+		}
+	}
+	return e, true
+}
+
+// parseTextFields parses the "k=v k=v | msg" of a text line, where a value may be a Go
+// quoted string; it reports false when s does not start with such pairs.
+func parseTextFields(s string) (fields map[string]any, msg string, ok bool) {
+	fields = map[string]any{}
+	for {
+		k, rest, ok := strings.Cut(s, "=")
+		if !ok || k == "" || strings.ContainsAny(k, ` "'|`) {
+			return nil, "", false
+		}
+		v := ""
+		if q, err := strconv.QuotedPrefix(rest); err == nil && rest[0] == '"' {
+			v, _ = strconv.Unquote(q)
+			s = rest[len(q):]
+		} else if i := strings.IndexByte(rest, ' '); i >= 0 {
+			v, s = rest[:i], rest[i:]
+		} else {
+			return nil, "", false
+		}
+		fields[k] = v
+		if msg, ok := strings.CutPrefix(s, " | "); ok {
+			return fields, msg, true
+		}
+		if s, ok = strings.CutPrefix(s, " "); !ok {
+			return nil, "", false
+		}
+	}
+}
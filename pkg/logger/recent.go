@@ -0,0 +1,94 @@
+package logger
+
+import (
+	"sort"
+	"sync"
+)
+
+// DefaultRecent is the number of recent entries services keep for /logz.
+const DefaultRecent = 500
+
+var (
+	recentMu      sync.Mutex
+	defaultRecent int
+)
+
+// SetDefaultRecent makes loggers created afterwards without WithRecent keep their last n
+// entries in memory (see Recent), unless LOG_RECENT is set. Services call it before
+// creating their loggers so /logz shows every logger.
+func SetDefaultRecent(n int) {
+	recentMu.Lock()
+	defaultRecent = max(n, 0)
+	recentMu.Unlock()
+}
+
+func defaultRecentSize() int {
+	recentMu.Lock()
+	defer recentMu.Unlock()
+	return defaultRecent
+}
+
+// ring keeps the last entries of a core.
+type ring struct {
+	mu   sync.Mutex
+	buf  []Entry
+	next int // index the next entry goes to
+	full bool
+}
+
+func newRing(n int) *ring { return &ring{buf: make([]Entry, n)} }
+
+func (r *ring) add(e Entry) {
+	r.mu.Lock()
+	r.buf[r.next] = e
+	r.next++
+	if r.next == len(r.buf) {
+		r.next, r.full = 0, true
+	}
+	r.mu.Unlock()
+}
+
+// entries returns the kept entries oldest first.
+func (r *ring) entries() []Entry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.full {
+		return append([]Entry(nil), r.buf[:r.next]...)
+	}
+	out := make([]Entry, 0, len(r.buf))
+	out = append(out, r.buf[r.next:]...)
+	return append(out, r.buf[:r.next]...)
+}
+
+// Recent returns the last entries logged through this logger and the loggers sharing its
+// output (With), oldest first; nil without WithRecent. Entries filtered out by the level
+// are not kept.
+func (l *Logger) Recent() []Entry {
+	if l.core.recent == nil {
+		return nil
+	}
+	return l.core.recent.entries()
+}
+
+// Recent returns the kept entries of every running logger matching q, oldest first; the
+// in-memory counterpart of Search for the loggers keeping recent entries.
+func Recent(q Query) []Entry {
+	registry.mu.Lock()
+	rings := make([]*ring, 0, len(registry.cores))
+	for c := range registry.cores {
+		if c.recent != nil {
+			rings = append(rings, c.recent)
+		}
+	}
+	registry.mu.Unlock()
+	var out []Entry
+	for _, r := range rings {
+		for _, e := range r.entries() {
+			if q.Match(e) {
+				out = append(out, e)
+			}
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Time.Before(out[j].Time) })
+	return out
+}
@@ -0,0 +1,79 @@
+package logger
+
+import "strings"
+
+// Redacted replaces the value of a redacted field.
+const Redacted = "[REDACTED]"
+
+// redactor masks the fields whose keys it holds, lower-cased.
+type redactor map[string]struct{}
+
+// newRedactor returns nil when keys has no non-blank key. Redacting "error" also redacts
+// "error_chain" (ErrorE).
+func newRedactor(keys []string) redactor {
+	var r redactor
+	for _, k := range keys {
+		if k = strings.ToLower(strings.TrimSpace(k)); k == "" {
+			continue
+		}
+		if r == nil {
+			r = redactor{}
+		}
+		r[k] = struct{}{}
+	}
+	if r.masks(ErrorKey) {
+		// the chain repeats the error's message
+		r[ErrorChainKey] = struct{}{}
+	}
+	return r
+}
+
+func (r redactor) masks(key string) bool {
+	_, ok := r[strings.ToLower(key)]
+	return ok
+}
+
+// fieldMap masks the redacted keys of m in place.
+func (r redactor) fieldMap(m map[string]any) map[string]any {
+	if r == nil {
+		return m
+	}
+	for k := range m {
+		if r.masks(k) {
+			m[k] = Redacted
+		}
+	}
+	return m
+}
+
+// fields returns extra with the redacted keys masked, copying it only when one is.
+func (r redactor) fields(extra []field) []field {
+	if r == nil {
+		return extra
+	}
+	var out []field
+	for i, f := range extra {
+		if !r.masks(f.key) {
+			continue
+		}
+		if out == nil {
+			out = append([]field(nil), extra...)
+		}
+		out[i].val = Redacted
+	}
+	if out == nil {
+		return extra
+	}
+	return out
+}
+
+// parseRedact parses LOG_REDACT, a comma-separated list of keys.
+func parseRedact(spec string) []string {
+	var keys []string
+	for _, k := range strings.Split(spec, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
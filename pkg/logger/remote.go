@@ -0,0 +1,221 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Remote shipping.
+//
+// A RemoteSink receives the entries written to the file in batches, from a background
+// shipper: logging never waits for the network. When the queue is full (the backend is
+// down or slow) entries are dropped and counted on stderr rather than blocking callers;
+// the file keeps every entry.
+
+// RemoteSink ships batches of entries to a log backend, e.g. LokiSink or OTLPSink. Push
+// is called from one goroutine at a time and should give up when ctx ends. Loggers given
+// the same sink share its shipper, so sinks should be pointers.
+type RemoteSink interface {
+	Push(ctx context.Context, entries []Entry) error
+}
+
+// Shipping parameters.
+const (
+	remoteQueueSize   = 4096
+	maxRemoteBatch    = 500
+	remoteInterval    = time.Second
+	remotePushTimeout = 10 * time.Second
+)
+
+var (
+	remoteMu  sync.Mutex
+	shippers  = map[RemoteSink]*shipper{}
+	envRemote RemoteSink // from LOG_REMOTE, nil when unset
+)
+
+// shipper batches the entries queued for one sink and pushes them in the background.
+type shipper struct {
+	sink    RemoteSink
+	refs    int // under remoteMu
+	mu      sync.RWMutex
+	closed  bool
+	queue   chan Entry
+	flushes chan chan struct{}
+	done    chan struct{}
+	dropped atomic.Int64
+}
+
+// openShipper returns the shipper of sink, starting it on first use.
+func openShipper(sink RemoteSink) *shipper {
+	remoteMu.Lock()
+	defer remoteMu.Unlock()
+	if s, ok := shippers[sink]; ok {
+		s.refs++
+		return s
+	}
+	s := &shipper{sink: sink, refs: 1, queue: make(chan Entry, remoteQueueSize),
+		flushes: make(chan chan struct{}), done: make(chan struct{})}
+	shippers[sink] = s
+	go s.run()
+	return s
+}
+
+// enqueue queues e without waiting; a full queue drops it.
+func (s *shipper) enqueue(e Entry) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.queue <- e:
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+// flush waits until the entries queued so far are pushed (or failed to).
+func (s *shipper) flush() {
+	s.mu.RLock()
+	if s.closed {
+		s.mu.RUnlock()
+		return
+	}
+	ack := make(chan struct{})
+	s.flushes <- ack
+	s.mu.RUnlock()
+	<-ack
+}
+
+// release stops the shipper, pushing what is queued, once the last logger using it closes.
+func (s *shipper) release() {
+	remoteMu.Lock()
+	s.refs--
+	last := s.refs == 0
+	if last {
+		delete(shippers, s.sink)
+	}
+	remoteMu.Unlock()
+	if !last {
+		return
+	}
+	s.mu.Lock()
+	s.closed = true
+	close(s.queue)
+	s.mu.Unlock()
+	<-s.done
+}
+
+func (s *shipper) run() {
+	defer close(s.done)
+	batch := make([]Entry, 0, maxRemoteBatch)
+	send := func() {
+		if len(batch) > 0 {
+			s.push(batch)
+			batch = batch[:0]
+		}
+	}
+	tick := time.NewTicker(remoteInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case e, ok := <-s.queue:
+			if !ok {
+				send()
+				return
+			}
+			if batch = append(batch, e); len(batch) >= maxRemoteBatch {
+				send()
+			}
+		case <-tick.C:
+			send()
+		case ack := <-s.flushes:
+		drain:
+			for {
+				select {
+				case e := <-s.queue:
+					if batch = append(batch, e); len(batch) >= maxRemoteBatch {
+						send()
+					}
+				default:
+					break drain
+				}
+			}
+			send()
+			close(ack)
+		}
+	}
+}
+
+// push sends batch, retrying once; a batch that still fails is dropped with a warning.
+func (s *shipper) push(batch []Entry) {
+	if n := s.dropped.Swap(0); n > 0 {
+		fmt.Fprintf(os.Stderr, "logger: remote sink queue full, %d entries dropped\n", n)
+	}
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if attempt > 0 {
+			time.Sleep(remoteInterval)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), remotePushTimeout)
+		err = s.sink.Push(ctx, batch)
+		cancel()
+		if err == nil {
+			return
+		}
+	}
+	fmt.Fprintf(os.Stderr, "logger: remote sink: %d entries dropped: %v\n", len(batch), err)
+}
+
+// flushShippers flushes every running shipper.
+func flushShippers() {
+	remoteMu.Lock()
+	all := make([]*shipper, 0, len(shippers))
+	for _, s := range shippers {
+		all = append(all, s)
+	}
+	remoteMu.Unlock()
+	for _, s := range all {
+		s.flush()
+	}
+}
+
+// parseRemoteSpec builds the sink of LOG_REMOTE, "loki=URL" or "otlp=URL", labelled with
+// LOG_REMOTE_LABELS ("job=loader,site=p1") and the host name.
+func parseRemoteSpec(spec, labelSpec string) (RemoteSink, error) {
+	kind, url, ok := strings.Cut(strings.TrimSpace(spec), "=")
+	if !ok || strings.TrimSpace(url) == "" {
+		return nil, fmt.Errorf("want loki=URL or otlp=URL, got %q", spec)
+	}
+	labels := map[string]string{}
+	if host, err := os.Hostname(); err == nil {
+		labels["host"] = host
+	}
+	for _, kv := range strings.Split(labelSpec, ",") {
+		if strings.TrimSpace(kv) == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || strings.TrimSpace(k) == "" {
+			return nil, fmt.Errorf("invalid label %q in LOG_REMOTE_LABELS", kv)
+		}
+		labels[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	if _, ok := labels["job"]; !ok {
+		labels["job"] = filepath.Base(os.Args[0])
+	}
+	switch strings.ToLower(strings.TrimSpace(kind)) {
+	case "loki":
+		return NewLokiSink(strings.TrimSpace(url), labels), nil
+	case "otlp":
+		return NewOTLPSink(strings.TrimSpace(url), labels), nil
+	default:
+		return nil, fmt.Errorf("unknown remote sink %q, want loki or otlp", kind)
+	}
+}
@@ -0,0 +1,108 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const lokiPushPath = "/loki/api/v1/push"
+
+// LokiSink pushes entries to Grafana Loki. Each batch becomes one stream per logger and
+// level, labelled with the sink's labels plus "logger" and "level"; the lines are the
+// messages followed by their fields as k=v pairs, for Loki's logfmt parser.
+type LokiSink struct {
+	url    string
+	labels map[string]string
+	client *http.Client
+}
+
+// NewLokiSink creates a sink pushing to the Loki at url, e.g. "http://loki:3100" (the push
+// path is added unless present), labelling the streams with labels such as job and host.
+func NewLokiSink(url string, labels map[string]string) *LokiSink {
+	url = strings.TrimRight(url, "/")
+	if !strings.HasSuffix(url, lokiPushPath) {
+		url += lokiPushPath
+	}
+	cp := make(map[string]string, len(labels))
+	for k, v := range labels {
+		cp[k] = v
+	}
+	return &LokiSink{url: url, labels: cp, client: &http.Client{Timeout: remotePushTimeout}}
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// Push implements RemoteSink.
+func (s *LokiSink) Push(ctx context.Context, entries []Entry) error {
+	var streams []*lokiStream
+	byKey := map[string]*lokiStream{}
+	for _, e := range entries {
+		key := e.Name + "\x00" + e.Level.String()
+		st, ok := byKey[key]
+		if !ok {
+			labels := make(map[string]string, len(s.labels)+2)
+			for k, v := range s.labels {
+				labels[k] = v
+			}
+			labels["logger"], labels["level"] = e.Name, strings.ToLower(e.Level.String())
+			st = &lokiStream{Stream: labels}
+			byKey[key] = st
+			streams = append(streams, st)
+		}
+		st.Values = append(st.Values, [2]string{strconv.FormatInt(e.Time.UnixNano(), 10), lokiLine(e)})
+	}
+	body, err := json.Marshal(map[string]any{"streams": streams})
+	if err != nil {
+		return fmt.Errorf("loki: encode: %w", err)
+	}
+	return postJSON(ctx, s.client, s.url, body, "loki")
+}
+
+// lokiLine renders e as its message followed by the fields as sorted k=v pairs.
+func lokiLine(e Entry) string {
+	if len(e.Fields) == 0 {
+		return e.Msg
+	}
+	keys := make([]string, 0, len(e.Fields))
+	for k := range e.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString(e.Msg)
+	for _, k := range keys {
+		b.WriteString(" " + k + "=" + textValue(e.Fields[k]))
+	}
+	return b.String()
+}
+
+// postJSON posts body to url and fails on a non-2xx status, quoting the start of the
+// response.
+func postJSON(ctx context.Context, client *http.Client, url string, body []byte, backend string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%s: %w", backend, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", backend, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s: %s", backend, resp.Status, bytes.TrimSpace(msg))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
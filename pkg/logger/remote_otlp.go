@@ -0,0 +1,127 @@
+package logger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const otlpLogsPath = "/v1/logs"
+
+// OTLPSink exports entries to an OpenTelemetry collector over OTLP/HTTP with JSON
+// encoding. Each logger is an instrumentation scope; the entry's fields become the record
+// attributes and the sink's attributes describe the resource.
+type OTLPSink struct {
+	url      string
+	resource []otlpKeyValue
+	client   *http.Client
+}
+
+// NewOTLPSink creates a sink exporting to the collector at endpoint, e.g.
+// "http://otel:4318" (the logs path is added unless present), with resource attributes
+// such as host; a "job" attribute also sets service.name unless given.
+func NewOTLPSink(endpoint string, resource map[string]string) *OTLPSink {
+	url := strings.TrimRight(endpoint, "/")
+	if !strings.HasSuffix(url, otlpLogsPath) {
+		url += otlpLogsPath
+	}
+	attrs := make(map[string]any, len(resource)+1)
+	for k, v := range resource {
+		attrs[k] = v
+	}
+	if job, ok := resource["job"]; ok && resource["service.name"] == "" {
+		attrs["service.name"] = job
+	}
+	return &OTLPSink{url: url, resource: otlpAttributes(attrs), client: &http.Client{Timeout: remotePushTimeout}}
+}
+
+type otlpKeyValue struct {
+	Key   string         `json:"key"`
+	Value map[string]any `json:"value"`
+}
+
+type otlpRecord struct {
+	TimeUnixNano   string         `json:"timeUnixNano"`
+	SeverityNumber int            `json:"severityNumber"`
+	SeverityText   string         `json:"severityText"`
+	Body           map[string]any `json:"body"`
+	Attributes     []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpScopeLogs struct {
+	Scope      map[string]string `json:"scope"`
+	LogRecords []otlpRecord      `json:"logRecords"`
+}
+
+// Push implements RemoteSink.
+func (s *OTLPSink) Push(ctx context.Context, entries []Entry) error {
+	var scopes []*otlpScopeLogs
+	byLogger := map[string]*otlpScopeLogs{}
+	for _, e := range entries {
+		sl, ok := byLogger[e.Name]
+		if !ok {
+			sl = &otlpScopeLogs{Scope: map[string]string{"name": e.Name}}
+			byLogger[e.Name] = sl
+			scopes = append(scopes, sl)
+		}
+		sl.LogRecords = append(sl.LogRecords, otlpRecord{
+			TimeUnixNano:   strconv.FormatInt(e.Time.UnixNano(), 10),
+			SeverityNumber: otlpSeverity(e.Level),
+			SeverityText:   e.Level.String(),
+			Body:           map[string]any{"stringValue": e.Msg},
+			Attributes:     otlpAttributes(e.Fields),
+		})
+	}
+	body, err := json.Marshal(map[string]any{"resourceLogs": []any{map[string]any{
+		"resource":  map[string]any{"attributes": s.resource},
+		"scopeLogs": scopes,
+	}}})
+	if err != nil {
+		return fmt.Errorf("otlp: encode: %w", err)
+	}
+	return postJSON(ctx, s.client, s.url, body, "otlp")
+}
+
+// otlpSeverity maps level to the first severity number of its OTLP range.
+func otlpSeverity(level Level) int {
+	switch {
+	case level >= Panic:
+		return 21
+	case level == Error:
+		return 17
+	case level == Warn:
+		return 13
+	case level == Info:
+		return 9
+	default:
+		return 5
+	}
+}
+
+// otlpAttributes encodes fields as OTLP attributes sorted by key, keeping booleans and
+// numbers typed and rendering anything else as a string.
+func otlpAttributes(fields map[string]any) []otlpKeyValue {
+	out := make([]otlpKeyValue, 0, len(fields))
+	for k, v := range fields {
+		var value map[string]any
+		switch v := v.(type) {
+		case string:
+			value = map[string]any{"stringValue": v}
+		case bool:
+			value = map[string]any{"boolValue": v}
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32:
+			value = map[string]any{"intValue": fmt.Sprint(v)} // int64 is a JSON string in OTLP
+		case float32, float64:
+			value = map[string]any{"doubleValue": v}
+		default:
+			value = map[string]any{"stringValue": fmt.Sprint(v)}
+		}
+		out = append(out, otlpKeyValue{Key: k, Value: value})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out
+}
@@ -0,0 +1,241 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rotation configures when a logFile rolls over.
+type rotation struct {
+	maxSize    int64 // bytes; 0 disables size rotation
+	maxBackups int
+	daily      bool
+	keepDays   int            // dated files kept by daily rotation; 0 keeps all
+	loc        *time.Location // where days start; nil is time.Local
+}
+
+// logFile is a log file opened for append and shared by every logger of the process writing
+// to the same path (e.g. all managers logging to entities.log), so size accounting and
+// rotation see all writes.
+//
+// When maxSize > 0 and a write would take the file past it, the file is rolled over first:
+// path.1 .. path.N shift up by one, the oldest beyond maxBackups is removed and the current
+// file becomes path.1. With daily rotation the first write of a new day (in loc) moves the
+// file to path.YYYY-MM-DD, named after the day it holds, and removes the dated files older
+// than keepDays days.
+type logFile struct {
+	path string
+	rotation
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+	day  string // day the current file holds, with daily rotation
+	refs int
+}
+
+// rotateNow is the clock of daily rotation; tests replace it.
+var rotateNow = time.Now
+
+var (
+	filesMu sync.Mutex
+	files   = map[string]*logFile{}
+)
+
+// openLogFile returns the shared file of path, opening it on first use. The rotation
+// settings of the first opener apply to every logger sharing the file.
+func openLogFile(path string, rot rotation) (*logFile, error) {
+	key, err := filepath.Abs(path)
+	if err != nil {
+		key = path
+	}
+	filesMu.Lock()
+	defer filesMu.Unlock()
+	if lf, ok := files[key]; ok {
+		lf.refs++
+		return lf, nil
+	}
+	if rot.loc == nil {
+		rot.loc = time.Local
+	}
+	lf := &logFile{path: path, rotation: rot, refs: 1}
+	if err := lf.open(); err != nil {
+		return nil, err
+	}
+	files[key] = lf
+	return lf, nil
+}
+
+func (lf *logFile) open() error {
+	f, err := os.OpenFile(lf.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	lf.f, lf.size = f, info.Size()
+	// A file kept from a previous run holds the day it was last written.
+	lf.day = lf.dayOf(rotateNow())
+	if lf.size > 0 {
+		lf.day = lf.dayOf(info.ModTime())
+	}
+	return nil
+}
+
+func (lf *logFile) dayOf(t time.Time) string { return t.In(lf.loc).Format(time.DateOnly) }
+
+// Write appends p, rotating first when a new day started or p would take the file past
+// maxSize. An entry larger than maxSize is still written whole, into a fresh file.
+func (lf *logFile) Write(p []byte) (int, error) {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	if lf.f == nil {
+		return 0, os.ErrClosed
+	}
+	if lf.daily {
+		if today := lf.dayOf(rotateNow()); today != lf.day {
+			if err := lf.rotateDay(today); err != nil {
+				fmt.Fprintf(os.Stderr, "logger: rotate %s: %v\n", lf.path, err)
+				if lf.f == nil {
+					return 0, err
+				}
+			}
+		}
+	}
+	if lf.maxSize > 0 && lf.size > 0 && lf.size+int64(len(p)) > lf.maxSize {
+		if err := lf.rotate(); err != nil {
+			fmt.Fprintf(os.Stderr, "logger: rotate %s: %v\n", lf.path, err)
+			if lf.f == nil {
+				return 0, err
+			}
+		}
+	}
+	n, err := lf.f.Write(p)
+	lf.size += int64(n)
+	return n, err
+}
+
+// rotate closes the current file, shifts the backups and reopens path empty. The file is
+// closed before renaming so rotation also works where open files cannot be renamed.
+func (lf *logFile) rotate() error {
+	if err := lf.f.Close(); err != nil {
+		lf.f = nil
+		return lf.reopen(err)
+	}
+	lf.f = nil
+
+	var err error
+	if lf.maxBackups <= 0 {
+		err = os.Remove(lf.path)
+	} else {
+		_ = os.Remove(backupName(lf.path, lf.maxBackups))
+		for i := lf.maxBackups - 1; i >= 1; i-- {
+			if rerr := os.Rename(backupName(lf.path, i), backupName(lf.path, i+1)); rerr != nil && !os.IsNotExist(rerr) {
+				err = rerr
+			}
+		}
+		if rerr := os.Rename(lf.path, backupName(lf.path, 1)); rerr != nil {
+			err = rerr
+		}
+	}
+	return lf.reopen(err)
+}
+
+// rotateDay moves the file of the previous day aside, removes the dated files past
+// keepDays and reopens path empty for today.
+func (lf *logFile) rotateDay(today string) error {
+	var err error
+	if lf.size > 0 {
+		if err = lf.f.Close(); err == nil {
+			err = os.Rename(lf.path, freeName(lf.path+"."+lf.day))
+		}
+		lf.f = nil
+	}
+	lf.day = today
+	if lf.keepDays > 0 {
+		if perr := lf.pruneDays(today); err == nil {
+			err = perr
+		}
+	}
+	if lf.f != nil {
+		return err
+	}
+	return lf.reopen(err)
+}
+
+// pruneDays removes the dated files of path older than keepDays days before today.
+func (lf *logFile) pruneDays(today string) error {
+	t, err := time.ParseInLocation(time.DateOnly, today, lf.loc)
+	if err != nil {
+		return err
+	}
+	cutoff := t.AddDate(0, 0, -lf.keepDays).Format(time.DateOnly)
+	dated, err := filepath.Glob(lf.path + ".????-??-??*")
+	if err != nil {
+		return err
+	}
+	for _, p := range dated {
+		day := strings.TrimPrefix(p, lf.path+".")[:len(time.DateOnly)]
+		if _, perr := time.Parse(time.DateOnly, day); perr != nil || day >= cutoff {
+			continue
+		}
+		if rerr := os.Remove(p); rerr != nil {
+			err = rerr
+		}
+	}
+	return err
+}
+
+// freeName returns name, or name.1, name.2... when it is taken (e.g. the clock went back).
+func freeName(name string) string {
+	for i, n := 1, name; ; i++ {
+		if _, err := os.Stat(n); os.IsNotExist(err) {
+			return n
+		}
+		n = fmt.Sprintf("%s.%d", name, i)
+	}
+}
+
+// reopen opens path again after a rotation attempt; cause is the rotation error, if any.
+func (lf *logFile) reopen(cause error) error {
+	if err := lf.open(); err != nil {
+		return fmt.Errorf("reopen: %w", err)
+	}
+	return cause
+}
+
+// release drops one reference and closes the file with the last one.
+func (lf *logFile) release() error {
+	filesMu.Lock()
+	lf.refs--
+	last := lf.refs == 0
+	if last {
+		for k, v := range files {
+			if v == lf {
+				delete(files, k)
+			}
+		}
+	}
+	filesMu.Unlock()
+	if !last {
+		return nil
+	}
+
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	if lf.f == nil {
+		return nil
+	}
+	err := lf.f.Close()
+	lf.f = nil
+	return err
+}
+
+func backupName(path string, n int) string { return fmt.Sprintf("%s.%d", path, n) }
@@ -0,0 +1,168 @@
+package logger
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sampler suppresses repeated identical entries of one core: within a window starting at
+// an entry, the first entries identical to it (same level, message and fields) are logged
+// and the others only counted. When the window ends a summary entry reports the count, so
+// an outage logging the same failure every second costs a few lines per window.
+type sampler struct {
+	first  int
+	window time.Duration
+
+	mu   sync.Mutex
+	seen map[string]*sampled
+	stop chan struct{}
+	done chan struct{}
+}
+
+// sampled is the window of one distinct entry.
+type sampled struct {
+	l          *Logger // logger of the first entry, whose fields the summary carries
+	level      Level
+	msg        string
+	extra      []field
+	start      time.Time
+	count      int // entries in the window, logged or not
+	suppressed int
+}
+
+func newSampler(first int, window time.Duration) *sampler {
+	s := &sampler{first: max(first, 1), window: window, seen: map[string]*sampled{},
+		stop: make(chan struct{}), done: make(chan struct{})}
+	go s.run()
+	return s
+}
+
+// allow reports whether an entry is logged; it logs the summary of an ended window of
+// the same entry first.
+func (s *sampler) allow(l *Logger, level Level, msg string, extra []field, now time.Time) bool {
+	key := sampleKey(l, level, msg, extra)
+	s.mu.Lock()
+	e := s.seen[key]
+	var ended *sampled
+	if e != nil && now.Sub(e.start) >= s.window {
+		ended, e = e, nil
+	}
+	if e == nil {
+		e = &sampled{l: l, level: level, msg: msg, extra: extra, start: now}
+		s.seen[key] = e
+	}
+	e.count++
+	ok := e.count <= s.first
+	if !ok {
+		e.suppressed++
+	}
+	s.mu.Unlock()
+	if ended != nil {
+		ended.summarize(now)
+	}
+	return ok
+}
+
+// run ends the windows that are over, so the summary of an entry that stopped repeating
+// is not held back until it recurs.
+func (s *sampler) run() {
+	defer close(s.done)
+	t := time.NewTicker(s.window)
+	defer t.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case now := <-t.C:
+			s.end(func(e *sampled) bool { return now.Sub(e.start) >= s.window })
+		}
+	}
+}
+
+// end drops the windows selected by ended and logs the summaries of those that
+// suppressed entries.
+func (s *sampler) end(ended func(*sampled) bool) {
+	var out []*sampled
+	s.mu.Lock()
+	for k, e := range s.seen {
+		if ended(e) {
+			delete(s.seen, k)
+			if e.suppressed > 0 {
+				out = append(out, e)
+			}
+		}
+	}
+	s.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].start.Before(out[j].start) })
+	now := time.Now()
+	for _, e := range out {
+		e.summarize(now)
+	}
+}
+
+// flush ends every window, so the suppressed counts so far are logged.
+func (s *sampler) flush() { s.end(func(*sampled) bool { return true }) }
+
+// close stops the goroutine and logs the pending summaries.
+func (s *sampler) close() {
+	select {
+	case <-s.stop:
+		return
+	default:
+		close(s.stop)
+	}
+	<-s.done
+	s.flush()
+}
+
+// summarize logs the count of the entries suppressed in e's window, with e's message and
+// fields and a "repeated" field.
+func (e *sampled) summarize(now time.Time) {
+	msg := fmt.Sprintf("%s (repeated %d times in %s)", e.msg, e.suppressed, now.Sub(e.start).Round(time.Second))
+	extra := append(append([]field(nil), e.extra...), field{"repeated", e.suppressed})
+	e.l.write(e.level, msg, now, extra)
+	e.l.emit(e.level, msg, now, extra)
+}
+
+// sampleKey identifies identical entries: level, message and the fields of the logger and
+// the entry.
+func sampleKey(l *Logger, level Level, msg string, extra []field) string {
+	var b strings.Builder
+	b.WriteString(strconv.Itoa(int(level)))
+	b.WriteByte(0)
+	b.WriteString(msg)
+	if len(l.fields) > 0 {
+		keys := make([]string, 0, len(l.fields))
+		for k := range l.fields {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(&b, "\x00%s=%v", k, l.fields[k])
+		}
+	}
+	for _, f := range extra {
+		fmt.Fprintf(&b, "\x00%s=%v", f.key, f.val)
+	}
+	return b.String()
+}
+
+// parseSampling parses LOG_SAMPLING: "FIRST/WINDOW" (e.g. "5/1m") or "WINDOW", which logs
+// the first entry of each window.
+func parseSampling(spec string) (first int, window time.Duration, err error) {
+	first = 1
+	if n, w, ok := strings.Cut(spec, "/"); ok {
+		if first, err = strconv.Atoi(strings.TrimSpace(n)); err != nil || first < 1 {
+			return 0, 0, fmt.Errorf("bad entry count %q", n)
+		}
+		spec = w
+	}
+	if window, err = time.ParseDuration(strings.TrimSpace(spec)); err != nil || window <= 0 {
+		return 0, 0, fmt.Errorf("bad window %q", spec)
+	}
+	return first, window, nil
+}
@@ -0,0 +1,76 @@
+package logger
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Format selects how a sink writes entries.
+type Format int
+
+const (
+	Plain  Format = iota // the logger's format: JSON with WithJSON, else text
+	Pretty               // local time, colored level, aligned logger name, then message and fields
+	Text                 // text whatever WithJSON says
+	JSON                 // one JSON object per line whatever WithJSON says
+)
+
+// ParseFormat parses "plain", "pretty", "text" or "json" (case-insensitive).
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "plain", "":
+		return Plain, nil
+	case "pretty":
+		return Pretty, nil
+	case "text":
+		return Text, nil
+	case "json":
+		return JSON, nil
+	default:
+		return Plain, fmt.Errorf("logger: unknown format %q", s)
+	}
+}
+
+// resolve returns the format written for f by a logger whose WithJSON is useJSON.
+func (f Format) resolve(useJSON bool) Format {
+	if f != Plain {
+		return f
+	}
+	if useJSON {
+		return JSON
+	}
+	return Text
+}
+
+// Sink is a further destination of a logger's entries, next to the file and the console;
+// see WithSink.
+type Sink struct {
+	Writer io.Writer
+	Format Format
+	Level  Level
+}
+
+// output is one destination of formatted entries: the log file, the console or a Sink.
+// Remote sinks, hooks and the recent entries get the entries unformatted (emit).
+type output struct {
+	w      io.Writer
+	format Format      // never Plain
+	color  bool        // Pretty with colors
+	level  Level       // on top of the logger level; Debug filters nothing
+	syslog *syslogSink // the file's: also gets every line written to it
+	batch  []byte      // lines gathered by the async writer
+}
+
+func newOutput(w io.Writer, f Format, useJSON bool, level Level) *output {
+	f = f.resolve(useJSON)
+	return &output{w: w, format: f, color: f == Pretty && useColor(w), level: level}
+}
+
+// write writes one formatted entry.
+func (o *output) write(level Level, line []byte) {
+	_, _ = o.w.Write(line)
+	if o.syslog != nil {
+		o.syslog.write(level, line)
+	}
+}
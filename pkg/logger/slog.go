@@ -0,0 +1,123 @@
+package logger
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+// SlogHandler returns a slog.Handler writing through l, so libraries and code using the
+// standard structured logger get l's sinks, format, level, redaction, sampling and hooks:
+//
+//	slog.SetDefault(slog.New(lgr.SlogHandler()))
+//
+// Levels map to the nearest of ours at or below them (slog.LevelWarn+2 is Warn). Attributes
+// become entry fields, those of groups prefixed with the group name and a dot
+// ("http.status"), and the fields of the record's context (ContextWithFields) are added.
+// With WithCaller, the call site is the one slog recorded.
+func (l *Logger) SlogHandler() slog.Handler { return &slogHandler{l: l} }
+
+// Slog returns a *slog.Logger writing through l; see SlogHandler.
+func (l *Logger) Slog() *slog.Logger { return slog.New(l.SlogHandler()) }
+
+type slogHandler struct {
+	l      *Logger
+	attrs  []field // from WithAttrs, already prefixed
+	prefix string  // open groups, e.g. "http."
+}
+
+// fromSlogLevel maps a slog level to ours.
+func fromSlogLevel(level slog.Level) Level {
+	switch {
+	case level >= slog.LevelError:
+		return Error
+	case level >= slog.LevelWarn:
+		return Warn
+	case level >= slog.LevelInfo:
+		return Info
+	default:
+		return Debug
+	}
+}
+
+func (h *slogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return h.l.core.enabled(fromSlogLevel(level))
+}
+
+func (h *slogHandler) Handle(ctx context.Context, r slog.Record) error {
+	level := fromSlogLevel(r.Level)
+	if !h.l.core.enabled(level) {
+		return nil
+	}
+	l := h.l
+	if ctx != nil {
+		l = l.WithContext(ctx)
+	}
+	extra := make([]field, 0, 2+len(h.attrs)+r.NumAttrs())
+	if l.cfg.Caller && r.PC != 0 {
+		f, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		extra = append(extra, field{CallerKey, trimPath(f.File) + ":" + strconv.Itoa(f.Line)}, field{FuncKey, trimFunc(f.Function)})
+	}
+	extra = append(extra, h.attrs...)
+	r.Attrs(func(a slog.Attr) bool {
+		extra = appendAttr(extra, h.prefix, a)
+		return true
+	})
+	at := r.Time
+	if at.IsZero() {
+		at = time.Now()
+	}
+	l.logEntryAt(level, r.Message, at, extra)
+	return nil
+}
+
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	c := *h
+	c.attrs = append([]field(nil), h.attrs...)
+	for _, a := range attrs {
+		c.attrs = appendAttr(c.attrs, h.prefix, a)
+	}
+	return &c
+}
+
+func (h *slogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	c := *h
+	c.prefix = h.prefix + name + "."
+	return &c
+}
+
+// appendAttr appends a as fields under prefix, following the slog.Handler rules: values
+// are resolved, empty attributes dropped and groups flattened (inlined without a key).
+func appendAttr(fields []field, prefix string, a slog.Attr) []field {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return fields
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, g := range a.Value.Group() {
+			fields = appendAttr(fields, prefix, g)
+		}
+		return fields
+	}
+	var v any
+	switch a.Value.Kind() {
+	case slog.KindDuration:
+		v = a.Value.Duration().String()
+	case slog.KindTime:
+		v = a.Value.Time().Format(time.RFC3339Nano)
+	default:
+		v = fieldValue(a.Value.Any())
+	}
+	return append(fields, field{prefix + a.Key, v})
+}
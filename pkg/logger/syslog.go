@@ -0,0 +1,83 @@
+package logger
+
+import (
+	"bytes"
+	"sync"
+)
+
+// syslogWriter is the part of *syslog.Writer a syslog sink uses.
+type syslogWriter interface {
+	Debug(m string) error
+	Info(m string) error
+	Warning(m string) error
+	Err(m string) error
+	Crit(m string) error
+	Close() error
+}
+
+// syslogSink sends entries to the local syslog daemon, which is journald under systemd
+// (journalctl -t TAG). Loggers with the same tag share one connection.
+type syslogSink struct {
+	tag  string
+	mu   sync.Mutex
+	w    syslogWriter
+	refs int
+}
+
+var (
+	syslogMu    sync.Mutex
+	syslogSinks = map[string]*syslogSink{}
+)
+
+// openSyslog returns the shared sink of tag, connecting on first use.
+func openSyslog(tag string) (*syslogSink, error) {
+	syslogMu.Lock()
+	defer syslogMu.Unlock()
+	if s, ok := syslogSinks[tag]; ok {
+		s.refs++
+		return s, nil
+	}
+	w, err := dialSyslog(tag)
+	if err != nil {
+		return nil, err
+	}
+	s := &syslogSink{tag: tag, w: w, refs: 1}
+	syslogSinks[tag] = s
+	return s, nil
+}
+
+// write sends one entry with the syslog priority of level.
+func (s *syslogSink) write(level Level, line []byte) {
+	msg := string(bytes.TrimRight(line, "\n"))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case level >= Panic:
+		_ = s.w.Crit(msg)
+	case level == Error:
+		_ = s.w.Err(msg)
+	case level == Warn:
+		_ = s.w.Warning(msg)
+	case level == Info:
+		_ = s.w.Info(msg)
+	default:
+		_ = s.w.Debug(msg)
+	}
+}
+
+// release closes the connection once the last logger using it is closed.
+func (s *syslogSink) release() error {
+	syslogMu.Lock()
+	s.refs--
+	last := s.refs == 0
+	if last {
+		delete(syslogSinks, s.tag)
+	}
+	syslogMu.Unlock()
+	if !last {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Close()
+}
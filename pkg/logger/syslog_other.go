@@ -0,0 +1,10 @@
+//go:build windows || plan9
+
+package logger
+
+import "errors"
+
+// dialSyslog fails: there is no syslog on this platform.
+var dialSyslog = func(tag string) (syslogWriter, error) {
+	return nil, errors.New("syslog is not supported on this platform")
+}
@@ -0,0 +1,10 @@
+//go:build !windows && !plan9
+
+package logger
+
+import "log/syslog"
+
+// dialSyslog connects to the local syslog daemon; tests replace it.
+var dialSyslog = func(tag string) (syslogWriter, error) {
+	return syslog.New(syslog.LOG_INFO|syslog.LOG_USER, tag)
+}
@@ -0,0 +1,949 @@
+package managers
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"hex_toolset/pkg/api"
+	"hex_toolset/pkg/buildinfo"
+	"hex_toolset/pkg/db/entities"
+	"hex_toolset/pkg/logger"
+	"hex_toolset/pkg/metrics"
+	"hex_toolset/pkg/timeutil"
+	ws "hex_toolset/pkg/websocket"
+)
+
+// AdminServer is the operator endpoint of a long-running service (db_clon, broadcast):
+// health, Prometheus metrics, recent log entries (/logz) and runtime log levels, so a
+// running process can be inspected and made verbose without a restart, plus the optional
+// HandleLineMaintenance, HandleMaintenanceWindows, HandleFlowGraph, HandleRecords,
+// HandleSLO, HandleTakt, HandleModelRuns, HandleStationTargets, HandleEnrichment,
+// HandleStorage, HandleIntegrity, HandleCompact, HandleOEE, HandleProgramRollup,
+// HandleWeeklyTrend, HandleWIP, HandleBandwidth and HandleAudit routes.
+type AdminServer struct {
+	server *http.Server
+	mux    *api.Router
+	log    *logger.Logger
+	audit  *AuditLog         // set by HandleAudit
+	tokens map[string]string // admin tokens by label, set by RequireTokens
+}
+
+// NewAdminServer creates an admin server listening on addr.
+func NewAdminServer(addr string, lgr *logger.Logger) *AdminServer {
+	mux := api.NewRouter()
+	mux.Handle("GET /health", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	}))
+	mux.Handle("GET /metrics", metrics.Handler(metrics.Default))
+	mux.HandleFunc("GET /version", handleVersion)
+	mux.HandleFunc("GET /logz", handleLogz)
+	mux.HandleFunc("GET /admin/log-levels", handleGetLogLevels)
+	mux.HandleFunc("PUT /admin/log-levels", handleSetLogLevel)
+	mux.HandleFunc("DELETE /admin/log-levels", handleResetLogLevels)
+	s := &AdminServer{mux: mux, log: lgr}
+	s.server = &http.Server{
+		Addr:         addr,
+		Handler:      api.Middleware(http.HandlerFunc(s.serveHTTP), lgr),
+		ReadTimeout:  15 * time.Second,
+		WriteTimeout: 15 * time.Second,
+		IdleTimeout:  60 * time.Second,
+	}
+	return s
+}
+
+// RequireTokens authenticates the admin API with tokens (by label, see ParseAdminTokens):
+// a request that changes something must send "Authorization: Bearer <token>" with one of
+// them, and a request with any other bearer token is refused, both with 401. Reads without
+// a token stay open for health checks and scrapers. The audit log records the label of the
+// token as the actor. Without tokens the API is unauthenticated and must stay on loopback.
+// Register it before Run.
+func (s *AdminServer) RequireTokens(tokens map[string]string) {
+	s.tokens = tokens
+}
+
+// serveHTTP authenticates and routes r, recording the requests that change something in
+// the audit log once HandleAudit is registered.
+func (s *AdminServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	r, err := s.authenticate(r)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		api.WriteError(w, r, err)
+		return
+	}
+	if s.audit != nil && changesState(r) {
+		if pattern := s.mux.Pattern(r); pattern != "" {
+			s.audit.auditRequest(w, r, pattern, s.mux)
+			return
+		}
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// authenticate checks the bearer token of r against the admin tokens and returns r with
+// the label of the token in its context (see RequestActor).
+func (s *AdminServer) authenticate(r *http.Request) (*http.Request, error) {
+	if len(s.tokens) == 0 {
+		return r, nil
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || strings.TrimSpace(token) == "" {
+		if changesState(r) {
+			return r, api.Unauthorized("admin token required")
+		}
+		return r, nil
+	}
+	for label, t := range s.tokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(strings.TrimSpace(token))) == 1 {
+			return r.WithContext(context.WithValue(r.Context(), adminTokenKey{}, label)), nil
+		}
+	}
+	return r, api.Unauthorized("unknown admin token")
+}
+
+// changesState reports whether r may change something, i.e. is not a read.
+func changesState(r *http.Request) bool {
+	return r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodOptions
+}
+
+// Run serves until ctx is done, then shuts the server down.
+func (s *AdminServer) Run(ctx context.Context) {
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = s.server.Shutdown(shutdownCtx)
+	}()
+	s.log.Infof("admin server listening on %s", s.server.Addr)
+	if err := s.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		s.log.Errorf("admin server error: %v", err)
+	}
+}
+
+// HandleLineMaintenance exposes the lines disabled for maintenance:
+//
+//	GET /admin/lines          list the disabled lines
+//	PUT /admin/lines/{line}   {"enabled": false, "reason": "PM week 42"} disables a line,
+//	                          {"enabled": true} re-enables it
+//
+// Register it before Run.
+func (s *AdminServer) HandleLineMaintenance(lines *LineMaintenance) {
+	s.mux.HandleFunc("GET /admin/lines", func(w http.ResponseWriter, r *http.Request) error {
+		disabled, err := lines.List(r.Context())
+		if err != nil {
+			return err
+		}
+		api.WriteJSON(w, http.StatusOK, LineMaintenanceChanged{Disabled: disabled})
+		return nil
+	})
+	s.mux.HandleFunc("PUT /admin/lines/{line}", func(w http.ResponseWriter, r *http.Request) error {
+		var body struct {
+			Enabled *bool  `json:"enabled"`
+			Reason  string `json:"reason"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<10)).Decode(&body); err != nil {
+			return api.InvalidRequest("invalid JSON body: %v", err)
+		}
+		if body.Enabled == nil {
+			return api.InvalidRequest(`"enabled" is required`)
+		}
+		line := r.PathValue("line")
+		if *body.Enabled {
+			ok, err := lines.Enable(r.Context(), line)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return api.NotFound("line %q is not disabled", line)
+			}
+			s.log.Warnf("line %s re-enabled", normalizeLine(line))
+		} else {
+			if body.Reason == "" {
+				return api.InvalidRequest(`"reason" is required when disabling a line`)
+			}
+			if err := lines.Disable(r.Context(), line, body.Reason); err != nil {
+				return err
+			}
+			s.log.Warnf("line %s disabled: %s", normalizeLine(line), body.Reason)
+		}
+		disabled, err := lines.List(r.Context())
+		if err != nil {
+			return err
+		}
+		api.WriteJSON(w, http.StatusOK, LineMaintenanceChanged{Disabled: disabled})
+		return nil
+	})
+}
+
+// HandleMaintenanceWindows exposes the planned maintenance windows:
+//
+//	GET    /admin/maintenance-windows?range=EXPR   the windows overlapping the range (default
+//	                                               the next 7 days), daily ones included
+//	POST   /admin/maintenance-windows              {"line": "J01", "range": "2025-03-10 22:00..2025-03-11 06:00",
+//	                                               "reason": "PM"} adds a dated window; no line stops all lines
+//	DELETE /admin/maintenance-windows/{id}         removes a dated window
+//
+// Register it before Run.
+func (s *AdminServer) HandleMaintenanceWindows(windows *MaintenanceWindows) {
+	list := func(w http.ResponseWriter, r *http.Request) error {
+		now := time.Now()
+		tr := timeutil.TimeRange{Start: now, End: now.Add(7 * 24 * time.Hour)}
+		if r.Method == http.MethodGet && (r.URL.Query().Has("range") || r.URL.Query().Has("from")) {
+			var err error
+			if tr, err = api.ParseTimeRange(r); err != nil {
+				return err
+			}
+		}
+		all, err := windows.Between(r.Context(), tr)
+		if err != nil {
+			return fmt.Errorf("maintenance windows of %s: %w", tr, err)
+		}
+		api.WriteJSON(w, http.StatusOK, all)
+		return nil
+	}
+	s.mux.HandleFunc("GET /admin/maintenance-windows", list)
+	s.mux.HandleFunc("POST /admin/maintenance-windows", func(w http.ResponseWriter, r *http.Request) error {
+		var body struct {
+			Line   string `json:"line"`
+			Range  string `json:"range"`
+			Reason string `json:"reason"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<10)).Decode(&body); err != nil {
+			return api.InvalidRequest("invalid JSON body: %v", err)
+		}
+		if body.Range == "" {
+			return api.InvalidRequest(`"range" is required`)
+		}
+		tr, err := timeutil.Parse(body.Range, time.Now())
+		if err != nil {
+			return api.InvalidRange("%v", err)
+		}
+		win, err := windows.Add(r.Context(), body.Line, tr, body.Reason)
+		if err != nil {
+			return err
+		}
+		s.log.Infof("%s planned (id %d)", win, win.ID)
+		api.WriteJSON(w, http.StatusCreated, win)
+		return nil
+	})
+	s.mux.HandleFunc("DELETE /admin/maintenance-windows/{id}", func(w http.ResponseWriter, r *http.Request) error {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			return api.InvalidRequest("invalid window id %q", r.PathValue("id"))
+		}
+		ok, err := windows.Delete(r.Context(), id)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return api.NotFound("no maintenance window %d", id)
+		}
+		s.log.Infof("maintenance window %d removed", id)
+		return list(w, r)
+	})
+}
+
+// HandleStationTargets exposes the station cycle time targets of STATION_VARIANCE:
+//
+//	GET    /admin/station-targets                    list the targets
+//	PUT    /admin/station-targets/{line}/{station}   {"cycle_seconds": 42} sets a target
+//	DELETE /admin/station-targets/{line}/{station}   removes it
+//
+// Register it before Run.
+func (s *AdminServer) HandleStationTargets(targets *StationTargets) {
+	list := func(w http.ResponseWriter, r *http.Request) error {
+		all, err := targets.List(r.Context())
+		if err != nil {
+			return err
+		}
+		api.WriteJSON(w, http.StatusOK, all)
+		return nil
+	}
+	s.mux.HandleFunc("GET /admin/station-targets", list)
+	s.mux.HandleFunc("PUT /admin/station-targets/{line}/{station}", func(w http.ResponseWriter, r *http.Request) error {
+		var body struct {
+			CycleSeconds float64 `json:"cycle_seconds"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<10)).Decode(&body); err != nil {
+			return api.InvalidRequest("invalid JSON body: %v", err)
+		}
+		if body.CycleSeconds <= 0 {
+			return api.InvalidRequest(`"cycle_seconds" must be positive`)
+		}
+		cycle := time.Duration(body.CycleSeconds * float64(time.Second))
+		if err := targets.Set(r.Context(), r.PathValue("line"), r.PathValue("station"), cycle); err != nil {
+			return err
+		}
+		s.log.Infof("station %s/%s target set to %gs", r.PathValue("line"), r.PathValue("station"), body.CycleSeconds)
+		return list(w, r)
+	})
+	s.mux.HandleFunc("DELETE /admin/station-targets/{line}/{station}", func(w http.ResponseWriter, r *http.Request) error {
+		ok, err := targets.Delete(r.Context(), r.PathValue("line"), r.PathValue("station"))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return api.NotFound("station %s/%s has no target", r.PathValue("line"), r.PathValue("station"))
+		}
+		s.log.Infof("station %s/%s target removed", r.PathValue("line"), r.PathValue("station"))
+		return list(w, r)
+	})
+}
+
+// HandleFlowGraph serves GET /api/lines/{line}/flow?range=EXPR (or from/to) with the
+// FlowGraph of the line. The range may not exceed MaxFlowRange.
+func (s *AdminServer) HandleFlowGraph(database *sql.DB) {
+	records := entities.NewRecordManagerEntity(database)
+	s.mux.HandleFunc("GET /api/lines/{line}/flow", func(w http.ResponseWriter, r *http.Request) error {
+		tr, err := api.ParseTimeRange(r)
+		if err != nil {
+			return err
+		}
+		if tr.Duration() > MaxFlowRange {
+			return api.InvalidRange("range %s exceeds %s", tr, MaxFlowRange)
+		}
+		line := normalizeLine(r.PathValue("line"))
+		if line == "" {
+			return api.InvalidRequest("line is required")
+		}
+		g, err := BuildFlowGraph(r.Context(), records, line, tr)
+		if err != nil {
+			return fmt.Errorf("flow graph of %s: %w", line, err)
+		}
+		api.WriteJSON(w, http.StatusOK, g)
+		return nil
+	})
+}
+
+// HandleTakt serves GET /api/lines/{line}/takt?group=G&takt=45s&range=EXPR (or from/to)
+// with the takt adherence of the line's group from the pass history. takt accepts a Go
+// duration or whole seconds.
+func (s *AdminServer) HandleTakt(history *PassHistory) {
+	s.mux.HandleFunc("GET /api/lines/{line}/takt", func(w http.ResponseWriter, r *http.Request) error {
+		if !history.Enabled() {
+			return api.NotFound("pass history is disabled (PASS_HISTORY_SLOTS=0)")
+		}
+		tr, err := api.ParseTimeRange(r)
+		if err != nil {
+			return err
+		}
+		if tr.Duration() > MaxTaktRange {
+			return api.InvalidRange("range %s exceeds %s", tr, MaxTaktRange)
+		}
+		line := normalizeLine(r.PathValue("line"))
+		group := strings.ToUpper(strings.TrimSpace(r.URL.Query().Get("group")))
+		if line == "" || group == "" {
+			return api.InvalidRequest("line and group are required")
+		}
+		takt, err := parseTakt(r.URL.Query().Get("takt"))
+		if err != nil {
+			return err
+		}
+		rep, err := history.Takt(r.Context(), line, group, tr, takt)
+		if err != nil {
+			return fmt.Errorf("takt of %s/%s: %w", line, group, err)
+		}
+		api.WriteJSON(w, http.StatusOK, rep)
+		return nil
+	})
+}
+
+// HandleModelRuns serves GET /api/model-runs?line=&range, the model runs overlapping the
+// range, of one line or all lines.
+func (s *AdminServer) HandleModelRuns(runs *ModelRuns) {
+	s.mux.HandleFunc("GET /api/model-runs", func(w http.ResponseWriter, r *http.Request) error {
+		tr, err := api.ParseTimeRange(r)
+		if err != nil {
+			return err
+		}
+		line := normalizeLine(r.URL.Query().Get("line"))
+		list, err := runs.List(r.Context(), line, tr)
+		if err != nil {
+			return fmt.Errorf("model runs: %w", err)
+		}
+		api.WriteJSON(w, http.StatusOK, list)
+		return nil
+	})
+}
+
+func parseTakt(v string) (time.Duration, error) {
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		if n, nerr := strconv.Atoi(v); nerr == nil {
+			d, err = time.Duration(n)*time.Second, nil
+		}
+	}
+	if err != nil || d <= 0 {
+		return 0, api.InvalidRequest("takt must be a positive duration (e.g. 45s) or seconds, got %q", v)
+	}
+	return d, nil
+}
+
+// DefaultRecordPageSize is the page size of GET /api/records without a limit.
+const DefaultRecordPageSize = 1000
+
+// HandleRecords serves GET /api/records?range=EXPR (or from/to) with the raw records of the
+// range, one page at a time: ?limit=N (at most entities.MaxPageSize) sets the page size and
+// ?cursor= the "next" value of the previous page. Any range is accepted, since a page
+// never loads more than limit records; archived days are read back from their files.
+func (s *AdminServer) HandleRecords(database *sql.DB) {
+	records := NewTieringManager(database, "", 0, nil)
+	s.mux.HandleFunc("GET /api/records", func(w http.ResponseWriter, r *http.Request) error {
+		tr, err := api.ParseTimeRange(r)
+		if err != nil {
+			return err
+		}
+		limit := DefaultRecordPageSize
+		if v := r.URL.Query().Get("limit"); v != "" {
+			if limit, err = strconv.Atoi(v); err != nil || limit <= 0 || limit > entities.MaxPageSize {
+				return api.InvalidRequest("limit must be between 1 and %d", entities.MaxPageSize)
+			}
+		}
+		page, err := records.PageIn(r.Context(), tr, r.URL.Query().Get("cursor"), limit)
+		if errors.Is(err, entities.ErrInvalidCursor) {
+			return api.InvalidRequest("%v", err)
+		}
+		if err != nil {
+			return fmt.Errorf("records of %s: %w", tr, err)
+		}
+		api.WriteJSON(w, http.StatusOK, page)
+		return nil
+	})
+}
+
+// sloResponse is the GET /admin/slo payload.
+type sloResponse struct {
+	Target         float64     `json:"target"`
+	LatencySeconds int         `json:"latency_seconds"`
+	Reports        []SLOReport `json:"reports"`
+}
+
+// HandleSLO serves GET /admin/slo with the ingestion SLO over every rolling window, or over
+// one range with ?range=EXPR (or from/to), e.g. the previous month for the ops review.
+func (s *AdminServer) HandleSLO(tracker *SLOTracker) {
+	s.mux.HandleFunc("GET /admin/slo", func(w http.ResponseWriter, r *http.Request) error {
+		slo := tracker.SLO()
+		resp := sloResponse{Target: slo.Target, LatencySeconds: int(slo.Latency / time.Second)}
+		q := r.URL.Query()
+		if q.Get("range") == "" && q.Get("from") == "" {
+			reps, err := tracker.Rolling(r.Context())
+			if err != nil {
+				return err
+			}
+			resp.Reports = reps
+		} else {
+			tr, err := api.ParseTimeRange(r)
+			if err != nil {
+				return err
+			}
+			rep, err := tracker.Report(r.Context(), tr)
+			if err != nil {
+				return err
+			}
+			resp.Reports = []SLOReport{rep}
+		}
+		api.WriteJSON(w, http.StatusOK, resp)
+		return nil
+	})
+}
+
+// HandleEnrichment exposes the lookups of the ingest enrichment stage:
+//
+//	GET    /admin/enrichment/stations                    list the line/station registry
+//	PUT    /admin/enrichment/stations/{line}             {"area": "B2", "process": "FATP"} sets the line default
+//	PUT    /admin/enrichment/stations/{line}/{station}   sets the entry of one station
+//	DELETE /admin/enrichment/stations/{line}[/{station}] removes an entry
+//	GET    /admin/enrichment/work-orders                 list the work order metadata
+//	PUT    /admin/enrichment/work-orders/{wo}            {"customer": "ACME", "program": "X1", "target_qty": 500} sets it
+//	DELETE /admin/enrichment/work-orders/{wo}            removes it
+//
+// Changes also re-enrich the stored records they apply to. Register it before Run.
+func (s *AdminServer) HandleEnrichment(enricher *Enricher) {
+	stations := func(w http.ResponseWriter, r *http.Request) error {
+		all, err := enricher.Stations(r.Context())
+		if err != nil {
+			return err
+		}
+		api.WriteJSON(w, http.StatusOK, all)
+		return nil
+	}
+	setStation := func(w http.ResponseWriter, r *http.Request) error {
+		var body struct {
+			Area    string `json:"area"`
+			Process string `json:"process"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<10)).Decode(&body); err != nil {
+			return api.InvalidRequest("invalid JSON body: %v", err)
+		}
+		line, station := r.PathValue("line"), r.PathValue("station")
+		if err := enricher.SetStation(r.Context(), line, station, body.Area, body.Process); err != nil {
+			return err
+		}
+		s.log.Infof("registry entry %s/%s set: area=%q process=%q", line, station, body.Area, body.Process)
+		return stations(w, r)
+	}
+	deleteStation := func(w http.ResponseWriter, r *http.Request) error {
+		line, station := r.PathValue("line"), r.PathValue("station")
+		ok, err := enricher.DeleteStation(r.Context(), line, station)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return api.NotFound("no registry entry for %s/%s", line, station)
+		}
+		s.log.Infof("registry entry %s/%s removed", line, station)
+		return stations(w, r)
+	}
+	s.mux.HandleFunc("GET /admin/enrichment/stations", stations)
+	s.mux.HandleFunc("PUT /admin/enrichment/stations/{line}", setStation)
+	s.mux.HandleFunc("PUT /admin/enrichment/stations/{line}/{station}", setStation)
+	s.mux.HandleFunc("DELETE /admin/enrichment/stations/{line}", deleteStation)
+	s.mux.HandleFunc("DELETE /admin/enrichment/stations/{line}/{station}", deleteStation)
+
+	orders := func(w http.ResponseWriter, r *http.Request) error {
+		all, err := enricher.WorkOrders(r.Context())
+		if err != nil {
+			return err
+		}
+		api.WriteJSON(w, http.StatusOK, all)
+		return nil
+	}
+	s.mux.HandleFunc("GET /admin/enrichment/work-orders", orders)
+	s.mux.HandleFunc("PUT /admin/enrichment/work-orders/{wo}", func(w http.ResponseWriter, r *http.Request) error {
+		var body struct {
+			Customer  string `json:"customer"`
+			Program   string `json:"program"`
+			TargetQty int    `json:"target_qty"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<10)).Decode(&body); err != nil {
+			return api.InvalidRequest("invalid JSON body: %v", err)
+		}
+		if body.TargetQty < 0 {
+			return api.InvalidRequest(`"target_qty" must not be negative`)
+		}
+		if err := enricher.SetWorkOrder(r.Context(), r.PathValue("wo"), body.Customer, body.Program, body.TargetQty); err != nil {
+			return err
+		}
+		s.log.Infof("work order %s set: customer=%q program=%q target=%d", r.PathValue("wo"), body.Customer, body.Program, body.TargetQty)
+		return orders(w, r)
+	})
+	s.mux.HandleFunc("DELETE /admin/enrichment/work-orders/{wo}", func(w http.ResponseWriter, r *http.Request) error {
+		ok, err := enricher.DeleteWorkOrder(r.Context(), r.PathValue("wo"))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return api.NotFound("work order %s has no metadata", r.PathValue("wo"))
+		}
+		s.log.Infof("work order %s metadata removed", r.PathValue("wo"))
+		return orders(w, r)
+	})
+}
+
+// HandleStorage serves GET /admin/storage with the database size and its projected growth
+// (see StorageForecast), for planning disk upgrades.
+func (s *AdminServer) HandleStorage(forecast *StorageForecast) {
+	s.mux.HandleFunc("GET /admin/storage", func(w http.ResponseWriter, r *http.Request) error {
+		rep, err := forecast.Report(r.Context())
+		if err != nil {
+			return fmt.Errorf("storage forecast: %w", err)
+		}
+		api.WriteJSON(w, http.StatusOK, rep)
+		return nil
+	})
+}
+
+// HandleIntegrity serves GET /admin/integrity, the report of the latest database integrity
+// check, and POST /admin/integrity?full=true|false, which runs one now (quick by default;
+// a full check of a large database takes minutes).
+func (s *AdminServer) HandleIntegrity(checker *IntegrityChecker) {
+	s.mux.HandleFunc("GET /admin/integrity", func(w http.ResponseWriter, r *http.Request) error {
+		rep := checker.Last()
+		if rep == nil {
+			return api.NotFound("no integrity check has run yet")
+		}
+		api.WriteJSON(w, http.StatusOK, rep)
+		return nil
+	})
+	s.mux.HandleFunc("POST /admin/integrity", func(w http.ResponseWriter, r *http.Request) error {
+		full := false
+		if v := r.URL.Query().Get("full"); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return api.InvalidRequest("invalid full %q", v)
+			}
+			full = b
+		}
+		rep, err := checker.Check(r.Context(), full)
+		if err != nil {
+			return fmt.Errorf("integrity check: %w", err)
+		}
+		s.log.Warnf("integrity check run via admin endpoint (full=%v): ok=%v", full, rep.OK)
+		api.WriteJSON(w, http.StatusOK, rep)
+		return nil
+	})
+}
+
+// HandleCompact serves GET /admin/compact, the expected size and downtime of compacting
+// the database and the state of the running or last compaction, and POST
+// /admin/compact?keep_backup=true|false, which starts one in the background (202) and
+// returns its estimate; poll GET until running is false.
+func (s *AdminServer) HandleCompact(compactor *Compactor) {
+	s.mux.HandleFunc("GET /admin/compact", func(w http.ResponseWriter, r *http.Request) error {
+		st, err := compactor.Status(r.Context())
+		if err != nil {
+			return fmt.Errorf("compaction estimate: %w", err)
+		}
+		api.WriteJSON(w, http.StatusOK, st)
+		return nil
+	})
+	s.mux.HandleFunc("POST /admin/compact", func(w http.ResponseWriter, r *http.Request) error {
+		keep := false
+		if v := r.URL.Query().Get("keep_backup"); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return api.InvalidRequest("invalid keep_backup %q", v)
+			}
+			keep = b
+		}
+		est, err := compactor.Start(r.Context(), keep)
+		if errors.Is(err, ErrCompactionRunning) {
+			return &api.Error{Status: http.StatusConflict, Code: api.CodeInvalidRequest, Detail: err.Error()}
+		}
+		if err != nil {
+			return fmt.Errorf("compaction: %w", err)
+		}
+		s.log.Warnf("database compaction started via admin endpoint (keep_backup=%v), expected downtime %.0fs",
+			keep, est.DowntimeSeconds)
+		api.WriteJSON(w, http.StatusAccepted, est)
+		return nil
+	})
+}
+
+// HandleOEE serves GET /api/oee?line=&range=EXPR (or from/to) with the OEE of every shift
+// overlapping the range, of one line or all lines; a shift in progress is measured up to now.
+func (s *AdminServer) HandleOEE(oee *OEE) {
+	s.mux.HandleFunc("GET /api/oee", func(w http.ResponseWriter, r *http.Request) error {
+		tr, err := api.ParseTimeRange(r)
+		if err != nil {
+			return err
+		}
+		if tr.Duration() > MaxOEERange {
+			return api.InvalidRange("range %s exceeds %s", tr, MaxOEERange)
+		}
+		rep, err := oee.Report(r.Context(), tr, normalizeLine(r.URL.Query().Get("line")))
+		if err != nil {
+			return fmt.Errorf("oee of %s: %w", tr, err)
+		}
+		api.WriteJSON(w, http.StatusOK, rep)
+		return nil
+	})
+}
+
+// HandleProgramRollup serves GET /api/programs/daily?range=EXPR (or from/to) with units
+// and yield per customer program and local day, and their totals (see ProgramRollup);
+// customer= and program= select one, and format=csv exports the days as a CSV attachment.
+func (s *AdminServer) HandleProgramRollup(rollup *ProgramRollup) {
+	s.mux.HandleFunc("GET /api/programs/daily", func(w http.ResponseWriter, r *http.Request) error {
+		tr, err := api.ParseTimeRange(r)
+		if err != nil {
+			return err
+		}
+		if tr.Duration() > MaxProgramRange {
+			return api.InvalidRange("range %s exceeds %s", tr, MaxProgramRange)
+		}
+		q := r.URL.Query()
+		format := strings.ToLower(q.Get("format"))
+		if format != "" && format != "json" && format != "csv" {
+			return api.InvalidRequest("invalid format %q, expected json or csv", format)
+		}
+		rep, err := rollup.Report(r.Context(), tr, strings.TrimSpace(q.Get("customer")), strings.TrimSpace(q.Get("program")))
+		if err != nil {
+			return fmt.Errorf("program rollup of %s: %w", tr, err)
+		}
+		if format != "csv" {
+			api.WriteJSON(w, http.StatusOK, rep)
+			return nil
+		}
+		name := fmt.Sprintf("programs_%s_%s.csv", tr.Start.In(time.Local).Format("20060102"), tr.End.In(time.Local).Format("20060102"))
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+		return rep.WriteCSV(w)
+	})
+}
+
+// HandleWeeklyTrend serves GET /api/trend/weekly?week=YYYY-MM-DD with output, first pass
+// yield and downtime per line of the local week containing the day (default this week)
+// beside the week before, with the deltas (see WeeklyTrend); line= selects one line, and
+// format=csv exports the lines as a CSV attachment for the production meeting.
+func (s *AdminServer) HandleWeeklyTrend(trend *WeeklyTrend) {
+	s.mux.HandleFunc("GET /api/trend/weekly", func(w http.ResponseWriter, r *http.Request) error {
+		q := r.URL.Query()
+		day := trend.now()
+		if v := strings.TrimSpace(q.Get("week")); v != "" {
+			d, err := timeutil.ParseDay(v, time.Local)
+			if err != nil {
+				return api.InvalidRequest("invalid week %q: %v", v, err)
+			}
+			day = d.Start
+		}
+		format := strings.ToLower(q.Get("format"))
+		if format != "" && format != "json" && format != "csv" {
+			return api.InvalidRequest("invalid format %q, expected json or csv", format)
+		}
+		if week := timeutil.Week(day); !trend.now().After(week.Start) {
+			return api.InvalidRange("week of %s has not started", week.Start.Format(timeutil.DayLayout))
+		}
+		rep, err := trend.Report(r.Context(), day, q.Get("line"))
+		if err != nil {
+			return fmt.Errorf("weekly trend: %w", err)
+		}
+		if format != "csv" {
+			api.WriteJSON(w, http.StatusOK, rep)
+			return nil
+		}
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="trend_`+strings.ReplaceAll(rep.Week, "-", "")+`.csv"`)
+		return rep.WriteCSV(w)
+	})
+}
+
+// HandleBandwidth serves GET /admin/bandwidth, the bytes the broadcast service sent per
+// topic and per connected websocket client (see websocket.Bandwidth), overall and over the
+// last minute and hour, with the payload sizes of each topic. ?topic=NAME narrows the
+// topics to one.
+func (s *AdminServer) HandleBandwidth(bandwidth *ws.Bandwidth) {
+	s.mux.HandleFunc("GET /admin/bandwidth", func(w http.ResponseWriter, r *http.Request) error {
+		rep := bandwidth.Report()
+		if name, ok := r.URL.Query()["topic"]; ok {
+			topics := []ws.TopicBandwidth{}
+			for _, t := range rep.Topics {
+				if t.Topic == name[0] {
+					topics = append(topics, t)
+				}
+			}
+			if len(topics) == 0 {
+				return api.NotFound("no message of topic %q was broadcast", name[0])
+			}
+			rep.Topics = topics
+		}
+		api.WriteJSON(w, http.StatusOK, rep)
+		return nil
+	})
+}
+
+// HandleWIP serves the units in process straight from latest_group:
+//
+//	GET /api/wip                         units in process keyed by LINE_GROUP, as the WIP topic
+//	GET /api/wip/units?line=J01&group=   the units with their latest pass, of one line and
+//	                                     group or all; timestamps are local
+//
+// Both answer with an ETag of latest_group's version (see WIPVersion) and 304 Not Modified
+// to an If-None-Match holding it, so clients polling every few seconds only get the WIP
+// again once it changed. The body is read with its version in one snapshot, so the ETag
+// sent with it is the version of that body even when a minute is stored meanwhile.
+func (s *AdminServer) HandleWIP(database *sql.DB) {
+	groups := entities.NewLatestGroupManager(database)
+	notModified := func(w http.ResponseWriter, r *http.Request) (bool, error) {
+		version, err := groups.WIPVersion(r.Context())
+		if err != nil {
+			return false, fmt.Errorf("wip version: %w", err)
+		}
+		return api.NotModified(w, r, version), nil
+	}
+	s.mux.HandleFunc("GET /api/wip", func(w http.ResponseWriter, r *http.Request) error {
+		if done, err := notModified(w, r); done || err != nil {
+			return err
+		}
+		snap, err := groups.SnapshotWIP(r.Context())
+		if err != nil {
+			return fmt.Errorf("wip: %w", err)
+		}
+		api.SetETag(w, snap.Version)
+		api.WriteJSON(w, http.StatusOK, snap.WIP)
+		return nil
+	})
+	s.mux.HandleFunc("GET /api/wip/units", func(w http.ResponseWriter, r *http.Request) error {
+		if done, err := notModified(w, r); done || err != nil {
+			return err
+		}
+		q := r.URL.Query()
+		snap, err := groups.SnapshotUnits(r.Context(), normalizeLine(q.Get("line")), normalizeLine(q.Get("group")))
+		if err != nil {
+			return fmt.Errorf("wip units: %w", err)
+		}
+		api.SetETag(w, snap.Version)
+		units := snap.Units
+		for i, u := range units {
+			if t, err := timeutil.ParseDB(u.CollectedTimestamp); err == nil {
+				units[i].CollectedTimestamp = timeutil.FormatLocal(t)
+			}
+		}
+		api.WriteJSON(w, http.StatusOK, units)
+		return nil
+	})
+}
+
+// HandleAudit records every PUT, POST and DELETE request of the admin server, with the
+// actor (see RequestActor), the route, its path, query and body, and the outcome, and
+// serves the record:
+//
+//	GET /admin/audit?actor=&action=&range=EXPR&limit=N   newest entries first (default 200);
+//	                                                     action matches a substring of the
+//	                                                     route, e.g. "lines" or "DELETE"
+//
+// Register it before Run; the routes registered before and after are both audited.
+func (s *AdminServer) HandleAudit(audit *AuditLog) {
+	s.audit = audit
+	s.mux.HandleFunc("GET /admin/audit", func(w http.ResponseWriter, r *http.Request) error {
+		q := r.URL.Query()
+		f := entities.AuditFilter{Actor: q.Get("actor"), Action: q.Get("action")}
+		if q.Has("range") || q.Has("from") {
+			tr, err := api.ParseTimeRange(r)
+			if err != nil {
+				return err
+			}
+			f.Range = tr
+		}
+		if v := q.Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 || n > entities.MaxPageSize {
+				return api.InvalidRequest("limit must be between 1 and %d", entities.MaxPageSize)
+			}
+			f.Limit = n
+		}
+		entries, err := audit.List(r.Context(), f)
+		if err != nil {
+			return fmt.Errorf("audit log: %w", err)
+		}
+		api.WriteJSON(w, http.StatusOK, entries)
+		return nil
+	})
+}
+
+// logLevelsResponse lists the current level of each running logger by name.
+type logLevelsResponse struct {
+	Levels  map[string]string `json:"levels"`
+	Changed int               `json:"changed,omitempty"`
+}
+
+func currentLogLevels() map[string]string {
+	out := map[string]string{}
+	for name, l := range logger.Levels() {
+		out[name] = strings.ToLower(l.String())
+	}
+	return out
+}
+
+// handleVersion returns the build of the running service (see buildinfo).
+func handleVersion(w http.ResponseWriter, r *http.Request) error {
+	api.WriteJSON(w, http.StatusOK, buildinfo.Get())
+	return nil
+}
+
+// defaultLogzLimit is how many entries /logz returns without ?limit=.
+const defaultLogzLimit = 200
+
+// handleLogz serves the recent entries the running loggers keep in memory (see
+// logger.SetDefaultRecent), newest last:
+//
+//	GET /logz?name=sfc_api,entities&level=warn&since=15m&grep=J0[12]&limit=N
+//
+// name lists logger names, level is the minimum level, since the earliest entry (as for
+// `hex logs --since`, see timeutil.ParseSince: 15m, -7d, today, "YYYY-MM-DD HH:MM") and
+// grep a regular expression matched against the message and the fields; limit keeps the
+// newest N entries (default 200).
+func handleLogz(w http.ResponseWriter, r *http.Request) error {
+	q := r.URL.Query()
+	var query logger.Query
+	for _, n := range strings.Split(q.Get("name"), ",") {
+		if n = strings.TrimSpace(n); n != "" {
+			query.Names = append(query.Names, n)
+		}
+	}
+	if v := q.Get("level"); v != "" {
+		level, err := logger.ParseLevel(v)
+		if err != nil {
+			return api.InvalidRequest("%v", err)
+		}
+		query.MinLevel = level
+	}
+	if v := q.Get("since"); v != "" {
+		since, err := timeutil.ParseSince(v, time.Now())
+		if err != nil {
+			return api.InvalidRequest("invalid since: %v", err)
+		}
+		query.Since = since
+	}
+	if v := q.Get("grep"); v != "" {
+		re, err := regexp.Compile(v)
+		if err != nil {
+			return api.InvalidRequest("invalid grep: %v", err)
+		}
+		query.Grep = re
+	}
+	limit := defaultLogzLimit
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return api.InvalidRequest("limit must be a positive integer")
+		}
+		limit = n
+	}
+	entries := logger.Recent(query)
+	if len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+	if entries == nil {
+		entries = []logger.Entry{}
+	}
+	api.WriteJSON(w, http.StatusOK, entries)
+	return nil
+}
+
+// handleGetLogLevels returns the level of every running logger.
+func handleGetLogLevels(w http.ResponseWriter, r *http.Request) error {
+	api.WriteJSON(w, http.StatusOK, logLevelsResponse{Levels: currentLogLevels()})
+	return nil
+}
+
+// handleSetLogLevel sets the level of one logger ({"logger":"entities","level":"debug"})
+// or of every logger when "logger" is empty.
+func handleSetLogLevel(w http.ResponseWriter, r *http.Request) error {
+	var body struct {
+		Logger string `json:"logger"`
+		Level  string `json:"level"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<10)).Decode(&body); err != nil {
+		return api.InvalidRequest("invalid JSON body: %v", err)
+	}
+	level, err := logger.ParseLevel(body.Level)
+	if err != nil {
+		return api.InvalidRequest("%v", err)
+	}
+	name := strings.TrimSpace(body.Logger)
+	if _, ok := logger.Levels()[name]; name != "" && !ok {
+		return api.NotFound("no running logger named %q", name)
+	}
+	n := logger.SetLevels(name, level)
+	api.WriteJSON(w, http.StatusOK, logLevelsResponse{Levels: currentLogLevels(), Changed: n})
+	return nil
+}
+
+// handleResetLogLevels restores the levels configured by LOG_LEVEL (.env or environment).
+func handleResetLogLevels(w http.ResponseWriter, r *http.Request) error {
+	if _, err := logger.ReloadLevels(".env"); err != nil {
+		return api.InvalidRequest("LOG_LEVEL: %v", err)
+	}
+	api.WriteJSON(w, http.StatusOK, logLevelsResponse{Levels: currentLogLevels()})
+	return nil
+}
@@ -0,0 +1,125 @@
+package managers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"hex_toolset/pkg/db"
+	"hex_toolset/pkg/db/entities"
+	skylogger "hex_toolset/pkg/logger"
+	"hex_toolset/pkg/timeutil"
+)
+
+func TestIntegrationWIPConditionalGet(t *testing.T) {
+	resetState(t)
+	lgr, _ := skylogger.New(skylogger.WithName("test_admin"))
+	admin := NewAdminServer("127.0.0.1:0", lgr)
+	admin.HandleWIP(db.GetDB())
+	get := func(path, etag string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		w := httptest.NewRecorder()
+		admin.server.Handler.ServeHTTP(w, req)
+		return w
+	}
+	records := entities.NewRecordManagerEntity(db.GetDB())
+	insert := func(ppid, group string, at time.Time) {
+		t.Helper()
+		err := records.InsertBatch([]entities.RecordEntity{{PPID: ppid, WorkOrder: "MO1", LineName: "J01",
+			GroupName: group, StationName: group + "01", ModelName: "M", CollectedTimestamp: at}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	insert("U1", "TEST", base)
+	insert("U2", "TEST", base.Add(time.Minute))
+
+	w := get("/api/wip", "")
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" || strings.TrimSpace(w.Body.String()) != `{"J01_TEST":2}` {
+		t.Fatalf("wip: status %d etag %q body %s", w.Code, etag, w.Body)
+	}
+	for _, path := range []string{"/api/wip", "/api/wip/units"} {
+		if w := get(path, etag); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+			t.Fatalf("%s unchanged: status %d body %q, want an empty 304", path, w.Code, w.Body)
+		}
+	}
+
+	// U1 leaves at IN_STORE: the newest timestamp alone would not tell the WIP shrank
+	// if the exit were backdated, the count does.
+	insert("U1", "IN_STORE", base.Add(30*time.Second))
+	w = get("/api/wip", etag)
+	if w.Code != http.StatusOK || w.Header().Get("ETag") == etag || strings.TrimSpace(w.Body.String()) != `{"J01_TEST":1}` {
+		t.Fatalf("wip after exit: status %d etag %q body %s", w.Code, w.Header().Get("ETag"), w.Body)
+	}
+
+	// the body and its ETag come from one snapshot
+	groups := entities.NewLatestGroupManager(db.GetDB())
+	snap, err := groups.SnapshotWIP(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version, _ := groups.WIPVersion(context.Background()); snap.Version != version || w.Header().Get("ETag") != `"`+version+`"` ||
+		len(snap.WIP) != 1 || snap.WIP["J01_TEST"] != 1 || snap.Units != nil {
+		t.Fatalf("snapshot = %+v, version %q, etag %q", snap, version, w.Header().Get("ETag"))
+	}
+	if snap, err := groups.SnapshotUnits(context.Background(), "J01", ""); err != nil || snap.Version != strings.Trim(w.Header().Get("ETag"), `"`) ||
+		len(snap.Units) != 1 || snap.Units[0].PPID != "U2" || snap.WIP != nil {
+		t.Fatalf("units snapshot = %+v (%v)", snap, err)
+	}
+
+	w = get("/api/wip/units?line=j01&group=test", "")
+	var units []entities.LatestGroup
+	if err := json.NewDecoder(w.Body).Decode(&units); err != nil {
+		t.Fatal(err)
+	}
+	if len(units) != 1 || units[0].PPID != "U2" || units[0].CollectedTimestamp != timeutil.FormatLocal(base.Add(time.Minute)) {
+		t.Fatalf("wip units = %+v", units)
+	}
+}
+
+func TestIntegrationLogz(t *testing.T) {
+	lgr, err := skylogger.New(skylogger.WithName("logz_test"), skylogger.WithConsole(false), skylogger.WithRecent(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lgr.Close()
+	lgr.Infow("minute stored", "line", "J01")
+	lgr.Errorw("minute failed", "line", "J02")
+	admin := NewAdminServer("127.0.0.1:0", lgr)
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		admin.server.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	var entries []map[string]any
+	w := get("/logz?name=logz_test&level=warn&since=1h")
+	if err := json.Unmarshal(w.Body.Bytes(), &entries); err != nil || w.Code != http.StatusOK || len(entries) != 1 ||
+		entries[0]["msg"] != "minute failed" || entries[0]["level"] != "ERROR" {
+		t.Fatalf("GET /logz = %d %s", w.Code, w.Body)
+	}
+	if w := get("/logz?name=logz_test&level=warn&since=today"); !strings.Contains(w.Body.String(), "minute failed") {
+		t.Fatalf("GET /logz?since=today = %d %s", w.Code, w.Body)
+	}
+	w = get("/logz?name=logz_test&grep=J01&limit=5")
+	if err := json.Unmarshal(w.Body.Bytes(), &entries); err != nil || len(entries) != 1 || entries[0]["msg"] != "minute stored" {
+		t.Fatalf("GET /logz?grep = %d %s", w.Code, w.Body)
+	}
+	if w := get("/logz?name=nobody"); w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != "[]" {
+		t.Fatalf("GET /logz of an unknown logger = %d %s", w.Code, w.Body)
+	}
+	for _, bad := range []string{"level=loud", "since=soon", "since=2099-01-01", "grep=(", "limit=0"} {
+		if w := get("/logz?" + bad); w.Code != http.StatusBadRequest {
+			t.Errorf("GET /logz?%s = %d, want 400", bad, w.Code)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package managers
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"hex_toolset/pkg/bus"
+	skylogger "hex_toolset/pkg/logger"
+)
+
+// Alert severities.
+const (
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// maxRecentAlerts bounds the in-memory history of raised/resolved alerts.
+const maxRecentAlerts = 100
+
+// Alert is a condition raised by a subsystem and broadcast on the ALERT topic.
+// Key deduplicates: raising an already active key is a no-op until it is resolved.
+// Maintenance names the maintenance window the alert was raised in; such an alert is not
+// broadcast unless it is still active once the window is over.
+type Alert struct {
+	Key         string     `json:"key"`
+	Severity    string     `json:"severity"`
+	Source      string     `json:"source"`
+	Message     string     `json:"message"`
+	Active      bool       `json:"active"`
+	RaisedAt    time.Time  `json:"raised_at"`
+	ResolvedAt  *time.Time `json:"resolved_at,omitempty"`
+	Maintenance string     `json:"maintenance,omitempty"`
+}
+
+// EnvelopeMeta lets websocket clients filter alerts by severity and source.
+func (a Alert) EnvelopeMeta() map[string]string {
+	return map[string]string{"severity": a.Severity, "source": a.Source}
+}
+
+// AlertManager tracks active alerts, logs them and publishes them as broadcast files.
+type AlertManager struct {
+	mu          sync.Mutex
+	logger      *skylogger.Logger
+	publisher   Publisher
+	maintenance *MaintenanceWindows
+	bus         *bus.Bus
+	active      map[string]Alert
+	recent      []Alert
+}
+
+// NewAlertManager creates an alert manager. pub may be nil to only log.
+func NewAlertManager(pub Publisher, lgr *skylogger.Logger) *AlertManager {
+	return &AlertManager{
+		logger:    lgr,
+		publisher: pub,
+		active:    make(map[string]Alert),
+	}
+}
+
+// SetPublisher replaces the publisher used for ALERT messages.
+func (a *AlertManager) SetPublisher(p Publisher) {
+	a.mu.Lock()
+	a.publisher = p
+	a.mu.Unlock()
+}
+
+// SetMaintenance makes alerts raised during a maintenance window of every line of w
+// suppressed: tracked and logged, but not broadcast (see ReleaseSuppressed).
+func (a *AlertManager) SetMaintenance(w *MaintenanceWindows) {
+	a.mu.Lock()
+	a.maintenance = w
+	a.mu.Unlock()
+}
+
+// SetBus makes raising and resolving alerts publish AlertRaised and AlertResolved on b,
+// suppressed alerts included.
+func (a *AlertManager) SetBus(b *bus.Bus) {
+	a.mu.Lock()
+	a.bus = b
+	a.mu.Unlock()
+}
+
+// Raise activates the alert identified by key. Returns false if it was already active.
+func (a *AlertManager) Raise(key, severity, source, message string) bool {
+	a.mu.Lock()
+	if _, ok := a.active[key]; ok {
+		a.mu.Unlock()
+		return false
+	}
+	maintenance := a.maintenance
+	a.mu.Unlock()
+	// read outside a.mu: the windows may query the DB
+	win, suppressed := maintenance.Active("")
+
+	a.mu.Lock()
+	if _, ok := a.active[key]; ok {
+		a.mu.Unlock()
+		return false
+	}
+	al := Alert{Key: key, Severity: severity, Source: source, Message: message, Active: true, RaisedAt: time.Now()}
+	if suppressed {
+		al.Maintenance = win.String()
+	}
+	a.active[key] = al
+	a.remember(al)
+	b := a.bus
+	a.mu.Unlock()
+
+	bus.Publish(b, bus.AlertRaised{Key: key, Severity: severity, Source: source, Message: message,
+		At: al.RaisedAt, Maintenance: al.Maintenance})
+	if suppressed {
+		if a.logger != nil {
+			a.logger.Infow("alert suppressed: "+message, "key", key, "source", source, "maintenance", al.Maintenance)
+		}
+		return true
+	}
+	if a.logger != nil {
+		if severity == SeverityCritical {
+			a.logger.Errorw("alert raised: "+message, "key", key, "source", source)
+		} else {
+			a.logger.Warnw("alert raised: "+message, "key", key, "source", source)
+		}
+	}
+	a.publish(al)
+	return true
+}
+
+// Resolve clears the alert identified by key. Returns false if it was not active.
+func (a *AlertManager) Resolve(key, message string) bool {
+	a.mu.Lock()
+	al, ok := a.active[key]
+	if !ok {
+		a.mu.Unlock()
+		return false
+	}
+	delete(a.active, key)
+	now := time.Now()
+	al.Active = false
+	al.ResolvedAt = &now
+	if message != "" {
+		al.Message = message
+	}
+	a.remember(al)
+	b := a.bus
+	a.mu.Unlock()
+
+	bus.Publish(b, bus.AlertResolved{Key: key, Source: al.Source, Message: al.Message, At: now})
+	if a.logger != nil {
+		a.logger.Infow("alert resolved: "+al.Message, "key", key, "source", al.Source)
+	}
+	if al.Maintenance == "" {
+		a.publish(al)
+	}
+	return true
+}
+
+// ReleaseSuppressed broadcasts the alerts suppressed during a maintenance window that are
+// still active now that no window of every line is in progress, since the condition
+// outlived the planned stop. The live cycle calls it every minute.
+func (a *AlertManager) ReleaseSuppressed() {
+	a.mu.Lock()
+	maintenance := a.maintenance
+	a.mu.Unlock()
+	if _, ok := maintenance.Active(""); ok {
+		return
+	}
+
+	a.mu.Lock()
+	var released []Alert
+	for key, al := range a.active {
+		if al.Maintenance != "" {
+			al.Maintenance = ""
+			a.active[key] = al
+			released = append(released, al)
+		}
+	}
+	a.mu.Unlock()
+	sort.Slice(released, func(i, j int) bool { return released[i].RaisedAt.Before(released[j].RaisedAt) })
+	for _, al := range released {
+		if a.logger != nil {
+			a.logger.Warnw("alert still active after maintenance: "+al.Message, "key", al.Key, "source", al.Source)
+		}
+		a.publish(al)
+	}
+}
+
+// Active returns the currently active alerts, oldest first.
+func (a *AlertManager) Active() []Alert {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	out := make([]Alert, 0, len(a.active))
+	for _, al := range a.active {
+		out = append(out, al)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].RaisedAt.Before(out[j].RaisedAt) })
+	return out
+}
+
+// Recent returns the most recent alert transitions (raise and resolve), oldest first.
+func (a *AlertManager) Recent() []Alert {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]Alert(nil), a.recent...)
+}
+
+// remember appends to the bounded history; caller holds a.mu.
+func (a *AlertManager) remember(al Alert) {
+	a.recent = append(a.recent, al)
+	if len(a.recent) > maxRecentAlerts {
+		a.recent = a.recent[len(a.recent)-maxRecentAlerts:]
+	}
+}
+
+func (a *AlertManager) publish(al Alert) {
+	a.mu.Lock()
+	pub := a.publisher
+	a.mu.Unlock()
+	if pub == nil {
+		return
+	}
+	if err := pub.Publish(TopicAlert, al); err != nil && a.logger != nil {
+		a.logger.Errorf("failed to publish alert %s: %v", al.Key, err)
+	}
+}
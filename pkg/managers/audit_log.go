@@ -0,0 +1,158 @@
+package managers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/user"
+	"strings"
+	"time"
+
+	"hex_toolset/pkg/api"
+	"hex_toolset/pkg/db/entities"
+	skylogger "hex_toolset/pkg/logger"
+	"hex_toolset/pkg/timeutil"
+)
+
+// maxAuditBody bounds the request body kept as the parameters of an audited admin request.
+const maxAuditBody = 16 << 10
+
+// AuditLog records administrative actions in the audit_log table for change control:
+// every mutating admin API request (AdminServer.HandleAudit) and the fix commands that
+// change data or settings. A failure to record is logged and does not fail the action.
+type AuditLog struct {
+	entity *entities.AuditLogManager
+	logger *skylogger.Logger
+	now    func() time.Time
+}
+
+// NewAuditLog creates an audit log on database.
+func NewAuditLog(database *sql.DB, lgr *skylogger.Logger) *AuditLog {
+	return &AuditLog{entity: entities.NewAuditLogManager(database), logger: lgr, now: time.Now}
+}
+
+// Record appends action by actor with params (marshalled to JSON) and its outcome, "ok"
+// when failure is nil.
+func (a *AuditLog) Record(ctx context.Context, actor, action string, params any, failure error) {
+	outcome := "ok"
+	if failure != nil {
+		outcome = failure.Error()
+	}
+	raw, err := json.Marshal(params)
+	if err != nil {
+		raw, _ = json.Marshal(map[string]string{"unencodable": fmt.Sprint(params)})
+	}
+	if _, err := a.entity.Add(ctx, a.now(), actor, action, raw, outcome); err != nil && a.logger != nil {
+		a.logger.Errorw("audit entry lost", "actor", actor, "action", action, "err", err)
+	}
+}
+
+// List returns the entries matching f, newest first, with local timestamps.
+func (a *AuditLog) List(ctx context.Context, f entities.AuditFilter) ([]entities.AuditEntry, error) {
+	entries, err := a.entity.List(ctx, f)
+	for i := range entries {
+		entries[i].At = timeutil.LocalDB(entries[i].At)
+	}
+	return entries, err
+}
+
+// RequestActor identifies who sent an admin request: "token:<label>" when the request was
+// authenticated with one of the admin tokens (AdminServer.RequireTokens), else the client
+// address "ip:<host>". An admin server without tokens is unauthenticated, so its requests
+// are recorded by address only, which names a host, not a person.
+func RequestActor(r *http.Request) string {
+	if label, ok := r.Context().Value(adminTokenKey{}).(string); ok {
+		return "token:" + label
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// adminTokenKey is the context key of the label of a request's verified admin token.
+type adminTokenKey struct{}
+
+// ParseAdminTokens parses ADMIN_TOKENS, "label=token[,label=token]", into the tokens by
+// label; the label names the operator or tool holding the token in the audit log.
+func ParseAdminTokens(spec string) (map[string]string, error) {
+	return parseSecrets(spec, "admin token")
+}
+
+// parseSecrets parses a "name=secret[,name=secret]" list of what into the secrets by name,
+// rejecting duplicate names and secrets shared by two names. Errors never show a secret.
+func parseSecrets(spec, what string) (map[string]string, error) {
+	out := map[string]string{}
+	for i, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, secret, ok := strings.Cut(part, "=")
+		name, secret = strings.TrimSpace(name), strings.TrimSpace(secret)
+		if !ok || name == "" || secret == "" {
+			// the entry may be a bare secret; never echo it
+			return nil, fmt.Errorf("invalid %s entry %d, expected name=secret", what, i+1)
+		}
+		if _, dup := out[name]; dup {
+			return nil, fmt.Errorf("duplicate %s name %q", what, name)
+		}
+		for other, s := range out {
+			if s == secret {
+				return nil, fmt.Errorf("%s names %q and %q share a secret", what, other, name)
+			}
+		}
+		out[name] = secret
+	}
+	return out, nil
+}
+
+// CLIActor identifies the operator running a command: "cli:user@host".
+func CLIActor() string {
+	name := os.Getenv("USER")
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	host, _ := os.Hostname()
+	return "cli:" + name + "@" + host
+}
+
+// auditRequest serves r through next and records it as action (the route pattern, e.g.
+// "PUT /admin/lines/{line}") with its path, query and body.
+func (a *AuditLog) auditRequest(w http.ResponseWriter, r *http.Request, action string, next http.Handler) {
+	params := map[string]any{"path": r.URL.Path}
+	if r.URL.RawQuery != "" {
+		params["query"] = r.URL.Query()
+	}
+	if r.Body != nil {
+		body, _ := io.ReadAll(io.LimitReader(r.Body, maxAuditBody))
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		if len(bytes.TrimSpace(body)) > 0 {
+			if json.Valid(body) {
+				params["body"] = json.RawMessage(body)
+			} else {
+				params["body"] = string(body)
+			}
+		}
+	}
+
+	status, problem := api.Observe(w, r, next)
+	var failure error
+	if status >= 400 {
+		failure = fmt.Errorf("HTTP %d %s", status, http.StatusText(status))
+		if problem.Detail != "" {
+			failure = fmt.Errorf("HTTP %d: %s", status, problem.Detail)
+		}
+	}
+	a.Record(context.WithoutCancel(r.Context()), RequestActor(r), action, params, failure)
+}
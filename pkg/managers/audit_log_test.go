@@ -0,0 +1,116 @@
+package managers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"hex_toolset/pkg/db"
+	"hex_toolset/pkg/db/entities"
+)
+
+func TestIntegrationAuditLog(t *testing.T) {
+	resetState(t)
+	m, _ := newTestManager(t)
+	audit := NewAuditLog(db.GetDB(), m.logger)
+	admin := NewAdminServer("127.0.0.1:0", m.logger)
+	admin.RequireTokens(map[string]string{"alice": "s3cret", "deploy-bot": "b0t"})
+	admin.HandleLineMaintenance(m.Lines())
+	admin.HandleAudit(audit)
+	serve := func(method, target, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		admin.server.Handler.ServeHTTP(w, req)
+		return w
+	}
+
+	// Changes need a known token; neither is recorded nor applied without one.
+	for _, token := range []string{"", "guess"} {
+		if w := serve(http.MethodPut, "/admin/lines/J03", token, `{"enabled": false, "reason": "PM"}`); w.Code != http.StatusUnauthorized {
+			t.Fatalf("disable J03 with token %q = %d %s", token, w.Code, w.Body)
+		}
+	}
+	if w := serve(http.MethodGet, "/admin/lines", "guess", ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("read with an unknown token = %d", w.Code)
+	}
+	if w := serve(http.MethodPut, "/admin/lines/J01", "s3cret", `{"enabled": false, "reason": "PM"}`); w.Code != http.StatusOK {
+		t.Fatalf("disable J01 = %d %s", w.Code, w.Body)
+	}
+	if w := serve(http.MethodPut, "/admin/lines/J02", "b0t", `{"enabled": false}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("disable J02 without a reason = %d", w.Code)
+	}
+	if w := serve(http.MethodGet, "/admin/lines", "", ""); w.Code != http.StatusOK { // reads are open and not audited
+		t.Fatalf("read without a token = %d", w.Code)
+	}
+	audit.Record(context.Background(), CLIActor(), "fix flag", map[string]any{"flag": FlagAutoBackfill, "enabled": false}, nil)
+
+	var entries []entities.AuditEntry
+	w := serve(http.MethodGet, "/admin/audit?action=lines", "", "")
+	if err := json.Unmarshal(w.Body.Bytes(), &entries); err != nil || w.Code != http.StatusOK || len(entries) != 2 {
+		t.Fatalf("GET /admin/audit?action=lines = %d %s", w.Code, w.Body)
+	}
+	failed, ok := entries[0], entries[1]
+	if failed.Action != "PUT /admin/lines/{line}" || failed.Actor != "token:deploy-bot" ||
+		!strings.HasPrefix(failed.Outcome, "HTTP 400") {
+		t.Fatalf("failed entry = %+v", failed)
+	}
+	if ok.Actor != "token:alice" || ok.Outcome != "ok" {
+		t.Fatalf("entry = %+v", ok)
+	}
+	var params struct {
+		Path string `json:"path"`
+		Body struct {
+			Reason string `json:"reason"`
+		} `json:"body"`
+	}
+	if err := json.Unmarshal(ok.Params, &params); err != nil || params.Path != "/admin/lines/J01" || params.Body.Reason != "PM" {
+		t.Fatalf("params = %s (%v)", ok.Params, err)
+	}
+	if disabled, _ := m.Lines().List(context.Background()); len(disabled) != 1 {
+		t.Fatalf("the audited request was not applied: %+v", disabled)
+	}
+
+	w = serve(http.MethodGet, "/admin/audit?actor="+url.QueryEscape(ok.Actor), "", "")
+	if err := json.Unmarshal(w.Body.Bytes(), &entries); err != nil || len(entries) != 1 || entries[0].ID != ok.ID {
+		t.Fatalf("GET /admin/audit?actor= = %d %s", w.Code, w.Body)
+	}
+	w = serve(http.MethodGet, "/admin/audit?limit=1", "", "")
+	if err := json.Unmarshal(w.Body.Bytes(), &entries); err != nil || len(entries) != 1 || entries[0].Action != "fix flag" {
+		t.Fatalf("GET /admin/audit?limit=1 = %d %s", w.Code, w.Body)
+	}
+
+	// Without tokens the API is unauthenticated and only the address is recorded, whatever
+	// token the caller sends.
+	plain := NewAdminServer("127.0.0.1:0", m.logger)
+	plain.HandleLineMaintenance(m.Lines())
+	plain.HandleAudit(audit)
+	req := httptest.NewRequest(http.MethodPut, "/admin/lines/J01", strings.NewReader(`{"enabled": true}`))
+	req.Header.Set("Authorization", "Bearer alice")
+	plain.server.Handler.ServeHTTP(httptest.NewRecorder(), req)
+	w = serve(http.MethodGet, "/admin/audit?limit=1", "", "")
+	if err := json.Unmarshal(w.Body.Bytes(), &entries); err != nil || len(entries) != 1 || !strings.HasPrefix(entries[0].Actor, "ip:") {
+		t.Fatalf("unauthenticated entry = %s", w.Body)
+	}
+}
+
+func TestParseAdminTokens(t *testing.T) {
+	tokens, err := ParseAdminTokens(" alice = s3cret ,deploy-bot=b0t,")
+	if err != nil || len(tokens) != 2 || tokens["alice"] != "s3cret" || tokens["deploy-bot"] != "b0t" {
+		t.Fatalf("ParseAdminTokens = %v, %v", tokens, err)
+	}
+	for _, spec := range []string{"s3cret", "alice=", "alice=a,alice=b", "alice=x,bob=x"} {
+		_, err := ParseAdminTokens(spec)
+		if err == nil {
+			t.Errorf("ParseAdminTokens(%q) accepted", spec)
+		} else if strings.Contains(err.Error(), "s3cret") {
+			t.Errorf("ParseAdminTokens(%q) error shows the token: %v", spec, err)
+		}
+	}
+}
@@ -2,17 +2,23 @@ package managers
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	pkg "hex_toolset/pkg"
+	"hex_toolset/pkg/api"
+	"hex_toolset/pkg/ipc"
 	"hex_toolset/pkg/logger"
+	"hex_toolset/pkg/topics"
 	ws "hex_toolset/pkg/websocket"
 
 	"github.com/fsnotify/fsnotify"
@@ -25,8 +31,16 @@ type BroadcastManager struct {
 	log *logger.Logger
 
 	// runtime
-	hub    *ws.Hub
-	server *http.Server
+	hub       *ws.Hub
+	server    *http.Server
+	backplane ws.Backplane    // nil in single-instance mode
+	history   *MessageHistory // nil when relayed files are deleted
+	bandwidth *ws.Bandwidth
+
+	// MESSAGE_DIR files created, handed by the watcher to the relay worker
+	created   chan string
+	rescanDue atomic.Bool
+	wake      chan struct{}
 
 	ctx    context.Context
 	cancel context.CancelFunc
@@ -35,52 +49,70 @@ type BroadcastManager struct {
 
 // NewBroadcastManager constructs a new BroadcastManager using application config and logger.
 func NewBroadcastManager(cfg *pkg.Config, logg *logger.Logger) *BroadcastManager {
-	return &BroadcastManager{cfg: cfg, log: logg}
+	return &BroadcastManager{cfg: cfg, log: logg, bandwidth: ws.NewBandwidth()}
 }
 
-// Run starts the websocket server and directory watcher, and blocks until ctx is cancelled.
-// If addr is empty, it falls back to cfg.BROADCAST_WS_ADDR or ":8081".
+// Bandwidth returns the traffic counts of the websocket clients, kept across runs.
+func (m *BroadcastManager) Bandwidth() *ws.Bandwidth { return m.bandwidth }
+
+// Run starts the websocket server on cfg.BROADCAST_WS_ADDR and the watcher of
+// cfg.BROADCAST_MESSAGE_DIR, and blocks until ctx is cancelled.
 func (m *BroadcastManager) Run(ctx context.Context) error {
 	if m == nil {
 		return errors.New("nil BroadcastManager")
 	}
+	if err := m.cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
 	// derive internal cancelable context
 	m.ctx, m.cancel = context.WithCancel(ctx)
 
-	dir := m.cfg.MESSAGE_DIR
-	addr := m.cfg.WS_ADD
-	// Build address using WS_ADD and WS_PORT:
-	// - if WS_ADD is empty -> listen on all interfaces using WS_PORT (":<port>")
-	// - if WS_ADD already contains ":" (host:port or :port) -> use as-is
-	// - otherwise -> append ":" + WS_PORT (host without port -> host:port)
-	if strings.TrimSpace(addr) == "" {
-		addr = ":" + m.cfg.WS_PORT
-	} else if !strings.Contains(addr, ":") {
-		addr = addr + ":" + m.cfg.WS_PORT
-	}
-	if strings.TrimSpace(addr) == "" {
-		addr = ":8081"
-	}
+	dir := m.cfg.BROADCAST_MESSAGE_DIR
+	addr := m.cfg.BROADCAST_WS_ADDR
 
 	// hub
 	m.hub = ws.NewHub()
+	m.hub.SetSnapshotViews(LatestSnapshotViews())
+	m.hub.SetBandwidth(m.bandwidth)
 	go m.hub.Run(m.log)
 
-	// http server
-	mux := http.NewServeMux()
-	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+	// optional backplane shared with other broadcast instances
+	m.startBackplane()
+
+	// http server; unknown routes and errors are answered with problem+json
+	mux := api.NewRouter()
+	mux.Handle("GET /health", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		_, _ = w.Write([]byte("ok"))
-	})
-	mux.Handle("/ws/monitor", ws.WSHandler(m.hub, m.log))
+	}))
+	mux.Handle("/ws/monitor", ws.WSHandlerWithOptions(m.hub, m.log, ws.Options{
+		WriteTimeout: time.Duration(m.cfg.WS_WRITE_TIMEOUT_SECONDS) * time.Second,
+		MaxBatch:     m.cfg.WS_MAX_BATCH,
+	}))
+	mux.HandleFunc("GET /api/stream/poll", ws.PollHandler(m.hub, ws.PollOptions{
+		Timeout: time.Duration(m.cfg.WS_POLL_TIMEOUT_SECONDS) * time.Second,
+	}))
+	mux.HandleFunc("GET /version", handleVersion)
+	mux.HandleFunc("GET /logz", handleLogz)
+	mux.HandleFunc("GET /api/topics", handleTopics)
+	mux.HandleFunc("GET /api/topics/{name}", handleTopic)
+	if m.cfg.WS_DASHBOARD {
+		registerDashboard(mux)
+	}
 	m.server = &http.Server{
 		Addr:         addr,
-		Handler:      ws.RecoverMiddleware(mux, m.log),
+		Handler:      api.Middleware(mux, m.log),
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
 	}
 
+	// direct pushes from db_clon on the same host
+	m.startIPC()
+
+	// relayed files kept as history, if configured
+	m.startHistory(dir)
+
 	// watcher
 	if err := m.startWatcher(dir); err != nil {
 		return fmt.Errorf("start watcher: %w", err)
@@ -90,7 +122,9 @@ func (m *BroadcastManager) Run(ctx context.Context) error {
 	filesJSON := filepath.Join(dir, "files.json")
 	if b, err := os.ReadFile(filesJSON); err == nil {
 		m.log.Infof("broadcasting initial files.json (%d bytes)", len(b))
-		m.hub.Broadcast(b)
+		if err := m.hub.Broadcast(b); err != nil {
+			m.log.Errorf("initial files.json broadcast failed: %v", err)
+		}
 	}
 
 	// start HTTP server
@@ -111,6 +145,143 @@ func (m *BroadcastManager) Run(ctx context.Context) error {
 	return m.shutdown()
 }
 
+// startBackplane connects to BACKPLANE_URL (if set) and relays messages published by other
+// instances to local clients. If the backplane is unreachable the instance keeps serving its
+// own clients only, so a Redis or NATS outage degrades fan-out rather than taking dashboards down.
+func (m *BroadcastManager) startBackplane() {
+	url := strings.TrimSpace(m.cfg.BACKPLANE_URL)
+	if url == "" {
+		return
+	}
+	connectCtx, cancel := context.WithTimeout(m.ctx, 5*time.Second)
+	bp, err := ws.NewBackplane(connectCtx, url, m.cfg.BACKPLANE_CHANNEL)
+	cancel()
+	if err != nil {
+		m.log.Errorf("backplane disabled, serving local clients only: %v", err)
+		return
+	}
+	m.backplane = bp
+	m.log.Infof("backplane connected (origin=%s)", bp.Origin())
+
+	m.wg.Add(1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				m.log.Errorf("backplane panic recovered: %v", r)
+			}
+			m.wg.Done()
+		}()
+		for {
+			err := bp.Subscribe(m.ctx, func(msg []byte) {
+				if err := m.hub.Broadcast(msg); err != nil {
+					m.log.Warnf("backplane message dropped (%d bytes): %v", len(msg), err)
+				}
+			})
+			if m.ctx.Err() != nil {
+				return
+			}
+			m.log.Errorf("backplane subscription ended, retrying in 5s: %v", err)
+			select {
+			case <-m.ctx.Done():
+				return
+			case <-time.After(5 * time.Second):
+			}
+		}
+	}()
+}
+
+// startIPC serves IPC_SOCKET (or the socket passed by systemd), relaying every message
+// like a MESSAGE_DIR file. Without it the service keeps working from MESSAGE_DIR alone.
+func (m *BroadcastManager) startIPC() {
+	path := strings.TrimSpace(m.cfg.IPC_SOCKET)
+	if path == "" {
+		return
+	}
+	ln, err := ipc.Listen(path)
+	if err != nil {
+		m.log.Errorf("ipc disabled, relaying MESSAGE_DIR only: %v", err)
+		return
+	}
+	m.log.Infof("ipc listening on %s", ln.Addr())
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		ipc.Serve(m.ctx, ln, func(msg []byte) {
+			// the hub and backplane keep the slice, so copy it out of the read buffer
+			m.broadcast(append([]byte(nil), msg...))
+		}, m.log)
+	}()
+}
+
+// historyCompactEvery is how often the kept history is compressed and pruned.
+const historyCompactEvery = 15 * time.Minute
+
+// startHistory keeps relayed MESSAGE_DIR files for MESSAGE_HISTORY_HOURS and compacts the
+// history periodically (see MessageHistory).
+func (m *BroadcastManager) startHistory(dir string) {
+	hours := m.cfg.MESSAGE_HISTORY_HOURS
+	if hours <= 0 {
+		return
+	}
+	m.history = NewMessageHistory(dir, time.Duration(hours)*time.Hour)
+	m.log.Infof("keeping relayed messages for %dh in %s", hours, m.history.Dir())
+	compact := func() {
+		res, err := m.history.Compact()
+		if err != nil {
+			m.log.Errorf("message history: %v", err)
+		}
+		if res.Compressed > 0 || res.Removed > 0 {
+			m.log.Infof("message history: compressed %d file(s) saving %d bytes, removed %d", res.Compressed, res.Saved, res.Removed)
+		}
+	}
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		t := time.NewTicker(historyCompactEvery)
+		defer t.Stop()
+		for {
+			compact()
+			select {
+			case <-m.ctx.Done():
+				return
+			case <-t.C:
+			}
+		}
+	}()
+}
+
+// broadcast delivers msg to local clients and publishes it to the other instances.
+func (m *BroadcastManager) broadcast(msg []byte) {
+	if err := m.hub.Broadcast(msg); err != nil {
+		m.log.Warnf("broadcast dropped (%d bytes): %v", len(msg), err)
+	}
+	if m.backplane == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(m.ctx, 2*time.Second)
+	defer cancel()
+	if err := m.backplane.Publish(ctx, msg); err != nil {
+		m.log.Errorf("backplane publish failed (%d bytes): %v", len(msg), err)
+	}
+}
+
+// handleTopics lists every registered broadcast topic with its envelope JSON Schema.
+func handleTopics(w http.ResponseWriter, r *http.Request) error {
+	api.WriteJSON(w, http.StatusOK, topics.Catalog())
+	return nil
+}
+
+// handleTopic returns a single topic descriptor by its massage_type name.
+func handleTopic(w http.ResponseWriter, r *http.Request) error {
+	name := r.PathValue("name")
+	d, ok := topics.Lookup(name)
+	if !ok {
+		return api.NotFound("unknown topic %q", name)
+	}
+	api.WriteJSON(w, http.StatusOK, d)
+	return nil
+}
+
 // Stop requests the manager to shutdown (non-blocking). Safe to call multiple times.
 func (m *BroadcastManager) Stop() {
 	if m.cancel != nil {
@@ -127,10 +298,16 @@ func (m *BroadcastManager) shutdown() error {
 			m.log.Errorf("server shutdown error: %v", err)
 		}
 	}
+	// relays (watcher, backplane, ipc) stop on ctx; wait for them so none broadcasts on a closed hub
+	m.wg.Wait()
 	if m.hub != nil {
 		m.hub.Shutdown()
 	}
-	m.wg.Wait()
+	if m.backplane != nil {
+		if err := m.backplane.Close(); err != nil {
+			m.log.Errorf("backplane close error: %v", err)
+		}
+	}
 	m.log.Infof("broadcast service stopped")
 	return nil
 }
@@ -157,6 +334,167 @@ func deleteWithRetry(path string, attempts int, delay time.Duration) error {
 	return nil
 }
 
+// File completeness check: a created file is read only once its size is unchanged across
+// two polls and its content parses as JSON, retrying for up to completeAttempts polls.
+const (
+	completePoll     = 50 * time.Millisecond
+	completeAttempts = 40
+)
+
+// skipMessageFile reports files that are not (yet) messages: directories, hidden files and
+// temp files of the write-then-rename convention used by StoreFileManager (".tmp-*").
+func skipMessageFile(path string) bool {
+	base := filepath.Base(path)
+	if strings.HasPrefix(base, ".") || strings.HasSuffix(base, ".tmp") || strings.HasSuffix(base, ".part") {
+		return true
+	}
+	fi, err := os.Stat(path)
+	return err == nil && fi.IsDir()
+}
+
+// readComplete waits until path is completely written and returns its content; gzipped
+// (.json.gz) files are decompressed.
+func (m *BroadcastManager) readComplete(path string) ([]byte, error) {
+	var lastSize int64 = -1
+	var lastErr error
+	for i := 0; i < completeAttempts; i++ {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		size := fi.Size()
+		if size > 0 && size == lastSize {
+			b, err := ReadMessageFile(path)
+			switch {
+			case errors.Is(err, os.ErrNotExist):
+				return nil, err
+			case err != nil:
+				lastErr = err // e.g. a gzip stream still being written
+			case json.Valid(b):
+				return b, nil
+			default:
+				lastErr = errors.New("content is not valid JSON")
+			}
+		}
+		lastSize = size
+		select {
+		case <-m.ctx.Done():
+			return nil, m.ctx.Err()
+		case <-time.After(completePoll):
+		}
+	}
+	if lastErr == nil {
+		lastErr = errors.New("size did not settle")
+	}
+	return nil, fmt.Errorf("file incomplete after %s: %w", completePoll*completeAttempts, lastErr)
+}
+
+// handleCreated broadcasts a newly created message file and deletes it, or moves it into
+// the history when one is kept (except files.json). Files that never become complete are
+// left in place for inspection.
+func (m *BroadcastManager) handleCreated(path string) {
+	if skipMessageFile(path) {
+		return
+	}
+	base := filepath.Base(path)
+	content, err := m.readComplete(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return // already consumed (e.g. by a rescan)
+		}
+		m.log.Errorf("failed reading created file %s: %v", base, err)
+		return
+	}
+
+	m.log.Infof("broadcasting created file: %s (%d bytes)", base, len(content))
+	m.broadcast(content)
+
+	// Delete the file after successful broadcast—skip files.json
+	if strings.EqualFold(base, "files.json") {
+		return
+	}
+	if m.history != nil {
+		err := m.history.Archive(path)
+		if err == nil {
+			return
+		}
+		m.log.Errorf("failed to keep %s in history, deleting it: %v", base, err)
+	}
+	if err := deleteWithRetry(path, 5, 150*time.Millisecond); err != nil {
+		m.log.Errorf("failed to delete %s after broadcast: %v", base, err)
+	} else {
+		m.log.Infof("deleted %s after broadcast", base)
+	}
+}
+
+// createdQueue is how many created files wait for the relay worker before the watcher
+// stops queueing them and has the worker rescan the directory instead.
+const createdQueue = 256
+
+// queueCreated hands a created file to the relay worker without blocking the watcher.
+func (m *BroadcastManager) queueCreated(path string) {
+	select {
+	case m.created <- path:
+	default:
+		m.log.Warnf("%d created files queued, rescanning for %s", createdQueue, filepath.Base(path))
+		m.requestRescan()
+	}
+}
+
+// requestRescan has the relay worker rescan MESSAGE_DIR once it is idle.
+func (m *BroadcastManager) requestRescan() {
+	m.rescanDue.Store(true)
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+// relayFiles broadcasts the created files queued by the watcher in order, waiting for each
+// to be complete, and runs the rescans requested meanwhile.
+func (m *BroadcastManager) relayFiles(dir string) {
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case path := <-m.created:
+			m.handleCreated(path)
+		case <-m.wake:
+		}
+		if m.rescanDue.Swap(false) {
+			m.rescan(dir)
+		}
+	}
+}
+
+// rescan processes message files still present in dir, oldest first.
+func (m *BroadcastManager) rescan(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		m.log.Errorf("rescan %s: %v", dir, err)
+		return
+	}
+	type pending struct {
+		path string
+		mod  time.Time
+	}
+	var files []pending
+	for _, e := range entries {
+		if e.IsDir() || strings.EqualFold(e.Name(), "files.json") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, pending{filepath.Join(dir, e.Name()), info.ModTime()})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].mod.Before(files[j].mod) })
+	for _, f := range files {
+		m.handleCreated(f.path)
+	}
+}
+
 func (m *BroadcastManager) startWatcher(dir string) error {
 	if err := ensureDir(dir); err != nil {
 		return err
@@ -165,6 +503,17 @@ func (m *BroadcastManager) startWatcher(dir string) error {
 	if err != nil {
 		return err
 	}
+	m.created, m.wake = make(chan string, createdQueue), make(chan struct{}, 1)
+	m.wg.Add(1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				m.log.Errorf("file relay panic recovered: %v", r)
+			}
+			m.wg.Done()
+		}()
+		m.relayFiles(dir)
+	}()
 	m.wg.Add(1)
 	go func() {
 		defer func() {
@@ -185,41 +534,20 @@ func (m *BroadcastManager) startWatcher(dir string) error {
 					return
 				}
 				if event.Op&fsnotify.Create == fsnotify.Create {
-					path := event.Name
-
-					// Skip directories
-					if fi, err := os.Stat(path); err == nil && fi.IsDir() {
-						continue
-					}
-
-					// Optional: wait for writer to finish (helps with partial writes)
-					time.Sleep(120 * time.Millisecond)
-
-					content, err := os.ReadFile(path)
-					if err != nil {
-						m.log.Errorf("failed reading created file %s: %v", path, err)
-						continue
-					}
-
-					base := filepath.Base(path)
-					m.log.Infof("broadcasting created file: %s (%d bytes)", base, len(content))
-					m.hub.Broadcast(content)
-
-					// Delete the file after successful broadcast—skip files.json
-					if strings.EqualFold(base, "files.json") {
-						continue
-					}
-					if err := deleteWithRetry(path, 5, 150*time.Millisecond); err != nil {
-						m.log.Errorf("failed to delete %s after broadcast: %v", base, err)
-					} else {
-						m.log.Infof("deleted %s after broadcast", base)
-					}
+					m.queueCreated(event.Name)
 				}
 			case err, ok := <-watcher.Errors:
 				if !ok {
 					m.log.Warnf("watcher errors channel closed")
 					return
 				}
+				if errors.Is(err, fsnotify.ErrEventOverflow) {
+					// The kernel queue overflowed while we were busy; events were lost,
+					// so pick up whatever is still waiting in the directory.
+					m.log.Warnf("watcher event overflow, rescanning %s", dir)
+					m.requestRescan()
+					continue
+				}
 				m.log.Errorf("watcher error: %v", err)
 			}
 		}
@@ -229,5 +557,7 @@ func (m *BroadcastManager) startWatcher(dir string) error {
 		return err
 	}
 	m.log.Infof("watching directory for new files: %s", dir)
+	// relay the files written while the service was down
+	m.requestRescan()
 	return nil
 }
@@ -0,0 +1,135 @@
+package managers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	pkg "hex_toolset/pkg"
+	skylogger "hex_toolset/pkg/logger"
+	ws "hex_toolset/pkg/websocket"
+)
+
+// recordingBackplane hands what the manager publishes to the other instances to got.
+type recordingBackplane struct{ got chan string }
+
+func (b recordingBackplane) Publish(_ context.Context, msg []byte) error {
+	b.got <- string(msg)
+	return nil
+}
+func (recordingBackplane) Subscribe(ctx context.Context, _ func([]byte)) error {
+	<-ctx.Done()
+	return nil
+}
+func (recordingBackplane) Origin() string { return "test" }
+func (recordingBackplane) Close() error   { return nil }
+
+// newRelayTest starts the watcher and relay worker of a manager on dir, recording the
+// broadcasts through its backplane.
+func newRelayTest(t *testing.T, dir string) (*BroadcastManager, chan string) {
+	t.Helper()
+	lgr, err := skylogger.New(skylogger.WithDir(t.TempDir()), skylogger.WithConsole(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewBroadcastManager(&pkg.Config{}, lgr)
+	m.ctx, m.cancel = context.WithCancel(context.Background())
+	m.hub = ws.NewHub()
+	go m.hub.Run(lgr)
+	got := make(chan string, 16)
+	m.backplane = recordingBackplane{got}
+	if err := m.startWatcher(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		m.cancel()
+		m.wg.Wait()
+		m.hub.Shutdown()
+		_ = lgr.Close()
+	})
+	return m, got
+}
+
+func nextBroadcast(t *testing.T, got chan string) string {
+	t.Helper()
+	select {
+	case msg := <-got:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("nothing broadcast")
+		return ""
+	}
+}
+
+func TestBroadcastRelay(t *testing.T) {
+	dir := t.TempDir()
+	// written while the service was down
+	if err := os.WriteFile(filepath.Join(dir, "waiting.json"), []byte(`{"n":0}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, got := newRelayTest(t, dir)
+	if msg := nextBroadcast(t, got); msg != `{"n":0}` {
+		t.Errorf("startup rescan broadcast %s", msg)
+	}
+
+	// A file still being written is broadcast once complete, and the one created after it
+	// follows in order.
+	slow, err := os.Create(filepath.Join(dir, "slow.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := slow.WriteString(`{"n":`); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(3 * completePoll)
+	if err := os.WriteFile(filepath.Join(dir, "fast.json"), []byte(`{"n":2}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(3 * completePoll)
+	if _, err := slow.WriteString(`1}`); err != nil {
+		t.Fatal(err)
+	}
+	_ = slow.Close()
+	if msg := nextBroadcast(t, got); msg != `{"n":1}` {
+		t.Errorf("first broadcast %s, want the slow file", msg)
+	}
+	if msg := nextBroadcast(t, got); msg != `{"n":2}` {
+		t.Errorf("second broadcast %s", msg)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for entries, _ := os.ReadDir(dir); len(entries) > 0; entries, _ = os.ReadDir(dir) {
+		if time.Now().After(deadline) {
+			t.Fatalf("files left after broadcast: %v", entries)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestBroadcastRelayQueueFull(t *testing.T) {
+	lgr, err := skylogger.New(skylogger.WithDir(t.TempDir()), skylogger.WithConsole(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lgr.Close()
+	m := NewBroadcastManager(&pkg.Config{}, lgr)
+	m.created, m.wake = make(chan string, 1), make(chan struct{}, 1)
+
+	// The watcher never waits on a busy worker: past the queue it asks for a rescan.
+	done := make(chan struct{})
+	go func() {
+		m.queueCreated("a.json")
+		m.queueCreated("b.json")
+		m.queueCreated("c.json")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("queueCreated blocked on a full queue")
+	}
+	if len(m.created) != 1 || !m.rescanDue.Load() || len(m.wake) != 1 {
+		t.Errorf("queued %d, rescan due %v", len(m.created), m.rescanDue.Load())
+	}
+}
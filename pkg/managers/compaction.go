@@ -0,0 +1,139 @@
+package managers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+
+	"hex_toolset/pkg/db"
+	skylogger "hex_toolset/pkg/logger"
+	"hex_toolset/pkg/timeutil"
+)
+
+// ErrCompactionRunning is returned by Compactor.Start while a compaction is in progress.
+var ErrCompactionRunning = errors.New("a compaction is already running")
+
+// CompactionStatus is the state of the database compaction of a service.
+type CompactionStatus struct {
+	Running   bool   `json:"running"`
+	Step      string `json:"step,omitempty"`       // copying, verifying or swapping
+	StartedAt string `json:"started_at,omitempty"` // 'YYYY-MM-DD HH:MM:SS' local, of the running or last one
+	// Estimate is what compacting now would take; absent while one runs, as measuring the
+	// database waits for its connection.
+	Estimate   *db.CompactEstimate `json:"estimate,omitempty"`
+	FinishedAt string              `json:"finished_at,omitempty"`
+	Last       *db.CompactResult   `json:"last,omitempty"`
+	Error      string              `json:"error,omitempty"` // of the last compaction
+}
+
+// Compactor runs db.Compact on the service's database in the background, so an admin
+// request can start it and poll its progress; ingestion pauses for the duration of the
+// swap as announced by the estimate. The copy rate measured by a compaction is used for
+// the next estimate.
+type Compactor struct {
+	db     *sql.DB
+	path   string
+	logger *skylogger.Logger
+	now    func() time.Time
+
+	mu       sync.Mutex
+	running  bool
+	step     string
+	started  time.Time
+	finished time.Time
+	last     *db.CompactResult
+	lastErr  error
+	rate     int64
+}
+
+// NewCompactor creates a compactor of database, the file at path.
+func NewCompactor(database *sql.DB, path string, lgr *skylogger.Logger) *Compactor {
+	return &Compactor{db: database, path: path, logger: lgr, now: time.Now}
+}
+
+// Status returns the state of the running or last compaction and, when none is running,
+// the estimate of one.
+func (c *Compactor) Status(ctx context.Context) (CompactionStatus, error) {
+	c.mu.Lock()
+	st := CompactionStatus{Running: c.running, Step: c.step, Last: c.last}
+	if !c.started.IsZero() {
+		st.StartedAt = timeutil.FormatLocal(c.started)
+	}
+	if !c.finished.IsZero() {
+		st.FinishedAt = timeutil.FormatLocal(c.finished)
+	}
+	if c.lastErr != nil {
+		st.Error = c.lastErr.Error()
+	}
+	rate := c.rate
+	c.mu.Unlock()
+	if st.Running {
+		return st, nil
+	}
+	est, err := db.EstimateCompact(ctx, c.db, c.path, rate)
+	if err != nil {
+		return st, err
+	}
+	st.Estimate = &est
+	return st, nil
+}
+
+// Start estimates a compaction and runs it in the background, keeping the replaced file
+// with keepBackup; it returns ErrCompactionRunning while one is in progress.
+func (c *Compactor) Start(ctx context.Context, keepBackup bool) (db.CompactEstimate, error) {
+	c.mu.Lock()
+	if c.running {
+		c.mu.Unlock()
+		return db.CompactEstimate{}, ErrCompactionRunning
+	}
+	c.running, c.step, c.started = true, "estimating", c.now()
+	rate := c.rate
+	c.mu.Unlock()
+
+	est, err := db.EstimateCompact(ctx, c.db, c.path, rate)
+	if err != nil {
+		c.finish(nil, err)
+		return est, err
+	}
+	if c.logger != nil {
+		c.logger.Warnw("database compaction started", "size_bytes", est.SizeBytes,
+			"free_bytes", est.FreeBytes, "expected_downtime_seconds", est.DowntimeSeconds)
+	}
+	go func() {
+		// not the request's context: the compaction outlives the admin request
+		res, err := db.Compact(context.Background(), c.db, c.path, db.CompactOptions{
+			Rate:       rate,
+			KeepBackup: keepBackup,
+			Progress: func(step string) {
+				c.mu.Lock()
+				c.step = step
+				c.mu.Unlock()
+			},
+		})
+		c.finish(&res, err)
+	}()
+	return est, nil
+}
+
+func (c *Compactor) finish(res *db.CompactResult, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.running, c.step, c.finished, c.lastErr = false, "", c.now(), err
+	if res != nil {
+		c.last = res
+		if res.RateBytesPerSecond > 0 {
+			c.rate = res.RateBytesPerSecond
+		}
+	}
+	if c.logger == nil {
+		return
+	}
+	if err != nil {
+		c.logger.Errorf("database compaction failed, database unchanged: %v", err)
+		return
+	}
+	c.logger.Warnw("database compaction finished", "before_bytes", res.BeforeBytes,
+		"after_bytes", res.AfterBytes, "downtime_seconds", res.DowntimeSeconds)
+}
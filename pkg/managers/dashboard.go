@@ -0,0 +1,26 @@
+package managers
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+
+	"hex_toolset/pkg/api"
+)
+
+// dashboardFiles is the live dashboard served by the broadcast service: a static page that
+// subscribes to /ws/monitor and renders WIP, LAST_HOUR, LAST_UPDATE and ALERT as they arrive.
+//
+//go:embed dashboard
+var dashboardFiles embed.FS
+
+// registerDashboard serves the dashboard page at / and its assets under /dashboard/.
+func registerDashboard(mux *api.Router) {
+	assets, _ := fs.Sub(dashboardFiles, "dashboard")
+	files := http.FileServer(http.FS(assets))
+	mux.Handle("GET /{$}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-cache")
+		http.ServeFileFS(w, r, assets, "index.html")
+	}))
+	mux.Handle("GET /dashboard/", http.StripPrefix("/dashboard/", files))
+}
@@ -0,0 +1,183 @@
+// Live dashboard of the broadcast service. Everything comes from /ws/monitor: the page
+// keeps the last WIP, LAST_HOUR and LAST_UPDATE snapshots, merges LAST_UPDATE_DELTA into
+// the latter and lists the alerts received since it was opened. Lines in a maintenance window
+// (MAINTENANCE_WINDOWS) are shown as under maintenance instead of stale or down.
+(function () {
+  "use strict";
+
+  // A line group whose last pass is older than these is shown as stale / down.
+  var STALE_MINUTES = 5;
+  var DOWN_MINUTES = 15;
+  var MAX_ALERTS = 50;
+
+  var state = {
+    wip: {},
+    hour: {},
+    lastUpdate: {},
+    disabled: {},
+    // line -> maintenance window in progress; "" stops every line
+    windows: {},
+    alerts: []
+  };
+
+  function splitKey(key) {
+    var i = key.indexOf("_");
+    return i < 0 ? [key, ""] : [key.slice(0, i), key.slice(i + 1)];
+  }
+
+  // parseLocal reads a 'YYYY-MM-DD HH:MM:SS' plant time as browser local time.
+  function parseLocal(s) {
+    var d = new Date(String(s).replace(" ", "T"));
+    return isNaN(d.getTime()) ? null : d;
+  }
+
+  function ingestion(last, now) {
+    if (!last) {
+      return ["down", "no data"];
+    }
+    var minutes = (now - last) / 60000;
+    if (minutes < STALE_MINUTES) {
+      return ["up", "live"];
+    }
+    return [minutes < DOWN_MINUTES ? "stale" : "down", Math.floor(minutes) + " min ago"];
+  }
+
+  function cell(row, text, cls) {
+    var td = document.createElement("td");
+    td.textContent = text;
+    if (cls) {
+      td.className = cls;
+    }
+    row.appendChild(td);
+    return td;
+  }
+
+  function renderLines() {
+    var now = new Date();
+    var minutes = now.getMinutes() + now.getSeconds() / 60;
+    var keys = {};
+    [state.wip, state.hour, state.lastUpdate].forEach(function (m) {
+      Object.keys(m).forEach(function (k) { keys[k] = true; });
+    });
+
+    var body = document.querySelector("#lines tbody");
+    body.textContent = "";
+    Object.keys(keys).sort().forEach(function (key) {
+      var parts = splitKey(key);
+      if (state.disabled[parts[0]]) {
+        return;
+      }
+      var units = state.hour[key];
+      var last = parseLocal(state.lastUpdate[key]);
+      var status = ingestion(last, now);
+      var window = state.windows[""] || state.windows[parts[0]];
+      if (window && status[0] !== "up") {
+        status = ["maintenance", "maintenance until " + String(window.end).slice(11, 16)];
+      }
+
+      var row = document.createElement("tr");
+      cell(row, parts[0]);
+      cell(row, parts[1]);
+      cell(row, key in state.wip ? state.wip[key] : "–", "num");
+      cell(row, units === undefined ? "–" : units, "num");
+      cell(row, units === undefined || minutes < 1 ? "–" : Math.round(units * 60 / minutes), "num");
+      cell(row, state.lastUpdate[key] || "–");
+      var badge = document.createElement("span");
+      badge.className = "status " + status[0];
+      badge.textContent = status[1];
+      cell(row, "").appendChild(badge);
+      body.appendChild(row);
+    });
+
+    var note = document.getElementById("maintenance");
+    var lines = Object.keys(state.disabled).sort();
+    note.hidden = lines.length === 0;
+    note.textContent = "Under maintenance: " + lines.join(", ");
+  }
+
+  function renderAlerts() {
+    var list = document.getElementById("alerts");
+    list.textContent = "";
+    if (state.alerts.length === 0) {
+      var empty = document.createElement("li");
+      empty.className = "note";
+      empty.textContent = "No alerts since the page was opened.";
+      list.appendChild(empty);
+      return;
+    }
+    state.alerts.forEach(function (a) {
+      var li = document.createElement("li");
+      li.className = (a.severity || "") + (a.active ? "" : " resolved");
+      var when = a.active ? a.raised_at : a.resolved_at;
+      li.textContent = new Date(when).toLocaleString() + " [" + (a.severity || "info") + "] " +
+        (a.source ? a.source + ": " : "") + a.message + (a.active ? "" : " (resolved)");
+      list.appendChild(li);
+    });
+  }
+
+  function apply(env) {
+    var data = env.massage;
+    switch (env.massage_type) {
+    case "WIP":
+      state.wip = data || {};
+      break;
+    case "LAST_HOUR":
+      state.hour = data || {};
+      break;
+    case "LAST_UPDATE":
+      state.lastUpdate = data || {};
+      break;
+    case "LAST_UPDATE_DELTA":
+      Object.keys(data || {}).forEach(function (k) { state.lastUpdate[k] = data[k]; });
+      break;
+    case "LINE_MAINTENANCE":
+      state.disabled = {};
+      ((data && data.disabled) || []).forEach(function (l) { state.disabled[l.line_name] = true; });
+      break;
+    case "MAINTENANCE_WINDOWS":
+      state.windows = {};
+      ((data && data.active) || []).forEach(function (w) { state.windows[w.line || ""] = w; });
+      break;
+    case "ALERT":
+      // Keep one entry per alert key, most recent first.
+      state.alerts = state.alerts.filter(function (a) { return a.key !== data.key; });
+      state.alerts.unshift(data);
+      state.alerts.length = Math.min(state.alerts.length, MAX_ALERTS);
+      renderAlerts();
+      return;
+    default:
+      return;
+    }
+    renderLines();
+  }
+
+  function setConnection(up) {
+    var el = document.getElementById("conn");
+    el.className = "status " + (up ? "up" : "down");
+    el.textContent = up ? "connected" : "reconnecting";
+  }
+
+  function connect(delay) {
+    var proto = location.protocol === "https:" ? "wss://" : "ws://";
+    var ws = new WebSocket(proto + location.host + "/ws/monitor");
+    ws.onopen = function () {
+      delay = 1000;
+      setConnection(true);
+    };
+    ws.onmessage = function (ev) {
+      try {
+        apply(JSON.parse(ev.data));
+      } catch (e) {
+        // not an envelope (e.g. files.json); ignore
+      }
+    };
+    ws.onclose = function () {
+      setConnection(false);
+      setTimeout(function () { connect(Math.min(delay * 2, 30000)); }, delay);
+    };
+  }
+
+  // Ingestion ages and UPH move with the clock even without new messages.
+  setInterval(renderLines, 30000);
+  connect(1000);
+})();
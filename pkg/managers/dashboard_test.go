@@ -0,0 +1,40 @@
+package managers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"hex_toolset/pkg/api"
+)
+
+func TestDashboardRoutes(t *testing.T) {
+	mux := api.NewRouter()
+	registerDashboard(mux)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		t.Helper()
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	w := get("/")
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("GET / = %d %q, want the dashboard page", w.Code, w.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(w.Body.String(), "/dashboard/dashboard.js") {
+		t.Fatalf("page does not load the dashboard script:\n%s", w.Body)
+	}
+
+	w = get("/dashboard/dashboard.js")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "/ws/monitor") {
+		t.Fatalf("GET /dashboard/dashboard.js = %d, want the script subscribing to /ws/monitor", w.Code)
+	}
+
+	// Only the page itself is served at the root; other paths still 404.
+	if w = get("/nope"); w.Code != http.StatusNotFound {
+		t.Fatalf("GET /nope = %d, want 404", w.Code)
+	}
+}
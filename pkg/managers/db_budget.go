@@ -0,0 +1,84 @@
+package managers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	pkgcfg "hex_toolset/pkg"
+	"hex_toolset/pkg/metrics"
+)
+
+// Live-ingest DB operations bounded by a latency budget.
+const (
+	DBOpMinuteInsert = "minute_insert"
+	DBOpLedger       = "ledger_record"
+	DBOpPublishQuery = "publish_query"
+)
+
+// DBBudget is the per-operation time allowed to DB work during live ingest. An operation
+// exceeding its budget is cancelled and fails, so a slow disk shows up as counted, bounded
+// failures (routed to the repair/retry path) instead of silently delaying later minutes.
+type DBBudget struct {
+	Insert time.Duration // minute insert batch
+	Query  time.Duration // ledger upserts and the queries feeding live broadcasts
+}
+
+// DefaultDBBudget reads DB_BUDGET_INSERT_MS and DB_BUDGET_QUERY_MS from the config.
+func DefaultDBBudget() DBBudget {
+	cfg := pkgcfg.GetConfig()
+	return DBBudget{
+		Insert: time.Duration(cfg.DB_BUDGET_INSERT_MS) * time.Millisecond,
+		Query:  time.Duration(cfg.DB_BUDGET_QUERY_MS) * time.Millisecond,
+	}
+}
+
+// For returns the budget of op; zero means unbounded.
+func (b DBBudget) For(op string) time.Duration {
+	if op == DBOpMinuteInsert {
+		return b.Insert
+	}
+	return b.Query
+}
+
+// ErrDBBudgetExceeded is returned (wrapped) when an operation ran out of its budget.
+var ErrDBBudgetExceeded = errors.New("db latency budget exceeded")
+
+var (
+	budgetCountersMu sync.Mutex
+	budgetCounters   = map[string]*metrics.Counter{}
+)
+
+// budgetCounter returns the db_budget_exceeded_total counter of op, registering it on first use.
+func budgetCounter(op string) *metrics.Counter {
+	budgetCountersMu.Lock()
+	defer budgetCountersMu.Unlock()
+	c, ok := budgetCounters[op]
+	if !ok {
+		c = metrics.NewCounter("db_budget_exceeded_total",
+			"DB operations cancelled because they exceeded their latency budget during live ingest.",
+			metrics.Labels{"operation": op})
+		metrics.Default.Register(c)
+		budgetCounters[op] = c
+	}
+	return c
+}
+
+// withBudget runs fn under a context bounded by the budget of op. Budget hits are counted and
+// returned as ErrDBBudgetExceeded; cancellation of the parent context is passed through as is.
+func withBudget(parent context.Context, b DBBudget, op string, fn func(ctx context.Context) error) error {
+	limit := b.For(op)
+	if limit <= 0 {
+		return fn(parent)
+	}
+	ctx, cancel := context.WithTimeout(parent, limit)
+	defer cancel()
+	err := fn(ctx)
+	if err != nil && parent.Err() == nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		budgetCounter(op).Inc()
+		return fmt.Errorf("%s: %w after %s: %v", op, ErrDBBudgetExceeded, limit, err)
+	}
+	return err
+}
@@ -0,0 +1,175 @@
+package managers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"hex_toolset/pkg/db/entities"
+	"hex_toolset/pkg/sfc_api"
+	"hex_toolset/pkg/timeutil"
+)
+
+// maxDumpMismatches bounds the mismatches listed in a DumpImportResult; all are counted.
+const maxDumpMismatches = 100
+
+// DumpImportResult summarizes an ImportDump.
+type DumpImportResult struct {
+	Rows       int            `json:"rows"`                 // dump rows read as records
+	Skipped    int            `json:"skipped"`              // unusable rows (see sfc_api.ReadDump)
+	Records    int            `json:"records"`              // distinct records, by logical key
+	Hours      int            `json:"hours"`                // hours the records fall in
+	Matched    int            `json:"matched"`              // stored with the same values
+	Mismatched int            `json:"mismatched"`           // stored with other values; left as stored
+	Inserted   int            `json:"inserted"`             // missing and inserted (to insert, in a dry run)
+	Failed     int            `json:"failed_hours"`         // hours not reconciled (claim or DB errors)
+	Mismatches []DumpMismatch `json:"mismatches,omitempty"` // the first maxDumpMismatches
+}
+
+// DumpMismatch is a record of the dump stored with other values than the dump's.
+type DumpMismatch struct {
+	ID          string   `json:"id"`
+	PPID        string   `json:"ppid"`
+	CollectedAt string   `json:"collected_at"` // local time
+	Line        string   `json:"line"`
+	Station     string   `json:"station"`
+	Fields      []string `json:"fields"` // e.g. `work_order: stored "MO-1", dump "MO-2"`
+}
+
+// ImportDump reconciles a vendor dump (see sfc_api.ReadDump) against records_table, for
+// the historical windows the API no longer serves. Hour by hour, under the hour's ingest
+// claim, the records missing from the table are inserted and those stored with other
+// values than the dump's are reported as mismatches; stored records are never changed or
+// deleted, so a partial or older dump cannot remove data. With dryRun nothing is written.
+func (m *SFCAPIManager) ImportDump(ctx context.Context, r io.Reader, dryRun bool) (DumpImportResult, error) {
+	var res DumpImportResult
+	rows, skipped, err := sfc_api.ReadDump(r)
+	if err != nil {
+		return res, err
+	}
+	res.Rows, res.Skipped = len(rows), len(skipped)
+	for i, s := range skipped {
+		if i == 10 {
+			m.logger.Warnf("dump: %d more row(s) skipped", len(skipped)-i)
+			break
+		}
+		m.logger.Warnf("dump: row skipped: %v", s)
+	}
+
+	recs, err := recordModelToEntity(rows, m.clock.Now())
+	if err != nil {
+		return res, err
+	}
+	byHour := map[time.Time]map[string]entities.RecordEntity{}
+	for _, rec := range recs {
+		hour := timeutil.Hour(rec.CollectedTimestamp).Start
+		if byHour[hour] == nil {
+			byHour[hour] = map[string]entities.RecordEntity{}
+		}
+		byHour[hour][rec.ID] = rec // the last row of a duplicated pass wins
+	}
+	hours := make([]time.Time, 0, len(byHour))
+	for h, hr := range byHour {
+		hours = append(hours, h)
+		res.Records += len(hr)
+	}
+	sort.Slice(hours, func(i, j int) bool { return hours[i].Before(hours[j]) })
+	res.Hours = len(hours)
+
+	for _, h := range hours {
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+		if err := m.importDumpHour(ctx, timeutil.Hour(h), byHour[h], dryRun, &res); err != nil {
+			m.logger.Errorf("dump import of %s: %v", timeutil.FormatLocal(h), err)
+			res.Failed++
+		}
+	}
+	verb := "inserted"
+	if dryRun {
+		verb = "to insert"
+	}
+	m.logger.Infof("dump import: %d record(s) in %d hour(s): %d matched, %d mismatched, %d %s, %d hour(s) failed",
+		res.Records, res.Hours, res.Matched, res.Mismatched, res.Inserted, verb, res.Failed)
+	if res.Failed > 0 {
+		return res, fmt.Errorf("%d of %d hour(s) failed", res.Failed, res.Hours)
+	}
+	return res, nil
+}
+
+// importDumpHour reconciles the dump records of one hour.
+func (m *SFCAPIManager) importDumpHour(ctx context.Context, hour timeutil.TimeRange, dump map[string]entities.RecordEntity, dryRun bool, res *DumpImportResult) error {
+	release, err := m.claims.Acquire(ctx, hour, "dump import")
+	if err != nil {
+		return fmt.Errorf("claim hour: %w", err)
+	}
+	defer release()
+
+	stored := map[string]entities.RecordEntity{}
+	err = m.recordEntity.ForEachIn(ctx, hour, func(rec entities.RecordEntity) error {
+		// keyed like the dump even if the row predates key-derived IDs
+		stored[entities.RecordID(rec)] = rec
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var missing []entities.RecordEntity
+	var matched, mismatched int
+	var mismatches []DumpMismatch
+	for id, rec := range dump {
+		have, ok := stored[id]
+		if !ok {
+			missing = append(missing, rec)
+			continue
+		}
+		fields := recordDiff(have, rec)
+		if len(fields) == 0 {
+			matched++
+			continue
+		}
+		mismatched++
+		mismatches = append(mismatches, DumpMismatch{ID: have.ID, PPID: rec.PPID, CollectedAt: timeutil.FormatLocal(rec.CollectedTimestamp),
+			Line: rec.LineName, Station: rec.StationName, Fields: fields})
+	}
+	if len(missing) > 0 && !dryRun {
+		sort.Slice(missing, func(i, j int) bool { return missing[i].CollectedTimestamp.Before(missing[j].CollectedTimestamp) })
+		m.enricher.Enrich(missing)
+		if _, err := m.insertRecords(ctx, missing, InsertSourceBackfill); err != nil {
+			return err
+		}
+		m.InvalidateCache(hour.Start, hour.End)
+	}
+
+	res.Matched += matched
+	res.Mismatched += mismatched
+	res.Inserted += len(missing)
+	sort.Slice(mismatches, func(i, j int) bool { return mismatches[i].CollectedAt < mismatches[j].CollectedAt })
+	for _, mm := range mismatches {
+		m.logger.Warnf("dump mismatch %s %s %s/%s: %v", mm.PPID, mm.CollectedAt, mm.Line, mm.Station, mm.Fields)
+		if len(res.Mismatches) < maxDumpMismatches {
+			res.Mismatches = append(res.Mismatches, mm)
+		}
+	}
+	return nil
+}
+
+// recordDiff lists the columns outside the logical key where stored and dump differ.
+func recordDiff(stored, dump entities.RecordEntity) []string {
+	var out []string
+	diff := func(col, a, b string) {
+		if a != b {
+			out = append(out, fmt.Sprintf("%s: stored %q, dump %q", col, a, b))
+		}
+	}
+	diff("work_order", stored.WorkOrder, dump.WorkOrder)
+	diff("employee_name", stored.EmployeeName, dump.EmployeeName)
+	diff("model_name", stored.ModelName, dump.ModelName)
+	diff("error_flag", strconv.FormatBool(stored.ErrorFlag), strconv.FormatBool(dump.ErrorFlag))
+	diff("next_station", stored.NextStation, dump.NextStation)
+	return out
+}
@@ -0,0 +1,54 @@
+package managers
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"hex_toolset/pkg/db/entities"
+	"hex_toolset/pkg/timeutil"
+)
+
+func TestIntegrationImportDump(t *testing.T) {
+	resetState(t)
+	m, _ := newTestManager(t)
+	fake.addLine(base, "J01", 2)
+	ctx := context.Background()
+	if _, err := m.ingestMinute(ctx, base, entities.IngestSourceLive); err != nil {
+		t.Fatal(err)
+	}
+	at := func(d time.Duration) string { return base.Add(d).Format("02-Jan-06 03.04.05.000000 PM") }
+	dump := "SERIAL_NUMBER|MO_NUMBER|EMP_NO|MODEL_NAME|LINE_NAME|STATION_NAME|GROUP_NAME|IN_STATION_TIME|ERROR_FLAG\n" +
+		"PPIDJ01080000|MO1|E1|MODELX|LINE J01|PACK01|PACKING|" + at(0) + "|0\n" +
+		"PPIDJ01080001|MO2|E1|MODELX|LINE J01|PACK01|PACKING|" + at(time.Second) + "|0\n" +
+		"PPIDOLD1|MO1|E1|MODELX|LINE J01|PACK01|PACKING|" + at(5*time.Second) + "|1\n" +
+		"PPIDOLD2|MO1|E1|MODELX|LINE J01|PACK01|PACKING|" + at(2*time.Hour) + "|0\n" +
+		"PPIDBAD|MO1|E1|MODELX|LINE J01|PACK01|PACKING||0\n"
+
+	res, err := m.ImportDump(ctx, strings.NewReader(dump), true)
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if res.Rows != 4 || res.Skipped != 1 || res.Records != 4 || res.Hours != 2 || res.Matched != 1 || res.Mismatched != 1 || res.Inserted != 2 {
+		t.Fatalf("dry run = %+v", res)
+	}
+	if mm := res.Mismatches[0]; mm.PPID != "PPIDJ01080001" || len(mm.Fields) != 1 || !strings.HasPrefix(mm.Fields[0], "work_order") {
+		t.Fatalf("mismatch = %+v", mm)
+	}
+	day := timeutil.TimeRange{Start: base, End: base.Add(24 * time.Hour)}
+	if got := storedIDs(t, day); len(got) != 2 {
+		t.Fatalf("dry run stored %d records", len(got))
+	}
+
+	if res, err = m.ImportDump(ctx, strings.NewReader(dump), false); err != nil || res.Inserted != 2 {
+		t.Fatalf("import = %+v, %v", res, err)
+	}
+	if got := storedIDs(t, day); len(got) != 4 {
+		t.Fatalf("stored %d records after import", len(got))
+	}
+	// Mismatches are reported, not overwritten; a second run has nothing to insert.
+	if res, err = m.ImportDump(ctx, strings.NewReader(dump), false); err != nil || res.Inserted != 0 || res.Matched != 3 || res.Mismatched != 1 {
+		t.Fatalf("second import = %+v, %v", res, err)
+	}
+}
@@ -0,0 +1,159 @@
+package managers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"hex_toolset/pkg/db/entities"
+	skylogger "hex_toolset/pkg/logger"
+)
+
+// Enricher is the ingest stage joining incoming records with the line/station registry
+// and the work order metadata: each record is stamped with its area, process, customer and
+// target quantity before it is stored, so dashboard queries read them from records_table
+// without joins. The lookups are cached and re-read at most once per ttl, or right away
+// when changed through the Set and Delete methods (which also re-enrich the stored records).
+type Enricher struct {
+	entity *entities.EnrichmentManager
+	ttl    time.Duration
+	logger *skylogger.Logger
+	now    func() time.Time
+
+	mu       sync.Mutex
+	stations map[stationKey]entities.LineStation
+	orders   map[string]entities.WorkOrderMeta
+	loadedAt time.Time
+	loaded   bool
+}
+
+type stationKey struct{ line, station string }
+
+// NewEnricher creates the enrichment stage of database.
+func NewEnricher(database *sql.DB, ttl time.Duration, lgr *skylogger.Logger) *Enricher {
+	return &Enricher{entity: entities.NewEnrichmentManager(database), ttl: ttl, logger: lgr, now: time.Now}
+}
+
+// Enrich stamps recs in place. Records without a registry entry or work order metadata
+// keep empty fields. When the lookups cannot be read the last known ones are used. It
+// must not be called inside a transaction: the cache may query the DB.
+func (e *Enricher) Enrich(recs []entities.RecordEntity) {
+	if e == nil || len(recs) == 0 {
+		return
+	}
+	e.mu.Lock()
+	stale := !e.loaded || e.now().Sub(e.loadedAt) >= e.ttl
+	e.mu.Unlock()
+	if stale {
+		if err := e.Refresh(context.Background()); err != nil && e.logger != nil {
+			e.logger.Warnf("enrichment: %v", err)
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for i := range recs {
+		r := &recs[i]
+		s, ok := e.stations[stationKey{r.LineName, r.StationName}]
+		if !ok {
+			s = e.stations[stationKey{r.LineName, ""}]
+		}
+		w := e.orders[r.WorkOrder]
+		r.Enrichment = entities.Enrichment{Area: s.Area, Process: s.Process, Customer: w.Customer, TargetQty: w.TargetQty}
+	}
+}
+
+// Refresh reloads the registry and the work order metadata.
+func (e *Enricher) Refresh(ctx context.Context) error {
+	stations, err := e.entity.ListStations(ctx)
+	var orders []entities.WorkOrderMeta
+	if err == nil {
+		orders, err = e.entity.ListWorkOrders(ctx)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.loadedAt = e.now()
+	if err != nil {
+		return err
+	}
+	e.stations = make(map[stationKey]entities.LineStation, len(stations))
+	for _, s := range stations {
+		e.stations[stationKey{s.LineName, s.StationName}] = s
+	}
+	e.orders = make(map[string]entities.WorkOrderMeta, len(orders))
+	for _, w := range orders {
+		e.orders[w.WorkOrder] = w
+	}
+	e.loaded = true
+	return nil
+}
+
+// Stations returns the line/station registry from the database.
+func (e *Enricher) Stations(ctx context.Context) ([]entities.LineStation, error) {
+	out, err := e.entity.ListStations(ctx)
+	if out == nil && err == nil {
+		out = []entities.LineStation{}
+	}
+	return out, err
+}
+
+// SetStation stores the registry entry of line/station; station "" sets the default of
+// every station of the line without an entry of its own.
+func (e *Enricher) SetStation(ctx context.Context, line, station, area, process string) error {
+	line, station = normalizeLine(line), normalizeLine(station)
+	if line == "" {
+		return fmt.Errorf("line is required")
+	}
+	err := e.entity.SetStation(ctx, entities.LineStation{LineName: line, StationName: station,
+		Area: strings.TrimSpace(area), Process: strings.TrimSpace(process)})
+	if err != nil {
+		return err
+	}
+	return e.Refresh(ctx)
+}
+
+// DeleteStation removes the registry entry of line/station; ok is false when it had none.
+func (e *Enricher) DeleteStation(ctx context.Context, line, station string) (ok bool, err error) {
+	if ok, err = e.entity.DeleteStation(ctx, normalizeLine(line), normalizeLine(station)); err != nil || !ok {
+		return ok, err
+	}
+	return true, e.Refresh(ctx)
+}
+
+// WorkOrders returns the work order metadata from the database.
+func (e *Enricher) WorkOrders(ctx context.Context) ([]entities.WorkOrderMeta, error) {
+	out, err := e.entity.ListWorkOrders(ctx)
+	if out == nil && err == nil {
+		out = []entities.WorkOrderMeta{}
+	}
+	return out, err
+}
+
+// SetWorkOrder stores the customer, program and target quantity of a work order.
+func (e *Enricher) SetWorkOrder(ctx context.Context, workOrder, customer, program string, targetQty int) error {
+	workOrder = strings.TrimSpace(workOrder)
+	if workOrder == "" {
+		return fmt.Errorf("work order is required")
+	}
+	if targetQty < 0 {
+		return fmt.Errorf("target quantity must not be negative")
+	}
+	err := e.entity.SetWorkOrder(ctx, entities.WorkOrderMeta{WorkOrder: workOrder,
+		Customer: strings.TrimSpace(customer), Program: strings.TrimSpace(program), TargetQty: targetQty})
+	if err != nil {
+		return err
+	}
+	return e.Refresh(ctx)
+}
+
+// DeleteWorkOrder removes the metadata of a work order; ok is false when it had none.
+func (e *Enricher) DeleteWorkOrder(ctx context.Context, workOrder string) (ok bool, err error) {
+	if ok, err = e.entity.DeleteWorkOrder(ctx, strings.TrimSpace(workOrder)); err != nil || !ok {
+		return ok, err
+	}
+	return true, e.Refresh(ctx)
+}
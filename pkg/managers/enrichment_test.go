@@ -0,0 +1,78 @@
+package managers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"hex_toolset/pkg/db"
+	"hex_toolset/pkg/db/entities"
+	"hex_toolset/pkg/timeutil"
+)
+
+func TestIntegrationRecordEnrichment(t *testing.T) {
+	resetState(t)
+	m, _ := newTestManager(t)
+	ctx := context.Background()
+	e := m.Enrichment()
+	if err := e.SetStation(ctx, "j01", "", "B2", "FATP"); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.SetStation(ctx, "J01", "pack01", "B2", "PACK"); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.SetWorkOrder(ctx, "MO1", "ACME", "", 500); err != nil {
+		t.Fatal(err)
+	}
+
+	fake.add(base, 2)
+	fake.addLine(base, "J02", 1)
+	m.RequestMinute(base)
+
+	stored := func() map[string]entities.Enrichment {
+		t.Helper()
+		out := map[string]entities.Enrichment{}
+		err := entities.NewRecordManagerEntity(db.GetDB()).ForEachIn(ctx, timeutil.Minute(base), func(r entities.RecordEntity) error {
+			if prev, ok := out[r.LineName]; ok && prev != r.Enrichment {
+				t.Fatalf("records of %s enriched differently: %+v and %+v", r.LineName, prev, r.Enrichment)
+			}
+			out[r.LineName] = r.Enrichment
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+	// The station entry wins over the line default; J02 has no registry entry.
+	want := map[string]entities.Enrichment{
+		"J01": {Area: "B2", Process: "PACK", Customer: "ACME", TargetQty: 500},
+		"J02": {Customer: "ACME", TargetQty: 500},
+	}
+	if got := stored(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("stored enrichment = %+v, want %+v", got, want)
+	}
+	if cached, _ := m.RecentRecords(base, base.Add(time.Minute)); len(cached) == 0 || cached[0].Customer != "ACME" {
+		t.Fatalf("cached records not enriched: %+v", cached)
+	}
+
+	// Changing the lookups re-enriches the stored records.
+	if ok, err := e.DeleteStation(ctx, "J01", "PACK01"); err != nil || !ok {
+		t.Fatalf("DeleteStation = %v, %v", ok, err)
+	}
+	if err := e.SetWorkOrder(ctx, "MO1", "Globex", "", 800); err != nil {
+		t.Fatal(err)
+	}
+	want["J01"] = entities.Enrichment{Area: "B2", Process: "FATP", Customer: "Globex", TargetQty: 800}
+	want["J02"] = entities.Enrichment{Customer: "Globex", TargetQty: 800}
+	if got := stored(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("enrichment after changes = %+v, want %+v", got, want)
+	}
+	if ok, err := e.DeleteWorkOrder(ctx, "MO1"); err != nil || !ok {
+		t.Fatalf("DeleteWorkOrder = %v, %v", ok, err)
+	}
+	if got := stored()["J02"]; got != (entities.Enrichment{}) {
+		t.Fatalf("J02 enrichment after deleting the work order = %+v, want none", got)
+	}
+}
@@ -0,0 +1,179 @@
+package managers
+
+import (
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"hex_toolset/pkg/db/entities"
+	skylogger "hex_toolset/pkg/logger"
+	"hex_toolset/pkg/timeutil"
+)
+
+// ExportDestination is a named directory receiving incremental record exports
+// (e.g. the landing folder of the nightly data-lake load).
+type ExportDestination struct {
+	Name string
+	Dir  string
+}
+
+// ParseExportDestinations parses "name=dir[,name=dir...]".
+func ParseExportDestinations(spec string) ([]ExportDestination, error) {
+	var out []ExportDestination
+	seen := map[string]bool{}
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, dir, ok := strings.Cut(part, "=")
+		name, dir = strings.TrimSpace(name), strings.TrimSpace(dir)
+		if !ok || name == "" || dir == "" {
+			return nil, fmt.Errorf("invalid export destination %q, expected name=dir", part)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate export destination %q", name)
+		}
+		seen[name] = true
+		out = append(out, ExportDestination{Name: name, Dir: dir})
+	}
+	return out, nil
+}
+
+// ExportResult describes one export run of a destination.
+type ExportResult struct {
+	Destination string `json:"destination"`
+	From        string `json:"from"` // exclusive
+	To          string `json:"to"`   // inclusive, the new watermark
+	Rows        int64  `json:"rows"`
+	File        string `json:"file,omitempty"`
+}
+
+// ExportManager exports records newer than each destination's watermark as gzipped NDJSON.
+//
+// The watermark is the collected_timestamp up to which a destination is complete. Runs only
+// export up to now-lag, so hour reloads (which rewrite the previous hour) land before their
+// range is exported; older backfills need the watermark reset to be re-exported.
+type ExportManager struct {
+	records *entities.RecordEntityManager
+	state   *entities.ExportStateManager
+	lag     time.Duration
+	logger  *skylogger.Logger
+	now     func() time.Time
+}
+
+// NewExportManager creates an exporter on database.
+func NewExportManager(database *sql.DB, lag time.Duration, lgr *skylogger.Logger) *ExportManager {
+	return &ExportManager{
+		records: entities.NewRecordManagerEntity(database),
+		state:   entities.NewExportStateManager(database),
+		lag:     lag,
+		logger:  lgr,
+		now:     time.Now,
+	}
+}
+
+// Export runs one incremental export for dest and advances its watermark.
+// A destination never exported before starts at the beginning of the previous day.
+func (m *ExportManager) Export(ctx context.Context, dest ExportDestination) (ExportResult, error) {
+	res := ExportResult{Destination: dest.Name}
+	st, err := m.state.Get(dest.Name)
+	if err != nil {
+		return res, err
+	}
+	now := m.now().In(time.Local)
+	res.From = st.Watermark
+	if res.From == "" {
+		y := now.AddDate(0, 0, -1)
+		res.From = timeutil.FormatDB(time.Date(y.Year(), y.Month(), y.Day(), 0, 0, 0, 0, time.Local))
+	}
+	res.To = timeutil.FormatDB(now.Add(-m.lag))
+	if res.To <= res.From {
+		return res, nil
+	}
+
+	res.File, res.Rows, err = m.writeFile(ctx, dest.Dir, res.From, res.To)
+	if err != nil {
+		if rerr := m.state.RecordError(dest.Name, err); rerr != nil {
+			m.logger.Errorf("%v", rerr)
+		}
+		return res, fmt.Errorf("export %s: %w", dest.Name, err)
+	}
+	// The file is in place before the watermark moves: a crash in between re-exports the
+	// same range next run (at-least-once) rather than skipping it.
+	if err := m.state.Advance(dest.Name, res.To, res.Rows, res.File); err != nil {
+		return res, err
+	}
+	m.logger.Infof("export %s: %d rows (%s, %s] -> %s", dest.Name, res.Rows, res.From, res.To, res.File)
+	return res, nil
+}
+
+// writeFile streams (from, to] into <dir>/records_<from>_<to>.ndjson.gz, written atomically.
+// No file is left behind when the range is empty.
+func (m *ExportManager) writeFile(ctx context.Context, dir, from, to string) (string, int64, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", 0, fmt.Errorf("ensure directory %s: %w", dir, err)
+	}
+	tmp, err := os.CreateTemp(dir, ".tmp-export-*")
+	if err != nil {
+		return "", 0, fmt.Errorf("create temp file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	defer func() { _ = os.Remove(tmpPath) }() // no-op after a successful rename
+
+	zw := gzip.NewWriter(tmp)
+	enc := json.NewEncoder(zw)
+	var rows int64
+	err = m.records.ForEachInRange(ctx, from, to, func(r entities.RecordEntity) error {
+		rows++
+		return enc.Encode(r)
+	})
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	if rows == 0 {
+		return "", 0, nil
+	}
+
+	compact := func(s string) string { return strings.NewReplacer("-", "", ":", "", " ", "T").Replace(s) }
+	path := filepath.Join(dir, fmt.Sprintf("records_%s_%s.ndjson.gz", compact(from), compact(to)))
+	if err := os.Rename(tmpPath, path); err != nil {
+		return "", 0, fmt.Errorf("move export into place: %w", err)
+	}
+	return path, rows, nil
+}
+
+// ExportAll exports every destination, continuing past failures.
+func (m *ExportManager) ExportAll(ctx context.Context, dests []ExportDestination) ([]ExportResult, error) {
+	var results []ExportResult
+	var errs []error
+	for _, d := range dests {
+		res, err := m.Export(ctx, d)
+		if err != nil {
+			m.logger.Errorf("%v", err)
+			errs = append(errs, err)
+		}
+		results = append(results, res)
+	}
+	return results, errors.Join(errs...)
+}
+
+// Schedule runs ExportAll every day at hour:minute.
+func (m *ExportManager) Schedule(lm *LoopsManager, hour, minute int, dests []ExportDestination) {
+	lm.StartDailyAt(hour, minute, 0, func(ctx context.Context) {
+		_, _ = m.ExportAll(ctx, dests)
+	})
+}
@@ -0,0 +1,107 @@
+package managers
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"hex_toolset/pkg/db"
+	"hex_toolset/pkg/db/entities"
+	skylogger "hex_toolset/pkg/logger"
+	"hex_toolset/pkg/timeutil"
+)
+
+// exportedLines counts the NDJSON lines of a gzipped export file.
+func exportedLines(t *testing.T, path string) int {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for sc := bufio.NewScanner(zr); sc.Scan(); {
+		n++
+	}
+	return n
+}
+
+func TestIntegrationExport(t *testing.T) {
+	resetState(t)
+	ctx := context.Background()
+	var recs []entities.RecordEntity
+	for i, at := range []time.Duration{10 * time.Minute, 40 * time.Minute, 100 * time.Minute} {
+		recs = append(recs, entities.RecordEntity{PPID: "E" + string(rune('0'+i)), WorkOrder: "MO1", LineName: "J01",
+			GroupName: "PACKING", StationName: "PACK01", ModelName: "M", CollectedTimestamp: base.Add(at)})
+	}
+	if err := entities.NewRecordManagerEntity(db.GetDB()).InsertBatch(recs); err != nil {
+		t.Fatal(err)
+	}
+	lgr, err := skylogger.New(skylogger.WithDir(t.TempDir()), skylogger.WithConsole(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lgr.Close()
+	m := NewExportManager(db.GetDB(), 30*time.Minute, lgr)
+	state := entities.NewExportStateManager(db.GetDB())
+	dest := ExportDestination{Name: "lake", Dir: t.TempDir()}
+	now := base.Add(2 * time.Hour)
+	m.now = func() time.Time { return now }
+
+	// A first run starts at the previous day and stops lag before now.
+	res, err := m.Export(ctx, dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantFrom := timeutil.FormatDB(timeutil.Day(base).Start.AddDate(0, 0, -1))
+	if res.From != wantFrom || res.To != timeutil.FormatDB(base.Add(90*time.Minute)) || res.Rows != 2 {
+		t.Fatalf("first export = %+v", res)
+	}
+	if n := exportedLines(t, res.File); n != 2 {
+		t.Fatalf("%s has %d lines, want 2", res.File, n)
+	}
+	if st, _ := state.Get("lake"); st.Watermark != res.To || st.ExportedRows != 2 || st.LastFile != res.File {
+		t.Fatalf("state after first export = %+v", st)
+	}
+
+	// Nothing past the watermark yet: no file, and an empty range still moves the watermark.
+	if again, err := m.Export(ctx, dest); err != nil || again.Rows != 0 || again.File != "" || again.To != res.To {
+		t.Fatalf("export without time passed = %+v, %v", again, err)
+	}
+	now = now.Add(5 * time.Minute)
+	empty, err := m.Export(ctx, dest)
+	if err != nil || empty.Rows != 0 || empty.File != "" || empty.From != res.To {
+		t.Fatalf("empty export = %+v, %v", empty, err)
+	}
+	if st, _ := state.Get("lake"); st.Watermark != empty.To || st.ExportedRows != 2 {
+		t.Fatalf("state after empty export = %+v", st)
+	}
+	if entries, _ := os.ReadDir(dest.Dir); len(entries) != 1 {
+		t.Fatalf("%d files in the destination, want the first export only", len(entries))
+	}
+
+	// A failed run keeps the watermark, so the next run resumes from it.
+	now = now.Add(time.Hour)
+	broken := ExportDestination{Name: "lake", Dir: filepath.Join(res.File, "sub")}
+	if _, err := m.Export(ctx, broken); err == nil {
+		t.Fatal("export into a file succeeded")
+	}
+	if st, _ := state.Get("lake"); st.Watermark != empty.To || st.LastError == "" {
+		t.Fatalf("state after failed export = %+v", st)
+	}
+	resumed, err := m.Export(ctx, dest)
+	if err != nil || resumed.From != empty.To || resumed.Rows != 1 {
+		t.Fatalf("resumed export = %+v, %v", resumed, err)
+	}
+	if st, _ := state.Get("lake"); st.Watermark != resumed.To || st.ExportedRows != 3 || st.LastError != "" {
+		t.Fatalf("state after resumed export = %+v", st)
+	}
+}
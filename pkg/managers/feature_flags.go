@@ -0,0 +1,189 @@
+package managers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"hex_toolset/pkg/bus"
+	"hex_toolset/pkg/db/entities"
+	skylogger "hex_toolset/pkg/logger"
+)
+
+// Feature flags gating risky behaviors. Flags missing from the feature_flags table use
+// the default listed in KnownFlags.
+const (
+	// FlagRecordsUpsert makes record inserts replace the stored duplicate of a unit pass
+	// (same ppid, timestamp, line, station, group) instead of ignoring the new row, so
+	// corrected upstream fields (error flag, next station) overwrite stale ones.
+	FlagRecordsUpsert = "records_upsert"
+	// FlagDeltaBroadcasts publishes only the LINE_GROUPs whose timestamp changed, on
+	// LAST_UPDATE_DELTA; the full LAST_UPDATE is still sent after start and at every hour.
+	FlagDeltaBroadcasts = "delta_broadcasts"
+	// FlagAutoBackfill lets db_clon repair minutes missing from the ingest ledger.
+	FlagAutoBackfill = "auto_backfill"
+)
+
+// FlagSpec documents a known flag and its default.
+type FlagSpec struct {
+	Name        string `json:"name"`
+	Default     bool   `json:"default"`
+	Description string `json:"description"`
+}
+
+// KnownFlags lists the flags the code checks.
+var KnownFlags = []FlagSpec{
+	{Name: FlagRecordsUpsert, Default: false, Description: "replace duplicate unit passes instead of ignoring them"},
+	{Name: FlagDeltaBroadcasts, Default: false, Description: "publish only changed LINE_GROUPs, on LAST_UPDATE_DELTA"},
+	{Name: FlagAutoBackfill, Default: true, Description: "repair minutes missing from the ingest ledger in db_clon"},
+}
+
+func knownFlag(name string) (FlagSpec, bool) {
+	for _, f := range KnownFlags {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return FlagSpec{}, false
+}
+
+// FeatureFlagsChanged is the FEATURE_FLAGS payload: the full flag state and what changed.
+type FeatureFlagsChanged struct {
+	Flags   map[string]bool `json:"flags"`
+	Changed []string        `json:"changed"`
+}
+
+// FeatureFlags is a cached view of the feature_flags table. State is reloaded at most
+// once per ttl; when a reload sees a flag change (e.g. set from another process with
+// `fix flag`) the new state is logged and published on FEATURE_FLAGS.
+type FeatureFlags struct {
+	entity *entities.FeatureFlagManager
+	state  *tableCache[map[string]bool]
+	logger *skylogger.Logger
+
+	mu        sync.Mutex
+	publisher Publisher
+	bus       *bus.Bus
+}
+
+// NewFeatureFlags creates a flag cache on database. pub may be nil to only log changes.
+func NewFeatureFlags(database *sql.DB, ttl time.Duration, pub Publisher, lgr *skylogger.Logger) *FeatureFlags {
+	f := &FeatureFlags{
+		entity:    entities.NewFeatureFlagManager(database),
+		publisher: pub,
+		logger:    lgr,
+	}
+	f.state = newTableCache(ttl, f.load, f.changed)
+	return f
+}
+
+// SetPublisher replaces the publisher used for FEATURE_FLAGS messages.
+func (f *FeatureFlags) SetPublisher(p Publisher) {
+	f.mu.Lock()
+	f.publisher = p
+	f.mu.Unlock()
+}
+
+// SetBus makes flag changes publish ConfigChanged on b.
+func (f *FeatureFlags) SetBus(b *bus.Bus) {
+	f.mu.Lock()
+	f.bus = b
+	f.mu.Unlock()
+}
+
+// Enabled reports whether flag name is on. When the table cannot be read the last known
+// state (or the flag default) is used, so a DB hiccup never flips behavior.
+func (f *FeatureFlags) Enabled(name string) bool {
+	if f == nil {
+		spec, _ := knownFlag(name)
+		return spec.Default
+	}
+	state, err := f.state.get(context.Background())
+	if err != nil && f.logger != nil {
+		f.logger.Warnf("feature flags: %v", err)
+	}
+	if v, ok := state[name]; ok {
+		return v
+	}
+	spec, _ := knownFlag(name)
+	return spec.Default
+}
+
+// Refresh reloads the flags from the database and publishes the state if it changed.
+func (f *FeatureFlags) Refresh(ctx context.Context) error {
+	return f.state.refresh(ctx)
+}
+
+// load reads every known flag, stored or at its default.
+func (f *FeatureFlags) load(ctx context.Context) (map[string]bool, error) {
+	stored, err := f.entity.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	next := map[string]bool{}
+	for _, s := range KnownFlags {
+		next[s.Name] = s.Default
+	}
+	for _, s := range stored {
+		next[s.Name] = s.Enabled
+	}
+	return next, nil
+}
+
+// changed logs and publishes the flags that differ between prev and next.
+func (f *FeatureFlags) changed(prev, next map[string]bool) {
+	var changed []string
+	for name, v := range next {
+		if p, ok := prev[name]; !ok || p != v {
+			changed = append(changed, name)
+		}
+	}
+	if len(changed) == 0 {
+		return
+	}
+	sort.Strings(changed)
+	f.mu.Lock()
+	pub, b := f.publisher, f.bus
+	f.mu.Unlock()
+	if f.logger != nil {
+		f.logger.Warnf("feature flags changed: %v", changed)
+	}
+	bus.Publish(b, bus.ConfigChanged{Source: bus.ConfigFeatureFlags, Changed: changed})
+	if pub != nil {
+		if err := pub.Publish(TopicFeatureFlags, FeatureFlagsChanged{Flags: copyFlags(next), Changed: changed}); err != nil && f.logger != nil {
+			f.logger.Errorf("%v", err)
+		}
+	}
+}
+
+// Set stores flag name and refreshes the cache, publishing the change.
+// Unknown names are rejected so a typo does not silently create a dead flag.
+func (f *FeatureFlags) Set(ctx context.Context, name string, enabled bool) error {
+	spec, ok := knownFlag(name)
+	if !ok {
+		return fmt.Errorf("unknown feature flag %q", name)
+	}
+	if err := f.entity.Set(ctx, name, enabled, spec.Description); err != nil {
+		return err
+	}
+	return f.Refresh(ctx)
+}
+
+// State returns the current value of every known or stored flag.
+func (f *FeatureFlags) State(ctx context.Context) (map[string]bool, error) {
+	if err := f.Refresh(ctx); err != nil {
+		return nil, err
+	}
+	return copyFlags(f.state.current()), nil
+}
+
+func copyFlags(m map[string]bool) map[string]bool {
+	out := make(map[string]bool, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,42 @@
+package managers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"hex_toolset/pkg/db"
+	"hex_toolset/pkg/db/entities"
+)
+
+// The upsert flag is read by record inserts; with a stale cache reading it queries the
+// database, which must happen before the insert transaction holds the pool's only
+// connection.
+func TestIntegrationUpsertFlagInsert(t *testing.T) {
+	resetState(t)
+	t.Cleanup(func() { _, _ = db.GetDB().Exec("DELETE FROM feature_flags") })
+	flags := NewFeatureFlags(db.GetDB(), 0, nil, nil) // stale on every read
+	records := entities.NewRecordManagerEntity(db.GetDB())
+	records.SetUpsert(func() bool { return flags.Enabled(FlagRecordsUpsert) })
+	rec := entities.RecordEntity{PPID: "U1", WorkOrder: "MO1", LineName: "J01", GroupName: "PACKING",
+		StationName: "PACK01", ModelName: "M", CollectedTimestamp: base}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if stats, err := records.InsertBatchStats(ctx, []entities.RecordEntity{rec}); err != nil || stats.Inserted != 1 {
+		t.Fatalf("insert with a cold flag cache = %+v, %v", stats, err)
+	}
+
+	// With the flag on, a corrected duplicate replaces the stored record.
+	if err := flags.Set(ctx, FlagRecordsUpsert, true); err != nil {
+		t.Fatal(err)
+	}
+	rec.ErrorFlag = true
+	if stats, err := records.InsertBatchStats(ctx, []entities.RecordEntity{rec}); err != nil || stats.Inserted != 1 {
+		t.Fatalf("upsert = %+v, %v", stats, err)
+	}
+	var failed bool
+	if err := db.GetDB().QueryRow(`SELECT error_flag FROM records_table`).Scan(&failed); err != nil || !failed {
+		t.Errorf("stored error_flag = %v, %v; want the replacement's", failed, err)
+	}
+}
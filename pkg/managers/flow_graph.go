@@ -0,0 +1,88 @@
+package managers
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"hex_toolset/pkg/db/entities"
+	"hex_toolset/pkg/timeutil"
+)
+
+// MaxFlowRange bounds the range of a flow graph request; the transitions are computed per
+// unit over raw records, so the query grows with the range.
+const MaxFlowRange = 7 * 24 * time.Hour
+
+// FlowEdge is an observed station-to-station transition of a line.
+type FlowEdge struct {
+	From          string  `json:"from"`
+	To            string  `json:"to"`
+	Count         int     `json:"count"`
+	MedianSeconds float64 `json:"median_seconds"`
+}
+
+// FlowGraph is the station flow of a line over a time range, for Sankey/flow views.
+// Edges are sorted by median transfer time, slowest first, so bottlenecks lead.
+type FlowGraph struct {
+	Line  string                  `json:"line"`
+	From  string                  `json:"from"`
+	To    string                  `json:"to"`
+	Nodes []entities.StationCount `json:"nodes"`
+	Edges []FlowEdge              `json:"edges"`
+}
+
+// BuildFlowGraph computes the flow graph of line in r from the raw records.
+func BuildFlowGraph(ctx context.Context, records *entities.RecordEntityManager, line string, r timeutil.TimeRange) (FlowGraph, error) {
+	g := FlowGraph{Line: line, From: timeutil.FormatLocal(r.Start), To: timeutil.FormatLocal(r.End)}
+	nodes, err := records.CountByStation(ctx, line, r)
+	if err != nil {
+		return g, err
+	}
+	g.Nodes = nodes
+	if g.Nodes == nil {
+		g.Nodes = []entities.StationCount{}
+	}
+
+	type key struct{ from, to string }
+	durations := map[key][]float64{}
+	err = records.ForEachTransition(ctx, line, r, func(t entities.StationTransition) error {
+		k := key{t.From, t.To}
+		durations[k] = append(durations[k], t.Seconds)
+		return nil
+	})
+	if err != nil {
+		return g, err
+	}
+
+	g.Edges = make([]FlowEdge, 0, len(durations))
+	for k, d := range durations {
+		g.Edges = append(g.Edges, FlowEdge{From: k.from, To: k.to, Count: len(d), MedianSeconds: median(d)})
+	}
+	sort.Slice(g.Edges, func(i, j int) bool {
+		a, b := g.Edges[i], g.Edges[j]
+		if a.MedianSeconds != b.MedianSeconds {
+			return a.MedianSeconds > b.MedianSeconds
+		}
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		if a.From != b.From {
+			return a.From < b.From
+		}
+		return a.To < b.To
+	})
+	return g, nil
+}
+
+// median returns the median of d, sorting it in place.
+func median(d []float64) float64 {
+	if len(d) == 0 {
+		return 0
+	}
+	sort.Float64s(d)
+	mid := len(d) / 2
+	if len(d)%2 == 1 {
+		return d[mid]
+	}
+	return (d[mid-1] + d[mid]) / 2
+}
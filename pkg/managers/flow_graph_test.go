@@ -0,0 +1,74 @@
+package managers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"hex_toolset/pkg/db"
+	"hex_toolset/pkg/db/entities"
+	"hex_toolset/pkg/timeutil"
+)
+
+func TestMedian(t *testing.T) {
+	cases := []struct {
+		in   []float64
+		want float64
+	}{
+		{nil, 0},
+		{[]float64{5}, 5},
+		{[]float64{9, 1, 5}, 5},
+		{[]float64{4, 1, 3, 2}, 2.5},
+	}
+	for _, c := range cases {
+		if got := median(c.in); got != c.want {
+			t.Errorf("median(%v) = %v, want %v", c.in, got, c.want)
+		}
+	}
+}
+
+func TestBuildFlowGraph(t *testing.T) {
+	resetState(t)
+	records := entities.NewRecordManagerEntity(db.GetDB())
+
+	// Two units go SMT -> TEST -> PACK; the second one also loops back through TEST.
+	var recs []entities.RecordEntity
+	pass := func(ppid, station, group string, at time.Duration) {
+		recs = append(recs, entities.RecordEntity{PPID: ppid, LineName: "J01", StationName: station,
+			GroupName: group, CollectedTimestamp: base.Add(at)})
+	}
+	pass("U1", "SMT01", "SMT", 0)
+	pass("U1", "TEST01", "TEST", 60*time.Second)
+	pass("U1", "PACK01", "PACKING", 100*time.Second)
+	pass("U2", "SMT01", "SMT", 10*time.Second)
+	pass("U2", "TEST01", "TEST", 30*time.Second)
+	pass("U2", "TEST01", "TEST", 90*time.Second)
+	pass("U2", "PACK01", "PACKING", 95*time.Second)
+	// Another line and a record outside the range are ignored.
+	recs = append(recs, entities.RecordEntity{PPID: "X", LineName: "J02", StationName: "SMT01", GroupName: "SMT", CollectedTimestamp: base},
+		entities.RecordEntity{PPID: "U1", LineName: "J01", StationName: "OBA01", GroupName: "OBA", CollectedTimestamp: base.Add(2 * time.Hour)})
+	if err := records.InsertBatch(recs); err != nil {
+		t.Fatal(err)
+	}
+
+	g, err := BuildFlowGraph(context.Background(), records, "J01", timeutil.Hour(base))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []FlowEdge{ // slowest first
+		{From: "TEST01", To: "TEST01", Count: 1, MedianSeconds: 60},
+		{From: "SMT01", To: "TEST01", Count: 2, MedianSeconds: 40},
+		{From: "TEST01", To: "PACK01", Count: 2, MedianSeconds: 22.5},
+	}
+	if len(g.Edges) != len(want) {
+		t.Fatalf("edges = %+v, want %+v", g.Edges, want)
+	}
+	for i := range want {
+		if g.Edges[i] != want[i] {
+			t.Fatalf("edge %d = %+v, want %+v", i, g.Edges[i], want[i])
+		}
+	}
+	if len(g.Nodes) != 3 || g.Nodes[0].StationName != "PACK01" || g.Nodes[2].Units != 3 {
+		t.Fatalf("nodes = %+v", g.Nodes)
+	}
+}
@@ -0,0 +1,93 @@
+package managers
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"hex_toolset/pkg/buildinfo"
+	"hex_toolset/pkg/timeutil"
+)
+
+// Heartbeat statuses written after each live minute cycle.
+const (
+	HeartbeatOK     = "ok"     // minute stored
+	HeartbeatEmpty  = "empty"  // minute fetched, no records
+	HeartbeatFailed = "failed" // fetch or store failed; the minute goes to the repair path
+)
+
+// Heartbeat rewrites a small status file after every live ingest cycle, so a plain
+// file-age check (e.g. Nagios check_file_age) alerts when db_clon stops cycling, even where
+// nothing scrapes /metrics. The file holds key=value lines:
+//
+//	timestamp=2025-03-10 08:01:02
+//	last_ingested_minute=2025-03-10 08:00
+//	status=ok
+//	error=
+//	version=1.4.2
+//	commit=3f2a9c1
+//
+// It is replaced atomically, so a check never reads a partial file.
+type Heartbeat struct {
+	path string
+	now  func() time.Time
+
+	mu         sync.Mutex
+	lastMinute time.Time
+}
+
+// NewHeartbeat creates a heartbeat writing to path.
+func NewHeartbeat(path string) *Heartbeat {
+	return &Heartbeat{path: path, now: time.Now}
+}
+
+// Beat records the outcome of the cycle of minute. A failed minute does not move the last
+// ingested minute, so a stalled feed is visible even while the file keeps being touched.
+func (h *Heartbeat) Beat(minute time.Time, status string, cycleErr error) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if status != HeartbeatFailed && minute.After(h.lastMinute) {
+		h.lastMinute = minute
+	}
+	last := ""
+	if !h.lastMinute.IsZero() {
+		last = h.lastMinute.In(time.Local).Format(timeutil.MinuteLayout)
+	}
+	msg := ""
+	if cycleErr != nil {
+		msg = strings.ReplaceAll(cycleErr.Error(), "\n", " ")
+	}
+	build := buildinfo.Get()
+	body := fmt.Sprintf("timestamp=%s\nlast_ingested_minute=%s\nstatus=%s\nerror=%s\nversion=%s\ncommit=%s\n",
+		h.now().In(time.Local).Format(timeutil.DBLayout), last, status, msg, build.Version, build.Commit)
+	return writeFileAtomic(h.path, []byte(body))
+}
+
+// writeFileAtomic writes b to a temp file next to path and renames it into place.
+func writeFileAtomic(path string, b []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("ensure directory %s: %w", dir, err)
+	}
+	tmp, err := os.CreateTemp(dir, ".tmp-heartbeat-*")
+	if err != nil {
+		return fmt.Errorf("create temp file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	_, werr := tmp.Write(b)
+	cerr := tmp.Close()
+	if werr == nil {
+		werr = cerr
+	}
+	if werr == nil {
+		werr = os.Rename(tmpPath, path)
+	}
+	if werr != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("write %s: %w", path, werr)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package managers
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"hex_toolset/pkg/buildinfo"
+)
+
+func TestHeartbeat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "status", "heartbeat")
+	hb := NewHeartbeat(path)
+	now := time.Date(2025, 3, 10, 8, 1, 2, 0, time.Local)
+	hb.now = func() time.Time { return now }
+	minute := time.Date(2025, 3, 10, 8, 0, 0, 0, time.Local)
+
+	read := func() string {
+		t.Helper()
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+
+	if err := hb.Beat(minute, HeartbeatOK, nil); err != nil {
+		t.Fatalf("Beat: %v", err)
+	}
+	build := "version=" + buildinfo.Get().Version + "\ncommit=" + buildinfo.Get().Commit + "\n"
+	want := "timestamp=2025-03-10 08:01:02\nlast_ingested_minute=2025-03-10 08:00\nstatus=ok\nerror=\n" + build
+	if got := read(); got != want {
+		t.Fatalf("heartbeat file =\n%s\nwant\n%s", got, want)
+	}
+
+	// A failed minute refreshes the file but keeps the last ingested minute.
+	now = now.Add(time.Minute)
+	if err := hb.Beat(minute.Add(time.Minute), HeartbeatFailed, errors.New("upstream\nunavailable")); err != nil {
+		t.Fatalf("Beat: %v", err)
+	}
+	want = "timestamp=2025-03-10 08:02:02\nlast_ingested_minute=2025-03-10 08:00\nstatus=failed\nerror=upstream unavailable\n" + build
+	if got := read(); got != want {
+		t.Fatalf("heartbeat file =\n%s\nwant\n%s", got, want)
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("status directory holds %d files, want only the heartbeat", len(entries))
+	}
+}
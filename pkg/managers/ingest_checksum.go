@@ -0,0 +1,106 @@
+package managers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"hex_toolset/pkg/db/entities"
+	"hex_toolset/pkg/timeutil"
+)
+
+// recordsChecksum identifies a set of records independently of the order the API returned
+// them in: the SHA-256 of their sorted canonical lines. Two fetches of a window with the
+// same checksum stored the same records, so the second needs no processing.
+func recordsChecksum(recs []entities.RecordEntity) string {
+	lines := make([]string, len(recs))
+	for i, r := range recs {
+		lines[i] = strings.Join([]string{r.PPID, timeutil.FormatDB(r.CollectedTimestamp), r.LineName, r.GroupName,
+			r.StationName, r.ModelName, r.WorkOrder, r.EmployeeName, fmt.Sprint(r.ErrorFlag), r.NextStation}, "\x1f")
+	}
+	sort.Strings(lines)
+	sum := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// minuteChecksums returns the recordsChecksum of every minute of window keyed by the
+// minute's Unix time, bucketing recs by their collected minute as the minute endpoint does.
+func minuteChecksums(window timeutil.TimeRange, recs []entities.RecordEntity) map[int64]string {
+	byMinute := map[int64][]entities.RecordEntity{}
+	for t := window.Start.Truncate(time.Minute); t.Before(window.End); t = t.Add(time.Minute) {
+		byMinute[t.Unix()] = nil
+	}
+	for _, r := range recs {
+		k := r.CollectedTimestamp.Truncate(time.Minute).Unix()
+		if _, ok := byMinute[k]; ok {
+			byMinute[k] = append(byMinute[k], r)
+		}
+	}
+	sums := make(map[int64]string, len(byMinute))
+	for k, rs := range byMinute {
+		sums[k] = recordsChecksum(rs)
+	}
+	return sums
+}
+
+// storedChecksums returns the ledger entries of [start, end) keyed by the minute's Unix time.
+func (m *SFCAPIManager) storedChecksums(start, end time.Time) map[int64]entities.IngestLedgerEntry {
+	entries, err := m.ledger.Range(start, end)
+	if err != nil {
+		m.logger.Warnf("ingest ledger: %v", err)
+		return nil
+	}
+	out := make(map[int64]entities.IngestLedgerEntry, len(entries))
+	for _, e := range entries {
+		if t, err := time.ParseInLocation(timeutil.DBLayout, e.Minute, time.Local); err == nil {
+			out[t.Unix()] = e
+		}
+	}
+	return out
+}
+
+// storedAs reports whether e is a successful ingest of exactly the records of checksum.
+func storedAs(e entities.IngestLedgerEntry, checksum string) bool {
+	return (e.Status == entities.IngestOK || e.Status == entities.IngestEmpty) && e.Checksum == checksum
+}
+
+// checkHour compares the per-minute checksums of the records fetched for window with the
+// ledger. unchanged is true when every minute was already stored with the same records;
+// minutes that changed after an earlier hour reload are flagged as upstream mutations.
+func (m *SFCAPIManager) checkHour(window timeutil.TimeRange, fresh []entities.RecordEntity) (sums map[int64]string, unchanged bool) {
+	sums = minuteChecksums(window, fresh)
+	stored := m.storedChecksums(window.Start, window.End)
+	unchanged = len(stored) == len(sums)
+	var mutated []time.Time
+	for k, sum := range sums {
+		e, ok := stored[k]
+		if !ok || !storedAs(e, sum) {
+			unchanged = false
+		}
+		if ok && entities.Mutated(e, sum) {
+			mutated = append(mutated, time.Unix(k, 0))
+		}
+	}
+	m.flagMutations(window, mutated)
+	return sums, unchanged
+}
+
+// flagMutations reports minutes whose records changed upstream after their hour had been
+// reconciled; the ledger counts them in mutations.
+func (m *SFCAPIManager) flagMutations(window timeutil.TimeRange, minutes []time.Time) {
+	if len(minutes) == 0 {
+		return
+	}
+	sort.Slice(minutes, func(i, j int) bool { return minutes[i].Before(minutes[j]) })
+	names := make([]string, len(minutes))
+	for i, t := range minutes {
+		names[i] = t.In(time.Local).Format("15:04")
+	}
+	hour := window.Start.In(time.Local).Format(timeutil.HourLayout)
+	msg := fmt.Sprintf("SFC data of closed hour %s changed upstream in %d minute(s): %s", hour, len(minutes), strings.Join(names, ", "))
+	m.logger.Warnf("%s", msg)
+	m.alerts.Raise("sfc_data_mutation_"+hour, SeverityWarning, "sfc_api", msg)
+}
@@ -0,0 +1,60 @@
+package managers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"hex_toolset/pkg/db/entities"
+	"hex_toolset/pkg/timeutil"
+)
+
+func TestIntegrationHourChecksums(t *testing.T) {
+	resetState(t)
+	m, _ := newTestManager(t)
+	fake.add(base, 3)
+	fake.add(base.Add(time.Minute), 3)
+	hour := timeutil.Hour(base)
+	next := base.Add(time.Hour)
+	if err := m.RequestHour(context.Background(), next); err != nil {
+		t.Fatalf("RequestHour: %v", err)
+	}
+	if e := ledgerEntry(t, base); e.Source != entities.IngestSourceHour || e.Checksum == "" {
+		t.Fatalf("ledger entry after reload = %+v", e)
+	}
+
+	// Re-fetching the same hour changes nothing and is not processed.
+	reconcile := insertMetricsFor(InsertSourceReconcile)
+	inserted, ignored := reconcile.inserted.Value(), reconcile.ignored.Value()
+	if err := m.RequestHour(context.Background(), next); err != nil {
+		t.Fatalf("RequestHour: %v", err)
+	}
+	if d := reconcile.inserted.Value() + reconcile.ignored.Value() - inserted - ignored; d != 0 {
+		t.Fatalf("unchanged hour processed %d records, want 0", d)
+	}
+	if e := ledgerEntry(t, base); e.Attempts != 1 || e.Mutations != 0 {
+		t.Fatalf("ledger entry after unchanged reload = %+v", e)
+	}
+
+	// SFC silently drops a unit of the closed hour: the reload follows it and flags the minute.
+	fake.drop(base.Add(time.Minute))
+	if err := m.RequestHour(context.Background(), next); err != nil {
+		t.Fatalf("RequestHour: %v", err)
+	}
+	if got := storedIDs(t, hour); len(got) != 5 {
+		t.Fatalf("stored %d records after mutated reload, want 5", len(got))
+	}
+	if e := ledgerEntry(t, base.Add(time.Minute)); e.Mutations != 1 {
+		t.Fatalf("mutated minute ledger entry = %+v", e)
+	}
+	if e := ledgerEntry(t, base); e.Mutations != 0 {
+		t.Fatalf("unchanged minute ledger entry = %+v", e)
+	}
+	var flagged bool
+	for _, a := range m.Alerts().Active() {
+		flagged = flagged || a.Key == "sfc_data_mutation_"+base.Format(timeutil.HourLayout)
+	}
+	if !flagged {
+		t.Fatalf("no mutation alert among %+v", m.Alerts().Active())
+	}
+}
@@ -0,0 +1,103 @@
+package managers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"hex_toolset/pkg/db/entities"
+	skylogger "hex_toolset/pkg/logger"
+	"hex_toolset/pkg/metrics"
+	"hex_toolset/pkg/timeutil"
+)
+
+// Defaults of IngestClaims.
+const (
+	// DefaultIngestClaimTTL bounds how long a claim outlives a process that died holding it;
+	// a claim covers one minute or one hour of work, which takes seconds.
+	DefaultIngestClaimTTL = 10 * time.Minute
+	// DefaultIngestClaimWait is how long an ingest waits for an overlapping one to finish.
+	DefaultIngestClaimWait = 2 * time.Minute
+	ingestClaimPoll        = 250 * time.Millisecond
+)
+
+// ErrIngestClaimed is returned (wrapped) when another ingest held the range for longer
+// than the wait.
+var ErrIngestClaimed = errors.New("range claimed by another ingest")
+
+var ingestClaimWaits = metrics.NewCounter("ingest_claim_waits_total",
+	"Minute or hour ingests that waited for an overlapping ingest (live, repair or a fix run) to finish.", nil)
+
+func init() { metrics.Default.Register(ingestClaimWaits) }
+
+// IngestClaims serializes fetching and storing SFC data: live ingest, the repair loop,
+// UpdateLostMinutes and fix runs claim the minute or hour they work on in the ingest_claim
+// table, and an ingest overlapping a claim waits for its release. Storing the same minute
+// twice at once is what caused the duplicate and conflict storms during manual repairs;
+// serialized, the second ingest sees the first one's checksum and skips the insert.
+type IngestClaims struct {
+	entity *entities.IngestClaimManager
+	owner  string
+	logger *skylogger.Logger
+	now    func() time.Time
+	ttl    time.Duration
+	wait   time.Duration
+}
+
+// NewIngestClaims creates the claims of owner (see ProcessOwner) on database.
+func NewIngestClaims(database *sql.DB, owner string, lgr *skylogger.Logger) *IngestClaims {
+	return &IngestClaims{entity: entities.NewIngestClaimManager(database), owner: owner, logger: lgr,
+		now: time.Now, ttl: DefaultIngestClaimTTL, wait: DefaultIngestClaimWait}
+}
+
+// ProcessOwner identifies this process in claims: "program@host:pid".
+func ProcessOwner() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s@%s:%d", filepath.Base(os.Args[0]), host, os.Getpid())
+}
+
+// Acquire claims r for source, waiting while an overlapping claim is held, and returns
+// the function releasing it. It fails with ErrIngestClaimed after the wait and with the
+// context's error when ctx ends. If the claim table cannot be used, the failure is
+// logged and the ingest proceeds unclaimed rather than stopping.
+func (c *IngestClaims) Acquire(ctx context.Context, r timeutil.TimeRange, source string) (release func(), err error) {
+	owner := c.owner + " " + source
+	deadline := c.now().Add(c.wait)
+	waited := false
+	for {
+		id, held, ok, err := c.entity.TryClaim(ctx, r.Start, r.End, owner, c.now(), c.ttl)
+		if err != nil {
+			c.logger.Warnf("ingest claim of %s: %v; proceeding unclaimed", r, err)
+			return func() {}, nil
+		}
+		if ok {
+			return func() { c.release(id) }, nil
+		}
+		if !waited && held.Owner != "" {
+			waited = true
+			ingestClaimWaits.Inc()
+			c.logger.Infof("%s of %s waits for %s (%s..%s)", source, r, held.Owner, held.StartAt, held.EndAt)
+		}
+		if !c.now().Before(deadline) {
+			return nil, fmt.Errorf("%s: %w (%s)", r, ErrIngestClaimed, held.Owner)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(ingestClaimPoll):
+		}
+	}
+}
+
+func (c *IngestClaims) release(id int64) {
+	// released even when the ingest was cancelled, or the range stays blocked until the TTL
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.entity.Release(ctx, id, c.now()); err != nil {
+		c.logger.Warnf("ingest claim: %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package managers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"hex_toolset/pkg/db"
+	"hex_toolset/pkg/db/entities"
+	"hex_toolset/pkg/timeutil"
+)
+
+func TestIntegrationIngestClaims(t *testing.T) {
+	resetState(t)
+	m, _ := newTestManager(t)
+	fake.addLine(base, "J01", 2)
+	ctx := context.Background()
+	hour := timeutil.Hour(base)
+	claims := entities.NewIngestClaimManager(db.GetDB())
+
+	// A fix run reloading the hour holds it: the repair waits, then gives up.
+	id, _, ok, err := claims.TryClaim(ctx, hour.Start, hour.End, "fix@other:1 hour", time.Now(), time.Minute)
+	if err != nil || !ok {
+		t.Fatalf("TryClaim = %v, %v", ok, err)
+	}
+	if _, held, ok, _ := claims.TryClaim(ctx, base, base.Add(time.Minute), "overlap", time.Now(), time.Minute); ok || held.Owner != "fix@other:1 hour" {
+		t.Fatalf("overlapping claim granted (held %+v)", held)
+	}
+	m.claims.wait = 300 * time.Millisecond
+	if _, err := m.ingestMinute(ctx, base, entities.IngestSourceRepair); !errors.Is(err, ErrIngestClaimed) {
+		t.Fatalf("ingest of a claimed minute = %v, want ErrIngestClaimed", err)
+	}
+	if got := storedIDs(t, hour); len(got) != 0 {
+		t.Fatalf("claimed minute stored: %v", got)
+	}
+
+	// Released while the ingest waits, the minute is stored once.
+	m.claims.wait = 10 * time.Second
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		_ = claims.Release(ctx, id, time.Now())
+	}()
+	start := time.Now()
+	if n, err := m.ingestMinute(ctx, base, entities.IngestSourceRepair); err != nil || n != 2 {
+		t.Fatalf("ingest after release = %d, %v", n, err)
+	}
+	if time.Since(start) < 250*time.Millisecond {
+		t.Fatal("ingest did not wait for the claim")
+	}
+
+	// A lapsed claim of a dead process does not block; the next release clears it.
+	if _, _, ok, err := claims.TryClaim(ctx, hour.Start, hour.End, "dead", time.Now().Add(-time.Hour), time.Minute); !ok || err != nil {
+		t.Fatalf("TryClaim lapsed = %v, %v", ok, err)
+	}
+	if _, err := m.loadHour(ctx, hour, InsertSourceReconcile); err != nil {
+		t.Fatalf("loadHour over a lapsed claim: %v", err)
+	}
+	var left int
+	if err := db.GetDB().QueryRow(`SELECT COUNT(*) FROM ingest_claim`).Scan(&left); err != nil || left != 0 {
+		t.Fatalf("claims left = %d, %v", left, err)
+	}
+}
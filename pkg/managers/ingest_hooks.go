@@ -0,0 +1,42 @@
+package managers
+
+import (
+	"hex_toolset/pkg/bus"
+	"hex_toolset/pkg/timeutil"
+)
+
+// MinuteLoaded is emitted after a minute was fetched and stored; see bus.MinuteIngested.
+type MinuteLoaded = bus.MinuteIngested
+
+// HourRepaired is emitted after RepairHour found missing minutes in an hour.
+type HourRepaired = RepairResult
+
+// Backfill kinds reported in BackfillComplete.
+const (
+	BackfillPreviousHour = "previous_hour" // scheduled RequestHour reload
+	BackfillHour         = "hour"          // LoadHour
+	BackfillDays         = "days"          // LoadDay / LoadRangeOfDays
+)
+
+// BackfillComplete is emitted when a whole-hour or multi-day reload finishes, successfully
+// or not. Failed counts the hours that could not be reloaded.
+type BackfillComplete struct {
+	Kind    string             `json:"kind"`
+	Range   timeutil.TimeRange `json:"range"`
+	Records int                `json:"records"`
+	Failed  int                `json:"failed"`
+	Error   string             `json:"error,omitempty"`
+}
+
+// The ingest events are published on the manager's bus (see Bus), in order: handlers run
+// synchronously on the ingesting goroutine, so they must be quick and hand off anything
+// slow; a panicking handler is logged and does not stop ingestion.
+
+// OnMinuteLoaded registers fn to run after each stored minute.
+func (m *SFCAPIManager) OnMinuteLoaded(fn func(MinuteLoaded)) { bus.Subscribe(m.bus, fn) }
+
+// OnHourRepaired registers fn to run after RepairHour repaired (or failed to repair) minutes.
+func (m *SFCAPIManager) OnHourRepaired(fn func(HourRepaired)) { bus.Subscribe(m.bus, fn) }
+
+// OnBackfillComplete registers fn to run after RequestHour, LoadHour, LoadDay and LoadRangeOfDays.
+func (m *SFCAPIManager) OnBackfillComplete(fn func(BackfillComplete)) { bus.Subscribe(m.bus, fn) }
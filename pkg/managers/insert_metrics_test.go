@@ -0,0 +1,36 @@
+package managers
+
+import (
+	"testing"
+	"time"
+
+	"hex_toolset/pkg/db/entities"
+	"hex_toolset/pkg/metrics"
+)
+
+func TestInsertMetricsLastMinute(t *testing.T) {
+	im := &insertMetrics{
+		inserted: metrics.NewCounter("t_inserted_total", "", nil),
+		ignored:  metrics.NewCounter("t_ignored_total", "", nil),
+	}
+	t0 := time.Date(2025, 3, 10, 8, 0, 10, 0, time.UTC)
+
+	im.observe(t0, entities.InsertStats{Inserted: 2, Ignored: 3})
+	im.observe(t0.Add(20*time.Second), entities.InsertStats{Ignored: 4})
+	if got := im.lastMinute(t0.Add(30 * time.Second)); got != 0 {
+		t.Fatalf("during the minute lastMinute = %d, want 0", got)
+	}
+	if got := im.lastMinute(t0.Add(time.Minute)); got != 7 {
+		t.Fatalf("next minute lastMinute = %d, want 7", got)
+	}
+	im.observe(t0.Add(time.Minute), entities.InsertStats{Ignored: 1})
+	if got := im.lastMinute(t0.Add(2 * time.Minute)); got != 1 {
+		t.Fatalf("two minutes later lastMinute = %d, want 1", got)
+	}
+	if got := im.lastMinute(t0.Add(10 * time.Minute)); got != 0 {
+		t.Fatalf("after a gap lastMinute = %d, want 0", got)
+	}
+	if im.inserted.Value() != 2 || im.ignored.Value() != 8 {
+		t.Fatalf("counters = %d inserted, %d ignored", im.inserted.Value(), im.ignored.Value())
+	}
+}
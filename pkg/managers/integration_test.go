@@ -0,0 +1,281 @@
+package managers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"hex_toolset/pkg/db"
+	"hex_toolset/pkg/db/entities"
+	"hex_toolset/pkg/sfc_api"
+	"hex_toolset/pkg/timeutil"
+)
+
+// The integration tests of this package run the managers end to end against a fake SFC
+// API and a temporary SQLite database holding the full schema. This file holds their
+// shared setup; the tests live in the <feature>_test.go file of what they cover. Config
+// and the DB connection are process-wide singletons, so TestMain sets them up once and
+// each test starts from resetState.
+
+var (
+	fake      *fakeSFC
+	statusDir string
+
+	// base is the first minute the tests ingest; it is far enough in the past that the
+	// live loops of a real deployment would never touch it.
+	base = time.Date(2025, 3, 10, 8, 0, 0, 0, time.UTC)
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(runIntegration(m))
+}
+
+func runIntegration(m *testing.M) int {
+	// The API returns local timestamps without a zone; pin Local so the test does not
+	// depend on the machine it runs on.
+	time.Local = time.UTC
+
+	dir, err := os.MkdirTemp("", "managers-it-")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+
+	fake = newFakeSFC()
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	statusDir = filepath.Join(dir, "status")
+	for k, v := range map[string]string{
+		"SFC_API":       srv.URL,
+		"SFC_CLON":      filepath.Join(dir, "sfc_clon.db"),
+		"SFC_DB_STATUS": statusDir,
+		"MESSAGE_DIR":   filepath.Join(dir, "messages"),
+		"LOG_DIR":       filepath.Join(dir, "logs"),
+		"IPC_SOCKET":    "",
+	} {
+		os.Setenv(k, v)
+	}
+
+	ctx := context.Background()
+	if err := db.GetInstance().InitDefault(ctx); err != nil {
+		fmt.Fprintln(os.Stderr, "init db:", err)
+		return 1
+	}
+	defer db.GetInstance().CloseDB()
+	for _, s := range entities.Schema(db.GetDB()) {
+		if err := s.Create(); err != nil {
+			fmt.Fprintf(os.Stderr, "schema %s: %v\n", s.Name, err)
+			return 1
+		}
+	}
+	return m.Run()
+}
+
+// fakeSFC serves /api/getPPIDRecords from per-minute fixtures keyed by Unix time. Minutes
+// marked as failing answer 500, and an hour request fails if any of its minutes does.
+type fakeSFC struct {
+	mu      sync.Mutex
+	minutes map[int64][]sfc_api.RecordDataCollector
+	failing map[int64]bool
+	hours   int // hour endpoint requests served
+}
+
+func newFakeSFC() *fakeSFC {
+	f := &fakeSFC{}
+	f.reset()
+	return f
+}
+
+func (f *fakeSFC) reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.minutes = map[int64][]sfc_api.RecordDataCollector{}
+	f.failing = map[int64]bool{}
+	f.hours = 0
+}
+
+func (f *fakeSFC) hourRequests() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.hours
+}
+
+// add stores n passing units of line J01 at minute, one second apart.
+func (f *fakeSFC) add(minute time.Time, n int) { f.addLine(minute, "J01", n) }
+
+// addLine stores n passing units of line at minute, one second apart.
+func (f *fakeSFC) addLine(minute time.Time, line string, n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := 0; i < n; i++ {
+		f.minutes[minute.Unix()] = append(f.minutes[minute.Unix()], sfc_api.RecordDataCollector{
+			SerialNumber:  fmt.Sprintf("PPID%s%s%02d", line, minute.Format("1504"), i),
+			LineName:      "LINE " + line,
+			GroupName:     "PACKING",
+			StationName:   "PACK01",
+			ModelName:     "MODELX",
+			MoNumber:      "MO1",
+			EmpNo:         "E1",
+			ErrorFlag:     "0",
+			InStationTime: minute.Add(time.Duration(i) * time.Second).Format(timeutil.DBLayout),
+		})
+	}
+}
+
+// drop removes the last record of minute, as when SFC corrects its data after the fact.
+func (f *fakeSFC) drop(minute time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if recs := f.minutes[minute.Unix()]; len(recs) > 0 {
+		f.minutes[minute.Unix()] = recs[:len(recs)-1]
+	}
+}
+
+// failUnit turns record i of minute into a failure, a correction that keeps the count.
+func (f *fakeSFC) failUnit(minute time.Time, i int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.minutes[minute.Unix()][i].ErrorFlag = "1"
+}
+
+func (f *fakeSFC) fail(minute time.Time, failing bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failing[minute.Unix()] = failing
+}
+
+func (f *fakeSFC) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/api/getPPIDRecords" {
+		http.NotFound(w, r)
+		return
+	}
+	q := r.URL.Query()
+	day, err := time.ParseInLocation("02-Jan-2006", q.Get("date"), time.Local)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	hour, _ := strconv.Atoi(q.Get("hour"))
+	start := day.Add(time.Duration(hour) * time.Hour)
+	end := start.Add(time.Hour)
+	if m := q.Get("minute"); m != "" {
+		minute, _ := strconv.Atoi(m)
+		start = start.Add(time.Duration(minute) * time.Minute)
+		end = start.Add(time.Minute)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if q.Get("minute") == "" {
+		f.hours++
+	}
+	out := []sfc_api.RecordDataCollector{}
+	for t := start; t.Before(end); t = t.Add(time.Minute) {
+		if f.failing[t.Unix()] {
+			http.Error(w, "upstream unavailable", http.StatusInternalServerError)
+			return
+		}
+		out = append(out, f.minutes[t.Unix()]...)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// publishRecorder records the topics and last payload published by the manager.
+type publishRecorder struct {
+	mu     sync.Mutex
+	topics []string
+	last   map[string]any
+}
+
+func (p *publishRecorder) Publish(topic string, v any) error {
+	if err := validateTopic(topic); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.topics = append(p.topics, topic)
+	if p.last == nil {
+		p.last = map[string]any{}
+	}
+	p.last[topic] = v
+	return nil
+}
+
+func (p *publishRecorder) published(topic string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, t := range p.topics {
+		if t == topic {
+			return true
+		}
+	}
+	return false
+}
+
+// resetState empties the fake API, the data tables and the failed-minute status file.
+func resetState(t *testing.T) {
+	t.Helper()
+	fake.reset()
+	for _, table := range []string{"records_table", "latest_pass", "latest_group", "ingest_ledger", "line_maintenance",
+		"line_station", "work_order_meta", "maintenance_window", "audit_log", "ingest_claim", "export_state",
+		"record_rollup", "record_archive"} {
+		if _, err := db.GetDB().Exec("DELETE FROM " + table); err != nil {
+			t.Fatalf("clear %s: %v", table, err)
+		}
+	}
+	if err := os.RemoveAll(statusDir); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newTestManager(t *testing.T) (*SFCAPIManager, *publishRecorder) {
+	t.Helper()
+	ctx := context.Background()
+	m := NewSFCAPIManager(&ctx)
+	if m == nil {
+		t.Fatal("NewSFCAPIManager returned nil")
+	}
+	rec := &publishRecorder{}
+	m.SetPublisher(rec)
+	return m, rec
+}
+
+// storedIDs returns the sorted record IDs stored in r.
+func storedIDs(t *testing.T, r timeutil.TimeRange) []string {
+	t.Helper()
+	var ids []string
+	err := entities.NewRecordManagerEntity(db.GetDB()).ForEachIn(context.Background(), r, func(rec entities.RecordEntity) error {
+		ids = append(ids, rec.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func ledgerEntry(t *testing.T, minute time.Time) entities.IngestLedgerEntry {
+	t.Helper()
+	entries, err := entities.NewIngestLedgerManager(db.GetDB()).Range(minute, minute.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("ledger entries for %s = %d, want 1", minute.Format(timeutil.MinuteLayout), len(entries))
+	}
+	return entries[0]
+}
@@ -0,0 +1,203 @@
+package managers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"hex_toolset/pkg/db/entities"
+	skylogger "hex_toolset/pkg/logger"
+	"hex_toolset/pkg/timeutil"
+)
+
+// Alert keys of the integrity check.
+const (
+	AlertDBCorruption    = "db_corruption"
+	AlertDBSchemaMissing = "db_schema_missing"
+	integrityAlertSource = "db_integrity"
+)
+
+// IntegrityReport is the outcome of one integrity check of the database.
+type IntegrityReport struct {
+	CheckedAt string  `json:"checked_at"` // 'YYYY-MM-DD HH:MM:SS' local
+	Full      bool    `json:"full"`       // integrity_check rather than quick_check
+	Seconds   float64 `json:"seconds"`
+	// Problems are the corruptions reported by SQLite, including a malformed-file error that
+	// stopped the check; Missing are the schema's indexes and triggers absent from the database.
+	Problems []string `json:"problems,omitempty"`
+	Missing  []string `json:"missing,omitempty"`
+	OK       bool     `json:"ok"`
+}
+
+// IntegrityChecker verifies the database file with SQLite's integrity pragmas and checks
+// that every index and trigger the schema creates is present: a dropped trigger silently
+// stops latest_pass/latest_group updates, and a corrupt page otherwise only shows when a
+// query happens to read it. Findings raise critical (corruption) and warning (missing
+// objects) alerts, resolved by the next clean check.
+type IntegrityChecker struct {
+	db     *sql.DB
+	alerts *AlertManager
+	logger *skylogger.Logger
+	now    func() time.Time
+
+	mu       sync.Mutex // one check at a time
+	expected []entities.SchemaObject
+	last     *IntegrityReport
+}
+
+// NewIntegrityChecker creates a checker of database reporting to alerts (nil to only log).
+func NewIntegrityChecker(database *sql.DB, alerts *AlertManager, lgr *skylogger.Logger) *IntegrityChecker {
+	return &IntegrityChecker{db: database, alerts: alerts, logger: lgr, now: time.Now}
+}
+
+// Schedule runs a check daily at hour:minute, a full one on fullDay and quick ones on the
+// other days; pick an idle hour, as the check reads the whole file.
+func (c *IntegrityChecker) Schedule(lm *LoopsManager, hour, minute int, fullDay *time.Weekday) {
+	lm.StartDailyAt(hour, minute, 0, func(ctx context.Context) {
+		full := fullDay != nil && c.now().Weekday() == *fullDay
+		if _, err := c.Check(ctx, full); err != nil && c.logger != nil {
+			c.logger.Errorf("integrity check: %v", err)
+		}
+	})
+}
+
+// Check runs quick_check, or integrity_check when full, compares the indexes and triggers
+// with the schema, and raises or resolves the alerts. The error is a failure to run the
+// check; one caused by corruption is also reported as a problem.
+func (c *IntegrityChecker) Check(ctx context.Context, full bool) (IntegrityReport, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	start := c.now()
+	rep := IntegrityReport{CheckedAt: timeutil.FormatLocal(start), Full: full}
+
+	problems, checkErr := entities.IntegrityCheck(ctx, c.db, full)
+	if checkErr != nil && isCorruption(checkErr) {
+		problems = append(problems, checkErr.Error())
+	}
+	rep.Problems = problems
+
+	missing, err := c.missingObjects(ctx)
+	if err != nil && checkErr == nil {
+		checkErr = err
+	}
+	for _, o := range missing {
+		rep.Missing = append(rep.Missing, o.String())
+	}
+	rep.Seconds = c.now().Sub(start).Seconds()
+	rep.OK = checkErr == nil && len(rep.Problems) == 0 && len(rep.Missing) == 0
+
+	c.report(rep, checkErr)
+	c.last = &rep
+	return rep, checkErr
+}
+
+// Last returns the report of the latest check, nil before the first.
+func (c *IntegrityChecker) Last() *IntegrityReport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.last
+}
+
+// missingObjects returns the expected indexes and triggers absent from the database.
+func (c *IntegrityChecker) missingObjects(ctx context.Context) ([]entities.SchemaObject, error) {
+	if c.expected == nil {
+		expected, err := schemaObjects(ctx)
+		if err != nil {
+			return nil, err
+		}
+		c.expected = expected
+	}
+	present, err := entities.ListSchemaObjects(ctx, c.db)
+	if err != nil {
+		return nil, err
+	}
+	have := make(map[entities.SchemaObject]bool, len(present))
+	for _, o := range present {
+		have[o] = true
+	}
+	var missing []entities.SchemaObject
+	for _, o := range c.expected {
+		if !have[o] {
+			missing = append(missing, o)
+		}
+	}
+	return missing, nil
+}
+
+// schemaObjects lists the indexes and triggers entities.Schema creates, by applying it to
+// a scratch in-memory database. Optional triggers (pass history mode) are not part of it.
+func schemaObjects(ctx context.Context) ([]entities.SchemaObject, error) {
+	scratch, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		return nil, fmt.Errorf("open scratch database: %w", err)
+	}
+	defer scratch.Close()
+	scratch.SetMaxOpenConns(1) // every connection is a new in-memory database
+	if _, err := entities.EnsureSchema(scratch); err != nil {
+		return nil, fmt.Errorf("schema of scratch database: %w", err)
+	}
+	return entities.ListSchemaObjects(ctx, scratch)
+}
+
+func (c *IntegrityChecker) report(rep IntegrityReport, checkErr error) {
+	kind := "quick_check"
+	if rep.Full {
+		kind = "integrity_check"
+	}
+	switch {
+	case len(rep.Problems) > 0:
+		msg := fmt.Sprintf("database %s found %d problem(s): %s", kind, len(rep.Problems), strings.Join(rep.Problems, "; "))
+		c.alert(AlertDBCorruption, SeverityCritical, msg)
+	case checkErr == nil:
+		c.resolve(AlertDBCorruption, fmt.Sprintf("database %s ok", kind))
+	}
+	if len(rep.Missing) > 0 {
+		c.alert(AlertDBSchemaMissing, SeverityWarning, "database schema objects missing: "+strings.Join(rep.Missing, ", "))
+	} else if checkErr == nil {
+		c.resolve(AlertDBSchemaMissing, "database schema objects present")
+	}
+	if checkErr != nil && c.logger != nil {
+		c.logger.Errorf("%s failed: %v", kind, checkErr)
+	} else if rep.OK && c.logger != nil {
+		c.logger.Infow(kind+" ok", "seconds", rep.Seconds)
+	}
+}
+
+func (c *IntegrityChecker) alert(key, severity, msg string) {
+	if c.alerts != nil {
+		c.alerts.Raise(key, severity, integrityAlertSource, msg)
+	} else if c.logger != nil {
+		c.logger.Errorf("%s", msg)
+	}
+}
+
+func (c *IntegrityChecker) resolve(key, msg string) {
+	if c.alerts != nil {
+		c.alerts.Resolve(key, msg)
+	}
+}
+
+// ParseWeekday parses a weekday name ("sunday", "Sun", case-insensitive); "" gives nil.
+func ParseWeekday(s string) (*time.Weekday, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return nil, nil
+	}
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		name := strings.ToLower(d.String())
+		if s == name || s == name[:3] {
+			return &d, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid weekday %q", s)
+}
+
+// isCorruption reports whether err is SQLite refusing to read a malformed file
+// (SQLITE_CORRUPT / SQLITE_NOTADB), which a check may hit before it can list problems.
+func isCorruption(err error) bool {
+	s := err.Error()
+	return strings.Contains(s, "malformed") || strings.Contains(s, "not a database")
+}
@@ -0,0 +1,71 @@
+package managers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"hex_toolset/pkg/buildinfo"
+	"hex_toolset/pkg/db"
+	"hex_toolset/pkg/db/entities"
+)
+
+func TestIntegrationIntegrityCheck(t *testing.T) {
+	ctx := context.Background()
+	rec := &publishRecorder{}
+	checker := NewIntegrityChecker(db.GetDB(), NewAlertManager(rec, nil), nil)
+	if rep, err := checker.Check(ctx, false); err != nil || !rep.OK || rep.Full {
+		t.Fatalf("quick check of a sound database: %+v, %v", rep, err)
+	}
+
+	// A dropped trigger is reported as missing and alerted on...
+	triggers := entities.NewTriggersManager(db.GetDB())
+	t.Cleanup(func() { _ = triggers.CreateRecordsGroupUpsertTrigger() })
+	if _, err := db.GetDB().Exec(`DROP TRIGGER trg_records_group_upsert`); err != nil {
+		t.Fatal(err)
+	}
+	rep, err := checker.Check(ctx, false)
+	if err != nil || rep.OK || len(rep.Problems) != 0 ||
+		!reflect.DeepEqual(rep.Missing, []string{"trigger trg_records_group_upsert on records_table"}) {
+		t.Fatalf("check without the trigger: %+v, %v", rep, err)
+	}
+	al, ok := rec.last[TopicAlert].(Alert)
+	if !ok || al.Key != AlertDBSchemaMissing || !al.Active || al.Severity != SeverityWarning {
+		t.Fatalf("alert = %+v", rec.last[TopicAlert])
+	}
+
+	// ...and resolved by the next clean check.
+	if err := triggers.CreateRecordsGroupUpsertTrigger(); err != nil {
+		t.Fatal(err)
+	}
+	if rep, err := checker.Check(ctx, true); err != nil || !rep.OK || !rep.Full {
+		t.Fatalf("full check after repair: %+v, %v", rep, err)
+	}
+	if al := rec.last[TopicAlert].(Alert); al.Key != AlertDBSchemaMissing || al.Active {
+		t.Fatalf("alert after repair = %+v", al)
+	}
+
+	admin := NewAdminServer("127.0.0.1:0", nil)
+	admin.HandleIntegrity(checker)
+	w := httptest.NewRecorder()
+	admin.server.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/integrity", nil))
+	var got IntegrityReport
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || w.Code != http.StatusOK || !got.OK || !got.Full {
+		t.Fatalf("GET /admin/integrity = %d %s", w.Code, w.Body)
+	}
+	w = httptest.NewRecorder()
+	admin.server.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/integrity?full=maybe", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("POST with an invalid full = %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	admin.server.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/version", nil))
+	var build buildinfo.Info
+	if err := json.Unmarshal(w.Body.Bytes(), &build); err != nil || build != buildinfo.Get() {
+		t.Fatalf("GET /version = %d %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,195 @@
+package managers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"hex_toolset/pkg/db/entities"
+	skylogger "hex_toolset/pkg/logger"
+	"hex_toolset/pkg/timeutil"
+	ws "hex_toolset/pkg/websocket"
+)
+
+// Views of the LATEST snapshot, chosen by websocket clients with ?snapshot=.
+const (
+	SnapshotRecords = "records" // every unit in process with the counts (default)
+	SnapshotGroups  = "groups"  // unit counts per LINE_GROUP only
+	SnapshotLines   = "lines"   // unit counts per line only
+)
+
+// LatestSnapshot is the LATEST payload: the units in process with their latest pass, from
+// latest_group, and their counts per LINE_GROUP and per line. The groups and lines views
+// carry only their counts.
+type LatestSnapshot struct {
+	GeneratedAt string                 `json:"generated_at"` // 'YYYY-MM-DD HH:MM:SS' local
+	View        string                 `json:"view"`
+	Units       []entities.LatestGroup `json:"units,omitempty"` // collected_timestamp local
+	Groups      map[string]int         `json:"groups,omitempty"`
+	Lines       map[string]int         `json:"lines,omitempty"`
+}
+
+// LatestSnapshotViews renders the groups and lines views of LATEST in the broadcast hub.
+func LatestSnapshotViews() ws.SnapshotViews {
+	return ws.SnapshotViews{
+		Topic:  TopicLatest,
+		Views:  []string{SnapshotRecords, SnapshotGroups, SnapshotLines},
+		Render: renderLatestView,
+	}
+}
+
+// renderLatestView reduces a LATEST envelope to view. The units are not decoded.
+func renderLatestView(msg []byte, view string) ([]byte, error) {
+	var env struct {
+		MassageType string            `json:"massage_type"`
+		Meta        map[string]string `json:"meta,omitempty"`
+		Massage     struct {
+			GeneratedAt string          `json:"generated_at"`
+			Units       json.RawMessage `json:"units"`
+			Groups      map[string]int  `json:"groups"`
+			Lines       map[string]int  `json:"lines"`
+		} `json:"massage"`
+	}
+	if err := json.Unmarshal(msg, &env); err != nil {
+		return nil, err
+	}
+	snap := LatestSnapshot{GeneratedAt: env.Massage.GeneratedAt, View: view}
+	switch view {
+	case SnapshotGroups:
+		snap.Groups = env.Massage.Groups
+	case SnapshotLines:
+		snap.Lines = env.Massage.Lines
+	default:
+		return nil, fmt.Errorf("unknown view %q", view)
+	}
+	out := NewEnvelope(env.MassageType, snap)
+	out.Meta = env.Meta
+	return json.Marshal(out)
+}
+
+// BuildLatestSnapshot reads the units in process, leaving out the lines in disabled.
+func BuildLatestSnapshot(ctx context.Context, database *sql.DB, disabled map[string]bool, now time.Time) (LatestSnapshot, error) {
+	snap, _, err := buildLatestSnapshot(ctx, entities.NewLatestGroupManager(database), disabled, now)
+	return snap, err
+}
+
+// buildLatestSnapshot also returns the WIPVersion of latest_group the snapshot was read at.
+func buildLatestSnapshot(ctx context.Context, groups *entities.LatestGroupManager, disabled map[string]bool, now time.Time) (LatestSnapshot, string, error) {
+	wip, err := groups.SnapshotUnits(ctx, "", "")
+	if err != nil {
+		return LatestSnapshot{}, "", fmt.Errorf("list wip: %w", err)
+	}
+	snap := LatestSnapshot{GeneratedAt: timeutil.FormatLocal(now), View: SnapshotRecords,
+		Units: wip.Units[:0], Groups: map[string]int{}, Lines: map[string]int{}}
+	for _, u := range wip.Units {
+		if disabled[u.LineName] {
+			continue
+		}
+		u.CollectedTimestamp = timeutil.LocalDB(u.CollectedTimestamp)
+		snap.Units = append(snap.Units, u)
+		snap.Groups[u.LineName+"_"+u.GroupName]++
+		snap.Lines[u.LineName]++
+	}
+	return snap, wip.Version, nil
+}
+
+// SplitLatestSnapshot returns the part of a records view snapshot of each line: the units
+// of the line with their counts.
+func SplitLatestSnapshot(snap LatestSnapshot) map[string]LatestSnapshot {
+	out := map[string]LatestSnapshot{}
+	for line, n := range snap.Lines {
+		out[line] = LatestSnapshot{GeneratedAt: snap.GeneratedAt, View: snap.View,
+			Units: []entities.LatestGroup{}, Groups: map[string]int{}, Lines: map[string]int{line: n}}
+	}
+	for _, u := range snap.Units {
+		part := out[u.LineName]
+		part.Units = append(part.Units, u)
+		part.Groups[u.LineName+"_"+u.GroupName]++
+		out[u.LineName] = part
+	}
+	return out
+}
+
+// LatestPublisher publishes the LATEST snapshot after live minutes, at most every interval
+// and only when the WIP changed, as the full units list is large.
+type LatestPublisher struct {
+	groups   *entities.LatestGroupManager
+	interval time.Duration
+	logger   *skylogger.Logger
+	perLine  bool
+
+	sentAt  time.Time
+	version string
+	lines   map[string]bool // lines of the last per-line snapshots
+}
+
+// NewLatestPublisher creates a LATEST publisher of database.
+func NewLatestPublisher(database *sql.DB, interval time.Duration, lgr *skylogger.Logger) *LatestPublisher {
+	return &LatestPublisher{groups: entities.NewLatestGroupManager(database), interval: interval, logger: lgr}
+}
+
+// SetPerLine also publishes each line's part of LATEST as LatestLineTopic(line); call it
+// before Attach.
+func (p *LatestPublisher) SetPerLine(enabled bool) { p.perLine = enabled }
+
+// Attach publishes LATEST through m after the live minutes it stores.
+func (p *LatestPublisher) Attach(m *SFCAPIManager) {
+	m.OnMinuteLoaded(func(ev MinuteLoaded) {
+		if ev.Source != entities.IngestSourceLive || ev.Minute.Sub(p.sentAt) < p.interval {
+			return
+		}
+		if err := p.publish(m, ev.Minute); err != nil {
+			p.logger.Warnf("latest snapshot: %v", err)
+		}
+	})
+}
+
+func (p *LatestPublisher) publish(m *SFCAPIManager, minute time.Time) error {
+	version, err := p.groups.WIPVersion(m.ctx)
+	if err != nil {
+		return err
+	}
+	if version == p.version {
+		return nil
+	}
+	// the version the units were read at, which may be newer than the one checked above
+	snap, version, err := buildLatestSnapshot(m.ctx, p.groups, m.lines.Disabled(), m.clock.Now())
+	if err != nil {
+		return err
+	}
+	if err := m.publisher.Publish(TopicLatest, snap); err != nil {
+		return err
+	}
+	p.sentAt, p.version = minute, version
+	if p.perLine {
+		return p.publishLines(m, snap)
+	}
+	return nil
+}
+
+// publishLines publishes the part of snap of each line, and an empty one for the lines
+// that had units in the last snapshot and have none now.
+func (p *LatestPublisher) publishLines(m *SFCAPIManager, snap LatestSnapshot) error {
+	parts := SplitLatestSnapshot(snap)
+	for line := range p.lines {
+		if _, ok := parts[line]; !ok {
+			parts[line] = LatestSnapshot{GeneratedAt: snap.GeneratedAt, View: snap.View,
+				Units: []entities.LatestGroup{}, Groups: map[string]int{}, Lines: map[string]int{line: 0}}
+		}
+	}
+	var errs []error
+	lines := map[string]bool{}
+	for line, part := range parts {
+		if err := m.publisher.Publish(LatestLineTopic(line), part); err != nil {
+			errs = append(errs, err)
+		}
+		if len(part.Units) > 0 {
+			lines[line] = true
+		}
+	}
+	p.lines = lines
+	return errors.Join(errs...)
+}
@@ -0,0 +1,107 @@
+package managers
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"hex_toolset/pkg/db"
+	"hex_toolset/pkg/sfc_api"
+	"hex_toolset/pkg/timeutil"
+)
+
+func TestIntegrationLatestSnapshot(t *testing.T) {
+	resetState(t)
+	m, rec := newTestManager(t)
+	NewLatestPublisher(db.GetDB(), 5*time.Minute, nil).Attach(m)
+	count := func() (n int) {
+		for _, topic := range rec.topics {
+			if topic == TopicLatest {
+				n++
+			}
+		}
+		return n
+	}
+
+	now := time.Now().Truncate(time.Minute)
+	fake.addLine(now, "J01", 2)
+	fake.addLine(now, "J02", 1)
+	m.RequestMinute(now)
+	snap, ok := rec.last[TopicLatest].(LatestSnapshot)
+	if !ok || snap.View != SnapshotRecords || len(snap.Units) != 3 ||
+		!reflect.DeepEqual(snap.Groups, map[string]int{"J01_PACKING": 2, "J02_PACKING": 1}) ||
+		!reflect.DeepEqual(snap.Lines, map[string]int{"J01": 2, "J02": 1}) {
+		t.Fatalf("LATEST = %+v", rec.last[TopicLatest])
+	}
+
+	// Within the interval nothing is published, even though the WIP changed.
+	fake.addLine(now.Add(time.Minute), "J01", 1)
+	m.RequestMinute(now.Add(time.Minute))
+	if n := count(); n != 1 {
+		t.Fatalf("LATEST published %d times, want 1", n)
+	}
+
+	// The lines view keeps only the counts per line.
+	msg, err := json.Marshal(NewEnvelope(TopicLatest, snap))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := LatestSnapshotViews().Render(msg, SnapshotLines)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var env struct {
+		MassageType string          `json:"massage_type"`
+		Massage     json.RawMessage `json:"massage"`
+	}
+	if err := json.Unmarshal(b, &env); err != nil || env.MassageType != TopicLatest ||
+		string(env.Massage) != `{"generated_at":"`+snap.GeneratedAt+`","view":"lines","lines":{"J01":2,"J02":1}}` {
+		t.Fatalf("lines view = %s (%v)", b, err)
+	}
+}
+
+func TestIntegrationLatestLineSnapshots(t *testing.T) {
+	resetState(t)
+	m, rec := newTestManager(t)
+	p := NewLatestPublisher(db.GetDB(), 0, nil)
+	p.SetPerLine(true)
+	p.Attach(m)
+
+	now := time.Now().Truncate(time.Minute)
+	fake.addLine(now, "J01", 2)
+	fake.addLine(now, "J02", 1)
+	m.RequestMinute(now)
+	j01, ok := rec.last[LatestLineTopic("J01")].(LatestSnapshot)
+	if !ok || len(j01.Units) != 2 || !reflect.DeepEqual(j01.Groups, map[string]int{"J01_PACKING": 2}) ||
+		!reflect.DeepEqual(j01.Lines, map[string]int{"J01": 2}) {
+		t.Fatalf("LATEST_J01 = %+v", rec.last[LatestLineTopic("J01")])
+	}
+	if j02, ok := rec.last[LatestLineTopic("J02")].(LatestSnapshot); !ok || len(j02.Units) != 1 || j02.Units[0].LineName != "J02" {
+		t.Fatalf("LATEST_J02 = %+v", rec.last[LatestLineTopic("J02")])
+	}
+
+	// J02's unit leaves the WIP: its display gets an empty snapshot, once.
+	next := now.Add(time.Minute)
+	fake.mu.Lock()
+	fake.minutes[next.Unix()] = append(fake.minutes[next.Unix()], sfc_api.RecordDataCollector{
+		SerialNumber: "PPIDJ02" + now.Format("1504") + "00", LineName: "LINE J02", GroupName: "IN_STORE", StationName: "STORE01",
+		ModelName: "MODELX", MoNumber: "MO1", EmpNo: "E1", ErrorFlag: "0", InStationTime: next.Format(timeutil.DBLayout),
+	})
+	fake.mu.Unlock()
+	m.RequestMinute(next)
+	if j02 := rec.last[LatestLineTopic("J02")].(LatestSnapshot); len(j02.Units) != 0 || j02.Lines["J02"] != 0 {
+		t.Fatalf("emptied LATEST_J02 = %+v", j02)
+	}
+	fake.addLine(next.Add(time.Minute), "J01", 1)
+	m.RequestMinute(next.Add(time.Minute))
+	var j02s int
+	for _, topic := range rec.topics {
+		if topic == LatestLineTopic("J02") {
+			j02s++
+		}
+	}
+	if j02s != 2 {
+		t.Fatalf("LATEST_J02 published %d times, want 2", j02s)
+	}
+}
@@ -0,0 +1,224 @@
+package managers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"hex_toolset/pkg/bus"
+	"hex_toolset/pkg/db/entities"
+	skylogger "hex_toolset/pkg/logger"
+)
+
+// LineMaintenanceChanged is the LINE_MAINTENANCE payload: every line currently disabled.
+type LineMaintenanceChanged struct {
+	Disabled []entities.LineMaintenance `json:"disabled"`
+}
+
+// LineMaintenance is a cached view of the line_maintenance table. Records of a disabled
+// line are dropped before they are stored and its keys are left out of the live
+// broadcasts, so test runs on a line under maintenance never reach production figures.
+// Like FeatureFlags the table is re-read at most once per ttl, which also picks up
+// changes made from another process.
+type LineMaintenance struct {
+	entity   *entities.LineMaintenanceManager
+	disabled *tableCache[map[string]entities.LineMaintenance]
+	logger   *skylogger.Logger
+
+	mu        sync.Mutex
+	publisher Publisher
+	bus       *bus.Bus
+}
+
+// NewLineMaintenance creates a line maintenance cache on database. pub may be nil.
+func NewLineMaintenance(database *sql.DB, ttl time.Duration, pub Publisher, lgr *skylogger.Logger) *LineMaintenance {
+	l := &LineMaintenance{
+		entity:    entities.NewLineMaintenanceManager(database),
+		publisher: pub,
+		logger:    lgr,
+	}
+	l.disabled = newTableCache(ttl, l.load, l.changed)
+	return l
+}
+
+// SetPublisher replaces the publisher used for LINE_MAINTENANCE messages.
+func (l *LineMaintenance) SetPublisher(p Publisher) {
+	l.mu.Lock()
+	l.publisher = p
+	l.mu.Unlock()
+}
+
+// SetBus makes changes of the disabled lines publish ConfigChanged on b.
+func (l *LineMaintenance) SetBus(b *bus.Bus) {
+	l.mu.Lock()
+	l.bus = b
+	l.mu.Unlock()
+}
+
+// normalizeLine matches the line codes stored in records_table (e.g. "j06 " -> "J06").
+func normalizeLine(line string) string {
+	return strings.ToUpper(strings.TrimSpace(line))
+}
+
+// Disabled returns the set of disabled lines. When the table cannot be read the last
+// known set is kept, so a DB hiccup never re-enables a line under maintenance.
+func (l *LineMaintenance) Disabled() map[string]bool {
+	if l == nil {
+		return nil
+	}
+	disabled, err := l.disabled.get(context.Background())
+	if err != nil && l.logger != nil {
+		l.logger.Warnf("line maintenance: %v", err)
+	}
+	out := make(map[string]bool, len(disabled))
+	for name := range disabled {
+		out[name] = true
+	}
+	return out
+}
+
+// Refresh reloads the disabled lines and publishes them if the set changed.
+func (l *LineMaintenance) Refresh(ctx context.Context) error {
+	return l.disabled.refresh(ctx)
+}
+
+// load reads the disabled lines by name.
+func (l *LineMaintenance) load(ctx context.Context) (map[string]entities.LineMaintenance, error) {
+	stored, err := l.entity.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	next := make(map[string]entities.LineMaintenance, len(stored))
+	for _, s := range stored {
+		next[s.LineName] = s
+	}
+	return next, nil
+}
+
+// changed logs and publishes the disabled lines when the set differs between prev and next.
+func (l *LineMaintenance) changed(prev, next map[string]entities.LineMaintenance) {
+	changed := len(next) != len(prev)
+	for name := range next {
+		if _, ok := prev[name]; !ok {
+			changed = true
+		}
+	}
+	if !changed {
+		return
+	}
+	stored := sortedMaintenance(next)
+	names := make([]string, 0, len(stored))
+	for _, s := range stored {
+		names = append(names, s.LineName)
+	}
+	l.mu.Lock()
+	pub, b := l.publisher, l.bus
+	l.mu.Unlock()
+	if l.logger != nil {
+		l.logger.Warnf("lines disabled for maintenance: %v", names)
+	}
+	bus.Publish(b, bus.ConfigChanged{Source: bus.ConfigLineMaintenance, Changed: names})
+	if pub != nil {
+		if err := pub.Publish(TopicLineMaintenance, LineMaintenanceChanged{Disabled: stored}); err != nil && l.logger != nil {
+			l.logger.Errorf("%v", err)
+		}
+	}
+}
+
+// ensureLoaded loads the cache once, so the Refresh following a change sees the change
+// and publishes it.
+func (l *LineMaintenance) ensureLoaded(ctx context.Context) error {
+	_, err := l.disabled.get(ctx)
+	return err
+}
+
+// Disable stops ingestion and broadcasts of line and refreshes the cache.
+func (l *LineMaintenance) Disable(ctx context.Context, line, reason string) error {
+	line = normalizeLine(line)
+	if line == "" {
+		return fmt.Errorf("line is required")
+	}
+	if err := l.ensureLoaded(ctx); err != nil {
+		return err
+	}
+	if err := l.entity.Disable(ctx, line, strings.TrimSpace(reason)); err != nil {
+		return err
+	}
+	return l.Refresh(ctx)
+}
+
+// Enable resumes ingestion of line and refreshes the cache; ok is false when the line
+// was not disabled. Minutes skipped meanwhile are not refetched; reload them with
+// LoadHour if the line's data for that period is wanted after all.
+func (l *LineMaintenance) Enable(ctx context.Context, line string) (ok bool, err error) {
+	if err := l.ensureLoaded(ctx); err != nil {
+		return false, err
+	}
+	if ok, err = l.entity.Enable(ctx, normalizeLine(line)); err != nil {
+		return false, err
+	}
+	return ok, l.Refresh(ctx)
+}
+
+// List returns the disabled lines from the database, refreshing the cache.
+func (l *LineMaintenance) List(ctx context.Context) ([]entities.LineMaintenance, error) {
+	if err := l.Refresh(ctx); err != nil {
+		return nil, err
+	}
+	return sortedMaintenance(l.disabled.current()), nil
+}
+
+func sortedMaintenance(m map[string]entities.LineMaintenance) []entities.LineMaintenance {
+	out := make([]entities.LineMaintenance, 0, len(m))
+	for _, s := range m {
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].LineName < out[j].LineName })
+	return out
+}
+
+// filterRecords drops the records of disabled lines, returning the kept records and the
+// number dropped. It must not be called inside a transaction: the cache may query the DB.
+func (l *LineMaintenance) filterRecords(recs []entities.RecordEntity) ([]entities.RecordEntity, int) {
+	disabled := l.Disabled()
+	if len(disabled) == 0 {
+		return recs, 0
+	}
+	kept := recs[:0:0]
+	for _, r := range recs {
+		if !disabled[normalizeLine(r.LineName)] {
+			kept = append(kept, r)
+		}
+	}
+	return kept, len(recs) - len(kept)
+}
+
+// disabledLines returns the disabled line names, sorted; reloads keep their stored records.
+func (l *LineMaintenance) disabledLines() []string {
+	disabled := l.Disabled()
+	out := make([]string, 0, len(disabled))
+	for name := range disabled {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// filterLineKeys removes the LINE_GROUP keys of disabled lines from a live broadcast map.
+func filterLineKeys[V any](disabled map[string]bool, m map[string]V) map[string]V {
+	if len(disabled) == 0 {
+		return m
+	}
+	out := make(map[string]V, len(m))
+	for k, v := range m {
+		line, _, _ := strings.Cut(k, "_")
+		if !disabled[line] {
+			out[k] = v
+		}
+	}
+	return out
+}
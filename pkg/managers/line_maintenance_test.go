@@ -0,0 +1,61 @@
+package managers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"hex_toolset/pkg/db/entities"
+	"hex_toolset/pkg/timeutil"
+)
+
+func TestIntegrationDisabledLineIsNotIngested(t *testing.T) {
+	resetState(t)
+	m, rec := newTestManager(t)
+	ctx := context.Background()
+	if err := m.Lines().Disable(ctx, "j02", "PM"); err != nil {
+		t.Fatal(err)
+	}
+	if !rec.published(TopicLineMaintenance) {
+		t.Fatalf("published %v, want LINE_MAINTENANCE", rec.topics)
+	}
+
+	// Live minute: only J01 is stored and broadcast.
+	now := time.Now().Truncate(time.Minute)
+	fake.addLine(now, "J01", 2)
+	fake.addLine(now, "J02", 3)
+	m.RequestMinute(now)
+	if got := storedIDs(t, timeutil.Minute(now)); len(got) != 2 {
+		t.Fatalf("stored %d records, want the 2 of J01", len(got))
+	}
+	hour, _ := rec.last[TopicLastHour].(map[string]int)
+	if hour["J01_PACKING"] != 2 || len(hour) != 1 {
+		t.Fatalf("LAST_HOUR = %v, want only J01_PACKING", hour)
+	}
+	if wip, _ := rec.last[TopicWIP].(map[string]int); wip["J01_PACKING"] != 2 || len(wip) != 1 {
+		t.Fatalf("WIP = %v, want only J01_PACKING", wip)
+	}
+
+	// A reload of the hour keeps what J02 had stored before it was disabled.
+	pre := base.Add(time.Minute)
+	if err := m.recordEntity.InsertBatch([]entities.RecordEntity{{PPID: "KEEP", LineName: "J02", GroupName: "PACKING",
+		StationName: "PACK01", CollectedTimestamp: pre}}); err != nil {
+		t.Fatal(err)
+	}
+	fake.addLine(base, "J01", 1)
+	fake.addLine(base, "J02", 1)
+	if err := m.LoadHour(base.Format(timeutil.HourLayout)); err != nil {
+		t.Fatalf("LoadHour: %v", err)
+	}
+	if got := storedIDs(t, timeutil.Hour(base)); len(got) != 2 {
+		t.Fatalf("stored %d records after reload, want J01's reloaded unit and J02's kept one", len(got))
+	}
+
+	if ok, err := m.Lines().Enable(ctx, "J02"); err != nil || !ok {
+		t.Fatalf("Enable = %v, %v", ok, err)
+	}
+	m.RequestMinute(now)
+	if got := storedIDs(t, timeutil.Minute(now)); len(got) != 5 {
+		t.Fatalf("stored %d records after re-enabling, want 5", len(got))
+	}
+}
@@ -2,8 +2,12 @@ package managers
 
 import (
 	"context"
+	"math/rand/v2"
 	"sync"
 	"time"
+
+	skylogger "hex_toolset/pkg/logger"
+	"hex_toolset/pkg/timeutil"
 )
 
 // LoopsManager runs aligned periodic tasks and supports graceful shutdown via context.
@@ -11,31 +15,108 @@ type LoopsManager struct {
 	ctx    context.Context
 	cancel context.CancelFunc
 	wg     sync.WaitGroup
+	clock  timeutil.Clock
+	randN  func(n int64) int64 // random in [0, n), for jitter
+}
+
+// JobOption shifts the runs of one job away from its aligned tick, so that instances at
+// several sites calling the same upstream API do not all hit it at hh:mm:02.
+type JobOption func(*jobTiming)
+
+// jobTiming delays each run by offset plus a random duration in [jitterMin, jitterMax].
+type jobTiming struct {
+	offset               time.Duration
+	jitterMin, jitterMax time.Duration
+}
+
+// WithPhaseOffset runs the job d after its aligned tick, e.g. 20s moves the minute loop
+// from hh:mm:02 to hh:mm:22. Negative values are ignored.
+func WithPhaseOffset(d time.Duration) JobOption {
+	return func(t *jobTiming) { t.offset = max(d, 0) }
+}
+
+// WithJitter delays each run by a random duration between lo and hi (inclusive), drawn
+// again for every run; it adds to WithPhaseOffset. The schedule stays aligned: jitter
+// never accumulates and the minute loop still processes the minute before its tick. Keep
+// offset plus hi well below the period, or runs fall behind and catch up.
+func WithJitter(lo, hi time.Duration) JobOption {
+	return func(t *jobTiming) {
+		lo, hi = max(lo, 0), max(hi, 0)
+		t.jitterMin, t.jitterMax = min(lo, hi), max(lo, hi)
+	}
+}
+
+func newJobTiming(opts []JobOption) jobTiming {
+	var t jobTiming
+	for _, o := range opts {
+		o(&t)
+	}
+	return t
+}
+
+// delay returns how long after its aligned tick the next run starts.
+func (lm *LoopsManager) delay(t jobTiming) time.Duration {
+	d := t.offset + t.jitterMin
+	if span := t.jitterMax - t.jitterMin; span > 0 {
+		d += time.Duration(lm.randN(int64(span) + 1))
+	}
+	return d
 }
 
-// NewLoopsManager creates a new loops manager bound to a parent context.
+// NewLoopsManager creates a new loops manager bound to a parent context, on the wall clock.
 func NewLoopsManager(parent context.Context) *LoopsManager {
+	return NewLoopsManagerWithClock(parent, timeutil.SystemClock)
+}
+
+// NewLoopsManagerWithClock creates a loops manager whose ticks are aligned to and paced by
+// clock: a FakeClock in tests, an OffsetClock to replay a past day.
+func NewLoopsManagerWithClock(parent context.Context, clock timeutil.Clock) *LoopsManager {
+	if clock == nil {
+		clock = timeutil.SystemClock
+	}
 	ctx, cancel := context.WithCancel(parent)
-	return &LoopsManager{ctx: ctx, cancel: cancel}
+	return &LoopsManager{ctx: ctx, cancel: cancel, clock: clock, randN: rand.Int64N}
 }
 
+// Clock returns the clock the loops run on, for tasks that reason about the current time.
+func (lm *LoopsManager) Clock() timeutil.Clock { return lm.clock }
+
 // Stop cancels all loops and waits for them to finish.
 func (lm *LoopsManager) Stop() {
 	lm.cancel()
 	lm.wg.Wait()
 }
 
-// StartEveryMinute runs fn every minute, aligned to next exact minute + 2s,
-// and passes the minute being processed to fn (no overlap; catch-up if behind).
-func (lm *LoopsManager) StartEveryMinute(fn func(context.Context, time.Time)) {
-	start := nextMinutePlus(2 * time.Second)
+// StopWithin cancels all loops and waits for them until ctx is done. It returns ctx.Err()
+// if a loop is still running by then; that loop keeps stopping in the background, at its
+// next cancellation check (a record insert checks between chunks).
+func (lm *LoopsManager) StopWithin(ctx context.Context) error {
+	lm.cancel()
+	done := make(chan struct{})
+	go func() {
+		lm.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// StartEveryMinute runs fn every minute, aligned to next exact minute + 2s (shifted by
+// opts), and passes the minute being processed to fn (no overlap; catch-up if behind).
+func (lm *LoopsManager) StartEveryMinute(fn func(context.Context, time.Time), opts ...JobOption) {
+	start := nextMinutePlus(lm.clock.Now(), 2*time.Second)
+	timing := newJobTiming(opts)
 
 	lm.wg.Add(1)
 	go func() {
 		defer lm.wg.Done()
 
 		// wait for the first aligned tick
-		if !lm.waitUntil(start) {
+		if !lm.waitUntil(start.Add(lm.delay(timing))) {
 			return
 		}
 
@@ -48,45 +129,44 @@ func (lm *LoopsManager) StartEveryMinute(fn func(context.Context, time.Time)) {
 			default:
 			}
 
-			// The minute to process is the previous full minute boundary
-			// relative to the aligned tick time (next).
-			minuteToProcess := next.Add(-time.Minute).Truncate(time.Minute)
+			minuteToProcess := minuteBefore(next)
 
 			safeCall(func(ctx context.Context) {
 				fn(ctx, minuteToProcess)
-			}, lm.ctx)
+			}, jobContext(lm.ctx, "minute", minuteToProcess))
 
 			// advance schedule and keep alignment (catch-up if behind)
 			next = next.Add(time.Minute)
-			if !lm.waitUntil(next) {
+			if !lm.waitUntil(next.Add(lm.delay(timing))) {
 				return
 			}
 		}
 	}()
 }
 
-// StartEveryHour runs fn every hour exactly at hh:00:02 (e.g., 01:00:02, 14:00:02).
-func (lm *LoopsManager) StartEveryHour(fn func(context.Context)) {
-	start := nextHourAtSecond(2)
-	lm.startAlignedPeriodic(fn, start, time.Hour)
+// StartEveryHour runs fn every hour exactly at hh:00:02 (e.g., 01:00:02, 14:00:02), shifted
+// by opts.
+func (lm *LoopsManager) StartEveryHour(fn func(context.Context), opts ...JobOption) {
+	start := nextHourAtSecond(lm.clock.Now(), 2)
+	lm.startAlignedPeriodic("hourly", fn, start, time.Hour, newJobTiming(opts))
 }
 
 // StartDailyAt runs fn every 24h at the given local time-of-day (hour:min:sec).
-// Example: StartDailyAt(17, 0, 0, fn) to run daily at 17:00:00.
-func (lm *LoopsManager) StartDailyAt(hour, min, sec int, fn func(context.Context)) {
-	start := nextDailyAt(hour, min, sec, time.Local)
-	lm.startAlignedPeriodic(fn, start, 24*time.Hour)
+// Example: StartDailyAt(17, 0, 0, fn) to run daily at 17:00:00. opts shift the runs.
+func (lm *LoopsManager) StartDailyAt(hour, min, sec int, fn func(context.Context), opts ...JobOption) {
+	start := nextDailyAt(lm.clock.Now(), hour, min, sec, time.Local)
+	lm.startAlignedPeriodic("daily", fn, start, 24*time.Hour, newJobTiming(opts))
 }
 
-// Internal runner: waits until start, runs fn, then repeats every period.
-// It maintains alignment by computing the next run from the last scheduled time.
-func (lm *LoopsManager) startAlignedPeriodic(fn func(context.Context), start time.Time, period time.Duration) {
+// Internal runner: waits until start, runs fn, then repeats every period, each run delayed
+// by timing. It maintains alignment by computing the next run from the last scheduled time.
+func (lm *LoopsManager) startAlignedPeriodic(kind string, fn func(context.Context), start time.Time, period time.Duration, timing jobTiming) {
 	lm.wg.Add(1)
 	go func() {
 		defer lm.wg.Done()
 
 		// Initial wait until aligned start
-		if !lm.waitUntil(start) {
+		if !lm.waitUntil(start.Add(lm.delay(timing))) {
 			return
 		}
 
@@ -99,11 +179,11 @@ func (lm *LoopsManager) startAlignedPeriodic(fn func(context.Context), start tim
 			default:
 			}
 
-			safeCall(fn, lm.ctx)
+			safeCall(fn, jobContext(lm.ctx, kind, next))
 
 			// Schedule next run based on the aligned clock
 			next = next.Add(period)
-			if !lm.waitUntil(next) {
+			if !lm.waitUntil(next.Add(lm.delay(timing))) {
 				return
 			}
 		}
@@ -113,7 +193,7 @@ func (lm *LoopsManager) startAlignedPeriodic(fn func(context.Context), start tim
 // waitUntil sleeps until t or returns false if context is canceled.
 func (lm *LoopsManager) waitUntil(t time.Time) bool {
 	for {
-		d := time.Until(t)
+		d := t.Sub(lm.clock.Now())
 		if d <= 0 {
 			return true
 		}
@@ -125,15 +205,15 @@ func (lm *LoopsManager) waitUntil(t time.Time) bool {
 		select {
 		case <-lm.ctx.Done():
 			return false
-		case <-time.After(chunk):
+		case <-lm.clock.After(chunk):
 		}
 	}
 }
 
 // Helpers for alignment
 
-func nextMinutePlus(extra time.Duration) time.Time {
-	now := time.Now()
+// nextMinutePlus returns the next minute boundary after now, plus extra.
+func nextMinutePlus(now time.Time, extra time.Duration) time.Time {
 	t := now.Truncate(time.Minute).Add(time.Minute).Add(extra)
 	if !t.After(now) {
 		t = t.Add(time.Minute)
@@ -142,11 +222,10 @@ func nextMinutePlus(extra time.Duration) time.Time {
 }
 
 // nextHourAtSecond returns the next occurrence of the top-of-hour at :second.
-func nextHourAtSecond(second int) time.Time {
+func nextHourAtSecond(now time.Time, second int) time.Time {
 	if second < 0 || second > 59 {
 		second = 2
 	}
-	now := time.Now()
 	aligned := now.Truncate(time.Hour).Add(time.Hour).Add(time.Duration(second) * time.Second)
 	if !aligned.After(now) {
 		aligned = aligned.Add(time.Hour)
@@ -154,11 +233,12 @@ func nextHourAtSecond(second int) time.Time {
 	return aligned
 }
 
-func nextDailyAt(hour, min, sec int, loc *time.Location) time.Time {
+// nextDailyAt returns the next occurrence of hour:min:sec in loc after now.
+func nextDailyAt(now time.Time, hour, min, sec int, loc *time.Location) time.Time {
 	if loc == nil {
 		loc = time.Local
 	}
-	now := time.Now().In(loc)
+	now = now.In(loc)
 	t := time.Date(now.Year(), now.Month(), now.Day(), hour, min, sec, 0, loc)
 	if !t.After(now) {
 		t = t.Add(24 * time.Hour)
@@ -166,6 +246,17 @@ func nextDailyAt(hour, min, sec int, loc *time.Location) time.Time {
 	return t
 }
 
+// minuteBefore returns the previous full minute boundary relative to the aligned tick time.
+func minuteBefore(tick time.Time) time.Time {
+	return tick.Add(-time.Minute).Truncate(time.Minute)
+}
+
+// jobContext tags one run of a job for skylogger.FromContext, e.g. job_id=minute/2025-03-10T08:00
+// for the minute loop processing 08:00, so its lines can be told from the next run's.
+func jobContext(ctx context.Context, kind string, at time.Time) context.Context {
+	return skylogger.ContextWithFields(ctx, skylogger.JobIDKey, kind+"/"+at.Format("2006-01-02T15:04"))
+}
+
 // safeCall runs fn with recover protection.
 func safeCall(fn func(context.Context), ctx context.Context) {
 	defer func() { _ = recover() }()
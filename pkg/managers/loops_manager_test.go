@@ -0,0 +1,140 @@
+package managers
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+
+	"hex_toolset/pkg/timeutil"
+)
+
+func TestLoopAlignment(t *testing.T) {
+	at := func(d, h, mi, s int) time.Time { return time.Date(2025, 3, d, h, mi, s, 0, time.UTC) }
+
+	cases := []struct {
+		name      string
+		got, want time.Time
+	}{
+		{"minute", nextMinutePlus(at(10, 8, 0, 30), 2*time.Second), at(10, 8, 1, 2)},
+		{"minute across midnight", nextMinutePlus(at(10, 23, 59, 59), 2*time.Second), at(11, 0, 0, 2)},
+		{"hour", nextHourAtSecond(at(10, 8, 59, 59), 2), at(10, 9, 0, 2)},
+		{"hour on the tick", nextHourAtSecond(at(10, 9, 0, 2), 2), at(10, 10, 0, 2)},
+		{"daily later today", nextDailyAt(at(10, 16, 59, 0), 17, 0, 0, time.UTC), at(10, 17, 0, 0)},
+		{"daily on the tick", nextDailyAt(at(10, 17, 0, 0), 17, 0, 0, time.UTC), at(11, 17, 0, 0)},
+		{"previous minute", minuteBefore(at(11, 0, 0, 2)), at(10, 23, 59, 0)},
+	}
+	for _, c := range cases {
+		if !c.got.Equal(c.want) {
+			t.Errorf("%s: got %s, want %s", c.name, c.got, c.want)
+		}
+	}
+}
+
+func TestLoopsManagerEveryMinuteOnFakeClock(t *testing.T) {
+	clock := timeutil.NewFakeClock(time.Date(2025, 3, 10, 23, 58, 30, 0, time.UTC))
+	lm := NewLoopsManagerWithClock(context.Background(), clock)
+	defer lm.Stop()
+
+	minutes := make(chan time.Time, 8)
+	lm.StartEveryMinute(func(ctx context.Context, minute time.Time) { minutes <- minute })
+
+	// Step the clock a second at a time, once the loop is waiting on it.
+	var got []time.Time
+	for len(got) < 3 {
+		for clock.Waiters() == 0 {
+			runtime.Gosched()
+		}
+		clock.Advance(time.Second)
+		select {
+		case m := <-minutes:
+			got = append(got, m)
+		default:
+		}
+		if clock.Now().Sub(time.Date(2025, 3, 11, 0, 5, 0, 0, time.UTC)) > 0 {
+			t.Fatalf("only %d minute(s) processed by %s", len(got), clock.Now())
+		}
+	}
+	for i, want := range []time.Time{
+		time.Date(2025, 3, 10, 23, 58, 0, 0, time.UTC),
+		time.Date(2025, 3, 10, 23, 59, 0, 0, time.UTC),
+		time.Date(2025, 3, 11, 0, 0, 0, 0, time.UTC),
+	} {
+		if !got[i].Equal(want) {
+			t.Fatalf("minute %d = %s, want %s", i, got[i], want)
+		}
+	}
+}
+
+func TestLoopsManagerOffsetAndJitter(t *testing.T) {
+	clock := timeutil.NewFakeClock(time.Date(2025, 3, 10, 8, 0, 30, 0, time.UTC))
+	lm := NewLoopsManagerWithClock(context.Background(), clock)
+	defer lm.Stop()
+	// jitter draws its upper bound, then its lower one
+	draws := 0
+	lm.randN = func(n int64) int64 {
+		draws++
+		if draws%2 == 1 {
+			return n - 1
+		}
+		return 0
+	}
+
+	type run struct{ at, minute time.Time }
+	runs := make(chan run, 8)
+	lm.StartEveryMinute(func(ctx context.Context, minute time.Time) {
+		runs <- run{clock.Now(), minute}
+	}, WithPhaseOffset(20*time.Second), WithJitter(10*time.Second, 5*time.Second))
+
+	var got []run
+	for len(got) < 2 {
+		for clock.Waiters() == 0 {
+			runtime.Gosched()
+		}
+		clock.Advance(time.Second)
+		select {
+		case r := <-runs:
+			got = append(got, r)
+		default:
+		}
+		if clock.Now().After(time.Date(2025, 3, 10, 8, 5, 0, 0, time.UTC)) {
+			t.Fatalf("only %d run(s) by %s", len(got), clock.Now())
+		}
+	}
+	// 02s tick + 20s offset + 5..10s jitter; the processed minute stays the one before the tick
+	for i, want := range []run{
+		{time.Date(2025, 3, 10, 8, 1, 32, 0, time.UTC), time.Date(2025, 3, 10, 8, 0, 0, 0, time.UTC)},
+		{time.Date(2025, 3, 10, 8, 2, 27, 0, time.UTC), time.Date(2025, 3, 10, 8, 1, 0, 0, time.UTC)},
+	} {
+		if !got[i].at.Equal(want.at) || !got[i].minute.Equal(want.minute) {
+			t.Fatalf("run %d at %s for minute %s, want %s for %s", i, got[i].at, got[i].minute, want.at, want.minute)
+		}
+	}
+}
+
+func TestIntegrationLoopsManagerStop(t *testing.T) {
+	m, _ := newTestManager(t)
+	lm := NewLoopsManager(context.Background())
+	called := make(chan struct{}, 1)
+	lm.StartEveryMinute(func(ctx context.Context, minute time.Time) {
+		m.RequestMinute(minute)
+		called <- struct{}{}
+	})
+	lm.StartEveryHour(func(ctx context.Context) { _ = m.RequestHour(ctx, time.Now()) })
+
+	start := time.Now()
+	stopCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := lm.StopWithin(stopCtx); err != nil {
+		t.Fatalf("StopWithin: %v", err)
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Fatalf("Stop took %s waiting for aligned loops", d)
+	}
+	lm.Stop() // again, once stopped
+	select {
+	case <-called:
+		t.Fatal("minute loop ran after Stop")
+	default:
+	}
+}
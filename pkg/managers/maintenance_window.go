@@ -0,0 +1,323 @@
+package managers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"hex_toolset/pkg/db/entities"
+	skylogger "hex_toolset/pkg/logger"
+	"hex_toolset/pkg/shifts"
+	"hex_toolset/pkg/timeutil"
+)
+
+// MaintenanceWindow is one occurrence of a planned stop of a line, or of every line when
+// Line is empty: a daily window of MAINTENANCE_WINDOWS (ID 0) or a dated one of the
+// maintenance_window table.
+type MaintenanceWindow struct {
+	ID     int64  `json:"id,omitempty"`
+	Line   string `json:"line,omitempty"`
+	Start  string `json:"start"` // 'YYYY-MM-DD HH:MM:SS' local
+	End    string `json:"end"`   // exclusive
+	Reason string `json:"reason,omitempty"`
+
+	r timeutil.TimeRange
+}
+
+func newMaintenanceWindow(id int64, line string, r timeutil.TimeRange, reason string) MaintenanceWindow {
+	return MaintenanceWindow{ID: id, Line: line, Start: timeutil.FormatLocal(r.Start), End: timeutil.FormatLocal(r.End),
+		Reason: reason, r: r}
+}
+
+// Covers reports whether the window stops line.
+func (w MaintenanceWindow) Covers(line string) bool {
+	return w.Line == "" || w.Line == normalizeLine(line)
+}
+
+// String describes the window for logs and annotations.
+func (w MaintenanceWindow) String() string {
+	scope := "all lines"
+	if w.Line != "" {
+		scope = w.Line
+	}
+	s := fmt.Sprintf("maintenance of %s %s..%s", scope, w.Start, w.End)
+	if w.Reason != "" {
+		s += " (" + w.Reason + ")"
+	}
+	return s
+}
+
+// MaintenanceWindowsActive is the MAINTENANCE_WINDOWS payload: the windows in progress.
+type MaintenanceWindowsActive struct {
+	Active []MaintenanceWindow `json:"active"`
+}
+
+// MaintenanceWindows are the planned stops during which missing passes are expected:
+// alerts raised meanwhile are not broadcast (see AlertManager.SetMaintenance), the OEE does
+// not count their time as planned nor as downtime, and the dashboard shows the lines as
+// under maintenance instead of stale. Daily windows come from MAINTENANCE_WINDOWS, dated
+// ones from the maintenance_window table, which like LineMaintenance is re-read at most
+// once per ttl.
+type MaintenanceWindows struct {
+	entity    *entities.MaintenanceWindowManager
+	daily     *shifts.Calendar // one "shift" per daily window, named by its line
+	ttl       time.Duration
+	publisher Publisher
+	logger    *skylogger.Logger
+	now       func() time.Time
+
+	mu        sync.Mutex
+	dated     []MaintenanceWindow // overlapping [loadedAt, loadedAt+24h)
+	loadedAt  time.Time
+	loaded    bool
+	published string // key of the active set last published
+}
+
+// ParseMaintenanceWindows parses the daily windows of spec, "HH:MM-HH:MM" for every line or
+// "LINE=HH:MM-HH:MM" for one, comma separated. A window ending at or before its start
+// crosses midnight.
+func ParseMaintenanceWindows(spec string) ([]shifts.Shift, error) {
+	var out []shifts.Shift
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		line, span, ok := strings.Cut(part, "=")
+		if !ok {
+			line, span = "", part
+		}
+		from, to, ok := strings.Cut(span, "-")
+		if !ok {
+			return nil, fmt.Errorf("invalid maintenance window %q, expected [LINE=]HH:MM-HH:MM", part)
+		}
+		start, err := time.Parse("15:04", strings.TrimSpace(from))
+		if err != nil {
+			return nil, fmt.Errorf("maintenance window %q start: expected HH:MM", part)
+		}
+		end, err := time.Parse("15:04", strings.TrimSpace(to))
+		if err != nil {
+			return nil, fmt.Errorf("maintenance window %q end: expected HH:MM", part)
+		}
+		out = append(out, shifts.Shift{Name: normalizeLine(line),
+			Start: time.Duration(start.Hour())*time.Hour + time.Duration(start.Minute())*time.Minute,
+			End:   time.Duration(end.Hour())*time.Hour + time.Duration(end.Minute())*time.Minute})
+	}
+	return out, nil
+}
+
+// NewMaintenanceWindows creates the maintenance windows of spec (see
+// ParseMaintenanceWindows) and of the maintenance_window table of database, which may be
+// nil for daily windows only. pub may be nil.
+func NewMaintenanceWindows(database *sql.DB, spec string, ttl time.Duration, pub Publisher, lgr *skylogger.Logger) (*MaintenanceWindows, error) {
+	daily, err := ParseMaintenanceWindows(spec)
+	if err != nil {
+		return nil, err
+	}
+	w := &MaintenanceWindows{daily: &shifts.Calendar{Shifts: daily, Loc: time.Local}, ttl: ttl,
+		publisher: pub, logger: lgr, now: time.Now}
+	if database != nil {
+		w.entity = entities.NewMaintenanceWindowManager(database)
+	}
+	return w, nil
+}
+
+// SetPublisher replaces the publisher used for MAINTENANCE_WINDOWS messages.
+func (w *MaintenanceWindows) SetPublisher(p Publisher) {
+	w.mu.Lock()
+	w.publisher = p
+	w.mu.Unlock()
+}
+
+// Between returns the windows overlapping r, ordered by start.
+func (w *MaintenanceWindows) Between(ctx context.Context, r timeutil.TimeRange) ([]MaintenanceWindow, error) {
+	if w == nil {
+		return nil, nil
+	}
+	out := []MaintenanceWindow{}
+	// a daily window ending in (r.Start, r.End+24h] overlaps r if it starts before r.End
+	for _, in := range w.daily.Between(r.Start, r.End.Add(24*time.Hour)) {
+		if in.Start.Before(r.End) {
+			out = append(out, newMaintenanceWindow(0, in.Name, timeutil.TimeRange{Start: in.Start, End: in.End}, ""))
+		}
+	}
+	dated, err := w.datedBetween(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	out = append(out, dated...)
+	sort.SliceStable(out, func(i, j int) bool { return out[i].r.Start.Before(out[j].r.Start) })
+	return out, nil
+}
+
+// datedBetween returns the windows of the table overlapping r, ordered by start.
+func (w *MaintenanceWindows) datedBetween(ctx context.Context, r timeutil.TimeRange) ([]MaintenanceWindow, error) {
+	if w.entity == nil {
+		return nil, nil
+	}
+	stored, err := w.entity.Overlapping(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]MaintenanceWindow, 0, len(stored))
+	for _, s := range stored {
+		start, err1 := timeutil.ParseDB(s.StartAt)
+		end, err2 := timeutil.ParseDB(s.EndAt)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		out = append(out, newMaintenanceWindow(s.ID, s.LineName, timeutil.TimeRange{Start: start, End: end}, s.Reason))
+	}
+	return out, nil
+}
+
+// Active returns the window stopping line now, if any; with line "" only windows of every
+// line count. When the table cannot be read the last known dated windows are kept.
+func (w *MaintenanceWindows) Active(line string) (MaintenanceWindow, bool) {
+	for _, win := range w.activeNow() {
+		if win.Line == "" || (line != "" && win.Covers(line)) {
+			return win, true
+		}
+	}
+	return MaintenanceWindow{}, false
+}
+
+// activeNow returns the windows in progress.
+func (w *MaintenanceWindows) activeNow() []MaintenanceWindow {
+	if w == nil {
+		return nil
+	}
+	now := w.now()
+	w.mu.Lock()
+	stale := w.entity != nil && (!w.loaded || now.Sub(w.loadedAt) >= w.ttl)
+	w.mu.Unlock()
+	if stale {
+		if err := w.Refresh(context.Background()); err != nil && w.logger != nil {
+			w.logger.Warnf("maintenance windows: %v", err)
+		}
+	}
+
+	var out []MaintenanceWindow
+	// a daily window in progress ends within 24 hours
+	for _, in := range w.daily.Between(now, now.Add(24*time.Hour)) {
+		if in.Contains(now) {
+			out = append(out, newMaintenanceWindow(0, in.Name, timeutil.TimeRange{Start: in.Start, End: in.End}, ""))
+		}
+	}
+	w.mu.Lock()
+	for _, win := range w.dated {
+		if !now.Before(win.r.Start) && now.Before(win.r.End) {
+			out = append(out, win)
+		}
+	}
+	w.mu.Unlock()
+	return out
+}
+
+// Refresh reloads the dated windows of the next 24 hours.
+func (w *MaintenanceWindows) Refresh(ctx context.Context) error {
+	now := w.now()
+	dated, err := w.datedBetween(ctx, timeutil.TimeRange{Start: now, End: now.Add(24 * time.Hour)})
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.loadedAt = now
+	if err != nil {
+		return err
+	}
+	w.dated, w.loaded = dated, true
+	return nil
+}
+
+// PublishActive publishes MAINTENANCE_WINDOWS when the set of windows in progress changed
+// since the last call; the live cycle calls it every minute.
+func (w *MaintenanceWindows) PublishActive() {
+	if w == nil {
+		return
+	}
+	active := w.activeNow()
+	keys := make([]string, 0, len(active))
+	for _, win := range active {
+		keys = append(keys, fmt.Sprintf("%d/%s/%s", win.ID, win.Line, win.Start))
+	}
+	key := strings.Join(keys, ",")
+
+	w.mu.Lock()
+	changed := key != w.published
+	w.published = key
+	pub := w.publisher
+	w.mu.Unlock()
+	if !changed {
+		return
+	}
+	if w.logger != nil {
+		if len(active) == 0 {
+			w.logger.Infof("maintenance windows ended")
+		}
+		for _, win := range active {
+			w.logger.Infof("%s in progress", win)
+		}
+	}
+	if pub != nil {
+		if err := pub.Publish(TopicMaintenanceWindows, MaintenanceWindowsActive{Active: append([]MaintenanceWindow{}, active...)}); err != nil && w.logger != nil {
+			w.logger.Errorf("%v", err)
+		}
+	}
+}
+
+// Add stores the dated window r of line ("" for every line) and returns it.
+func (w *MaintenanceWindows) Add(ctx context.Context, line string, r timeutil.TimeRange, reason string) (MaintenanceWindow, error) {
+	if w.entity == nil {
+		return MaintenanceWindow{}, fmt.Errorf("maintenance windows have no database")
+	}
+	line, reason = normalizeLine(line), strings.TrimSpace(reason)
+	id, err := w.entity.Add(ctx, line, r.Start, r.End, reason)
+	if err != nil {
+		return MaintenanceWindow{}, err
+	}
+	return newMaintenanceWindow(id, line, r, reason), w.Refresh(ctx)
+}
+
+// Delete removes the dated window id; ok is false when there was none.
+func (w *MaintenanceWindows) Delete(ctx context.Context, id int64) (ok bool, err error) {
+	if w.entity == nil {
+		return false, nil
+	}
+	if ok, err = w.entity.Delete(ctx, id); err != nil || !ok {
+		return ok, err
+	}
+	return true, w.Refresh(ctx)
+}
+
+// maintenanceIntervals returns the parts of r stopped for line by windows, merged and
+// ordered.
+func maintenanceIntervals(windows []MaintenanceWindow, line string, r timeutil.TimeRange) []timeutil.TimeRange {
+	var out []timeutil.TimeRange
+	for _, win := range windows {
+		if !win.Covers(line) {
+			continue
+		}
+		start, end := win.r.Start, win.r.End
+		if start.Before(r.Start) {
+			start = r.Start
+		}
+		if end.After(r.End) {
+			end = r.End
+		}
+		if !start.Before(end) {
+			continue
+		}
+		if n := len(out); n > 0 && !start.After(out[n-1].End) {
+			if end.After(out[n-1].End) {
+				out[n-1].End = end
+			}
+			continue
+		}
+		out = append(out, timeutil.TimeRange{Start: start, End: end})
+	}
+	return out
+}
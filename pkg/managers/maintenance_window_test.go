@@ -0,0 +1,111 @@
+package managers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"hex_toolset/pkg/db"
+	"hex_toolset/pkg/db/entities"
+	"hex_toolset/pkg/shifts"
+	"hex_toolset/pkg/timeutil"
+)
+
+func TestIntegrationMaintenanceWindows(t *testing.T) {
+	resetState(t)
+	t.Cleanup(func() { _, _ = db.GetDB().Exec("DELETE FROM station_target") })
+	ctx := context.Background()
+	rec := &publishRecorder{}
+	now := base.Add(5 * time.Minute)
+	mw, err := NewMaintenanceWindows(db.GetDB(), "J01=08:20-08:30", time.Minute, rec, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mw.now = func() time.Time { return now }
+	shutdown, err := mw.Add(ctx, "", timeutil.TimeRange{Start: base, End: base.Add(10 * time.Minute)}, "shutdown")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An alert raised while every line is stopped is tracked but not broadcast...
+	alerts := NewAlertManager(rec, nil)
+	alerts.SetMaintenance(mw)
+	mw.PublishActive()
+	alerts.Raise("api_slow", SeverityWarning, "sfc_api", "p95 degraded")
+	if active := alerts.Active(); len(active) != 1 || active[0].Maintenance != shutdown.String() || rec.published(TopicAlert) {
+		t.Fatalf("alert during maintenance: active %+v, published %v", active, rec.topics)
+	}
+	mw.PublishActive() // same windows in progress: nothing new to publish
+	// ...until the window is over while it is still active.
+	now = base.Add(15 * time.Minute)
+	mw.PublishActive()
+	alerts.ReleaseSuppressed()
+	if !reflect.DeepEqual(rec.topics, []string{TopicMaintenanceWindows, TopicMaintenanceWindows, TopicAlert}) {
+		t.Fatalf("published %v", rec.topics)
+	}
+	if al := rec.last[TopicAlert].(Alert); al.Key != "api_slow" || al.Maintenance != "" {
+		t.Fatalf("released alert = %+v", al)
+	}
+	if got := rec.last[TopicMaintenanceWindows].(MaintenanceWindowsActive); len(got.Active) != 0 {
+		t.Fatalf("windows in progress after the shutdown = %+v", got)
+	}
+
+	// The daily window stops J01 only.
+	now = base.Add(25 * time.Minute)
+	if _, ok := mw.Active("j01"); !ok {
+		t.Fatal("J01 not in its daily window")
+	}
+	if win, ok := mw.Active("J02"); ok {
+		t.Fatalf("J02 stopped by %s", win)
+	}
+	if _, ok := mw.Active(""); ok {
+		t.Fatal("a window of J01 stops every line")
+	}
+
+	// The OEE leaves both windows out of the planned time: PACK01 passes every minute but
+	// 40-49, a stop; the passes during the windows still count as processed.
+	if err := entities.NewStationTargetManager(db.GetDB()).Set(ctx, "J01", "PACK01", 30); err != nil {
+		t.Fatal(err)
+	}
+	var recs []entities.RecordEntity
+	for i := 0; i < 60; i++ {
+		if i >= 40 && i < 50 {
+			continue
+		}
+		recs = append(recs, entities.RecordEntity{PPID: fmt.Sprintf("U%d", i), WorkOrder: "MO1", LineName: "J01",
+			GroupName: "PACKING", StationName: "PACK01", ModelName: "M", CollectedTimestamp: base.Add(time.Duration(i) * time.Minute)})
+	}
+	if err := entities.NewRecordManagerEntity(db.GetDB()).InsertBatch(recs); err != nil {
+		t.Fatal(err)
+	}
+	cal, err := shifts.Parse("A=08:00-09:00,B=09:00-08:00", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oee := NewOEE(cal, db.GetDB(), 5*time.Minute, nil)
+	oee.SetMaintenance(mw)
+	oee.now = func() time.Time { return base.Add(2 * time.Hour) }
+	rep, err := oee.Shift(ctx, cal.Between(base, base.Add(time.Hour))[0], "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rep.Maintenance) != 2 || rep.Maintenance[0].ID != shutdown.ID || rep.Maintenance[1].Line != "J01" {
+		t.Fatalf("maintenance of the shift = %+v", rep.Maintenance)
+	}
+	pack := rep.Lines[0].Stations[0]
+	if pack.MaintenanceSeconds != 1200 || pack.PlannedSeconds != 2400 || pack.Stops != 1 ||
+		pack.DowntimeSeconds != 660 || pack.Processed != 50 {
+		t.Fatalf("PACK01 = %+v", pack.OEEFigures)
+	}
+
+	// Removed windows stop nothing.
+	if ok, err := mw.Delete(ctx, shutdown.ID); err != nil || !ok {
+		t.Fatalf("delete: %v %v", ok, err)
+	}
+	now = base.Add(5 * time.Minute)
+	if win, ok := mw.Active(""); ok {
+		t.Fatalf("deleted window still active: %s", win)
+	}
+}
@@ -0,0 +1,207 @@
+package managers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// HistoryDirName is the subdirectory of BROADCAST_MESSAGE_DIR holding the broadcast messages
+	// kept as history. The broadcast service does not watch it.
+	HistoryDirName = "history"
+	// CompressAfter is the age after which kept messages are gzipped in place.
+	CompressAfter = time.Hour
+)
+
+// gzipExt is appended to the name of a compressed message file (x.json -> x.json.gz).
+const gzipExt = ".gz"
+
+// ReadMessageFile returns the content of a message file, decompressing .gz files, so every
+// loader reads plain and compressed messages alike.
+func ReadMessageFile(path string) ([]byte, error) {
+	b, err := os.ReadFile(path)
+	if err != nil || !strings.HasSuffix(strings.ToLower(path), gzipExt) {
+		return b, err
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	defer zr.Close()
+	out, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	return out, nil
+}
+
+// MessageHistory keeps the messages the broadcast service consumed from MESSAGE_DIR in its
+// history subdirectory for keep, instead of deleting them, so past snapshots can be
+// replayed for triage. Compact gzips the ones older than CompressAfter, which cuts their
+// size by ~90%, and removes those past keep.
+type MessageHistory struct {
+	dir  string
+	keep time.Duration
+	now  func() time.Time
+}
+
+// NewMessageHistory creates the history of messageDir keeping messages for keep.
+func NewMessageHistory(messageDir string, keep time.Duration) *MessageHistory {
+	return &MessageHistory{dir: filepath.Join(messageDir, HistoryDirName), keep: keep, now: time.Now}
+}
+
+// Dir returns the history directory.
+func (h *MessageHistory) Dir() string { return h.dir }
+
+// Archive moves the consumed message file at path into the history.
+func (h *MessageHistory) Archive(path string) error {
+	if err := os.MkdirAll(h.dir, 0o755); err != nil {
+		return fmt.Errorf("history directory: %w", err)
+	}
+	return os.Rename(path, filepath.Join(h.dir, filepath.Base(path)))
+}
+
+// CompactResult tells what a Compact run did.
+type CompactResult struct {
+	Compressed int   `json:"compressed"`
+	Saved      int64 `json:"saved_bytes"`
+	Removed    int   `json:"removed"`
+}
+
+// Compact removes the messages older than keep and gzips the remaining plain ones older
+// than CompressAfter. Files are compressed to a temp file renamed over the .gz name and
+// keep their modification time, which orders the replay. A file that fails is left as is
+// and reported after the others were processed.
+func (h *MessageHistory) Compact() (CompactResult, error) {
+	var res CompactResult
+	files, err := h.files()
+	if err != nil {
+		return res, err
+	}
+	now := h.now()
+	var errs []string
+	for _, f := range files {
+		age := now.Sub(f.mod)
+		switch {
+		case h.keep > 0 && age > h.keep:
+			if err := os.Remove(f.path); err != nil {
+				errs = append(errs, err.Error())
+				continue
+			}
+			res.Removed++
+		case age > CompressAfter && !strings.HasSuffix(strings.ToLower(f.path), gzipExt):
+			saved, err := compressFile(f.path, f.mod)
+			if err != nil {
+				errs = append(errs, err.Error())
+				continue
+			}
+			res.Compressed++
+			res.Saved += saved
+		}
+	}
+	if len(errs) > 0 {
+		return res, fmt.Errorf("compact %s: %s", h.dir, strings.Join(errs, "; "))
+	}
+	return res, nil
+}
+
+// Replay calls fn with the name and content of every kept message modified at or after
+// since, oldest first; compressed messages are decompressed.
+func (h *MessageHistory) Replay(since time.Time, fn func(name string, msg []byte) error) error {
+	files, err := h.files()
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if f.mod.Before(since) {
+			continue
+		}
+		b, err := ReadMessageFile(f.path)
+		if err != nil {
+			return err
+		}
+		if err := fn(strings.TrimSuffix(filepath.Base(f.path), gzipExt), b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type historyFile struct {
+	path string
+	mod  time.Time
+}
+
+// files lists the kept messages, oldest first; a missing directory is an empty history.
+func (h *MessageHistory) files() ([]historyFile, error) {
+	entries, err := os.ReadDir(h.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", h.dir, err)
+	}
+	var out []historyFile
+	for _, e := range entries {
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		out = append(out, historyFile{filepath.Join(h.dir, e.Name()), info.ModTime()})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].mod.Before(out[j].mod) })
+	return out, nil
+}
+
+// compressFile replaces path by path.gz with the same modification time and returns the
+// bytes saved.
+func compressFile(path string, mod time.Time) (int64, error) {
+	in, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Name = filepath.Base(path)
+	if _, err := zw.Write(in); err != nil {
+		return 0, err
+	}
+	if err := zw.Close(); err != nil {
+		return 0, err
+	}
+
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return 0, err
+	}
+	tmpPath := tmp.Name()
+	_, werr := tmp.Write(buf.Bytes())
+	if cerr := tmp.Close(); werr == nil {
+		werr = cerr
+	}
+	if werr == nil {
+		werr = os.Chtimes(tmpPath, mod, mod)
+	}
+	if werr == nil {
+		werr = os.Rename(tmpPath, path+gzipExt)
+	}
+	if werr != nil {
+		_ = os.Remove(tmpPath)
+		return 0, werr
+	}
+	if err := os.Remove(path); err != nil {
+		return 0, err
+	}
+	return int64(len(in) - buf.Len()), nil
+}
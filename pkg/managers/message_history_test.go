@@ -0,0 +1,75 @@
+package managers
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMessageHistory(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	h := NewMessageHistory(dir, 24*time.Hour)
+	h.now = func() time.Time { return now }
+
+	// Three relayed messages: 30h (past keep), 2h (to compress) and 10m old.
+	body := func(typ string) []byte {
+		return []byte(`{"massage_type":"` + typ + `","massage":{"J01_PACKING":` + strings.Repeat("1", 500) + `}}`)
+	}
+	for name, age := range map[string]time.Duration{"old.json": 30 * time.Hour, "hour.json": 2 * time.Hour, "new.json": 10 * time.Minute} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, body(strings.TrimSuffix(name, ".json")), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, now.Add(-age), now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+		if err := h.Archive(path); err != nil {
+			t.Fatalf("archive %s: %v", name, err)
+		}
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 || entries[0].Name() != HistoryDirName {
+		t.Fatalf("MESSAGE_DIR after archiving = %v", entries)
+	}
+
+	res, err := h.Compact()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Compressed != 1 || res.Removed != 1 || res.Saved <= 0 {
+		t.Fatalf("compact = %+v", res)
+	}
+	var names []string
+	entries, _ := os.ReadDir(h.Dir())
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if strings.Join(names, ",") != "hour.json.gz,new.json" {
+		t.Fatalf("history = %v", names)
+	}
+	if again, err := h.Compact(); err != nil || again != (CompactResult{}) {
+		t.Fatalf("second compact = %+v, %v", again, err)
+	}
+
+	// Replay reads both, oldest first, the compressed one decompressed.
+	var replayed []string
+	err = h.Replay(now.Add(-3*time.Hour), func(name string, msg []byte) error {
+		if !bytes.Equal(msg, body(strings.TrimSuffix(name, ".json"))) {
+			t.Fatalf("%s replayed as %q", name, msg)
+		}
+		replayed = append(replayed, name)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(replayed, ",") != "hour.json,new.json" {
+		t.Fatalf("replayed %v", replayed)
+	}
+	if b, err := ReadMessageFile(filepath.Join(h.Dir(), "hour.json.gz")); err != nil || !bytes.Equal(b, body("hour")) {
+		t.Fatalf("ReadMessageFile = %q, %v", b, err)
+	}
+}
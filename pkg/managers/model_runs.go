@@ -0,0 +1,86 @@
+package managers
+
+import (
+	"context"
+	"database/sql"
+
+	"hex_toolset/pkg/bus"
+	"hex_toolset/pkg/db/entities"
+	skylogger "hex_toolset/pkg/logger"
+	"hex_toolset/pkg/timeutil"
+)
+
+// ModelRuns segments each line's output into model runs, so output can be reported per
+// model without splitting it by hand at changeovers. The runs are derived from the passes
+// of one output group: extended after every ingested minute and rebuilt after a backfill,
+// which may change the passes of a period already segmented.
+type ModelRuns struct {
+	runs   *entities.ModelRunManager
+	group  string
+	ctx    context.Context
+	logger *skylogger.Logger
+}
+
+// NewModelRuns creates the model-run segmentation of database over the passes of group.
+// Hooks run with ctx.
+func NewModelRuns(ctx context.Context, database *sql.DB, group string, lgr *skylogger.Logger) *ModelRuns {
+	return &ModelRuns{runs: entities.NewModelRunManager(database), group: group, ctx: ctx, logger: lgr}
+}
+
+// Attach keeps the runs up to date with the ingestion published on b (SFCAPIManager.Bus).
+func (r *ModelRuns) Attach(b *bus.Bus) {
+	bus.Subscribe(b, func(ev bus.MinuteIngested) {
+		if ev.Records > 0 {
+			_ = r.Update(r.ctx)
+		}
+	})
+	bus.Subscribe(b, func(ev BackfillComplete) {
+		if ev.Records > 0 {
+			_ = r.Rebuild(r.ctx, ev.Range)
+		}
+	})
+}
+
+// Update extends the runs with the passes stored since the last update.
+func (r *ModelRuns) Update(ctx context.Context) error {
+	changes, err := r.runs.Segment(ctx, r.group)
+	r.report(changes, err)
+	return err
+}
+
+// Rebuild segments again from the start of tr, e.g. after tr was reloaded.
+func (r *ModelRuns) Rebuild(ctx context.Context, tr timeutil.TimeRange) error {
+	changes, err := r.runs.Resegment(ctx, r.group, tr)
+	r.report(changes, err)
+	return err
+}
+
+func (r *ModelRuns) report(changes []entities.Changeover, err error) {
+	if r.logger == nil {
+		return
+	}
+	if err != nil {
+		r.logger.Errorf("model runs: %v", err)
+		return
+	}
+	for _, c := range changes {
+		if c.From == "" {
+			r.logger.Infof("line %s runs %s since %s", c.LineName, c.To, timeutil.LocalDB(c.At))
+			continue
+		}
+		r.logger.Infof("changeover on line %s at %s: %s -> %s", c.LineName, timeutil.LocalDB(c.At), c.From, c.To)
+	}
+}
+
+// List returns the runs overlapping tr of line (all lines when empty), oldest first, with
+// local start and end times.
+func (r *ModelRuns) List(ctx context.Context, line string, tr timeutil.TimeRange) ([]entities.ModelRun, error) {
+	runs, err := r.runs.List(ctx, line, tr)
+	for i := range runs {
+		runs[i].Start, runs[i].End = timeutil.LocalDB(runs[i].Start), timeutil.LocalDB(runs[i].End)
+	}
+	if runs == nil {
+		runs = []entities.ModelRun{}
+	}
+	return runs, err
+}
@@ -0,0 +1,73 @@
+package managers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"hex_toolset/pkg/db"
+	"hex_toolset/pkg/db/entities"
+	"hex_toolset/pkg/timeutil"
+)
+
+func TestIntegrationModelRuns(t *testing.T) {
+	resetState(t)
+	t.Cleanup(func() { _, _ = db.GetDB().Exec("DELETE FROM model_run") })
+	records := entities.NewRecordManagerEntity(db.GetDB())
+	pass := func(ppid, model string, at time.Duration) entities.RecordEntity {
+		return entities.RecordEntity{PPID: ppid, WorkOrder: "MO1", CollectedTimestamp: base.Add(at), GroupName: "PACKING",
+			LineName: "J01", StationName: "PACK01", ModelName: model}
+	}
+	runs := NewModelRuns(context.Background(), db.GetDB(), "PACKING", nil)
+	summary := func() string {
+		list, err := runs.List(context.Background(), "J01", timeutil.Hour(base))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var parts []string
+		for _, r := range list {
+			parts = append(parts, fmt.Sprintf("%s:%d", r.ModelName, r.Units))
+		}
+		return strings.Join(parts, " ")
+	}
+
+	if err := records.InsertBatch([]entities.RecordEntity{
+		pass("P1", "A", 0), pass("P2", "A", time.Minute), pass("P3", "B", 2*time.Minute),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := runs.Update(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := summary(); got != "A:2 B:1" {
+		t.Fatalf("runs = %q, want A:2 B:1", got)
+	}
+
+	// The open run is extended, a new model starts the next one.
+	if err := records.InsertBatch([]entities.RecordEntity{pass("P4", "B", 3*time.Minute), pass("P5", "A", 4*time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+	changes, err := entities.NewModelRunManager(db.GetDB()).Segment(context.Background(), "PACKING")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].From != "B" || changes[0].To != "A" {
+		t.Fatalf("changeovers = %+v, want B -> A", changes)
+	}
+	if got := summary(); got != "A:2 B:2 A:1" {
+		t.Fatalf("runs = %q, want A:2 B:2 A:1", got)
+	}
+
+	// A backfilled pass inside a segmented period is only attributed by a rebuild.
+	if err := records.InsertBatch([]entities.RecordEntity{pass("P6", "B", 150*time.Second)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := runs.Rebuild(context.Background(), timeutil.TimeRange{Start: base.Add(2 * time.Minute), End: base.Add(5 * time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+	if got := summary(); got != "A:2 B:3 A:1" {
+		t.Fatalf("runs after rebuild = %q, want A:2 B:3 A:1", got)
+	}
+}
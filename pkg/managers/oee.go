@@ -0,0 +1,296 @@
+package managers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"hex_toolset/pkg/db/entities"
+	skylogger "hex_toolset/pkg/logger"
+	"hex_toolset/pkg/shifts"
+	"hex_toolset/pkg/timeutil"
+)
+
+// MaxOEERange bounds the range of an OEE report; each shift is computed from raw records.
+const MaxOEERange = 31 * 24 * time.Hour
+
+// ShiftOEE is the OEE of every line with station targets over one shift. Until is set while
+// the shift is in progress: it is measured up to then instead of its end. Maintenance lists
+// the maintenance windows overlapping the shift, whose time the figures leave out.
+type ShiftOEE struct {
+	Shift       string              `json:"shift"`
+	Start       string              `json:"start"` // 'YYYY-MM-DD HH:MM:SS' local
+	End         string              `json:"end"`
+	Until       string              `json:"until,omitempty"`
+	Maintenance []MaintenanceWindow `json:"maintenance,omitempty"`
+	Lines       []LineOEE           `json:"lines"`
+}
+
+// LineOEE is the OEE of a line, from the sums of its stations' figures.
+type LineOEE struct {
+	Line string `json:"line"`
+	OEEFigures
+	Stations []StationOEE `json:"stations"`
+}
+
+// StationOEE is the OEE of one station with a cycle time target.
+type StationOEE struct {
+	Station       string  `json:"station"`
+	TargetSeconds float64 `json:"target_seconds"`
+	OEEFigures
+}
+
+// OEEFigures are the three OEE factors and what they are computed from:
+//
+//   - Availability: the share of the planned time the station was running. The planned time
+//     is the shift minus the maintenance windows of the line. Any gap of at least the stop
+//     threshold without a record in the planned time, including before the first and after
+//     the last of the shift or around a window, is a stop and counts whole as downtime.
+//   - Performance: the target cycle time of the units processed (passes and failures)
+//     against the running time, capped at 1.
+//   - Quality: the first pass yield, the share of the units tested whose first test of the
+//     shift passed.
+//
+// A factor without a base (no planned time, no running time, no units) is 0.
+type OEEFigures struct {
+	MaintenanceSeconds float64 `json:"maintenance_seconds"`
+	PlannedSeconds     float64 `json:"planned_seconds"`
+	DowntimeSeconds    float64 `json:"downtime_seconds"`
+	Stops              int     `json:"stops"`
+	IdealSeconds       float64 `json:"ideal_seconds"`
+	Processed          int     `json:"processed"`
+	Units              int     `json:"units"`
+	FirstPass          int     `json:"first_pass"`
+	Availability       float64 `json:"availability"`
+	Performance        float64 `json:"performance"`
+	Quality            float64 `json:"quality"`
+	OEE                float64 `json:"oee"`
+}
+
+func (f *OEEFigures) add(o OEEFigures) {
+	f.MaintenanceSeconds += o.MaintenanceSeconds
+	f.PlannedSeconds += o.PlannedSeconds
+	f.DowntimeSeconds += o.DowntimeSeconds
+	f.Stops += o.Stops
+	f.IdealSeconds += o.IdealSeconds
+	f.Processed += o.Processed
+	f.Units += o.Units
+	f.FirstPass += o.FirstPass
+}
+
+// compute derives the factors from the totals.
+func (f *OEEFigures) compute() {
+	run := f.PlannedSeconds - f.DowntimeSeconds
+	f.Availability, f.Performance, f.Quality = 0, 0, 0
+	if f.PlannedSeconds > 0 {
+		f.Availability = run / f.PlannedSeconds
+	}
+	if run > 0 {
+		f.Performance = min(f.IdealSeconds/run, 1)
+	}
+	if f.Units > 0 {
+		f.Quality = float64(f.FirstPass) / float64(f.Units)
+	}
+	f.OEE = f.Availability * f.Performance * f.Quality
+}
+
+// OEE computes the per-station and per-line OEE of each shift from the raw records and the
+// station cycle time targets; stations without a target are left out, since performance
+// cannot be measured without one.
+type OEE struct {
+	calendar    *shifts.Calendar
+	records     *entities.RecordEntityManager
+	targets     *entities.StationTargetManager
+	maintenance *MaintenanceWindows
+	stop        time.Duration
+	logger      *skylogger.Logger
+	now         func() time.Time
+}
+
+// NewOEE creates the OEE of database over the shifts of cal; a gap of stop or more without
+// a record at a station is downtime.
+func NewOEE(cal *shifts.Calendar, database *sql.DB, stop time.Duration, lgr *skylogger.Logger) *OEE {
+	return &OEE{calendar: cal, records: entities.NewRecordManagerEntity(database),
+		targets: entities.NewStationTargetManager(database), stop: stop, logger: lgr, now: time.Now}
+}
+
+// SetMaintenance leaves the maintenance windows of w out of the planned time.
+func (o *OEE) SetMaintenance(w *MaintenanceWindows) { o.maintenance = w }
+
+// Attach publishes the OEE of each shift sm closes, after its SHIFT_CLOSED.
+func (o *OEE) Attach(sm *ShiftManager) {
+	sm.OnClosed(func(in shifts.Instance) {
+		rep, err := o.Shift(context.Background(), in, "")
+		if err != nil {
+			o.logger.Errorf("oee of shift %s %s: %v", in.Name, timeutil.FormatLocal(in.Start), err)
+			return
+		}
+		if sm.publisher == nil {
+			return
+		}
+		if err := sm.publisher.Publish(TopicOEE, rep); err != nil {
+			o.logger.Errorf("failed to publish oee of shift %s %s: %v", in.Name, timeutil.FormatLocal(in.Start), err)
+		}
+	})
+}
+
+// Report returns the OEE of every shift overlapping r that has started, oldest first, of
+// one line or ("") all lines.
+func (o *OEE) Report(ctx context.Context, r timeutil.TimeRange, line string) ([]ShiftOEE, error) {
+	now := o.now()
+	out := []ShiftOEE{}
+	for _, in := range o.calendar.Between(r.Start, r.End.Add(24*time.Hour)) {
+		if !in.Start.Before(r.End) || !in.Start.Before(now) {
+			continue
+		}
+		rep, err := o.Shift(ctx, in, line)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, rep)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Start < out[j].Start })
+	return out, nil
+}
+
+// Shift computes the OEE of one shift, of one line or ("") all lines. A shift in progress
+// is measured up to now.
+func (o *OEE) Shift(ctx context.Context, in shifts.Instance, line string) (ShiftOEE, error) {
+	rep := ShiftOEE{Shift: in.Name, Start: timeutil.FormatLocal(in.Start), End: timeutil.FormatLocal(in.End), Lines: []LineOEE{}}
+	end := in.End
+	if now := o.now(); now.Before(end) {
+		end = now
+		rep.Until = timeutil.FormatLocal(end)
+	}
+
+	targets, err := o.targets.List(ctx)
+	if err != nil {
+		return rep, err
+	}
+	type key struct{ line, station string }
+	type firstTest struct {
+		at   time.Time
+		pass bool
+	}
+	type station struct {
+		target entities.StationTarget
+		passes []time.Time
+		units  map[string]firstTest // by PPID
+	}
+	line = normalizeLine(line)
+	stations := map[key]*station{}
+	for _, t := range targets {
+		if line == "" || t.LineName == line {
+			stations[key{t.LineName, t.StationName}] = &station{target: t, units: map[string]firstTest{}}
+		}
+	}
+	if len(stations) == 0 {
+		return rep, nil
+	}
+	shift := timeutil.TimeRange{Start: in.Start, End: end}
+	windows, err := o.maintenance.Between(ctx, shift)
+	if err != nil {
+		return rep, fmt.Errorf("maintenance windows of shift %s %s: %w", in.Name, rep.Start, err)
+	}
+	for _, w := range windows {
+		if line == "" || w.Covers(line) {
+			rep.Maintenance = append(rep.Maintenance, w)
+		}
+	}
+
+	err = o.records.ForEachIn(ctx, shift, func(r entities.RecordEntity) error {
+		s, ok := stations[key{normalizeLine(r.LineName), normalizeLine(r.StationName)}]
+		if !ok {
+			return nil
+		}
+		s.passes = append(s.passes, r.CollectedTimestamp)
+		if f, seen := s.units[r.PPID]; !seen || r.CollectedTimestamp.Before(f.at) {
+			s.units[r.PPID] = firstTest{at: r.CollectedTimestamp, pass: !r.ErrorFlag}
+		}
+		return nil
+	})
+	if err != nil {
+		return rep, fmt.Errorf("records of shift %s %s: %w", in.Name, rep.Start, err)
+	}
+
+	lines := map[string]*LineOEE{}
+	for k, s := range stations {
+		st := StationOEE{Station: k.station, TargetSeconds: s.target.CycleSeconds}
+		stopped := maintenanceIntervals(windows, k.line, shift)
+		for _, m := range stopped {
+			st.MaintenanceSeconds += m.Duration().Seconds()
+		}
+		st.PlannedSeconds = shift.Duration().Seconds() - st.MaintenanceSeconds
+		st.Stops, st.DowntimeSeconds = o.downtime(shift, stopped, s.passes)
+		st.Processed = len(s.passes)
+		st.IdealSeconds = float64(st.Processed) * s.target.CycleSeconds
+		st.Units = len(s.units)
+		for _, f := range s.units {
+			if f.pass {
+				st.FirstPass++
+			}
+		}
+		st.compute()
+
+		l, ok := lines[k.line]
+		if !ok {
+			l = &LineOEE{Line: k.line}
+			lines[k.line] = l
+		}
+		l.add(st.OEEFigures)
+		l.Stations = append(l.Stations, st)
+	}
+	for _, l := range lines {
+		l.compute()
+		sort.Slice(l.Stations, func(i, j int) bool { return l.Stations[i].Station < l.Stations[j].Station })
+		rep.Lines = append(rep.Lines, *l)
+	}
+	sort.Slice(rep.Lines, func(i, j int) bool { return rep.Lines[i].Line < rep.Lines[j].Line })
+	return rep, nil
+}
+
+// downtime returns the stops in shift outside the maintenance intervals stopped (merged,
+// ordered) given the record times of a station: every gap of at least o.stop between the
+// start of a planned period, the records and its end. A stop threshold <= 0 disables stop
+// detection.
+func (o *OEE) downtime(shift timeutil.TimeRange, stopped []timeutil.TimeRange, passes []time.Time) (stops int, seconds float64) {
+	if o.stop <= 0 {
+		return 0, 0
+	}
+	sort.Slice(passes, func(i, j int) bool { return passes[i].Before(passes[j]) })
+	// the planned periods are the shift around the maintenance intervals
+	var planned []timeutil.TimeRange
+	from := shift.Start
+	for _, m := range stopped {
+		if m.Start.After(from) {
+			planned = append(planned, timeutil.TimeRange{Start: from, End: m.Start})
+		}
+		from = m.End
+	}
+	if shift.End.After(from) {
+		planned = append(planned, timeutil.TimeRange{Start: from, End: shift.End})
+	}
+
+	for _, p := range planned {
+		prev := p.Start
+		for _, t := range passes {
+			if t.Before(p.Start) || !t.Before(p.End) {
+				continue
+			}
+			if gap := t.Sub(prev); gap >= o.stop {
+				stops++
+				seconds += gap.Seconds()
+			}
+			if t.After(prev) {
+				prev = t
+			}
+		}
+		if gap := p.End.Sub(prev); gap >= o.stop {
+			stops++
+			seconds += gap.Seconds()
+		}
+	}
+	return stops, seconds
+}
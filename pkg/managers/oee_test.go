@@ -0,0 +1,115 @@
+package managers
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"hex_toolset/pkg/db"
+	"hex_toolset/pkg/db/entities"
+	skylogger "hex_toolset/pkg/logger"
+	"hex_toolset/pkg/shifts"
+	"hex_toolset/pkg/timeutil"
+)
+
+func TestIntegrationShiftOEE(t *testing.T) {
+	resetState(t)
+	t.Cleanup(func() { _, _ = db.GetDB().Exec("DELETE FROM station_target") })
+	ctx := context.Background()
+	targets := entities.NewStationTargetManager(db.GetDB())
+	for _, st := range []string{"PACK01", "TEST01"} {
+		if err := targets.Set(ctx, "J01", st, 27); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// PACK01 runs minutes 0-9 and 30-39 of the 08:00-09:00 shift, one record a minute: 19
+	// units, U3 and U4 failing their first test and U3 retested at minute 39. TEST01 and
+	// TEST02 (no target) stay idle.
+	var recs []entities.RecordEntity
+	for i := 0; i < 20; i++ {
+		at := base.Add(time.Duration(i) * time.Minute)
+		if i >= 10 {
+			at = at.Add(20 * time.Minute)
+		}
+		ppid := fmt.Sprintf("U%d", i)
+		if i == 19 {
+			ppid = "U3"
+		}
+		recs = append(recs, entities.RecordEntity{PPID: ppid, WorkOrder: "MO1", LineName: "J01", GroupName: "PACKING",
+			StationName: "PACK01", ModelName: "M", CollectedTimestamp: at, ErrorFlag: i == 3 || i == 4})
+	}
+	if err := entities.NewRecordManagerEntity(db.GetDB()).InsertBatch(recs); err != nil {
+		t.Fatal(err)
+	}
+
+	cal, err := shifts.Parse("A=08:00-09:00,B=09:00-08:00", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oee := NewOEE(cal, db.GetDB(), 5*time.Minute, nil)
+	oee.now = func() time.Time { return base.Add(2 * time.Hour) }
+	near := func(got, want float64) bool { return math.Abs(got-want) < 1e-9 }
+
+	reps, err := oee.Report(ctx, timeutil.Hour(base), "j01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reps) != 1 || reps[0].Shift != "A" || reps[0].Until != "" || len(reps[0].Lines) != 1 {
+		t.Fatalf("report = %+v", reps)
+	}
+	line := reps[0].Lines[0]
+	if len(line.Stations) != 2 {
+		t.Fatalf("stations = %+v", line.Stations)
+	}
+	pack, idle := line.Stations[0], line.Stations[1]
+	// Stops 09:00-09:30 (21m) and 09:39-10:00 (21m): 1080s running for 20 x 27s of work.
+	if pack.Station != "PACK01" || pack.Stops != 2 || pack.DowntimeSeconds != 2520 || pack.Processed != 20 ||
+		pack.Units != 19 || pack.FirstPass != 17 {
+		t.Fatalf("PACK01 = %+v", pack)
+	}
+	if !near(pack.Availability, 0.3) || !near(pack.Performance, 0.5) || !near(pack.Quality, 17.0/19) ||
+		!near(pack.OEE, 0.15*17/19) {
+		t.Fatalf("PACK01 factors = %+v", pack.OEEFigures)
+	}
+	if idle.Station != "TEST01" || idle.Stops != 1 || idle.DowntimeSeconds != 3600 || idle.OEE != 0 {
+		t.Fatalf("idle TEST01 = %+v", idle)
+	}
+	if line.PlannedSeconds != 7200 || !near(line.Availability, 0.15) || !near(line.Performance, 0.5) ||
+		!near(line.OEE, 0.075*17/19) {
+		t.Fatalf("line J01 = %+v", line.OEEFigures)
+	}
+
+	// A shift in progress is measured up to now: 20 minutes, stopped since minute 9.
+	oee.now = func() time.Time { return base.Add(20 * time.Minute) }
+	rep, err := oee.Shift(ctx, cal.Between(base, base.Add(time.Hour))[0], "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pack = rep.Lines[0].Stations[0]
+	if rep.Until != timeutil.FormatLocal(base.Add(20*time.Minute)) || pack.PlannedSeconds != 1200 ||
+		pack.DowntimeSeconds != 660 || !near(pack.Performance, 0.5) {
+		t.Fatalf("shift in progress = %+v, PACK01 %+v", rep, pack)
+	}
+
+	// Closing the shift publishes its OEE after SHIFT_CLOSED.
+	lgr, err := skylogger.New(skylogger.WithDir(t.TempDir()), skylogger.WithConsole(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = lgr.Close() })
+	rec := &publishRecorder{}
+	sm := NewShiftManager(cal, db.GetDB(), rec, lgr)
+	oee.Attach(sm)
+	oee.now = func() time.Time { return base.Add(2 * time.Hour) }
+	sm.CloseEnded(base, base.Add(time.Hour))
+	if !reflect.DeepEqual(rec.topics, []string{TopicShiftClosed, TopicOEE}) {
+		t.Fatalf("published %v", rec.topics)
+	}
+	if got := rec.last[TopicOEE].(ShiftOEE); len(got.Lines) != 1 || !near(got.Lines[0].OEE, line.OEE) {
+		t.Fatalf("OEE payload = %+v", got)
+	}
+}
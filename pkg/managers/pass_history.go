@@ -0,0 +1,105 @@
+package managers
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"sort"
+	"time"
+
+	"hex_toolset/pkg/db/entities"
+	skylogger "hex_toolset/pkg/logger"
+	"hex_toolset/pkg/timeutil"
+)
+
+// MaxTaktRange bounds the range of a takt report; older passes are compacted away anyway.
+const MaxTaktRange = 7 * 24 * time.Hour
+
+// TaktReport is the inter-pass interval analysis of one (line, group) over a range. An
+// interval shared by several units passing in the same second counts once per unit, at
+// its length divided by the units.
+type TaktReport struct {
+	Line          string  `json:"line"`
+	Group         string  `json:"group"`
+	From          string  `json:"from"`
+	To            string  `json:"to"`
+	TaktSeconds   float64 `json:"takt_seconds"`
+	Units         int     `json:"units"`
+	MedianSeconds float64 `json:"median_seconds"`
+	P90Seconds    float64 `json:"p90_seconds"`
+	// WithinTakt counts the units that passed within TaktSeconds of the previous one;
+	// Adherence is their fraction of Units (0 for an empty range).
+	WithinTakt int     `json:"within_takt"`
+	Adherence  float64 `json:"adherence"`
+}
+
+// PassHistory runs the optional pass history mode: while slots > 0 every passing second is
+// recorded per (line, group), and Compact, scheduled for an idle hour, trims each (line,
+// group) back to its newest slots passing seconds.
+type PassHistory struct {
+	history *entities.PassHistoryManager
+	slots   int
+	logger  *skylogger.Logger
+}
+
+// NewPassHistory creates the pass history of database keeping slots passing seconds per
+// (line, group); slots <= 0 disables history mode.
+func NewPassHistory(database *sql.DB, slots int, lgr *skylogger.Logger) *PassHistory {
+	return &PassHistory{history: entities.NewPassHistoryManager(database), slots: slots, logger: lgr}
+}
+
+// Enabled reports whether history mode is on.
+func (p *PassHistory) Enabled() bool { return p.slots > 0 }
+
+// Apply creates or drops the recording trigger to match the configured mode.
+func (p *PassHistory) Apply() error { return p.history.SetEnabled(p.Enabled()) }
+
+// Compact trims the history to the configured slots and returns the rows removed.
+func (p *PassHistory) Compact(ctx context.Context) (int64, error) {
+	if !p.Enabled() {
+		return 0, nil
+	}
+	return p.history.Compact(ctx, p.slots)
+}
+
+// Schedule runs Compact every day at hour:minute, which should be outside production hours.
+func (p *PassHistory) Schedule(lm *LoopsManager, hour, minute int) {
+	lm.StartDailyAt(hour, minute, 0, func(ctx context.Context) {
+		n, err := p.Compact(ctx)
+		if err != nil {
+			p.logger.Errorf("pass history: %v", err)
+			return
+		}
+		p.logger.Infof("pass history: compacted to %d slots per line/group, %d rows removed", p.slots, n)
+	})
+}
+
+// Takt reports how the passes of line/group in r kept to takt.
+func (p *PassHistory) Takt(ctx context.Context, line, group string, r timeutil.TimeRange, takt time.Duration) (TaktReport, error) {
+	rep := TaktReport{Line: line, Group: group, From: timeutil.FormatLocal(r.Start), To: timeutil.FormatLocal(r.End),
+		TaktSeconds: takt.Seconds()}
+	intervals, err := p.history.Intervals(ctx, line, group, r)
+	if err != nil {
+		return rep, err
+	}
+	var perUnit []float64
+	for _, iv := range intervals {
+		units := max(iv.Units, 1)
+		s := iv.Seconds / float64(units)
+		for i := 0; i < units; i++ {
+			perUnit = append(perUnit, s)
+		}
+		if s <= rep.TaktSeconds {
+			rep.WithinTakt += units
+		}
+	}
+	rep.Units = len(perUnit)
+	if rep.Units == 0 {
+		return rep, nil
+	}
+	sort.Float64s(perUnit)
+	rep.MedianSeconds = median(perUnit)
+	rep.P90Seconds = perUnit[int(math.Ceil(0.9*float64(len(perUnit))))-1]
+	rep.Adherence = float64(rep.WithinTakt) / float64(rep.Units)
+	return rep, nil
+}
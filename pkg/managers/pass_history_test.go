@@ -0,0 +1,67 @@
+package managers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"hex_toolset/pkg/db"
+	"hex_toolset/pkg/db/entities"
+	"hex_toolset/pkg/timeutil"
+)
+
+func TestIntegrationPassHistoryTakt(t *testing.T) {
+	resetState(t)
+	history := NewPassHistory(db.GetDB(), 2, nil)
+	if err := history.Apply(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = entities.NewPassHistoryManager(db.GetDB()).SetEnabled(false)
+		_, _ = db.GetDB().Exec("DELETE FROM pass_history")
+	})
+	records := entities.NewRecordManagerEntity(db.GetDB())
+	pass := func(ppid string, at time.Duration, errorFlag bool) entities.RecordEntity {
+		return entities.RecordEntity{PPID: ppid, WorkOrder: "MO1", CollectedTimestamp: base.Add(at), GroupName: "PACKING",
+			LineName: "J01", StationName: "PACK01", ModelName: "MODELX", ErrorFlag: errorFlag}
+	}
+	if err := records.InsertBatch([]entities.RecordEntity{
+		pass("P1", 0, false),
+		pass("P2", 30*time.Second, false),
+		pass("P3", 30*time.Second, false), // two units in the same second
+		pass("P4", 45*time.Second, true),  // failures are not passes
+		pass("P5", 90*time.Second, false),
+		pass("P6", 100*time.Second, false),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	rep, err := history.Takt(context.Background(), "J01", "PACKING", timeutil.Hour(base), 20*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// per unit: 15 15 (30s shared by two units), 60, 10
+	if rep.Units != 4 || rep.MedianSeconds != 15 || rep.P90Seconds != 60 || rep.WithinTakt != 3 || rep.Adherence != 0.75 {
+		t.Fatalf("takt report = %+v", rep)
+	}
+
+	removed, err := history.Compact(context.Background())
+	if err != nil || removed != 2 {
+		t.Fatalf("compact removed %d, %v; want 2", removed, err)
+	}
+	if rep, _ := history.Takt(context.Background(), "J01", "PACKING", timeutil.Hour(base), 20*time.Second); rep.Units != 1 {
+		t.Fatalf("after compaction %d units, want the one interval between the two newest passes", rep.Units)
+	}
+
+	// Disabled, passes are no longer recorded.
+	if err := NewPassHistory(db.GetDB(), 0, nil).Apply(); err != nil {
+		t.Fatal(err)
+	}
+	if err := records.InsertBatch([]entities.RecordEntity{pass("P7", 2*time.Minute, false)}); err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	if err := db.GetDB().QueryRow("SELECT COUNT(*) FROM pass_history").Scan(&n); err != nil || n != 2 {
+		t.Fatalf("pass_history rows = %d, %v; want 2", n, err)
+	}
+}
@@ -0,0 +1,136 @@
+package managers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"hex_toolset/pkg/db/entities"
+	"hex_toolset/pkg/timeutil"
+)
+
+// MaxProgramRange bounds the range of a program rollup; each day is aggregated from raw
+// records.
+const MaxProgramRange = 92 * 24 * time.Hour
+
+// ProgramDay is the output and yield of one customer program on one local day.
+type ProgramDay struct {
+	Day string `json:"day"` // YYYY-MM-DD local
+	entities.ProgramCount
+	// Yield is the share of the units tested that day without a failing record; 0 without
+	// units tested.
+	Yield float64 `json:"yield"`
+}
+
+// ProgramTotal sums the days of one customer program; Yield is computed from the sums.
+type ProgramTotal struct {
+	Customer string  `json:"customer"`
+	Program  string  `json:"program"`
+	Units    int     `json:"units"`
+	Tested   int     `json:"tested"`
+	Failed   int     `json:"failed"`
+	Yield    float64 `json:"yield"`
+}
+
+// ProgramReport is the program rollup of a time range, for management reviews by customer
+// program rather than by line.
+type ProgramReport struct {
+	From        string         `json:"from"` // 'YYYY-MM-DD HH:MM:SS' local
+	To          string         `json:"to"`
+	OutputGroup string         `json:"output_group"`
+	Days        []ProgramDay   `json:"days"`
+	Totals      []ProgramTotal `json:"totals"`
+}
+
+// ProgramRollup aggregates units and yield per customer program and day by joining the
+// records' work orders with the work order metadata (customer, program), so a change of
+// a work order's program applies to its past records too. Units are the distinct units
+// passing outputGroup; records of work orders without metadata roll up under an empty
+// customer and program, so the totals reconcile with the line figures.
+type ProgramRollup struct {
+	entity      *entities.EnrichmentManager
+	outputGroup string
+}
+
+// NewProgramRollup creates the program rollup of database counting the passes of
+// outputGroup (e.g. PACKING) as output.
+func NewProgramRollup(database *sql.DB, outputGroup string) *ProgramRollup {
+	return &ProgramRollup{entity: entities.NewEnrichmentManager(database), outputGroup: outputGroup}
+}
+
+// Report aggregates every local day overlapping tr, cut to tr, optionally of one customer
+// and program (case-insensitive; "" for all).
+func (p *ProgramRollup) Report(ctx context.Context, tr timeutil.TimeRange, customer, program string) (ProgramReport, error) {
+	rep := ProgramReport{From: timeutil.FormatLocal(tr.Start), To: timeutil.FormatLocal(tr.End),
+		OutputGroup: p.outputGroup, Days: []ProgramDay{}, Totals: []ProgramTotal{}}
+	totals := map[[2]string]*ProgramTotal{}
+	local := timeutil.TimeRange{Start: tr.Start.In(time.Local), End: tr.End.In(time.Local)}
+	for _, day := range local.Days() {
+		span := timeutil.Day(day)
+		if span.Start.Before(tr.Start) {
+			span.Start = tr.Start
+		}
+		if span.End.After(tr.End) {
+			span.End = tr.End
+		}
+		counts, err := p.entity.ProgramCounts(ctx, span, p.outputGroup)
+		if err != nil {
+			return rep, err
+		}
+		for _, c := range counts {
+			if customer != "" && !strings.EqualFold(c.Customer, customer) || program != "" && !strings.EqualFold(c.Program, program) {
+				continue
+			}
+			rep.Days = append(rep.Days, ProgramDay{Day: day.Format(time.DateOnly), ProgramCount: c, Yield: yield(c.Tested, c.Failed)})
+			key := [2]string{c.Customer, c.Program}
+			t := totals[key]
+			if t == nil {
+				t = &ProgramTotal{Customer: c.Customer, Program: c.Program}
+				totals[key] = t
+			}
+			t.Units += c.Units
+			t.Tested += c.Tested
+			t.Failed += c.Failed
+		}
+	}
+	for _, t := range totals {
+		t.Yield = yield(t.Tested, t.Failed)
+		rep.Totals = append(rep.Totals, *t)
+	}
+	sort.Slice(rep.Totals, func(i, j int) bool {
+		a, b := rep.Totals[i], rep.Totals[j]
+		if a.Customer != b.Customer {
+			return a.Customer < b.Customer
+		}
+		return a.Program < b.Program
+	})
+	return rep, nil
+}
+
+func yield(tested, failed int) float64 {
+	if tested == 0 {
+		return 0
+	}
+	return float64(tested-failed) / float64(tested)
+}
+
+// WriteCSV writes the days of rep as CSV with a header row, for spreadsheets.
+func (rep ProgramReport) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"day", "customer", "program", "work_orders", "units", "tested", "failed", "yield"})
+	for _, d := range rep.Days {
+		_ = cw.Write([]string{d.Day, d.Customer, d.Program, strconv.Itoa(d.WorkOrders), strconv.Itoa(d.Units),
+			strconv.Itoa(d.Tested), strconv.Itoa(d.Failed), strconv.FormatFloat(d.Yield, 'f', 4, 64)})
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("write program rollup: %w", err)
+	}
+	return nil
+}
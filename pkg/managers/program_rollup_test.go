@@ -0,0 +1,95 @@
+package managers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"hex_toolset/pkg/db"
+	"hex_toolset/pkg/db/entities"
+	skylogger "hex_toolset/pkg/logger"
+	"hex_toolset/pkg/timeutil"
+)
+
+func TestIntegrationProgramRollup(t *testing.T) {
+	resetState(t)
+	ctx := context.Background()
+	e := NewEnricher(db.GetDB(), time.Minute, nil)
+	for _, wo := range []string{"MO1", "MO2"} {
+		if err := e.SetWorkOrder(ctx, wo, "ACME", "X1", 100); err != nil {
+			t.Fatal(err)
+		}
+	}
+	records := entities.NewRecordManagerEntity(db.GetDB())
+	rec := func(ppid, wo, group string, at time.Duration, errorFlag bool) entities.RecordEntity {
+		return entities.RecordEntity{PPID: ppid, WorkOrder: wo, CollectedTimestamp: base.Add(at), GroupName: group,
+			LineName: "J01", StationName: group + "01", ModelName: "MODELX", ErrorFlag: errorFlag}
+	}
+	if err := records.InsertBatch([]entities.RecordEntity{
+		rec("U1", "MO1", "FT", 0, false),
+		rec("U1", "MO1", "PACKING", time.Minute, false),
+		rec("U2", "MO1", "FT", 0, true), // retested: a failure of the day
+		rec("U2", "MO1", "FT", 2*time.Minute, false),
+		rec("U2", "MO1", "PACKING", 3*time.Minute, false),
+		rec("U3", "MO2", "FT", 0, false), // tested, not yet packed
+		rec("U4", "MO9", "PACKING", 0, false),
+		rec("U5", "MO2", "PACKING", 24*time.Hour, false),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	lgr, _ := skylogger.New(skylogger.WithName("test_admin"))
+	admin := NewAdminServer("127.0.0.1:0", lgr)
+	admin.HandleProgramRollup(NewProgramRollup(db.GetDB(), "packing"))
+	day := timeutil.Day(base.In(time.Local))
+	get := func(query string) *httptest.ResponseRecorder {
+		t.Helper()
+		q := url.Values{"from": {timeutil.FormatLocal(day.Start)}, "to": {timeutil.FormatLocal(day.Start.AddDate(0, 0, 2))}}
+		req := httptest.NewRequest(http.MethodGet, "/api/programs/daily?"+q.Encode()+query, nil)
+		w := httptest.NewRecorder()
+		admin.server.Handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("")
+	var rep ProgramReport
+	if err := json.Unmarshal(w.Body.Bytes(), &rep); w.Code != http.StatusOK || err != nil {
+		t.Fatalf("status %d, %v: %s", w.Code, err, w.Body)
+	}
+	day1, day2 := day.Start.Format(time.DateOnly), day.Start.AddDate(0, 0, 1).Format(time.DateOnly)
+	acme := func(wos, units, tested, failed int) entities.ProgramCount {
+		return entities.ProgramCount{Customer: "ACME", Program: "X1", WorkOrders: wos, Units: units, Tested: tested, Failed: failed}
+	}
+	want := []ProgramDay{
+		{Day: day1, ProgramCount: entities.ProgramCount{WorkOrders: 1, Units: 1, Tested: 1}, Yield: 1},
+		{Day: day1, ProgramCount: acme(2, 2, 3, 1), Yield: 2.0 / 3},
+		{Day: day2, ProgramCount: acme(1, 1, 1, 0), Yield: 1},
+	}
+	if !reflect.DeepEqual(rep.Days, want) {
+		t.Fatalf("days = %+v, want %+v", rep.Days, want)
+	}
+	if len(rep.Totals) != 2 || rep.Totals[1] != (ProgramTotal{Customer: "ACME", Program: "X1", Units: 3, Tested: 4, Failed: 1, Yield: 0.75}) {
+		t.Fatalf("totals = %+v", rep.Totals)
+	}
+
+	// A program's work orders changing program move their past records along.
+	if err := e.SetWorkOrder(ctx, "MO2", "ACME", "X2", 100); err != nil {
+		t.Fatal(err)
+	}
+	w = get("&customer=acme&program=x2&format=csv")
+	wantCSV := "day,customer,program,work_orders,units,tested,failed,yield\n" +
+		day1 + ",ACME,X2,1,0,1,0,1.0000\n" +
+		day2 + ",ACME,X2,1,1,1,0,1.0000\n"
+	if w.Code != http.StatusOK || w.Body.String() != wantCSV || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/csv") {
+		t.Fatalf("csv: status %d %q\n%s", w.Code, w.Header().Get("Content-Type"), w.Body)
+	}
+	if w := get("&format=xml"); w.Code != http.StatusBadRequest {
+		t.Fatalf("format=xml: status %d", w.Code)
+	}
+}
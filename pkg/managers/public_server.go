@@ -0,0 +1,243 @@
+package managers
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"hex_toolset/pkg/api"
+	"hex_toolset/pkg/db/entities"
+	"hex_toolset/pkg/logger"
+	"hex_toolset/pkg/timeutil"
+)
+
+// Fields a public snapshot line may expose; "line" is always included.
+const (
+	PublicFieldOutputToday = "output_today" // passing units at the output group since midnight
+	PublicFieldOutputHour  = "output_hour"  // passing units at the output group in the current hour
+	PublicFieldFailToday   = "fail_today"   // failing units at the output group since midnight
+	PublicFieldStatus      = "status"       // running, idle or no_data
+	PublicFieldLastPass    = "last_pass"    // latest passing timestamp at any group
+)
+
+var publicFields = []string{PublicFieldOutputToday, PublicFieldOutputHour, PublicFieldFailToday, PublicFieldStatus, PublicFieldLastPass}
+
+// Line statuses reported by the public snapshot.
+const (
+	LineRunning = "running"
+	LineIdle    = "idle"
+	LineNoData  = "no_data"
+)
+
+// PublicOptions configures the public snapshot (see the PUBLIC_* settings).
+type PublicOptions struct {
+	Fields      []string
+	OutputGroup string
+	CacheTTL    time.Duration
+	RatePerMin  int
+	IdleAfter   time.Duration
+}
+
+// ParsePublicFields parses a comma separated allowlist, rejecting unknown fields.
+func ParsePublicFields(s string) ([]string, error) {
+	var out []string
+	for _, f := range strings.Split(s, ",") {
+		f = strings.ToLower(strings.TrimSpace(f))
+		if f == "" || f == "line" {
+			continue
+		}
+		known := false
+		for _, k := range publicFields {
+			known = known || k == f
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown public field %q (known: %s)", f, strings.Join(publicFields, ", "))
+		}
+		out = append(out, f)
+	}
+	return out, nil
+}
+
+// PublicSnapshot is the body of GET /public/snapshot.
+type PublicSnapshot struct {
+	GeneratedAt string           `json:"generated_at"`
+	Lines       []map[string]any `json:"lines"`
+}
+
+// PublicServer serves the unauthenticated lobby-display snapshot. It runs on its own
+// listener and mux, separate from the admin endpoint, and exposes nothing but coarse
+// per-line aggregates restricted to the configured field allowlist. The snapshot is
+// computed at most once per CacheTTL and served with ETag/Cache-Control so a caching
+// proxy in front of it can absorb display traffic.
+type PublicServer struct {
+	server  *http.Server
+	log     *logger.Logger
+	opts    PublicOptions
+	records *entities.RecordEntityManager
+	latest  *entities.LatestPassManager
+
+	mu      sync.Mutex
+	body    []byte
+	etag    string
+	expires time.Time
+}
+
+// NewPublicServer creates a public snapshot server listening on addr.
+func NewPublicServer(addr string, db *sql.DB, opts PublicOptions, lgr *logger.Logger) *PublicServer {
+	s := &PublicServer{
+		log:     lgr,
+		opts:    opts,
+		records: entities.NewRecordManagerEntity(db),
+		latest:  entities.NewLatestPassManager(db),
+	}
+	mux := api.NewRouter()
+	mux.HandleFunc("GET /public/snapshot", s.handleSnapshot)
+	s.server = &http.Server{
+		Addr:         addr,
+		Handler:      api.Middleware(api.NewRateLimiter(opts.RatePerMin).Wrap(mux), lgr),
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 10 * time.Second,
+		IdleTimeout:  60 * time.Second,
+	}
+	return s
+}
+
+// Run serves until ctx is done, then shuts the server down.
+func (s *PublicServer) Run(ctx context.Context) {
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = s.server.Shutdown(shutdownCtx)
+	}()
+	s.log.Infof("public snapshot listening on %s (fields: %s)", s.server.Addr, strings.Join(s.opts.Fields, ","))
+	if err := s.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		s.log.Errorf("public server error: %v", err)
+	}
+}
+
+func (s *PublicServer) handleSnapshot(w http.ResponseWriter, r *http.Request) error {
+	body, etag, expires, err := s.cached(r.Context())
+	if err != nil {
+		return err
+	}
+	maxAge := int(time.Until(expires).Seconds())
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(max(maxAge, 0)))
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(body)
+	return nil
+}
+
+// cached returns the encoded snapshot, rebuilding it once the TTL has passed. Concurrent
+// requests during a rebuild wait for it instead of querying the DB themselves.
+func (s *PublicServer) cached(ctx context.Context) ([]byte, string, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if s.body != nil && now.Before(s.expires) {
+		return s.body, s.etag, s.expires, nil
+	}
+	snap, err := s.build(ctx, now)
+	if err != nil {
+		return nil, "", time.Time{}, err
+	}
+	body, err := json.Marshal(snap)
+	if err != nil {
+		return nil, "", time.Time{}, err
+	}
+	sum := sha256.Sum256(body)
+	s.body, s.etag, s.expires = body, `"`+hex.EncodeToString(sum[:8])+`"`, now.Add(s.opts.CacheTTL)
+	return s.body, s.etag, s.expires, nil
+}
+
+func (s *PublicServer) build(ctx context.Context, now time.Time) (PublicSnapshot, error) {
+	now = now.In(time.Local)
+	day, hour := timeutil.Day(now), timeutil.Hour(now)
+
+	today, err := s.records.CountByLineGroup(day.DBStart(), day.DBEnd())
+	if err != nil {
+		return PublicSnapshot{}, err
+	}
+	thisHour, err := s.records.CountByLineGroup(hour.DBStart(), hour.DBEnd())
+	if err != nil {
+		return PublicSnapshot{}, err
+	}
+	latest, err := s.latest.LatestByLine(ctx)
+	if err != nil {
+		return PublicSnapshot{}, err
+	}
+
+	type agg struct{ today, hour, fail int }
+	lines := map[string]*agg{}
+	line := func(name string) *agg {
+		if lines[name] == nil {
+			lines[name] = &agg{}
+		}
+		return lines[name]
+	}
+	for _, c := range today {
+		a := line(c.LineName)
+		if strings.EqualFold(c.GroupName, s.opts.OutputGroup) {
+			a.today += c.Units
+			a.fail += c.FailUnits
+		}
+	}
+	for _, c := range thisHour {
+		if strings.EqualFold(c.GroupName, s.opts.OutputGroup) {
+			line(c.LineName).hour += c.Units
+		}
+	}
+	for name := range latest {
+		line(name)
+	}
+
+	names := make([]string, 0, len(lines))
+	for name := range lines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	snap := PublicSnapshot{GeneratedAt: now.Format(timeutil.DBLayout), Lines: make([]map[string]any, 0, len(names))}
+	for _, name := range names {
+		a := lines[name]
+		values := map[string]any{
+			PublicFieldOutputToday: a.today,
+			PublicFieldOutputHour:  a.hour,
+			PublicFieldFailToday:   a.fail,
+			PublicFieldStatus:      s.lineStatus(latest[name], now),
+			PublicFieldLastPass:    timeutil.LocalDB(latest[name]),
+		}
+		entry := map[string]any{"line": name}
+		for _, f := range s.opts.Fields {
+			entry[f] = values[f]
+		}
+		snap.Lines = append(snap.Lines, entry)
+	}
+	return snap, nil
+}
+
+func (s *PublicServer) lineStatus(last string, now time.Time) string {
+	t, err := timeutil.ParseDB(last)
+	if err != nil {
+		return LineNoData
+	}
+	if now.Sub(t) > s.opts.IdleAfter {
+		return LineIdle
+	}
+	return LineRunning
+}
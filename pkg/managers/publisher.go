@@ -0,0 +1,189 @@
+package managers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"hex_toolset/pkg/ipc"
+	"hex_toolset/pkg/topics"
+	ws "hex_toolset/pkg/websocket"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/google/uuid"
+)
+
+// Publisher delivers a payload on a broadcast topic. Implementations own the envelope,
+// serialization and transport, so managers only decide what to publish and when.
+type Publisher interface {
+	Publish(topic string, v any) error
+}
+
+// PublisherFunc adapts a function to Publisher.
+type PublisherFunc func(topic string, v any) error
+
+func (f PublisherFunc) Publish(topic string, v any) error { return f(topic, v) }
+
+// validateTopic rejects topics missing from the catalog so typos fail loudly instead of
+// producing messages no client subscribes to.
+func validateTopic(topic string) error {
+	if _, ok := topics.Lookup(topic); !ok {
+		return fmt.Errorf("publish: unknown topic %q", topic)
+	}
+	return nil
+}
+
+// EncodeEnvelope serializes v wrapped in the { "massage_type", "massage", "meta" } envelope.
+func EncodeEnvelope(topic string, v any) ([]byte, error) {
+	b, err := json.Marshal(NewEnvelope(topic, v))
+	if err != nil {
+		return nil, fmt.Errorf("publish %s: marshal: %w", topic, err)
+	}
+	return b, nil
+}
+
+// FilePublisher writes each message as a timestamped envelope file into MESSAGE_DIR,
+// where the broadcast service picks it up and relays it to websocket clients.
+type FilePublisher struct {
+	store *StoreFileManager
+}
+
+// NewFilePublisher creates a publisher on top of store.
+func NewFilePublisher(store *StoreFileManager) *FilePublisher {
+	return &FilePublisher{store: store}
+}
+
+func (p *FilePublisher) Publish(topic string, v any) error {
+	if p == nil || p.store == nil {
+		return errors.New("publish: file publisher has no store")
+	}
+	if err := validateTopic(topic); err != nil {
+		return err
+	}
+	if _, err := p.store.SaveWithTimestampWrapped(strings.ToLower(topic), topic, v); err != nil {
+		return fmt.Errorf("publish %s: %w", topic, err)
+	}
+	return nil
+}
+
+// HubPublisher broadcasts envelopes directly to the clients of an in-process websocket hub.
+type HubPublisher struct {
+	hub *ws.Hub
+}
+
+// NewHubPublisher creates a publisher broadcasting on hub.
+func NewHubPublisher(hub *ws.Hub) *HubPublisher {
+	return &HubPublisher{hub: hub}
+}
+
+func (p *HubPublisher) Publish(topic string, v any) error {
+	if err := validateTopic(topic); err != nil {
+		return err
+	}
+	b, err := EncodeEnvelope(topic, v)
+	if err != nil {
+		return err
+	}
+	if err := p.hub.Broadcast(b); err != nil {
+		return fmt.Errorf("publish %s: %w", topic, err)
+	}
+	return nil
+}
+
+// IPCPublisher sends envelopes to the broadcast service over the local IPC socket and falls
+// back to another publisher (normally the FilePublisher) for messages the socket could not
+// take, so a stopped or restarting broadcast service still gets them through MESSAGE_DIR.
+type IPCPublisher struct {
+	client   *ipc.Client
+	fallback Publisher
+}
+
+// NewIPCPublisher creates a publisher on the socket at path.
+func NewIPCPublisher(path string, fallback Publisher) *IPCPublisher {
+	return &IPCPublisher{client: ipc.NewClient(path), fallback: fallback}
+}
+
+func (p *IPCPublisher) Publish(topic string, v any) error {
+	if err := validateTopic(topic); err != nil {
+		return err
+	}
+	b, err := EncodeEnvelope(topic, v)
+	if err != nil {
+		return err
+	}
+	if err := p.client.Send(b); err == nil || p.fallback == nil {
+		return err
+	}
+	return p.fallback.Publish(topic, v)
+}
+
+// Close closes the IPC connection.
+func (p *IPCPublisher) Close() error { return p.client.Close() }
+
+// MQTTPublisher publishes envelopes to an MQTT broker, one MQTT topic per broadcast topic
+// (prefix + topic, e.g. hex_toolset/LAST_HOUR), at QoS 1 so a broker restart loses nothing
+// acknowledged. The client reconnects on its own; a publish while disconnected fails.
+type MQTTPublisher struct {
+	client  mqtt.Client
+	prefix  string
+	timeout time.Duration
+}
+
+// NewMQTTPublisher connects to the broker at url (tcp://[user:password@]host:1883, ssl://
+// or ws://) and publishes under prefix.
+func NewMQTTPublisher(url, prefix string) (*MQTTPublisher, error) {
+	p := &MQTTPublisher{prefix: prefix, timeout: 5 * time.Second}
+	opts := mqtt.NewClientOptions().AddBroker(strings.TrimSpace(url)).
+		SetClientID("hex_toolset-" + uuid.NewString()).
+		SetConnectTimeout(p.timeout).
+		SetAutoReconnect(true).
+		SetMaxReconnectInterval(30 * time.Second)
+	p.client = mqtt.NewClient(opts)
+	if err := p.wait(p.client.Connect()); err != nil {
+		return nil, fmt.Errorf("mqtt connect %s: %w", url, err)
+	}
+	return p, nil
+}
+
+func (p *MQTTPublisher) Publish(topic string, v any) error {
+	if err := validateTopic(topic); err != nil {
+		return err
+	}
+	b, err := EncodeEnvelope(topic, v)
+	if err != nil {
+		return err
+	}
+	if err := p.wait(p.client.Publish(p.prefix+topic, 1, false, b)); err != nil {
+		return fmt.Errorf("publish %s: mqtt: %w", topic, err)
+	}
+	return nil
+}
+
+func (p *MQTTPublisher) wait(tok mqtt.Token) error {
+	if !tok.WaitTimeout(p.timeout) {
+		return fmt.Errorf("no answer within %s", p.timeout)
+	}
+	return tok.Error()
+}
+
+// Close disconnects from the broker, leaving a second for queued publishes.
+func (p *MQTTPublisher) Close() error {
+	p.client.Disconnect(1000)
+	return nil
+}
+
+// MultiPublisher publishes to every wrapped publisher (e.g. file and hub) and returns
+// the joined errors of those that failed.
+type MultiPublisher []Publisher
+
+func (mp MultiPublisher) Publish(topic string, v any) error {
+	var errs []error
+	for _, p := range mp {
+		if err := p.Publish(topic, v); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
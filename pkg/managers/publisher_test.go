@@ -0,0 +1,164 @@
+package managers
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type published struct {
+	topic string
+	v     any
+}
+
+func recordPublishes(out *[]published) PublisherFunc {
+	return func(topic string, v any) error {
+		*out = append(*out, published{topic, v})
+		return nil
+	}
+}
+
+func TestPublishers(t *testing.T) {
+	// A topic missing from the catalog fails before reaching any transport.
+	if err := NewIPCPublisher(filepath.Join(t.TempDir(), "none.sock"), nil).Publish("LAST_HOURS", nil); err == nil ||
+		!strings.Contains(err.Error(), "unknown topic") {
+		t.Errorf("unknown topic: %v", err)
+	}
+
+	// Without a broadcast service on the socket the IPC publisher falls back.
+	var fallback []published
+	ipcPub := NewIPCPublisher(filepath.Join(t.TempDir(), "none.sock"), recordPublishes(&fallback))
+	if err := ipcPub.Publish(TopicLastHour, map[string]int{"J06_PACKING": 3}); err != nil {
+		t.Fatal(err)
+	}
+	if len(fallback) != 1 || fallback[0].topic != TopicLastHour {
+		t.Errorf("fallback got %v", fallback)
+	}
+
+	// MultiPublisher reaches every transport and joins the errors of those failing.
+	var first []published
+	broken := PublisherFunc(func(string, any) error { return errors.New("broken") })
+	err := MultiPublisher{recordPublishes(&first), broken, broken}.Publish(TopicWIP, map[string]int{})
+	if len(first) != 1 || err == nil || strings.Count(err.Error(), "broken") != 2 {
+		t.Errorf("multi publish: %v, %v", first, err)
+	}
+}
+
+// fakeMQTT is an MQTT 3.1.1 broker accepting any CONNECT and acknowledging QoS 1 publishes,
+// which it hands to got.
+type fakeMQTT struct {
+	ln  net.Listener
+	got chan published
+}
+
+func newFakeMQTT(t *testing.T) *fakeMQTT {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	b := &fakeMQTT{ln: ln, got: make(chan published, 16)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(conn)
+		}
+	}()
+	return b
+}
+
+func (b *fakeMQTT) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		header, err := r.ReadByte()
+		if err != nil {
+			return
+		}
+		size, err := readRemainingLength(r)
+		if err != nil {
+			return
+		}
+		body := make([]byte, size)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return
+		}
+		switch header >> 4 {
+		case 1: // CONNECT
+			_, _ = conn.Write([]byte{0x20, 2, 0, 0})
+		case 3: // PUBLISH
+			n := int(binary.BigEndian.Uint16(body))
+			topic, rest := string(body[2:2+n]), body[2+n:]
+			if qos := header >> 1 & 3; qos > 0 {
+				_, _ = conn.Write([]byte{0x40, 2, rest[0], rest[1]})
+				rest = rest[2:]
+			}
+			b.got <- published{topic, string(rest)}
+		case 12: // PINGREQ
+			_, _ = conn.Write([]byte{0xd0, 0})
+		case 14: // DISCONNECT
+			return
+		}
+	}
+}
+
+func readRemainingLength(r *bufio.Reader) (int, error) {
+	n, shift := 0, 0
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		n |= int(c&0x7f) << shift
+		if c&0x80 == 0 {
+			return n, nil
+		}
+		shift += 7
+	}
+}
+
+func TestMQTTPublisher(t *testing.T) {
+	broker := newFakeMQTT(t)
+	pub, err := NewMQTTPublisher("tcp://"+broker.ln.Addr().String(), "plant/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pub.Close()
+
+	if err := pub.Publish(TopicLastHour, map[string]int{"J06_PACKING": 3}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case p := <-broker.got:
+		var env struct {
+			MassageType string         `json:"massage_type"`
+			Massage     map[string]int `json:"massage"`
+		}
+		if err := json.Unmarshal([]byte(p.v.(string)), &env); err != nil {
+			t.Fatal(err)
+		}
+		if p.topic != "plant/LAST_HOUR" || env.MassageType != TopicLastHour || env.Massage["J06_PACKING"] != 3 {
+			t.Errorf("broker got %s %+v", p.topic, env)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("nothing published")
+	}
+
+	if err := pub.Publish("LAST_HOURS", nil); err == nil {
+		t.Error("unknown topic published")
+	}
+	if _, err := NewMQTTPublisher("tcp://127.0.0.1:1", ""); err == nil {
+		t.Error("connected to a closed port")
+	}
+}
@@ -0,0 +1,142 @@
+package managers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"hex_toolset/pkg/api"
+	"hex_toolset/pkg/db/entities"
+	"hex_toolset/pkg/logger"
+	"hex_toolset/pkg/sfc_api"
+)
+
+// ParsePushKeys parses PUSH_KEYS, "collector=secret[,collector=secret]", into the signing
+// secrets by collector (the api.SignatureKeyHeader each collector sends).
+func ParsePushKeys(spec string) (map[string][]byte, error) {
+	secrets, err := parseSecrets(spec, "push key")
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string][]byte, len(secrets))
+	for collector, secret := range secrets {
+		keys[collector] = []byte(secret)
+	}
+	return keys, nil
+}
+
+// PushResult is the response of POST /ingest/records.
+type PushResult struct {
+	Received int `json:"received"`
+	Inserted int `json:"inserted"`
+	Ignored  int `json:"ignored"` // already stored, e.g. fetched from the API first
+}
+
+// PushServer receives records pushed by edge collectors on the shop network, which see
+// units before the SFC API serves them. It runs on its own listener, apart from the admin
+// endpoint, and every request must be signed with its collector's key (api.SignRequest),
+// so collectors authenticate without TLS client certificates:
+//
+//	POST /ingest/records   a JSON array of records in the SFC API's format
+//
+// The minute loop still fetches every minute from the API, which stays the reference.
+type PushServer struct {
+	server *http.Server
+	log    *logger.Logger
+	mgr    *SFCAPIManager
+}
+
+// NewPushServer creates a push ingest server listening on addr that accepts requests
+// signed with one of keys (collector -> secret, see ParsePushKeys) and stores the records
+// through mgr.
+func NewPushServer(addr string, mgr *SFCAPIManager, keys map[string][]byte, lgr *logger.Logger) *PushServer {
+	s := &PushServer{log: lgr, mgr: mgr}
+	mux := api.NewRouter()
+	mux.Handle("POST /ingest/records", api.NewSignatureVerifier(keys, 0).Wrap(api.HandlerFunc(s.handleRecords)))
+	s.server = &http.Server{
+		Addr:         addr,
+		Handler:      api.Middleware(mux, lgr),
+		ReadTimeout:  15 * time.Second,
+		WriteTimeout: 15 * time.Second,
+		IdleTimeout:  60 * time.Second,
+	}
+	return s
+}
+
+// Run serves until ctx is done, then shuts the server down.
+func (s *PushServer) Run(ctx context.Context) {
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = s.server.Shutdown(shutdownCtx)
+	}()
+	s.log.Infof("push ingest listening on %s", s.server.Addr)
+	if err := s.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		s.log.Errorf("push server error: %v", err)
+	}
+}
+
+func (s *PushServer) handleRecords(w http.ResponseWriter, r *http.Request) error {
+	var recs []sfc_api.RecordDataCollector
+	if err := json.NewDecoder(r.Body).Decode(&recs); err != nil {
+		return api.InvalidRequest("invalid JSON body: %v", err)
+	}
+	for i, rec := range recs {
+		if rec.SerialNumber == "" {
+			return api.InvalidRequest("record %d: SERIAL_NUMBER is required", i)
+		}
+		if _, err := sfc_api.ParseAPITimestamp(rec.InStationTime); err != nil {
+			return api.InvalidRequest("record %d: invalid IN_STATION_TIME %q", i, rec.InStationTime)
+		}
+	}
+	stats, err := s.mgr.PushRecords(r.Context(), recs)
+	if err != nil {
+		return fmt.Errorf("push ingest: %w", err)
+	}
+	s.log.Infof("collector %s pushed %d records: %d inserted, %d ignored",
+		r.Header.Get(api.SignatureKeyHeader), len(recs), stats.Inserted, stats.Ignored)
+	api.WriteJSON(w, http.StatusOK, PushResult{Received: len(recs), Inserted: stats.Inserted, Ignored: stats.Ignored})
+	return nil
+}
+
+// PushRecords stores records pushed by a collector, normalized, mapped, filtered and
+// enriched like a fetched minute; records already stored are ignored. The ingest ledger is left alone, so
+// the minutes are still fetched from the API, and the cached minutes they fall in are
+// dropped to be read again from the database.
+func (m *SFCAPIManager) PushRecords(ctx context.Context, recs []sfc_api.RecordDataCollector) (entities.InsertStats, error) {
+	// normalized like the API responses, so pushed records key like the fetched ones
+	for i := range recs {
+		recs[i].LineName = sfc_api.ExtractJLineCode(recs[i].LineName)
+		recs[i].GroupName = strings.ReplaceAll(recs[i].GroupName, " ", "_")
+		recs[i].NextStations = strings.ReplaceAll(recs[i].NextStations, " ", "_")
+	}
+	fresh, err := recordModelToEntity(recs, m.clock.Now())
+	if err != nil {
+		return entities.InsertStats{}, err
+	}
+	fresh = m.dropDisabledLines(fresh, "push")
+	if len(fresh) == 0 {
+		return entities.InsertStats{}, nil
+	}
+	m.enricher.Enrich(fresh)
+	stats, err := m.insertRecords(ctx, fresh, InsertSourcePush)
+	if err != nil {
+		return stats, err
+	}
+	first, last := fresh[0].CollectedTimestamp, fresh[0].CollectedTimestamp
+	for _, r := range fresh[1:] {
+		if r.CollectedTimestamp.Before(first) {
+			first = r.CollectedTimestamp
+		}
+		if r.CollectedTimestamp.After(last) {
+			last = r.CollectedTimestamp
+		}
+	}
+	m.InvalidateCache(first.Truncate(time.Minute), last.Truncate(time.Minute).Add(time.Minute))
+	return stats, nil
+}
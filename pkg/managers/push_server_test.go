@@ -0,0 +1,87 @@
+package managers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"hex_toolset/pkg/api"
+	"hex_toolset/pkg/timeutil"
+)
+
+func TestIntegrationPushIngest(t *testing.T) {
+	resetState(t)
+	m, _ := newTestManager(t)
+	keys, err := ParsePushKeys("edge-j01=j01-secret,edge-j02=j02-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewPushServer("127.0.0.1:0", m, keys, m.logger)
+	push := func(body, key string, secret []byte) (*httptest.ResponseRecorder, *http.Request) {
+		req := httptest.NewRequest(http.MethodPost, "/ingest/records", strings.NewReader(body))
+		if key != "" {
+			if err := api.SignRequest(req, key, secret, time.Now()); err != nil {
+				t.Fatal(err)
+			}
+		}
+		w := httptest.NewRecorder()
+		s.server.Handler.ServeHTTP(w, req)
+		return w, req
+	}
+	body := func(ppids ...string) string {
+		var recs []string
+		for i, ppid := range ppids {
+			recs = append(recs, `{"SERIAL_NUMBER":"`+ppid+`","LINE_NAME":"LINE J01","GROUP_NAME":"PACKING","STATION_NAME":"PACK01",`+
+				`"MODEL_NAME":"MODELX","MO_NUMBER":"MO1","ERROR_FLAG":"0","IN_STATION_TIME":"`+
+				base.Add(time.Duration(i)*time.Second).Format(timeutil.DBLayout)+`"}`)
+		}
+		return "[" + strings.Join(recs, ",") + "]"
+	}
+	minute := timeutil.Minute(base)
+
+	// Unsigned, unknown collectors and the wrong secret are refused before anything is stored.
+	for name, w := range map[string]*httptest.ResponseRecorder{
+		"unsigned":     recorder(push(body("P1"), "", nil)),
+		"unknown key":  recorder(push(body("P1"), "edge-j09", []byte("j01-secret"))),
+		"wrong secret": recorder(push(body("P1"), "edge-j01", []byte("j02-secret"))),
+	} {
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("%s push = %d %s", name, w.Code, w.Body)
+		}
+	}
+	if got := storedIDs(t, minute); len(got) != 0 {
+		t.Fatalf("refused pushes stored %d records", len(got))
+	}
+
+	// A signed push is stored; the same records pushed again are ignored.
+	w, req := push(body("P1", "P2"), "edge-j01", keys["edge-j01"])
+	var res PushResult
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil || w.Code != http.StatusOK || res != (PushResult{Received: 2, Inserted: 2}) {
+		t.Fatalf("push = %d %s", w.Code, w.Body)
+	}
+	if got := storedIDs(t, minute); len(got) != 2 {
+		t.Fatalf("stored %d pushed records, want 2", len(got))
+	}
+	w, _ = push(body("P1", "P2"), "edge-j02", keys["edge-j02"])
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil || res != (PushResult{Received: 2, Ignored: 2}) {
+		t.Fatalf("second push = %d %s", w.Code, w.Body)
+	}
+
+	// A captured request cannot be replayed.
+	replay := httptest.NewRequest(http.MethodPost, "/ingest/records", strings.NewReader(body("P1", "P2")))
+	replay.Header = req.Header.Clone()
+	rw := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rw, replay)
+	if rw.Code != http.StatusUnauthorized {
+		t.Fatalf("replayed push = %d %s", rw.Code, rw.Body)
+	}
+
+	if w, _ := push(`[{"SERIAL_NUMBER":"P3"}]`, "edge-j01", keys["edge-j01"]); w.Code != http.StatusBadRequest {
+		t.Fatalf("push without a timestamp = %d %s", w.Code, w.Body)
+	}
+}
+
+func recorder(w *httptest.ResponseRecorder, _ *http.Request) *httptest.ResponseRecorder { return w }
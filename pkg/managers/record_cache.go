@@ -0,0 +1,100 @@
+package managers
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	pkgcfg "hex_toolset/pkg"
+	"hex_toolset/pkg/db/entities"
+)
+
+// RecordCache keeps the records fetched for the most recent minutes, keyed by minute.
+// An entry with no records means "fetched, upstream returned nothing" and still counts
+// as cached. Entries are evicted oldest-minute first once capacity is exceeded.
+type RecordCache struct {
+	mu       sync.RWMutex
+	capacity int
+	minutes  map[int64][]entities.RecordEntity // key: unix minute
+}
+
+// NewRecordCache creates a cache holding at most capacity minutes; capacity <= 0 uses
+// pkg.DefaultRecordCacheMinutes.
+func NewRecordCache(capacity int) *RecordCache {
+	if capacity <= 0 {
+		capacity = pkgcfg.DefaultRecordCacheMinutes
+	}
+	return &RecordCache{capacity: capacity, minutes: make(map[int64][]entities.RecordEntity)}
+}
+
+func minuteKey(t time.Time) int64 { return t.Unix() / 60 }
+
+// Put stores the records fetched for minute, replacing any previous entry.
+func (c *RecordCache) Put(minute time.Time, recs []entities.RecordEntity) {
+	cp := append([]entities.RecordEntity(nil), recs...)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.minutes[minuteKey(minute)] = cp
+	if len(c.minutes) <= c.capacity {
+		return
+	}
+	keys := make([]int64, 0, len(c.minutes))
+	for k := range c.minutes {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	for _, k := range keys[:len(keys)-c.capacity] {
+		delete(c.minutes, k)
+	}
+}
+
+// Get returns the cached records for minute.
+func (c *RecordCache) Get(minute time.Time) ([]entities.RecordEntity, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	recs, ok := c.minutes[minuteKey(minute)]
+	if !ok {
+		return nil, false
+	}
+	return append([]entities.RecordEntity(nil), recs...), true
+}
+
+// Range returns the cached records for every minute in [start, end).
+// complete is false if any minute in the range is missing from the cache.
+func (c *RecordCache) Range(start, end time.Time) (recs []entities.RecordEntity, complete bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	complete = true
+	for k := minuteKey(start); k < minuteKey(end); k++ {
+		m, ok := c.minutes[k]
+		if !ok {
+			complete = false
+			continue
+		}
+		recs = append(recs, m...)
+	}
+	return recs, complete
+}
+
+// Invalidate drops every cached minute in [start, end) and returns how many were dropped.
+// Callers that rewrite stored data (backfill, hour reloads) must invalidate first.
+func (c *RecordCache) Invalidate(start, end time.Time) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	from, to := minuteKey(start), minuteKey(end)
+	for k := range c.minutes {
+		if k >= from && k < to {
+			delete(c.minutes, k)
+			n++
+		}
+	}
+	return n
+}
+
+// Len returns the number of cached minutes.
+func (c *RecordCache) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.minutes)
+}
@@ -0,0 +1,63 @@
+package managers
+
+import (
+	"testing"
+	"time"
+
+	pkgcfg "hex_toolset/pkg"
+	"hex_toolset/pkg/db/entities"
+)
+
+func TestRecordCache(t *testing.T) {
+	t0 := time.Date(2025, 3, 10, 8, 0, 0, 0, time.UTC)
+	at := func(i int) time.Time { return t0.Add(time.Duration(i) * time.Minute) }
+	recs := func(ppids ...string) []entities.RecordEntity {
+		var out []entities.RecordEntity
+		for _, p := range ppids {
+			out = append(out, entities.RecordEntity{PPID: p})
+		}
+		return out
+	}
+
+	c := NewRecordCache(3)
+	in := recs("U1", "U2")
+	c.Put(at(0).Add(30*time.Second), in) // keyed by its minute
+	in[0].PPID = "changed"
+	c.Put(at(1), nil) // fetched, nothing upstream
+	if got, ok := c.Get(at(0)); !ok || len(got) != 2 || got[0].PPID != "U1" {
+		t.Fatalf("Get = %+v, %v; want the records as put", got, ok)
+	}
+	if got, ok := c.Get(at(1)); !ok || len(got) != 0 {
+		t.Fatalf("empty minute = %+v, %v; want cached without records", got, ok)
+	}
+	if _, ok := c.Get(at(2)); ok {
+		t.Fatal("minute never put is cached")
+	}
+	if got, complete := c.Range(at(0), at(2)); !complete || len(got) != 2 {
+		t.Fatalf("Range = %+v, %v", got, complete)
+	}
+	if _, complete := c.Range(at(0), at(3)); complete {
+		t.Fatal("Range with a missing minute is complete")
+	}
+
+	// Over capacity the oldest minutes go first, whatever the order they were put in.
+	c.Put(at(5), recs("U5"))
+	c.Put(at(3), recs("U3"))
+	if _, ok := c.Get(at(0)); ok || c.Len() != 3 {
+		t.Fatalf("after eviction: minute 0 cached %v, len %d", ok, c.Len())
+	}
+	if _, ok := c.Get(at(1)); !ok {
+		t.Fatal("minute 1 evicted before the oldest")
+	}
+
+	if n := c.Invalidate(at(1), at(4)); n != 2 || c.Len() != 1 {
+		t.Fatalf("Invalidate dropped %d, len %d; want 2 and 1", n, c.Len())
+	}
+	if _, ok := c.Get(at(5)); !ok {
+		t.Fatal("minute after the invalidated range dropped")
+	}
+
+	if c := NewRecordCache(0); c.capacity != pkgcfg.DefaultRecordCacheMinutes {
+		t.Errorf("default capacity = %d", c.capacity)
+	}
+}
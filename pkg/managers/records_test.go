@@ -0,0 +1,284 @@
+package managers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"hex_toolset/pkg/db"
+	"hex_toolset/pkg/db/entities"
+	"hex_toolset/pkg/db/migrations"
+	"hex_toolset/pkg/timeutil"
+)
+
+func TestIntegrationInsertBatchCancel(t *testing.T) {
+	resetState(t)
+	m, _ := newTestManager(t)
+	re := m.recordEntity
+	re.SetInsertChunk(2)
+	defer re.SetInsertChunk(0)
+	var recs []entities.RecordEntity
+	for i := range 5 {
+		recs = append(recs, entities.RecordEntity{PPID: fmt.Sprintf("P%d", i), WorkOrder: "MO1", LineName: "J01",
+			GroupName: "PACKING", StationName: "PACK01", ModelName: "M", CollectedTimestamp: base.Add(time.Duration(i) * time.Second)})
+	}
+	hour := timeutil.Hour(base)
+
+	// cancelled before the first chunk: nothing written
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if stats, err := re.InsertBatchStats(ctx, recs); !errors.Is(err, context.Canceled) || stats.Inserted != 0 {
+		t.Fatalf("insert with a cancelled context = %+v, %v", stats, err)
+	}
+	if got := storedIDs(t, hour); len(got) != 0 {
+		t.Fatalf("stored %d records from a cancelled batch", len(got))
+	}
+
+	// cancelled after the first chunk: it stays committed, the rest is not written
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	re.SetInsertProgress(func(done, total int) { cancel() })
+	stats, err := re.InsertBatchStats(ctx, recs)
+	re.SetInsertProgress(nil)
+	var partial *entities.PartialInsertError
+	if !errors.As(err, &partial) || !errors.Is(err, context.Canceled) || partial.Remaining != 3 || stats.Inserted != 2 {
+		t.Fatalf("insert cancelled after a chunk = %+v, %v", stats, err)
+	}
+	if got := storedIDs(t, hour); len(got) != 2 {
+		t.Fatalf("stored %d records, want the 2 of the committed chunk", len(got))
+	}
+
+	// the retry completes the batch, ignoring what was committed
+	if stats, err := re.InsertBatchStats(context.Background(), recs); err != nil || stats.Inserted != 3 || stats.Ignored != 2 {
+		t.Fatalf("retried insert = %+v, %v; want 3 inserted, 2 ignored", stats, err)
+	}
+	if got := storedIDs(t, hour); len(got) != 5 {
+		t.Fatalf("stored %d records, want 5", len(got))
+	}
+}
+
+func TestIntegrationRecordPages(t *testing.T) {
+	resetState(t)
+	m, _ := newTestManager(t)
+	fake.add(base, 3)
+	fake.addLine(base, "J02", 3) // same timestamps as J01; the id breaks the tie
+	fake.add(base.Add(time.Minute), 3)
+	m.RequestMinute(base)
+	m.RequestMinute(base.Add(time.Minute))
+	want := storedIDs(t, timeutil.Hour(base))
+
+	admin := NewAdminServer("127.0.0.1:0", m.logger)
+	admin.HandleRecords(db.GetDB())
+	get := func(query string) (*httptest.ResponseRecorder, entities.RecordPage) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		admin.server.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/records?"+query, nil))
+		var page entities.RecordPage
+		if w.Code == http.StatusOK {
+			if err := json.NewDecoder(w.Body).Decode(&page); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return w, page
+	}
+
+	from := url.QueryEscape(base.Format(timeutil.DBLayout))
+	var got []string
+	var sizes []int
+	cursor := ""
+	for {
+		w, page := get("from=" + from + "&limit=4&cursor=" + cursor)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", w.Code, w.Body)
+		}
+		sizes = append(sizes, len(page.Records))
+		for _, r := range page.Records {
+			got = append(got, r.ID)
+		}
+		if page.Next == "" {
+			break
+		}
+		cursor = page.Next
+	}
+	if fmt.Sprint(sizes) != "[4 4 1]" {
+		t.Fatalf("page sizes = %v, want [4 4 1]", sizes)
+	}
+	sort.Strings(got)
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("paged ids = %v, want %v", got, want)
+	}
+
+	if w, _ := get("from=" + from + "&cursor=bogus"); w.Code != http.StatusBadRequest {
+		t.Fatalf("invalid cursor answered %d, want 400", w.Code)
+	}
+	if w, _ := get("from=" + from + "&limit=0"); w.Code != http.StatusBadRequest {
+		t.Fatalf("limit=0 answered %d, want 400", w.Code)
+	}
+}
+
+func TestIntegrationLatestGroupOutOfOrder(t *testing.T) {
+	resetState(t)
+	records := entities.NewRecordManagerEntity(db.GetDB())
+	groups := entities.NewLatestGroupManager(db.GetDB())
+	pass := func(ppid, group string, at time.Duration) entities.RecordEntity {
+		return entities.RecordEntity{PPID: ppid, WorkOrder: "MO1", CollectedTimestamp: base.Add(at),
+			GroupName: group, LineName: "J01", StationName: group + "01", ModelName: "MODELX"}
+	}
+	insert := func(recs ...entities.RecordEntity) {
+		t.Helper()
+		if err := records.InsertBatch(recs); err != nil {
+			t.Fatal(err)
+		}
+	}
+	state := func(ppid string) string {
+		t.Helper()
+		lg, err := groups.GetByPPID(ppid)
+		if errors.Is(err, sql.ErrNoRows) {
+			return "gone"
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return lg.GroupName
+	}
+
+	// U1 left the line; a backfill replaying an older WIP pass must not bring it back.
+	insert(pass("U1", "SMT", time.Hour), pass("U1", "IN_STORE", 90*time.Minute))
+	insert(pass("U1", "PACKING", 30*time.Minute))
+	if got := state("U1"); got != "gone" {
+		t.Fatalf("U1 = %s, want gone", got)
+	}
+
+	// U2 was reworked after leaving; replaying the old exit must not wipe its WIP state.
+	insert(pass("U2", "REWORK", time.Hour))
+	insert(pass("U2", "IN_STORE", 30*time.Minute))
+	if got, want := state("U2"), "REWORK"; got != want {
+		t.Fatalf("U2 = %s, want %s", got, want)
+	}
+
+	// U3 arrives out of order within one batch.
+	insert(pass("U3", "IN_STORE", time.Hour), pass("U3", "PACKING", 30*time.Minute))
+	if got := state("U3"); got != "gone" {
+		t.Fatalf("U3 = %s, want gone", got)
+	}
+
+	// U4 never leaves; older WIP passes do not override newer ones.
+	insert(pass("U4", "SMT", 0), pass("U4", "PACKING", 30*time.Minute))
+	insert(pass("U4", "TEST", 15*time.Minute))
+	if got, want := state("U4"), "PACKING"; got != want {
+		t.Fatalf("U4 = %s, want %s", got, want)
+	}
+}
+
+func TestIntegrationUTCMigration(t *testing.T) {
+	resetState(t)
+	conn := db.GetDB()
+	chicago, err := time.LoadLocation("America/Chicago")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exec := func(q string, args ...any) {
+		t.Helper()
+		if _, err := conn.Exec(q, args...); err != nil {
+			t.Fatalf("%s: %v", q, err)
+		}
+	}
+	t.Cleanup(func() {
+		time.Local = time.UTC
+		exec("DELETE FROM record_rollup")
+		exec("DELETE FROM export_state")
+		exec("DROP TABLE " + migrations.Table)
+		for _, s := range entities.Schema(conn) {
+			if err := s.Create(); err != nil {
+				t.Fatalf("schema %s: %v", s.Name, err)
+			}
+		}
+	})
+
+	// A database written before the migrations: local wall-clock time, IDs keyed on it,
+	// latest_pass filled by the trigger.
+	time.Local = chicago
+	legacy := `INSERT INTO records_table (id, ppid, work_order, collected_timestamp, employee_name, group_name,
+		line_name, station_name, model_name, error_flag) VALUES (?, ?, 'MO1', ?, ?, 'PACKING', 'J01', 'PACK01', 'MODELX', 0)`
+	exec(legacy, "legacy-1", "P1", "2025-01-15 12:00:00", "E1")
+	exec(legacy, "legacy-2", "P2", "2025-03-10 08:00:00", nil)
+	exec(legacy, "legacy-3", "P3", "2025-11-02 01:30:00", "E1")
+	// the same pass stored again with its milliseconds, which the converted ID drops
+	exec(legacy, "legacy-4", "P3", "2025-11-02 01:30:00.400", "E1")
+	exec(`INSERT INTO record_rollup (hour, line_name, group_name, station_name, units, fail_units) VALUES
+		('2025-03-10 08:00:00', 'J01', 'PACKING', 'PACK01', 5, 0),
+		('2025-03-10 13:00:00', 'J01', 'PACKING', 'PACK01', 7, 1)`)
+	if err := entities.NewExportStateManager(conn).Reset("lake", "2025-03-10 08:00:00"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	applied, err := migrations.Migrate(ctx, conn, migrations.Options{})
+	if err != nil || len(applied) != 2 || applied[1].Name != "utc_timestamps" {
+		t.Fatalf("migrate = %+v, %v", applied, err)
+	}
+	if applied, err := migrations.Migrate(ctx, conn, migrations.Options{}); err != nil || len(applied) != 0 {
+		t.Fatalf("second migrate = %+v, %v", applied, err)
+	}
+	if err := entities.CheckSchema(ctx, conn); err != nil {
+		t.Fatalf("schema after the migration: %v", err)
+	}
+	rows, err := conn.Query(`SELECT id, ppid, strftime('%Y-%m-%d %H:%M:%S', collected_timestamp), employee_name IS NULL
+		FROM records_table ORDER BY ppid`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for rows.Next() {
+		var id, ppid, ts string
+		var nullEmployee bool
+		if err := rows.Scan(&id, &ppid, &ts, &nullEmployee); err != nil {
+			t.Fatal(err)
+		}
+		at, _ := timeutil.ParseDB(ts)
+		want := entities.RecordID(entities.RecordEntity{PPID: ppid, CollectedTimestamp: at, LineName: "J01", StationName: "PACK01", GroupName: "PACKING"})
+		if id != want {
+			t.Fatalf("%s: id %s, want recomputed %s", ppid, id, want)
+		}
+		got = append(got, fmt.Sprintf("%s %s null=%v", ppid, ts, nullEmployee))
+	}
+	rows.Close()
+	want := []string{"P1 2025-01-15 18:00:00 null=false", "P2 2025-03-10 13:00:00 null=true", "P3 2025-11-02 06:30:00 null=false"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("records = %v, want %v", got, want)
+	}
+
+	latest, err := entities.NewLatestPassManager(conn).GetMap()
+	if err != nil || latest["J01_PACKING"] != "2025-11-02 06:30:00" {
+		t.Fatalf("latest_pass = %v, %v", latest, err)
+	}
+	if st, err := entities.NewExportStateManager(conn).Get("lake"); err != nil || st.Watermark != "2025-03-10 13:00:00" {
+		t.Fatalf("watermark = %q, %v", st.Watermark, err)
+	}
+	hours := map[string]int{}
+	rows, err = conn.Query("SELECT hour, units FROM record_rollup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+		var h string
+		var units int
+		if err := rows.Scan(&h, &units); err != nil {
+			t.Fatal(err)
+		}
+		hours[h] = units
+	}
+	rows.Close()
+	if len(hours) != 2 || hours["2025-03-10 13:00:00"] != 5 || hours["2025-03-10 18:00:00"] != 7 {
+		t.Fatalf("rollup hours = %v", hours)
+	}
+}
@@ -0,0 +1,109 @@
+package managers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"hex_toolset/pkg/db/entities"
+	skylogger "hex_toolset/pkg/logger"
+	"hex_toolset/pkg/metrics"
+	"hex_toolset/pkg/timeutil"
+)
+
+// DefaultRetentionBatch is the number of records Prune deletes per transaction.
+const DefaultRetentionBatch = 5000
+
+var (
+	recordsPruned = metrics.NewCounter("records_pruned_total",
+		"Records deleted from records_table by the retention job (RETENTION_DAYS).", nil)
+	lastPrune atomic.Int64 // unix seconds of the last complete Prune
+)
+
+func init() {
+	metrics.Default.Register(recordsPruned)
+	metrics.Default.Register(metrics.NewGaugeFunc("records_pruned_last_run_timestamp_seconds",
+		"Time of the last complete run of the retention job, 0 before the first.", nil,
+		func() float64 { return float64(lastPrune.Load()) }))
+}
+
+// RetentionResult is the outcome of one Prune.
+type RetentionResult struct {
+	Cutoff          time.Time `json:"cutoff"` // records collected before it are deleted
+	Deleted         int64     `json:"deleted"`
+	Batches         int       `json:"batches"`
+	DurationSeconds float64   `json:"duration_seconds"`
+}
+
+// RetentionManager deletes the records_table rows collected more than keepDays days ago,
+// for good: unlike tiering nothing is archived or rolled up, so it bounds the database
+// where the raw history is not needed. The delete runs batch rows per transaction, each
+// short enough that the minute ingest waiting for the connection stays within its budget.
+type RetentionManager struct {
+	records  *entities.RecordEntityManager
+	keepDays int
+	batch    int
+	logger   *skylogger.Logger
+	now      func() time.Time
+}
+
+// NewRetentionManager creates a retention manager keeping keepDays days of records; batch
+// <= 0 uses DefaultRetentionBatch.
+func NewRetentionManager(database *sql.DB, keepDays, batch int, lgr *skylogger.Logger) *RetentionManager {
+	if batch <= 0 {
+		batch = DefaultRetentionBatch
+	}
+	return &RetentionManager{
+		records:  entities.NewRecordManagerEntity(database),
+		keepDays: keepDays,
+		batch:    batch,
+		logger:   lgr,
+		now:      time.Now,
+	}
+}
+
+// Prune deletes the records collected before the start of the local day keepDays days ago.
+// It stops between batches when ctx is done; the batches deleted stay deleted, and the
+// next run carries on from there.
+func (m *RetentionManager) Prune(ctx context.Context) (res RetentionResult, err error) {
+	if m.keepDays <= 0 {
+		return res, fmt.Errorf("retention disabled: keep at least one day")
+	}
+	res.Cutoff = timeutil.Day(m.now().In(time.Local)).Start.AddDate(0, 0, -m.keepDays)
+	start := time.Now()
+	defer func() { res.DurationSeconds = time.Since(start).Seconds() }()
+	for {
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+		n, err := m.records.DeleteBefore(ctx, res.Cutoff, m.batch)
+		if err != nil {
+			return res, err
+		}
+		if n > 0 {
+			res.Batches++
+			res.Deleted += n
+			recordsPruned.Add(uint64(n))
+		}
+		if n < int64(m.batch) {
+			break
+		}
+	}
+	lastPrune.Store(m.now().Unix())
+	if m.logger != nil {
+		m.logger.Infof("retention: deleted %d records collected before %s in %d batches",
+			res.Deleted, timeutil.FormatDB(res.Cutoff), res.Batches)
+	}
+	return res, nil
+}
+
+// Schedule runs Prune every day at hour:minute.
+func (m *RetentionManager) Schedule(lm *LoopsManager, hour, minute int) {
+	lm.StartDailyAt(hour, minute, 0, func(ctx context.Context) {
+		if _, err := m.Prune(ctx); err != nil && m.logger != nil {
+			m.logger.Errorf("retention: %v", err)
+		}
+	})
+}
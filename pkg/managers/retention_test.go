@@ -0,0 +1,67 @@
+package managers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"hex_toolset/pkg/db"
+	"hex_toolset/pkg/db/entities"
+	"hex_toolset/pkg/timeutil"
+)
+
+func TestIntegrationRetention(t *testing.T) {
+	resetState(t)
+	ctx := context.Background()
+
+	// 3 records on each of the 4 days before base's day, 2 so far today
+	var recs []entities.RecordEntity
+	for d := -4; d <= 0; d++ {
+		day := timeutil.Day(base).Start.AddDate(0, 0, d)
+		n := 3
+		if d == 0 {
+			n = 2
+		}
+		for i := 0; i < n; i++ {
+			recs = append(recs, entities.RecordEntity{PPID: fmt.Sprintf("R%d_%d", d, i), WorkOrder: "MO1", LineName: "J01",
+				GroupName: "PACKING", StationName: "PACK01", ModelName: "M", CollectedTimestamp: day.Add(time.Duration(i) * time.Hour)})
+		}
+	}
+	if err := entities.NewRecordManagerEntity(db.GetDB()).InsertBatch(recs); err != nil {
+		t.Fatal(err)
+	}
+
+	before := recordsPruned.Value()
+	m := NewRetentionManager(db.GetDB(), 2, 2, nil)
+	m.now = func() time.Time { return base }
+	res, err := m.Prune(ctx)
+	if err != nil {
+		t.Fatalf("Prune: %v", err)
+	}
+	cutoff := timeutil.Day(base).Start.AddDate(0, 0, -2)
+	if !res.Cutoff.Equal(cutoff) || res.Deleted != 6 || res.Batches != 3 || recordsPruned.Value()-before != 6 {
+		t.Fatalf("Prune = %+v (counter +%d), want the 6 records before %s in 3 batches", res, recordsPruned.Value()-before, cutoff)
+	}
+	if got := storedIDs(t, timeutil.TimeRange{Start: cutoff.AddDate(0, 0, -10), End: cutoff}); len(got) != 0 {
+		t.Fatalf("%d records left before the cutoff", len(got))
+	}
+	if got := storedIDs(t, timeutil.TimeRange{Start: cutoff, End: base.AddDate(0, 0, 1)}); len(got) != 8 {
+		t.Fatalf("%d records kept, want 8", len(got))
+	}
+	if res, err := m.Prune(ctx); err != nil || res.Deleted != 0 || res.Batches != 0 {
+		t.Fatalf("second Prune = %+v, %v; want nothing left to delete", res, err)
+	}
+
+	// a cancelled prune stops before the next batch
+	m.keepDays = 1
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if res, err := m.Prune(cctx); !errors.Is(err, context.Canceled) || res.Deleted != 0 {
+		t.Fatalf("cancelled Prune = %+v, %v", res, err)
+	}
+	if _, err := NewRetentionManager(db.GetDB(), 0, 0, nil).Prune(ctx); err == nil {
+		t.Error("Prune with retention disabled succeeded")
+	}
+}
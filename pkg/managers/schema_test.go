@@ -0,0 +1,184 @@
+package managers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"hex_toolset/pkg/db"
+	"hex_toolset/pkg/db/entities"
+)
+
+func TestIntegrationApplySchema(t *testing.T) {
+	ctx := context.Background()
+	statuses := func(changes []entities.SchemaChange) map[string]string {
+		out := map[string]string{}
+		for _, c := range changes {
+			if c.Status != entities.SchemaSkipped {
+				out[c.Step] = c.Status + " " + strings.Join(c.Objects, ",")
+			}
+		}
+		return out
+	}
+	verify := func(only ...string) map[string]string {
+		t.Helper()
+		changes, err := entities.VerifySchema(ctx, db.GetDB(), only)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return statuses(changes)
+	}
+	for step, st := range verify() {
+		if st != "ok " {
+			t.Fatalf("verify of the full schema: %s %s", step, st)
+		}
+	}
+
+	triggers := entities.NewTriggersManager(db.GetDB())
+	t.Cleanup(func() { _ = triggers.CreateRecordsPassUpsertTrigger() })
+	if _, err := db.GetDB().Exec(`DROP TRIGGER trg_records_pass_upsert`); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"trg_records_pass_upsert": "missing trigger trg_records_pass_upsert", "trg_records_group_upsert": "ok "}
+	if got := verify("triggers"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("verify without the trigger = %v", got)
+	}
+
+	changes, err := entities.ApplySchema(ctx, db.GetDB(), entities.SchemaOptions{Only: []string{"records", "triggers"}})
+	want = map[string]string{"records_table": "unchanged ", "trg_records_pass_upsert": "created trigger trg_records_pass_upsert",
+		"trg_records_group_upsert": "unchanged "}
+	if got := statuses(changes); err != nil || len(changes) != len(entities.Schema(db.GetDB())) || !reflect.DeepEqual(got, want) {
+		t.Fatalf("apply of records and triggers = %v, %v", got, err)
+	}
+
+	changes, err = entities.ApplySchema(ctx, db.GetDB(), entities.SchemaOptions{Only: []string{"latest_group"},
+		DropRecreate: []string{"trg_records_group_upsert"}})
+	want = map[string]string{"latest_group": "unchanged ", "trg_records_group_upsert": "recreated trigger trg_records_group_upsert"}
+	if got := statuses(changes); err != nil || !reflect.DeepEqual(got, want) {
+		t.Fatalf("drop-recreate = %v, %v", got, err)
+	}
+	if _, err := entities.ApplySchema(ctx, db.GetDB(), entities.SchemaOptions{DropRecreate: []string{"records"}}); err == nil {
+		t.Fatal("drop-recreate of a table accepted")
+	}
+	if _, err := entities.ApplySchema(ctx, db.GetDB(), entities.SchemaOptions{Only: []string{"bogus"}}); err == nil {
+		t.Fatal("unknown step accepted")
+	}
+}
+
+func TestIntegrationCheckSchema(t *testing.T) {
+	ctx := context.Background()
+	if err := entities.CheckSchema(ctx, db.GetDB()); err != nil {
+		t.Fatalf("check of the current schema: %v", err)
+	}
+
+	triggers := entities.NewTriggersManager(db.GetDB())
+	t.Cleanup(func() { _ = triggers.CreateRecordsGroupUpsertTrigger() })
+	if _, err := db.GetDB().Exec(`DROP TRIGGER trg_records_group_upsert`); err != nil {
+		t.Fatal(err)
+	}
+	var mismatch *entities.SchemaMismatchError
+	err := entities.CheckSchema(ctx, db.GetDB())
+	if !errors.As(err, &mismatch) || !reflect.DeepEqual(mismatch.Objects, []string{"trigger trg_records_group_upsert (missing)"}) {
+		t.Fatalf("check without a trigger = %v", err)
+	}
+}
+
+func TestIntegrationAnonymize(t *testing.T) {
+	resetState(t)
+	ctx := context.Background()
+	if err := NewEnricher(db.GetDB(), time.Minute, nil).SetWorkOrder(ctx, "MO1", "ACME", "X1", 100); err != nil {
+		t.Fatal(err)
+	}
+	rec := func(ppid, group string, at time.Duration) entities.RecordEntity {
+		return entities.RecordEntity{PPID: ppid, WorkOrder: "MO1", EmployeeName: "Jane Roe", CollectedTimestamp: base.Add(at),
+			GroupName: group, LineName: "J01", StationName: group + "01", ModelName: "MODELX"}
+	}
+	if err := entities.NewRecordManagerEntity(db.GetDB()).InsertBatch([]entities.RecordEntity{
+		rec("SN1", "FT", 0), rec("SN1", "PACKING", time.Minute), rec("SN2", "FT", 0),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := entities.NewAuditLogManager(db.GetDB()).Add(ctx, base, "Jane Roe", "rename", json.RawMessage(`{"ppid":"SN1"}`), "ok"); err != nil {
+		t.Fatal(err)
+	}
+
+	anonymize := func(path, key string) *sql.DB {
+		t.Helper()
+		res, err := entities.Anonymize(ctx, db.GetDB(), path, []byte(key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Records != 3 || res.PPIDs != 2 || res.WorkOrders != 1 || res.Employees != 1 || res.AuditDeleted != 1 {
+			t.Fatalf("result = %+v", res)
+		}
+		cp, err := sql.Open("sqlite", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = cp.Close() })
+		return cp
+	}
+	dir := t.TempDir()
+	cp := anonymize(filepath.Join(dir, "masked.db"), "k1")
+	if _, err := entities.Anonymize(ctx, db.GetDB(), filepath.Join(dir, "masked.db"), []byte("k1")); err == nil {
+		t.Fatal("anonymize over an existing file succeeded")
+	}
+
+	// the same values map to the same tokens across tables, the record IDs follow the new PPIDs
+	rows, err := cp.Query(`SELECT id, ppid, work_order, employee_name, collected_timestamp, line_name, station_name, group_name
+		FROM records_table ORDER BY collected_timestamp, group_name`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ppids []string
+	for rows.Next() {
+		var r entities.RecordEntity
+		if err := rows.Scan(&r.ID, &r.PPID, &r.WorkOrder, &r.EmployeeName, &r.CollectedTimestamp, &r.LineName, &r.StationName, &r.GroupName); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(r.PPID, "P") || r.WorkOrder == "MO1" || !strings.HasPrefix(r.WorkOrder, "WO") ||
+			!strings.HasPrefix(r.EmployeeName, "EMP") || r.ID != entities.RecordID(r) {
+			t.Fatalf("anonymized record = %+v", r)
+		}
+		ppids = append(ppids, r.PPID)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	rows.Close()
+	if len(ppids) != 3 || ppids[0] == ppids[1] || ppids[2] != ppids[0] && ppids[2] != ppids[1] {
+		t.Fatalf("ppids = %v", ppids)
+	}
+	var leaks, audit int
+	if err := cp.QueryRow(`SELECT (SELECT COUNT(*) FROM latest_group WHERE ppid LIKE 'SN%' OR work_order = 'MO1')
+		+ (SELECT COUNT(*) FROM work_order_meta WHERE work_order = 'MO1'), (SELECT COUNT(*) FROM audit_log)`).Scan(&leaks, &audit); err != nil {
+		t.Fatal(err)
+	}
+	if leaks != 0 || audit != 0 {
+		t.Fatalf("%d production identifiers and %d audit entries left", leaks, audit)
+	}
+	var joined int
+	if err := cp.QueryRow(`SELECT COUNT(*) FROM latest_group g JOIN work_order_meta m ON m.work_order = g.work_order
+		WHERE g.ppid IN (SELECT ppid FROM records_table)`).Scan(&joined); err != nil || joined != 2 {
+		t.Fatalf("latest_group rows joining the anonymized tables = %d, %v", joined, err)
+	}
+
+	// the key decides the tokens
+	token := func(cp *sql.DB) (ppid string) {
+		t.Helper()
+		if err := cp.QueryRow(`SELECT MIN(ppid) FROM records_table`).Scan(&ppid); err != nil {
+			t.Fatal(err)
+		}
+		return ppid
+	}
+	same, other := anonymize(filepath.Join(dir, "same.db"), "k1"), anonymize(filepath.Join(dir, "other.db"), "k2")
+	if token(same) != token(cp) || token(other) == token(cp) {
+		t.Fatalf("tokens: %s with k1, %s again with k1, %s with k2", token(cp), token(same), token(other))
+	}
+}
@@ -6,17 +6,17 @@ import (
 	"errors"
 	"fmt"
 	pkgcfg "hex_toolset/pkg"
+	"hex_toolset/pkg/bus"
 	"hex_toolset/pkg/db"
 	"hex_toolset/pkg/db/entities"
 	skylogger "hex_toolset/pkg/logger"
 	"hex_toolset/pkg/sfc_api"
-	"log"
+	"hex_toolset/pkg/timeutil"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"time"
-
-	"github.com/google/uuid"
 )
 
 type SFCAPIManager struct {
@@ -25,7 +25,27 @@ type SFCAPIManager struct {
 	logger       *skylogger.Logger
 	recordEntity *entities.RecordEntityManager
 	lastEntity   *entities.LatestPassManager
-	store        *StoreFileManager
+	groupEntity  *entities.LatestGroupManager
+	ledger       *entities.IngestLedgerManager
+	publisher    Publisher
+	alerts       *AlertManager
+	cache        *RecordCache
+	budget       DBBudget
+	flags        *FeatureFlags
+	lines        *LineMaintenance
+	maintenance  *MaintenanceWindows
+	enricher     *Enricher
+	bus          *bus.Bus
+	heartbeat    *Heartbeat
+	clock        timeutil.Clock
+	claims       *IngestClaims
+
+	// lastErrorLog is the time (unix nanoseconds) of the last Error entry of logger.
+	lastErrorLog atomic.Int64
+
+	// lastUpdateSent is the LAST_UPDATE state last published, the base of delta broadcasts.
+	lastUpdateSent map[string]string
+	lastUpdateHour time.Time
 }
 
 func NewSFCAPIManager(
@@ -46,21 +66,166 @@ func NewSFCAPIManager(
 
 	storeManager, err := NewStoreFileManager()
 	if err != nil {
-		log.Fatalf("failed to create StoreFileManager: %v", err)
+		lgr.Fatalf("failed to create StoreFileManager: %v", err)
 	}
 
 	entityManager := entities.NewLatestPassManager(db.GetDB())
+	publisher := NewFilePublisher(storeManager)
 
-	return &SFCAPIManager{
+	m := &SFCAPIManager{
 		client:       sfc_api.NewAPIClient(),
 		ctx:          *ctx,
 		logger:       lgr,
 		recordEntity: record,
 		lastEntity:   entityManager,
-		store:        storeManager,
+		groupEntity:  entities.NewLatestGroupManager(db.GetDB()),
+		ledger:       entities.NewIngestLedgerManager(db.GetDB()),
+		publisher:    publisher,
+		alerts:       NewAlertManager(publisher, lgr),
+		cache:        NewRecordCache(pkgcfg.GetConfig().RECORD_CACHE_MINUTES),
+		budget:       DefaultDBBudget(),
+		clock:        timeutil.SystemClock,
+		claims:       NewIngestClaims(db.GetDB(), ProcessOwner(), lgr),
+		bus:          bus.New(lgr),
+		flags: NewFeatureFlags(db.GetDB(), time.Duration(pkgcfg.GetConfig().FEATURE_FLAG_TTL_SECONDS)*time.Second,
+			publisher, lgr),
+	}
+	m.lines = NewLineMaintenance(db.GetDB(), time.Duration(pkgcfg.GetConfig().FEATURE_FLAG_TTL_SECONDS)*time.Second,
+		publisher, lgr)
+	if m.maintenance, err = NewMaintenanceWindows(db.GetDB(), pkgcfg.GetConfig().MAINTENANCE_WINDOWS,
+		time.Duration(pkgcfg.GetConfig().FEATURE_FLAG_TTL_SECONDS)*time.Second, publisher, lgr); err != nil {
+		lgr.Errorf("invalid MAINTENANCE_WINDOWS, daily maintenance windows disabled: %v", err)
+		m.maintenance, _ = NewMaintenanceWindows(db.GetDB(), "",
+			time.Duration(pkgcfg.GetConfig().FEATURE_FLAG_TTL_SECONDS)*time.Second, publisher, lgr)
+	}
+	m.alerts.SetMaintenance(m.maintenance)
+	m.alerts.SetBus(m.bus)
+	m.flags.SetBus(m.bus)
+	m.lines.SetBus(m.bus)
+	m.enricher = NewEnricher(db.GetDB(), time.Duration(pkgcfg.GetConfig().FEATURE_FLAG_TTL_SECONDS)*time.Second, lgr)
+	record.SetUpsert(func() bool { return m.flags.Enabled(FlagRecordsUpsert) })
+	cfg := pkgcfg.GetConfig()
+	m.client.SetBackupURL(strings.TrimSpace(cfg.SFC_API_BACKUP))
+	m.client.SetBreaker(cfg.SFC_API_BREAKER_FAILURES, time.Duration(cfg.SFC_API_BREAKER_COOLDOWN_SECONDS)*time.Second)
+	m.client.SetMinuteConcurrency(cfg.SFC_MINUTE_CONCURRENCY)
+	m.client.SetMaxHourBytes(int64(cfg.SFC_HOUR_MAX_BYTES))
+	m.client.SetLatencyAlertHandler(m.onLatencyAlert)
+	m.client.SetFailoverHandler(m.onFailover)
+	lgr.RegisterHook(skylogger.Error, m.onErrorLogged)
+	return m
+}
+
+// SetPublisher replaces the publisher used for live updates and alerts (file publisher by default).
+func (m *SFCAPIManager) SetPublisher(p Publisher) {
+	m.publisher = p
+	m.alerts.SetPublisher(p)
+	m.flags.SetPublisher(p)
+	m.lines.SetPublisher(p)
+	m.maintenance.SetPublisher(p)
+}
+
+// Publisher returns the publisher used for live updates and alerts.
+func (m *SFCAPIManager) Publisher() Publisher { return m.publisher }
+
+// Bus returns the event bus the manager and its alerts, feature flags and line maintenance
+// publish on (MinuteIngested, HourRepaired, BackfillComplete, AlertRaised, AlertResolved,
+// ConfigChanged), for other subsystems to subscribe to.
+func (m *SFCAPIManager) Bus() *bus.Bus { return m.bus }
+
+// SetHeartbeat makes RequestMinute rewrite hb after every live minute cycle.
+func (m *SFCAPIManager) SetHeartbeat(hb *Heartbeat) { m.heartbeat = hb }
+
+// SetClock sets the clock of the manager and its API client: the current hour of delta
+// broadcasts, the previous minute and the fallback timestamp of undated records.
+func (m *SFCAPIManager) SetClock(c timeutil.Clock) {
+	if c == nil {
+		return
+	}
+	m.clock = c
+	m.client.SetClock(c)
+	m.maintenance.now = c.Now
+}
+
+// Flags returns the feature flags consulted by the manager.
+func (m *SFCAPIManager) Flags() *FeatureFlags { return m.flags }
+
+// Enrichment returns the ingest stage stamping records with registry and work order metadata.
+func (m *SFCAPIManager) Enrichment() *Enricher { return m.enricher }
+
+// Lines returns the lines disabled for maintenance, whose records the manager drops.
+func (m *SFCAPIManager) Lines() *LineMaintenance { return m.lines }
+
+// Maintenance returns the planned maintenance windows, during which alerts are suppressed.
+func (m *SFCAPIManager) Maintenance() *MaintenanceWindows { return m.maintenance }
+
+// RecentRecords returns the cached records for [start, end) without touching the DB or API.
+// complete is false if any minute in the range is not cached.
+func (m *SFCAPIManager) RecentRecords(start, end time.Time) ([]entities.RecordEntity, bool) {
+	return m.cache.Range(start, end)
+}
+
+// InvalidateCache drops cached minutes in [start, end); used before any backfill rewrites them.
+func (m *SFCAPIManager) InvalidateCache(start, end time.Time) {
+	if n := m.cache.Invalidate(start, end); n > 0 {
+		m.logger.Infof("record cache invalidated %d minute(s) in [%s, %s)", n, start.Format(time.DateTime), end.Format(time.DateTime))
 	}
 }
 
+// Alerts returns the alert manager used by this manager.
+func (m *SFCAPIManager) Alerts() *AlertManager { return m.alerts }
+
+// onLatencyAlert turns SFC API p95 degradation/recovery into alerts.
+func (m *SFCAPIManager) onLatencyAlert(a sfc_api.LatencyAlert) {
+	key := "sfc_api_latency_" + string(a.Endpoint)
+	if a.Degraded {
+		m.alerts.Raise(key, SeverityWarning, "sfc_api",
+			fmt.Sprintf("%s endpoint p95 %s above %s since %s (%d samples)",
+				a.Endpoint, a.P95.Round(time.Millisecond), a.Threshold, a.Since.Format(time.RFC3339), a.Samples))
+		return
+	}
+	m.alerts.Resolve(key, fmt.Sprintf("%s endpoint p95 recovered to %s", a.Endpoint, a.P95.Round(time.Millisecond)))
+}
+
+// onFailover raises an alert while the SFC API is served by the backup instance.
+func (m *SFCAPIManager) onFailover(e sfc_api.FailoverEvent) {
+	const key = "sfc_api_failover"
+	if e.FailedOver {
+		m.alerts.Raise(key, SeverityWarning, "sfc_api",
+			fmt.Sprintf("primary SFC API %s failed %d times in a row; using backup %s", e.From, e.Failures, e.To))
+		return
+	}
+	m.alerts.Resolve(key, fmt.Sprintf("primary SFC API %s recovered; failed back from %s", e.To, e.From))
+}
+
+// errorLogQuiet is how long the manager must go without logging an error before the
+// errorLogAlert is resolved.
+const (
+	errorLogAlert = "sfc_api_errors_logged"
+	errorLogQuiet = 10 * time.Minute
+)
+
+// onErrorLogged raises an alert for the Error entries of the manager's logger, which the
+// alert manager, the flags and the other helpers share, so failures reach the ALERT topic
+// instead of only the log file. The alert is a warning: raising it logs below Error and
+// does not come back through the hook.
+func (m *SFCAPIManager) onErrorLogged(e skylogger.Entry) {
+	m.lastErrorLog.Store(e.Time.UnixNano())
+	msg := e.Msg
+	if err, ok := e.Fields[skylogger.ErrorKey].(string); ok {
+		msg += ": " + err // logged with ErrorE
+	}
+	m.alerts.Raise(errorLogAlert, SeverityWarning, "sfc_api", "error logged: "+msg)
+}
+
+// resolveErrorLogAlert resolves the errorLogAlert once no error was logged for errorLogQuiet.
+func (m *SFCAPIManager) resolveErrorLogAlert() {
+	last := m.lastErrorLog.Load()
+	if last == 0 || time.Since(time.Unix(0, last)) < errorLogQuiet {
+		return
+	}
+	m.alerts.Resolve(errorLogAlert, fmt.Sprintf("no errors logged for %s", errorLogQuiet))
+}
+
 func (m *SFCAPIManager) UpdateLostMinutes() {
 	cfg := pkgcfg.GetConfig()
 	statusDir := strings.TrimSpace(cfg.SFC_DB_STATUS)
@@ -98,14 +263,13 @@ func (m *SFCAPIManager) UpdateLostMinutes() {
 			remaining = append(remaining, line)
 			continue
 		}
-		recs, rerr := m.client.RequestMinute(m.ctx, min)
+		n, rerr := m.ingestMinute(m.ctx, min, entities.IngestSourceRepair)
 		if rerr != nil {
 			m.logger.Errorf("retry minute failed %s: %v", min, rerr)
 			remaining = append(remaining, line)
 			continue
 		}
-		// Action not defined yet; per log. We consider successful if no error returned.
-		m.logger.Infof("retry minute succeeded %s, records: %d", min.Format(layoutNew), len(recs))
+		m.logger.Infof("retry minute succeeded %s, records: %d", min.Format(layoutNew), n)
 	}
 	if serr := scanner.Err(); serr != nil {
 		m.logger.Errorf("scanner error reading status file: %v", serr)
@@ -159,118 +323,344 @@ func (m *SFCAPIManager) persistFailedMinute(minute time.Time) {
 	}
 }
 
-func (m *SFCAPIManager) RequestMinute(time time.Time) {
-	// You can use the minute argument to request the exact window you need.
-	// For now, this is a placeholder where you'd call your client with the minute.
-	// Example:
-	// date := minute.Format("02-Jan-2006")
-	// hour := minute.Hour()
-	// min := minute.Minute()
-	// recs, err := m.client.RequestMinuteData(m.ctx, date, hour, min)
-	// handle recs/err...
-	fmt.Printf("Requesting minute %s\n", time)
+// RequestMinute ingests one live minute on the manager's context and publishes the live topics.
+func (m *SFCAPIManager) RequestMinute(time time.Time) { m.RequestMinuteContext(m.ctx, time) }
+
+// RequestMinuteContext is RequestMinute on ctx, logging with the fields of ctx (e.g. the
+// job_id of the minute loop run) so the lines of one minute load can be found together.
+func (m *SFCAPIManager) RequestMinuteContext(ctx context.Context, time time.Time) {
+	lg := m.logger.WithContext(ctx)
+	lg.Debugf("requesting minute %s", time.Format(timeutil.MinuteLayout))
 
-	recs, err := m.client.RequestMinute(m.ctx, time)
+	// maintenance windows start and end with the clock, whether records arrive or not
+	m.maintenance.PublishActive()
+	m.alerts.ReleaseSuppressed()
+	m.resolveErrorLogAlert()
+
+	n, err := m.ingestMinute(ctx, time, entities.IngestSourceLive)
 	if err != nil {
-		m.logger.Errorf("Error requesting minute data: %v", err)
-		// error requesting minute data
+		lg.ErrorE(err, "live minute failed", "minute", timeutil.FormatLocal(time))
+		// error requesting or storing minute data
 		m.persistFailedMinute(time)
+		m.beat(time, HeartbeatFailed, err)
 		return
 	}
-
-	if len(recs) == 0 {
-		m.logger.Warnf("No records found for minute %s", time)
+	if n == 0 {
+		if win, ok := m.maintenance.Active(""); ok {
+			lg.Infof("No records found for minute %s during %s", time, win)
+		} else {
+			lg.Warnf("No records found for minute %s", time)
+		}
+		m.beat(time, HeartbeatEmpty, nil)
 		return
 	}
+	m.beat(time, HeartbeatOK, nil)
 
-	// Insert records into the minute
-
-	mapRecords, err := recordModelToEntity(recs)
+	m.publishLive()
+}
 
+// ingestMinute fetches one minute from the API, stores it and records the outcome in the
+// ingest ledger. It returns the number of records stored. A minute fetched again with the
+// same records (same checksum as in the ledger) is not inserted again; the minute is
+// claimed first, so an ingest of it running elsewhere finishes before.
+func (m *SFCAPIManager) ingestMinute(ctx context.Context, minute time.Time, source string) (int, error) {
+	release, err := m.claims.Acquire(ctx, timeutil.TimeRange{Start: minute, End: minute.Add(time.Minute)}, source)
 	if err != nil {
-		m.logger.Errorf("Error converting records to entities: %v", err)
-		return
+		return 0, fmt.Errorf("Error claiming minute: %w", err)
 	}
-	err = m.recordEntity.InsertBatch(mapRecords)
+	defer release()
+
+	recs, err := m.client.RequestMinute(ctx, minute)
 	if err != nil {
-		m.logger.Errorf("Error inserting records: %v", err)
-		// error inserting records
-		m.persistFailedMinute(time)
-		return
+		m.recordLedger(minute, entities.IngestFailed, 0, source, "", err)
+		return 0, fmt.Errorf("Error requesting minute data: %v", err)
 	}
 
-	// Create a Broadcast file for the minute data
-	// Create a Broadcast file for the hour data
+	// Insert records into the minute
 
-	hour, err := m.recordEntity.GetLastHour()
+	mapRecords, err := recordModelToEntity(recs, m.clock.Now())
 	if err != nil {
+		m.recordLedger(minute, entities.IngestFailed, 0, source, "", err)
+		return 0, fmt.Errorf("Error converting records to entities: %v", err)
+	}
+	mapRecords = m.dropDisabledLines(mapRecords, minute.Format(timeutil.MinuteLayout))
+	m.enricher.Enrich(mapRecords)
+	status := entities.IngestOK
+	if len(recs) == 0 {
+		status = entities.IngestEmpty
+	}
+
+	sum := recordsChecksum(mapRecords)
+	prev, seen := m.storedChecksums(minute, minute.Add(time.Minute))[minute.Truncate(time.Minute).Unix()]
+	if seen && entities.Mutated(prev, sum) {
+		m.flagMutations(timeutil.Hour(minute), []time.Time{minute})
+	}
+	if seen && storedAs(prev, sum) {
+		m.logger.Debugf("minute %s unchanged (%d records); insert skipped", minute.Format(timeutil.MinuteLayout), len(mapRecords))
+	} else if len(mapRecords) > 0 {
+		insertSource := InsertSourceLive
+		if source == entities.IngestSourceRepair {
+			insertSource = InsertSourceBackfill
+		}
+		err = withBudget(ctx, m.budget, DBOpMinuteInsert, func(ctx context.Context) error {
+			_, err := m.insertRecords(ctx, mapRecords, insertSource)
+			return err
+		})
+		if err != nil {
+			m.recordLedger(minute, entities.IngestFailed, 0, source, "", err)
+			return 0, fmt.Errorf("Error inserting records: %v", err)
+		}
+	}
+	m.cache.Put(minute, mapRecords)
+	m.recordLedger(minute, status, len(mapRecords), source, sum, nil)
+	bus.Publish(m.bus, MinuteLoaded{Minute: minute, Records: len(mapRecords), Source: source})
+	return len(mapRecords), nil
+}
+
+func (m *SFCAPIManager) beat(minute time.Time, status string, err error) {
+	if m.heartbeat == nil {
 		return
 	}
+	if herr := m.heartbeat.Beat(minute, status, err); herr != nil {
+		m.logger.Warnf("heartbeat: %v", herr)
+	}
+}
 
-	_, err = m.store.SaveWithTimestampWrapped("minute", "LAST_HOUR", hour)
+func (m *SFCAPIManager) recordLedger(minute time.Time, status entities.IngestStatus, records int, source, checksum string, ingestErr error) {
+	err := withBudget(m.ctx, m.budget, DBOpLedger, func(ctx context.Context) error {
+		return m.ledger.Record(ctx, minute, status, records, source, checksum, ingestErr)
+	})
+	if err != nil {
+		m.logger.Warnf("ingest ledger: %v", err)
+	}
+}
 
-	latest, err := m.lastEntity.GetMap()
+// publishLive publishes LAST_HOUR, WIP and LAST_UPDATE from the current DB state.
+func (m *SFCAPIManager) publishLive() {
+	var hour map[string]int
+	err := withBudget(m.ctx, m.budget, DBOpPublishQuery, func(ctx context.Context) (err error) {
+		hour, err = m.recordEntity.GetLastHourContext(ctx)
+		return err
+	})
 	if err != nil {
-		log.Fatalf("failed to get latest: %v", err)
+		m.logger.ErrorE(err, "live hour query failed")
 		return
 	}
+	disabled := m.lines.Disabled()
+	if err := m.publisher.Publish(TopicLastHour, filterLineKeys(disabled, hour)); err != nil {
+		m.logger.Errorf("%v", err)
+	}
 
-	_, err = m.store.SaveWithTimestampWrapped("last", "LAST_UPDATE", latest)
+	var wip map[string]int
+	err = withBudget(m.ctx, m.budget, DBOpPublishQuery, func(ctx context.Context) (err error) {
+		wip, err = m.groupEntity.GetWIPContext(ctx)
+		return err
+	})
+	if err != nil {
+		m.logger.ErrorE(err, "live wip query failed")
+	} else if err := m.publisher.Publish(TopicWIP, filterLineKeys(disabled, wip)); err != nil {
+		m.logger.Errorf("%v", err)
+	}
 
+	var latest map[string]string
+	err = withBudget(m.ctx, m.budget, DBOpPublishQuery, func(ctx context.Context) (err error) {
+		latest, err = m.lastEntity.GetMapContext(ctx)
+		return err
+	})
+	if err != nil {
+		m.logger.ErrorE(err, "live latest query failed")
+		return
+	}
+	for k, ts := range latest {
+		latest[k] = timeutil.LocalDB(ts) // stored in UTC, broadcast in plant time
+	}
+	topic, payload := m.lastUpdatePayload(filterLineKeys(disabled, latest))
+	if err := m.publisher.Publish(topic, payload); err != nil {
+		m.logger.Errorf("%v", err)
+	}
 }
 
-func (m *SFCAPIManager) RequestHour(t time.Time) {
+// lastUpdatePayload returns the topic and payload of the next LAST_UPDATE publish: latest
+// on LAST_UPDATE, or with delta broadcasts enabled only the LINE_GROUPs whose timestamp
+// changed since the previous publish, on LAST_UPDATE_DELTA. LAST_UPDATE therefore always
+// carries the full map; with deltas it is sent after start and at each new hour to resync
+// late joiners, and clients merging LAST_UPDATE_DELTA into it converge on the full map.
+func (m *SFCAPIManager) lastUpdatePayload(latest map[string]string) (string, map[string]string) {
+	prev := m.lastUpdateSent
+	hour := m.clock.Now().Truncate(time.Hour)
+	m.lastUpdateSent = latest
+	if prev == nil || !hour.Equal(m.lastUpdateHour) || !m.flags.Enabled(FlagDeltaBroadcasts) {
+		m.lastUpdateHour = hour
+		return TopicLastUpdate, latest
+	}
+	delta := map[string]string{}
+	for k, v := range latest {
+		if prev[k] != v {
+			delta[k] = v
+		}
+	}
+	return TopicLastUpdateDelta, delta
+}
 
-	// time gets the previous hour
-	previousHour := t.Add(-1 * time.Hour)
+// RepairResult summarizes a partial-hour repair.
+type RepairResult struct {
+	HourStart time.Time `json:"hour_start"`
+	Until     time.Time `json:"until"`
+	Missing   int       `json:"missing"`
+	Repaired  int       `json:"repaired"`
+	Failed    int       `json:"failed"`
+	Records   int       `json:"records"`
+}
 
-	fmt.Printf("Requesting hour %s\n", previousHour)
+// RepairHour fetches only the minutes of hour's hour, up to until, that the ingest ledger
+// does not show as ingested. Unlike RequestHour/LoadHour nothing is deleted, so dashboards
+// never see the hour's WIP drop while it is being repaired; inserts are idempotent thanks to
+// the records_table unique constraint.
+func (m *SFCAPIManager) RepairHour(ctx context.Context, hour, until time.Time) (RepairResult, error) {
+	hour = hour.In(time.Local)
+	hourStart := time.Date(hour.Year(), hour.Month(), hour.Day(), hour.Hour(), 0, 0, 0, time.Local)
+	end := hourStart.Add(time.Hour)
+	if until.Before(end) {
+		end = until.Truncate(time.Minute)
+	}
+	res := RepairResult{HourStart: hourStart, Until: end}
+	if !end.After(hourStart) {
+		return res, nil
+	}
 
-	recs, err := m.client.RequestHour(m.ctx, previousHour)
+	missing, err := m.ledger.MissingMinutes(hourStart, end)
 	if err != nil {
-		m.logger.Errorf("")
-		return
+		return res, err
+	}
+	res.Missing = len(missing)
+	for _, minute := range missing {
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+		n, err := m.ingestMinute(ctx, minute, entities.IngestSourceRepair)
+		if err != nil {
+			m.logger.Errorf("repair minute %s failed: %v", minute.Format(time.DateTime), err)
+			res.Failed++
+			continue
+		}
+		res.Repaired++
+		res.Records += n
 	}
 
-	if len(recs) == 0 {
-		m.logger.Warnf("No records found for hour %s", previousHour)
+	if res.Missing > 0 {
+		m.logger.Infof("repair hour %s until %s: %d missing, %d repaired, %d failed, %d records",
+			hourStart.Format(time.DateTime), end.Format(time.DateTime), res.Missing, res.Repaired, res.Failed, res.Records)
+		bus.Publish[HourRepaired](m.bus, res)
+	}
+	if res.Records > 0 {
+		m.publishLive()
+	}
+	if res.Failed > 0 {
+		return res, fmt.Errorf("repair completed with %d minute(s) failed", res.Failed)
+	}
+	return res, nil
+}
+
+// AutoRepair runs RepairHour for the hour of minute up to its end every `every` minutes
+// while the auto_backfill flag is on; every <= 0 disables it. db_clon calls it in the minute
+// loop after the live fetch, which keeps the repair from racing the minute being ingested.
+// Failures are logged.
+func (m *SFCAPIManager) AutoRepair(ctx context.Context, minute time.Time, every int) {
+	if every <= 0 || (minute.Minute()+1)%every != 0 || !m.flags.Enabled(FlagAutoBackfill) {
 		return
 	}
+	if _, err := m.RepairHour(ctx, minute, minute.Add(time.Minute)); err != nil {
+		m.logger.Warnf("repair hour of %s: %v", minute.Format(timeutil.MinuteLayout), err)
+	}
+}
 
-	// Delete records from the hour
+// markHourLoaded records a successful whole-hour reload in the ingest ledger with the
+// checksums of its minutes.
+func (m *SFCAPIManager) markHourLoaded(t time.Time, sums map[int64]string) {
+	hour := timeutil.Hour(t.In(time.Local))
+	if err := m.ledger.RecordRange(hour.Start, hour.End, entities.IngestOK, entities.IngestSourceHour, sums); err != nil {
+		m.logger.Warnf("ingest ledger: %v", err)
+	}
+}
 
-	previousHourDB := previousHour.Format("02-Jan-2006 15:04:05")
-	currentHourDB := t.Format("02-Jan-2006 15:04:05")
+// RequestHour reloads the hour before t and reports it to the OnBackfillComplete hooks.
+// ctx bounds the API fetch and the replace; it returns the reload error, already logged.
+func (m *SFCAPIManager) RequestHour(ctx context.Context, t time.Time) error {
+	previousHour := t.Add(-1 * time.Hour)
+	m.logger.Infof("Requesting hour %s", previousHour.Format(timeutil.HourLayout))
 
-	err = m.recordEntity.DeleteRecordRange(previousHourDB, currentHourDB)
+	n, err := m.loadHour(ctx, timeutil.Hour(previousHour), InsertSourceReconcile)
+	failed := 0
 	if err != nil {
-
-		m.logger.Errorf("Error deleting records: %v", err)
-		return
+		m.logger.Errorf("reload hour %s: %v", previousHour.Format(timeutil.HourLayout), err)
+		failed = 1
 	}
+	m.emitBackfill(BackfillPreviousHour, timeutil.Hour(previousHour), n, failed, err)
+	return err
+}
 
-	hour, err := m.client.RequestHour(m.ctx, previousHour)
+// loadHour replaces the stored records of hour with a fresh API fetch under the hour's
+// claim, feeding the insert metrics of source, and returns the records stored; an empty
+// fetch clears the stored hour. The replace is skipped when the ledger checksums or the
+// live cache show the stored hour already holds the fetched records. The hour is fetched
+// once and replaced in one transaction, so a failed fetch or insert leaves it as it was.
+func (m *SFCAPIManager) loadHour(ctx context.Context, hour timeutil.TimeRange, source string) (int, error) {
+	s := hour.Start.Format(timeutil.HourLayout)
+	release, err := m.claims.Acquire(ctx, hour, entities.IngestSourceHour)
 	if err != nil {
-		return
+		return 0, fmt.Errorf("claim hour %s: %w", s, err)
 	}
+	defer release()
 
-	mapRecords, err := recordModelToEntity(hour)
+	recs, err := m.client.RequestHour(ctx, hour.Start)
+	if err != nil {
+		return 0, fmt.Errorf("RequestHour failed for %s: %w", s, err)
+	}
+	if len(recs) == 0 {
+		m.logger.Warnf("No records for hour %s", s)
+	}
 
+	fresh, err := recordModelToEntity(recs, m.clock.Now())
 	if err != nil {
-		m.logger.Errorf("Error converting records to entities: %v", err)
-		return
+		return 0, fmt.Errorf("mapping records failed for %s: %w", s, err)
+	}
+	fresh = m.dropDisabledLines(fresh, s)
+	m.enricher.Enrich(fresh)
+	sums, unchanged := m.checkHour(hour, fresh)
+	if unchanged {
+		m.logger.Infof("hour %s unchanged upstream (%d records); reload skipped", s, len(fresh))
+		return len(fresh), nil
+	}
+	if len(fresh) > 0 {
+		if cached, complete := m.cache.Range(hour.Start, hour.End); complete && recordsChecksum(cached) == recordsChecksum(fresh) {
+			m.logger.Infof("hour %s matches %d cached records; reload skipped", s, len(cached))
+			m.markHourLoaded(hour.Start, sums)
+			return len(cached), nil
+		}
 	}
-	err = m.recordEntity.InsertBatch(mapRecords)
 
-	// successfully got records
+	if _, err := m.replaceHour(ctx, hour, fresh, source); err != nil {
+		return 0, fmt.Errorf("ReplaceHour failed for %s: %w", s, err)
+	}
+	if len(recs) == 0 {
+		if err := m.ledger.RecordRange(hour.Start, hour.End, entities.IngestEmpty, entities.IngestSourceHour, sums); err != nil {
+			m.logger.Warnf("ingest ledger: %v", err)
+		}
+		m.logger.Infof("Cleared range for empty hour %s", s)
+		return 0, nil
+	}
 
+	m.markHourLoaded(hour.Start, sums)
+	m.logger.Infof("Loaded %d records for hour %s", len(fresh), s)
+	return len(fresh), nil
 }
 
-func recordModelToEntity(data []sfc_api.RecordDataCollector) ([]entities.RecordEntity, error) {
+// recordModelToEntity maps API records to entities; records without a parseable timestamp
+// are stamped now.
+func recordModelToEntity(data []sfc_api.RecordDataCollector, now time.Time) ([]entities.RecordEntity, error) {
 	var result []entities.RecordEntity
 	for _, r := range data {
 		entity := entities.RecordEntity{
-			ID:           uuid.New().String(),
 			PPID:         r.SerialNumber,
 			WorkOrder:    r.MoNumber,
 			EmployeeName: r.EmpNo,
@@ -288,109 +678,88 @@ func recordModelToEntity(data []sfc_api.RecordDataCollector) ([]entities.RecordE
 			ts, err = sfc_api.ParseAPITimestamp(r.InLineTime)
 		}
 		if err != nil {
-			entity.CollectedTimestamp = time.Now()
+			entity.CollectedTimestamp = now
 		} else {
 			entity.CollectedTimestamp = ts
 		}
+		entity.ID = entities.RecordID(entity)
 
 		result = append(result, entity)
 	}
 	return result, nil
 }
 
+// LoadDay reloads every hour of date (YYYY-MM-DD) and reports it to the OnBackfillComplete hooks.
 func (m *SFCAPIManager) LoadDay(ctx context.Context, date string) error {
 	// Parse input date as local time zone, hour-beginning will be 00:00 .. 23:00
-	day, err := time.ParseInLocation("2006-01-02", strings.TrimSpace(date), time.Local)
+	day, err := timeutil.ParseDay(date, time.Local)
 	if err != nil {
-		return fmt.Errorf("invalid date %q, expected YYYY-MM-DD: %w", date, err)
+		return err
 	}
 
-	startOfDay := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.Local)
-	var failed int
-	for h := 0; h < 24; h++ {
+	records, failed, err := m.loadDay(ctx, day)
+	m.emitBackfill(BackfillDays, day, records, failed, err)
+	return err
+}
+
+// loadDay reloads the hours of day, returning the records stored and the hours that failed.
+func (m *SFCAPIManager) loadDay(ctx context.Context, day timeutil.TimeRange) (records, failed int, err error) {
+	date := day.Start.Format(timeutil.DayLayout)
+	for h, hourStart := range day.Hours() {
 		select {
 		case <-ctx.Done():
 			m.logger.Warnf("LoadDay canceled for %s: %v", date, ctx.Err())
 			if failed > 0 {
-				return fmt.Errorf("canceled after %d hour(s) failed: %w", failed, ctx.Err())
+				return records, failed, fmt.Errorf("canceled after %d hour(s) failed: %w", failed, ctx.Err())
 			}
-			return ctx.Err()
+			return records, failed, ctx.Err()
 		default:
 		}
 
-		hourStart := startOfDay.Add(time.Duration(h) * time.Hour)
-
-		// 1) Fetch hour data
-		recs, rerr := m.client.RequestHour(ctx, hourStart)
-		if rerr != nil {
-			m.logger.Errorf("RequestHour failed for %s %02d:00: %v", date, h, rerr)
-			failed++
-			continue
-		}
-		if len(recs) == 0 {
-			m.logger.Warnf("No records for %s %02d:00", date, h)
-			continue
-		}
-
-		// Delete records from the hour
-		hourStartDB := hourStart.Format("2006-01-02 15:04:05")
-		hourEndDB := hourStart.Add(time.Hour).Format("2006-01-02 15:04:05")
-
-		err = m.recordEntity.DeleteRecordRange(hourStartDB, hourEndDB)
+		n, err := m.loadHour(ctx, timeutil.Hour(hourStart), InsertSourceBackfill)
 		if err != nil {
-			m.logger.Errorf("DeleteRecordRange failed for %s %02d:00: %v", date, h, err)
-			failed++
-			continue
-		}
-		// 2) Map to entities
-		mapRecords, merr := recordModelToEntity(recs)
-		if merr != nil {
-			m.logger.Errorf("Mapping records failed for %s %02d:00: %v", date, h, merr)
-			failed++
-			continue
-		}
-
-		// 3) Persist
-		if ierr := m.recordEntity.InsertBatch(mapRecords); ierr != nil {
-			m.logger.Errorf("InsertBatch failed for %s %02d:00: %v", date, h, ierr)
+			m.logger.Errorf("%s %02d:00: %v", date, h, err)
 			failed++
 			continue
 		}
-
-		m.logger.Infof("Loaded %d records for %s %02d:00", len(mapRecords), date, h)
+		records += n
 	}
 
 	if failed > 0 {
-		return fmt.Errorf("completed with %d hour(s) failed for %s", failed, date)
+		return records, failed, fmt.Errorf("completed with %d hour(s) failed for %s", failed, date)
 	}
-	return nil
+	return records, 0, nil
 }
 
 func (m *SFCAPIManager) LoadRangeOfDays(ctx context.Context, start string, finish string) error {
-	startDay, err := time.ParseInLocation("2006-01-02", strings.TrimSpace(start), time.Local)
+	startDay, err := timeutil.ParseDay(start, time.Local)
 	if err != nil {
-		return fmt.Errorf("invalid start date %q, expected YYYY-MM-DD: %w", start, err)
+		return fmt.Errorf("start: %w", err)
 	}
-	endDay, err := time.ParseInLocation("2006-01-02", strings.TrimSpace(finish), time.Local)
+	endDay, err := timeutil.ParseDay(finish, time.Local)
 	if err != nil {
-		return fmt.Errorf("invalid finish date %q, expected YYYY-MM-DD: %w", finish, err)
+		return fmt.Errorf("finish: %w", err)
 	}
-	if endDay.Before(startDay) {
+	if endDay.Start.Before(startDay.Start) {
 		return fmt.Errorf("finish date %s is before start date %s", finish, start)
 	}
 
-	var failed int
-	for d := startDay; !d.After(endDay); d = d.AddDate(0, 0, 1) {
-		if err := m.LoadDay(ctx, d.Format("2006-01-02")); err != nil {
-			m.logger.Errorf("LoadDay error for %s: %v", d.Format("2006-01-02"), err)
+	span := timeutil.TimeRange{Start: startDay.Start, End: endDay.End}
+	var records, failedHours, failed int
+	for _, d := range span.Days() {
+		n, f, err := m.loadDay(ctx, timeutil.Day(d))
+		records, failedHours = records+n, failedHours+f
+		if err != nil {
+			m.logger.Errorf("LoadDay error for %s: %v", d.Format(timeutil.DayLayout), err)
 			failed++
 			// continue to next day, aggregating failures
 		}
 	}
 	if failed > 0 {
-		return fmt.Errorf("range load completed with %d day(s) failed", failed)
+		err = fmt.Errorf("range load completed with %d day(s) failed", failed)
 	}
-	return nil
+	m.emitBackfill(BackfillDays, span, records, failedHours, err)
+	return err
 }
 
 // LoadHour loads a single hour given "YYYY-MM-DD HH" (e.g., "2025-08-29 15").
@@ -399,52 +768,50 @@ func (m *SFCAPIManager) LoadHour(dateHour string) error {
 	if s == "" {
 		return fmt.Errorf("dateHour is required in format YYYY-MM-DD HH")
 	}
-	t, err := time.ParseInLocation("2006-01-02 15", s, time.Local)
+	hour, err := timeutil.ParseHour(s, time.Local)
 	if err != nil {
-		return fmt.Errorf("invalid dateHour %q, expected YYYY-MM-DD HH: %w", s, err)
+		return err
 	}
-	hourStart := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, time.Local)
 
-	// Fetch hour data
-	recs, rerr := m.client.RequestHour(m.ctx, hourStart)
-	if rerr != nil {
-		m.logger.Errorf("RequestHour failed for %s: %v", s, rerr)
-		return rerr
-	}
-	if len(recs) == 0 {
-		m.logger.Warnf("No records for %s", s)
-		// still clear DB range to avoid stale data
-	}
-
-	// Delete records for that hour using "YYYY-MM-DD HH:MM:SS"
-	startStr := hourStart.Format("2006-01-02 15:04:05")
-	endStr := hourStart.Add(time.Hour).Format("2006-01-02 15:04:05")
-	if derr := m.recordEntity.DeleteRecordRange(startStr, endStr); derr != nil {
-		m.logger.Errorf("DeleteRecordRange failed for %s: %v", s, derr)
-		return derr
+	records, err := m.loadHour(m.ctx, hour, InsertSourceBackfill)
+	failed := 0
+	if err != nil {
+		m.logger.Errorf("load hour %s: %v", s, err)
+		failed = 1
 	}
+	m.emitBackfill(BackfillHour, hour, records, failed, err)
+	return err
+}
 
-	if len(recs) == 0 {
-		// nothing to insert
-		m.logger.Infof("Cleared range for empty hour %s", s)
-		return nil
+// replaceHour replaces the stored records of hour with recs (keeping those of the lines
+// under maintenance), feeds the insert metrics of source and drops the hour from the cache.
+// On error the stored hour is unchanged.
+func (m *SFCAPIManager) replaceHour(ctx context.Context, hour timeutil.TimeRange, recs []entities.RecordEntity, source string) (entities.ReplaceResult, error) {
+	res, err := m.recordEntity.ReplaceHour(ctx, hour.Start, recs, m.lines.disabledLines()...)
+	if err != nil {
+		return res, err
 	}
+	insertMetricsFor(source).observe(time.Now(), res.InsertStats)
+	m.InvalidateCache(hour.Start, hour.End)
+	return res, nil
+}
 
-	// Map to entities
-	mapRecords, merr := recordModelToEntity(recs)
-	if merr != nil {
-		m.logger.Errorf("Mapping records failed for %s: %v", s, merr)
-		return merr
+// dropDisabledLines removes the records of lines disabled for maintenance; at is the
+// minute or hour they were fetched for, used in the log.
+func (m *SFCAPIManager) dropDisabledLines(recs []entities.RecordEntity, at string) []entities.RecordEntity {
+	kept, dropped := m.lines.filterRecords(recs)
+	if dropped > 0 {
+		m.logger.Debugf("dropped %d record(s) of disabled lines at %s", dropped, at)
 	}
+	return kept
+}
 
-	// Persist
-	if ierr := m.recordEntity.InsertBatch(mapRecords); ierr != nil {
-		m.logger.Errorf("InsertBatch failed for %s: %v", s, ierr)
-		return ierr
+func (m *SFCAPIManager) emitBackfill(kind string, r timeutil.TimeRange, records, failed int, err error) {
+	ev := BackfillComplete{Kind: kind, Range: r, Records: records, Failed: failed}
+	if err != nil {
+		ev.Error = err.Error()
 	}
-
-	m.logger.Infof("Loaded %d records for hour %s", len(mapRecords), hourStart.Format("2006-01-02 15:00:00"))
-	return nil
+	bus.Publish(m.bus, ev)
 }
 
 func parseErrorFlag(flag string) bool {
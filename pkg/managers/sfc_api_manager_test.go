@@ -0,0 +1,552 @@
+package managers
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"hex_toolset/pkg/bus"
+	"hex_toolset/pkg/db"
+	"hex_toolset/pkg/db/entities"
+	"hex_toolset/pkg/timeutil"
+)
+
+func TestIntegrationMinuteIngestion(t *testing.T) {
+	resetState(t)
+	m, rec := newTestManager(t)
+	var events []MinuteLoaded
+	m.OnMinuteLoaded(func(ev MinuteLoaded) { events = append(events, ev) })
+
+	fake.add(base, 3)
+	m.RequestMinute(base)
+
+	if got := storedIDs(t, timeutil.Minute(base)); len(got) != 3 {
+		t.Fatalf("stored %d records, want 3", len(got))
+	}
+	if e := ledgerEntry(t, base); e.Status != entities.IngestOK || e.Records != 3 || e.Source != entities.IngestSourceLive || e.IngestedAt == "" {
+		t.Fatalf("ledger entry = %+v", e)
+	}
+	if !rec.published(TopicLastHour) || !rec.published(TopicLastUpdate) {
+		t.Fatalf("published %v, want LAST_HOUR and LAST_UPDATE", rec.topics)
+	}
+	if len(events) != 1 || events[0].Records != 3 || !events[0].Minute.Equal(base) {
+		t.Fatalf("MinuteLoaded events = %+v", events)
+	}
+	latest, err := entities.NewLatestPassManager(db.GetDB()).LatestByLine(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := base.Add(2 * time.Second).Format(timeutil.DBLayout); latest["J01"] != want {
+		t.Fatalf("latest pass of J01 = %q, want %q", latest["J01"], want)
+	}
+
+	// Fetching the same records again (same checksum) skips the insert altogether.
+	live := insertMetricsFor(InsertSourceLive)
+	inserted, ignored := live.inserted.Value(), live.ignored.Value()
+	m.RequestMinute(base)
+	if d := live.inserted.Value() + live.ignored.Value() - inserted - ignored; d != 0 {
+		t.Fatalf("unchanged re-ingest processed %d records, want 0", d)
+	}
+	if e := ledgerEntry(t, base); e.Attempts != 2 || e.Records != 3 || e.Checksum == "" {
+		t.Fatalf("ledger entry after unchanged re-ingest = %+v", e)
+	}
+
+	// A changed minute is inserted again without duplicating records; the duplicates are counted.
+	fake.addLine(base, "J02", 1)
+	m.RequestMinute(base)
+	if got := storedIDs(t, timeutil.Minute(base)); len(got) != 4 {
+		t.Fatalf("after re-ingest stored %d records, want 4", len(got))
+	}
+	if d := live.ignored.Value() - ignored; d != 3 {
+		t.Fatalf("re-ingest counted %d ignored records, want 3", d)
+	}
+	if d := live.inserted.Value() - inserted; d != 1 {
+		t.Fatalf("re-ingest counted %d inserted records, want 1", d)
+	}
+
+	// An empty minute is ledgered as such and nothing is published for it.
+	empty := base.Add(time.Minute)
+	m.RequestMinute(empty)
+	if e := ledgerEntry(t, empty); e.Status != entities.IngestEmpty {
+		t.Fatalf("empty minute ledger entry = %+v", e)
+	}
+}
+
+func TestIntegrationFailedMinuteRepair(t *testing.T) {
+	resetState(t)
+	m, _ := newTestManager(t)
+	var repaired []HourRepaired
+	m.OnHourRepaired(func(ev HourRepaired) { repaired = append(repaired, ev) })
+
+	bad := base.Add(time.Minute)
+	for i := 0; i < 3; i++ {
+		fake.add(base.Add(time.Duration(i)*time.Minute), 2)
+	}
+	fake.fail(bad, true)
+	for i := 0; i < 3; i++ {
+		m.RequestMinute(base.Add(time.Duration(i) * time.Minute))
+	}
+
+	if e := ledgerEntry(t, bad); e.Status != entities.IngestFailed || e.Error == "" {
+		t.Fatalf("failed minute ledger entry = %+v", e)
+	}
+	statusFile := filepath.Join(statusDir, "erro_minute_sync")
+	b, err := os.ReadFile(statusFile)
+	if err != nil {
+		t.Fatalf("failed minute not persisted: %v", err)
+	}
+	if want := bad.Format("2006-01-02 15:04:05 -0700 MST"); strings.TrimSpace(string(b)) != want {
+		t.Fatalf("status file = %q, want %q", b, want)
+	}
+
+	fake.fail(bad, false)
+	res, err := m.RepairHour(context.Background(), base, base.Add(3*time.Minute))
+	if err != nil {
+		t.Fatalf("RepairHour: %v", err)
+	}
+	if res.Missing != 1 || res.Repaired != 1 || res.Records != 2 {
+		t.Fatalf("repair result = %+v", res)
+	}
+	if len(repaired) != 1 || repaired[0].Repaired != 1 {
+		t.Fatalf("HourRepaired events = %+v", repaired)
+	}
+	if e := ledgerEntry(t, bad); e.Status != entities.IngestOK || e.Source != entities.IngestSourceRepair {
+		t.Fatalf("repaired minute ledger entry = %+v", e)
+	}
+	if got := storedIDs(t, timeutil.TimeRange{Start: base, End: base.Add(3 * time.Minute)}); len(got) != 6 {
+		t.Fatalf("stored %d records after repair, want 6", len(got))
+	}
+
+	// A second repair finds nothing to do.
+	if res, err := m.RepairHour(context.Background(), base, base.Add(3*time.Minute)); err != nil || res.Missing != 0 {
+		t.Fatalf("second repair = %+v, %v", res, err)
+	}
+
+	// The persisted minute now succeeds, so the retry pass clears the status file.
+	m.UpdateLostMinutes()
+	if _, err := os.Stat(statusFile); !os.IsNotExist(err) {
+		t.Fatalf("status file still present after retry: %v", err)
+	}
+}
+
+func TestIntegrationUpdateLostMinutes(t *testing.T) {
+	resetState(t)
+	m, _ := newTestManager(t)
+	lost, down := base.Add(time.Minute), base.Add(2*time.Minute)
+	for _, minute := range []time.Time{lost, down} {
+		fake.add(minute, 2)
+		m.persistFailedMinute(minute) // as a failed live minute is (see TestIntegrationFailedMinute)
+	}
+	statusFile := filepath.Join(statusDir, "erro_minute_sync")
+
+	// The retry stores the minute that is back; the one still failing stays persisted.
+	fake.fail(down, true)
+	m.UpdateLostMinutes()
+	if got := storedIDs(t, timeutil.Minute(lost)); len(got) != 2 {
+		t.Fatalf("stored %d records of the retried minute, want 2", len(got))
+	}
+	if e := ledgerEntry(t, lost); e.Status != entities.IngestOK || e.Source != entities.IngestSourceRepair || e.Records != 2 {
+		t.Fatalf("retried minute ledger entry = %+v", e)
+	}
+	b, err := os.ReadFile(statusFile)
+	if want := down.Format("2006-01-02 15:04:05 -0700 MST"); err != nil || strings.TrimSpace(string(b)) != want {
+		t.Fatalf("status file after retry = %q, %v, want %q", b, err, want)
+	}
+
+	fake.fail(down, false)
+	m.UpdateLostMinutes()
+	if got := storedIDs(t, timeutil.Minute(down)); len(got) != 2 {
+		t.Fatalf("stored %d records of the second minute, want 2", len(got))
+	}
+	if _, err := os.Stat(statusFile); !os.IsNotExist(err) {
+		t.Fatalf("status file still present: %v", err)
+	}
+}
+
+func TestIntegrationAutoRepair(t *testing.T) {
+	resetState(t)
+	ctx := context.Background()
+	m, _ := newTestManager(t)
+	t.Cleanup(func() { _, _ = db.GetDB().Exec("DELETE FROM feature_flags") })
+	bad := base.Add(time.Minute)
+	fake.add(bad, 2)
+	fake.fail(bad, true)
+	m.RequestMinute(bad)
+	fake.fail(bad, false)
+	repaired := func() bool { return ledgerEntry(t, bad).Status == entities.IngestOK }
+
+	// Only every 5th minute, and only with auto_backfill on.
+	m.AutoRepair(ctx, base.Add(3*time.Minute), 5)
+	if repaired() {
+		t.Fatal("repaired off schedule")
+	}
+	if err := m.Flags().Set(ctx, FlagAutoBackfill, false); err != nil {
+		t.Fatal(err)
+	}
+	m.AutoRepair(ctx, base.Add(4*time.Minute), 5)
+	if repaired() {
+		t.Fatal("repaired with auto_backfill off")
+	}
+	if err := m.Flags().Set(ctx, FlagAutoBackfill, true); err != nil {
+		t.Fatal(err)
+	}
+	m.AutoRepair(ctx, base.Add(4*time.Minute), 5)
+	if !repaired() {
+		t.Fatalf("minute not repaired: %+v", ledgerEntry(t, bad))
+	}
+	missing, err := entities.NewIngestLedgerManager(db.GetDB()).MissingMinutes(base, base.Add(6*time.Minute))
+	if err != nil || len(missing) != 1 || !missing[0].Equal(base.Add(5*time.Minute)) {
+		t.Fatalf("missing after the repair = %v, %v; want only the minute after it ran", missing, err)
+	}
+}
+
+func TestIntegrationLoadHourReplacesHour(t *testing.T) {
+	resetState(t)
+	m, _ := newTestManager(t)
+	var backfills []BackfillComplete
+	m.OnBackfillComplete(func(ev BackfillComplete) { backfills = append(backfills, ev) })
+
+	fake.add(base, 3)
+	fake.add(base.Add(time.Minute), 3)
+	m.RequestMinute(base)
+	m.RequestMinute(base.Add(time.Minute))
+	hour := timeutil.Hour(base)
+	live := storedIDs(t, hour)
+
+	// SFC drops a unit after the fact; the reload must follow it.
+	fake.drop(base.Add(time.Minute))
+	if err := m.LoadHour(base.Format(timeutil.HourLayout)); err != nil {
+		t.Fatalf("LoadHour: %v", err)
+	}
+
+	reloaded := storedIDs(t, hour)
+	if len(reloaded) != 5 {
+		t.Fatalf("stored %d records after reload, want 5", len(reloaded))
+	}
+	kept := map[string]bool{}
+	for _, id := range live {
+		kept[id] = true
+	}
+	for _, id := range reloaded {
+		if !kept[id] {
+			t.Fatalf("reload produced new id %s; ids must be derived from the record key", id)
+		}
+	}
+	if len(backfills) != 1 || backfills[0].Kind != BackfillHour || backfills[0].Records != 5 ||
+		!backfills[0].Range.Equal(hour) || backfills[0].Error != "" {
+		t.Fatalf("BackfillComplete events = %+v", backfills)
+	}
+	missing, err := entities.NewIngestLedgerManager(db.GetDB()).MissingMinutes(hour.Start, hour.End)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(missing) != 0 {
+		t.Fatalf("%d minute(s) still missing after the hour reload", len(missing))
+	}
+}
+
+// An hour whose live minutes are all cached is not reloaded when upstream still has those
+// records, but a correction keeping the record count is stored.
+func TestIntegrationRequestHourCachedCorrection(t *testing.T) {
+	resetState(t)
+	m, _ := newTestManager(t)
+	for i := 0; i < 60; i++ {
+		fake.add(base.Add(time.Duration(i)*time.Minute), 1)
+		m.RequestMinute(base.Add(time.Duration(i) * time.Minute))
+	}
+	failed := func() int {
+		t.Helper()
+		var n int
+		if err := db.GetDB().QueryRow(`SELECT count(*) FROM records_table WHERE error_flag = 1`).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	fake.failUnit(base.Add(10*time.Minute), 0)
+	if err := m.RequestHour(context.Background(), base.Add(time.Hour)); err != nil {
+		t.Fatalf("RequestHour: %v", err)
+	}
+	if got := storedIDs(t, timeutil.Hour(base)); len(got) != 60 || failed() != 1 {
+		t.Fatalf("after the reload stored %d records, %d failed; want 60 and the corrected 1", len(got), failed())
+	}
+}
+
+func TestIntegrationRequestHourReplacesHour(t *testing.T) {
+	resetState(t)
+	m, _ := newTestManager(t)
+	var backfills []BackfillComplete
+	m.OnBackfillComplete(func(ev BackfillComplete) { backfills = append(backfills, ev) })
+
+	fake.add(base, 3)
+	fake.add(base.Add(time.Minute), 3)
+	m.RequestMinute(base)
+	hour := timeutil.Hour(base)
+	next := base.Add(time.Hour)
+
+	// The second minute was never ingested live; the reload fetches the hour once and stores it.
+	if err := m.RequestHour(context.Background(), next); err != nil {
+		t.Fatalf("RequestHour: %v", err)
+	}
+	if n := fake.hourRequests(); n != 1 {
+		t.Fatalf("hour endpoint requested %d times, want 1", n)
+	}
+	if got := storedIDs(t, hour); len(got) != 6 {
+		t.Fatalf("stored %d records after reload, want 6", len(got))
+	}
+
+	// SFC drops a unit after the fact; the reload replaces the hour.
+	fake.drop(base)
+	if err := m.RequestHour(context.Background(), next); err != nil {
+		t.Fatalf("RequestHour: %v", err)
+	}
+	if n := fake.hourRequests(); n != 2 {
+		t.Fatalf("hour endpoint requested %d times, want 2", n)
+	}
+	if got := storedIDs(t, hour); len(got) != 5 {
+		t.Fatalf("stored %d records after second reload, want 5", len(got))
+	}
+
+	// A cancelled reload fails without touching the stored hour.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	fake.drop(base)
+	if err := m.RequestHour(ctx, next); err == nil {
+		t.Fatal("RequestHour with a cancelled context succeeded")
+	}
+	if got := storedIDs(t, hour); len(got) != 5 {
+		t.Fatalf("stored %d records after failed reload, want 5", len(got))
+	}
+
+	if len(backfills) != 3 || backfills[0].Kind != BackfillPreviousHour || backfills[0].Records != 6 ||
+		!backfills[0].Range.Equal(hour) || backfills[2].Failed != 1 || backfills[2].Error == "" {
+		t.Fatalf("BackfillComplete events = %+v", backfills)
+	}
+}
+
+func TestIntegrationEmptyHourClearsHour(t *testing.T) {
+	hour := timeutil.Hour(base)
+	for name, load := range map[string]func(m *SFCAPIManager) error{
+		"RequestHour": func(m *SFCAPIManager) error { return m.RequestHour(context.Background(), hour.End) },
+		"LoadDay":     func(m *SFCAPIManager) error { return m.LoadDay(context.Background(), base.Format(timeutil.DayLayout)) },
+		"LoadHour":    func(m *SFCAPIManager) error { return m.LoadHour(base.Format(timeutil.HourLayout)) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			resetState(t)
+			m, _ := newTestManager(t)
+			fake.add(base, 3)
+			m.RequestMinute(base)
+			if got := storedIDs(t, hour); len(got) != 3 {
+				t.Fatalf("stored %d records live, want 3", len(got))
+			}
+
+			// SFC no longer returns anything for the hour; the reload clears it.
+			fake.reset()
+			if err := load(m); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if got := storedIDs(t, hour); len(got) != 0 {
+				t.Fatalf("stored %d records after an empty reload, want 0", len(got))
+			}
+			if e := ledgerEntry(t, base); e.Status != entities.IngestEmpty {
+				t.Fatalf("ledger entry after an empty reload = %+v", e)
+			}
+		})
+	}
+}
+
+func TestIntegrationReplaceHour(t *testing.T) {
+	resetState(t)
+	m, _ := newTestManager(t)
+	ctx := context.Background()
+	hour := timeutil.Hour(base)
+
+	fake.add(base, 3)
+	if err := m.LoadHour(base.Format(timeutil.HourLayout)); err != nil {
+		t.Fatalf("LoadHour: %v", err)
+	}
+	want := storedIDs(t, hour)
+
+	// A replace failing after the delete, or after the insert, must leave the hour exactly
+	// as stored.
+	fake.add(base.Add(time.Minute), 2)
+	for _, step := range []string{entities.ReplaceStepDelete, entities.ReplaceStepInsert} {
+		m.recordEntity.SetReplaceFault(func(s string) error {
+			if s == step {
+				return errors.New("injected")
+			}
+			return nil
+		})
+		if err := m.LoadHour(base.Format(timeutil.HourLayout)); err == nil {
+			t.Fatalf("LoadHour failing at %s succeeded", step)
+		}
+		if got := storedIDs(t, hour); !reflect.DeepEqual(got, want) {
+			t.Fatalf("stored %v after failing at %s, want %v", got, step, want)
+		}
+	}
+	if err := m.LoadDay(ctx, base.Format(timeutil.DayLayout)); err == nil {
+		t.Fatal("LoadDay failing at insert succeeded")
+	}
+	if got := storedIDs(t, hour); !reflect.DeepEqual(got, want) {
+		t.Fatalf("stored %v after failed day load, want %v", got, want)
+	}
+	m.recordEntity.SetReplaceFault(nil)
+	if err := m.LoadHour(base.Format(timeutil.HourLayout)); err != nil {
+		t.Fatalf("LoadHour: %v", err)
+	}
+	if got := storedIDs(t, hour); len(got) != 5 {
+		t.Fatalf("stored %d records, want 5", len(got))
+	}
+	want = storedIDs(t, hour)
+
+	// Replaying the same replace is idempotent; records outside the hour are left to their own.
+	recs := []entities.RecordEntity{
+		{PPID: "A", WorkOrder: "MO1", LineName: "J01", GroupName: "PACKING", StationName: "PACK01", ModelName: "M", CollectedTimestamp: base},
+		{PPID: "B", WorkOrder: "MO1", LineName: "J01", GroupName: "PACKING", StationName: "PACK01", ModelName: "M", CollectedTimestamp: base.Add(time.Minute)},
+		{PPID: "C", WorkOrder: "MO1", LineName: "J01", GroupName: "PACKING", StationName: "PACK01", ModelName: "M", CollectedTimestamp: base.Add(time.Hour)},
+	}
+	res, err := m.recordEntity.ReplaceHour(ctx, base, recs)
+	if err != nil {
+		t.Fatalf("ReplaceHour: %v", err)
+	}
+	if res.Deleted != len(want) || res.Inserted != 2 || res.Ignored != 1 {
+		t.Fatalf("ReplaceHour = %+v, want %d deleted, 2 inserted, 1 ignored", res, len(want))
+	}
+	if res, err = m.recordEntity.ReplaceHour(ctx, base, recs); err != nil || res.Deleted != 2 || res.Inserted != 2 {
+		t.Fatalf("replayed ReplaceHour = %+v, %v, want 2 deleted and 2 inserted", res, err)
+	}
+	if got := storedIDs(t, timeutil.TimeRange{Start: base, End: base.Add(2 * time.Hour)}); len(got) != 2 {
+		t.Fatalf("stored %d records, want the 2 of the hour", len(got))
+	}
+}
+
+func TestIntegrationErrorLogAlert(t *testing.T) {
+	m, rec := newTestManager(t)
+
+	m.logger.Errorf("live hour query failed: %v", errors.New("timeout"))
+	m.logger.Errorf("second failure")
+	m.logger.Flush()
+	active := m.Alerts().Active()
+	if len(active) != 1 || active[0].Key != errorLogAlert || active[0].Message != "error logged: live hour query failed: timeout" {
+		t.Fatalf("active = %+v", active)
+	}
+	if !rec.published(TopicAlert) {
+		t.Fatal("alert not published")
+	}
+
+	m.resolveErrorLogAlert()
+	if len(m.Alerts().Active()) != 1 {
+		t.Fatal("resolved while errors are recent")
+	}
+	m.lastErrorLog.Store(time.Now().Add(-errorLogQuiet).UnixNano())
+	m.resolveErrorLogAlert()
+	if active := m.Alerts().Active(); len(active) != 0 {
+		t.Fatalf("still active: %+v", active)
+	}
+}
+
+func TestIntegrationBusEvents(t *testing.T) {
+	resetState(t)
+	ctx := context.Background()
+	m, _ := newTestManager(t)
+	var got []any
+	bus.Subscribe(m.Bus(), func(ev bus.AlertRaised) { got = append(got, ev) })
+	bus.Subscribe(m.Bus(), func(ev bus.AlertResolved) { got = append(got, ev) })
+	bus.Subscribe(m.Bus(), func(ev bus.ConfigChanged) { got = append(got, ev) })
+
+	m.Alerts().Raise("k", SeverityWarning, "test", "raised")
+	m.Alerts().Resolve("k", "resolved")
+	if err := m.Flags().Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _, _ = db.GetDB().Exec("DELETE FROM feature_flags") })
+	if err := m.Flags().Set(ctx, FlagDeltaBroadcasts, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Lines().Disable(ctx, "J09", "test run"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != 4 {
+		t.Fatalf("events = %+v", got)
+	}
+	if ev, ok := got[0].(bus.AlertRaised); !ok || ev.Key != "k" || ev.Severity != SeverityWarning || ev.Message != "raised" {
+		t.Errorf("first event = %+v", got[0])
+	}
+	if ev, ok := got[1].(bus.AlertResolved); !ok || ev.Key != "k" || ev.Source != "test" || ev.Message != "resolved" {
+		t.Errorf("second event = %+v", got[1])
+	}
+	want := []any{
+		bus.ConfigChanged{Source: bus.ConfigFeatureFlags, Changed: []string{FlagDeltaBroadcasts}},
+		bus.ConfigChanged{Source: bus.ConfigLineMaintenance, Changed: []string{"J09"}},
+	}
+	if !reflect.DeepEqual(got[2:], want) {
+		t.Errorf("config events = %+v, want %+v", got[2:], want)
+	}
+}
+
+func TestIntegrationDeltaBroadcasts(t *testing.T) {
+	resetState(t)
+	ctx := context.Background()
+	m, rec := newTestManager(t)
+	clock := timeutil.NewFakeClock(base.Add(5 * time.Minute))
+	m.SetClock(clock)
+	t.Cleanup(func() { _, _ = db.GetDB().Exec("DELETE FROM feature_flags") })
+	if err := m.Flags().Set(ctx, FlagDeltaBroadcasts, true); err != nil {
+		t.Fatal(err)
+	}
+	last := func(topic string) map[string]string {
+		t.Helper()
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+		if n := len(rec.topics); n < 3 || rec.topics[n-1] != topic {
+			t.Fatalf("published %v, want %s last", rec.topics, topic)
+		}
+		return rec.last[topic].(map[string]string)
+	}
+
+	// The first publish is the full map, on LAST_UPDATE.
+	fake.add(base, 1)
+	m.RequestMinute(base)
+	if got := last(TopicLastUpdate); len(got) != 1 || got["J01_PACKING"] == "" {
+		t.Fatalf("LAST_UPDATE = %v", got)
+	}
+	// Then only the changed keys, on LAST_UPDATE_DELTA, so LAST_UPDATE stays a full map.
+	fake.addLine(base.Add(time.Minute), "J02", 1)
+	m.RequestMinute(base.Add(time.Minute))
+	if got := last(TopicLastUpdateDelta); len(got) != 1 || got["J02_PACKING"] == "" {
+		t.Fatalf("LAST_UPDATE_DELTA = %v", got)
+	}
+	// A new hour resyncs with the full map.
+	clock.Advance(time.Hour)
+	m.RequestMinute(base.Add(time.Minute))
+	if got := last(TopicLastUpdate); len(got) != 2 {
+		t.Fatalf("LAST_UPDATE after the hour = %v", got)
+	}
+}
+
+// A failing live query, as on shutdown when the context is cancelled, is logged and skips
+// the topic; it never ends the process.
+func TestIntegrationPublishLiveQueryError(t *testing.T) {
+	resetState(t)
+	m, rec := newTestManager(t)
+	if _, err := db.GetDB().Exec(`ALTER TABLE latest_pass RENAME TO latest_pass_moved`); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _, _ = db.GetDB().Exec(`ALTER TABLE latest_pass_moved RENAME TO latest_pass`) })
+
+	m.publishLive()
+	if !rec.published(TopicLastHour) || rec.published(TopicLastUpdate) {
+		t.Fatalf("published %v, want LAST_HOUR without LAST_UPDATE", rec.topics)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	m.ctx = ctx
+	m.publishLive()
+}
@@ -0,0 +1,107 @@
+package managers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"hex_toolset/pkg/db/entities"
+	skylogger "hex_toolset/pkg/logger"
+	"hex_toolset/pkg/shifts"
+	"hex_toolset/pkg/timeutil"
+)
+
+// ShiftCloseGrace delays the freeze after shift end so the last minute is ingested first.
+const ShiftCloseGrace = 3 * time.Minute
+
+// ShiftManager freezes shift summaries at shift end and broadcasts SHIFT_CLOSED.
+type ShiftManager struct {
+	calendar  *shifts.Calendar
+	records   *entities.RecordEntityManager
+	summaries *entities.ShiftSummaryManager
+	publisher Publisher
+	logger    *skylogger.Logger
+	onClosed  []func(shifts.Instance)
+}
+
+// NewShiftManager creates a shift manager. pub may be nil to skip broadcasting.
+func NewShiftManager(cal *shifts.Calendar, database *sql.DB, pub Publisher, lgr *skylogger.Logger) *ShiftManager {
+	return &ShiftManager{
+		calendar:  cal,
+		records:   entities.NewRecordManagerEntity(database),
+		summaries: entities.NewShiftSummaryManager(database),
+		publisher: pub,
+		logger:    lgr,
+	}
+}
+
+// OnClosed registers fn to run after each shift CloseShift freezes, once its SHIFT_CLOSED
+// is published. Register before Schedule.
+func (m *ShiftManager) OnClosed(fn func(shifts.Instance)) { m.onClosed = append(m.onClosed, fn) }
+
+// Calendar returns the shift calendar.
+func (m *ShiftManager) Calendar() *shifts.Calendar { return m.calendar }
+
+// CloseShift freezes a new version of the shift's figures and publishes it.
+func (m *ShiftManager) CloseShift(in shifts.Instance) (entities.ShiftClosure, error) {
+	start := in.Start.Format("2006-01-02 15:04:05")
+	end := in.End.Format("2006-01-02 15:04:05")
+
+	span := timeutil.TimeRange{Start: in.Start, End: in.End}
+	counts, err := m.records.CountByLineGroup(span.DBStart(), span.DBEnd())
+	if err != nil {
+		return entities.ShiftClosure{}, fmt.Errorf("count shift %s %s: %w", in.Name, start, err)
+	}
+	lines := make([]entities.ShiftLineSummary, 0, len(counts))
+	for _, c := range counts {
+		lines = append(lines, entities.ShiftLineSummary{LineName: c.LineName, GroupName: c.GroupName, Units: c.Units, FailUnits: c.FailUnits})
+	}
+
+	closure, err := m.summaries.Freeze(in.Name, start, end, lines)
+	if err != nil {
+		return entities.ShiftClosure{}, fmt.Errorf("freeze shift %s %s: %w", in.Name, start, err)
+	}
+	m.logger.Infof("shift %s %s..%s closed as v%d: units=%d fail=%d", in.Name, start, end, closure.Version, closure.Units, closure.FailUnits)
+
+	if m.publisher != nil {
+		if err := m.publisher.Publish(TopicShiftClosed, closure); err != nil {
+			m.logger.Errorf("failed to publish shift closure %s %s: %v", in.Name, start, err)
+		}
+	}
+	for _, fn := range m.onClosed {
+		fn(in)
+	}
+	return closure, nil
+}
+
+// CloseEnded freezes every shift that ended in (since, now] and has not been frozen yet.
+// Already frozen shifts are left alone; use CloseShift to publish a new version explicitly.
+func (m *ShiftManager) CloseEnded(since, now time.Time) {
+	for _, in := range m.calendar.Between(since, now) {
+		frozen, err := m.summaries.IsFrozen(in.Name, in.Start.Format("2006-01-02 15:04:05"))
+		if err != nil {
+			m.logger.Errorf("check shift %s %s frozen: %v", in.Name, in.Start.Format(time.DateTime), err)
+			continue
+		}
+		if frozen {
+			continue
+		}
+		if _, err := m.CloseShift(in); err != nil {
+			m.logger.Errorf("close shift failed: %v", err)
+		}
+	}
+}
+
+// Schedule registers a daily job per shift that runs ShiftCloseGrace after the shift ends.
+// Each run also catches up on shifts missed in the previous day (e.g. while the service was down).
+func (m *ShiftManager) Schedule(lm *LoopsManager) {
+	for _, s := range m.calendar.Shifts {
+		at := (s.End + ShiftCloseGrace) % (24 * time.Hour)
+		h, mi := int(at/time.Hour), int((at%time.Hour)/time.Minute)
+		lm.StartDailyAt(h, mi, 0, func(ctx context.Context) {
+			now := lm.Clock().Now().Add(-ShiftCloseGrace)
+			m.CloseEnded(now.Add(-24*time.Hour), now)
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package managers
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	pkgcfg "hex_toolset/pkg"
+	"hex_toolset/pkg/db/entities"
+	skylogger "hex_toolset/pkg/logger"
+	"hex_toolset/pkg/metrics"
+	"hex_toolset/pkg/timeutil"
+)
+
+// IngestSLO is the ingestion objective: Target (a fraction, e.g. 0.995) of the minutes are
+// ingested within Latency of the minute's end.
+type IngestSLO struct {
+	Target  float64
+	Latency time.Duration
+}
+
+// DefaultIngestSLO reads SLO_INGEST_TARGET and SLO_INGEST_LATENCY_SECONDS from the config.
+func DefaultIngestSLO() IngestSLO {
+	cfg := pkgcfg.GetConfig()
+	return IngestSLO{
+		Target:  cfg.SLO_INGEST_TARGET / 100,
+		Latency: time.Duration(cfg.SLO_INGEST_LATENCY_SECONDS) * time.Second,
+	}
+}
+
+// SLOWindow is a rolling window the tracker reports on.
+type SLOWindow struct {
+	Name     string
+	Duration time.Duration
+}
+
+// SLOWindows are the rolling windows of the burn-rate metrics: the short ones catch a fast
+// burn (an outage), the 30-day one is the budget of the monthly review.
+var SLOWindows = []SLOWindow{
+	{"1h", time.Hour},
+	{"6h", 6 * time.Hour},
+	{"24h", 24 * time.Hour},
+	{"30d", 30 * 24 * time.Hour},
+}
+
+// SLOReport is the compliance of the ingestion SLO over one range. Minutes still within
+// their latency allowance are not judged yet and are left out of the range.
+type SLOReport struct {
+	Window         string  `json:"window,omitempty"`
+	From           string  `json:"from"`
+	To             string  `json:"to"`
+	Target         float64 `json:"target"`
+	LatencySeconds int     `json:"latency_seconds"`
+	Minutes        int     `json:"minutes"`
+	OnTime         int     `json:"on_time"`
+	Late           int     `json:"late"`
+	Missing        int     `json:"missing"`
+	// Compliance is the on-time fraction of Minutes (1 for an empty range).
+	Compliance float64 `json:"compliance"`
+	// BurnRate is the rate the error budget is spent at: 1 spends exactly the budget over
+	// the range, above 1 exhausts it early.
+	BurnRate float64 `json:"burn_rate"`
+	// BudgetRemaining is the unspent fraction of the range's error budget; negative once
+	// the budget is overspent.
+	BudgetRemaining float64 `json:"budget_remaining"`
+	Met             bool    `json:"met"`
+}
+
+// SLOTracker computes ingestion SLO compliance from the ingest ledger, where every minute
+// records when it was first stored.
+type SLOTracker struct {
+	ledger *entities.IngestLedgerManager
+	slo    IngestSLO
+	logger *skylogger.Logger
+	now    func() time.Time
+
+	mu      sync.RWMutex
+	rolling map[string]SLOReport
+}
+
+// NewSLOTracker creates a tracker of slo over the ledger in database.
+func NewSLOTracker(database *sql.DB, slo IngestSLO, lgr *skylogger.Logger) *SLOTracker {
+	return &SLOTracker{
+		ledger:  entities.NewIngestLedgerManager(database),
+		slo:     slo,
+		logger:  lgr,
+		now:     time.Now,
+		rolling: map[string]SLOReport{},
+	}
+}
+
+// SLO returns the tracked objective.
+func (t *SLOTracker) SLO() IngestSLO { return t.slo }
+
+// judgedUntil is the end of the minutes whose latency allowance has passed at now.
+func (t *SLOTracker) judgedUntil() time.Time {
+	return t.now().In(time.Local).Add(-time.Minute - t.slo.Latency).Truncate(time.Minute)
+}
+
+// Report computes the SLO over r, cut at the minutes that can be judged already.
+func (t *SLOTracker) Report(ctx context.Context, r timeutil.TimeRange) (SLOReport, error) {
+	if until := t.judgedUntil(); r.End.After(until) {
+		r.End = until
+	}
+	if r.Start.After(r.End) {
+		r.Start = r.End
+	}
+	rep := SLOReport{
+		From:           timeutil.FormatLocal(r.Start),
+		To:             timeutil.FormatLocal(r.End),
+		Target:         t.slo.Target,
+		LatencySeconds: int(t.slo.Latency / time.Second),
+	}
+	var err error
+	if rep.OnTime, rep.Late, rep.Missing, err = t.ledger.LatencyCounts(ctx, r.Start, r.End, t.slo.Latency); err != nil {
+		return rep, err
+	}
+	rep.Minutes = rep.OnTime + rep.Late + rep.Missing
+	rep.score()
+	return rep, nil
+}
+
+func (r *SLOReport) score() {
+	r.Compliance, r.BudgetRemaining = 1, 1
+	if r.Minutes > 0 {
+		r.Compliance = float64(r.OnTime) / float64(r.Minutes)
+	}
+	bad := 1 - r.Compliance
+	switch allowed := 1 - r.Target; {
+	case allowed > 0:
+		r.BurnRate = bad / allowed
+		r.BudgetRemaining = 1 - r.BurnRate
+	case bad > 0:
+		r.BudgetRemaining = -1 // a 100% target has no budget to spend
+	}
+	r.Met = r.Compliance >= r.Target
+}
+
+// Rolling computes the report of every SLOWindow ending now.
+func (t *SLOTracker) Rolling(ctx context.Context) ([]SLOReport, error) {
+	end := t.judgedUntil()
+	out := make([]SLOReport, 0, len(SLOWindows))
+	for _, w := range SLOWindows {
+		rep, err := t.Report(ctx, timeutil.TimeRange{Start: end.Add(-w.Duration), End: end})
+		if err != nil {
+			return nil, err
+		}
+		rep.Window = w.Name
+		out = append(out, rep)
+	}
+	return out, nil
+}
+
+// Refresh recomputes the rolling windows behind the SLO metrics.
+func (t *SLOTracker) Refresh(ctx context.Context) error {
+	reps, err := t.Rolling(ctx)
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, r := range reps {
+		t.rolling[r.Window] = r
+	}
+	return nil
+}
+
+func (t *SLOTracker) cached(window string) SLOReport {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.rolling[window]
+}
+
+// Register adds the ingest_slo_* gauges of every rolling window to reg. They read the
+// reports of the last Refresh.
+func (t *SLOTracker) Register(reg *metrics.Registry) {
+	for _, w := range SLOWindows {
+		name, labels := w.Name, metrics.Labels{"window": w.Name}
+		reg.Register(metrics.NewGaugeFunc("ingest_slo_compliance",
+			"Fraction of minutes ingested within the SLO latency, over the rolling window.", labels,
+			func() float64 { return t.cached(name).Compliance }))
+		reg.Register(metrics.NewGaugeFunc("ingest_slo_burn_rate",
+			"Rate the ingestion error budget is spent at over the rolling window (1 spends it exactly).", labels,
+			func() float64 { return t.cached(name).BurnRate }))
+		reg.Register(metrics.NewGaugeFunc("ingest_slo_budget_remaining",
+			"Unspent fraction of the ingestion error budget over the rolling window.", labels,
+			func() float64 { return t.cached(name).BudgetRemaining }))
+	}
+}
+
+// Schedule registers the SLO metrics on the default registry and refreshes them now and
+// then every minute.
+func (t *SLOTracker) Schedule(lm *LoopsManager) {
+	t.Register(metrics.Default)
+	if err := t.Refresh(context.Background()); err != nil {
+		t.logger.Errorf("slo: %v", err)
+	}
+	lm.StartEveryMinute(func(ctx context.Context, _ time.Time) {
+		if err := t.Refresh(ctx); err != nil {
+			t.logger.Errorf("slo: %v", err)
+		}
+	})
+}
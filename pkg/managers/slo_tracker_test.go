@@ -0,0 +1,55 @@
+package managers
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"hex_toolset/pkg/db"
+	"hex_toolset/pkg/timeutil"
+)
+
+func TestIntegrationSLOReport(t *testing.T) {
+	resetState(t)
+	// Minutes 0-6 are stored 70s after they start, minute 7 five minutes late, minute 8
+	// failed and minute 9 never reached the ledger.
+	for i := 0; i < 9; i++ {
+		minute := base.Add(time.Duration(i) * time.Minute)
+		status, ingested := "ok", minute.Add(70*time.Second).Format(timeutil.DBLayout)
+		switch i {
+		case 7:
+			ingested = minute.Add(5 * time.Minute).Format(timeutil.DBLayout)
+		case 8:
+			status, ingested = "failed", ""
+		}
+		_, err := db.GetDB().Exec(`INSERT INTO ingest_ledger (minute, status, records, attempts, source, error, updated_at, ingested_at)
+			VALUES (?, ?, 0, 1, 'live', '', ?, ?)`, minute.Format("2006-01-02 15:04:00"), status, ingested, ingested)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tracker := NewSLOTracker(db.GetDB(), IngestSLO{Target: 0.9, Latency: 2 * time.Minute}, nil)
+	tracker.now = func() time.Time { return base.Add(time.Hour) }
+	r := timeutil.TimeRange{Start: base, End: base.Add(10 * time.Minute)}
+	rep, err := tracker.Report(context.Background(), r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.Minutes != 10 || rep.OnTime != 7 || rep.Late != 1 || rep.Missing != 2 {
+		t.Fatalf("report = %+v", rep)
+	}
+	if math.Abs(rep.Compliance-0.7) > 1e-9 || math.Abs(rep.BurnRate-3) > 1e-9 || math.Abs(rep.BudgetRemaining+2) > 1e-9 || rep.Met {
+		t.Fatalf("scores = %+v", rep)
+	}
+
+	// Minutes whose latency allowance has not passed yet are not judged.
+	tracker.now = func() time.Time { return base.Add(5 * time.Minute) }
+	if rep, err = tracker.Report(context.Background(), r); err != nil {
+		t.Fatal(err)
+	}
+	if rep.Minutes != 2 || rep.OnTime != 2 || !rep.Met || rep.To != base.Add(2*time.Minute).Format(timeutil.DBLayout) {
+		t.Fatalf("report at %s = %+v", base.Add(5*time.Minute).Format(timeutil.DBLayout), rep)
+	}
+}
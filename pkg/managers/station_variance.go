@@ -0,0 +1,187 @@
+package managers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"hex_toolset/pkg/db/entities"
+	skylogger "hex_toolset/pkg/logger"
+	"hex_toolset/pkg/timeutil"
+)
+
+// StationVarianceSnapshot is the STATION_VARIANCE payload: the rolling cycle time of every
+// station with a target over the Window minutes ending at Minute, against the target.
+type StationVarianceSnapshot struct {
+	Minute   string            `json:"minute"` // last minute of the window, 'YYYY-MM-DD HH:MM' local
+	Window   int               `json:"window_minutes"`
+	Stations []StationVariance `json:"stations"`
+}
+
+// StationVariance is the live cycle time of one station. ActualSeconds is the mean gap
+// between the passing units of the window and is null while fewer than two passed;
+// VarianceSeconds (actual - target, positive when slower) and VariancePercent follow it.
+type StationVariance struct {
+	Line            string   `json:"line"`
+	Station         string   `json:"station"`
+	TargetSeconds   float64  `json:"target_seconds"`
+	Units           int      `json:"units"`
+	ActualSeconds   *float64 `json:"actual_seconds"`
+	VarianceSeconds *float64 `json:"variance_seconds"`
+	VariancePercent *float64 `json:"variance_percent"`
+}
+
+// StationTargets keeps the per-station cycle time targets and publishes STATION_VARIANCE
+// after every live minute. The actual cycle times come from the manager's record cache,
+// so the broadcast costs no DB query; the targets are re-read at most once per ttl, or
+// right away when changed through Set or Delete.
+type StationTargets struct {
+	entity *entities.StationTargetManager
+	window int
+	ttl    time.Duration
+	logger *skylogger.Logger
+	now    func() time.Time
+
+	mu       sync.Mutex
+	targets  []entities.StationTarget
+	loadedAt time.Time
+	loaded   bool
+}
+
+// NewStationTargets creates the station targets of database, measured over a rolling
+// window of minutes.
+func NewStationTargets(database *sql.DB, window int, ttl time.Duration, lgr *skylogger.Logger) *StationTargets {
+	return &StationTargets{entity: entities.NewStationTargetManager(database), window: window, ttl: ttl,
+		logger: lgr, now: time.Now}
+}
+
+// Attach publishes STATION_VARIANCE through m after each live minute it stores.
+func (s *StationTargets) Attach(m *SFCAPIManager) {
+	m.OnMinuteLoaded(func(ev MinuteLoaded) {
+		if ev.Source != entities.IngestSourceLive {
+			return
+		}
+		snap, err := s.Snapshot(m, ev.Minute)
+		if err != nil {
+			s.logger.Warnf("station variance: %v", err)
+			return
+		}
+		if len(snap.Stations) == 0 {
+			return
+		}
+		if err := m.publisher.Publish(TopicStationVariance, snap); err != nil {
+			s.logger.Errorf("%v", err)
+		}
+	})
+}
+
+// Snapshot computes the variance of the window ending with minute from m's record cache.
+// Minutes not cached (e.g. right after start) are treated as empty.
+func (s *StationTargets) Snapshot(m *SFCAPIManager, minute time.Time) (StationVarianceSnapshot, error) {
+	targets, err := s.current(m.ctx)
+	if err != nil {
+		return StationVarianceSnapshot{}, err
+	}
+	end := minute.Truncate(time.Minute).Add(time.Minute)
+	recs, _ := m.RecentRecords(end.Add(-time.Duration(s.window)*time.Minute), end)
+	return StationVarianceSnapshot{
+		Minute:   minute.In(time.Local).Format(timeutil.MinuteLayout),
+		Window:   s.window,
+		Stations: stationVariance(targets, recs),
+	}, nil
+}
+
+// current returns the cached targets, reloading them once the ttl expired. When the table
+// cannot be read the last known targets are kept.
+func (s *StationTargets) current(ctx context.Context) ([]entities.StationTarget, error) {
+	s.mu.Lock()
+	stale := !s.loaded || s.now().Sub(s.loadedAt) >= s.ttl
+	s.mu.Unlock()
+	if stale {
+		if _, err := s.List(ctx); err != nil {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if !s.loaded {
+				return nil, err
+			}
+			s.logger.Warnf("station targets: %v", err)
+			return s.targets, nil
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.targets, nil
+}
+
+// List returns every target from the database, refreshing the cache.
+func (s *StationTargets) List(ctx context.Context) ([]entities.StationTarget, error) {
+	targets, err := s.entity.List(ctx)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loadedAt = s.now()
+	if err != nil {
+		return nil, err
+	}
+	if targets == nil {
+		targets = []entities.StationTarget{}
+	}
+	s.targets, s.loaded = targets, true
+	return targets, nil
+}
+
+// Set stores the target cycle time of line/station.
+func (s *StationTargets) Set(ctx context.Context, line, station string, cycle time.Duration) error {
+	line, station = normalizeLine(line), normalizeLine(station)
+	if line == "" || station == "" {
+		return fmt.Errorf("line and station are required")
+	}
+	if cycle <= 0 {
+		return fmt.Errorf("cycle time must be positive, got %s", cycle)
+	}
+	if err := s.entity.Set(ctx, line, station, cycle.Seconds()); err != nil {
+		return err
+	}
+	_, err := s.List(ctx)
+	return err
+}
+
+// Delete removes the target of line/station; ok is false when it had none.
+func (s *StationTargets) Delete(ctx context.Context, line, station string) (ok bool, err error) {
+	if ok, err = s.entity.Delete(ctx, normalizeLine(line), normalizeLine(station)); err != nil {
+		return false, err
+	}
+	_, err = s.List(ctx)
+	return ok, err
+}
+
+// stationVariance measures each target's station over recs. Failed units are not passes.
+func stationVariance(targets []entities.StationTarget, recs []entities.RecordEntity) []StationVariance {
+	type key struct{ line, station string }
+	passes := make(map[key][]time.Time, len(targets))
+	for _, t := range targets {
+		passes[key{t.LineName, t.StationName}] = nil
+	}
+	for _, r := range recs {
+		k := key{normalizeLine(r.LineName), normalizeLine(r.StationName)}
+		if ts, ok := passes[k]; ok && !r.ErrorFlag {
+			passes[k] = append(ts, r.CollectedTimestamp)
+		}
+	}
+	out := make([]StationVariance, 0, len(targets))
+	for _, t := range targets {
+		ts := passes[key{t.LineName, t.StationName}]
+		v := StationVariance{Line: t.LineName, Station: t.StationName, TargetSeconds: t.CycleSeconds, Units: len(ts)}
+		if len(ts) >= 2 {
+			sort.Slice(ts, func(i, j int) bool { return ts[i].Before(ts[j]) })
+			actual := ts[len(ts)-1].Sub(ts[0]).Seconds() / float64(len(ts)-1)
+			variance := actual - t.CycleSeconds
+			percent := variance / t.CycleSeconds * 100
+			v.ActualSeconds, v.VarianceSeconds, v.VariancePercent = &actual, &variance, &percent
+		}
+		out = append(out, v)
+	}
+	return out
+}
@@ -0,0 +1,58 @@
+package managers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"hex_toolset/pkg/db"
+)
+
+func TestIntegrationStationVariance(t *testing.T) {
+	resetState(t)
+	t.Cleanup(func() { _, _ = db.GetDB().Exec("DELETE FROM station_target") })
+	m, rec := newTestManager(t)
+	targets := NewStationTargets(db.GetDB(), 15, time.Minute, nil)
+	targets.Attach(m)
+	for _, st := range []struct {
+		station string
+		cycle   time.Duration
+	}{{"pack01", 2 * time.Second}, {"TEST01", 30 * time.Second}} {
+		if err := targets.Set(context.Background(), "j01", st.station, st.cycle); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fake.add(base, 5) // PACK01, one second apart
+	m.RequestMinute(base)
+	snap, ok := rec.last[TopicStationVariance].(StationVarianceSnapshot)
+	if !ok {
+		t.Fatalf("STATION_VARIANCE not published: %v", rec.topics)
+	}
+	if len(snap.Stations) != 2 || snap.Window != 15 {
+		t.Fatalf("snapshot = %+v", snap)
+	}
+	pack, idle := snap.Stations[0], snap.Stations[1]
+	if pack.Station != "PACK01" || pack.Units != 5 || pack.ActualSeconds == nil || *pack.ActualSeconds != 1 ||
+		*pack.VarianceSeconds != -1 || *pack.VariancePercent != -50 {
+		t.Fatalf("PACK01 variance = %+v", pack)
+	}
+	if idle.Station != "TEST01" || idle.Units != 0 || idle.ActualSeconds != nil {
+		t.Fatalf("TEST01 without passes = %+v", idle)
+	}
+
+	// The window spans the cached minutes: the gap to the next minute's units counts.
+	fake.add(base.Add(time.Minute), 1)
+	m.RequestMinute(base.Add(time.Minute))
+	snap = rec.last[TopicStationVariance].(StationVarianceSnapshot)
+	if got := *snap.Stations[0].ActualSeconds; snap.Stations[0].Units != 6 || got != 12 {
+		t.Fatalf("PACK01 over two minutes: %d units, %.1fs; want 6 units, 12s", snap.Stations[0].Units, got)
+	}
+
+	if ok, err := targets.Delete(context.Background(), "J01", "TEST01"); err != nil || !ok {
+		t.Fatalf("delete target: %v, %v", ok, err)
+	}
+	if all, _ := targets.List(context.Background()); len(all) != 1 {
+		t.Fatalf("targets after delete = %+v", all)
+	}
+}
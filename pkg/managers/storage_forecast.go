@@ -0,0 +1,231 @@
+package managers
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"sync"
+	"time"
+
+	"hex_toolset/pkg/db/entities"
+	skylogger "hex_toolset/pkg/logger"
+	"hex_toolset/pkg/timeutil"
+)
+
+// StorageHorizons are the days ahead projected by the storage report.
+var StorageHorizons = []int{30, 90, 365}
+
+// storageFullLookahead bounds the search for the day the database outgrows its capacity.
+const storageFullLookahead = 10 * 365
+
+// StorageReport is the storage usage of the database and its projected growth.
+type StorageReport struct {
+	GeneratedAt      string  `json:"generated_at"` // 'YYYY-MM-DD HH:MM:SS' local
+	FileBytes        int64   `json:"file_bytes"`
+	UsedBytes        int64   `json:"used_bytes"`
+	RecordsBytes     int64   `json:"records_bytes"` // records_table and its indexes
+	Records          int64   `json:"records"`
+	BytesPerRecord   float64 `json:"bytes_per_record"`
+	RawRetentionDays int     `json:"raw_retention_days"` // TIER_RAW_DAYS or RETENTION_DAYS; 0 keeps every record
+
+	// RecordsPerDay is the mean daily volume of the HistoryDays complete days before today;
+	// TrendPerDay is how much that volume changes per day (least squares), positive when
+	// the plant ships more every day.
+	HistoryDays   int     `json:"history_days"`
+	RecordsPerDay float64 `json:"records_per_day"`
+	TrendPerDay   float64 `json:"trend_per_day"`
+
+	CapacityBytes int64               `json:"capacity_bytes,omitempty"`
+	Projections   []StorageProjection `json:"projections"`
+	// DaysUntilFull is the first day the file outgrows CapacityBytes, null when no capacity
+	// is configured or it is not reached within ten years.
+	DaysUntilFull *int `json:"days_until_full"`
+}
+
+// StorageProjection is the projected size of the database Days from now.
+type StorageProjection struct {
+	Days         int    `json:"days"`
+	Date         string `json:"date"` // 'YYYY-MM-DD'
+	Records      int64  `json:"records"`
+	RecordsBytes int64  `json:"records_bytes"`
+	UsedBytes    int64  `json:"used_bytes"`
+	FileBytes    int64  `json:"file_bytes"`
+}
+
+// StorageForecast projects the size of the database from the daily volume of records_table.
+// The daily volume is extrapolated linearly from the recent history; with raw retention only
+// the last rawDays days stay in records_table and the pages of archived days are reused.
+// The other tables (rollups, ledger, ...) are assumed not to grow, and the file never
+// shrinks (SQLite does not return free pages without a VACUUM). Measuring walks the whole
+// database, so reports are cached for ttl.
+type StorageForecast struct {
+	db       *sql.DB
+	records  *entities.RecordEntityManager
+	rawDays  int
+	history  int
+	capacity int64
+	ttl      time.Duration
+	logger   *skylogger.Logger
+	now      func() time.Time
+
+	mu     sync.Mutex
+	report *StorageReport
+	at     time.Time
+}
+
+// NewStorageForecast creates a forecast of database fitting the daily volume over history
+// days, for raw retention rawDays (0 when records are kept forever) and capacityBytes of
+// disk available to the database file (0 when unknown).
+func NewStorageForecast(database *sql.DB, rawDays, history int, capacityBytes int64, lgr *skylogger.Logger) *StorageForecast {
+	if history < 2 {
+		history = 2
+	}
+	return &StorageForecast{db: database, records: entities.NewRecordManagerEntity(database), rawDays: rawDays,
+		history: history, capacity: capacityBytes, ttl: time.Hour, logger: lgr, now: time.Now}
+}
+
+// Report returns the current forecast, measuring again once the cached one is older than the ttl.
+func (f *StorageForecast) Report(ctx context.Context) (StorageReport, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.report != nil && f.now().Sub(f.at) < f.ttl {
+		return *f.report, nil
+	}
+	rep, err := f.measure(ctx)
+	if err != nil {
+		return StorageReport{}, err
+	}
+	f.report, f.at = &rep, f.now()
+	if rep.DaysUntilFull != nil && *rep.DaysUntilFull <= 90 && f.logger != nil {
+		f.logger.Warnf("database projected to outgrow its %d bytes of capacity in %d day(s)", rep.CapacityBytes, *rep.DaysUntilFull)
+	}
+	return rep, nil
+}
+
+func (f *StorageForecast) measure(ctx context.Context) (StorageReport, error) {
+	usage, err := entities.MeasureStorage(ctx, f.db, f.records.TableName)
+	if err != nil {
+		return StorageReport{}, err
+	}
+	now := f.now().In(time.Local)
+	today := timeutil.Day(now)
+
+	// past[i] is the volume of the day i days before today (past[0] is today so far).
+	span := max(f.history, f.rawDays)
+	counts, err := f.records.HourlyCounts(ctx, timeutil.TimeRange{Start: today.Start.AddDate(0, 0, -span), End: today.End})
+	if err != nil {
+		return StorageReport{}, err
+	}
+	index := make(map[string]int, span+1)
+	for i := 0; i <= span; i++ {
+		index[today.Start.AddDate(0, 0, -i).Format(timeutil.DayLayout)] = i
+	}
+	past := make([]float64, span+1)
+	for hour, n := range counts {
+		if i, ok := index[hour.In(time.Local).Format(timeutil.DayLayout)]; ok {
+			past[i] += float64(n)
+		}
+	}
+
+	rep := StorageReport{
+		GeneratedAt:      now.Format(timeutil.DBLayout),
+		FileBytes:        usage.FileBytes(),
+		UsedBytes:        usage.UsedBytes(),
+		RecordsBytes:     usage.TableBytes,
+		Records:          usage.TableRows,
+		RawRetentionDays: f.rawDays,
+		CapacityBytes:    f.capacity,
+		Projections:      []StorageProjection{},
+	}
+	if usage.TableRows > 0 {
+		rep.BytesPerRecord = float64(usage.TableBytes) / float64(usage.TableRows)
+	}
+
+	// Fit the complete days, back to the first one with records: a database younger than
+	// the history (or whose older days were archived) must not read as a collapse in volume.
+	days := f.history
+	if f.rawDays > 0 {
+		days = min(days, f.rawDays)
+	}
+	for days > 0 && past[days] == 0 {
+		days--
+	}
+	intercept, slope := fitDailyVolume(past[1 : days+1])
+	rep.HistoryDays, rep.TrendPerDay = days, slope
+	if days > 0 {
+		var sum float64
+		for _, v := range past[1 : days+1] {
+			sum += v
+		}
+		rep.RecordsPerDay = sum / float64(days)
+	}
+
+	// volume returns the records of day j relative to today: measured up to today,
+	// extrapolated after.
+	volume := func(j int) float64 {
+		switch {
+		case j > 0:
+			return math.Max(0, intercept+slope*float64(j))
+		case -j <= span:
+			return past[-j]
+		}
+		return 0
+	}
+	other := float64(max(usage.UsedBytes()-usage.TableBytes, 0))
+	file := float64(rep.FileBytes)
+	records := float64(usage.TableRows)
+	last := StorageHorizons[len(StorageHorizons)-1]
+	horizon := 0
+	for k := 1; k <= storageFullLookahead && (k <= last || (f.capacity > 0 && rep.DaysUntilFull == nil)); k++ {
+		if f.rawDays > 0 {
+			records = 0
+			for j := k - f.rawDays + 1; j <= k; j++ {
+				records += volume(j)
+			}
+		} else {
+			records += volume(k)
+		}
+		recordsBytes := records * rep.BytesPerRecord
+		used := other + recordsBytes
+		file = math.Max(file, used)
+		if f.capacity > 0 && rep.DaysUntilFull == nil && file > float64(f.capacity) {
+			d := k
+			rep.DaysUntilFull = &d
+		}
+		if horizon < len(StorageHorizons) && k == StorageHorizons[horizon] {
+			rep.Projections = append(rep.Projections, StorageProjection{
+				Days:         k,
+				Date:         today.Start.AddDate(0, 0, k).Format(timeutil.DayLayout),
+				Records:      int64(math.Round(records)),
+				RecordsBytes: int64(math.Round(recordsBytes)),
+				UsedBytes:    int64(math.Round(used)),
+				FileBytes:    int64(math.Round(file)),
+			})
+			horizon++
+		}
+	}
+	if f.capacity > 0 && rep.FileBytes > f.capacity {
+		d := 0
+		rep.DaysUntilFull = &d
+	}
+	return rep, nil
+}
+
+// fitDailyVolume fits volume = intercept + slope*x by least squares, where ys[i] is the
+// volume of day x = -(i+1). Fewer than two days give a flat line at their mean.
+func fitDailyVolume(ys []float64) (intercept, slope float64) {
+	n := float64(len(ys))
+	if len(ys) == 0 {
+		return 0, 0
+	}
+	var sx, sy, sxx, sxy float64
+	for i, y := range ys {
+		x := -float64(i + 1)
+		sx, sy, sxx, sxy = sx+x, sy+y, sxx+x*x, sxy+x*y
+	}
+	if len(ys) < 2 {
+		return sy / n, 0
+	}
+	slope = (n*sxy - sx*sy) / (n*sxx - sx*sx)
+	return (sy - slope*sx) / n, slope
+}
@@ -0,0 +1,76 @@
+package managers
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"hex_toolset/pkg/db"
+	"hex_toolset/pkg/db/entities"
+	"hex_toolset/pkg/timeutil"
+)
+
+func TestIntegrationStorageForecast(t *testing.T) {
+	resetState(t)
+	ctx := context.Background()
+
+	// 10, 20 and 30 records on the three days before base's day, 5 so far today.
+	var recs []entities.RecordEntity
+	for d, n := range map[int]int{-3: 10, -2: 20, -1: 30, 0: 5} {
+		day := timeutil.Day(base).Start.AddDate(0, 0, d)
+		for i := 0; i < n; i++ {
+			recs = append(recs, entities.RecordEntity{PPID: fmt.Sprintf("S%d_%02d", d, i), WorkOrder: "MO1", LineName: "J01",
+				GroupName: "PACKING", StationName: "PACK01", ModelName: "M", CollectedTimestamp: day.Add(time.Duration(i) * time.Minute)})
+		}
+	}
+	if err := entities.NewRecordManagerEntity(db.GetDB()).InsertBatch(recs); err != nil {
+		t.Fatal(err)
+	}
+
+	forecast := func(rawDays int, capacity int64) StorageReport {
+		t.Helper()
+		f := NewStorageForecast(db.GetDB(), rawDays, 28, capacity, nil)
+		f.now = func() time.Time { return base }
+		rep, err := f.Report(ctx)
+		if err != nil {
+			t.Fatalf("Report: %v", err)
+		}
+		return rep
+	}
+
+	// The volume grows by 10 a day from 30 yesterday: 40 + 10k on day k.
+	rep := forecast(0, 0)
+	if rep.Records != 65 || rep.HistoryDays != 3 || rep.RecordsPerDay != 20 || math.Abs(rep.TrendPerDay-10) > 1e-9 {
+		t.Fatalf("report = %+v, want 65 records, 3 days of history at 20/day growing 10/day", rep)
+	}
+	if rep.RecordsBytes <= 0 || rep.BytesPerRecord <= 0 || rep.DaysUntilFull != nil {
+		t.Fatalf("report = %+v, want the size of records_table and no capacity", rep)
+	}
+	if len(rep.Projections) != len(StorageHorizons) {
+		t.Fatalf("projections = %+v, want one per horizon", rep.Projections)
+	}
+	p := rep.Projections[0]
+	if p.Days != 30 || p.Date != "2025-04-09" || p.Records != 65+30*40+10*465 {
+		t.Fatalf("30-day projection = %+v, want %d records on 2025-04-09", p, 65+30*40+10*465)
+	}
+	for i := 1; i < len(rep.Projections); i++ {
+		if rep.Projections[i].FileBytes < rep.Projections[i-1].FileBytes {
+			t.Fatalf("file shrinks: %+v", rep.Projections)
+		}
+	}
+
+	// With two days of raw retention only days 29 and 30 remain in records_table.
+	if p := forecast(2, 0).Projections[0]; p.Records != 330+340 {
+		t.Fatalf("30-day projection with 2 raw days = %+v, want 670 records", p)
+	}
+
+	// A capacity already exceeded is full today; one far beyond the growth is never reached.
+	if rep := forecast(0, rep.FileBytes-1); rep.DaysUntilFull == nil || *rep.DaysUntilFull != 0 {
+		t.Fatalf("days until full = %v, want 0", rep.DaysUntilFull)
+	}
+	if rep := forecast(0, 1<<50); rep.DaysUntilFull != nil {
+		t.Fatalf("days until full = %d, want never", *rep.DaysUntilFull)
+	}
+}
@@ -19,10 +19,27 @@ type StoreFileManager struct {
 }
 
 // Envelope used to wrap data with a massage_type.
-// JSON structure: { "massage_type": "<type>", "massage": <data> }
+// JSON structure: { "massage_type": "<type>", "massage": <data>, "meta": {...} }
+// meta is present only for payloads implementing EnvelopeMetadata.
 type MassageEnvelope struct {
-	MassageType string      `json:"massage_type"`
-	Massage     interface{} `json:"massage"`
+	MassageType string            `json:"massage_type"`
+	Massage     interface{}       `json:"massage"`
+	Meta        map[string]string `json:"meta,omitempty"`
+}
+
+// EnvelopeMetadata is implemented by payloads that describe themselves to filtering
+// websocket clients (see websocket.Filter); the fields go into the envelope "meta".
+type EnvelopeMetadata interface {
+	EnvelopeMeta() map[string]string
+}
+
+// NewEnvelope wraps data in an envelope of massageType, with the payload's metadata.
+func NewEnvelope(massageType string, data any) MassageEnvelope {
+	env := MassageEnvelope{MassageType: massageType, Massage: data}
+	if md, ok := data.(EnvelopeMetadata); ok {
+		env.Meta = md.EnvelopeMeta()
+	}
+	return env
 }
 
 // NewStoreFileManager creates a manager using MESSAGE_DIR env var.
@@ -111,10 +128,7 @@ func (m *StoreFileManager) SaveWrapped(filename, massageType string, data any) (
 	if strings.TrimSpace(massageType) == "" {
 		return "", errors.New("massageType is required")
 	}
-	env := MassageEnvelope{
-		MassageType: massageType,
-		Massage:     data,
-	}
+	env := NewEnvelope(massageType, data)
 	return m.Save(filename, env)
 }
 
@@ -135,10 +149,7 @@ func (m *StoreFileManager) SaveWithTimestampWrapped(base, massageType string, da
 	if strings.TrimSpace(massageType) == "" {
 		return "", errors.New("massageType is required")
 	}
-	env := MassageEnvelope{
-		MassageType: massageType,
-		Massage:     data,
-	}
+	env := NewEnvelope(massageType, data)
 	return m.SaveWithTimestamp(base, env)
 }
 
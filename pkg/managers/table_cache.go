@@ -0,0 +1,69 @@
+package managers
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// tableCache is a value loaded from the database and reloaded at most once per ttl, which
+// also picks up changes made from another process. A failed reload keeps the last loaded
+// value, so a DB hiccup never flips behavior, and is not retried before the ttl expires.
+// FeatureFlags and LineMaintenance keep their table in one.
+type tableCache[T any] struct {
+	load func(context.Context) (T, error)
+	// changed, if set, is called after a reload replaced a previously loaded value, outside
+	// the lock; it compares prev and next itself.
+	changed func(prev, next T)
+	ttl     time.Duration
+	now     func() time.Time
+
+	mu       sync.Mutex
+	value    T
+	loadedAt time.Time
+	loaded   bool
+}
+
+func newTableCache[T any](ttl time.Duration, load func(context.Context) (T, error), changed func(prev, next T)) *tableCache[T] {
+	return &tableCache[T]{load: load, changed: changed, ttl: ttl, now: time.Now}
+}
+
+// get returns the cached value, reloading it first when the ttl expired. A reload error
+// is returned along with the last loaded value (the zero T before the first load).
+func (c *tableCache[T]) get(ctx context.Context) (T, error) {
+	c.mu.Lock()
+	stale := !c.loaded || c.now().Sub(c.loadedAt) >= c.ttl
+	c.mu.Unlock()
+	var err error
+	if stale {
+		err = c.refresh(ctx)
+	}
+	return c.current(), err
+}
+
+// current returns the last loaded value without reloading it.
+func (c *tableCache[T]) current() T {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.value
+}
+
+// refresh reloads the value now.
+func (c *tableCache[T]) refresh(ctx context.Context) error {
+	next, err := c.load(ctx)
+
+	c.mu.Lock()
+	c.loadedAt = c.now()
+	if err != nil {
+		c.mu.Unlock()
+		return err
+	}
+	prev, wasLoaded := c.value, c.loaded
+	c.value, c.loaded = next, true
+	c.mu.Unlock()
+
+	if wasLoaded && c.changed != nil {
+		c.changed(prev, next)
+	}
+	return nil
+}
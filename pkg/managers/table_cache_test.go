@@ -0,0 +1,54 @@
+package managers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestTableCache(t *testing.T) {
+	ctx := context.Background()
+	loads, value := 0, 1
+	var failure error
+	var changes []string
+	c := newTableCache(time.Minute, func(context.Context) (int, error) {
+		loads++
+		return value, failure
+	}, func(prev, next int) { changes = append(changes, fmt.Sprintf("%d->%d", prev, next)) })
+	now := base
+	c.now = func() time.Time { return now }
+
+	if v, err := c.get(ctx); v != 1 || err != nil || loads != 1 {
+		t.Fatalf("first get = %d, %v after %d loads", v, err, loads)
+	}
+	value = 2
+	if v, _ := c.get(ctx); v != 1 || loads != 1 {
+		t.Errorf("get within ttl = %d after %d loads, want the cached 1", v, loads)
+	}
+
+	// Past the ttl the value is reloaded; a failed reload keeps the last value and waits
+	// for the next ttl.
+	now = now.Add(time.Minute)
+	if v, _ := c.get(ctx); v != 2 || loads != 2 {
+		t.Errorf("get past ttl = %d after %d loads, want 2", v, loads)
+	}
+	value, failure = 3, errors.New("db down")
+	now = now.Add(time.Minute)
+	if v, err := c.get(ctx); v != 2 || err == nil {
+		t.Errorf("failed reload = %d, %v, want the last value and the error", v, err)
+	}
+	if v, err := c.get(ctx); v != 2 || err != nil || loads != 3 {
+		t.Errorf("get after a failed reload = %d, %v after %d loads", v, err, loads)
+	}
+
+	failure = nil
+	if err := c.refresh(ctx); err != nil || c.current() != 3 {
+		t.Fatalf("refresh = %d, %v", c.current(), err)
+	}
+	// The first load is not a change.
+	if fmt.Sprint(changes) != "[1->2 2->3]" {
+		t.Errorf("changes %v", changes)
+	}
+}
@@ -0,0 +1,364 @@
+package managers
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"hex_toolset/pkg/db/entities"
+	skylogger "hex_toolset/pkg/logger"
+	"hex_toolset/pkg/timeutil"
+)
+
+// ArchiveResult describes one day moved from records_table to an archive file.
+type ArchiveResult struct {
+	Day        string `json:"day"`
+	Records    int64  `json:"records"`
+	RollupRows int64  `json:"rollup_rows"`
+	File       string `json:"file,omitempty"`
+	Skipped    string `json:"skipped,omitempty"`
+}
+
+// TieringManager keeps raw records for the last keepDays days and, for older days, only an
+// hourly rollup in the database plus the raw rows in a gzipped NDJSON file per day.
+//
+// Days are archived oldest first and never out of order, so everything before
+// ArchivedUntil is archived and everything after is raw. CountByLineGroup, ForEachRecord
+// and PageIn split a range at that point and answer each side from its tier; they need
+// neither dir nor keepDays. A nil logger is allowed.
+type TieringManager struct {
+	records  *entities.RecordEntityManager
+	rollups  *entities.RollupManager
+	dir      string
+	keepDays int
+	logger   *skylogger.Logger
+	now      func() time.Time
+}
+
+// NewTieringManager creates a tiering manager archiving to dir.
+func NewTieringManager(database *sql.DB, dir string, keepDays int, lgr *skylogger.Logger) *TieringManager {
+	return &TieringManager{
+		records:  entities.NewRecordManagerEntity(database),
+		rollups:  entities.NewRollupManager(database),
+		dir:      dir,
+		keepDays: keepDays,
+		logger:   lgr,
+		now:      time.Now,
+	}
+}
+
+// Archive archives every day older than keepDays that still has raw records.
+func (m *TieringManager) Archive(ctx context.Context) ([]ArchiveResult, error) {
+	if m.keepDays <= 0 {
+		return nil, fmt.Errorf("tiering disabled: raw retention must be at least one day")
+	}
+	cutoff := timeutil.Day(m.now().In(time.Local)).Start.AddDate(0, 0, -m.keepDays)
+	oldest, err := m.rollups.OldestRaw(ctx)
+	if err != nil || oldest.IsZero() {
+		return nil, err
+	}
+	until, err := m.rollups.ArchivedUntil(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []ArchiveResult
+	for _, d := range (timeutil.TimeRange{Start: oldest, End: cutoff}).Days() {
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+		day := timeutil.Day(d)
+		if day.Start.Before(until) {
+			// Raw rows reappeared in an archived day (e.g. a LoadDay of an old date). The
+			// rollup and archive file are kept as they are; the rows are left for review.
+			if m.logger != nil {
+				m.logger.Warnf("tiering: %s is already archived; raw records left in place", d.Format(timeutil.DayLayout))
+			}
+			results = append(results, ArchiveResult{Day: d.Format(timeutil.DayLayout), Skipped: "already archived"})
+			continue
+		}
+		res, err := m.archiveDay(ctx, day)
+		if err != nil {
+			return results, fmt.Errorf("archive %s: %w", d.Format(timeutil.DayLayout), err)
+		}
+		results = append(results, res)
+		if m.logger != nil {
+			m.logger.Infof("tiering: archived %s: %d records, %d rollup rows -> %s", res.Day, res.Records, res.RollupRows, res.File)
+		}
+	}
+	return results, nil
+}
+
+// archiveDay rolls up day, writes its raw records to the archive file and then deletes them.
+// The file and the rollup are in place before the delete, so a crash leaves the day raw and
+// the next run redoes it.
+func (m *TieringManager) archiveDay(ctx context.Context, day timeutil.TimeRange) (ArchiveResult, error) {
+	res := ArchiveResult{Day: day.Start.Format(timeutil.DayLayout)}
+	var err error
+	if res.RollupRows, err = m.rollups.RollUp(ctx, day); err != nil {
+		return res, err
+	}
+	if res.File, res.Records, err = m.writeArchive(ctx, day); err != nil {
+		return res, err
+	}
+	return res, m.rollups.MarkArchived(ctx, day, res.File, res.Records)
+}
+
+// writeArchive streams the raw records of day into <dir>/records_YYYYMMDD.ndjson.gz,
+// written atomically. No file is written for an empty day.
+func (m *TieringManager) writeArchive(ctx context.Context, day timeutil.TimeRange) (string, int64, error) {
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return "", 0, fmt.Errorf("ensure directory %s: %w", m.dir, err)
+	}
+	tmp, err := os.CreateTemp(m.dir, ".tmp-archive-*")
+	if err != nil {
+		return "", 0, fmt.Errorf("create temp file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	defer func() { _ = os.Remove(tmpPath) }() // no-op after a successful rename
+
+	zw := gzip.NewWriter(tmp)
+	enc := json.NewEncoder(zw)
+	var rows int64
+	err = m.records.ForEachIn(ctx, day, func(r entities.RecordEntity) error {
+		rows++
+		return enc.Encode(r)
+	})
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil || rows == 0 {
+		return "", 0, err
+	}
+
+	path := filepath.Join(m.dir, "records_"+day.Start.Format("20060102")+".ndjson.gz")
+	if err := os.Rename(tmpPath, path); err != nil {
+		return "", 0, fmt.Errorf("move archive into place: %w", err)
+	}
+	return path, rows, nil
+}
+
+// CountByLineGroup counts passing/failing units per (line, group) in r: archived days from
+// the hourly rollup (so by the hours starting in r), the rest from raw records.
+func (m *TieringManager) CountByLineGroup(ctx context.Context, r timeutil.TimeRange) ([]entities.LineGroupCount, error) {
+	archived, raw, err := m.split(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	var parts [][]entities.LineGroupCount
+	if !archived.IsZero() {
+		c, err := m.rollups.CountByLineGroup(ctx, archived)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, c)
+	}
+	if !raw.IsZero() {
+		c, err := m.records.CountByLineGroup(raw.DBStart(), raw.DBEnd())
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, c)
+	}
+	if len(parts) == 1 {
+		return parts[0], nil
+	}
+	return mergeLineGroupCounts(parts...), nil
+}
+
+// ForEachRecord streams the records of r, oldest first: archived days are read back from
+// their archive files, the rest from records_table.
+func (m *TieringManager) ForEachRecord(ctx context.Context, r timeutil.TimeRange, fn func(entities.RecordEntity) error) error {
+	archived, raw, err := m.split(ctx, r)
+	if err != nil {
+		return err
+	}
+	if !archived.IsZero() {
+		if err := m.forEachArchived(ctx, archived, fn); err != nil {
+			return err
+		}
+	}
+	if !raw.IsZero() {
+		return m.records.ForEachIn(ctx, raw, fn)
+	}
+	return nil
+}
+
+// forEachArchived streams the records of r, which lies before the archive watermark, from
+// the archive files of its days.
+func (m *TieringManager) forEachArchived(ctx context.Context, r timeutil.TimeRange, fn func(entities.RecordEntity) error) error {
+	days, err := m.rollups.Archived(ctx, r)
+	if err != nil {
+		return err
+	}
+	for _, d := range days {
+		if d.Path == "" {
+			continue // empty day
+		}
+		if err := readArchive(d.Path, func(rec entities.RecordEntity) error {
+			if !r.Contains(rec.CollectedTimestamp) {
+				return nil
+			}
+			return fn(rec)
+		}); err != nil {
+			return fmt.Errorf("read archive %s: %w", d.Path, err)
+		}
+	}
+	return nil
+}
+
+// errPageFull stops reading archive files once a page is complete.
+var errPageFull = errors.New("page full")
+
+// PageIn is entities.RecordEntityManager.PageIn across both tiers: archived days are read
+// back from their archive files (written in page order) and skipped up to the cursor, the
+// rest is paged in records_table. The cursors are interchangeable with those of the
+// records table.
+func (m *TieringManager) PageIn(ctx context.Context, r timeutil.TimeRange, cursor string, limit int) (entities.RecordPage, error) {
+	page := entities.RecordPage{Records: []entities.RecordEntity{}}
+	after, err := entities.RecordsAfter(cursor)
+	if err != nil {
+		return page, err
+	}
+	if limit <= 0 || limit > entities.MaxPageSize {
+		limit = entities.MaxPageSize
+	}
+	archived, raw, err := m.split(ctx, r)
+	if err != nil {
+		return page, err
+	}
+
+	// One extra record tells whether a next page exists.
+	if !archived.IsZero() {
+		err := m.forEachArchived(ctx, archived, func(rec entities.RecordEntity) error {
+			if !after(rec) {
+				return nil
+			}
+			page.Records = append(page.Records, rec)
+			if len(page.Records) > limit {
+				return errPageFull
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, errPageFull) {
+			return page, err
+		}
+	}
+	more := len(page.Records) > limit
+	if !more && !raw.IsZero() {
+		// Raw records all sort after the archived ones, so the cursor only applies to the
+		// raw tier when no archived record followed it.
+		rawCursor := cursor
+		if len(page.Records) > 0 {
+			rawCursor = ""
+		}
+		rest, err := m.records.PageIn(ctx, raw, rawCursor, limit+1-len(page.Records))
+		if err != nil {
+			return page, err
+		}
+		page.Records = append(page.Records, rest.Records...)
+		more = len(page.Records) > limit || rest.Next != ""
+	}
+	if len(page.Records) > limit {
+		page.Records = page.Records[:limit]
+	}
+	if more {
+		page.Next = entities.PageCursor(page.Records[len(page.Records)-1])
+	}
+	return page, nil
+}
+
+// split cuts r at the archive watermark; either side may be zero.
+func (m *TieringManager) split(ctx context.Context, r timeutil.TimeRange) (archived, raw timeutil.TimeRange, err error) {
+	until, err := m.rollups.ArchivedUntil(ctx)
+	if err != nil {
+		return archived, raw, err
+	}
+	switch {
+	case !until.After(r.Start):
+		raw = r
+	case !until.Before(r.End):
+		archived = r
+	default:
+		archived = timeutil.TimeRange{Start: r.Start, End: until}
+		raw = timeutil.TimeRange{Start: until, End: r.End}
+	}
+	return archived, raw, nil
+}
+
+func readArchive(path string, fn func(entities.RecordEntity) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(bufio.NewReader(f))
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	dec := json.NewDecoder(zr)
+	for {
+		var rec entities.RecordEntity
+		if err := dec.Decode(&rec); errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+}
+
+func mergeLineGroupCounts(parts ...[]entities.LineGroupCount) []entities.LineGroupCount {
+	type key struct{ line, group string }
+	sums := map[key]*entities.LineGroupCount{}
+	for _, p := range parts {
+		for _, c := range p {
+			k := key{c.LineName, c.GroupName}
+			if s, ok := sums[k]; ok {
+				s.Units += c.Units
+				s.FailUnits += c.FailUnits
+				continue
+			}
+			c := c
+			sums[k] = &c
+		}
+	}
+	out := make([]entities.LineGroupCount, 0, len(sums))
+	for _, c := range sums {
+		out = append(out, *c)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].LineName != out[j].LineName {
+			return out[i].LineName < out[j].LineName
+		}
+		return out[i].GroupName < out[j].GroupName
+	})
+	return out
+}
+
+// Schedule runs Archive every day at hour:minute.
+func (m *TieringManager) Schedule(lm *LoopsManager, hour, minute int) {
+	lm.StartDailyAt(hour, minute, 0, func(ctx context.Context) {
+		if _, err := m.Archive(ctx); err != nil && m.logger != nil {
+			m.logger.Errorf("tiering: %v", err)
+		}
+	})
+}
@@ -0,0 +1,128 @@
+package managers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"hex_toolset/pkg/db"
+	"hex_toolset/pkg/db/entities"
+	"hex_toolset/pkg/timeutil"
+)
+
+func TestIntegrationTiering(t *testing.T) {
+	resetState(t)
+	ctx := context.Background()
+	conn := db.GetDB()
+
+	// Two days of records: the first is archived, the second stays raw. Two records share
+	// a timestamp so pages also break ties on the ID.
+	var recs []entities.RecordEntity
+	add := func(at time.Time, ppid, line, group string, fail bool) {
+		recs = append(recs, entities.RecordEntity{PPID: ppid, WorkOrder: "MO1", LineName: line, GroupName: group,
+			StationName: group + "01", ModelName: "M", CollectedTimestamp: at, ErrorFlag: fail})
+	}
+	add(base, "P1", "J01", "PACKING", false)
+	add(base, "P2", "J01", "PACKING", false)
+	add(base.Add(30*time.Minute), "P3", "J01", "PACKING", true)
+	add(base.Add(time.Hour), "P4", "J01", "FT", false)
+	add(base.Add(2*time.Hour), "P5", "J02", "PACKING", false)
+	add(base.Add(24*time.Hour), "P6", "J01", "PACKING", false)
+	add(base.Add(25*time.Hour), "P7", "J01", "FT", true)
+	add(base.Add(26*time.Hour), "P8", "J02", "PACKING", false)
+	if _, err := entities.NewRecordManagerEntity(conn).InsertBatchStats(ctx, recs); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewTieringManager(conn, t.TempDir(), 1, nil) // no logger, as the fix command may pass
+	m.now = func() time.Time { return base.Add(48 * time.Hour) }
+	span := timeutil.TimeRange{Start: timeutil.Day(base).Start, End: timeutil.Day(base).Start.AddDate(0, 0, 2)}
+	readAll := func() []string {
+		t.Helper()
+		var ids []string
+		if err := m.ForEachRecord(ctx, span, func(r entities.RecordEntity) error {
+			ids = append(ids, r.ID)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return ids
+	}
+	countsBefore, err := m.CountByLineGroup(ctx, span)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idsBefore := readAll()
+	if len(idsBefore) != len(recs) {
+		t.Fatalf("read %d records before archiving, want %d", len(idsBefore), len(recs))
+	}
+
+	results, err := m.Archive(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("archived %+v, want only 2025-03-10", results)
+	}
+	res := results[0]
+	// hours 08 (PACKING), 09 (FT) and 10 (J02 PACKING)
+	if res.Day != "2025-03-10" || res.Records != 5 || res.RollupRows != 3 || res.Skipped != "" {
+		t.Errorf("archive result %+v", res)
+	}
+	if _, err := os.Stat(res.File); err != nil {
+		t.Errorf("archive file: %v", err)
+	}
+	var raw int
+	if err := conn.QueryRow("SELECT COUNT(*) FROM records_table").Scan(&raw); err != nil || raw != 3 {
+		t.Errorf("%d raw records left, want 3 (%v)", raw, err)
+	}
+	if again, err := m.Archive(ctx); err != nil || len(again) != 0 {
+		t.Errorf("second archive run = %+v, %v", again, err)
+	}
+
+	// Readback across the watermark answers as before archiving: counts from the rollup,
+	// records from the archive file.
+	counts, err := m.CountByLineGroup(ctx, span)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(counts) != fmt.Sprint(countsBefore) {
+		t.Errorf("counts after archiving %v, want %v", counts, countsBefore)
+	}
+	if ids := readAll(); fmt.Sprint(ids) != fmt.Sprint(idsBefore) {
+		t.Errorf("records after archiving %v, want %v", ids, idsBefore)
+	}
+
+	// Pages of any size walk both tiers in order, crossing the watermark mid-page.
+	for limit := 1; limit <= len(recs)+1; limit++ {
+		var ids []string
+		cursor := ""
+		for pages := 0; ; pages++ {
+			if pages > len(recs) {
+				t.Fatalf("limit %d: paging does not end", limit)
+			}
+			page, err := m.PageIn(ctx, span, cursor, limit)
+			if err != nil {
+				t.Fatalf("limit %d: %v", limit, err)
+			}
+			if len(page.Records) > limit {
+				t.Fatalf("limit %d: page of %d", limit, len(page.Records))
+			}
+			for _, r := range page.Records {
+				ids = append(ids, r.ID)
+			}
+			if page.Next == "" {
+				break
+			}
+			cursor = page.Next
+		}
+		if fmt.Sprint(ids) != fmt.Sprint(idsBefore) {
+			t.Errorf("limit %d: paged %v, want %v", limit, ids, idsBefore)
+		}
+	}
+	if _, err := m.PageIn(ctx, span, "garbage", 2); err == nil {
+		t.Error("invalid cursor accepted")
+	}
+}
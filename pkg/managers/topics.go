@@ -0,0 +1,109 @@
+package managers
+
+import (
+	"time"
+
+	"hex_toolset/pkg/db/entities"
+	"hex_toolset/pkg/topics"
+)
+
+// Broadcast topics (envelope massage_type values) published by the managers.
+const (
+	TopicLastHour   = "LAST_HOUR"
+	TopicLastUpdate = "LAST_UPDATE"
+	// TopicLastUpdateDelta carries the LAST_UPDATE keys that changed, with delta broadcasts.
+	TopicLastUpdateDelta = "LAST_UPDATE_DELTA"
+	TopicLatest          = "LATEST"
+	TopicAlert           = "ALERT"
+	TopicShiftClosed     = "SHIFT_CLOSED"
+	TopicFeatureFlags    = "FEATURE_FLAGS"
+	// TopicLineMaintenance lists the lines whose ingestion is disabled.
+	TopicLineMaintenance = "LINE_MAINTENANCE"
+	// TopicStationVariance is the live cycle time of the stations with a target.
+	TopicStationVariance = "STATION_VARIANCE"
+	// TopicWIP counts the units in process per line and group.
+	TopicWIP = "WIP"
+	// TopicOEE is the OEE of the stations with a target over a closed shift.
+	TopicOEE = "OEE"
+	// TopicMaintenanceWindows lists the maintenance windows in progress.
+	TopicMaintenanceWindows = "MAINTENANCE_WINDOWS"
+	// TopicLatestLinePrefix starts the per-line LATEST topics; see LatestLineTopic.
+	TopicLatestLinePrefix = "LATEST_"
+)
+
+// LatestLineTopic is the topic of line's part of LATEST, e.g. LATEST_J06.
+func LatestLineTopic(line string) string { return TopicLatestLinePrefix + line }
+
+func init() {
+	topics.Register(topics.Topic{
+		Name:        TopicLastHour,
+		Description: "Passing units in the current hour keyed by LINE_GROUP (e.g. J06_PACKING).",
+		Frequency:   time.Minute,
+		Payload:     map[string]int{},
+	})
+	topics.Register(topics.Topic{
+		Name:        TopicLastUpdate,
+		Description: "Latest passing timestamp ('YYYY-MM-DD HH:MM:SS') keyed by LINE_GROUP, from latest_pass; always the full map. With the delta_broadcasts flag it is sent after start and at every hour, and LAST_UPDATE_DELTA in the other minutes.",
+		Frequency:   time.Minute,
+		Payload:     map[string]string{},
+	})
+	topics.Register(topics.Topic{
+		Name:        TopicLastUpdateDelta,
+		Description: "The LAST_UPDATE keys whose timestamp changed since the previous publish, sent instead of LAST_UPDATE between the hourly full maps when the delta_broadcasts flag is on; merge it into the last LAST_UPDATE.",
+		Frequency:   time.Minute,
+		Payload:     map[string]string{},
+	})
+	topics.Register(topics.Topic{
+		Name:        TopicLatest,
+		Description: "Units in process from latest_group with their counts per LINE_GROUP and line, published when the WIP changed (LATEST_SNAPSHOT_MINUTES); clients connecting with ?snapshot=groups or ?snapshot=lines get only those counts, also right after subscribing.",
+		Payload:     LatestSnapshot{},
+	})
+	topics.Register(topics.Topic{
+		Name:        TopicLatestLinePrefix + "{LINE}",
+		Prefix:      TopicLatestLinePrefix,
+		Description: "One line's part of LATEST (e.g. LATEST_J06): its units in process and their counts, published with LATEST when LATEST_LINE_SNAPSHOTS is set; a line whose WIP emptied gets one snapshot without units.",
+		Payload:     LatestSnapshot{},
+	})
+	topics.Register(topics.Topic{
+		Name:        TopicAlert,
+		Description: "Alert raised or resolved by a service (e.g. SFC API latency degradation).",
+		Payload:     Alert{},
+	})
+	topics.Register(topics.Topic{
+		Name:        TopicShiftClosed,
+		Description: "Final, frozen figures of a shift published after it ends; the version increments on re-freeze.",
+		Payload:     entities.ShiftClosure{},
+	})
+	topics.Register(topics.Topic{
+		Name:        TopicFeatureFlags,
+		Description: "Feature flag state, published when a flag changes in the feature_flags table.",
+		Payload:     FeatureFlagsChanged{},
+	})
+	topics.Register(topics.Topic{
+		Name:        TopicLineMaintenance,
+		Description: "Lines disabled for maintenance, published when a line is disabled or re-enabled; their keys are absent from LAST_HOUR and LAST_UPDATE meanwhile.",
+		Payload:     LineMaintenanceChanged{},
+	})
+	topics.Register(topics.Topic{
+		Name:        TopicStationVariance,
+		Description: "Rolling cycle time of each station with a target against that target, from the live minutes in memory.",
+		Frequency:   time.Minute,
+		Payload:     StationVarianceSnapshot{},
+	})
+	topics.Register(topics.Topic{
+		Name:        TopicWIP,
+		Description: "Units in process keyed by LINE_GROUP of their latest pass, from latest_group; units leave it at IN_STORE.",
+		Frequency:   time.Minute,
+		Payload:     map[string]int{},
+	})
+	topics.Register(topics.Topic{
+		Name:        TopicOEE,
+		Description: "Availability, performance, first pass yield and OEE per station and line with a cycle time target, published after SHIFT_CLOSED.",
+		Payload:     ShiftOEE{},
+	})
+	topics.Register(topics.Topic{
+		Name:        TopicMaintenanceWindows,
+		Description: "Planned maintenance windows in progress (line empty for all lines), published when one starts or ends; alerts raised meanwhile are not broadcast.",
+		Payload:     MaintenanceWindowsActive{},
+	})
+}
@@ -0,0 +1,240 @@
+package managers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"hex_toolset/pkg/db/entities"
+	"hex_toolset/pkg/timeutil"
+)
+
+// TotalLine names the row of a weekly trend summing every line.
+const TotalLine = "ALL"
+
+// WeekFigures are the aggregates of one line over one week.
+type WeekFigures struct {
+	Output    int `json:"output"` // passes of the output group
+	Tested    int `json:"tested"` // units tested, once per station (see entities.LineFirstPass)
+	FirstPass int `json:"first_pass"`
+	// FPY is the first pass yield, FirstPass over Tested; 0 without units tested.
+	FPY float64 `json:"fpy"`
+	// DowntimeSeconds and Stops sum the stops of the line's stations with a cycle time
+	// target over the shifts starting in the week (see OEEFigures); 0 without targets.
+	DowntimeSeconds float64 `json:"downtime_seconds"`
+	Stops           int     `json:"stops"`
+}
+
+func (f *WeekFigures) add(o WeekFigures) {
+	f.Output += o.Output
+	f.Tested += o.Tested
+	f.FirstPass += o.FirstPass
+	f.DowntimeSeconds += o.DowntimeSeconds
+	f.Stops += o.Stops
+}
+
+func (f *WeekFigures) compute() {
+	f.FPY = 0
+	if f.Tested > 0 {
+		f.FPY = float64(f.FirstPass) / float64(f.Tested)
+	}
+}
+
+// TrendDelta is the change from last week to this week: output and downtime in percent of
+// last week's, FPY in percentage points. A delta is null when last week has no base (no
+// output, no units tested, no downtime).
+type TrendDelta struct {
+	OutputPct   *float64 `json:"output_pct"`
+	FPYPoints   *float64 `json:"fpy_points"`
+	DowntimePct *float64 `json:"downtime_pct"`
+}
+
+// LineTrend puts one line's figures of this week and last week side by side.
+type LineTrend struct {
+	Line     string      `json:"line"`
+	LastWeek WeekFigures `json:"last_week"`
+	ThisWeek WeekFigures `json:"this_week"`
+	Delta    TrendDelta  `json:"delta"`
+}
+
+// WeeklyTrendReport compares a week with the week before, per line and in total, as on the
+// production meeting slide. While the week is in progress (Until set) it is measured up to
+// now and last week up to the same point, so the deltas compare equal spans.
+type WeeklyTrendReport struct {
+	Week        string `json:"week"` // Monday of this week, YYYY-MM-DD local
+	From        string `json:"from"` // 'YYYY-MM-DD HH:MM:SS' local
+	To          string `json:"to"`
+	Until       string `json:"until,omitempty"`
+	LastFrom    string `json:"last_from"`
+	LastTo      string `json:"last_to"`
+	OutputGroup string `json:"output_group"`
+	// Downtime reports whether the downtime figures were measured (OEE enabled).
+	Downtime bool        `json:"downtime"`
+	Lines    []LineTrend `json:"lines"`
+	Total    LineTrend   `json:"total"`
+}
+
+// WeeklyTrend aggregates output, first pass yield and downtime per line and week from the
+// raw records (output also from the rollup of archived days), for the weekly production
+// meeting.
+type WeeklyTrend struct {
+	records     *entities.RecordEntityManager
+	tiers       *TieringManager
+	oee         *OEE
+	outputGroup string
+	now         func() time.Time
+}
+
+// NewWeeklyTrend creates the weekly trend of database counting the passes of outputGroup
+// (e.g. PACKING) as output, with the downtime of oee; a nil oee leaves downtime out.
+func NewWeeklyTrend(database *sql.DB, outputGroup string, oee *OEE) *WeeklyTrend {
+	return &WeeklyTrend{records: entities.NewRecordManagerEntity(database), tiers: NewTieringManager(database, "", 0, nil),
+		oee: oee, outputGroup: outputGroup, now: time.Now}
+}
+
+// Report compares the local week containing day with the week before, of one line or ("")
+// all lines. A week that has not started yet is an error.
+func (t *WeeklyTrend) Report(ctx context.Context, day time.Time, line string) (WeeklyTrendReport, error) {
+	this := timeutil.Week(day.In(time.Local))
+	last := timeutil.Week(this.Start.AddDate(0, 0, -1))
+	rep := WeeklyTrendReport{Week: this.Start.Format(timeutil.DayLayout), From: timeutil.FormatLocal(this.Start),
+		To: timeutil.FormatLocal(this.End), OutputGroup: t.outputGroup, Downtime: t.oee != nil, Lines: []LineTrend{}}
+	now := t.now()
+	if !now.After(this.Start) {
+		return rep, fmt.Errorf("week of %s has not started", rep.Week)
+	}
+	if now.Before(this.End) {
+		this.End = now
+		last.End = last.Start.Add(now.Sub(this.Start))
+		rep.Until = timeutil.FormatLocal(now)
+	}
+	rep.LastFrom, rep.LastTo = timeutil.FormatLocal(last.Start), timeutil.FormatLocal(last.End)
+
+	line = normalizeLine(line)
+	lastWeek, err := t.week(ctx, last, line)
+	if err != nil {
+		return rep, fmt.Errorf("week of %s: %w", last.Start.Format(timeutil.DayLayout), err)
+	}
+	thisWeek, err := t.week(ctx, this, line)
+	if err != nil {
+		return rep, fmt.Errorf("week of %s: %w", rep.Week, err)
+	}
+
+	lines := map[string]*LineTrend{}
+	for name := range lastWeek {
+		lines[name] = &LineTrend{Line: name}
+	}
+	for name := range thisWeek {
+		lines[name] = &LineTrend{Line: name}
+	}
+	rep.Total.Line = TotalLine
+	for name, l := range lines {
+		l.LastWeek, l.ThisWeek = lastWeek[name], thisWeek[name]
+		rep.Total.LastWeek.add(l.LastWeek)
+		rep.Total.ThisWeek.add(l.ThisWeek)
+		l.compute()
+		rep.Lines = append(rep.Lines, *l)
+	}
+	rep.Total.compute()
+	sort.Slice(rep.Lines, func(i, j int) bool { return rep.Lines[i].Line < rep.Lines[j].Line })
+	return rep, nil
+}
+
+// week returns the figures of each line (or only line) over r, without FPY.
+func (t *WeeklyTrend) week(ctx context.Context, r timeutil.TimeRange, line string) (map[string]WeekFigures, error) {
+	out := map[string]WeekFigures{}
+	update := func(name string, fn func(f *WeekFigures)) {
+		name = normalizeLine(name)
+		if line != "" && name != line {
+			return
+		}
+		f := out[name]
+		fn(&f)
+		out[name] = f
+	}
+
+	counts, err := t.tiers.CountByLineGroup(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range counts {
+		if strings.EqualFold(c.GroupName, t.outputGroup) {
+			update(c.LineName, func(f *WeekFigures) { f.Output += c.Units })
+		}
+	}
+	tested, err := t.records.FirstPassByLine(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range tested {
+		update(c.LineName, func(f *WeekFigures) { f.Tested += c.Units; f.FirstPass += c.FirstPass })
+	}
+	if t.oee == nil {
+		return out, nil
+	}
+	shifts, err := t.oee.Report(ctx, r, line)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range shifts {
+		for _, l := range s.Lines {
+			update(l.Line, func(f *WeekFigures) { f.DowntimeSeconds += l.DowntimeSeconds; f.Stops += l.Stops })
+		}
+	}
+	return out, nil
+}
+
+// compute derives the yields and the deltas from the sums.
+func (l *LineTrend) compute() {
+	l.LastWeek.compute()
+	l.ThisWeek.compute()
+	l.Delta = TrendDelta{
+		OutputPct:   percentChange(float64(l.LastWeek.Output), float64(l.ThisWeek.Output)),
+		DowntimePct: percentChange(l.LastWeek.DowntimeSeconds, l.ThisWeek.DowntimeSeconds),
+	}
+	if l.LastWeek.Tested > 0 && l.ThisWeek.Tested > 0 {
+		points := (l.ThisWeek.FPY - l.LastWeek.FPY) * 100
+		l.Delta.FPYPoints = &points
+	}
+}
+
+// percentChange returns the change from last to this in percent of last; nil when last is 0.
+func percentChange(last, this float64) *float64 {
+	if last == 0 {
+		return nil
+	}
+	pct := (this - last) / last * 100
+	return &pct
+}
+
+// WriteCSV writes the lines of rep and their total as CSV with a header row, one line per
+// row with last week, this week and the delta of each figure side by side (downtime in
+// minutes; a delta without base is empty).
+func (rep WeeklyTrendReport) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"line", "output_last", "output_this", "output_delta_pct", "fpy_last", "fpy_this",
+		"fpy_delta_points", "downtime_min_last", "downtime_min_this", "downtime_delta_pct"})
+	num := func(v float64, prec int) string { return strconv.FormatFloat(v, 'f', prec, 64) }
+	delta := func(v *float64) string {
+		if v == nil {
+			return ""
+		}
+		return num(*v, 1)
+	}
+	for _, l := range append(rep.Lines, rep.Total) {
+		_ = cw.Write([]string{l.Line, strconv.Itoa(l.LastWeek.Output), strconv.Itoa(l.ThisWeek.Output), delta(l.Delta.OutputPct),
+			num(l.LastWeek.FPY*100, 2), num(l.ThisWeek.FPY*100, 2), delta(l.Delta.FPYPoints),
+			num(l.LastWeek.DowntimeSeconds/60, 1), num(l.ThisWeek.DowntimeSeconds/60, 1), delta(l.Delta.DowntimePct)})
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("write weekly trend: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package managers
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"hex_toolset/pkg/db"
+	"hex_toolset/pkg/db/entities"
+	skylogger "hex_toolset/pkg/logger"
+)
+
+func TestIntegrationWeeklyTrend(t *testing.T) {
+	resetState(t)
+	lastWeek := base.AddDate(0, 0, -7)
+	rec := func(ppid, line, group string, at time.Time, errorFlag bool) entities.RecordEntity {
+		return entities.RecordEntity{PPID: ppid, WorkOrder: "MO1", CollectedTimestamp: at, GroupName: group,
+			LineName: line, StationName: group + "01", ModelName: "MODELX", ErrorFlag: errorFlag}
+	}
+	recs := []entities.RecordEntity{
+		rec("V1", "J02", "PACKING", lastWeek, false),
+		rec("V1", "J02", "FT", lastWeek, true),
+		rec("V2", "J01", "PACKING", lastWeek.Add(2*time.Hour), false), // after the point this week is at
+		rec("W6", "J01", "PACKING", base.Add(6*time.Minute), true),
+		rec("W6", "J01", "PACKING", base.Add(7*time.Minute), false), // a retest: a pass, not a first pass
+		rec("X1", "j03", "PACKING", base, false),
+	}
+	for i := 1; i <= 5; i++ {
+		recs = append(recs, rec(fmt.Sprintf("U%d", i), "J01", "PACKING", lastWeek.Add(time.Duration(i)*time.Minute), i == 5),
+			rec(fmt.Sprintf("W%d", i), "J01", "PACKING", base.Add(time.Duration(i)*time.Minute), false))
+	}
+	if err := entities.NewRecordManagerEntity(db.GetDB()).InsertBatch(recs); err != nil {
+		t.Fatal(err)
+	}
+
+	trend := NewWeeklyTrend(db.GetDB(), "packing", nil)
+	trend.now = func() time.Time { return base.Add(time.Hour) }
+	lgr, _ := skylogger.New(skylogger.WithName("test_admin"))
+	admin := NewAdminServer("127.0.0.1:0", lgr)
+	admin.HandleWeeklyTrend(trend)
+	get := func(query string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/trend/weekly?"+query, nil)
+		w := httptest.NewRecorder()
+		admin.server.Handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("")
+	var rep WeeklyTrendReport
+	if err := json.Unmarshal(w.Body.Bytes(), &rep); w.Code != http.StatusOK || err != nil {
+		t.Fatalf("status %d, %v: %s", w.Code, err, w.Body)
+	}
+	// The week in progress is compared with last week up to the same hour.
+	if rep.Week != "2025-03-10" || rep.Until != "2025-03-10 09:00:00" || rep.LastFrom != "2025-03-03 00:00:00" ||
+		rep.LastTo != "2025-03-03 09:00:00" || rep.Downtime || len(rep.Lines) != 3 {
+		t.Fatalf("report = %+v", rep)
+	}
+	near := func(got *float64, want float64) bool { return got != nil && math.Abs(*got-want) < 1e-9 }
+	j01, j02, j03 := rep.Lines[0], rep.Lines[1], rep.Lines[2]
+	if j01.Line != "J01" || j01.LastWeek != (WeekFigures{Output: 4, Tested: 5, FirstPass: 4, FPY: 0.8}) ||
+		j01.ThisWeek != (WeekFigures{Output: 6, Tested: 6, FirstPass: 5, FPY: 5.0 / 6}) ||
+		!near(j01.Delta.OutputPct, 50) || !near(j01.Delta.FPYPoints, (5.0/6-0.8)*100) || j01.Delta.DowntimePct != nil {
+		t.Fatalf("J01 = %+v", j01)
+	}
+	if j02.Line != "J02" || j02.LastWeek.Output != 1 || j02.LastWeek.Tested != 2 || j02.ThisWeek != (WeekFigures{}) ||
+		!near(j02.Delta.OutputPct, -100) || j02.Delta.FPYPoints != nil {
+		t.Fatalf("J02 = %+v", j02)
+	}
+	if j03.Line != "J03" || j03.ThisWeek.Output != 1 || j03.Delta.OutputPct != nil {
+		t.Fatalf("J03 = %+v", j03)
+	}
+	if rep.Total.Line != TotalLine || rep.Total.LastWeek.Output != 5 || rep.Total.ThisWeek.Output != 7 ||
+		!near(rep.Total.Delta.OutputPct, 40) || rep.Total.LastWeek.Tested != 7 || rep.Total.ThisWeek.FirstPass != 6 {
+		t.Fatalf("total = %+v", rep.Total)
+	}
+
+	// Any day of a week selects it; a finished week is compared whole.
+	w = get("week=2025-03-05&line=j01&format=csv")
+	wantCSV := "line,output_last,output_this,output_delta_pct,fpy_last,fpy_this,fpy_delta_points,downtime_min_last,downtime_min_this,downtime_delta_pct\n" +
+		"J01,0,5,,0.00,83.33,,0.0,0.0,\n" +
+		"ALL,0,5,,0.00,83.33,,0.0,0.0,\n"
+	if w.Code != http.StatusOK || w.Body.String() != wantCSV ||
+		w.Header().Get("Content-Disposition") != `attachment; filename="trend_20250303.csv"` {
+		t.Fatalf("csv: status %d %q: %s", w.Code, w.Header().Get("Content-Disposition"), w.Body)
+	}
+
+	for _, query := range []string{"week=2025-03-17", "week=someday", "format=xml"} {
+		if w := get(query); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d: %s", query, w.Code, w.Body)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+// Counter is a monotonically increasing value (Prometheus counter).
+type Counter struct {
+	name, help string
+	labels     Labels
+	value      atomic.Uint64
+}
+
+// NewCounter creates a counter; by convention name ends in _total.
+func NewCounter(name, help string, labels Labels) *Counter {
+	return &Counter{name: name, help: help, labels: labels}
+}
+
+// Inc adds one.
+func (c *Counter) Inc() { c.value.Add(1) }
+
+// Add adds n.
+func (c *Counter) Add(n uint64) { c.value.Add(n) }
+
+// Value returns the current count.
+func (c *Counter) Value() uint64 { return c.value.Load() }
+
+func (c *Counter) Name() string { return c.name }
+func (c *Counter) Help() string { return c.help }
+func (c *Counter) Type() string { return "counter" }
+
+func (c *Counter) WriteSamples(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "%s%s %d\n", c.name, c.labels.format("", ""), c.Value())
+	return err
+}
@@ -0,0 +1,31 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+)
+
+// GaugeFunc is a gauge whose value is computed by fn at scrape time, for values derived
+// from state the owner already keeps (a window, a queue length) rather than set on change.
+type GaugeFunc struct {
+	name, help string
+	labels     Labels
+	fn         func() float64
+}
+
+// NewGaugeFunc creates a gauge reading its value from fn; fn must be safe for concurrent use.
+func NewGaugeFunc(name, help string, labels Labels, fn func() float64) *GaugeFunc {
+	return &GaugeFunc{name: name, help: help, labels: labels, fn: fn}
+}
+
+// Value returns the current value.
+func (g *GaugeFunc) Value() float64 { return g.fn() }
+
+func (g *GaugeFunc) Name() string { return g.name }
+func (g *GaugeFunc) Help() string { return g.help }
+func (g *GaugeFunc) Type() string { return "gauge" }
+
+func (g *GaugeFunc) WriteSamples(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "%s%s %s\n", g.name, g.labels.format("", ""), formatFloat(g.Value()))
+	return err
+}
@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync"
+)
+
+// Histogram counts observations into cumulative buckets (Prometheus semantics).
+type Histogram struct {
+	name, help string
+	labels     Labels
+
+	mu      sync.Mutex
+	buckets []float64 // upper bounds, ascending, without +Inf
+	counts  []uint64  // per-bucket (non-cumulative) counts; last slot is +Inf
+	sum     float64
+	count   uint64
+}
+
+// NewHistogram creates a histogram with the given bucket upper bounds.
+func NewHistogram(name, help string, buckets []float64, labels Labels) *Histogram {
+	b := append([]float64(nil), buckets...)
+	sort.Float64s(b)
+	return &Histogram{
+		name:    name,
+		help:    help,
+		labels:  labels,
+		buckets: b,
+		counts:  make([]uint64, len(b)+1),
+	}
+}
+
+// Observe records one value.
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.buckets, v)
+	h.mu.Lock()
+	h.counts[i]++
+	h.sum += v
+	h.count++
+	h.mu.Unlock()
+}
+
+// HistogramSnapshot is a point-in-time copy of a histogram.
+type HistogramSnapshot struct {
+	Buckets    []float64 `json:"buckets"`
+	Cumulative []uint64  `json:"cumulative"` // aligned with Buckets, plus a final +Inf entry
+	Sum        float64   `json:"sum"`
+	Count      uint64    `json:"count"`
+}
+
+// Snapshot returns a consistent copy of the histogram state.
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	cum := make([]uint64, len(h.counts))
+	var running uint64
+	for i, c := range h.counts {
+		running += c
+		cum[i] = running
+	}
+	return HistogramSnapshot{
+		Buckets:    append([]float64(nil), h.buckets...),
+		Cumulative: cum,
+		Sum:        h.sum,
+		Count:      h.count,
+	}
+}
+
+func (h *Histogram) Name() string { return h.name }
+func (h *Histogram) Help() string { return h.help }
+func (h *Histogram) Type() string { return "histogram" }
+
+func (h *Histogram) WriteSamples(w io.Writer) error {
+	s := h.Snapshot()
+	for i, ub := range append(s.Buckets, math.Inf(+1)) {
+		if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labels.format("le", formatFloat(ub)), s.Cumulative[i]); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.labels.format("", ""), formatFloat(s.Sum)); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.labels.format("", ""), s.Count)
+	return err
+}
@@ -0,0 +1,105 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Collector is anything that can write itself in Prometheus text exposition format.
+type Collector interface {
+	// Name is the metric family name; collectors sharing a name are grouped together.
+	Name() string
+	Help() string
+	Type() string
+	// WriteSamples writes the sample lines (no HELP/TYPE header).
+	WriteSamples(w io.Writer) error
+}
+
+// Registry holds collectors exposed by one process.
+type Registry struct {
+	mu         sync.RWMutex
+	collectors []Collector
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry { return &Registry{} }
+
+// Default is the process-wide registry used by packages that publish metrics.
+var Default = NewRegistry()
+
+// Register adds c to the registry.
+func (r *Registry) Register(c Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, c)
+}
+
+// WritePrometheus writes all collectors in Prometheus text format (version 0.0.4).
+func (r *Registry) WritePrometheus(w io.Writer) error {
+	r.mu.RLock()
+	cs := make([]Collector, len(r.collectors))
+	copy(cs, r.collectors)
+	r.mu.RUnlock()
+
+	sort.SliceStable(cs, func(i, j int) bool { return cs[i].Name() < cs[j].Name() })
+	lastName := ""
+	for _, c := range cs {
+		if c.Name() != lastName {
+			if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", c.Name(), c.Help(), c.Name(), c.Type()); err != nil {
+				return err
+			}
+			lastName = c.Name()
+		}
+		if err := c.WriteSamples(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Handler serves the registry in Prometheus text format.
+func Handler(r *Registry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = r.WritePrometheus(w)
+	})
+}
+
+// Labels are constant label pairs attached to a collector.
+type Labels map[string]string
+
+// format renders labels as {k="v",...} in key order, optionally with one extra pair.
+func (l Labels) format(extraKey, extraVal string) string {
+	keys := make([]string, 0, len(l))
+	for k := range l {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%q", k, l[k]))
+	}
+	if extraKey != "" {
+		parts = append(parts, fmt.Sprintf("%s=%q", extraKey, extraVal))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, +1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	default:
+		return fmt.Sprintf("%g", v)
+	}
+}
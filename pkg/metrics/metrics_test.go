@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHistogramPrometheusOutput(t *testing.T) {
+	r := NewRegistry()
+	h := NewHistogram("req_seconds", "request latency", []float64{1, 0.5}, Labels{"endpoint": "minute"})
+	r.Register(h)
+	h.Observe(0.2)
+	h.Observe(0.7)
+	h.Observe(3)
+
+	var b strings.Builder
+	if err := r.WritePrometheus(&b); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	out := b.String()
+	for _, want := range []string{
+		"# TYPE req_seconds histogram",
+		`req_seconds_bucket{endpoint="minute",le="0.5"} 1`,
+		`req_seconds_bucket{endpoint="minute",le="1"} 2`,
+		`req_seconds_bucket{endpoint="minute",le="+Inf"} 3`,
+		`req_seconds_count{endpoint="minute"} 3`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("missing %q in output:\n%s", want, out)
+		}
+	}
+}
+
+func TestCounterPrometheusOutput(t *testing.T) {
+	r := NewRegistry()
+	c := NewCounter("ops_total", "operations", Labels{"op": "insert"})
+	r.Register(c)
+	c.Inc()
+	c.Add(2)
+
+	var b strings.Builder
+	if err := r.WritePrometheus(&b); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	out := b.String()
+	for _, want := range []string{"# TYPE ops_total counter", `ops_total{op="insert"} 3`} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("missing %q in output:\n%s", want, out)
+		}
+	}
+}
+
+func TestGaugeFuncPrometheusOutput(t *testing.T) {
+	r := NewRegistry()
+	v := 1.5
+	r.Register(NewGaugeFunc("queue_depth", "queued items", Labels{"queue": "repair"}, func() float64 { return v }))
+	v = 4
+
+	var b strings.Builder
+	if err := r.WritePrometheus(&b); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	out := b.String()
+	for _, want := range []string{"# TYPE queue_depth gauge", `queue_depth{queue="repair"} 4`} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("missing %q in output:\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package sfc_api
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Vendor dumps.
+//
+// The SFC vendor publishes periodic exports of the collector table, spooled from Oracle
+// as delimited text: a header row with the API's column names (SERIAL_NUMBER,
+// IN_STATION_TIME, ...) and one row per pass. Older windows are only available this way,
+// since the HTTP API no longer answers for them.
+
+// dumpColumns maps the dump header names to the record fields.
+var dumpColumns = map[string]func(r *RecordDataCollector) *string{
+	"CONTAINER_NO":    func(r *RecordDataCollector) *string { return &r.ContainerNo },
+	"EMP_NO":          func(r *RecordDataCollector) *string { return &r.EmpNo },
+	"GROUP_NAME":      func(r *RecordDataCollector) *string { return &r.GroupName },
+	"IN_LINE_TIME":    func(r *RecordDataCollector) *string { return &r.InLineTime },
+	"IN_STATION_TIME": func(r *RecordDataCollector) *string { return &r.InStationTime },
+	"LINE_NAME":       func(r *RecordDataCollector) *string { return &r.LineName },
+	"MODEL_NAME":      func(r *RecordDataCollector) *string { return &r.ModelName },
+	"MO_NUMBER":       func(r *RecordDataCollector) *string { return &r.MoNumber },
+	"PALLET_NO":       func(r *RecordDataCollector) *string { return &r.PalletNo },
+	"SECTION_NAME":    func(r *RecordDataCollector) *string { return &r.SectionName },
+	"SERIAL_NUMBER":   func(r *RecordDataCollector) *string { return &r.SerialNumber },
+	"STATION_NAME":    func(r *RecordDataCollector) *string { return &r.StationName },
+	"VERSION_CODE":    func(r *RecordDataCollector) *string { return &r.VersionCode },
+	"ERROR_FLAG":      func(r *RecordDataCollector) *string { return &r.ErrorFlag },
+	"NEXT_STATION":    func(r *RecordDataCollector) *string { return &r.NextStations },
+}
+
+// requiredDumpColumns are the columns of the records_table logical key.
+var requiredDumpColumns = []string{"SERIAL_NUMBER", "IN_STATION_TIME", "LINE_NAME", "STATION_NAME", "GROUP_NAME"}
+
+// dumpTimeLayouts are the Oracle renderings of IN_STATION_TIME found in dumps, tried
+// before the API formats (see ParseAPITimestamp).
+var dumpTimeLayouts = []string{
+	"02-Jan-06 03.04.05.999999999 PM", // NLS_TIMESTAMP_FORMAT default
+	"02-Jan-06 03.04.05 PM",
+	"02-Jan-06 15:04:05",
+	"2006-01-02 15:04:05.999999999",
+}
+
+// DumpRowError is a dump row that could not be read as a record.
+type DumpRowError struct {
+	Line int // line of the row in the dump, 1-based
+	Err  error
+}
+
+func (e DumpRowError) Error() string { return fmt.Sprintf("line %d: %v", e.Line, e.Err) }
+
+// ReadDump reads a vendor dump, plain or gzip-compressed. The delimiter (comma,
+// semicolon, pipe or tab) is taken from the header; column names are matched case
+// insensitively and unknown columns are ignored. Records are normalized as the API's are
+// (line codes, underscores in group names) and IN_STATION_TIME is returned in the API's
+// "2006-01-02 15:04:05" format. Rows that cannot be used (wrong field count, no serial
+// number or an unreadable time, e.g. the "N rows selected." trailer of a spool) are
+// skipped and returned as DumpRowErrors; err is only set when the dump itself is unreadable.
+func ReadDump(r io.Reader) (records []RecordDataCollector, skipped []DumpRowError, err error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(2); isGzip(magic) {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, nil, fmt.Errorf("dump: %w", err)
+		}
+		defer zr.Close()
+		br = bufio.NewReader(zr)
+	}
+	header, err := br.ReadString('\n')
+	if err != nil && (!errors.Is(err, io.EOF) || header == "") {
+		return nil, nil, fmt.Errorf("dump: reading header: %w", err)
+	}
+	header = strings.TrimPrefix(header, "\ufeff") // UTF-8 BOM of Windows exports
+
+	cr := csv.NewReader(io.MultiReader(strings.NewReader(header), br))
+	cr.Comma = dumpDelimiter(header)
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	cr.ReuseRecord = true
+	names, err := cr.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("dump: reading header: %w", err)
+	}
+	setters := make([]func(*RecordDataCollector) *string, len(names))
+	seen := map[string]bool{}
+	for i, n := range names {
+		n = strings.ToUpper(strings.TrimSpace(n))
+		setters[i], seen[n] = dumpColumns[n], true
+	}
+	var missing []string
+	for _, n := range requiredDumpColumns {
+		if !seen[n] {
+			missing = append(missing, n)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, nil, fmt.Errorf("dump: missing column(s) %s", strings.Join(missing, ", "))
+	}
+
+	for {
+		row, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return records, skipped, nil
+		}
+		if err != nil {
+			var pe *csv.ParseError
+			if errors.As(err, &pe) {
+				skipped = append(skipped, DumpRowError{Line: pe.Line, Err: pe.Err})
+				continue
+			}
+			return records, skipped, fmt.Errorf("dump: %w", err)
+		}
+		line, _ := cr.FieldPos(0)
+		if len(row) != len(names) {
+			skipped = append(skipped, DumpRowError{Line: line, Err: fmt.Errorf("%d fields, header has %d", len(row), len(names))})
+			continue
+		}
+		var rec RecordDataCollector
+		for i, v := range row {
+			if setters[i] != nil {
+				*setters[i](&rec) = strings.TrimSpace(v)
+			}
+		}
+		if rec.SerialNumber == "" {
+			skipped = append(skipped, DumpRowError{Line: line, Err: errors.New("no SERIAL_NUMBER")})
+			continue
+		}
+		ts, err := ParseDumpTimestamp(rec.InStationTime)
+		if err != nil {
+			skipped = append(skipped, DumpRowError{Line: line, Err: err})
+			continue
+		}
+		rec.InStationTime = ts.Format(time.DateTime)
+		// normalized like the API responses, so dump records key like the stored ones
+		rec.LineName = ExtractJLineCode(rec.LineName)
+		rec.GroupName = strings.ReplaceAll(rec.GroupName, " ", "_")
+		rec.NextStations = strings.ReplaceAll(rec.NextStations, " ", "_")
+		records = append(records, rec)
+	}
+}
+
+// ParseDumpTimestamp parses a time of a vendor dump: the Oracle renderings, then the
+// formats of the API.
+func ParseDumpTimestamp(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range dumpTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return ParseAPITimestamp(s)
+}
+
+// dumpDelimiter returns the most frequent candidate delimiter of the header line.
+func dumpDelimiter(header string) rune {
+	best, count := ',', 0
+	for _, d := range []rune{',', ';', '|', '\t'} {
+		if n := strings.Count(header, string(d)); n > count {
+			best, count = d, n
+		}
+	}
+	return best
+}
+
+// isGzip reports whether b starts like a gzip stream.
+func isGzip(b []byte) bool { return bytes.HasPrefix(b, []byte{0x1f, 0x8b}) }
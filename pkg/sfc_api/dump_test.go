@@ -0,0 +1,54 @@
+package sfc_api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+)
+
+func TestReadDump(t *testing.T) {
+	dump := "\ufeff\"SERIAL_NUMBER\";\"MO_NUMBER\";\"LINE_NAME\";\"STATION_NAME\";\"GROUP_NAME\";\"IN_STATION_TIME\";\"ERROR_FLAG\";\"EXTRA\"\n" +
+		"\"PP1\";\"MO-1\";\"J01\";\"ST1\";\"SMT\";\"14-SEP-25 08.03.11.000000 AM\";\"0\";\"x\"\n" +
+		"PP2;MO-1;J01;ST1;SMT;2025-09-14 20:15:00;1;y\n" +
+		";MO-1;J01;ST1;SMT;2025-09-14 20:16:00;0;z\n" +
+		"PP3;MO-1;J01;ST1;SMT;not a time;0;z\n" +
+		"\n" +
+		"2 rows selected.\n"
+
+	check := func(t *testing.T, data []byte) {
+		t.Helper()
+		recs, skipped, err := ReadDump(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("ReadDump: %v", err)
+		}
+		if len(recs) != 2 {
+			t.Fatalf("records = %+v", recs)
+		}
+		if r := recs[0]; r.SerialNumber != "PP1" || r.MoNumber != "MO-1" || r.GroupName != "SMT" || r.InStationTime != "2025-09-14 08:03:11" {
+			t.Errorf("first record = %+v", r)
+		}
+		if r := recs[1]; r.InStationTime != "2025-09-14 20:15:00" || r.ErrorFlag != "1" {
+			t.Errorf("second record = %+v", r)
+		}
+		var lines []int
+		for _, s := range skipped {
+			lines = append(lines, s.Line)
+		}
+		if len(lines) != 3 || lines[0] != 4 || lines[1] != 5 || lines[2] != 7 {
+			t.Errorf("skipped = %v", skipped)
+		}
+	}
+	t.Run("plain", func(t *testing.T) { check(t, []byte(dump)) })
+	t.Run("gzip", func(t *testing.T) {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		_, _ = zw.Write([]byte(dump))
+		_ = zw.Close()
+		check(t, buf.Bytes())
+	})
+
+	if _, _, err := ReadDump(strings.NewReader("SERIAL_NUMBER,LINE_NAME\nPP1,J01\n")); err == nil || !strings.Contains(err.Error(), "STATION_NAME") {
+		t.Errorf("missing columns: %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+package sfc_api
+
+import (
+	"sync"
+	"time"
+)
+
+// Circuit breaker defaults for the primary API: after DefaultBreakerFailures consecutive
+// failed requests the client fails over to the backup, and probes the primary again every
+// DefaultBreakerCooldown.
+const (
+	DefaultBreakerFailures = 5
+	DefaultBreakerCooldown = time.Minute
+)
+
+// callResult classifies a request for the primary's circuit breaker.
+type callResult int
+
+const (
+	callIgnored callResult = iota // canceled before the upstream answered
+	callOK                        // the upstream answered, even with a client error
+	callFailed                    // unreachable, 5xx or the response was cut
+)
+
+// FailoverEvent is emitted when the client switches between the primary and backup API.
+type FailoverEvent struct {
+	FailedOver bool // true when switching to the backup, false when failing back
+	From, To   string
+	Failures   int // consecutive primary failures that opened the circuit
+	At         time.Time
+}
+
+// failover routes requests to the primary base URL while its circuit is closed and to the
+// backup while it is open. Once the cooldown has passed one request probes the primary
+// (half-open): success closes the circuit and fails back, failure keeps it open for another
+// cooldown. Without a backup every request goes to the primary.
+type failover struct {
+	mu       sync.Mutex
+	primary  string
+	backup   string
+	failures int
+	cooldown time.Duration
+	logf     func(format string, args ...any)
+	onSwitch func(FailoverEvent)
+	now      func() time.Time
+
+	consecutive int
+	open        bool
+	openedAt    time.Time
+	probing     bool
+}
+
+// pick returns the base URL of the next request.
+func (f *failover) pick() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.open || f.backup == "" {
+		return f.primary
+	}
+	if !f.probing && f.now().Sub(f.openedAt) >= f.cooldown {
+		f.probing = true
+		return f.primary
+	}
+	return f.backup
+}
+
+// active returns the base URL requests currently go to, without starting a probe.
+func (f *failover) active() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.open && f.backup != "" {
+		return f.backup
+	}
+	return f.primary
+}
+
+// report records the result of a request sent to base.
+func (f *failover) report(base string, res callResult) {
+	f.mu.Lock()
+	if base != f.primary || res == callIgnored {
+		if base == f.primary {
+			f.probing = false
+		}
+		f.mu.Unlock()
+		return
+	}
+	var ev *FailoverEvent
+	switch {
+	case res == callOK:
+		if f.open {
+			ev = &FailoverEvent{From: f.backup, To: f.primary, At: f.now()}
+			f.logf("SFC API primary %s recovered; failing back from %s", f.primary, f.backup)
+		}
+		f.consecutive, f.open, f.probing = 0, false, false
+	case f.probing:
+		f.consecutive++
+		f.openedAt, f.probing = f.now(), false
+		f.logf("SFC API primary %s still failing; staying on backup %s for %s", f.primary, f.backup, f.cooldown)
+	default:
+		f.consecutive++
+		if !f.open && f.backup != "" && f.consecutive >= f.failures {
+			f.open, f.openedAt = true, f.now()
+			ev = &FailoverEvent{FailedOver: true, From: f.primary, To: f.backup, Failures: f.consecutive, At: f.openedAt}
+			f.logf("SFC API primary %s failed %d times in a row; failing over to backup %s", f.primary, f.consecutive, f.backup)
+		}
+	}
+	fn := f.onSwitch
+	f.mu.Unlock()
+
+	if ev != nil && fn != nil {
+		fn(*ev)
+	}
+}
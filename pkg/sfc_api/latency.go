@@ -0,0 +1,209 @@
+package sfc_api
+
+import (
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"hex_toolset/pkg/metrics"
+)
+
+// Endpoint identifies the kind of upstream request for latency tracking.
+type Endpoint string
+
+const (
+	EndpointMinute Endpoint = "minute"
+	EndpointHour   Endpoint = "hour"
+)
+
+// Latency alert defaults: p95 over a 10 minute window must stay above the threshold
+// for 10 minutes before an alert is raised.
+const (
+	DefaultLatencyP95Threshold = 8 * time.Second
+	DefaultLatencyWindow       = 10 * time.Minute
+	DefaultLatencySustain      = 10 * time.Minute
+	minLatencySamples          = 3
+)
+
+var latencyBuckets = []float64{0.1, 0.25, 0.5, 1, 2, 5, 10, 20, 30}
+
+var (
+	histOnce   sync.Once
+	histograms map[Endpoint]*metrics.Histogram
+)
+
+// endpointHistogram returns the process-wide histogram for ep, registering it on first use.
+func endpointHistogram(ep Endpoint) *metrics.Histogram {
+	histOnce.Do(func() {
+		histograms = map[Endpoint]*metrics.Histogram{}
+		for _, e := range []Endpoint{EndpointMinute, EndpointHour} {
+			h := metrics.NewHistogram("sfc_api_request_duration_seconds",
+				"Latency of SFC API requests by endpoint, including failed attempts.",
+				latencyBuckets, metrics.Labels{"endpoint": string(e)})
+			metrics.Default.Register(h)
+			histograms[e] = h
+		}
+	})
+	return histograms[ep]
+}
+
+// LatencyAlert is emitted when an endpoint's rolling p95 crosses the threshold for the
+// sustain period (Degraded=true) and again when it recovers (Degraded=false).
+type LatencyAlert struct {
+	Endpoint  Endpoint
+	Degraded  bool
+	P95       time.Duration
+	Threshold time.Duration
+	Since     time.Time
+	Samples   int
+}
+
+// LatencyPolicy configures the degradation alert.
+type LatencyPolicy struct {
+	Threshold time.Duration // p95 above this is degraded
+	Window    time.Duration // rolling window used to compute p95
+	Sustain   time.Duration // how long p95 must stay degraded before alerting
+}
+
+// DefaultLatencyPolicy returns the defaults, with the threshold overridable via SFC_API_P95_ALERT_MS.
+func DefaultLatencyPolicy() LatencyPolicy {
+	p := LatencyPolicy{
+		Threshold: DefaultLatencyP95Threshold,
+		Window:    DefaultLatencyWindow,
+		Sustain:   DefaultLatencySustain,
+	}
+	if v := strings.TrimSpace(os.Getenv("SFC_API_P95_ALERT_MS")); v != "" {
+		if ms, err := strconv.Atoi(v); err == nil && ms > 0 {
+			p.Threshold = time.Duration(ms) * time.Millisecond
+		}
+	}
+	return p
+}
+
+type latencySample struct {
+	at time.Time
+	d  time.Duration
+}
+
+type endpointLatency struct {
+	samples       []latencySample
+	degradedSince time.Time
+	alerted       bool
+}
+
+// LatencyTracker keeps rolling latency samples per endpoint and evaluates the alert policy.
+type LatencyTracker struct {
+	mu        sync.Mutex
+	policy    LatencyPolicy
+	endpoints map[Endpoint]*endpointLatency
+	onAlert   func(LatencyAlert)
+	now       func() time.Time
+}
+
+// NewLatencyTracker creates a tracker with the given policy.
+func NewLatencyTracker(policy LatencyPolicy) *LatencyTracker {
+	return &LatencyTracker{
+		policy:    policy,
+		endpoints: map[Endpoint]*endpointLatency{},
+		now:       time.Now,
+	}
+}
+
+// SetAlertHandler sets the callback invoked on degradation and recovery.
+func (t *LatencyTracker) SetAlertHandler(fn func(LatencyAlert)) {
+	t.mu.Lock()
+	t.onAlert = fn
+	t.mu.Unlock()
+}
+
+// SetPolicy replaces the alert policy.
+func (t *LatencyTracker) SetPolicy(p LatencyPolicy) {
+	t.mu.Lock()
+	t.policy = p
+	t.mu.Unlock()
+}
+
+// Observe records a request duration for ep and evaluates the alert policy.
+func (t *LatencyTracker) Observe(ep Endpoint, d time.Duration) {
+	if h := endpointHistogram(ep); h != nil {
+		h.Observe(d.Seconds())
+	}
+
+	t.mu.Lock()
+	now := t.now()
+	el := t.endpoints[ep]
+	if el == nil {
+		el = &endpointLatency{}
+		t.endpoints[ep] = el
+	}
+	el.samples = append(el.samples, latencySample{at: now, d: d})
+	el.samples = pruneSamples(el.samples, now.Add(-t.policy.Window))
+
+	var alert *LatencyAlert
+	p95, n := percentile(el.samples, 0.95), len(el.samples)
+	if n >= minLatencySamples && p95 > t.policy.Threshold {
+		if el.degradedSince.IsZero() {
+			el.degradedSince = now
+		}
+		if !el.alerted && now.Sub(el.degradedSince) >= t.policy.Sustain {
+			el.alerted = true
+			alert = &LatencyAlert{Endpoint: ep, Degraded: true, P95: p95, Threshold: t.policy.Threshold, Since: el.degradedSince, Samples: n}
+		}
+	} else {
+		if el.alerted {
+			alert = &LatencyAlert{Endpoint: ep, Degraded: false, P95: p95, Threshold: t.policy.Threshold, Since: el.degradedSince, Samples: n}
+		}
+		el.degradedSince = time.Time{}
+		el.alerted = false
+	}
+	fn := t.onAlert
+	t.mu.Unlock()
+
+	if alert != nil && fn != nil {
+		fn(*alert)
+	}
+}
+
+// P95 returns the current rolling p95 and sample count for ep.
+func (t *LatencyTracker) P95(ep Endpoint) (time.Duration, int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	el := t.endpoints[ep]
+	if el == nil {
+		return 0, 0
+	}
+	el.samples = pruneSamples(el.samples, t.now().Add(-t.policy.Window))
+	return percentile(el.samples, 0.95), len(el.samples)
+}
+
+func pruneSamples(s []latencySample, cutoff time.Time) []latencySample {
+	i := 0
+	for i < len(s) && s[i].at.Before(cutoff) {
+		i++
+	}
+	return s[i:]
+}
+
+// percentile returns the nearest-rank percentile q (0..1) of the sample durations.
+func percentile(s []latencySample, q float64) time.Duration {
+	if len(s) == 0 {
+		return 0
+	}
+	ds := make([]time.Duration, len(s))
+	for i, x := range s {
+		ds[i] = x.d
+	}
+	sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+	rank := int(math.Ceil(q*float64(len(ds)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(ds) {
+		rank = len(ds) - 1
+	}
+	return ds[rank]
+}
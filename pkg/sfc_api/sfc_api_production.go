@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	sflogger "hex_toolset/pkg/logger"
+	"hex_toolset/pkg/timeutil"
 	"io"
 	"log"
 	"math/rand"
@@ -15,6 +16,7 @@ import (
 	"path"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -23,15 +25,28 @@ const (
 	HTTPTimeout = 20 * time.Second
 	MaxRetries  = 2
 	RetryDelay  = 5 * time.Second
+
+	// DefaultMinuteConcurrency bounds the parallel minute requests of the hour fallback.
+	DefaultMinuteConcurrency = 8
+	// DefaultMaxHourBytes is the hour response size above which the hour is refetched by minute.
+	DefaultMaxHourBytes = 64 << 20
 )
 
+// ErrHourTooLarge is returned when an hour response exceeds the configured size limit.
+var ErrHourTooLarge = errors.New("hour response too large")
+
 // RecordDataCollector represents the API response structure (for reference)
 
 // APIClient handles HTTP requests to the external API
 type APIClient struct {
 	httpClient *http.Client
-	baseURL    string
+	upstream   *failover
 	logger     *log.Logger
+	latency    *LatencyTracker
+	clock      timeutil.Clock
+
+	minuteConcurrency int
+	maxHourBytes      int64 // 0 disables the limit
 }
 
 // NewAPIClient creates a new API client with timeout configuration
@@ -53,15 +68,61 @@ func NewAPIClient() *APIClient {
 		stdLogger = log.Default()
 	}
 
-	return &APIClient{
-		httpClient: &http.Client{Timeout: HTTPTimeout},
-		baseURL:    baseURL,
-		logger:     stdLogger,
+	api := &APIClient{
+		httpClient:        &http.Client{Timeout: HTTPTimeout},
+		logger:            stdLogger,
+		latency:           NewLatencyTracker(DefaultLatencyPolicy()),
+		clock:             timeutil.SystemClock,
+		minuteConcurrency: DefaultMinuteConcurrency,
+		maxHourBytes:      DefaultMaxHourBytes,
+	}
+	// Without a backup (SetBackupURL) every request goes to the primary.
+	api.upstream = &failover{
+		primary:  baseURL,
+		failures: DefaultBreakerFailures,
+		cooldown: DefaultBreakerCooldown,
+		logf:     func(format string, args ...any) { api.logger.Printf(format, args...) },
+		now:      time.Now,
 	}
+	return api
 }
 
 // Optional configuration setters (non-breaking)
-func (api *APIClient) SetBaseURL(u string) { api.baseURL = u }
+func (api *APIClient) SetBaseURL(u string) {
+	api.upstream.mu.Lock()
+	api.upstream.primary = u
+	api.upstream.mu.Unlock()
+}
+
+// SetBackupURL sets the API failed over to while the primary's circuit is open; "" disables failover.
+func (api *APIClient) SetBackupURL(u string) {
+	api.upstream.mu.Lock()
+	api.upstream.backup = u
+	api.upstream.mu.Unlock()
+}
+
+// SetBreaker sets the consecutive failures that open the primary's circuit and how long the
+// client stays on the backup before probing the primary again.
+func (api *APIClient) SetBreaker(failures int, cooldown time.Duration) {
+	api.upstream.mu.Lock()
+	defer api.upstream.mu.Unlock()
+	if failures > 0 {
+		api.upstream.failures = failures
+	}
+	if cooldown > 0 {
+		api.upstream.cooldown = cooldown
+	}
+}
+
+// SetFailoverHandler registers fn to be called when the client fails over to the backup or back.
+func (api *APIClient) SetFailoverHandler(fn func(FailoverEvent)) {
+	api.upstream.mu.Lock()
+	api.upstream.onSwitch = fn
+	api.upstream.mu.Unlock()
+}
+
+// ActiveURL returns the base URL requests are currently sent to.
+func (api *APIClient) ActiveURL() string { return api.upstream.active() }
 
 func (api *APIClient) SetHTTPClient(h *http.Client) {
 	if h != nil {
@@ -74,9 +135,38 @@ func (api *APIClient) SetLogger(l *log.Logger) {
 	}
 }
 
+// SetMinuteConcurrency sets how many minutes the hour fallback fetches at once.
+func (api *APIClient) SetMinuteConcurrency(n int) {
+	if n > 0 {
+		api.minuteConcurrency = n
+	}
+}
+
+// SetMaxHourBytes sets the hour response size limit; 0 disables it.
+func (api *APIClient) SetMaxHourBytes(n int64) {
+	if n >= 0 {
+		api.maxHourBytes = n
+	}
+}
+
+// SetClock sets the clock RequestPreviousMinute reads the current minute from.
+func (api *APIClient) SetClock(c timeutil.Clock) {
+	if c != nil {
+		api.clock = c
+	}
+}
+
+// Latency returns the per-endpoint latency tracker.
+func (api *APIClient) Latency() *LatencyTracker { return api.latency }
+
+// SetLatencyAlertHandler registers fn to be called when an endpoint's p95 degrades or recovers.
+func (api *APIClient) SetLatencyAlertHandler(fn func(LatencyAlert)) {
+	api.latency.SetAlertHandler(fn)
+}
+
 // buildURL constructs API URLs with proper encoding and stable order
-func (api *APIClient) buildURL(endpoint string, params map[string]interface{}) string {
-	u, _ := url.Parse(api.baseURL)
+func buildURL(base, endpoint string, params map[string]interface{}) string {
+	u, _ := url.Parse(base)
 	u.Path = path.Join(u.Path, endpoint)
 
 	if len(params) > 0 {
@@ -95,8 +185,20 @@ func (api *APIClient) buildURL(endpoint string, params map[string]interface{}) s
 	return u.String()
 }
 
-func (api *APIClient) makeRequest(ctx context.Context, url string) ([]byte, error) {
+func (api *APIClient) makeRequest(ctx context.Context, ep Endpoint, endpoint string, params map[string]interface{}) ([]byte, error) {
+	return api.makeRequestLimit(ctx, ep, endpoint, params, 0)
+}
+
+// makeRequestLimit is makeRequest failing with ErrHourTooLarge once the body exceeds
+// maxBytes (0 = unlimited), without buffering the rest of it. The request goes to the
+// primary or backup API as the circuit breaker decides, and its result feeds the breaker.
+func (api *APIClient) makeRequestLimit(ctx context.Context, ep Endpoint, endpoint string, params map[string]interface{}, maxBytes int64) ([]byte, error) {
 	start := time.Now()
+	defer func() { api.latency.Observe(ep, time.Since(start)) }()
+	base := api.upstream.pick()
+	result := callIgnored
+	defer func() { api.upstream.report(base, result) }()
+	url := buildURL(base, endpoint, params)
 	//api.logger.Printf("HTTP GET start url=%s", url)
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
@@ -114,9 +216,14 @@ func (api *APIClient) makeRequest(ctx context.Context, url string) ([]byte, erro
 		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
 			return nil, err
 		}
+		result = callFailed
 		return nil, fmt.Errorf("request failed: %w", err)
 	}
 	defer resp.Body.Close()
+	result = callOK
+	if resp.StatusCode >= http.StatusInternalServerError {
+		result = callFailed
+	}
 
 	if resp.StatusCode != http.StatusOK {
 		// read a limited error body for context
@@ -126,11 +233,28 @@ func (api *APIClient) makeRequest(ctx context.Context, url string) ([]byte, erro
 		return nil, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(b)))
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	if maxBytes > 0 && resp.ContentLength > maxBytes {
+		api.logger.Printf("HTTP GET too large url=%s content_length=%d limit=%d", url, resp.ContentLength, maxBytes)
+		return nil, fmt.Errorf("%w: %d bytes (limit %d)", ErrHourTooLarge, resp.ContentLength, maxBytes)
+	}
+	var reader io.Reader = resp.Body
+	if maxBytes > 0 {
+		reader = io.LimitReader(resp.Body, maxBytes+1)
+	}
+	body, err := io.ReadAll(reader)
 	if err != nil {
 		api.logger.Printf("HTTP GET read error url=%s err=%v duration=%s", url, err, time.Since(start))
+		if ctx.Err() == nil {
+			result = callFailed
+		} else {
+			result = callIgnored
+		}
 		return nil, fmt.Errorf("failed to read response body: %w", err)
 	}
+	if maxBytes > 0 && int64(len(body)) > maxBytes {
+		api.logger.Printf("HTTP GET too large url=%s limit=%d duration=%s", url, maxBytes, time.Since(start))
+		return nil, fmt.Errorf("%w: more than %d bytes", ErrHourTooLarge, maxBytes)
+	}
 	api.logger.Printf("HTTP GET done url=%s status=%d duration=%s bytes=%d", url, resp.StatusCode, time.Since(start), len(body))
 	return body, nil
 }
@@ -150,10 +274,7 @@ func (api *APIClient) RequestMinuteData(ctx context.Context, date string, hour,
 		"minute": fmt.Sprintf("%02d", minute),
 	}
 
-	_url := api.buildURL("api/getPPIDRecords", params)
-	//api.logger.Printf("Requesting: %s", _url)
-
-	body, err := api.makeRequest(ctx, _url)
+	body, err := api.makeRequest(ctx, EndpointMinute, "api/getPPIDRecords", params)
 	if err != nil {
 		return nil, fmt.Errorf("API request failed: %w", err)
 	}
@@ -188,10 +309,7 @@ func (api *APIClient) RequestHourData(ctx context.Context, date string, hour int
 		"hour": fmt.Sprintf("%02d", hour),
 	}
 
-	_url := api.buildURL("api/getPPIDRecords", params)
-	api.logger.Printf("Requesting: %s", _url)
-
-	body, err := api.makeRequest(ctx, _url)
+	body, err := api.makeRequestLimit(ctx, EndpointHour, "api/getPPIDRecords", params, api.maxHourBytes)
 	if err != nil {
 		return nil, fmt.Errorf("API request failed: %w", err)
 	}
@@ -214,7 +332,7 @@ func (api *APIClient) RequestHourData(ctx context.Context, date string, hour int
 
 // RequestPreviousMinute fetches current minute data with automatic retry and jittered backoff
 func (api *APIClient) RequestPreviousMinute(ctx context.Context) ([]RecordDataCollector, error) {
-	date, hour, minute := CalculatePreviousMinute()
+	date, hour, minute := CalculatePreviousMinute(api.clock)
 
 	//api.logger.Printf("Fetching minute data at %s for %s %02d:%02d",
 	//	time.Now().Format("15:04:05"), date, hour, minute)
@@ -268,8 +386,26 @@ func (api *APIClient) RequestMinute(ctx context.Context, time time.Time) ([]Reco
 	return result, nil
 }
 
+// RequestHour fetches the hour containing t. When the hour endpoint keeps failing or the
+// response exceeds the size limit, the hour is fetched minute by minute instead.
 func (api *APIClient) RequestHour(ctx context.Context, t time.Time) ([]RecordDataCollector, error) {
-	// Align to the provided hour and call the hour endpoint with retry, mirroring RequestMinute
+	recs, err := api.requestHourOnce(ctx, t)
+	if err == nil {
+		return recs, nil
+	}
+	if ctx.Err() != nil {
+		return nil, err
+	}
+	api.logger.Printf("Hour %s unavailable (%v); falling back to minute requests", t.Format("2006-01-02 15:00"), err)
+	recs, merr := api.RequestHourByMinutes(ctx, t)
+	if merr != nil {
+		return nil, fmt.Errorf("hour request failed: %v; minute fallback failed: %w", err, merr)
+	}
+	return recs, nil
+}
+
+// requestHourOnce calls the hour endpoint with retry; a too-large response is not retried.
+func (api *APIClient) requestHourOnce(ctx context.Context, t time.Time) ([]RecordDataCollector, error) {
 	// Date format must match other requests (CalculateDateHourMinute uses "02-Jan-2006").
 	date := t.Format("02-Jan-2006")
 	hour := t.Hour()
@@ -282,6 +418,9 @@ func (api *APIClient) RequestHour(ctx context.Context, t time.Time) ([]RecordDat
 		if err != nil {
 			lastErr = err
 			api.logger.Printf("Attempt failed: %v", err)
+			if errors.Is(err, ErrHourTooLarge) {
+				return permanent(err)
+			}
 			return err
 		}
 		result = data
@@ -295,8 +434,76 @@ func (api *APIClient) RequestHour(ctx context.Context, t time.Time) ([]RecordDat
 	return result, nil
 }
 
+// RequestHourByMinutes fetches the 60 minutes of the hour containing t concurrently,
+// bounded by the minute concurrency, and merges them in minute order. The hour is only
+// returned when every minute succeeded; the first failure cancels the remaining requests.
+func (api *APIClient) RequestHourByMinutes(ctx context.Context, t time.Time) ([]RecordDataCollector, error) {
+	hourStart := t.Truncate(time.Hour)
+	workers := api.minuteConcurrency
+	if workers <= 0 {
+		workers = DefaultMinuteConcurrency
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		results  [60][]RecordDataCollector
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	sem := make(chan struct{}, workers)
+	for i := 0; i < 60; i++ {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			minute := hourStart.Add(time.Duration(i) * time.Minute)
+			data, err := api.RequestMinute(ctx, minute)
+			if err != nil {
+				errOnce.Do(func() {
+					firstErr = fmt.Errorf("minute %s: %w", minute.Format("15:04"), err)
+					cancel()
+				})
+				return
+			}
+			results[i] = data
+		}(i)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var merged []RecordDataCollector
+	for _, r := range results {
+		merged = append(merged, r...)
+	}
+	api.logger.Printf("Fetched %d records for %s by minute", len(merged), hourStart.Format("2006-01-02 15:00"))
+	return merged, nil
+}
+
+// permanentError marks an error that doWithRetry must not retry.
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+func permanent(err error) error { return permanentError{err: err} }
+
 // doWithRetry executes fn with retry using jittered backoff.
-// It stops early if the context is done.
+// It stops early if the context is done or fn returns a permanent error.
 func doWithRetry(ctx context.Context, attempts int, baseDelay time.Duration, fn func() error) error {
 	if attempts <= 0 {
 		attempts = 1
@@ -311,6 +518,10 @@ func doWithRetry(ctx context.Context, attempts int, baseDelay time.Duration, fn
 		if err == nil {
 			return nil
 		}
+		var perm permanentError
+		if errors.As(err, &perm) {
+			return perm.err
+		}
 		if i == attempts {
 			return err
 		}
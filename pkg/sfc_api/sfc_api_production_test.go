@@ -3,10 +3,15 @@ package sfc_api
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"hex_toolset/pkg/timeutil"
 )
 
 type fixtureRecord struct {
@@ -115,3 +120,204 @@ func TestRequestPreviousMinute_Success(t *testing.T) {
 		t.Fatalf("expected 1 record, got %d", len(recs))
 	}
 }
+
+func TestRequestPreviousMinuteUsesClock(t *testing.T) {
+	var got atomic.Value
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		got.Store(q.Get("date") + " " + q.Get("hour") + ":" + q.Get("minute"))
+		_, _ = w.Write([]byte("[]"))
+	}))
+	defer ts.Close()
+
+	client := NewAPIClient()
+	client.SetBaseURL(ts.URL)
+	// just past midnight: the previous minute is the last one of the day before
+	client.SetClock(timeutil.NewFakeClock(time.Date(2025, 3, 1, 0, 0, 30, 0, time.Local)))
+
+	if _, err := client.RequestPreviousMinute(context.Background()); err != nil {
+		t.Fatalf("RequestPreviousMinute error: %v", err)
+	}
+	if want := "28-Feb-2025 23:59"; got.Load() != want {
+		t.Fatalf("requested %v, want %s", got.Load(), want)
+	}
+}
+
+func TestLatencyTrackerAlertsAfterSustainedDegradation(t *testing.T) {
+	tr := NewLatencyTracker(LatencyPolicy{Threshold: time.Second, Window: 10 * time.Minute, Sustain: 10 * time.Minute})
+	now := time.Date(2025, 9, 1, 8, 0, 0, 0, time.UTC)
+	tr.now = func() time.Time { return now }
+
+	var alerts []LatencyAlert
+	tr.SetAlertHandler(func(a LatencyAlert) { alerts = append(alerts, a) })
+
+	// one slow request per minute; p95 is evaluated from the 3rd sample (t=2m),
+	// so the 10 minute sustain period elapses at t=12m
+	for i := 0; i < 12; i++ {
+		tr.Observe(EndpointMinute, 3*time.Second)
+		now = now.Add(time.Minute)
+	}
+	if len(alerts) != 0 {
+		t.Fatalf("alert raised before sustain period: %+v", alerts)
+	}
+	tr.Observe(EndpointMinute, 3*time.Second)
+	if len(alerts) != 1 || !alerts[0].Degraded || alerts[0].Endpoint != EndpointMinute {
+		t.Fatalf("expected one degraded alert, got %+v", alerts)
+	}
+	// hour endpoint is tracked independently
+	if p, n := tr.P95(EndpointHour); p != 0 || n != 0 {
+		t.Fatalf("hour endpoint should have no samples, got %s/%d", p, n)
+	}
+
+	// recovery: window slides past the slow samples
+	now = now.Add(11 * time.Minute)
+	for i := 0; i < 3; i++ {
+		tr.Observe(EndpointMinute, 100*time.Millisecond)
+	}
+	if len(alerts) != 2 || alerts[1].Degraded {
+		t.Fatalf("expected recovery alert, got %+v", alerts)
+	}
+}
+
+func TestRequestHourFallsBackToMinutesWhenTooLarge(t *testing.T) {
+	var hourCalls, inFlight, maxInFlight int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/getPPIDRecords", func(w http.ResponseWriter, r *http.Request) {
+		minute := r.URL.Query().Get("minute")
+		if minute == "" {
+			atomic.AddInt32(&hourCalls, 1)
+			_, _ = w.Write([]byte(strings.Repeat(" ", 2048) + "[]"))
+			return
+		}
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			m := atomic.LoadInt32(&maxInFlight)
+			if n <= m || atomic.CompareAndSwapInt32(&maxInFlight, m, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		_ = json.NewEncoder(w).Encode([]fixtureRecord{{SerialNumber: "SN" + minute, LineName: "J01"}})
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	client := NewAPIClient()
+	client.SetBaseURL(ts.URL)
+	client.SetMaxHourBytes(1024)
+	client.SetMinuteConcurrency(4)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	recs, err := client.RequestHour(ctx, time.Date(2025, 9, 1, 8, 0, 0, 0, time.Local))
+	if err != nil {
+		t.Fatalf("RequestHour error: %v", err)
+	}
+	if hourCalls != 1 {
+		t.Fatalf("too-large hour should not be retried, got %d hour calls", hourCalls)
+	}
+	if len(recs) != 60 {
+		t.Fatalf("expected 60 merged records, got %d", len(recs))
+	}
+	for i, r := range recs {
+		if want := fmt.Sprintf("SN%02d", i); r.SerialNumber != want {
+			t.Fatalf("record %d: expected %s in minute order, got %s", i, want, r.SerialNumber)
+		}
+	}
+	if maxInFlight > 4 {
+		t.Fatalf("expected at most 4 concurrent minute requests, got %d", maxInFlight)
+	}
+}
+
+func TestRequestHourByMinutesFailsOnMissingMinute(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/getPPIDRecords", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("minute") == "30" {
+			http.Error(w, "boom", http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte("[]"))
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	client := NewAPIClient()
+	client.SetBaseURL(ts.URL)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if _, err := client.RequestHourByMinutes(ctx, time.Date(2025, 9, 1, 8, 0, 0, 0, time.Local)); err == nil || !strings.Contains(err.Error(), "08:30") {
+		t.Fatalf("expected failure naming minute 08:30, got %v", err)
+	}
+}
+
+func TestClientFailsOverToBackupAndBack(t *testing.T) {
+	var primaryDown atomic.Bool
+	primaryDown.Store(true)
+	var primaryCalls, backupCalls atomic.Int32
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primaryCalls.Add(1)
+		if primaryDown.Load() {
+			http.Error(w, "down", http.StatusBadGateway)
+			return
+		}
+		_, _ = w.Write([]byte("[]"))
+	}))
+	defer primary.Close()
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		backupCalls.Add(1)
+		_, _ = w.Write([]byte("[]"))
+	}))
+	defer backup.Close()
+
+	client := NewAPIClient()
+	client.SetBaseURL(primary.URL)
+	client.SetBackupURL(backup.URL)
+	client.SetBreaker(2, time.Minute)
+	now := time.Date(2025, 9, 1, 8, 0, 0, 0, time.UTC)
+	client.upstream.now = func() time.Time { return now }
+	var events []FailoverEvent
+	client.SetFailoverHandler(func(e FailoverEvent) { events = append(events, e) })
+
+	ctx := context.Background()
+	minute := func() error {
+		_, err := client.RequestMinuteData(ctx, "01-Sep-2025", 8, 0)
+		return err
+	}
+
+	// Two failures open the primary's circuit; the next request goes to the backup.
+	for i := 0; i < 2; i++ {
+		if err := minute(); err == nil {
+			t.Fatalf("request %d succeeded against the failing primary", i)
+		}
+	}
+	if client.ActiveURL() != backup.URL || len(events) != 1 || !events[0].FailedOver || events[0].Failures != 2 {
+		t.Fatalf("active %s, events %+v; want failover to the backup", client.ActiveURL(), events)
+	}
+	if err := minute(); err != nil || backupCalls.Load() != 1 || primaryCalls.Load() != 2 {
+		t.Fatalf("err %v, primary/backup calls %d/%d; want the request served by the backup",
+			err, primaryCalls.Load(), backupCalls.Load())
+	}
+
+	// After the cooldown one request probes the primary; still down, the client stays on the backup.
+	now = now.Add(time.Minute)
+	if err := minute(); err == nil || primaryCalls.Load() != 3 {
+		t.Fatalf("err %v, primary calls %d; want a failed probe of the primary", err, primaryCalls.Load())
+	}
+	if err := minute(); err != nil || backupCalls.Load() != 2 {
+		t.Fatalf("err %v, backup calls %d; want the backup until the next cooldown", err, backupCalls.Load())
+	}
+
+	// Once the primary recovers the next probe fails back.
+	primaryDown.Store(false)
+	now = now.Add(time.Minute)
+	if err := minute(); err != nil || primaryCalls.Load() != 4 {
+		t.Fatalf("err %v, primary calls %d; want a successful probe", err, primaryCalls.Load())
+	}
+	if client.ActiveURL() != primary.URL || len(events) != 2 || events[1].FailedOver {
+		t.Fatalf("active %s, events %+v; want fail back to the primary", client.ActiveURL(), events)
+	}
+}
@@ -5,12 +5,13 @@ import (
 	"regexp"
 	"strings"
 	"time"
+
+	"hex_toolset/pkg/timeutil"
 )
 
-// CalculatePreviousMinute calculates the previous minute with proper wraparound
-func CalculatePreviousMinute() (string, int, int) {
-	now := time.Now()
-	prevMinute := now.Add(-time.Minute)
+// CalculatePreviousMinute calculates the minute before clock's current time with proper wraparound
+func CalculatePreviousMinute(clock timeutil.Clock) (string, int, int) {
+	prevMinute := clock.Now().Add(-time.Minute)
 
 	return prevMinute.Format("02-Jan-2006"), prevMinute.Hour(), prevMinute.Minute()
 }
@@ -0,0 +1,153 @@
+package shifts
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultSpec is used when no SHIFTS configuration is provided: two 12h shifts.
+const DefaultSpec = "A=06:00-18:00,B=18:00-06:00"
+
+// Shift is a recurring daily shift. Start and End are offsets from local midnight;
+// End <= Start means the shift crosses midnight.
+type Shift struct {
+	Name  string
+	Start time.Duration
+	End   time.Duration
+}
+
+// Instance is a concrete occurrence of a shift.
+type Instance struct {
+	Name  string    `json:"name"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// Contains reports whether t falls in [Start, End).
+func (i Instance) Contains(t time.Time) bool { return !t.Before(i.Start) && t.Before(i.End) }
+
+// Calendar is a set of daily shifts evaluated in a location.
+type Calendar struct {
+	Shifts []Shift
+	Loc    *time.Location
+}
+
+// Parse builds a calendar from "NAME=HH:MM-HH:MM,..." (e.g. "A=06:00-18:00,B=18:00-06:00").
+func Parse(spec string, loc *time.Location) (*Calendar, error) {
+	if loc == nil {
+		loc = time.Local
+	}
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		spec = DefaultSpec
+	}
+	cal := &Calendar{Loc: loc}
+	seen := map[string]bool{}
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, span, ok := strings.Cut(part, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid shift %q, expected NAME=HH:MM-HH:MM", part)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate shift name %q", name)
+		}
+		seen[name] = true
+		from, to, ok := strings.Cut(span, "-")
+		if !ok {
+			return nil, fmt.Errorf("invalid shift span %q for %s, expected HH:MM-HH:MM", span, name)
+		}
+		start, err := parseClock(from)
+		if err != nil {
+			return nil, fmt.Errorf("shift %s start: %w", name, err)
+		}
+		end, err := parseClock(to)
+		if err != nil {
+			return nil, fmt.Errorf("shift %s end: %w", name, err)
+		}
+		cal.Shifts = append(cal.Shifts, Shift{Name: name, Start: start, End: end})
+	}
+	if len(cal.Shifts) == 0 {
+		return nil, fmt.Errorf("no shifts defined")
+	}
+	sort.Slice(cal.Shifts, func(i, j int) bool { return cal.Shifts[i].Start < cal.Shifts[j].Start })
+	return cal, nil
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// instanceOn returns the occurrence of s that starts on the local day of day.
+func (c *Calendar) instanceOn(s Shift, day time.Time) Instance {
+	d := day.In(c.Loc)
+	midnight := time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, c.Loc)
+	start := midnight.Add(s.Start)
+	endDay := midnight
+	if s.End <= s.Start {
+		endDay = midnight.AddDate(0, 0, 1)
+	}
+	// Use calendar arithmetic so DST days keep wall-clock shift boundaries.
+	end := time.Date(endDay.Year(), endDay.Month(), endDay.Day(), 0, 0, 0, 0, c.Loc).Add(s.End)
+	return Instance{Name: s.Name, Start: start, End: end}
+}
+
+// candidates returns all instances starting on the day before, of, and after t.
+func (c *Calendar) candidates(t time.Time) []Instance {
+	var out []Instance
+	for _, off := range []int{-1, 0, 1} {
+		day := t.In(c.Loc).AddDate(0, 0, off)
+		for _, s := range c.Shifts {
+			out = append(out, c.instanceOn(s, day))
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Start.Before(out[j].Start) })
+	return out
+}
+
+// At returns the shift instance containing t.
+func (c *Calendar) At(t time.Time) (Instance, bool) {
+	for _, in := range c.candidates(t) {
+		if in.Contains(t) {
+			return in, true
+		}
+	}
+	return Instance{}, false
+}
+
+// LastEnded returns the most recent instance whose End is at or before t.
+func (c *Calendar) LastEnded(t time.Time) (Instance, bool) {
+	var best Instance
+	found := false
+	for _, in := range c.candidates(t) {
+		if !in.End.After(t) && (!found || in.End.After(best.End)) {
+			best, found = in, true
+		}
+	}
+	return best, found
+}
+
+// Between returns every instance that ends in (from, to], oldest first.
+func (c *Calendar) Between(from, to time.Time) []Instance {
+	var out []Instance
+	for day := from.In(c.Loc).AddDate(0, 0, -1); !day.After(to.In(c.Loc).AddDate(0, 0, 1)); day = day.AddDate(0, 0, 1) {
+		for _, s := range c.Shifts {
+			in := c.instanceOn(s, day)
+			if in.End.After(from) && !in.End.After(to) {
+				out = append(out, in)
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].End.Before(out[j].End) })
+	return out
+}
@@ -0,0 +1,42 @@
+package shifts
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseAndAt(t *testing.T) {
+	cal, err := Parse("A=06:00-18:00,B=18:00-06:00", time.UTC)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	in, ok := cal.At(time.Date(2025, 9, 2, 3, 0, 0, 0, time.UTC))
+	if !ok || in.Name != "B" || !in.Start.Equal(time.Date(2025, 9, 1, 18, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected overnight instance: %+v", in)
+	}
+	in, ok = cal.At(time.Date(2025, 9, 2, 6, 0, 0, 0, time.UTC))
+	if !ok || in.Name != "A" || !in.End.Equal(time.Date(2025, 9, 2, 18, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected day instance: %+v", in)
+	}
+}
+
+func TestLastEndedAndBetween(t *testing.T) {
+	cal, _ := Parse("A=06:00-18:00,B=18:00-06:00", time.UTC)
+	at := time.Date(2025, 9, 2, 18, 2, 0, 0, time.UTC)
+	in, ok := cal.LastEnded(at)
+	if !ok || in.Name != "A" || !in.End.Equal(time.Date(2025, 9, 2, 18, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected last ended: %+v", in)
+	}
+	got := cal.Between(time.Date(2025, 9, 1, 12, 0, 0, 0, time.UTC), at)
+	if len(got) != 3 || got[0].Name != "A" || got[1].Name != "B" || got[2].Name != "A" {
+		t.Fatalf("unexpected instances between: %+v", got)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, spec := range []string{"A", "A=06:00", "A=6-18", "A=06:00-18:00,A=18:00-06:00"} {
+		if _, err := Parse(spec, time.UTC); err == nil {
+			t.Fatalf("expected error for %q", spec)
+		}
+	}
+}
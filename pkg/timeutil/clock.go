@@ -0,0 +1,104 @@
+package timeutil
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock tells the time and waits. Time-based logic (loop alignment, the previous minute,
+// shift boundaries) takes a Clock instead of calling time.Now, so tests drive it with a
+// FakeClock and a service can run shifted in time with an OffsetClock.
+type Clock interface {
+	Now() time.Time
+	// After sends the clock's time on the returned channel once d has elapsed on it.
+	After(d time.Duration) <-chan time.Time
+}
+
+// SystemClock is the wall clock.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// OffsetClock returns c shifted by offset: with -24h a service replays yesterday in real
+// time, fetching and storing each minute of the day before as if it were live.
+func OffsetClock(c Clock, offset time.Duration) Clock {
+	return offsetClock{c: c, offset: offset}
+}
+
+type offsetClock struct {
+	c      Clock
+	offset time.Duration
+}
+
+func (o offsetClock) Now() time.Time { return o.c.Now().Add(o.offset) }
+
+func (o offsetClock) After(d time.Duration) <-chan time.Time {
+	out := make(chan time.Time, 1)
+	in := o.c.After(d)
+	go func() { out <- (<-in).Add(o.offset) }()
+	return out
+}
+
+// FakeClock is a Clock that only moves when told to, for deterministic tests.
+type FakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+}
+
+type fakeWaiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+// NewFakeClock returns a FakeClock stopped at now.
+func NewFakeClock(now time.Time) *FakeClock { return &FakeClock{now: now} }
+
+// Now returns the fake time.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// After returns a channel that fires once the clock is advanced by d or more.
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.waiters = append(c.waiters, fakeWaiter{at: c.now.Add(d), ch: ch})
+	return ch
+}
+
+// Advance moves the clock forward by d and fires the waiters that became due, earliest first.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	sort.SliceStable(c.waiters, func(i, j int) bool { return c.waiters[i].at.Before(c.waiters[j].at) })
+	kept := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.at.After(c.now) {
+			kept = append(kept, w)
+			continue
+		}
+		w.ch <- c.now
+	}
+	c.waiters = kept
+}
+
+// Waiters returns the number of pending After calls, so a test can wait until the code
+// under test is blocked on the clock before advancing it.
+func (c *FakeClock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.waiters)
+}
@@ -0,0 +1,47 @@
+package timeutil
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeClockFiresDueWaiters(t *testing.T) {
+	start := time.Date(2025, 3, 10, 8, 0, 0, 0, time.UTC)
+	c := NewFakeClock(start)
+	soon, later := c.After(time.Second), c.After(time.Minute)
+	if n := c.Waiters(); n != 2 {
+		t.Fatalf("waiters = %d, want 2", n)
+	}
+
+	c.Advance(30 * time.Second)
+	select {
+	case at := <-soon:
+		if !at.Equal(start.Add(30 * time.Second)) {
+			t.Fatalf("fired at %s, want the advanced time", at)
+		}
+	default:
+		t.Fatal("due waiter did not fire")
+	}
+	select {
+	case <-later:
+		t.Fatal("waiter fired before its time")
+	default:
+	}
+	if n := c.Waiters(); n != 1 {
+		t.Fatalf("waiters = %d, want 1", n)
+	}
+}
+
+func TestOffsetClock(t *testing.T) {
+	base := NewFakeClock(time.Date(2025, 3, 10, 0, 0, 30, 0, time.UTC))
+	c := OffsetClock(base, -24*time.Hour)
+	if want := time.Date(2025, 3, 9, 0, 0, 30, 0, time.UTC); !c.Now().Equal(want) {
+		t.Fatalf("now = %s, want %s", c.Now(), want)
+	}
+
+	ch := c.After(time.Second)
+	base.Advance(time.Second)
+	if at := <-ch; !at.Equal(time.Date(2025, 3, 9, 0, 0, 31, 0, time.UTC)) {
+		t.Fatalf("fired at %s, want the shifted time", at)
+	}
+}
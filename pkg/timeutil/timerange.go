@@ -0,0 +1,278 @@
+// Package timeutil holds the time formats used across the toolset and the TimeRange
+// type shared by the CLIs, REST handlers and entity APIs.
+package timeutil
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Layouts in use. Collected timestamps are stored and compared as DBLayout text in UTC
+// (see FormatDB and ParseDB) and shown in local time, so DST changes neither repeat nor
+// skip an hour in the database.
+const (
+	DBLayout      = "2006-01-02 15:04:05" // records_table and every TEXT timestamp column
+	DayLayout     = "2006-01-02"
+	HourLayout    = "2006-01-02 15"
+	MinuteLayout  = "2006-01-02 15:04"
+	APIDateLayout = "02-Jan-2006" // date parameter of the SFC API
+)
+
+// TimeRange is the half-open interval [Start, End).
+type TimeRange struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// NewTimeRange returns [start, end) or an error when end is not after start.
+func NewTimeRange(start, end time.Time) (TimeRange, error) {
+	if !end.After(start) {
+		return TimeRange{}, fmt.Errorf("invalid time range: end %s is not after start %s",
+			end.Format(DBLayout), start.Format(DBLayout))
+	}
+	return TimeRange{Start: start, End: end}, nil
+}
+
+// Day returns the calendar day containing t, in t's location.
+func Day(t time.Time) TimeRange {
+	start := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	return TimeRange{Start: start, End: start.AddDate(0, 0, 1)}
+}
+
+// Week returns the week containing t, Monday to Monday, in t's location.
+func Week(t time.Time) TimeRange {
+	start := Day(t).Start
+	start = start.AddDate(0, 0, -(int(start.Weekday())+6)%7)
+	return TimeRange{Start: start, End: start.AddDate(0, 0, 7)}
+}
+
+// Hour returns the clock hour containing t, in t's location.
+func Hour(t time.Time) TimeRange {
+	start := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+	return TimeRange{Start: start, End: start.Add(time.Hour)}
+}
+
+// Minute returns the minute containing t.
+func Minute(t time.Time) TimeRange {
+	start := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, t.Location())
+	return TimeRange{Start: start, End: start.Add(time.Minute)}
+}
+
+// Parse parses a range expression, resolving dates in now's location:
+//
+//	2025-09-01, 01-Sep-2025      the whole day
+//	2025-09-01 08                the hour 08:00-09:00
+//	2025-09-01 08:15             the minute
+//	-24h, -90m, -7d              the last 24 hours / 90 minutes / 7 days up to now
+//	today, yesterday
+//	FROM..TO                     see ParseBounds
+//
+// A single instant (seconds or RFC3339) is not a range; use it as a bound of FROM..TO.
+func Parse(s string, now time.Time) (TimeRange, error) {
+	s = strings.TrimSpace(s)
+	if from, to, ok := strings.Cut(s, ".."); ok {
+		return ParseBounds(from, to, now)
+	}
+	r, instant, err := parseExpr(s, now)
+	if err != nil {
+		return TimeRange{}, err
+	}
+	if instant {
+		return TimeRange{}, fmt.Errorf("%q is an instant, not a range; use FROM..TO", s)
+	}
+	return r, nil
+}
+
+// ParseBounds builds a range from two expressions: the start of from and the end of to,
+// so "2025-09-01".."2025-09-03" covers three whole days. An empty to means now.
+func ParseBounds(from, to string, now time.Time) (TimeRange, error) {
+	from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+	if from == "" {
+		return TimeRange{}, fmt.Errorf("missing range start")
+	}
+	f, _, err := parseExpr(from, now)
+	if err != nil {
+		return TimeRange{}, err
+	}
+	end := now
+	if to != "" {
+		t, instant, err := parseExpr(to, now)
+		if err != nil {
+			return TimeRange{}, err
+		}
+		end = t.End
+		if instant || isRelative(to) {
+			// "-1h" as an upper bound means one hour ago, not now
+			end = t.Start
+		}
+	}
+	return NewTimeRange(f.Start, end)
+}
+
+// ParseSince resolves a "since" bound, as taken by `hex logs --since` and /logz?since=, to
+// the start of the range ParseBounds(s, "", now) opens. A bare duration counts back from
+// now like its relative form ("2h" is "-2h").
+func ParseSince(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if _, err := parseOffset(s); err == nil {
+		s = "-" + s
+	}
+	r, err := ParseBounds(s, "", now)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return r.Start, nil
+}
+
+// ParseDay parses s as one calendar day (YYYY-MM-DD or DD-Mon-YYYY).
+func ParseDay(s string, loc *time.Location) (TimeRange, error) {
+	r, err := Parse(s, time.Now().In(loc))
+	if err != nil || !r.Equal(Day(r.Start)) {
+		return TimeRange{}, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", s)
+	}
+	return r, nil
+}
+
+// ParseHour parses s as one clock hour ("YYYY-MM-DD HH").
+func ParseHour(s string, loc *time.Location) (TimeRange, error) {
+	r, err := Parse(s, time.Now().In(loc))
+	if err != nil || !r.Equal(Hour(r.Start)) {
+		return TimeRange{}, fmt.Errorf("invalid hour %q, expected \"YYYY-MM-DD HH\"", s)
+	}
+	return r, nil
+}
+
+// parseExpr resolves one expression to a range; instant reports a point in time
+// (returned as [t, t]).
+func parseExpr(s string, now time.Time) (r TimeRange, instant bool, err error) {
+	loc := now.Location()
+	switch strings.ToLower(s) {
+	case "":
+		return r, false, fmt.Errorf("empty time expression")
+	case "now":
+		return TimeRange{Start: now, End: now}, true, nil
+	case "today":
+		return Day(now), false, nil
+	case "yesterday":
+		return Day(now.AddDate(0, 0, -1)), false, nil
+	}
+	if isRelative(s) {
+		d, err := parseOffset(s[1:])
+		if err != nil {
+			return r, false, fmt.Errorf("invalid relative time %q: %v", s, err)
+		}
+		return TimeRange{Start: now.Add(-d), End: now}, false, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return TimeRange{Start: t.In(loc), End: t.In(loc)}, true, nil
+	}
+	if t, err := time.ParseInLocation(DBLayout, s, loc); err == nil {
+		return TimeRange{Start: t, End: t}, true, nil
+	}
+	layouts := []struct {
+		layout string
+		span   func(time.Time) TimeRange
+	}{
+		{MinuteLayout, Minute},
+		{HourLayout, Hour},
+		{DayLayout, Day},
+		{APIDateLayout, Day},
+	}
+	for _, l := range layouts {
+		if t, err := time.ParseInLocation(l.layout, s, loc); err == nil {
+			return l.span(t), false, nil
+		}
+	}
+	return r, false, fmt.Errorf("unrecognized time %q (use YYYY-MM-DD, \"YYYY-MM-DD HH[:MM[:SS]]\", RFC3339 or -24h)", s)
+}
+
+func isRelative(s string) bool { return len(s) > 1 && s[0] == '-' }
+
+// parseOffset accepts Go durations ("90m", "1h30m") plus whole days and weeks ("7d", "2w").
+func parseOffset(s string) (time.Duration, error) {
+	if n := len(s); n > 1 && (s[n-1] == 'd' || s[n-1] == 'w') {
+		v, err := strconv.Atoi(s[:n-1])
+		if err != nil || v <= 0 {
+			return 0, fmt.Errorf("expected a positive count of days or weeks")
+		}
+		d := time.Duration(v) * 24 * time.Hour
+		if s[n-1] == 'w' {
+			d *= 7
+		}
+		return d, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("expected a positive duration")
+	}
+	return d, nil
+}
+
+// Contains reports whether t falls in [Start, End).
+func (r TimeRange) Contains(t time.Time) bool { return !t.Before(r.Start) && t.Before(r.End) }
+
+// Duration returns End - Start.
+func (r TimeRange) Duration() time.Duration { return r.End.Sub(r.Start) }
+
+// Equal reports whether both ranges have the same bounds.
+func (r TimeRange) Equal(o TimeRange) bool { return r.Start.Equal(o.Start) && r.End.Equal(o.End) }
+
+// IsZero reports whether the range is unset.
+func (r TimeRange) IsZero() bool { return r.Start.IsZero() && r.End.IsZero() }
+
+// DBStart and DBEnd format the bounds for comparisons against DBLayout columns:
+// collected_timestamp >= DBStart() AND collected_timestamp < DBEnd().
+func (r TimeRange) DBStart() string { return FormatDB(r.Start) }
+func (r TimeRange) DBEnd() string   { return FormatDB(r.End) }
+
+// FormatDB formats t for a stored timestamp column: DBLayout in UTC.
+func FormatDB(t time.Time) string { return t.UTC().Format(DBLayout) }
+
+// ParseDB parses a stored DBLayout timestamp (UTC) and returns it in local time.
+func ParseDB(s string) (time.Time, error) {
+	t, err := time.ParseInLocation(DBLayout, s, time.UTC)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.In(time.Local), nil
+}
+
+// FormatLocal formats t as DBLayout in local time, for display.
+func FormatLocal(t time.Time) string { return t.In(time.Local).Format(DBLayout) }
+
+// LocalDB converts a stored timestamp to its local DBLayout display form. Values that do
+// not parse (e.g. "") are returned unchanged.
+func LocalDB(s string) string {
+	t, err := ParseDB(s)
+	if err != nil {
+		return s
+	}
+	return FormatLocal(t)
+}
+
+// Hours returns the start of every clock hour overlapping the range.
+func (r TimeRange) Hours() []time.Time {
+	var out []time.Time
+	for t := Hour(r.Start).Start; t.Before(r.End); t = t.Add(time.Hour) {
+		out = append(out, t)
+	}
+	return out
+}
+
+// Days returns the start of every calendar day overlapping the range.
+func (r TimeRange) Days() []time.Time {
+	var out []time.Time
+	for t := Day(r.Start).Start; t.Before(r.End); t = t.AddDate(0, 0, 1) {
+		out = append(out, t)
+	}
+	return out
+}
+
+func (r TimeRange) String() string {
+	return "[" + r.Start.Format(DBLayout) + ", " + r.End.Format(DBLayout) + ")"
+}
@@ -0,0 +1,128 @@
+package timeutil
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestParseExpressions(t *testing.T) {
+	loc := time.FixedZone("plant", -6*3600)
+	now := time.Date(2025, 9, 10, 14, 25, 30, 0, loc)
+	at := func(y int, mo time.Month, d, h, mi int) time.Time { return time.Date(y, mo, d, h, mi, 0, 0, loc) }
+
+	cases := []struct {
+		in         string
+		start, end time.Time
+	}{
+		{"2025-09-01", at(2025, 9, 1, 0, 0), at(2025, 9, 2, 0, 0)},
+		{"01-Sep-2025", at(2025, 9, 1, 0, 0), at(2025, 9, 2, 0, 0)},
+		{"2025-09-01 08", at(2025, 9, 1, 8, 0), at(2025, 9, 1, 9, 0)},
+		{"2025-09-01 08:15", at(2025, 9, 1, 8, 15), at(2025, 9, 1, 8, 16)},
+		{"-24h", now.Add(-24 * time.Hour), now},
+		{"-7d", now.AddDate(0, 0, -7), now},
+		{"today", at(2025, 9, 10, 0, 0), at(2025, 9, 11, 0, 0)},
+		{"yesterday", at(2025, 9, 9, 0, 0), at(2025, 9, 10, 0, 0)},
+		{"2025-09-01..2025-09-03", at(2025, 9, 1, 0, 0), at(2025, 9, 4, 0, 0)},
+		{"2025-09-01 06:00:00..2025-09-01 18:00:00", at(2025, 9, 1, 6, 0), at(2025, 9, 1, 18, 0)},
+		{"-2h..-1h", now.Add(-2 * time.Hour), now.Add(-time.Hour)},
+		{"2025-09-10 12..", at(2025, 9, 10, 12, 0), now},
+	}
+	for _, c := range cases {
+		r, err := Parse(c.in, now)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", c.in, err)
+		}
+		if !r.Start.Equal(c.start) || !r.End.Equal(c.end) {
+			t.Fatalf("Parse(%q) = %s, want [%s, %s)", c.in, r, c.start.Format(DBLayout), c.end.Format(DBLayout))
+		}
+	}
+
+	for _, bad := range []string{"", "2025-13-01", "-0h", "-xd", "2025-09-01 08:00:00", "2025-09-03..2025-09-01"} {
+		if _, err := Parse(bad, now); err == nil {
+			t.Fatalf("Parse(%q) should fail", bad)
+		}
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	loc := time.FixedZone("plant", -6*3600)
+	now := time.Date(2025, 9, 10, 14, 25, 30, 0, loc)
+	for in, want := range map[string]time.Time{
+		"2h":                  now.Add(-2 * time.Hour),
+		"-90m":                now.Add(-90 * time.Minute),
+		"7d":                  now.AddDate(0, 0, -7),
+		"2025-09-10":          time.Date(2025, 9, 10, 0, 0, 0, 0, loc),
+		"2025-09-10 08:15":    time.Date(2025, 9, 10, 8, 15, 0, 0, loc),
+		"2025-09-10 08:15:20": time.Date(2025, 9, 10, 8, 15, 20, 0, loc),
+		"yesterday":           time.Date(2025, 9, 9, 0, 0, 0, 0, loc),
+	} {
+		if got, err := ParseSince(in, now); err != nil || !got.Equal(want) {
+			t.Errorf("ParseSince(%q) = %s, %v, want %s", in, got, err, want)
+		}
+	}
+	for _, bad := range []string{"", "0h", "soon", "2025-09-11"} {
+		if _, err := ParseSince(bad, now); err == nil {
+			t.Errorf("ParseSince(%q) should fail", bad)
+		}
+	}
+}
+
+func TestParseDayAndHour(t *testing.T) {
+	if _, err := ParseDay("2025-09-01", time.Local); err != nil {
+		t.Fatalf("ParseDay: %v", err)
+	}
+	if _, err := ParseDay("2025-09-01 08", time.Local); err == nil {
+		t.Fatalf("ParseDay should reject an hour")
+	}
+	r, err := ParseHour("2025-09-01 08", time.FixedZone("plant", -6*3600))
+	if err != nil || r.Duration() != time.Hour || r.DBStart() != "2025-09-01 14:00:00" || r.DBEnd() != "2025-09-01 15:00:00" {
+		t.Fatalf("ParseHour = %s, %v", r, err)
+	}
+	if len(r.Hours()) != 1 || len(Day(r.Start).Hours()) != 24 || len(Day(r.Start).Days()) != 1 {
+		t.Fatalf("unexpected hour/day iteration")
+	}
+}
+
+func TestDBTimestampsAcrossDST(t *testing.T) {
+	chicago, err := time.LoadLocation("America/Chicago")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(l *time.Location) { time.Local = l }(time.Local)
+	time.Local = chicago
+
+	// 01:30 happens twice on the fall-back night; stored in UTC the two passes stay apart.
+	first := time.Date(2025, 11, 2, 6, 30, 0, 0, time.UTC)
+	second := first.Add(time.Hour)
+	if FormatLocal(first) != FormatLocal(second) {
+		t.Fatalf("expected the same local wall clock, got %s and %s", FormatLocal(first), FormatLocal(second))
+	}
+	if FormatDB(first) != "2025-11-02 06:30:00" || FormatDB(second) != "2025-11-02 07:30:00" {
+		t.Fatalf("FormatDB = %s, %s", FormatDB(first), FormatDB(second))
+	}
+	back, err := ParseDB(FormatDB(second))
+	if err != nil || !back.Equal(second) || back.Location() != chicago {
+		t.Fatalf("ParseDB = %v, %v", back, err)
+	}
+	if got := LocalDB("2025-11-02 07:30:00"); got != "2025-11-02 01:30:00" {
+		t.Fatalf("LocalDB = %q", got)
+	}
+	if got := LocalDB(""); got != "" {
+		t.Fatalf("LocalDB(\"\") = %q", got)
+	}
+
+	// The local day of the fall-back night is 25 hours long in UTC.
+	day := Day(time.Date(2025, 11, 2, 12, 0, 0, 0, chicago))
+	if day.DBStart() != "2025-11-02 05:00:00" || day.DBEnd() != "2025-11-03 06:00:00" {
+		t.Fatalf("day bounds = %s, %s", day.DBStart(), day.DBEnd())
+	}
+	// and its week from Monday to Monday one hour longer than 7 days
+	week := Week(time.Date(2025, 11, 2, 12, 0, 0, 0, chicago))
+	if week.DBStart() != "2025-10-27 05:00:00" || week.DBEnd() != "2025-11-03 06:00:00" {
+		t.Fatalf("week bounds = %s, %s", week.DBStart(), week.DBEnd())
+	}
+	if w := Week(week.Start); !w.Start.Equal(week.Start) {
+		t.Fatalf("week of its Monday starts %s", w.Start)
+	}
+}
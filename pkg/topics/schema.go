@@ -0,0 +1,98 @@
+package topics
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// SchemaOf returns a JSON Schema (draft 2020-12 subset) describing the JSON encoding of v.
+// It follows encoding/json rules: exported fields, `json` tag names, omitempty => optional.
+func SchemaOf(v any) map[string]any {
+	if v == nil {
+		return map[string]any{}
+	}
+	return schemaFor(reflect.TypeOf(v), map[reflect.Type]bool{})
+}
+
+func schemaFor(t reflect.Type, seen map[reflect.Type]bool) map[string]any {
+	if t == timeType {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		s := schemaFor(t.Elem(), seen)
+		if typ, ok := s["type"].(string); ok {
+			s["type"] = []string{typ, "null"}
+		}
+		return s
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// []byte is encoded as base64 string
+			return map[string]any{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]any{"type": "array", "items": schemaFor(t.Elem(), seen)}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": schemaFor(t.Elem(), seen)}
+	case reflect.Struct:
+		if seen[t] {
+			// recursive type: stop expanding to keep the schema finite
+			return map[string]any{"type": "object"}
+		}
+		seen[t] = true
+		defer delete(seen, t)
+		props := map[string]any{}
+		var required []string
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			name, omitEmpty, skip := jsonFieldName(f)
+			if skip {
+				continue
+			}
+			props[name] = schemaFor(f.Type, seen)
+			if !omitEmpty {
+				required = append(required, name)
+			}
+		}
+		s := map[string]any{"type": "object", "properties": props}
+		if len(required) > 0 {
+			s["required"] = required
+		}
+		return s
+	default:
+		// interface{} and anything else: unconstrained
+		return map[string]any{}
+	}
+}
+
+func jsonFieldName(f reflect.StructField) (name string, omitEmpty, skip bool) {
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return "", false, true
+	}
+	parts := strings.Split(tag, ",")
+	name = parts[0]
+	if name == "" {
+		name = f.Name
+	}
+	for _, p := range parts[1:] {
+		if p == "omitempty" || p == "omitzero" {
+			omitEmpty = true
+		}
+	}
+	return name, omitEmpty, false
+}
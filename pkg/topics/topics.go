@@ -0,0 +1,119 @@
+package topics
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Topic describes a broadcast message type published to websocket clients.
+// Name is the value carried in the envelope "massage_type" field.
+type Topic struct {
+	Name        string
+	Description string
+	// Frequency is the nominal publish interval; 0 means event-driven.
+	Frequency time.Duration
+	// Payload is a sample (zero) value of the "massage" payload; its type drives the schema.
+	Payload any
+	// Prefix makes the topic a family standing for every name starting with it, e.g.
+	// "LATEST_" for LATEST_J01, LATEST_J06, ...; Name is then a placeholder such as
+	// "LATEST_{LINE}".
+	Prefix string
+}
+
+// Descriptor is the JSON form of a registered topic served by /api/topics.
+type Descriptor struct {
+	Name             string         `json:"name"`
+	Prefix           string         `json:"prefix,omitempty"`
+	Description      string         `json:"description"`
+	Frequency        string         `json:"frequency"`
+	FrequencySeconds float64        `json:"frequency_seconds"`
+	Schema           map[string]any `json:"schema"`
+}
+
+var (
+	mu       sync.RWMutex
+	registry = map[string]Topic{}
+)
+
+// Register adds a topic to the catalog. It panics on empty or duplicate names,
+// since registration happens at init time and either is a programming error.
+func Register(t Topic) {
+	if t.Name == "" {
+		panic("topics: empty topic name")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if _, dup := registry[t.Name]; dup {
+		panic(fmt.Sprintf("topics: duplicate registration of %q", t.Name))
+	}
+	registry[t.Name] = t
+}
+
+// Lookup returns the descriptor for name: the topic registered under it, or else the
+// family with the longest prefix of it.
+func Lookup(name string) (Descriptor, bool) {
+	mu.RLock()
+	t, ok := registry[name]
+	if !ok {
+		for _, f := range registry {
+			if f.Prefix != "" && len(name) > len(f.Prefix) && strings.HasPrefix(name, f.Prefix) && len(f.Prefix) > len(t.Prefix) {
+				t, ok = f, true
+			}
+		}
+	}
+	mu.RUnlock()
+	if !ok {
+		return Descriptor{}, false
+	}
+	return describe(t), true
+}
+
+// Catalog returns descriptors for all registered topics sorted by name.
+func Catalog() []Descriptor {
+	mu.RLock()
+	out := make([]Descriptor, 0, len(registry))
+	for _, t := range registry {
+		out = append(out, describe(t))
+	}
+	mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// describe builds the envelope schema: { "massage_type": <name>, "massage": <payload> }.
+func describe(t Topic) Descriptor {
+	freq := "event"
+	if t.Frequency > 0 {
+		freq = t.Frequency.String()
+	}
+	typ := map[string]any{"const": t.Name}
+	if t.Prefix != "" {
+		typ = map[string]any{"type": "string", "pattern": "^" + regexp.QuoteMeta(t.Prefix)}
+	}
+	return Descriptor{
+		Name:             t.Name,
+		Prefix:           t.Prefix,
+		Description:      t.Description,
+		Frequency:        freq,
+		FrequencySeconds: t.Frequency.Seconds(),
+		Schema: map[string]any{
+			"$schema": "https://json-schema.org/draft/2020-12/schema",
+			"title":   t.Name,
+			"type":    "object",
+			"properties": map[string]any{
+				"massage_type": typ,
+				"massage":      SchemaOf(t.Payload),
+				"meta": map[string]any{
+					"type":                 "object",
+					"description":          "Optional metadata matched by websocket ?filter= expressions.",
+					"additionalProperties": map[string]any{"type": "string"},
+				},
+			},
+			"required": []string{"massage_type", "massage"},
+		},
+	}
+}
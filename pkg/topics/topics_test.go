@@ -0,0 +1,93 @@
+package topics
+
+import (
+	"testing"
+	"time"
+)
+
+type samplePayload struct {
+	Line    string         `json:"line"`
+	Units   int            `json:"units"`
+	Note    string         `json:"note,omitempty"`
+	At      time.Time      `json:"at"`
+	Groups  map[string]int `json:"groups"`
+	Skipped string         `json:"-"`
+	hidden  string
+}
+
+func TestSchemaOfStruct(t *testing.T) {
+	s := SchemaOf(samplePayload{hidden: "x"})
+	if s["type"] != "object" {
+		t.Fatalf("expected object schema, got %#v", s)
+	}
+	props := s["properties"].(map[string]any)
+	if _, ok := props["Skipped"]; ok {
+		t.Fatalf("json:\"-\" field must be skipped")
+	}
+	if _, ok := props["hidden"]; ok {
+		t.Fatalf("unexported field must be skipped")
+	}
+	if props["units"].(map[string]any)["type"] != "integer" {
+		t.Fatalf("units should be integer: %#v", props["units"])
+	}
+	if props["at"].(map[string]any)["format"] != "date-time" {
+		t.Fatalf("time.Time should be date-time string: %#v", props["at"])
+	}
+	groups := props["groups"].(map[string]any)
+	if groups["additionalProperties"].(map[string]any)["type"] != "integer" {
+		t.Fatalf("map value schema wrong: %#v", groups)
+	}
+	for _, r := range s["required"].([]string) {
+		if r == "note" {
+			t.Fatalf("omitempty field must not be required")
+		}
+	}
+}
+
+func TestRegisterAndCatalog(t *testing.T) {
+	Register(Topic{Name: "TEST_TOPIC_B", Frequency: time.Minute, Payload: map[string]string{}})
+	Register(Topic{Name: "TEST_TOPIC_A", Payload: []int{}})
+
+	d, ok := Lookup("TEST_TOPIC_B")
+	if !ok || d.Frequency != "1m0s" || d.FrequencySeconds != 60 {
+		t.Fatalf("unexpected descriptor: %+v", d)
+	}
+	if a, _ := Lookup("TEST_TOPIC_A"); a.Frequency != "event" {
+		t.Fatalf("zero frequency should be reported as event, got %q", a.Frequency)
+	}
+	cat := Catalog()
+	if len(cat) < 2 || cat[0].Name > cat[len(cat)-1].Name {
+		t.Fatalf("catalog should be sorted: %+v", cat)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("duplicate registration should panic")
+		}
+	}()
+	Register(Topic{Name: "TEST_TOPIC_A"})
+}
+
+func TestTopicFamilies(t *testing.T) {
+	Register(Topic{Name: "TEST_FAMILY_{LINE}", Prefix: "TEST_FAMILY_", Payload: map[string]int{}})
+	Register(Topic{Name: "TEST_FAMILY_X_{LINE}", Prefix: "TEST_FAMILY_X_", Payload: []int{}})
+	Register(Topic{Name: "TEST_FAMILY_FIXED", Payload: "x"})
+
+	for name, want := range map[string]string{
+		"TEST_FAMILY_J01":   "TEST_FAMILY_{LINE}",
+		"TEST_FAMILY_X_J01": "TEST_FAMILY_X_{LINE}",
+		"TEST_FAMILY_FIXED": "TEST_FAMILY_FIXED",
+	} {
+		if d, ok := Lookup(name); !ok || d.Name != want {
+			t.Errorf("Lookup(%q) = %q, %v; want %q", name, d.Name, ok, want)
+		}
+	}
+	if _, ok := Lookup("TEST_FAMILY_"); ok {
+		t.Errorf("the bare prefix is not a topic of the family")
+	}
+	d, _ := Lookup("TEST_FAMILY_J01")
+	mt := d.Schema["properties"].(map[string]any)["massage_type"].(map[string]any)
+	if d.Prefix != "TEST_FAMILY_" || mt["pattern"] != "^TEST_FAMILY_" {
+		t.Errorf("family descriptor = %+v", d)
+	}
+}
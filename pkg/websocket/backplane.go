@@ -0,0 +1,185 @@
+package websocket
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/redis/go-redis/v9"
+)
+
+// Backplane fans broadcasts out across broadcast server instances, so a message picked up
+// by one instance reaches clients connected to any other instance behind the load balancer.
+type Backplane interface {
+	// Publish sends msg to every instance (including the sender).
+	Publish(ctx context.Context, msg []byte) error
+	// Subscribe calls fn for every message published by another instance until ctx is done.
+	Subscribe(ctx context.Context, fn func(msg []byte)) error
+	// Origin returns this instance's identifier on the backplane.
+	Origin() string
+	Close() error
+}
+
+// DefaultBackplaneChannel is the pub/sub channel used when none is configured.
+const DefaultBackplaneChannel = "hex_toolset:broadcast"
+
+// NewBackplane connects to the backplane at rawURL, picking the implementation from its
+// scheme: redis:// or rediss:// for Redis, nats:// or tls:// for NATS.
+func NewBackplane(ctx context.Context, rawURL, channel string) (Backplane, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return nil, fmt.Errorf("backplane: invalid url: %w", err)
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "redis", "rediss":
+		return NewRedisBackplane(ctx, rawURL, channel)
+	case "nats", "tls":
+		return NewNATSBackplane(ctx, rawURL, channel)
+	default:
+		return nil, fmt.Errorf("backplane: unsupported scheme %q (want redis, rediss, nats or tls)", u.Scheme)
+	}
+}
+
+// frame prefixes msg with origin, see RedisBackplane.
+func frame(origin string, msg []byte) []byte {
+	f := make([]byte, 0, len(origin)+1+len(msg))
+	f = append(f, origin...)
+	f = append(f, '\n')
+	return append(f, msg...)
+}
+
+// unframe returns the payload of f, or false for a malformed frame or one sent by origin.
+func unframe(origin string, f []byte) ([]byte, bool) {
+	from, payload, found := bytes.Cut(f, []byte{'\n'})
+	if !found || string(from) == origin {
+		return nil, false
+	}
+	return payload, true
+}
+
+// RedisBackplane implements Backplane on Redis PUBLISH/SUBSCRIBE.
+// Each message is framed as "<origin>\n<payload>" so an instance can skip its own messages,
+// which it has already delivered locally.
+type RedisBackplane struct {
+	client  *redis.Client
+	channel string
+	origin  string
+}
+
+// NewRedisBackplane connects to the Redis server at url (redis://[:password@]host:port/db).
+func NewRedisBackplane(ctx context.Context, url, channel string) (*RedisBackplane, error) {
+	opts, err := redis.ParseURL(strings.TrimSpace(url))
+	if err != nil {
+		return nil, fmt.Errorf("backplane: invalid redis url: %w", err)
+	}
+	if strings.TrimSpace(channel) == "" {
+		channel = DefaultBackplaneChannel
+	}
+	client := redis.NewClient(opts)
+	if err := client.Ping(ctx).Err(); err != nil {
+		_ = client.Close()
+		return nil, fmt.Errorf("backplane: redis ping: %w", err)
+	}
+	return &RedisBackplane{client: client, channel: channel, origin: uuid.NewString()}, nil
+}
+
+// Origin returns this instance's identifier on the backplane.
+func (b *RedisBackplane) Origin() string { return b.origin }
+
+func (b *RedisBackplane) Publish(ctx context.Context, msg []byte) error {
+	return b.client.Publish(ctx, b.channel, frame(b.origin, msg)).Err()
+}
+
+// Subscribe blocks receiving messages; go-redis reconnects and resubscribes on connection loss.
+func (b *RedisBackplane) Subscribe(ctx context.Context, fn func(msg []byte)) error {
+	sub := b.client.Subscribe(ctx, b.channel)
+	defer sub.Close()
+	if _, err := sub.Receive(ctx); err != nil {
+		return fmt.Errorf("backplane: subscribe %s: %w", b.channel, err)
+	}
+	ch := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case m, ok := <-ch:
+			if !ok {
+				return errors.New("backplane: subscription closed")
+			}
+			if payload, ok := unframe(b.origin, []byte(m.Payload)); ok {
+				fn(payload)
+			}
+		}
+	}
+}
+
+func (b *RedisBackplane) Close() error { return b.client.Close() }
+
+// NATSBackplane implements Backplane on a NATS subject, with the same framing as
+// RedisBackplane. The client reconnects forever and replays the subscription itself.
+type NATSBackplane struct {
+	conn    *nats.Conn
+	subject string
+	origin  string
+	closed  chan struct{}
+}
+
+// NewNATSBackplane connects to the NATS server at url (nats://[user:password@]host:port);
+// channel is used as the subject.
+func NewNATSBackplane(ctx context.Context, url, channel string) (*NATSBackplane, error) {
+	if strings.TrimSpace(channel) == "" {
+		channel = DefaultBackplaneChannel
+	}
+	b := &NATSBackplane{subject: channel, origin: uuid.NewString(), closed: make(chan struct{})}
+	timeout := 5 * time.Second
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+	conn, err := nats.Connect(strings.TrimSpace(url), nats.Name("hex_toolset broadcast "+b.origin),
+		nats.Timeout(timeout), nats.MaxReconnects(-1), nats.ReconnectWait(time.Second),
+		nats.ClosedHandler(func(*nats.Conn) { close(b.closed) }))
+	if err != nil {
+		return nil, fmt.Errorf("backplane: nats connect: %w", err)
+	}
+	b.conn = conn
+	return b, nil
+}
+
+func (b *NATSBackplane) Origin() string { return b.origin }
+
+func (b *NATSBackplane) Publish(_ context.Context, msg []byte) error {
+	return b.conn.Publish(b.subject, frame(b.origin, msg))
+}
+
+// Subscribe blocks receiving messages until ctx is done or the connection is closed.
+func (b *NATSBackplane) Subscribe(ctx context.Context, fn func(msg []byte)) error {
+	ch := make(chan *nats.Msg, 256)
+	sub, err := b.conn.ChanSubscribe(b.subject, ch)
+	if err != nil {
+		return fmt.Errorf("backplane: subscribe %s: %w", b.subject, err)
+	}
+	defer sub.Unsubscribe()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-b.closed:
+			return errors.New("backplane: nats connection closed")
+		case m := <-ch:
+			if payload, ok := unframe(b.origin, m.Data); ok {
+				fn(payload)
+			}
+		}
+	}
+}
+
+func (b *NATSBackplane) Close() error {
+	b.conn.Close()
+	return nil
+}
@@ -0,0 +1,329 @@
+package websocket
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeBroker is an in-process pub/sub server speaking just enough of the Redis (RESP2) or
+// NATS protocol for the backplane clients: connect handshake, PING, SUBSCRIBE and PUBLISH.
+type fakeBroker struct {
+	proto string // "redis" or "nats"
+	ln    net.Listener
+
+	mu    sync.Mutex
+	conns map[*brokerConn]bool
+}
+
+type brokerConn struct {
+	net.Conn
+	mu   sync.Mutex
+	subs map[string]string // channel or subject -> NATS sid
+}
+
+func (c *brokerConn) send(s string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, _ = io.WriteString(c.Conn, s)
+}
+
+func newFakeBroker(t *testing.T, proto string) *fakeBroker {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &fakeBroker{proto: proto, ln: ln, conns: map[*brokerConn]bool{}}
+	t.Cleanup(func() { _ = ln.Close(); b.drop() })
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			c := &brokerConn{Conn: nc, subs: map[string]string{}}
+			b.mu.Lock()
+			b.conns[c] = true
+			b.mu.Unlock()
+			go b.serve(c)
+		}
+	}()
+	return b
+}
+
+func (b *fakeBroker) url() string { return b.proto + "://" + b.ln.Addr().String() }
+
+// drop closes every client connection, as a broker restart would.
+func (b *fakeBroker) drop() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for c := range b.conns {
+		_ = c.Close()
+		delete(b.conns, c)
+	}
+}
+
+// subscriptions counts the subscriptions of the connected clients.
+func (b *fakeBroker) subscriptions() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := 0
+	for c := range b.conns {
+		c.mu.Lock()
+		n += len(c.subs)
+		c.mu.Unlock()
+	}
+	return n
+}
+
+func (b *fakeBroker) waitSubscriptions(t *testing.T, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for b.subscriptions() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d subscriptions, want %d", b.subscriptions(), n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (b *fakeBroker) publish(channel string, payload []byte) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := 0
+	for c := range b.conns {
+		c.mu.Lock()
+		sid, ok := c.subs[channel]
+		c.mu.Unlock()
+		if !ok {
+			continue
+		}
+		n++
+		if b.proto == "nats" {
+			c.send(fmt.Sprintf("MSG %s %s %d\r\n%s\r\n", channel, sid, len(payload), payload))
+		} else {
+			c.send(respArray("message", channel, string(payload)))
+		}
+	}
+	return n
+}
+
+func (b *fakeBroker) serve(c *brokerConn) {
+	defer func() {
+		_ = c.Close()
+		b.mu.Lock()
+		delete(b.conns, c)
+		b.mu.Unlock()
+	}()
+	r := bufio.NewReader(c)
+	if b.proto == "nats" {
+		c.send(`INFO {"server_id":"fake","version":"2.10.0","proto":1,"max_payload":1048576}` + "\r\n")
+		b.serveNATS(c, r)
+		return
+	}
+	b.serveRedis(c, r)
+}
+
+func (b *fakeBroker) serveNATS(c *brokerConn, r *bufio.Reader) {
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		f := strings.Fields(line)
+		if len(f) == 0 {
+			continue
+		}
+		switch strings.ToUpper(f[0]) {
+		case "PING":
+			c.send("PONG\r\n")
+		case "SUB": // SUB <subject> [queue] <sid>
+			c.mu.Lock()
+			c.subs[f[1]] = f[len(f)-1]
+			c.mu.Unlock()
+		case "UNSUB":
+			c.mu.Lock()
+			for subj, sid := range c.subs {
+				if sid == f[1] {
+					delete(c.subs, subj)
+				}
+			}
+			c.mu.Unlock()
+		case "PUB": // PUB <subject> [reply] <size>\r\n<payload>\r\n
+			size, _ := strconv.Atoi(f[len(f)-1])
+			payload := make([]byte, size+2)
+			if _, err := io.ReadFull(r, payload); err != nil {
+				return
+			}
+			b.publish(f[1], payload[:size])
+		}
+	}
+}
+
+func (b *fakeBroker) serveRedis(c *brokerConn, r *bufio.Reader) {
+	for {
+		args, err := readRESP(r)
+		if err != nil {
+			return
+		}
+		switch strings.ToUpper(args[0]) {
+		case "HELLO":
+			c.send("-ERR unknown command 'HELLO'\r\n") // clients fall back to RESP2
+		case "PING":
+			c.mu.Lock()
+			subscribed := len(c.subs) > 0
+			c.mu.Unlock()
+			if subscribed {
+				c.send(respArray("pong", ""))
+			} else {
+				c.send("+PONG\r\n")
+			}
+		case "SUBSCRIBE":
+			for i, ch := range args[1:] {
+				c.mu.Lock()
+				c.subs[ch] = ""
+				c.mu.Unlock()
+				c.send(fmt.Sprintf("*3\r\n$9\r\nsubscribe\r\n$%d\r\n%s\r\n:%d\r\n", len(ch), ch, i+1))
+			}
+		case "UNSUBSCRIBE":
+			c.mu.Lock()
+			c.subs = map[string]string{}
+			c.mu.Unlock()
+			c.send("*3\r\n$11\r\nunsubscribe\r\n$-1\r\n:0\r\n")
+		case "PUBLISH":
+			c.send(fmt.Sprintf(":%d\r\n", b.publish(args[1], []byte(args[2]))))
+		default:
+			c.send("+OK\r\n")
+		}
+	}
+}
+
+func readRESP(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("unexpected %q", line)
+	}
+	args := make([]string, n)
+	for i := range args {
+		if line, err = r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, fmt.Errorf("unexpected %q", line)
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func respArray(items ...string) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "*%d\r\n", len(items))
+	for _, it := range items {
+		fmt.Fprintf(&sb, "$%d\r\n%s\r\n", len(it), it)
+	}
+	return sb.String()
+}
+
+// subscribeTest connects a backplane to broker and subscribes it, returning the messages
+// it receives.
+func subscribeTest(t *testing.T, ctx context.Context, broker *fakeBroker) (Backplane, chan string) {
+	t.Helper()
+	bp, err := NewBackplane(ctx, broker.url(), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = bp.Close() })
+	got := make(chan string, 64)
+	go func() { _ = bp.Subscribe(ctx, func(msg []byte) { got <- string(msg) }) }()
+	return bp, got
+}
+
+func receive(t *testing.T, got chan string) string {
+	t.Helper()
+	select {
+	case msg := <-got:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+		return ""
+	}
+}
+
+func TestBackplane(t *testing.T) {
+	for _, proto := range []string{"redis", "nats"} {
+		t.Run(proto, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			broker := newFakeBroker(t, proto)
+			a, gotA := subscribeTest(t, ctx, broker)
+			b, gotB := subscribeTest(t, ctx, broker)
+			if a.Origin() == b.Origin() {
+				t.Fatalf("instances share origin %s", a.Origin())
+			}
+			broker.waitSubscriptions(t, 2)
+
+			// Fan-out: each instance gets the other's messages but never its own, which the
+			// broker echoes back to it ahead of b's.
+			if err := a.Publish(ctx, []byte("from a")); err != nil {
+				t.Fatal(err)
+			}
+			if err := b.Publish(ctx, []byte("from b")); err != nil {
+				t.Fatal(err)
+			}
+			if msg := receive(t, gotB); msg != "from a" {
+				t.Errorf("b received %q, want from a", msg)
+			}
+			if msg := receive(t, gotA); msg != "from b" {
+				t.Errorf("a received %q, want from b (own message echoed?)", msg)
+			}
+
+			// A frame without origin is not a backplane message.
+			broker.publish("test", []byte("garbage"))
+
+			// Reconnect: after the broker drops every connection both clients resubscribe.
+			broker.drop()
+			broker.waitSubscriptions(t, 2)
+			deadline := time.Now().Add(5 * time.Second)
+			for {
+				if err := a.Publish(ctx, []byte("again")); err == nil {
+					break
+				} else if time.Now().After(deadline) {
+					t.Fatalf("publish after reconnect: %v", err)
+				}
+				time.Sleep(50 * time.Millisecond)
+			}
+			if msg := receive(t, gotB); msg != "again" {
+				t.Errorf("b received %q after reconnect, want again", msg)
+			}
+			select {
+			case msg := <-gotA:
+				t.Errorf("a received %q after reconnect", msg)
+			case <-time.After(100 * time.Millisecond):
+			}
+		})
+	}
+}
+
+func TestNewBackplaneScheme(t *testing.T) {
+	if _, err := NewBackplane(context.Background(), "amqp://rabbit:5672", ""); err == nil || !strings.Contains(err.Error(), "unsupported scheme") {
+		t.Errorf("amqp backplane: %v", err)
+	}
+}
@@ -0,0 +1,272 @@
+package websocket
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// bandwidthMinutes is the history of per-minute byte counts a Bandwidth keeps.
+const bandwidthMinutes = 60
+
+// Bandwidth counts the bytes the hub sends, per websocket client and per topic, so the
+// topics and payloads that dominate the plant network show up before IT throttles the
+// service. Topic counts are payload bytes: a message counts once when published and once
+// per client it is queued to (fan-out); client counts are the frames actually written,
+// NDJSON batches and control replies included, websocket framing and pings not. A nil
+// Bandwidth counts nothing.
+type Bandwidth struct {
+	mu        sync.Mutex
+	since     time.Time
+	now       func() time.Time
+	topics    map[string]*topicBandwidth
+	clients   map[*client]*clientBandwidth
+	departed  uint64 // bytes sent to clients that disconnected
+	sentTotal byteSeries
+}
+
+type topicBandwidth struct {
+	messages, payload uint64
+	maxPayload        int
+	deliveries        uint64
+	sent              byteSeries
+}
+
+type clientBandwidth struct {
+	remote        string
+	name, version string
+	connected     time.Time
+	frames        uint64
+	sent          byteSeries
+}
+
+// byteSeries is a running total with the bytes of each of the last bandwidthMinutes
+// minutes.
+type byteSeries struct {
+	total   uint64
+	bytes   [bandwidthMinutes]uint64
+	minutes [bandwidthMinutes]int64 // unix minute of each slot
+}
+
+func (s *byteSeries) add(now time.Time, n int) {
+	m := now.Unix() / 60
+	i := m % bandwidthMinutes
+	if s.minutes[i] != m {
+		s.minutes[i], s.bytes[i] = m, 0
+	}
+	s.bytes[i] += uint64(n)
+	s.total += uint64(n)
+}
+
+// last returns the bytes of the last minutes minutes, the current one included.
+func (s *byteSeries) last(now time.Time, minutes int64) uint64 {
+	m := now.Unix() / 60
+	var sum uint64
+	for i, at := range s.minutes {
+		if at > m-minutes && at <= m {
+			sum += s.bytes[i]
+		}
+	}
+	return sum
+}
+
+// perMinute returns the minutes of the last hour with bytes sent, oldest first.
+func (s *byteSeries) perMinute(now time.Time) []MinuteBytes {
+	m := now.Unix() / 60
+	var out []MinuteBytes
+	for i, at := range s.minutes {
+		if at > m-bandwidthMinutes && at <= m && s.bytes[i] > 0 {
+			out = append(out, MinuteBytes{Minute: time.Unix(at*60, 0).UTC(), Bytes: s.bytes[i]})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Minute.Before(out[j].Minute) })
+	return out
+}
+
+// NewBandwidth returns an empty Bandwidth; hand it to Hub.SetBandwidth.
+func NewBandwidth() *Bandwidth {
+	return &Bandwidth{since: time.Now().UTC(), now: time.Now,
+		topics: map[string]*topicBandwidth{}, clients: map[*client]*clientBandwidth{}}
+}
+
+// SetBandwidth makes the hub count its traffic in b; call it before clients connect. A
+// Bandwidth outlives the hub, so a restarted hub keeps adding to the same counts.
+func (h *Hub) SetBandwidth(b *Bandwidth) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.bandwidth = b
+}
+
+func (b *Bandwidth) topic(name string) *topicBandwidth {
+	t := b.topics[name]
+	if t == nil {
+		t = &topicBandwidth{}
+		b.topics[name] = t
+	}
+	return t
+}
+
+// published counts a message of topic broadcast by the hub.
+func (b *Bandwidth) published(topic string, size int) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t := b.topic(topic)
+	t.messages++
+	t.payload += uint64(size)
+	t.maxPayload = max(t.maxPayload, size)
+}
+
+// delivered counts a message of topic queued to one client.
+func (b *Bandwidth) delivered(topic string, size int) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t := b.topic(topic)
+	t.deliveries++
+	t.sent.add(b.now(), size)
+}
+
+func (b *Bandwidth) connect(c *client, remote string) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.clients[c] = &clientBandwidth{remote: remote, connected: b.now().UTC()}
+}
+
+func (b *Bandwidth) hello(c *client, name, version string) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if cb := b.clients[c]; cb != nil {
+		cb.name, cb.version = name, version
+	}
+}
+
+func (b *Bandwidth) disconnect(c *client) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if cb := b.clients[c]; cb != nil {
+		b.departed += cb.sent.total
+		delete(b.clients, c)
+	}
+}
+
+// sent counts a frame written to c.
+func (b *Bandwidth) sent(c *client, size int) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	if cb := b.clients[c]; cb != nil {
+		cb.frames++
+		cb.sent.add(now, size)
+	}
+	b.sentTotal.add(now, size)
+}
+
+// MinuteBytes is the bytes sent in one minute.
+type MinuteBytes struct {
+	Minute time.Time `json:"minute"` // start, UTC
+	Bytes  uint64    `json:"bytes"`
+}
+
+// TopicBandwidth is the traffic of one topic (envelope massage_type; "" for messages that
+// are not envelopes, e.g. files.json).
+type TopicBandwidth struct {
+	Topic           string  `json:"topic"`
+	Messages        uint64  `json:"messages"`      // published
+	PayloadBytes    uint64  `json:"payload_bytes"` // published, each message once
+	AvgPayloadBytes float64 `json:"avg_payload_bytes"`
+	MaxPayloadBytes int     `json:"max_payload_bytes"`
+	Deliveries      uint64  `json:"deliveries"` // messages queued to clients
+	// SentBytes is the payload queued to clients, each message once per recipient (the
+	// snapshot topic in each client's view).
+	SentBytes           uint64        `json:"sent_bytes"`
+	SentBytesLastMinute uint64        `json:"sent_bytes_last_minute"`
+	SentBytesLastHour   uint64        `json:"sent_bytes_last_hour"`
+	PerMinute           []MinuteBytes `json:"per_minute,omitempty"` // last hour, oldest first
+}
+
+// ClientBandwidth is the traffic of one connected websocket client.
+type ClientBandwidth struct {
+	ID                  string    `json:"id"` // as in the hub's log lines
+	Remote              string    `json:"remote"`
+	Name                string    `json:"name,omitempty"` // from its hello frame
+	Version             string    `json:"version,omitempty"`
+	Connected           time.Time `json:"connected"`
+	Frames              uint64    `json:"frames"`
+	SentBytes           uint64    `json:"sent_bytes"`
+	SentBytesLastMinute uint64    `json:"sent_bytes_last_minute"`
+	SentBytesLastHour   uint64    `json:"sent_bytes_last_hour"`
+}
+
+// BandwidthReport is what Report returns; topics and clients are sorted by bytes sent,
+// most first.
+type BandwidthReport struct {
+	Since               time.Time         `json:"since"`
+	SentBytes           uint64            `json:"sent_bytes"` // to every client, disconnected ones included
+	SentBytesLastMinute uint64            `json:"sent_bytes_last_minute"`
+	SentBytesLastHour   uint64            `json:"sent_bytes_last_hour"`
+	DepartedBytes       uint64            `json:"departed_bytes"` // to clients since disconnected
+	Topics              []TopicBandwidth  `json:"topics"`
+	Clients             []ClientBandwidth `json:"clients"`
+}
+
+// Report returns the counts so far.
+func (b *Bandwidth) Report() BandwidthReport {
+	rep := BandwidthReport{Topics: []TopicBandwidth{}, Clients: []ClientBandwidth{}}
+	if b == nil {
+		return rep
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	rep.Since, rep.DepartedBytes = b.since, b.departed
+	rep.SentBytes = b.sentTotal.total
+	rep.SentBytesLastMinute, rep.SentBytesLastHour = b.sentTotal.last(now, 1), b.sentTotal.last(now, bandwidthMinutes)
+	for name, t := range b.topics {
+		tb := TopicBandwidth{Topic: name, Messages: t.messages, PayloadBytes: t.payload, MaxPayloadBytes: t.maxPayload,
+			Deliveries: t.deliveries, SentBytes: t.sent.total, SentBytesLastMinute: t.sent.last(now, 1),
+			SentBytesLastHour: t.sent.last(now, bandwidthMinutes), PerMinute: t.sent.perMinute(now)}
+		if t.messages > 0 {
+			tb.AvgPayloadBytes = float64(t.payload) / float64(t.messages)
+		}
+		rep.Topics = append(rep.Topics, tb)
+	}
+	for c, cb := range b.clients {
+		rep.Clients = append(rep.Clients, ClientBandwidth{ID: fmt.Sprintf("%p", c), Remote: cb.remote,
+			Name: cb.name, Version: cb.version, Connected: cb.connected, Frames: cb.frames,
+			SentBytes: cb.sent.total, SentBytesLastMinute: cb.sent.last(now, 1),
+			SentBytesLastHour: cb.sent.last(now, bandwidthMinutes)})
+	}
+	sort.Slice(rep.Topics, func(i, j int) bool {
+		a, b := rep.Topics[i], rep.Topics[j]
+		if a.SentBytes != b.SentBytes {
+			return a.SentBytes > b.SentBytes
+		}
+		return a.Topic < b.Topic
+	})
+	sort.Slice(rep.Clients, func(i, j int) bool {
+		a, b := rep.Clients[i], rep.Clients[j]
+		if a.SentBytes != b.SentBytes {
+			return a.SentBytes > b.SentBytes
+		}
+		return a.ID < b.ID
+	})
+	return rep
+}
@@ -0,0 +1,232 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"hex_toolset/pkg/buildinfo"
+)
+
+// Control frames.
+//
+// Clients may send JSON control frames, each a text message naming its "type"; an "id"
+// is echoed in the reply so clients can match replies to requests:
+//
+//	{"type":"subscribe","id":"1","topics":["LAST_HOUR","ALERT"],"filter":"line==\"J06\""}
+//	{"type":"unsubscribe","id":"2","topics":["ALERT"]}
+//	{"type":"hello","name":"Kiosk J06","version":"2.3.0"}
+//	{"type":"ping","id":"3"}
+//
+// A client starts subscribed to every topic. Its first subscribe narrows that to the
+// listed topics and later ones add to them; "*" stands for every topic. unsubscribe
+// removes topics. A "filter" replaces the ?filter= expression ("" clears it). hello
+// reports the client's display name and version, which the hub logs.
+//
+// The server answers with "ack" (carrying the resulting topics and filter), "pong" (with
+// the server time) or "error"; pong and the ack of hello also carry the server's "build". Replies are sent in the client's message stream; they carry
+// "type" where envelopes carry "massage_type". Unknown fields are ignored and an unknown
+// type gets an error reply without closing the connection, so clients may send types
+// added later.
+
+// Control frame types.
+const (
+	ControlSubscribe   = "subscribe"
+	ControlUnsubscribe = "unsubscribe"
+	ControlHello       = "hello"
+	ControlPing        = "ping"
+	ControlAck         = "ack"
+	ControlPong        = "pong"
+	ControlError       = "error"
+)
+
+// AllTopics subscribes to or unsubscribes from every topic.
+const AllTopics = "*"
+
+// ControlFrame is a control frame sent by a client.
+type ControlFrame struct {
+	Type    string   `json:"type"`
+	ID      string   `json:"id,omitempty"`
+	Topics  []string `json:"topics,omitempty"`
+	Filter  *string  `json:"filter,omitempty"` // nil keeps the filter
+	Name    string   `json:"name,omitempty"`
+	Version string   `json:"version,omitempty"`
+}
+
+// ControlReply is the server's answer to a ControlFrame.
+type ControlReply struct {
+	Type   string    `json:"type"`
+	ID     string    `json:"id,omitempty"`
+	Topics []string  `json:"topics,omitempty"` // ack: the subscribed topics, sorted; ["*"] for all
+	Filter string    `json:"filter,omitempty"` // ack: the filter in effect
+	Time   time.Time `json:"time,omitzero"`    // pong: the server time
+	Error  string    `json:"error,omitempty"`
+	// Build is the build of the broadcast service, in pong and in the ack of hello.
+	Build *buildinfo.Info `json:"build,omitempty"`
+}
+
+// subscription selects the messages queued for a client; the Run goroutine reads it and
+// readPump changes it, both under the hub's mu.
+type subscription struct {
+	topics   map[string]bool // nil: every topic but excluded
+	excluded map[string]bool
+	explicit bool    // a subscribe or unsubscribe was received
+	filter   *Filter // nil delivers every message
+}
+
+// match reports whether a message with meta is for the client.
+func (s *subscription) match(meta map[string]string) bool {
+	t := meta["type"]
+	if s.topics != nil && !s.topics[t] || s.topics == nil && s.excluded[t] {
+		return false
+	}
+	return s.filter.Match(meta)
+}
+
+func (s *subscription) subscribe(topics []string) {
+	for _, t := range topics {
+		switch {
+		case t == AllTopics:
+			s.topics, s.excluded = nil, nil
+		case s.topics == nil && !s.explicit:
+			s.topics = map[string]bool{t: true}
+		case s.topics == nil:
+			delete(s.excluded, t)
+		default:
+			s.topics[t] = true
+		}
+		s.explicit = true
+	}
+}
+
+func (s *subscription) unsubscribe(topics []string) {
+	for _, t := range topics {
+		switch {
+		case t == AllTopics:
+			s.topics, s.excluded = map[string]bool{}, nil
+		case s.topics == nil:
+			if s.excluded == nil {
+				s.excluded = map[string]bool{}
+			}
+			s.excluded[t] = true
+		default:
+			delete(s.topics, t)
+		}
+		s.explicit = true
+	}
+}
+
+// list returns the subscribed topics for an ack: ["*"] for every topic, then "-TOPIC"
+// for the excluded ones.
+func (s *subscription) list() []string {
+	var out []string
+	if s.topics == nil {
+		for t := range s.excluded {
+			out = append(out, "-"+t)
+		}
+		sort.Strings(out)
+		return append([]string{AllTopics}, out...)
+	}
+	out = []string{}
+	for t := range s.topics {
+		out = append(out, t)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// handleControl applies one control frame of c and queues the reply.
+func (c *client) handleControl(data []byte) {
+	var f ControlFrame
+	if err := json.Unmarshal(data, &f); err != nil {
+		c.reply(ControlReply{Type: ControlError, Error: "control frame is not a JSON object"})
+		return
+	}
+	switch f.Type {
+	case ControlPing:
+		c.reply(ControlReply{Type: ControlPong, ID: f.ID, Time: time.Now().UTC(), Build: serverBuild()})
+	case ControlHello:
+		c.hub.mu.Lock()
+		c.name, c.version = f.Name, f.Version
+		c.hub.mu.Unlock()
+		c.bw.hello(c, f.Name, f.Version)
+		c.log.Infof("client %p: hello name=%q version=%q", c, f.Name, f.Version)
+		c.reply(ControlReply{Type: ControlAck, ID: f.ID, Build: serverBuild()})
+	case ControlSubscribe, ControlUnsubscribe:
+		var filter *Filter
+		if f.Filter != nil && strings.TrimSpace(*f.Filter) != "" {
+			var err error
+			if filter, err = ParseFilter(*f.Filter); err != nil {
+				c.reply(ControlReply{Type: ControlError, ID: f.ID, Error: err.Error()})
+				return
+			}
+		}
+		if !c.waitJoined() {
+			return
+		}
+		h := c.hub
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		snapshotSeen := h.latest != nil && c.sub.match(h.latest.meta)
+		if f.Type == ControlSubscribe {
+			c.sub.subscribe(f.Topics)
+		} else {
+			c.sub.unsubscribe(f.Topics)
+		}
+		if f.Filter != nil {
+			c.sub.filter = filter
+		}
+		c.queueReply(ControlReply{Type: ControlAck, ID: f.ID, Topics: c.sub.list(), Filter: c.sub.filter.String()})
+		// a client that just started receiving the snapshot topic gets the latest one
+		if !snapshotSeen && h.clients[c] {
+			h.sendSnapshot(c, c.log)
+		}
+	default:
+		c.reply(ControlReply{Type: ControlError, ID: f.ID, Error: fmt.Sprintf("unknown control frame type %q", f.Type)})
+	}
+}
+
+func serverBuild() *buildinfo.Info {
+	b := buildinfo.Get()
+	return &b
+}
+
+// reply queues r to c once the hub registered it.
+func (c *client) reply(r ControlReply) {
+	if !c.waitJoined() {
+		return
+	}
+	c.hub.mu.Lock()
+	defer c.hub.mu.Unlock()
+	c.queueReply(r)
+}
+
+// waitJoined waits until the hub registered c; it reports false after Shutdown.
+func (c *client) waitJoined() bool {
+	select {
+	case <-c.joined:
+		return true
+	case <-c.hub.done:
+		return false
+	}
+}
+
+// queueReply queues r to c, dropping it when c's queue is full or c has left. The caller
+// holds the hub's mu.
+func (c *client) queueReply(r ControlReply) {
+	if !c.hub.clients[c] {
+		return
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		c.log.Errorf("client %p: encode %s reply: %v", c, r.Type, err)
+		return
+	}
+	select {
+	case c.send <- b:
+	default:
+		c.log.Warnf("client %p: send queue full; %s reply dropped", c, r.Type)
+	}
+}
@@ -0,0 +1,257 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MaxFilterLength bounds the ?filter= expression of a client.
+const MaxFilterLength = 512
+
+// Filter is a client-side subscription filter evaluated by the hub against the metadata of
+// each envelope before it is queued, so clients only receive the messages they render.
+//
+// The grammar is comparisons of a metadata field with a double-quoted string, combined with
+// && and || and grouped with parentheses (&& binds tighter):
+//
+//	type!="LAST_HOUR" && (line=="J06" || line=="J07")
+//
+// The fields are "type" (the envelope massage_type) and the keys of the envelope "meta"
+// object. A comparison on a field the message does not carry is satisfied, so messages
+// that are not about one line (e.g. LAST_HOUR) still reach a client filtering on line.
+type Filter struct {
+	expr string
+	root filterNode
+}
+
+// ParseFilter parses a filter expression.
+func ParseFilter(expr string) (*Filter, error) {
+	if len(expr) > MaxFilterLength {
+		return nil, fmt.Errorf("filter longer than %d bytes", MaxFilterLength)
+	}
+	toks, err := lexFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{toks: toks}
+	root, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("filter: unexpected %s at offset %d", t, t.pos)
+	}
+	return &Filter{expr: strings.TrimSpace(expr), root: root}, nil
+}
+
+// Match reports whether a message with meta passes the filter. A nil filter matches all.
+func (f *Filter) Match(meta map[string]string) bool {
+	return f == nil || f.root.eval(meta)
+}
+
+func (f *Filter) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.expr
+}
+
+// EnvelopeMeta returns the filterable metadata of an envelope: its massage_type as "type"
+// and the string fields of its "meta" object. Messages that are not envelopes have none.
+func EnvelopeMeta(msg []byte) map[string]string {
+	var env struct {
+		Type string         `json:"massage_type"`
+		Meta map[string]any `json:"meta"`
+	}
+	if err := json.Unmarshal(msg, &env); err != nil {
+		return nil
+	}
+	meta := make(map[string]string, len(env.Meta)+1)
+	for k, v := range env.Meta {
+		if s, ok := v.(string); ok {
+			meta[k] = s
+		}
+	}
+	if env.Type != "" {
+		meta["type"] = env.Type
+	}
+	return meta
+}
+
+type filterNode interface {
+	eval(meta map[string]string) bool
+}
+
+type filterCompare struct {
+	field, value string
+	equal        bool
+}
+
+func (c filterCompare) eval(meta map[string]string) bool {
+	v, ok := meta[c.field]
+	if !ok {
+		return true
+	}
+	return (v == c.value) == c.equal
+}
+
+type filterBinary struct {
+	and         bool
+	left, right filterNode
+}
+
+func (b filterBinary) eval(meta map[string]string) bool {
+	if b.and {
+		return b.left.eval(meta) && b.right.eval(meta)
+	}
+	return b.left.eval(meta) || b.right.eval(meta)
+}
+
+type filterTokenKind int
+
+const (
+	tokEOF filterTokenKind = iota
+	tokIdent
+	tokString
+	tokEq
+	tokNeq
+	tokAnd
+	tokOr
+	tokLParen
+	tokRParen
+)
+
+type filterToken struct {
+	kind filterTokenKind
+	text string
+	pos  int
+}
+
+func (t filterToken) String() string {
+	if t.kind == tokEOF {
+		return "end of filter"
+	}
+	return strconv.Quote(t.text)
+}
+
+func lexFilter(s string) ([]filterToken, error) {
+	var toks []filterToken
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '(' || c == ')':
+			kind := tokLParen
+			if c == ')' {
+				kind = tokRParen
+			}
+			toks = append(toks, filterToken{kind, string(c), i})
+			i++
+		case strings.HasPrefix(s[i:], "=="), strings.HasPrefix(s[i:], "!="),
+			strings.HasPrefix(s[i:], "&&"), strings.HasPrefix(s[i:], "||"):
+			kind := map[string]filterTokenKind{"==": tokEq, "!=": tokNeq, "&&": tokAnd, "||": tokOr}[s[i:i+2]]
+			toks = append(toks, filterToken{kind, s[i : i+2], i})
+			i += 2
+		case c == '"':
+			end := i + 1
+			for end < len(s) && s[end] != '"' {
+				if s[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(s) {
+				return nil, fmt.Errorf("filter: unterminated string at offset %d", i)
+			}
+			v, err := strconv.Unquote(s[i : end+1])
+			if err != nil {
+				return nil, fmt.Errorf("filter: invalid string at offset %d", i)
+			}
+			toks = append(toks, filterToken{tokString, v, i})
+			i = end + 1
+		case isIdentByte(c, true):
+			end := i + 1
+			for end < len(s) && isIdentByte(s[end], false) {
+				end++
+			}
+			toks = append(toks, filterToken{tokIdent, s[i:end], i})
+			i = end
+		default:
+			return nil, fmt.Errorf("filter: unexpected %q at offset %d", c, i)
+		}
+	}
+	return append(toks, filterToken{kind: tokEOF, pos: len(s)}), nil
+}
+
+func isIdentByte(c byte, first bool) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (!first && c >= '0' && c <= '9')
+}
+
+type filterParser struct {
+	toks []filterToken
+	pos  int
+}
+
+func (p *filterParser) peek() filterToken { return p.toks[p.pos] }
+
+func (p *filterParser) next() filterToken {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *filterParser) or() (filterNode, error) {
+	left, err := p.and()
+	for err == nil && p.peek().kind == tokOr {
+		p.next()
+		var right filterNode
+		if right, err = p.and(); err == nil {
+			left = filterBinary{and: false, left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+func (p *filterParser) and() (filterNode, error) {
+	left, err := p.primary()
+	for err == nil && p.peek().kind == tokAnd {
+		p.next()
+		var right filterNode
+		if right, err = p.primary(); err == nil {
+			left = filterBinary{and: true, left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+func (p *filterParser) primary() (filterNode, error) {
+	t := p.next()
+	switch t.kind {
+	case tokLParen:
+		n, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if c := p.next(); c.kind != tokRParen {
+			return nil, fmt.Errorf("filter: expected \")\" at offset %d, got %s", c.pos, c)
+		}
+		return n, nil
+	case tokIdent:
+		op := p.next()
+		if op.kind != tokEq && op.kind != tokNeq {
+			return nil, fmt.Errorf("filter: expected == or != after %s at offset %d", t.text, op.pos)
+		}
+		v := p.next()
+		if v.kind != tokString {
+			return nil, fmt.Errorf("filter: expected a quoted string at offset %d, got %s", v.pos, v)
+		}
+		return filterCompare{field: t.text, value: v.text, equal: op.kind == tokEq}, nil
+	default:
+		return nil, fmt.Errorf("filter: expected a field or \"(\" at offset %d, got %s", t.pos, t)
+	}
+}
@@ -1,24 +1,45 @@
 package websocket
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
+	"hex_toolset/pkg/api"
 	"hex_toolset/pkg/logger"
 
 	"github.com/gorilla/websocket"
 )
 
+// ErrHubClosed is returned by Broadcast after Shutdown.
+var ErrHubClosed = errors.New("websocket hub is shut down")
+
 // Hub manages active clients and broadcasts messages
 // Exported for reuse by managers.
+//
+// The hub's channels are never closed: Shutdown closes done instead, so Broadcast and
+// clients still registering or leaving concurrently with it return instead of panicking.
+// Run then delivers the messages still queued before Shutdown closes the clients.
 type Hub struct {
 	clients    map[*client]bool
 	broadcast  chan []byte
 	register   chan *client
 	unregister chan *client
+	done       chan struct{}
+	stopped    chan struct{} // closed when Run returns
+	sending    sync.RWMutex  // held by Broadcast while it may queue, see flush
+	replay     *replayBuffer // recent messages for PollHandler
+	views      *SnapshotViews
+	latest     *snapshot // latest message of views.Topic
+	bandwidth  *Bandwidth
 	mu         sync.RWMutex
 	closed     bool
+	running    bool
 }
 
 // NewHub constructs a new Hub
@@ -28,11 +49,22 @@ func NewHub() *Hub {
 		broadcast:  make(chan []byte, 1024),
 		register:   make(chan *client, 128),
 		unregister: make(chan *client, 128),
+		done:       make(chan struct{}),
+		stopped:    make(chan struct{}),
+		replay:     newReplayBuffer(DefaultReplaySize),
 	}
 }
 
 // Run starts the hub event loop
 func (h *Hub) Run(logg *logger.Logger) {
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return
+	}
+	h.running = true
+	h.mu.Unlock()
+	defer close(h.stopped)
 	defer func() {
 		if r := recover(); r != nil {
 			logg.Errorf("hub panic recovered: %v", r)
@@ -40,55 +72,176 @@ func (h *Hub) Run(logg *logger.Logger) {
 	}()
 	for {
 		select {
+		case <-h.done:
+			h.flush(logg)
+			return
 		case c := <-h.register:
 			h.mu.Lock()
+			if h.closed {
+				close(c.send)
+				h.mu.Unlock()
+				continue
+			}
 			h.clients[c] = true
+			close(c.joined)
+			h.sendSnapshot(c, logg)
 			h.mu.Unlock()
-			logg.Infof("client registered: %p (total=%d)", c, len(h.clients))
+			if c.sub.filter != nil {
+				logg.Infof("client registered: %p filter=%s (total=%d)", c, c.sub.filter, len(h.clients))
+			} else {
+				logg.Infof("client registered: %p (total=%d)", c, len(h.clients))
+			}
 		case c := <-h.unregister:
 			h.mu.Lock()
 			if _, ok := h.clients[c]; ok {
 				delete(h.clients, c)
 				close(c.send)
 			}
+			name, version := c.name, c.version
 			h.mu.Unlock()
-			logg.Infof("client unregistered: %p (total=%d)", c, len(h.clients))
+			if name != "" || version != "" {
+				logg.Infof("client unregistered: %p name=%q version=%q (total=%d)", c, name, version, len(h.clients))
+			} else {
+				logg.Infof("client unregistered: %p (total=%d)", c, len(h.clients))
+			}
 		case msg := <-h.broadcast:
-			h.mu.RLock()
-			for c := range h.clients {
-				select {
-				case c.send <- msg:
-				default:
-					// slow client, drop
-					close(c.send)
-					delete(h.clients, c)
-				}
+			h.deliver(msg, logg)
+		}
+	}
+}
+
+// deliver queues msg to every client subscribed to it, dropping clients whose queue is full.
+func (h *Hub) deliver(msg []byte, logg *logger.Logger) {
+	meta := EnvelopeMeta(msg)
+	h.replay.add(msg, meta)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.bandwidth.published(meta["type"], len(msg))
+	isSnapshot := h.views != nil && meta["type"] == h.views.Topic
+	if isSnapshot {
+		h.latest = &snapshot{msg: msg, meta: meta, rendered: map[string][]byte{}}
+	}
+	for c := range h.clients {
+		if !c.sub.match(meta) {
+			continue
+		}
+		out := msg
+		if isSnapshot {
+			var err error
+			if out, err = h.render(c.view); err != nil {
+				logg.Errorf("%v", err)
 			}
-			h.mu.RUnlock()
 		}
+		select {
+		case c.send <- out:
+			h.bandwidth.delivered(meta["type"], len(out))
+		default:
+			// slow client, drop
+			logg.Warnf("client %p: send queue full; disconnecting", c)
+			close(c.send)
+			delete(h.clients, c)
+		}
+	}
+}
+
+// flush delivers the messages queued before Shutdown. Broadcast holds sending while it may
+// still queue, so once flush holds it (done being closed) nothing is queued after it.
+func (h *Hub) flush(logg *logger.Logger) {
+	h.sending.Lock() // waits out the Broadcasts in flight
+	h.sending.Unlock()
+	for {
+		select {
+		case msg := <-h.broadcast:
+			h.deliver(msg, logg)
+		default:
+			return
+		}
+	}
+}
+
+// sendSnapshot queues the latest snapshot, in c's view, to a client that just subscribed.
+// The caller holds h.mu.
+func (h *Hub) sendSnapshot(c *client, logg *logger.Logger) {
+	if h.latest == nil || !c.sub.match(h.latest.meta) {
+		return
+	}
+	out, err := h.render(c.view)
+	if err != nil {
+		logg.Errorf("%v", err)
+	}
+	select {
+	case c.send <- out:
+		h.bandwidth.delivered(h.latest.meta["type"], len(out))
+	default:
 	}
 }
 
-// Shutdown closes all client channels and stops the hub
+// Shutdown stops the hub: it waits for Run to deliver the messages already queued, then
+// closes all client channels, so clients receive them before the close frame. Safe to
+// call more than once.
 func (h *Hub) Shutdown() {
 	h.mu.Lock()
-	defer h.mu.Unlock()
 	if h.closed {
+		h.mu.Unlock()
 		return
 	}
 	h.closed = true
+	close(h.done)
+	running := h.running
+	h.mu.Unlock()
+	if running {
+		<-h.stopped
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
 	for c := range h.clients {
 		close(c.send)
 		delete(h.clients, c)
 	}
-	close(h.broadcast)
-	close(h.register)
-	close(h.unregister)
 }
 
-// Broadcast sends a message to all clients via the hub.
-func (h *Hub) Broadcast(msg []byte) {
-	h.broadcast <- msg
+// Broadcast queues a message for all clients. It blocks while the queue is full and
+// returns ErrHubClosed, delivering nothing, once the hub is shut down. nil means queued:
+// the message reaches the clients subscribed to it when Run gets to it, Shutdown
+// included, unless their queue is full. Without Run nothing is delivered.
+func (h *Hub) Broadcast(msg []byte) error {
+	h.sending.RLock()
+	defer h.sending.RUnlock()
+	select {
+	case <-h.done:
+		return ErrHubClosed
+	default:
+	}
+	select {
+	case h.broadcast <- msg:
+		return nil
+	case <-h.done:
+		return ErrHubClosed
+	}
+}
+
+// join registers c with the hub; it reports false when the hub is shut down.
+func (h *Hub) join(c *client) bool {
+	select {
+	case <-h.done:
+		return false
+	default:
+	}
+	select {
+	case h.register <- c:
+		return true
+	case <-h.done:
+		return false
+	}
+}
+
+// leave unregisters c; after Shutdown its queue is already closed.
+func (h *Hub) leave(c *client) {
+	select {
+	case h.unregister <- c:
+	case <-h.done:
+	}
 }
 
 // client represents a websocket client
@@ -98,37 +251,70 @@ type client struct {
 	conn *websocket.Conn
 	send chan []byte
 	log  *logger.Logger
+	bw   *Bandwidth // the hub's when the client connected
+
+	writeTimeout time.Duration
+	ndjson       bool // batch queued messages into one frame, one JSON document per line
+	maxBatch     int
+	view         string // ?snapshot=; "" for snapshots as published
+
+	// Under hub.mu: the topics and filter (?filter= or control frames) of the messages
+	// queued for the client, and the name and version it reported in a hello frame.
+	sub           subscription
+	name, version string
+	joined        chan struct{} // closed once the hub registered the client
 }
 
 const (
-	writeWait      = 10 * time.Second
 	pongWait       = 60 * time.Second
 	pingPeriod     = (pongWait * 9) / 10
-	maxMessageSize = 64 // small; we don't expect client -> server traffic
+	maxMessageSize = 4096 // control frames only (see ControlFrame)
+
+	// DefaultWriteTimeout bounds each frame written to a client.
+	DefaultWriteTimeout = 10 * time.Second
+	// DefaultMaxBatch bounds the messages joined into one NDJSON frame.
+	DefaultMaxBatch = 64
 )
 
+// Options configures WSHandlerWithOptions.
+type Options struct {
+	// WriteTimeout is the per-client deadline of each frame; a client that cannot take a
+	// frame in time is disconnected. 0 uses DefaultWriteTimeout.
+	WriteTimeout time.Duration
+	// MaxBatch is the most messages sent in one frame to NDJSON clients. 0 uses DefaultMaxBatch.
+	MaxBatch int
+}
+
 func (c *client) readPump() {
 	defer func() {
 		if r := recover(); r != nil {
 			c.log.Errorf("client read panic recovered: %v", r)
 		}
-		c.hub.unregister <- c
+		c.hub.leave(c)
+		c.bw.disconnect(c)
 		_ = c.conn.Close()
 	}()
 	c.conn.SetReadLimit(int64(maxMessageSize))
 	_ = c.conn.SetReadDeadline(time.Now().Add(pongWait))
 	c.conn.SetPongHandler(func(string) error { _ = c.conn.SetReadDeadline(time.Now().Add(pongWait)); return nil })
 	for {
-		_, _, err := c.conn.ReadMessage()
+		kind, data, err := c.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				c.log.Errorf("unexpected ws close: %v", err)
 			}
 			break
 		}
+		if kind == websocket.TextMessage {
+			c.handleControl(data)
+		}
 	}
 }
 
+// writePump sends each queued message in its own text frame. Clients that connected with
+// ?batch=ndjson instead get whatever is queued (up to maxBatch messages) in one frame with
+// one compact JSON document per line. A failed write is not retried: the connection is
+// unusable afterwards, so the client is dropped and expected to reconnect.
 func (c *client) writePump() {
 	ticker := time.NewTicker(pingPeriod)
 	defer func() {
@@ -141,68 +327,165 @@ func (c *client) writePump() {
 	for {
 		select {
 		case msg, ok := <-c.send:
-			_ = c.conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if !ok {
+				_ = c.conn.SetWriteDeadline(time.Now().Add(c.writeTimeout))
 				_ = c.conn.WriteMessage(websocket.CloseMessage, []byte{})
 				return
 			}
-			w, err := c.conn.NextWriter(websocket.TextMessage)
-			if err != nil {
-				c.log.Errorf("next writer error: %v", err)
-				return
-			}
-			if _, err := w.Write(msg); err != nil {
-				c.log.Errorf("write error: %v", err)
-				_ = w.Close()
-				return
+			frame, closed := msg, false
+			if c.ndjson {
+				frame, closed = c.nextBatch(msg)
 			}
-			// batch queued messages
-			n := len(c.send)
-			for i := 0; i < n; i++ {
-				if _, err := w.Write([]byte("\n")); err != nil {
-					c.log.Errorf("write joiner error: %v", err)
-					break
-				}
-				if _, err := w.Write(<-c.send); err != nil {
-					c.log.Errorf("write batch error: %v", err)
-					break
+			if len(frame) > 0 {
+				if err := c.write(websocket.TextMessage, frame); err != nil {
+					c.writeFailed("write", err)
+					return
 				}
+				c.bw.sent(c, len(frame))
 			}
-			if err := w.Close(); err != nil {
-				c.log.Errorf("writer close error: %v", err)
+			if closed {
+				_ = c.conn.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+				_ = c.conn.WriteMessage(websocket.CloseMessage, []byte{})
 				return
 			}
 		case <-ticker.C:
-			_ = c.conn.SetWriteDeadline(time.Now().Add(writeWait))
-			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
-				c.log.Errorf("ping error: %v", err)
+			if err := c.write(websocket.PingMessage, nil); err != nil {
+				c.writeFailed("ping", err)
 				return
 			}
 		}
 	}
 }
 
+func (c *client) write(messageType int, data []byte) error {
+	_ = c.conn.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+	return c.conn.WriteMessage(messageType, data)
+}
+
+// nextBatch joins first and the messages already queued behind it into one NDJSON frame.
+// closed reports that the hub closed the queue while the batch was collected.
+func (c *client) nextBatch(first []byte) (frame []byte, closed bool) {
+	frame = c.appendLine(nil, first)
+	for n := 1; n < c.maxBatch; n++ {
+		select {
+		case msg, ok := <-c.send:
+			if !ok {
+				return frame, true
+			}
+			frame = c.appendLine(frame, msg)
+		default:
+			return frame, false
+		}
+	}
+	return frame, false
+}
+
+// appendLine appends msg to an NDJSON frame. Messages spanning several lines (e.g. indented
+// files from MESSAGE_DIR) are compacted; ones that are not JSON cannot be framed and are
+// skipped.
+func (c *client) appendLine(frame, msg []byte) []byte {
+	sep := len(frame)
+	if sep > 0 {
+		frame = append(frame, '\n')
+	}
+	if bytes.IndexByte(msg, '\n') < 0 {
+		return append(frame, msg...)
+	}
+	buf := bytes.NewBuffer(frame)
+	if err := json.Compact(buf, msg); err != nil {
+		c.log.Warnf("client %p: skipping multi-line non-JSON message in NDJSON mode: %v", c, err)
+		return frame[:sep]
+	}
+	return buf.Bytes()
+}
+
+// writeFailed logs why a write to the client failed: timeouts point at a slow or stalled
+// client, a closed connection is a normal disconnect.
+func (c *client) writeFailed(op string, err error) {
+	var ne net.Error
+	switch {
+	case errors.As(err, &ne) && ne.Timeout():
+		c.log.Warnf("client %p: %s timed out after %s; disconnecting", c, op, c.writeTimeout)
+	case errors.Is(err, net.ErrClosed), errors.Is(err, websocket.ErrCloseSent), websocket.IsCloseError(err):
+		c.log.Infof("client %p: connection closed during %s", c, op)
+	default:
+		c.log.Errorf("client %p: %s error: %v", c, op, err)
+	}
+}
+
 // WSHandler upgrades and registers clients with the Hub
 func WSHandler(h *Hub, logg *logger.Logger) http.HandlerFunc {
+	return WSHandlerWithOptions(h, logg, Options{})
+}
+
+// WSHandlerWithOptions is WSHandler with explicit write timeout and batching limits.
+// Clients opt into NDJSON batching with ?batch=ndjson, receive only the messages
+// matching ?filter=<expression> (see Filter) and choose the granularity of the snapshot
+// topic with ?snapshot=<view> (see SnapshotViews). Once connected they can change their
+// topics and filter with control frames (see ControlFrame).
+func WSHandlerWithOptions(h *Hub, logg *logger.Logger, opts Options) http.HandlerFunc {
+	if opts.WriteTimeout <= 0 {
+		opts.WriteTimeout = DefaultWriteTimeout
+	}
+	if opts.MaxBatch <= 0 {
+		opts.MaxBatch = DefaultMaxBatch
+	}
 	upgrader := websocket.Upgrader{
 		ReadBufferSize:  1024,
 		WriteBufferSize: 1024,
 		CheckOrigin:     func(r *http.Request) bool { return true },
+		Error: func(w http.ResponseWriter, r *http.Request, status int, reason error) {
+			api.WriteProblem(w, r, status, api.CodeInvalidRequest, reason.Error())
+		},
 	}
 	return func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if rec := recover(); rec != nil {
 				logg.Errorf("ws handler panic recovered: %v", rec)
-				http.Error(w, "internal server error", http.StatusInternalServerError)
+				api.WriteProblem(w, r, http.StatusInternalServerError, api.CodeInternal, "internal server error")
 			}
 		}()
+		var ndjson bool
+		switch batch := r.URL.Query().Get("batch"); batch {
+		case "", "none":
+		case "ndjson":
+			ndjson = true
+		default:
+			api.WriteProblem(w, r, http.StatusBadRequest, api.CodeInvalidRequest, "batch must be none or ndjson, got "+batch)
+			return
+		}
+		var filter *Filter
+		if expr := r.URL.Query().Get("filter"); strings.TrimSpace(expr) != "" {
+			f, err := ParseFilter(expr)
+			if err != nil {
+				api.WriteProblem(w, r, http.StatusBadRequest, api.CodeInvalidRequest, err.Error())
+				return
+			}
+			filter = f
+		}
+		view, err := h.snapshotView(r.URL.Query().Get("snapshot"))
+		if err != nil {
+			api.WriteProblem(w, r, http.StatusBadRequest, api.CodeInvalidRequest, err.Error())
+			return
+		}
 		conn, err := upgrader.Upgrade(w, r, nil)
 		if err != nil {
 			logg.Errorf("upgrade error: %v", err)
 			return
 		}
-		cl := &client{hub: h, conn: conn, send: make(chan []byte, 256), log: logg}
-		h.register <- cl
+		// the request_id of the upgrade request (api.Middleware) tags the connection's lines
+		cl := &client{hub: h, conn: conn, send: make(chan []byte, 256), log: logg.WithContext(r.Context()), writeTimeout: opts.WriteTimeout,
+			ndjson: ndjson, maxBatch: opts.MaxBatch, view: view, sub: subscription{filter: filter}, joined: make(chan struct{})}
+		h.mu.RLock()
+		cl.bw = h.bandwidth
+		h.mu.RUnlock()
+		cl.bw.connect(cl, r.RemoteAddr)
+		if !h.join(cl) {
+			cl.bw.disconnect(cl)
+			_ = conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "shutting down"))
+			_ = conn.Close()
+			return
+		}
 		go cl.writePump()
 		cl.readPump()
 	}
@@ -214,7 +497,7 @@ func RecoverMiddleware(next http.Handler, logg *logger.Logger) http.Handler {
 		defer func() {
 			if rec := recover(); rec != nil {
 				logg.Errorf("http panic recovered: %v", rec)
-				http.Error(w, "internal server error", http.StatusInternalServerError)
+				api.WriteProblem(w, r, http.StatusInternalServerError, api.CodeInternal, "internal server error")
 			}
 		}()
 		next.ServeHTTP(w, r)
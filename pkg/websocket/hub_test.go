@@ -0,0 +1,553 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"hex_toolset/pkg/logger"
+
+	"github.com/gorilla/websocket"
+)
+
+func newTestHub(t *testing.T, opts Options) (*Hub, *httptest.Server) {
+	t.Helper()
+	lgr, err := logger.New(logger.WithName("ws_test"), logger.WithDir(t.TempDir()), logger.WithConsole(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = lgr.Close() })
+	h := NewHub()
+	go h.Run(lgr)
+	srv := httptest.NewServer(WSHandlerWithOptions(h, lgr, opts))
+	t.Cleanup(srv.Close)
+	return h, srv
+}
+
+func dial(t *testing.T, srv *httptest.Server, query string) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+query, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+// waitClients waits until the hub has registered n clients.
+func waitClients(t *testing.T, h *Hub, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		h.mu.RLock()
+		got := len(h.clients)
+		h.mu.RUnlock()
+		if got == n {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("hub did not register %d client(s)", n)
+}
+
+// readFrames reads frames until they hold want lines in total.
+func readFrames(t *testing.T, conn *websocket.Conn, want int) []string {
+	t.Helper()
+	var frames []string
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for lines := 0; lines < want; {
+		_, b, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("read after %d frame(s): %v", len(frames), err)
+		}
+		frames = append(frames, string(b))
+		lines += strings.Count(string(b), "\n") + 1
+	}
+	return frames
+}
+
+func TestOneMessagePerFrameByDefault(t *testing.T) {
+	h, srv := newTestHub(t, Options{})
+	conn := dial(t, srv, "")
+	waitClients(t, h, 1)
+
+	msgs := []string{`{"a":1}`, `{"b":2}`, `{"c":3}`}
+	for _, m := range msgs {
+		h.Broadcast([]byte(m))
+	}
+	frames := readFrames(t, conn, len(msgs))
+	if strings.Join(frames, "|") != strings.Join(msgs, "|") {
+		t.Fatalf("frames = %q, want one per message %q", frames, msgs)
+	}
+}
+
+func TestNDJSONBatching(t *testing.T) {
+	h, srv := newTestHub(t, Options{MaxBatch: 2})
+	conn := dial(t, srv, "?batch=ndjson")
+	waitClients(t, h, 1)
+
+	// Queue everything before the pump runs so the messages are batched.
+	h.mu.RLock()
+	var cl *client
+	for c := range h.clients {
+		cl = c
+	}
+	h.mu.RUnlock()
+	cl.send <- []byte("{\n  \"a\": 1\n}\n")
+	cl.send <- []byte(`{"b":2}`)
+	cl.send <- []byte("not json\nat all")
+	cl.send <- []byte(`{"c":3}`)
+
+	var lines []string
+	for _, f := range readFrames(t, conn, 3) {
+		lines = append(lines, strings.Split(f, "\n")...)
+	}
+	want := []string{`{"a":1}`, `{"b":2}`, `{"c":3}`}
+	if strings.Join(lines, "|") != strings.Join(want, "|") {
+		t.Fatalf("lines = %q, want %q", lines, want)
+	}
+}
+
+func TestRejectsUnknownBatchMode(t *testing.T) {
+	_, srv := newTestHub(t, Options{})
+	_, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"?batch=xml", nil)
+	if err == nil {
+		t.Fatal("dial succeeded, want 400")
+	}
+	if resp == nil || resp.StatusCode != 400 {
+		t.Fatalf("response = %v, want 400", resp)
+	}
+}
+
+func TestFilterExpressions(t *testing.T) {
+	meta := map[string]string{"type": "ALERT", "line": "J06", "group": "PACKING"}
+	cases := []struct {
+		expr string
+		want bool
+	}{
+		{`line=="J06"`, true},
+		{`line=="J06" && group!="IN_STORE"`, true},
+		{`line=="J07" || group=="PACKING"`, true},
+		{`type!="ALERT" && line=="J06"`, false},
+		{`line=="J07" || line=="J08" && group=="PACKING"`, false},
+		{`(line=="J07" || line=="J06") && group=="PACKING"`, true},
+		{`station=="PACK01"`, true}, // not carried by the message: satisfied
+	}
+	for _, c := range cases {
+		f, err := ParseFilter(c.expr)
+		if err != nil {
+			t.Fatalf("ParseFilter(%q): %v", c.expr, err)
+		}
+		if got := f.Match(meta); got != c.want {
+			t.Fatalf("%q matched %v, want %v", c.expr, got, c.want)
+		}
+	}
+	for _, bad := range []string{`line=J06`, `line==J06`, `line=="J06" &&`, `(line=="J06"`, `line=="J06")`, `"J06"==line`, `line=="J06`} {
+		if _, err := ParseFilter(bad); err == nil {
+			t.Fatalf("ParseFilter(%q) should fail", bad)
+		}
+	}
+
+	if got := EnvelopeMeta([]byte(`{"massage_type":"ALERT","massage":{},"meta":{"line":"J06","n":1}}`)); len(got) != 2 || got["type"] != "ALERT" || got["line"] != "J06" {
+		t.Fatalf("EnvelopeMeta = %v", got)
+	}
+}
+
+func TestFilteredClientSkipsMessages(t *testing.T) {
+	h, srv := newTestHub(t, Options{})
+	filtered := dial(t, srv, `?filter=`+url.QueryEscape(`type!="LAST_HOUR" && line=="J06"`))
+	all := dial(t, srv, "")
+	waitClients(t, h, 2)
+
+	msgs := []string{
+		`{"massage_type":"LAST_HOUR","massage":{}}`,
+		`{"massage_type":"ALERT","massage":{},"meta":{"line":"J07"}}`,
+		`{"massage_type":"ALERT","massage":{},"meta":{"line":"J06"}}`,
+		`{"massage_type":"LAST_UPDATE","massage":{}}`,
+	}
+	for _, m := range msgs {
+		h.Broadcast([]byte(m))
+	}
+	if got := readFrames(t, all, len(msgs)); len(got) != len(msgs) {
+		t.Fatalf("unfiltered client got %d frames", len(got))
+	}
+	got := readFrames(t, filtered, 2)
+	if want := []string{msgs[2], msgs[3]}; strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("filtered client got %q, want %q", got, want)
+	}
+
+	_, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"?filter="+url.QueryEscape(`line=J06`), nil)
+	if err == nil || resp == nil || resp.StatusCode != 400 {
+		t.Fatalf("invalid filter: err=%v resp=%v, want 400", err, resp)
+	}
+}
+
+func TestSnapshotViews(t *testing.T) {
+	h, srv := newTestHub(t, Options{})
+	h.SetSnapshotViews(SnapshotViews{Topic: "SNAP", Views: []string{"full", "counts"},
+		Render: func(msg []byte, view string) ([]byte, error) {
+			return []byte(`{"massage_type":"SNAP","massage":"` + view + `"}`), nil
+		}})
+	full := dial(t, srv, "?snapshot=full")
+	waitClients(t, h, 1)
+
+	snap := `{"massage_type":"SNAP","massage":"everything"}`
+	h.Broadcast([]byte(snap))
+	if got := readFrames(t, full, 1); got[0] != snap {
+		t.Fatalf("full view = %q", got)
+	}
+
+	// A client subscribing later gets the latest snapshot right away, in its view...
+	counts := dial(t, srv, "?snapshot=counts")
+	counted := `{"massage_type":"SNAP","massage":"counts"}`
+	if got := readFrames(t, counts, 1); got[0] != counted {
+		t.Fatalf("snapshot on subscribe = %q", got)
+	}
+	// ...and the other topics unchanged.
+	other := `{"massage_type":"WIP","massage":{}}`
+	h.Broadcast([]byte(other))
+	h.Broadcast([]byte(snap))
+	if got := readFrames(t, counts, 2); got[0] != other || got[1] != counted {
+		t.Fatalf("counts client got %q", got)
+	}
+	if got := readFrames(t, full, 2); got[1] != snap {
+		t.Fatalf("full client got %q", got)
+	}
+
+	_, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"?snapshot=lines", nil)
+	if err == nil || resp == nil || resp.StatusCode != 400 {
+		t.Fatalf("unknown view: err=%v resp=%v, want 400", err, resp)
+	}
+}
+
+func TestControlFrames(t *testing.T) {
+	h, srv := newTestHub(t, Options{})
+	h.SetSnapshotViews(SnapshotViews{Topic: "SNAP", Views: []string{"full"}})
+	conn := dial(t, srv, "")
+	waitClients(t, h, 1)
+	send := func(frame string) {
+		t.Helper()
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(frame)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reply := func() ControlReply {
+		t.Helper()
+		var r ControlReply
+		if err := json.Unmarshal([]byte(readFrames(t, conn, 1)[0]), &r); err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	send(`{"type":"ping","id":"p1","future_field":true}`)
+	if r := reply(); r.Type != ControlPong || r.ID != "p1" || r.Time.IsZero() || r.Build == nil || r.Build.Version == "" {
+		t.Fatalf("ping reply = %+v", r)
+	}
+	send(`{"type":"hello","id":"h1","name":"Kiosk J06","version":"2.3.0"}`)
+	if r := reply(); r.Type != ControlAck || r.ID != "h1" {
+		t.Fatalf("hello reply = %+v", r)
+	}
+	h.mu.RLock()
+	for c := range h.clients {
+		if c.name != "Kiosk J06" || c.version != "2.3.0" {
+			t.Errorf("client metadata = %q %q", c.name, c.version)
+		}
+	}
+	h.mu.RUnlock()
+
+	// The first subscribe narrows the stream to its topics.
+	send(`{"type":"subscribe","id":"s1","topics":["ALERT"]}`)
+	if r := reply(); r.Type != ControlAck || !reflect.DeepEqual(r.Topics, []string{"ALERT"}) {
+		t.Fatalf("subscribe reply = %+v", r)
+	}
+	snap := `{"massage_type":"SNAP","massage":{}}`
+	alert := `{"massage_type":"ALERT","massage":{},"meta":{"line":"J06"}}`
+	h.Broadcast([]byte(`{"massage_type":"LAST_HOUR","massage":{}}`))
+	h.Broadcast([]byte(snap))
+	h.Broadcast([]byte(alert))
+	if got := readFrames(t, conn, 1); got[0] != alert {
+		t.Fatalf("got %q, want only the alert", got)
+	}
+
+	// Subscribing to the snapshot topic sends the latest snapshot after the ack.
+	send(`{"type":"subscribe","id":"s2","topics":["SNAP"],"filter":"line==\"J07\""}`)
+	if r := reply(); !reflect.DeepEqual(r.Topics, []string{"ALERT", "SNAP"}) || r.Filter != `line=="J07"` {
+		t.Fatalf("subscribe reply = %+v", r)
+	}
+	if got := readFrames(t, conn, 1); got[0] != snap {
+		t.Fatalf("snapshot on subscribe = %q", got)
+	}
+	send(`{"type":"unsubscribe","id":"u1","topics":["SNAP"],"filter":""}`)
+	if r := reply(); !reflect.DeepEqual(r.Topics, []string{"ALERT"}) || r.Filter != "" {
+		t.Fatalf("unsubscribe reply = %+v", r)
+	}
+	send(`{"type":"subscribe","topics":["*"]}`)
+	if r := reply(); !reflect.DeepEqual(r.Topics, []string{"*"}) {
+		t.Fatalf("subscribe * reply = %+v", r)
+	}
+	if got := readFrames(t, conn, 1); got[0] != snap {
+		t.Fatalf("snapshot on subscribe * = %q", got)
+	}
+
+	// Errors are answered and the connection stays usable.
+	send(`{"type":"subscribe","id":"bad","filter":"line=J06"}`)
+	if r := reply(); r.Type != ControlError || r.ID != "bad" {
+		t.Fatalf("invalid filter reply = %+v", r)
+	}
+	send(`{"type":"resume","id":"r1"}`)
+	if r := reply(); r.Type != ControlError || !strings.Contains(r.Error, "resume") {
+		t.Fatalf("unknown type reply = %+v", r)
+	}
+	send(`not json`)
+	if r := reply(); r.Type != ControlError {
+		t.Fatalf("non-JSON reply = %+v", r)
+	}
+	h.Broadcast([]byte(alert))
+	if got := readFrames(t, conn, 1); got[0] != alert {
+		t.Fatalf("after errors got %q", got)
+	}
+}
+
+func TestBroadcastAfterShutdown(t *testing.T) {
+	h, srv := newTestHub(t, Options{})
+	conn := dial(t, srv, "")
+	waitClients(t, h, 1)
+
+	// Broadcasters racing the shutdown either deliver or get ErrHubClosed, never a panic.
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if err := h.Broadcast([]byte(`{"a":1}`)); err != nil && !errors.Is(err, ErrHubClosed) {
+					t.Errorf("Broadcast: %v", err)
+				}
+			}
+		}()
+	}
+	h.Shutdown()
+	wg.Wait()
+
+	if err := h.Broadcast([]byte(`{"a":1}`)); !errors.Is(err, ErrHubClosed) {
+		t.Fatalf("Broadcast after Shutdown = %v, want ErrHubClosed", err)
+	}
+	h.Shutdown()
+
+	// The connected client is closed; new ones are turned away.
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			break
+		}
+	}
+	late := dial(t, srv, "")
+	_ = late.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, _, err := late.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Fatalf("client after Shutdown: %v, want going-away close", err)
+	}
+}
+
+func TestShutdownDeliversQueued(t *testing.T) {
+	h, srv := newTestHub(t, Options{})
+	conn := dial(t, srv, "")
+	waitClients(t, h, 1)
+
+	// Stall Run so the messages are still queued when Shutdown starts.
+	const n = 50
+	h.mu.Lock()
+	for i := 0; i < n; i++ {
+		if err := h.Broadcast([]byte(fmt.Sprintf(`{"n":%d}`, i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stopped := make(chan struct{})
+	go func() { h.Shutdown(); close(stopped) }()
+	time.Sleep(20 * time.Millisecond)
+	h.mu.Unlock()
+	<-stopped
+
+	// Every queued message arrives, in order, before the close frame.
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for i := 0; ; i++ {
+		_, b, err := conn.ReadMessage()
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseNoStatusReceived) || i != n {
+				t.Fatalf("read %d of %d messages, then %v", i, n, err)
+			}
+			break
+		}
+		if want := fmt.Sprintf(`{"n":%d}`, i); string(b) != want {
+			t.Fatalf("message %d = %s, want %s", i, b, want)
+		}
+	}
+}
+
+func TestPollHandler(t *testing.T) {
+	h, _ := newTestHub(t, Options{})
+	srv := httptest.NewServer(PollHandler(h, PollOptions{Timeout: 100 * time.Millisecond}))
+	t.Cleanup(srv.Close)
+
+	poll := func(query string) (int, PollResponse) {
+		t.Helper()
+		res, err := http.Get(srv.URL + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		var resp PollResponse
+		if res.StatusCode == http.StatusOK {
+			if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return res.StatusCode, resp
+	}
+	seqs := func(resp PollResponse) []uint64 {
+		var out []uint64
+		for _, m := range resp.Messages {
+			out = append(out, m.Seq)
+		}
+		return out
+	}
+
+	for _, m := range []string{
+		`{"massage_type":"LAST_HOUR","massage":{"J01_PACKING":1}}`,
+		`{"massage_type":"ALERT","massage":{"key":"k"},"meta":{"severity":"warning"}}`,
+		`{"massage_type":"LAST_HOUR","massage":{"J01_PACKING":2}}`,
+	} {
+		if err := h.Broadcast([]byte(m)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for h.replay.current() < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// Replay from the start, one topic at a time; the cursor skips the other topics.
+	if code, resp := poll("?since_seq=0&topic=LAST_HOUR"); code != http.StatusOK || resp.Seq != 3 ||
+		!reflect.DeepEqual(seqs(resp), []uint64{1, 3}) || resp.Reset {
+		t.Fatalf("poll = %d %+v, want LAST_HOUR messages 1 and 3", code, resp)
+	}
+	if _, resp := poll("?since_seq=1&filter=" + url.QueryEscape(`type=="ALERT" && severity=="warning"`)); !reflect.DeepEqual(seqs(resp), []uint64{2}) ||
+		!strings.Contains(string(resp.Messages[0].Envelope), `"ALERT"`) {
+		t.Fatalf("filtered poll = %+v, want the ALERT envelope", resp)
+	}
+
+	// Nothing new: the poll is held until the timeout and answers empty with the cursor.
+	if _, resp := poll("?since_seq=3"); resp.Seq != 3 || len(resp.Messages) != 0 {
+		t.Fatalf("idle poll = %+v, want no messages at seq 3", resp)
+	}
+
+	// A held poll returns as soon as a message is broadcast.
+	done := make(chan PollResponse)
+	go func() {
+		_, resp := poll("?since_seq=3")
+		done <- resp
+	}()
+	time.Sleep(20 * time.Millisecond)
+	if err := h.Broadcast([]byte(`{"massage_type":"LAST_UPDATE","massage":{}}`)); err != nil {
+		t.Fatal(err)
+	}
+	if resp := <-done; resp.Seq != 4 || !reflect.DeepEqual(seqs(resp), []uint64{4}) {
+		t.Fatalf("held poll = %+v, want message 4", resp)
+	}
+
+	// A cursor from before a restart resets to the buffered messages.
+	if _, resp := poll("?since_seq=99"); !resp.Reset || len(resp.Messages) != 4 {
+		t.Fatalf("poll past the end = %+v, want a reset with all 4 messages", resp)
+	}
+	if code, _ := poll("?since_seq=-1"); code != http.StatusBadRequest {
+		t.Fatalf("invalid since_seq = %d, want 400", code)
+	}
+}
+
+func TestReplayBufferWraps(t *testing.T) {
+	b := newReplayBuffer(3)
+	for i := 0; i < 5; i++ {
+		b.add([]byte(`{}`), nil)
+	}
+	all := func(map[string]string) bool { return true }
+	out, last, reset, _ := b.since(1, 10, all)
+	if len(out) != 3 || out[0].seq != 3 || last != 5 || !reset {
+		t.Fatalf("since(1) = %d messages from %d, last %d, reset %v; want 3..5 with a reset", len(out), out[0].seq, last, reset)
+	}
+	if out, last, reset, _ = b.since(3, 1, all); len(out) != 1 || out[0].seq != 4 || last != 4 || reset {
+		t.Fatalf("since(3) limited to 1 = %+v, last %d, reset %v; want message 4", out, last, reset)
+	}
+}
+
+func TestBandwidth(t *testing.T) {
+	h, srv := newTestHub(t, Options{})
+	b := NewBandwidth()
+	now := time.Date(2026, 3, 2, 8, 0, 30, 0, time.UTC)
+	b.now = func() time.Time { return now }
+	h.SetBandwidth(b)
+	conn := dial(t, srv, "")
+	waitClients(t, h, 1)
+
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"hello","name":"Kiosk J06"}`)); err != nil {
+		t.Fatal(err)
+	}
+	ack := readFrames(t, conn, 1)[0]
+	big := `{"massage_type":"LAST_HOUR","massage":{"rows":"` + strings.Repeat("x", 100) + `"}}`
+	small := `{"massage_type":"ALERT","massage":{}}`
+	for _, m := range []string{big, small, big} {
+		h.Broadcast([]byte(m))
+	}
+	readFrames(t, conn, 3)
+
+	want := uint64(len(ack) + 2*len(big) + len(small))
+	var rep BandwidthReport
+	deadline := time.Now().Add(2 * time.Second)
+	for rep = b.Report(); rep.SentBytes != want && time.Now().Before(deadline); rep = b.Report() {
+		time.Sleep(5 * time.Millisecond) // the pump counts a frame after writing it
+	}
+	if rep.SentBytes != want || rep.SentBytesLastMinute != want || len(rep.Clients) != 1 {
+		t.Fatalf("report = %+v, want %d bytes to one client", rep, want)
+	}
+	if c := rep.Clients[0]; c.Name != "Kiosk J06" || c.Frames != 4 || c.SentBytes != want || c.Remote == "" {
+		t.Errorf("client = %+v", c)
+	}
+	if len(rep.Topics) != 2 {
+		t.Fatalf("topics = %+v", rep.Topics)
+	}
+	if top := rep.Topics[0]; top.Topic != "LAST_HOUR" || top.Messages != 2 || top.Deliveries != 2 ||
+		top.SentBytes != uint64(2*len(big)) || top.MaxPayloadBytes != len(big) || top.AvgPayloadBytes != float64(len(big)) ||
+		len(top.PerMinute) != 1 || !top.PerMinute[0].Minute.Equal(now.Truncate(time.Minute)) {
+		t.Errorf("top topic = %+v", top)
+	}
+
+	// the minute and hour windows move on; the totals stay
+	b.mu.Lock()
+	now = now.Add(2 * time.Minute)
+	b.mu.Unlock()
+	if rep := b.Report(); rep.SentBytesLastMinute != 0 || rep.SentBytesLastHour != want || rep.SentBytes != want {
+		t.Errorf("two minutes later: %+v", rep)
+	}
+	b.mu.Lock()
+	now = now.Add(time.Hour)
+	b.mu.Unlock()
+	if rep := b.Report(); rep.SentBytesLastHour != 0 || rep.Topics[0].PerMinute != nil || rep.SentBytes != want {
+		t.Errorf("an hour later: %+v", rep)
+	}
+
+	_ = conn.Close()
+	deadline = time.Now().Add(2 * time.Second)
+	for rep = b.Report(); len(rep.Clients) > 0 && time.Now().Before(deadline); rep = b.Report() {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if len(rep.Clients) != 0 || rep.DepartedBytes != want {
+		t.Errorf("after disconnect: %+v", rep)
+	}
+}
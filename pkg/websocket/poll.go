@@ -0,0 +1,204 @@
+package websocket
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"hex_toolset/pkg/api"
+)
+
+const (
+	// DefaultReplaySize is the number of recent messages the hub keeps for long-polling clients.
+	DefaultReplaySize = 1024
+	// DefaultPollTimeout is how long a poll waits for a new message before answering empty.
+	DefaultPollTimeout = 25 * time.Second
+	// DefaultPollMax bounds the messages returned by one poll.
+	DefaultPollMax = 256
+)
+
+// replayed is one broadcast message kept in the replay buffer.
+type replayed struct {
+	seq  uint64
+	msg  []byte
+	meta map[string]string // EnvelopeMeta of msg
+}
+
+// replayBuffer numbers every broadcast message and keeps the last size of them, so clients
+// that cannot hold a websocket open can fetch what they missed since a sequence number.
+// Sequence numbers start at 1 and restart with the process.
+type replayBuffer struct {
+	mu   sync.Mutex
+	ring []replayed
+	next int // index of the slot written next
+	full bool
+	seq  uint64
+	wake chan struct{} // closed and replaced on every append
+}
+
+func newReplayBuffer(size int) *replayBuffer {
+	if size <= 0 {
+		size = DefaultReplaySize
+	}
+	return &replayBuffer{ring: make([]replayed, size), wake: make(chan struct{})}
+}
+
+// add appends msg and wakes the waiting pollers. Messages that are not JSON are not kept:
+// they cannot be embedded in a poll response.
+func (b *replayBuffer) add(msg []byte, meta map[string]string) {
+	if !json.Valid(msg) {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.seq++
+	b.ring[b.next] = replayed{seq: b.seq, msg: msg, meta: meta}
+	b.next = (b.next + 1) % len(b.ring)
+	if b.next == 0 {
+		b.full = true
+	}
+	close(b.wake)
+	b.wake = make(chan struct{})
+}
+
+// since returns up to limit kept messages after seq accepted by match, oldest first, and the
+// sequence number to poll from next. reset reports that messages after seq were already
+// evicted, or that seq is from before a restart; the messages then start at the oldest
+// kept. wake is closed by the next add, for callers that got nothing and want to wait.
+func (b *replayBuffer) since(seq uint64, limit int, match func(map[string]string) bool) (out []replayed, last uint64, reset bool, wake <-chan struct{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	kept := b.next
+	if b.full {
+		kept = len(b.ring)
+	}
+	oldest := b.seq - uint64(kept) + 1
+	if seq > b.seq || (kept > 0 && seq+1 < oldest) {
+		reset = seq != 0 || oldest > 1
+		seq = oldest - 1
+	}
+	last = seq
+	for i := 0; i < kept && len(out) < limit; i++ {
+		r := b.ring[(b.next-kept+i+len(b.ring))%len(b.ring)]
+		if r.seq <= seq {
+			continue
+		}
+		last = r.seq
+		if match(r.meta) {
+			out = append(out, r)
+		}
+	}
+	return out, last, reset, b.wake
+}
+
+// current returns the last sequence number handed out.
+func (b *replayBuffer) current() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.seq
+}
+
+// PollOptions configures PollHandler.
+type PollOptions struct {
+	// Timeout is how long a poll without new messages is held open. 0 uses DefaultPollTimeout.
+	Timeout time.Duration
+	// MaxMessages bounds the messages of one response. 0 uses DefaultPollMax.
+	MaxMessages int
+}
+
+// PollMessage is one envelope of a poll response with its sequence number.
+type PollMessage struct {
+	Seq      uint64          `json:"seq"`
+	Envelope json.RawMessage `json:"envelope"`
+}
+
+// PollResponse answers a long poll. Clients pass Seq as since_seq of the next poll; Reset
+// reports that messages were lost in between (the buffer wrapped or the service restarted)
+// and the client should reload its full state.
+type PollResponse struct {
+	Seq      uint64        `json:"seq"`
+	Reset    bool          `json:"reset,omitempty"`
+	Messages []PollMessage `json:"messages"`
+}
+
+// PollHandler serves the hub's messages to clients without websocket support, e.g. behind
+// proxies that drop upgrades: GET ?since_seq=<n>&topic=<TYPE[,TYPE]>&filter=<expression>
+// returns the envelopes broadcast after n, or holds the request until one is broadcast or
+// the timeout passes. Without since_seq the poll starts from the latest message, so the
+// first call only returns the cursor (once a message arrives or on timeout); since_seq=0
+// returns everything still buffered. topic and filter select messages as ?filter= does on
+// the websocket endpoint.
+func PollHandler(h *Hub, opts PollOptions) api.HandlerFunc {
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultPollTimeout
+	}
+	if opts.MaxMessages <= 0 {
+		opts.MaxMessages = DefaultPollMax
+	}
+	return func(w http.ResponseWriter, r *http.Request) error {
+		q := r.URL.Query()
+		seq := h.replay.current()
+		if s := q.Get("since_seq"); s != "" {
+			n, err := strconv.ParseUint(s, 10, 64)
+			if err != nil {
+				return api.InvalidRequest("since_seq must be a non-negative integer, got %q", s)
+			}
+			seq = n
+		}
+		var topics map[string]bool
+		if t := strings.TrimSpace(q.Get("topic")); t != "" {
+			topics = map[string]bool{}
+			for _, name := range strings.Split(t, ",") {
+				if name = strings.TrimSpace(name); name != "" {
+					topics[name] = true
+				}
+			}
+		}
+		var filter *Filter
+		if expr := q.Get("filter"); strings.TrimSpace(expr) != "" {
+			f, err := ParseFilter(expr)
+			if err != nil {
+				return api.InvalidRequest("%v", err)
+			}
+			filter = f
+		}
+		match := func(meta map[string]string) bool {
+			if topics != nil && !topics[meta["type"]] {
+				return false
+			}
+			return filter == nil || filter.Match(meta)
+		}
+
+		// The held request outlives the server's WriteTimeout.
+		_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(opts.Timeout + 10*time.Second))
+		timer := time.NewTimer(opts.Timeout)
+		defer timer.Stop()
+		resp := PollResponse{Messages: []PollMessage{}}
+	poll:
+		for {
+			msgs, last, reset, wake := h.replay.since(seq, opts.MaxMessages, match)
+			resp.Reset = resp.Reset || reset
+			resp.Seq, seq = last, last
+			for _, m := range msgs {
+				resp.Messages = append(resp.Messages, PollMessage{Seq: m.seq, Envelope: m.msg})
+			}
+			if len(msgs) > 0 {
+				break
+			}
+			select {
+			case <-wake:
+			case <-timer.C:
+				break poll
+			case <-h.done:
+				break poll
+			case <-r.Context().Done():
+				return nil
+			}
+		}
+		api.WriteJSON(w, http.StatusOK, resp)
+		return nil
+	}
+}
@@ -0,0 +1,72 @@
+package websocket
+
+import "fmt"
+
+// SnapshotViews lets clients receive a snapshot topic at a chosen granularity: a client
+// connecting with ?snapshot=<view> gets every message of Topic rendered as that view, and
+// the latest one as soon as it subscribes. The hub renders each view once per message, so
+// a kiosk showing counts does not download the full snapshot.
+type SnapshotViews struct {
+	Topic string // massage_type of the snapshot messages
+	// Views are the accepted ?snapshot= values; Views[0] is the message as published and
+	// the view of clients that do not ask for one.
+	Views []string
+	// Render returns msg reduced to view (never Views[0]).
+	Render func(msg []byte, view string) ([]byte, error)
+}
+
+// SetSnapshotViews enables ?snapshot= for v.Topic; call it before clients connect.
+func (h *Hub) SetSnapshotViews(v SnapshotViews) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.views = &v
+}
+
+// snapshotView validates a ?snapshot= value and returns the view to render, "" for the
+// message as published.
+func (h *Hub) snapshotView(view string) (string, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if view == "" {
+		return "", nil
+	}
+	if h.views == nil {
+		return "", fmt.Errorf("snapshot views are not available")
+	}
+	for i, v := range h.views.Views {
+		if v == view {
+			if i == 0 {
+				return "", nil
+			}
+			return view, nil
+		}
+	}
+	return "", fmt.Errorf("snapshot must be one of %v, got %q", h.views.Views, view)
+}
+
+// snapshot is the latest message of the snapshot topic and its views rendered so far,
+// used by the Run goroutine under h.mu.
+type snapshot struct {
+	msg      []byte
+	meta     map[string]string
+	rendered map[string][]byte
+}
+
+// render returns the latest snapshot as view, rendering it on first use. A view that fails
+// to render is sent as published; the error is returned once.
+func (h *Hub) render(view string) ([]byte, error) {
+	s := h.latest
+	if view == "" {
+		return s.msg, nil
+	}
+	if b, ok := s.rendered[view]; ok {
+		return b, nil
+	}
+	b, err := h.views.Render(s.msg, view)
+	if err != nil {
+		s.rendered[view] = s.msg
+		return s.msg, fmt.Errorf("render %s snapshot as %q: %w", h.views.Topic, view, err)
+	}
+	s.rendered[view] = b
+	return b, nil
+}